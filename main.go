@@ -26,6 +26,18 @@ func main() {
 
 	vm := executor.NewVM(engine)
 
+	// the bodies of triggers are compiled when they fire, with NEW / OLD bound to the row
+	vm.SetCompiler(func(sql string, old, new map[string]interface{}) ([]executor.Instruction, error) {
+		p := parser.New(lex.New(sql))
+		p.SetViews(engine.LookupView)
+		p.SetTriggerRow(old, new)
+		stmt, err := p.ParseStatement()
+		if err != nil {
+			return nil, err
+		}
+		return codegen.EmitBytecode(stmt)
+	})
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 	go func() {
@@ -70,6 +82,7 @@ func main() {
 		// Lexer + Parser
 		l := lex.New(query)
 		p := parser.New(l)
+		p.SetViews(engine.LookupView)
 
 		stmt, err := p.ParseStatement()
 		if err != nil {
@@ -103,11 +116,30 @@ func printHelp() {
 	fmt.Println("  SHOW DATABASES")
 	fmt.Println("  CREATE DATABASE <name>")
 	fmt.Println("  USE <database>")
-	fmt.Println("  CREATE TABLE <name> ( col type [primary key], ... )")
+	fmt.Println("  CREATE TABLE <name> ( col type [primary key] [GENERATED ALWAYS AS (expr) [STORED|VIRTUAL]], ... )")
 	fmt.Println("  INSERT INTO <table> VALUES ( val1, val2, ... )")
-	fmt.Println("  SELECT * FROM <table> [ WHERE col = value ]")
-	fmt.Println("  SELECT * FROM t1 [ INNER|LEFT|RIGHT|FULL ] JOIN t2 ON col1 = col2 [ WHERE ... ]")
+	fmt.Println("  INSERT INTO <table> VALUES (...) ON CONFLICT [(pk)] DO NOTHING | DO UPDATE SET col = EXCLUDED.col, ... [WHERE ...]")
+	fmt.Println("  UPDATE <table> [[AS] a] SET col = expr, ... [FROM t2 [AS] b [JOIN ...]] [WHERE expr]")
+	fmt.Println("  DELETE FROM <table> [[AS] a] [USING t2 [AS] b [JOIN ...]] [WHERE expr]")
+	fmt.Println("  INSERT ... | UPDATE ... | DELETE ... RETURNING * | expr [AS alias], ...")
+	fmt.Println("  SELECT * | expr [AS alias], ... FROM <table> [ WHERE expr ] [ ORDER BY expr [ASC|DESC], ... ]")
+	fmt.Println("  functions: UPPER LOWER LENGTH SUBSTR TRIM CONCAT REPLACE ABS ROUND FLOOR CEIL MOD POWER COALESCE NULLIF, CASE WHEN ... END")
+	fmt.Println("  CAST(expr AS type) or expr::type  (INT, FLOAT, VARCHAR)")
+	fmt.Println("  predicates: AND OR NOT, [NOT] LIKE|ILIKE 'p%' [ESCAPE 'c'], [NOT] IN (...), [NOT] BETWEEN a AND b")
+	fmt.Println("  subqueries: x [NOT] IN (SELECT ...), [NOT] EXISTS (SELECT ...), (SELECT ...) as a value, FROM (SELECT ...) alias")
+	fmt.Println("  SELECT * FROM t1 [AS] a [NATURAL] [ INNER|LEFT|RIGHT|FULL [OUTER] ] JOIN t2 [AS] b { ON a.x = b.y | USING (col, ...) } ...")
+	fmt.Println("  SELECT * FROM t1 a CROSS JOIN t2 b   |   SELECT * FROM t1 a, t2 b WHERE a.ts BETWEEN b.lo AND b.hi")
+	fmt.Println("  SELECT DISTINCT ...   |   SELECT ... { UNION | INTERSECT | EXCEPT } [ALL] SELECT ... [ ORDER BY ... ]")
+	fmt.Println("  WITH [RECURSIVE] name [(col, ...)] AS (SELECT ...), ... SELECT ...")
+	fmt.Println("  SELECT f(...) OVER ([PARTITION BY ...] [ORDER BY ...] [ROWS|RANGE BETWEEN ... AND ...]) FROM t")
+	fmt.Println("  CREATE [OR REPLACE] VIEW v [(col, ...)] AS SELECT ...   |   DROP VIEW v")
+	fmt.Println("  CREATE MATERIALIZED VIEW m AS SELECT ...   |   REFRESH MATERIALIZED VIEW [CONCURRENTLY] m   |   DROP MATERIALIZED VIEW m")
+	fmt.Println("  CREATE TRIGGER name BEFORE|AFTER INSERT|UPDATE|DELETE ON t FOR EACH ROW { stmt | BEGIN stmt; stmt; ... END }   (NEW.col, OLD.col)   |   DROP TRIGGER name")
+	fmt.Println("  ANALYZE [table]   (collect statistics for the cost-based planner)")
+	fmt.Println("  EXPLAIN [ANALYZE] [FORMAT TEXT|JSON] SELECT ...   (show the query plan; ANALYZE runs it)")
 	fmt.Println("  BEGIN; COMMIT; ROLLBACK")
+	fmt.Println("  BEGIN [ISOLATION LEVEL READ COMMITTED|REPEATABLE READ|SERIALIZABLE]   |   SET TRANSACTION ISOLATION LEVEL ...   |   SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL ...")
+	fmt.Println("  SAVEPOINT name; ROLLBACK TO [SAVEPOINT] name; RELEASE [SAVEPOINT] name")
+	fmt.Println("  SELECT * FROM sys.locks   (granted and waiting locks)")
 	fmt.Println("  exit")
-	fmt.Println("Note: UPDATE/DELETE/DROP are parsed but not executed yet.")
 }
@@ -1,6 +1,7 @@
 package executor
 
 import (
+	storageengine "DaemonDB/storage_engine"
 	"fmt"
 )
 
@@ -11,11 +12,13 @@ Called when the user executes INSERT/UPDATE/DELETE without an explicit BEGIN/COM
 
 // autoTransactionBegin starts an implicit transaction for a single statement.
 func (vm *VM) autoTransactionBegin() error {
-	txn, err := vm.storageEngine.BeginTransaction()
+	txn, err := vm.storageEngine.BeginTransaction(vm.isolation)
 
 	if err != nil {
 		return fmt.Errorf("failed to begin txn: %w", err)
 	}
+	// the triggers its statement fires run in this VM
+	vm.storageEngine.SetTriggerRunner(txn, vm.runTrigger)
 
 	vm.currentTxn = txn
 	vm.autoTxn = true
@@ -35,6 +38,11 @@ func (vm *VM) autoTransactionCommit() error {
 	// Mark transaction as committed.
 	// This removes it from the TxnManager's active set.
 	if err := vm.storageEngine.CommitTransaction(txnID); err != nil {
+		if storageengine.IsSerializationFailure(err) {
+			// the commit rolled it back
+			vm.currentTxn = nil
+			vm.autoTxn = false
+		}
 		return err
 	}
 
@@ -0,0 +1,53 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+ExecAnalyze handles ANALYZE [table] execution.
+Collects the optimizer statistics of one table, or of every table when the
+name is empty, and prints them.
+*/
+
+func (vm *VM) ExecAnalyze(tableName string) error {
+	if vm.storageEngine == nil {
+		return fmt.Errorf("storage engine not initialized")
+	}
+
+	if err := vm.storageEngine.RequireDatabase(); err != nil {
+		return fmt.Errorf("no database selected. Run: USE <dbname>")
+	}
+
+	tables := []string{tableName}
+	if tableName == "" {
+		var err error
+		if tables, err = vm.storageEngine.AnalyzeAllTables(); err != nil {
+			return fmt.Errorf("analyze failed: %w", err)
+		}
+	} else {
+		if !vm.storageEngine.CatalogManager.TableExists(tableName) {
+			return fmt.Errorf("table '%s' does not exist", tableName)
+		}
+		if _, err := vm.storageEngine.AnalyzeTable(tableName); err != nil {
+			return fmt.Errorf("analyze failed: %w", err)
+		}
+	}
+
+	for _, table := range tables {
+		stats, _ := vm.storageEngine.CatalogManager.GetTableStats(table)
+		schema, err := vm.storageEngine.CatalogManager.GetTableSchema(table)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("[VM] Analyzed %s: %d rows, %d pages\n", table, stats.RowCount, stats.PageCount)
+		for _, col := range schema.Columns {
+			colStats := stats.Columns[strings.ToLower(col.Name)]
+			fmt.Printf("  %-16s distinct=%-6d null_frac=%.2f histogram=%v\n",
+				col.Name, colStats.Distinct, colStats.NullFrac, colStats.Histogram)
+		}
+	}
+	return nil
+}
@@ -4,11 +4,16 @@ import (
 	"DaemonDB/types"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 /*
 This file contains command related to create table,
 the vm function does the pre processing like building schema and validation foreign keys before sending it to the storage engine
+
+a generated column (GENERATED ALWAYS AS (expr) [STORED | VIRTUAL]) may only read the
+ordinary columns of its table, without subqueries or window functions, and its
+expression must be assignable to the column type
 */
 
 func (vm *VM) ExecuteCreateTable(tableName string) error {
@@ -20,8 +25,9 @@ func (vm *VM) ExecuteCreateTable(tableName string) error {
 	vm.stack = vm.stack[:len(vm.stack)-1]
 
 	var payload struct {
-		Columns     string                `json:"columns"`
-		ForeignKeys []types.ForeignKeyDef `json:"foreign_keys"`
+		Columns     string                           `json:"columns"`
+		ForeignKeys []types.ForeignKeyDef            `json:"foreign_keys"`
+		Generated   map[string]types.GeneratedColumn `json:"generated"`
 	}
 
 	if err := json.Unmarshal([]byte(schemaPayload), &payload); err != nil {
@@ -34,6 +40,12 @@ func (vm *VM) ExecuteCreateTable(tableName string) error {
 		return err
 	}
 
+	for i := range columnDefs {
+		if gen, ok := payload.Generated[columnDefs[i].Name]; ok {
+			columnDefs[i].Generated = &gen
+		}
+	}
+
 	// Build schema object
 	schema := types.TableSchema{
 		TableName:   tableName,
@@ -41,6 +53,10 @@ func (vm *VM) ExecuteCreateTable(tableName string) error {
 		ForeignKeys: payload.ForeignKeys,
 	}
 
+	if err := checkGeneratedColumns(schema); err != nil {
+		return err
+	}
+
 	// Validate foreign keys (semantic validation only)
 	if err := vm.validateForeignKeys(schema); err != nil {
 		return err
@@ -54,3 +70,64 @@ func (vm *VM) ExecuteCreateTable(tableName string) error {
 	fmt.Printf("Table %s created successfully\n", tableName)
 	return nil
 }
+
+// checkGeneratedColumns type checks the expressions of the generated columns of schema.
+func checkGeneratedColumns(schema types.TableSchema) error {
+	ordinary := types.TableSchema{TableName: schema.TableName}
+	generated := map[string]bool{}
+	for _, col := range schema.Columns {
+		if col.Generated != nil {
+			generated[strings.ToLower(col.Name)] = true
+		} else {
+			ordinary.Columns = append(ordinary.Columns, col)
+		}
+	}
+	if len(generated) == 0 {
+		return nil
+	}
+	if len(ordinary.Columns) == 0 {
+		return fmt.Errorf("table '%s' needs a column that is not generated", schema.TableName)
+	}
+
+	columns := types.SchemaResolver(ordinary)
+	for _, col := range schema.Columns {
+		if col.Generated == nil {
+			continue
+		}
+		resolve := func(name string) (string, error) {
+			bare := strings.ToLower(name[strings.LastIndex(name, ".")+1:])
+			if generated[bare] {
+				return "", fmt.Errorf("cannot refer to generated column %s", name)
+			}
+			return columns(name)
+		}
+
+		expr := col.Generated.Expr
+		if containsSubquery(expr) {
+			return fmt.Errorf("generated column %s: subqueries are not allowed", col.Name)
+		}
+		if err := checkNoWindow(expr, "generated columns"); err != nil {
+			return err
+		}
+		if err := types.CheckAssignable(expr, col.Name, col.Type, resolve); err != nil {
+			return fmt.Errorf("generated column %s: %w", col.Name, err)
+		}
+	}
+	return nil
+}
+
+// containsSubquery reports whether expr has a subquery anywhere in it.
+func containsSubquery(expr *types.ExpressionNode) bool {
+	if expr == nil {
+		return false
+	}
+	if expr.Subquery != nil {
+		return true
+	}
+	for _, child := range expr.Children() {
+		if containsSubquery(child) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,22 @@
 package executor
 
 import (
+	"DaemonDB/types"
+	"encoding/json"
 	"fmt"
-	"strings"
 )
 
+/*
+This file contains the delete query
+
+the WHERE (any predicate, over the table and the USING items) is type checked first,
+the storage engine then finds the matching rows (TargetRows, through the primary key
+index when the WHERE allows it) and deletes them by row pointer (DeleteRowsAt),
+in an auto transaction like INSERT and UPDATE so that DELETE triggers write in it
+*/
+
 // ExecDelete executes DELETE through the storage engine
-func (vm *VM) ExecDelete(table string, whereCol string, whereVal string) error {
+func (vm *VM) ExecDelete(table string) error {
 
 	if vm.storageEngine == nil {
 		return fmt.Errorf("storage engine not initialized")
@@ -17,40 +27,121 @@ func (vm *VM) ExecDelete(table string, whereCol string, whereVal string) error {
 		return fmt.Errorf("no database selected. Run: USE <dbname>")
 	}
 
+	if len(vm.stack) == 0 {
+		return fmt.Errorf("stack underflow: no delete payload")
+	}
+	payloadJSON := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+
+	var payload types.DeletePayload
+	if err := json.Unmarshal(payloadJSON, &payload); err != nil {
+		return fmt.Errorf("invalid delete payload: %w", err)
+	}
+
 	if table == "" {
 		return fmt.Errorf("table name cannot be empty")
 	}
 
 	// Validate table existence
+	if err := vm.checkNotView(table); err != nil {
+		return err
+	}
 	if !vm.storageEngine.CatalogManager.TableExists(table) {
 		return fmt.Errorf("table '%s' does not exist", table)
 	}
 
-	// Optional column validation
-	if whereCol != "" {
-		schema, err := vm.storageEngine.CatalogManager.GetTableSchema(table)
-		if err != nil {
-			return fmt.Errorf("failed to fetch schema: %w", err)
+	target := types.TableRef{Table: table, Alias: payload.Alias}
+	schema, _, err := vm.checkTargetWhere(target, payload.Using, payload.WhereExpr)
+	if err != nil {
+		return err
+	}
+	if err := vm.checkReturning(schema); err != nil {
+		return err
+	}
+
+	fmt.Printf("[VM] Deleting rows from table: %s\n", table)
+
+	// the DELETE triggers write in the statement's transaction, and its
+	// subqueries read with its snapshot
+	if vm.currentTxn == nil {
+		if err := vm.autoTransactionBegin(); err != nil {
+			return fmt.Errorf("failed to auto-begin transaction: %w", err)
+		}
+	}
+	if err := vm.storageEngine.BindSubqueries(vm.currentTxn, payload.WhereExpr); err != nil {
+		if vm.autoTxn {
+			_ = vm.autoTransactionAbort()
 		}
+		return err
+	}
 
-		found := false
-		for _, col := range schema.Columns {
-			if strings.EqualFold(col.Name, whereCol) {
-				found = true
-				break
-			}
+	if err := vm.deleteTargets(target, payload); err != nil {
+		if vm.autoTxn {
+			_ = vm.autoTransactionAbort()
 		}
+		return err
+	}
 
-		if !found {
-			return fmt.Errorf("column '%s' not found in table '%s'", whereCol, table)
+	if vm.autoTxn {
+		if err := vm.autoTransactionCommit(); err != nil {
+			return fmt.Errorf("failed to auto-commit: %w", err)
 		}
 	}
+	vm.printReturning()
+	return nil
+}
 
-	fmt.Printf("[VM] Deleting rows from table: %s\n", table)
+// deleteTargets deletes the rows of target matched by the DELETE and collects
+// its RETURNING rows.
+func (vm *VM) deleteTargets(target types.TableRef, payload types.DeletePayload) error {
+	targets, err := vm.storageEngine.TargetRows(vm.currentTxn, target, payload.Using, payload.WhereExpr)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	ptrs := make([]types.RowPointer, len(targets))
+	for i, t := range targets {
+		ptrs[i] = t.Pointer
+	}
 
-	if err := vm.storageEngine.DeleteRows(table, whereCol, whereVal); err != nil {
+	deleted, err := vm.storageEngine.DeleteRowsAt(vm.currentTxn, target.Table, ptrs)
+	if err != nil {
 		return fmt.Errorf("delete failed: %w", err)
 	}
 
+	// RETURNING sees the deleted rows
+	for _, row := range deleted {
+		if err := vm.collectReturning(target.Name(), row.Values); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// checkTargetWhere type checks the WHERE of an UPDATE or DELETE over its target
+// table and FROM / USING items. It returns the target's schema under the name
+// the statement refers to it by, and the resolver for expressions over them all.
+func (vm *VM) checkTargetWhere(target types.TableRef, joins []types.JoinClause, where *types.ExpressionNode) (types.TableSchema, types.ColumnTypeResolver, error) {
+	block := types.SelectPayload{Table: target.Table, Alias: target.Alias, Joins: joins}
+	schemas, _, resolve, err := vm.checkFromItems(&block, nil)
+	if err != nil {
+		return types.TableSchema{}, nil, err
+	}
+
+	if where != nil {
+		if err := checkNoWindow(where, "WHERE"); err != nil {
+			return types.TableSchema{}, nil, err
+		}
+		if err := vm.checkSubqueries(where, resolve); err != nil {
+			return types.TableSchema{}, nil, fmt.Errorf("WHERE: %w", err)
+		}
+		if err := types.CheckPredicate(where, resolve); err != nil {
+			return types.TableSchema{}, nil, fmt.Errorf("WHERE: %w", err)
+		}
+	}
+	for _, join := range joins {
+		if err := vm.storageEngine.BindSubqueries(vm.currentTxn, join.On); err != nil {
+			return types.TableSchema{}, nil, err
+		}
+	}
+	return schemas[0], resolve, nil
+}
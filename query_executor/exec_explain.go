@@ -0,0 +1,133 @@
+package executor
+
+import (
+	"DaemonDB/types"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+/*
+ExecExplain handles EXPLAIN [ANALYZE] [FORMAT TEXT|JSON] SELECT ...
+The select is type checked like a SELECT, then the storage engine plans it
+(EXPLAIN) or runs it (EXPLAIN ANALYZE) and the operator tree is printed:
+
+	Sort  (cost=4.61 rows=40)
+	  Sort Key: c.name
+	  ->  Hash Join  (cost=4.20 rows=40)
+	        Join Cond: o.cust_id = c.id
+	        ->  Seq Scan on orders AS o  (cost=2.00 rows=100)
+	        ->  Seq Scan on customers AS c  (cost=1.40 rows=40)
+
+or, with FORMAT JSON, the same tree as JSON. With a result handler set
+(SetResultHandler) the lines go to it as the rows of one column, QUERY PLAN.
+*/
+
+func (vm *VM) ExecExplain(payload string) error {
+	if err := vm.storageEngine.RequireDatabase(); err != nil {
+		return fmt.Errorf("no database selected. Run: USE <dbname>")
+	}
+
+	var explain types.ExplainPayload
+	if err := json.Unmarshal([]byte(payload), &explain); err != nil {
+		return fmt.Errorf("invalid explain payload: %w", err)
+	}
+
+	if err := vm.checkSelectTypes(&explain.Select); err != nil {
+		return err
+	}
+
+	plan, err := vm.storageEngine.ExplainSelect(vm.currentTxn, explain.Select, explain.Analyze)
+	if err != nil {
+		return err
+	}
+
+	if explain.Format == "json" {
+		roundPlan(plan)
+		out, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode plan: %w", err)
+		}
+		vm.printPlan(string(out) + "\n")
+		return nil
+	}
+
+	var b strings.Builder
+	writePlanText(&b, plan, 0)
+	if plan.Actual != nil {
+		fmt.Fprintf(&b, "Execution time: %.3f ms\n", plan.Actual.TimeMs)
+	}
+	vm.printPlan(b.String())
+	return nil
+}
+
+// printPlan prints the text of a plan, or hands its lines to the result
+// handler.
+func (vm *VM) printPlan(text string) {
+	if vm.results == nil {
+		fmt.Print(text)
+		return
+	}
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		rows = append(rows, []string{line})
+	}
+	vm.results([]string{"QUERY PLAN"}, rows)
+}
+
+// roundPlan rounds the estimates of a plan to two decimals for display.
+func roundPlan(node *types.PlanNode) {
+	node.EstRows = math.Round(node.EstRows*100) / 100
+	node.EstCost = math.Round(node.EstCost*100) / 100
+	for _, child := range node.Children {
+		roundPlan(child)
+	}
+}
+
+// writePlanText writes node and its children, each child indented below its
+// parent and marked with "->".
+func writePlanText(b *strings.Builder, node *types.PlanNode, depth int) {
+	indent := ""
+	if depth > 0 {
+		indent = strings.Repeat(" ", 6*depth-4) + "->  "
+	}
+	detail := strings.Repeat(" ", 6*depth+2)
+
+	b.WriteString(indent + node.Operator)
+	if node.Relation != "" {
+		b.WriteString(" on " + node.Relation)
+	}
+	fmt.Fprintf(b, "  (cost=%.2f rows=%.0f)", node.EstCost, node.EstRows)
+	if node.Actual != nil {
+		fmt.Fprintf(b, " (actual rows=%d time=%.3f ms hits=%d misses=%d",
+			node.Actual.Rows, node.Actual.TimeMs, node.Actual.BufferHits, node.Actual.BufferMisses)
+		if node.Actual.Partitions > 0 {
+			fmt.Fprintf(b, " partitions=%d peak_rows=%d", node.Actual.Partitions, node.Actual.PeakRows)
+		}
+		b.WriteString(")")
+	}
+	b.WriteString("\n")
+
+	if node.Condition != "" {
+		label := "Cond"
+		switch {
+		case node.Operator == "Sort":
+			label = "Sort Key"
+		case node.Operator == "WindowAgg":
+			label = "Window"
+		case strings.HasPrefix(node.Operator, "Index") && !strings.HasSuffix(node.Operator, "Join"):
+			label = "Index Cond"
+		case strings.HasSuffix(node.Operator, "Join"):
+			label = "Join Cond"
+		}
+		b.WriteString(detail + label + ": " + node.Condition + "\n")
+	}
+	if node.Filter != "" {
+		b.WriteString(detail + "Filter: " + node.Filter + "\n")
+	}
+
+	for _, child := range node.Children {
+		writePlanText(b, child, depth+1)
+	}
+}
@@ -1,20 +1,56 @@
 package executor
 
 import (
+	storageengine "DaemonDB/storage_engine"
+	"DaemonDB/types"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 )
 
 /*
 This file contains command related to inserting value into the table,
 the vm function does the pre processing like getting schema from catalog manager and validation over number of columns passed in the query
 vm also calls auto transaction handlers for the insert operation
+each value arrives as a JSON expression node, it is type checked against the column type,
+evaluated and implicitly cast (e.g. INT → FLOAT) before it reaches the storage engine
+
+INSERT ... ON CONFLICT: the storage engine finds an existing row with the same
+primary key in the B+ tree and reports it as a DuplicateKeyError. DO NOTHING
+then skips the row; DO UPDATE evaluates its SET list on the existing row, with
+the proposed one as EXCLUDED, and updates it in the same transaction, so the
+insert attempt and the update commit or roll back together
 */
 
 func (vm *VM) ExecuteInsert(tableName string) error {
+	return vm.insert(tableName, nil)
+}
+
+// ExecuteUpsert handles INSERT ... ON CONFLICT; the clause is on top of the
+// stack, above the values.
+func (vm *VM) ExecuteUpsert(tableName string) error {
+	if len(vm.stack) == 0 {
+		return fmt.Errorf("stack underflow: no ON CONFLICT clause")
+	}
+	raw := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+
+	var conflict types.OnConflict
+	if err := json.Unmarshal(raw, &conflict); err != nil {
+		return fmt.Errorf("invalid ON CONFLICT clause: %w", err)
+	}
+	return vm.insert(tableName, &conflict)
+}
+
+func (vm *VM) insert(tableName string, conflict *types.OnConflict) error {
 	if err := vm.storageEngine.RequireDatabase(); err != nil {
 		return fmt.Errorf("no database selected. Run: USE <dbname>")
 	}
 
+	if err := vm.checkNotView(tableName); err != nil {
+		return err
+	}
 	schema, err := vm.storageEngine.CatalogManager.GetTableSchema(tableName)
 
 	fmt.Print("schema: %+w", schema)
@@ -22,15 +58,50 @@ func (vm *VM) ExecuteInsert(tableName string) error {
 		return fmt.Errorf("table '%s' not found: %w", tableName, err)
 	}
 
-	if len(vm.stack) < len(schema.Columns) {
+	// VALUES lists the columns that are not generated; the storage engine
+	// computes the others
+	writable := 0
+	var generated *types.ColumnDef
+	for i, col := range schema.Columns {
+		if col.Generated == nil {
+			writable++
+		} else if generated == nil {
+			generated = &schema.Columns[i]
+		}
+	}
+	if generated != nil && len(vm.stack) == len(schema.Columns) {
+		return fmt.Errorf("column %s is a generated column and cannot be written (leave it out of VALUES)", generated.Name)
+	}
+
+	if len(vm.stack) < writable {
 		return fmt.Errorf("stack underflow: need %d values, have %d",
-			len(schema.Columns), len(vm.stack))
+			writable, len(vm.stack))
 	}
 
 	values := make([]any, len(schema.Columns))
 	for i := len(schema.Columns) - 1; i >= 0; i-- {
-		values[i] = vm.stack[len(vm.stack)-1]
+		if schema.Columns[i].Generated != nil {
+			continue
+		}
+		raw := vm.stack[len(vm.stack)-1]
 		vm.stack = vm.stack[:len(vm.stack)-1]
+
+		val, err := vm.evaluateInsertValue(raw, schema.Columns[i])
+		if err != nil {
+			return err
+		}
+		values[i] = val
+	}
+
+	if err := vm.checkReturning(schema); err != nil {
+		return err
+	}
+
+	var colTypes map[string]string
+	if conflict != nil {
+		if colTypes, err = vm.checkOnConflict(schema, conflict); err != nil {
+			return err
+		}
 	}
 
 	// Auto Transaction Begin
@@ -43,6 +114,16 @@ func (vm *VM) ExecuteInsert(tableName string) error {
 
 	err = vm.storageEngine.InsertRow(vm.currentTxn, tableName, values)
 
+	var dup *storageengine.DuplicateKeyError
+	if conflict != nil && errors.As(err, &dup) {
+		err = vm.resolveConflict(schema, values, conflict, colTypes, dup)
+	} else if err == nil {
+		inserted := make(map[string]interface{}, len(values))
+		for i, col := range schema.Columns {
+			inserted[strings.ToLower(col.Name)] = values[i]
+		}
+		err = vm.collectReturning(tableName, inserted)
+	}
 	if err != nil {
 		// Statement failed — if we auto-began, we must abort
 		if vm.autoTxn {
@@ -57,5 +138,161 @@ func (vm *VM) ExecuteInsert(tableName string) error {
 		}
 	}
 
+	vm.printReturning()
 	return nil
 }
+
+// evaluateInsertValue decodes one VALUES expression, checks it can be stored
+// in col and returns it converted to the column type.
+func (vm *VM) evaluateInsertValue(raw []byte, col types.ColumnDef) (any, error) {
+	var expr types.ExpressionNode
+	if err := json.Unmarshal(raw, &expr); err != nil {
+		return nil, fmt.Errorf("invalid insert value for column %s: %w", col.Name, err)
+	}
+
+	noColumns := func(name string) (string, error) {
+		return "", fmt.Errorf("column reference %s is not allowed in VALUES", name)
+	}
+	if err := types.CheckAssignable(&expr, col.Name, col.Type, noColumns); err != nil {
+		return nil, err
+	}
+
+	val, err := types.EvalExpression(&expr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("column %s: %w", col.Name, err)
+	}
+	if val == nil {
+		return nil, fmt.Errorf("column %s: NULL values are not supported", col.Name)
+	}
+
+	colType, err := types.NormalizeType(col.Type)
+	if err != nil {
+		return nil, err
+	}
+	return types.CoerceValue(val, colType)
+}
+
+// checkOnConflict checks the conflict target is the primary key and type
+// checks DO UPDATE; it returns the normalized column types.
+func (vm *VM) checkOnConflict(schema types.TableSchema, conflict *types.OnConflict) (map[string]string, error) {
+	pk := ""
+	colTypes := make(map[string]string, len(schema.Columns))
+	for _, col := range schema.Columns {
+		typ, err := types.NormalizeType(col.Type)
+		if err != nil {
+			return nil, err
+		}
+		colTypes[strings.ToLower(col.Name)] = typ
+		if col.IsPrimaryKey {
+			pk = col.Name
+		}
+	}
+
+	if len(conflict.Columns) > 0 && (pk == "" || len(conflict.Columns) != 1 || !strings.EqualFold(conflict.Columns[0], pk)) {
+		return nil, fmt.Errorf("there is no primary key on (%s) of table '%s' matching the ON CONFLICT specification",
+			strings.Join(conflict.Columns, ", "), schema.TableName)
+	}
+	if !conflict.DoUpdate {
+		return colTypes, nil
+	}
+
+	// unqualified columns are the existing row, EXCLUDED.col the proposed one
+	excluded := schema
+	excluded.TableName = "excluded"
+	resolve := types.ChainResolvers(types.SchemaResolver(schema), types.SchemaResolver(excluded))
+
+	for colName, expr := range conflict.SetExprs {
+		colType, ok := colTypes[strings.ToLower(colName)]
+		if !ok {
+			return nil, fmt.Errorf("column '%s' not found in table '%s'", colName, schema.TableName)
+		}
+		if strings.EqualFold(colName, pk) {
+			return nil, fmt.Errorf("ON CONFLICT DO UPDATE cannot change the primary key column %s", colName)
+		}
+		if err := checkNotGenerated(schema, colName); err != nil {
+			return nil, err
+		}
+		if err := checkNoWindow(&expr, "ON CONFLICT DO UPDATE"); err != nil {
+			return nil, err
+		}
+		if err := vm.checkSubqueries(&expr, resolve); err != nil {
+			return nil, err
+		}
+		if err := types.CheckAssignable(&expr, colName, colType, resolve); err != nil {
+			return nil, err
+		}
+		if err := vm.storageEngine.BindSubqueries(vm.currentTxn, &expr); err != nil {
+			return nil, err
+		}
+		conflict.SetExprs[colName] = expr
+	}
+
+	if conflict.Where != nil {
+		if err := checkNoWindow(conflict.Where, "WHERE"); err != nil {
+			return nil, err
+		}
+		if err := vm.checkSubqueries(conflict.Where, resolve); err != nil {
+			return nil, err
+		}
+		if err := types.CheckPredicate(conflict.Where, resolve); err != nil {
+			return nil, fmt.Errorf("ON CONFLICT WHERE: %w", err)
+		}
+		if err := vm.storageEngine.BindSubqueries(vm.currentTxn, conflict.Where); err != nil {
+			return nil, err
+		}
+	}
+	return colTypes, nil
+}
+
+// resolveConflict applies DO NOTHING or DO UPDATE to the row that kept
+// values from being inserted.
+func (vm *VM) resolveConflict(schema types.TableSchema, values []any, conflict *types.OnConflict, colTypes map[string]string, dup *storageengine.DuplicateKeyError) error {
+	if !conflict.DoUpdate {
+		fmt.Printf("ON CONFLICT: %s = %v exists, nothing done\n", dup.Column, dup.Value)
+		return nil
+	}
+
+	existing, err := vm.storageEngine.ReadRow(schema.TableName, dup.Existing)
+	if err != nil {
+		return err
+	}
+	env := make(map[string]interface{}, 3*len(schema.Columns))
+	for i, col := range schema.Columns {
+		name := strings.ToLower(col.Name)
+		env[name] = existing.Values[name]
+		env[strings.ToLower(schema.TableName)+"."+name] = existing.Values[name]
+		env["excluded."+name] = values[i]
+	}
+
+	if conflict.Where != nil {
+		match, err := types.EvalPredicate(conflict.Where, env)
+		if err != nil {
+			return fmt.Errorf("error evaluating ON CONFLICT WHERE: %w", err)
+		}
+		if !match {
+			fmt.Printf("ON CONFLICT: %s = %v exists, WHERE not satisfied, nothing done\n", dup.Column, dup.Value)
+			return nil
+		}
+	}
+
+	newRow := existing.Clone()
+	for colName, expr := range conflict.SetExprs {
+		val, err := types.EvalExpression(&expr, env)
+		if err == nil {
+			val, err = types.CoerceValue(val, colTypes[strings.ToLower(colName)])
+		}
+		if err == nil && val == nil {
+			err = fmt.Errorf("NULL values are not supported")
+		}
+		if err != nil {
+			return fmt.Errorf("column %s: %w", colName, err)
+		}
+		newRow.Set(colName, val)
+	}
+
+	if err := vm.storageEngine.UpdateRow(vm.currentTxn, schema.TableName, dup.Existing, newRow); err != nil {
+		return fmt.Errorf("failed to update row: %w", err)
+	}
+	fmt.Printf("ON CONFLICT: %s = %v exists, row updated\n", dup.Column, dup.Value)
+	return vm.collectReturning(schema.TableName, newRow.Values)
+}
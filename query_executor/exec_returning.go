@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"DaemonDB/types"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/*
+This file contains the RETURNING clause of INSERT, UPDATE and DELETE
+
+OP_RETURNING comes before the statement and leaves the list on the vm; the statement
+type checks it against its table, evaluates it on every row it writes (the new values
+of INSERT and UPDATE, the old ones of DELETE), and prints the rows like a SELECT once
+it has succeeded (after the auto transaction committed)
+*/
+
+// returningList is the RETURNING clause of the statement being executed.
+type returningList struct {
+	projections []types.Projection // empty: RETURNING *
+	columns     []string
+	rows        []map[string]interface{}
+}
+
+// ExecReturning keeps the RETURNING list for the statement that follows.
+func (vm *VM) ExecReturning(payload string) error {
+	var projections []types.Projection
+	if err := json.Unmarshal([]byte(payload), &projections); err != nil {
+		return fmt.Errorf("invalid RETURNING payload: %w", err)
+	}
+	vm.returning = &returningList{projections: projections}
+	return nil
+}
+
+// checkReturning type checks the RETURNING list against the target table
+// and works out its output columns.
+func (vm *VM) checkReturning(schema types.TableSchema) error {
+	ret := vm.returning
+	if ret == nil {
+		return nil
+	}
+	if len(ret.projections) == 0 {
+		for _, col := range schema.Columns {
+			ret.columns = append(ret.columns, col.Name)
+		}
+		return nil
+	}
+
+	resolve := types.SchemaResolver(schema)
+	for i := range ret.projections {
+		proj := &ret.projections[i]
+		if err := checkNoWindow(proj.Expr, "RETURNING"); err != nil {
+			return err
+		}
+		if err := vm.checkSubqueries(proj.Expr, resolve); err != nil {
+			return fmt.Errorf("RETURNING: %w", err)
+		}
+		if _, err := types.InferType(proj.Expr, resolve); err != nil {
+			return fmt.Errorf("RETURNING: %w", err)
+		}
+		if err := vm.storageEngine.BindSubqueries(vm.currentTxn, proj.Expr); err != nil {
+			return err
+		}
+		ret.columns = append(ret.columns, proj.Name)
+	}
+	return nil
+}
+
+// collectReturning evaluates the RETURNING list on a row written to table.
+func (vm *VM) collectReturning(table string, values map[string]interface{}) error {
+	ret := vm.returning
+	if ret == nil {
+		return nil
+	}
+
+	// columns may also be qualified with the table name
+	env := make(map[string]interface{}, 2*len(values))
+	prefix := strings.ToLower(table) + "."
+	for col, val := range values {
+		env[col] = val
+		env[prefix+col] = val
+	}
+
+	out := make(map[string]interface{}, len(ret.columns))
+	if len(ret.projections) == 0 {
+		for _, col := range ret.columns {
+			out[col] = values[strings.ToLower(col)]
+		}
+	}
+	for _, proj := range ret.projections {
+		val, err := types.EvalExpression(proj.Expr, env)
+		if err != nil {
+			return fmt.Errorf("RETURNING %s: %w", proj.Name, err)
+		}
+		out[proj.Name] = val
+	}
+	ret.rows = append(ret.rows, out)
+	return nil
+}
+
+// printReturning prints the returned rows and clears the list.
+func (vm *VM) printReturning() {
+	ret := vm.returning
+	vm.returning = nil
+	if ret == nil {
+		return
+	}
+	vm.printRows(ret.rows, ret.columns)
+}
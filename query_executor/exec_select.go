@@ -1,9 +1,11 @@
 package executor
 
 import (
+	storageengine "DaemonDB/storage_engine"
 	"DaemonDB/types"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 /*
@@ -11,7 +13,8 @@ This file contains select query for the table
 the vm function does the pre processing like unmarshling the payload sent in the query
 then send it to the storage engine to perform the operation
 and prints the returned result (columns header and rows)
-SELECT is a read-only operation, so it doesn't need transaction boundaries (no auto-transaction wrapping).
+SELECT is a read-only operation, so it doesn't need transaction boundaries (no auto-transaction wrapping);
+it takes no locks either: it reads the row versions the snapshot of the statement sees.
 */
 
 func (vm *VM) ExecuteSelect(payload string) error {
@@ -24,28 +27,404 @@ func (vm *VM) ExecuteSelect(payload string) error {
 		return fmt.Errorf("invalid select payload: %w", err)
 	}
 
+	if err := vm.checkSelectTypes(&selectPayload); err != nil {
+		return err
+	}
+
 	// StorageEngine returns rows as []map[string]interface{}
-	rows, columns, err := vm.storageEngine.ExecuteSelect(selectPayload)
+	rows, columns, err := vm.storageEngine.ExecuteSelect(vm.currentTxn, selectPayload)
 	if err != nil {
 		return err
 	}
 
-	if len(rows) == 0 {
-		fmt.Println("no rows returned")
-		return nil
+	vm.printRows(rows, columns)
+	return nil
+}
+
+// checkSelectTypes type checks the WHERE clause, select list and ORDER BY
+// against the schemas of the tables in the FROM clause.
+func (vm *VM) checkSelectTypes(payload *types.SelectPayload) error {
+	_, err := vm.checkSelectPayload(payload, nil)
+	return err
+}
+
+// checkSelectPayload type checks a SELECT, including its subqueries, and
+// returns its output columns. outer resolves references to the enclosing
+// query of a correlated subquery; it is nil for the top-level statement.
+func (vm *VM) checkSelectPayload(payload *types.SelectPayload, outer types.ColumnTypeResolver) ([]types.ColumnDef, error) {
+	var output []types.ColumnDef
+	var err error
+	switch {
+	case payload.WorkTable != "":
+		output, err = vm.checkWorkTable(payload)
+	case payload.SystemTable != "":
+		output, err = storageengine.SystemTableColumns(payload.SystemTable)
+	case payload.Recursive != "":
+		output, err = vm.checkRecursive(payload, outer)
+	case payload.SetOp != nil:
+		output, err = vm.checkSetOperation(payload, outer)
+	default:
+		output, err = vm.checkSelectBlock(payload, outer)
+	}
+	if err != nil || len(payload.OutputNames) == 0 {
+		return output, err
+	}
+	return renameColumns(output, payload.OutputNames)
+}
+
+// renameColumns gives the columns of a CTE the names of its column list.
+func renameColumns(cols []types.ColumnDef, names []string) ([]types.ColumnDef, error) {
+	if len(names) != len(cols) {
+		return nil, fmt.Errorf("query has %d columns but %d column names were given", len(cols), len(names))
+	}
+	renamed := make([]types.ColumnDef, len(cols))
+	for i, col := range cols {
+		renamed[i] = types.ColumnDef{Name: names[i], Type: col.Type}
+	}
+	return renamed, nil
+}
+
+// checkSelectBlock type checks a single SELECT ... FROM ... [WHERE] [ORDER BY].
+func (vm *VM) checkSelectBlock(payload *types.SelectPayload, outer types.ColumnTypeResolver) ([]types.ColumnDef, error) {
+	schemas, merged, resolve, err := vm.checkFromItems(payload, outer)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.WhereExpr != nil {
+		if err := checkNoWindow(payload.WhereExpr, "WHERE"); err != nil {
+			return nil, err
+		}
+		if err := vm.checkSubqueries(payload.WhereExpr, resolve); err != nil {
+			return nil, fmt.Errorf("WHERE: %w", err)
+		}
+		if err := types.CheckPredicate(payload.WhereExpr, resolve); err != nil {
+			return nil, fmt.Errorf("WHERE: %w", err)
+		}
+	}
+
+	// SELECT * returns every column of the FROM items, merged USING columns once
+	output := []types.ColumnDef{}
+	if len(payload.Projections) == 0 {
+		output = append(output, merged.Columns...)
+		for _, schema := range schemas {
+			for _, col := range schema.Columns {
+				if len(schemas) > 1 {
+					if _, err := types.SchemaResolver(merged)(col.Name); err == nil {
+						continue
+					}
+					col.Name = schema.TableName + "." + col.Name
+				}
+				output = append(output, col)
+			}
+		}
 	}
 
-	// Print column headers
-	vm.PrintLine(columns)
-	vm.PrintSeparator(len(columns))
+	// ORDER BY may refer to select-list aliases
+	aliases := make(map[string]string)
+	for _, proj := range payload.Projections {
+		if err := vm.checkSubqueries(proj.Expr, resolve); err != nil {
+			return nil, err
+		}
+		typ, err := types.InferType(proj.Expr, resolve)
+		if err != nil {
+			return nil, err
+		}
+		aliases[strings.ToLower(proj.Name)] = typ
+		output = append(output, types.ColumnDef{Name: proj.Name, Type: typ})
+	}
+	resolveWithAliases := func(column string) (string, error) {
+		if typ, ok := aliases[strings.ToLower(column)]; ok {
+			return typ, nil
+		}
+		return resolve(column)
+	}
 
-	// Print each row
-	for _, row := range rows {
-		strs := make([]string, len(columns))
-		for i, col := range columns {
-			strs[i] = vm.formatValue(row[col])
+	for _, item := range payload.OrderBy {
+		if err := vm.checkSubqueries(item.Expr, resolveWithAliases); err != nil {
+			return nil, fmt.Errorf("ORDER BY: %w", err)
+		}
+		if _, err := types.InferType(item.Expr, resolveWithAliases); err != nil {
+			return nil, fmt.Errorf("ORDER BY: %w", err)
 		}
-		vm.PrintLine(strs)
+		// rows are deduplicated on the select list, so sorting on anything
+		// else would pick an arbitrary one of the merged rows' values
+		if payload.Distinct && len(payload.Projections) > 0 && !inSelectList(item.Expr, payload.Projections) {
+			return nil, fmt.Errorf("for SELECT DISTINCT, ORDER BY expressions must appear in select list")
+		}
+	}
+
+	return output, nil
+}
+
+// checkNoWindow rejects window functions in clauses evaluated one row at a
+// time, before the windows are computed.
+func checkNoWindow(expr *types.ExpressionNode, clause string) error {
+	if types.ContainsWindow(expr) {
+		return fmt.Errorf("window functions are not allowed in %s", clause)
+	}
+	return nil
+}
+
+// inSelectList reports whether expr is one of the projections, by output
+// name or as the same expression.
+func inSelectList(expr *types.ExpressionNode, projections []types.Projection) bool {
+	text := types.FormatExpression(expr)
+	for _, proj := range projections {
+		if expr.Type == types.ExprColumn && strings.EqualFold(expr.Column, proj.Name) {
+			return true
+		}
+		if strings.EqualFold(text, types.FormatExpression(proj.Expr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSetOperation type checks both sides of a UNION / INTERSECT / EXCEPT.
+// They must return the same number of columns, and each pair of columns must
+// have a common type, which is recorded in the payload so the storage engine
+// can convert the rows. The result columns are named after the left side.
+func (vm *VM) checkSetOperation(payload *types.SelectPayload, outer types.ColumnTypeResolver) ([]types.ColumnDef, error) {
+	setOp := payload.SetOp
+	left, err := vm.checkSelectPayload(setOp.Left, outer)
+	if err != nil {
+		return nil, err
+	}
+	right, err := vm.checkSelectPayload(setOp.Right, outer)
+	if err != nil {
+		return nil, err
+	}
+	if len(left) != len(right) {
+		return nil, fmt.Errorf("each %s query must have the same number of columns (%d and %d)", setOp.Op, len(left), len(right))
+	}
+
+	output := make([]types.ColumnDef, len(left))
+	setOp.Types = make([]string, len(left))
+	for i := range left {
+		typ, err := types.CommonType(normalizedType(left[i].Type), normalizedType(right[i].Type))
+		if err != nil {
+			return nil, fmt.Errorf("%s column %d (%s): %w", setOp.Op, i+1, left[i].Name, err)
+		}
+		setOp.Types[i] = typ
+		output[i] = types.ColumnDef{Name: left[i].Name, Type: typ}
+	}
+
+	// ORDER BY of a compound query sorts its result columns
+	resolve := types.SchemaResolver(types.TableSchema{Columns: output})
+	for _, item := range payload.OrderBy {
+		if _, err := types.InferType(item.Expr, resolve); err != nil {
+			return nil, fmt.Errorf("ORDER BY: %w", err)
+		}
+	}
+	return output, nil
+}
+
+// checkRecursive type checks anchor UNION [ALL] step of a WITH RECURSIVE
+// query. The anchor fixes the column types; while the step is checked, its
+// reference to the CTE resolves to the work table with those columns.
+func (vm *VM) checkRecursive(payload *types.SelectPayload, outer types.ColumnTypeResolver) ([]types.ColumnDef, error) {
+	name := payload.Recursive
+	setOp := payload.SetOp
+	if setOp == nil || setOp.Op != "UNION" {
+		return nil, fmt.Errorf("recursive query %q must have the form <non-recursive part> UNION [ALL] <recursive part>", name)
+	}
+
+	anchor, err := vm.checkSelectPayload(setOp.Left, outer)
+	if err != nil {
+		return nil, err
+	}
+	output := make([]types.ColumnDef, len(anchor))
+	for i, col := range anchor {
+		output[i] = types.ColumnDef{Name: col.Name, Type: normalizedType(col.Type)}
+	}
+	workTable := output
+	if len(payload.OutputNames) > 0 {
+		if workTable, err = renameColumns(output, payload.OutputNames); err != nil {
+			return nil, fmt.Errorf("recursive query %q: %w", name, err)
+		}
+	}
+
+	key := strings.ToLower(name)
+	vm.workTables[key] = workTable
+	step, err := vm.checkSelectPayload(setOp.Right, outer)
+	delete(vm.workTables, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(step) != len(output) {
+		return nil, fmt.Errorf("each UNION query must have the same number of columns (%d and %d)", len(output), len(step))
+	}
+
+	// the step's rows are converted to the anchor's types
+	setOp.Types = make([]string, len(output))
+	for i := range output {
+		typ, err := types.CommonType(output[i].Type, normalizedType(step[i].Type))
+		if err != nil || typ != output[i].Type {
+			return nil, fmt.Errorf("recursive query %q column %d has type %s in the non-recursive part but type %s overall (use CAST)",
+				name, i+1, output[i].Type, normalizedType(step[i].Type))
+		}
+		setOp.Types[i] = typ
+	}
+	return output, nil
+}
+
+// checkWorkTable resolves a recursive CTE's reference to itself. The columns
+// are recorded in the payload for the storage engine, which runs the step
+// before it has produced any rows.
+func (vm *VM) checkWorkTable(payload *types.SelectPayload) ([]types.ColumnDef, error) {
+	cols, ok := vm.workTables[strings.ToLower(payload.WorkTable)]
+	if !ok {
+		return nil, fmt.Errorf("recursive reference to query %q must not appear within its non-recursive part", payload.WorkTable)
+	}
+	payload.OutputNames = make([]string, len(cols))
+	for i, col := range cols {
+		payload.OutputNames[i] = col.Name
+	}
+	return cols, nil
+}
+
+// normalizedType maps a schema type name (INTEGER, TEXT ...) to its SQL type,
+// leaving names the type system does not know unchanged.
+func normalizedType(name string) string {
+	if typ, err := types.NormalizeType(name); err == nil {
+		return typ
+	}
+	return name
+}
+
+// checkFromItems type checks the FROM items of a SELECT block (also the target
+// and FROM / USING items of UPDATE and DELETE) with their join conditions. It
+// returns their schemas, the merged USING / NATURAL columns and the resolver
+// for expressions over them.
+func (vm *VM) checkFromItems(payload *types.SelectPayload, outer types.ColumnTypeResolver) ([]types.TableSchema, types.TableSchema, types.ColumnTypeResolver, error) {
+	// FROM items are known by their alias (or table name), so self-joins resolve
+	schemas := []types.TableSchema{}
+	for _, ref := range payload.TableRefs() {
+		schema, err := vm.tableRefSchema(ref, outer)
+		if err != nil {
+			return nil, types.TableSchema{}, nil, err
+		}
+		for _, other := range schemas {
+			if strings.EqualFold(other.TableName, schema.TableName) {
+				return nil, types.TableSchema{}, nil, fmt.Errorf("table name %q specified more than once (use an alias)", schema.TableName)
+			}
+		}
+		schemas = append(schemas, schema)
+	}
+
+	// USING / NATURAL columns are merged into one unqualified column
+	merged := types.TableSchema{}
+	for i, join := range payload.Joins {
+		using, err := joinUsingColumns(schemas[:i+1], merged, schemas[i+1], join)
+		if err != nil {
+			return nil, types.TableSchema{}, nil, err
+		}
+		for _, col := range using {
+			if _, err := types.SchemaResolver(merged)(col.Name); err != nil {
+				merged.Columns = append(merged.Columns, col)
+			}
+		}
+	}
+	resolve := types.ChainResolvers(types.ChainResolvers(types.SchemaResolver(merged), types.SchemaResolver(schemas...)), outer)
+
+	for _, join := range payload.Joins {
+		if join.On == nil {
+			continue
+		}
+		if err := checkNoWindow(join.On, "JOIN conditions"); err != nil {
+			return nil, types.TableSchema{}, nil, err
+		}
+		if err := vm.checkSubqueries(join.On, resolve); err != nil {
+			return nil, types.TableSchema{}, nil, fmt.Errorf("JOIN %s: %w", join.Name(), err)
+		}
+		if err := types.CheckPredicate(join.On, resolve); err != nil {
+			return nil, types.TableSchema{}, nil, fmt.Errorf("JOIN %s: %w", join.Name(), err)
+		}
+	}
+	return schemas, merged, resolve, nil
+}
+
+// tableRefSchema returns the columns of one FROM item under the name the
+// query refers to it by.
+func (vm *VM) tableRefSchema(ref types.TableRef, outer types.ColumnTypeResolver) (types.TableSchema, error) {
+	if ref.Subquery != nil {
+		cols, err := vm.checkSelectPayload(ref.Subquery, outer)
+		if err != nil {
+			return types.TableSchema{}, fmt.Errorf("subquery %s: %w", ref.Name(), err)
+		}
+		return types.TableSchema{TableName: ref.Name(), Columns: cols}, nil
+	}
+
+	schema, err := vm.storageEngine.CatalogManager.GetTableSchema(ref.Table)
+	if err != nil {
+		return types.TableSchema{}, fmt.Errorf("table '%s' not found: %w", ref.Table, err)
+	}
+	schema.TableName = ref.Name()
+	return schema, nil
+}
+
+// joinUsingColumns checks a USING / NATURAL join and returns its merged
+// columns (typed with the common type of both sides). left holds the items
+// before the join, merged the columns earlier joins already merged.
+func joinUsingColumns(left []types.TableSchema, merged, right types.TableSchema, join types.JoinClause) ([]types.ColumnDef, error) {
+	names := join.Using
+	resolveLeft := types.ChainResolvers(types.SchemaResolver(merged), types.SchemaResolver(left...))
+	if join.Natural {
+		for _, col := range right.Columns {
+			if _, err := resolveLeft(col.Name); err == nil {
+				names = append(names, col.Name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("NATURAL JOIN %s: no common columns", join.Name())
+		}
+	}
+
+	cols := []types.ColumnDef{}
+	for _, name := range names {
+		lt, err := resolveLeft(name)
+		if err != nil {
+			return nil, fmt.Errorf("USING column %s: %w", name, err)
+		}
+		rt, err := types.SchemaResolver(right)(name)
+		if err != nil {
+			return nil, fmt.Errorf("USING column %s: %w", name, err)
+		}
+		typ, err := types.CommonType(lt, rt)
+		if err != nil {
+			return nil, fmt.Errorf("USING column %s: %w", name, err)
+		}
+		cols = append(cols, types.ColumnDef{Name: name, Type: typ})
+	}
+	return cols, nil
+}
+
+// checkSubqueries type checks every subquery inside expr and records the type
+// of scalar and IN subqueries in their DataType, where InferType reads it.
+func (vm *VM) checkSubqueries(expr *types.ExpressionNode, resolve types.ColumnTypeResolver) error {
+	if expr == nil {
+		return nil
+	}
+	for _, child := range expr.Children() {
+		if err := vm.checkSubqueries(child, resolve); err != nil {
+			return err
+		}
+	}
+	if expr.Subquery == nil {
+		return nil
+	}
+
+	cols, err := vm.checkSelectPayload(expr.Subquery, resolve)
+	if err != nil {
+		return fmt.Errorf("subquery: %w", err)
+	}
+	if expr.Type == types.ExprExists {
+		return nil
+	}
+	if len(cols) != 1 {
+		return fmt.Errorf("subquery must return only one column, got %d", len(cols))
 	}
+	expr.DataType = cols[0].Type
 	return nil
 }
@@ -0,0 +1,124 @@
+package executor
+
+import (
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/*
+This file contains triggers
+
+the storage engine fires a trigger from InsertRow / UpdateRow / DeleteRowsAt and
+calls runTrigger of the VM that began the transaction (registered at BEGIN and
+at the auto transaction of a statement); each statement of the body is compiled
+with NEW / OLD bound to the row and executed by a VM of its own in the same
+transaction, so what it writes commits or rolls back with the statement that
+fired it
+*/
+
+// Compiler turns the SQL of a statement into bytecode, with NEW and OLD bound
+// to the rows new and old. The parser and code generator sit above the VM, so
+// main hands it one for the bodies of triggers.
+type Compiler func(sql string, old, new map[string]interface{}) ([]Instruction, error)
+
+// maxTriggerDepth bounds triggers firing one another (a trigger writing to its
+// own table would otherwise never stop).
+const maxTriggerDepth = 16
+
+// SetCompiler sets the compiler of trigger bodies.
+func (vm *VM) SetCompiler(compile Compiler) {
+	vm.compile = compile
+}
+
+// ExecCreateTrigger executes CREATE TRIGGER. Each statement of the body is
+// compiled once with placeholder rows, to report errors in NEW / OLD
+// references before the trigger is stored.
+func (vm *VM) ExecCreateTrigger(payloadJSON string) error {
+	var trigger types.TriggerDef
+	if err := json.Unmarshal([]byte(payloadJSON), &trigger); err != nil {
+		return fmt.Errorf("invalid trigger payload: %w", err)
+	}
+	if err := vm.storageEngine.RequireDatabase(); err != nil {
+		return fmt.Errorf("no database selected. Run: USE <dbname>")
+	}
+
+	if vm.storageEngine.CatalogManager.TableExists(trigger.Table) && vm.compile != nil {
+		schema, err := vm.storageEngine.CatalogManager.GetTableSchema(trigger.Table)
+		if err != nil {
+			return err
+		}
+		row := placeholderRow(schema)
+		var old, new map[string]interface{}
+		if trigger.Event != "INSERT" {
+			old = row
+		}
+		if trigger.Event != "DELETE" {
+			new = row
+		}
+		for _, sql := range trigger.Body {
+			if _, err := vm.compile(sql, old, new); err != nil {
+				return fmt.Errorf("trigger %s: %w", trigger.Name, err)
+			}
+		}
+	}
+	return vm.storageEngine.CreateTrigger(trigger)
+}
+
+// ExecDropTrigger executes DROP TRIGGER.
+func (vm *VM) ExecDropTrigger(name string) error {
+	return vm.storageEngine.DropTrigger(name)
+}
+
+// runTrigger runs the body of trigger for one row in transaction tx.
+func (vm *VM) runTrigger(tx *txn.Transaction, trigger types.TriggerDef, old, new map[string]interface{}) error {
+	if vm.compile == nil {
+		return fmt.Errorf("no compiler for trigger bodies")
+	}
+	if vm.triggerDepth >= maxTriggerDepth {
+		return fmt.Errorf("triggers nested more than %d deep", maxTriggerDepth)
+	}
+	vm.triggerDepth++
+	defer func() { vm.triggerDepth-- }()
+
+	for _, sql := range trigger.Body {
+		instructions, err := vm.compile(sql, old, new)
+		if err != nil {
+			return err
+		}
+
+		// a VM of its own keeps the stack and RETURNING list of the statement
+		// that fired the trigger; with currentTxn set it does not auto-commit
+		body := &VM{
+			storageEngine: vm.storageEngine,
+			currentTxn:    tx,
+			stack:         make([][]byte, 0),
+			workTables:    make(map[string][]types.ColumnDef),
+		}
+		if err := body.Execute(instructions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placeholderRow returns a row of schema holding the zero value of each column type.
+func placeholderRow(schema types.TableSchema) map[string]interface{} {
+	row := make(map[string]interface{}, len(schema.Columns))
+	for _, col := range schema.Columns {
+		var val interface{}
+		typ, _ := types.NormalizeType(col.Type)
+		switch typ {
+		case types.TypeInt:
+			val = 0
+		case types.TypeFloat:
+			val = 0.0
+		default:
+			val = ""
+		}
+		row[strings.ToLower(col.Name)] = val
+	}
+	return row
+}
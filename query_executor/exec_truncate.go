@@ -20,6 +20,9 @@ func (vm *VM) ExecTruncate(tableName string) error {
 		return fmt.Errorf("table name cannot be empty")
 	}
 
+	if err := vm.checkNotView(tableName); err != nil {
+		return err
+	}
 	if !vm.storageEngine.CatalogManager.TableExists(tableName) {
 		return fmt.Errorf("table '%s' does not exist", tableName)
 	}
@@ -11,9 +11,11 @@ import (
 This file contains update query for the table
 the vm function does the pre processing like unmarshling the payload sent in the query
 begins an auto transaction
-scan for the row pointers that are present for the target table, and do the necessary updates in those rows
+finds the rows to change with the storage engine's TargetRows (the WHERE, with the FROM items joined
+in, using the primary key index when it can), and does the necessary updates in those rows
 
-includes the helper functions for update set clause like expression evaluator, value comparator, type converter
+SET and WHERE expressions are type checked against the catalog schema before any row is touched,
+then evaluated per row by the shared evaluator in the types package
 */
 
 // ExecuteUpdate handles UPDATE statements
@@ -33,6 +35,23 @@ func (vm *VM) ExecuteUpdate(tableName string) error {
 		return fmt.Errorf("invalid update payload: %w", err)
 	}
 
+	if err := vm.checkNotView(tableName); err != nil {
+		return err
+	}
+	schema, err := vm.storageEngine.CatalogManager.GetTableSchema(tableName)
+	if err != nil {
+		return fmt.Errorf("table '%s' not found: %w", tableName, err)
+	}
+	colTypes, err := vm.checkUpdateTypes(schema, &updatePayload)
+	if err != nil {
+		return err
+	}
+	target := types.TableRef{Table: tableName, Alias: updatePayload.Alias}
+	schema.TableName = target.Name()
+	if err := vm.checkReturning(schema); err != nil {
+		return err
+	}
+
 	// Auto Commit Command
 	if vm.currentTxn == nil { // check if there is no running transaction
 		err := vm.autoTransactionBegin()
@@ -41,35 +60,43 @@ func (vm *VM) ExecuteUpdate(tableName string) error {
 		}
 	}
 
-	rowPtrs, tableSchema, err := vm.storageEngine.Scan(vm.currentTxn, tableName)
+	// Subqueries run through the storage engine, with the snapshot of the
+	// statement's transaction
+	if err := vm.bindUpdateSubqueries(&updatePayload); err != nil {
+		if vm.autoTxn {
+			_ = vm.autoTransactionAbort()
+		}
+		return err
+	}
+
+	targets, err := vm.storageEngine.TargetRows(vm.currentTxn, target, updatePayload.From, updatePayload.WhereExpr)
 	if err != nil {
+		if vm.autoTxn {
+			_ = vm.autoTransactionAbort()
+		}
 		return err
 	}
 
 	updatedCount := 0
 
-	// Iterate through all rows
-	for _, row := range rowPtrs {
-		rowData := row.ToMap()
-
-		// Evaluate WHERE condition
-		if updatePayload.WhereExpr != nil {
-			match, err := vm.evaluateExpression(updatePayload.WhereExpr, rowData, tableSchema)
-			if err != nil {
-				return fmt.Errorf("error evaluating WHERE: %w", err)
-			}
-			if !match {
-				continue
-			}
-		}
-
+	// Iterate through the matching rows
+	for _, row := range targets {
 		// Apply SET expressions
 		newRow := row.Row.Clone()
 
 		for colName, expr := range updatePayload.SetExprs {
-			val, err := vm.evaluateExpressionValue(&expr, rowData, tableSchema)
+			val, err := types.EvalExpression(&expr, row.Env)
+			if err == nil {
+				val, err = types.CoerceValue(val, colTypes[strings.ToLower(colName)])
+			}
+			if err == nil && val == nil {
+				err = fmt.Errorf("NULL values are not supported")
+			}
 			if err != nil {
-				return err
+				if vm.autoTxn {
+					_ = vm.autoTransactionAbort()
+				}
+				return fmt.Errorf("column %s: %w", colName, err)
 			}
 			newRow.Set(colName, val)
 		}
@@ -80,6 +107,12 @@ func (vm *VM) ExecuteUpdate(tableName string) error {
 			}
 			return fmt.Errorf("failed to update row: %w", err)
 		}
+		if err := vm.collectReturning(target.Name(), newRow.Values); err != nil {
+			if vm.autoTxn {
+				_ = vm.autoTransactionAbort()
+			}
+			return err
+		}
 
 		updatedCount++
 	}
@@ -91,165 +124,60 @@ func (vm *VM) ExecuteUpdate(tableName string) error {
 	}
 
 	fmt.Printf("%d row(s) updated\n", updatedCount)
+	vm.printReturning()
 	return nil
 }
 
-// evaluateExpression evaluates a comparison expression and returns true/false
-func (vm *VM) evaluateExpression(expr *types.ExpressionNode, rowData map[string]interface{}, schema types.TableSchema) (bool, error) {
-	if expr.Type != 3 { // EXPR_COMPARISON
-		return false, fmt.Errorf("WHERE expression must be a comparison")
-	}
-
-	leftVal, err := vm.evaluateExpressionValue(expr.Left, rowData, schema)
+// checkUpdateTypes verifies every SET expression is assignable to its column
+// and that WHERE is a boolean condition, both over the table and the FROM
+// items. It returns the normalized column types.
+func (vm *VM) checkUpdateTypes(schema types.TableSchema, payload *types.UpdatePayload) (map[string]string, error) {
+	target := types.TableRef{Table: schema.TableName, Alias: payload.Alias}
+	_, resolve, err := vm.checkTargetWhere(target, payload.From, payload.WhereExpr)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	rightVal, err := vm.evaluateExpressionValue(expr.Right, rowData, schema)
-	if err != nil {
-		return false, err
+	colTypes := make(map[string]string, len(schema.Columns))
+	for _, col := range schema.Columns {
+		typ, err := types.NormalizeType(col.Type)
+		if err != nil {
+			return nil, err
+		}
+		colTypes[strings.ToLower(col.Name)] = typ
 	}
 
-	return vm.compareValues(leftVal, rightVal, expr.Op)
-}
-
-// evaluateExpressionValue evaluates an expression and returns its value
-func (vm *VM) evaluateExpressionValue(expr *types.ExpressionNode, rowData map[string]interface{}, schema types.TableSchema) (interface{}, error) {
-	switch expr.Type {
-	case 0: // EXPR_LITERAL
-		return expr.Literal, nil
-
-	case 1: // EXPR_COLUMN
-		colName := strings.ToLower(expr.Column)
-		val, ok := rowData[colName]
+	for colName, expr := range payload.SetExprs {
+		colType, ok := colTypes[strings.ToLower(colName)]
 		if !ok {
-			return nil, fmt.Errorf("column %s not found", expr.Column)
+			return nil, fmt.Errorf("column '%s' not found in table '%s'", colName, schema.TableName)
 		}
-		return val, nil
-
-	case 2: // EXPR_BINARY (arithmetic)
-		leftVal, err := vm.evaluateExpressionValue(expr.Left, rowData, schema)
-		if err != nil {
+		if err := checkNotGenerated(schema, colName); err != nil {
 			return nil, err
 		}
-
-		rightVal, err := vm.evaluateExpressionValue(expr.Right, rowData, schema)
-		if err != nil {
+		if err := checkNoWindow(&expr, "UPDATE"); err != nil {
 			return nil, err
 		}
-
-		return vm.applyArithmeticOp(leftVal, rightVal, expr.Op)
-
-	default:
-		return nil, fmt.Errorf("unsupported expression type: %d", expr.Type)
-	}
-}
-
-// applyArithmeticOp applies arithmetic operations (+, -, *, /)
-func (vm *VM) applyArithmeticOp(left, right interface{}, op string) (interface{}, error) {
-	// Convert to int64 for arithmetic
-	leftInt, leftOk := vm.toInt64(left)
-	rightInt, rightOk := vm.toInt64(right)
-
-	if !leftOk || !rightOk {
-		return nil, fmt.Errorf("arithmetic operations require numeric values")
-	}
-
-	switch op {
-	case "+":
-		return leftInt + rightInt, nil
-	case "-":
-		return leftInt - rightInt, nil
-	case "*":
-		return leftInt * rightInt, nil
-	case "/":
-		if rightInt == 0 {
-			return nil, fmt.Errorf("division by zero")
-		}
-		return leftInt / rightInt, nil
-	default:
-		return nil, fmt.Errorf("unknown operator: %s", op)
-	}
-}
-
-// compareValues compares two values using the given operator
-func (vm *VM) compareValues(left, right interface{}, op string) (bool, error) {
-	switch op {
-	case "=":
-		return vm.equalValues(left, right), nil
-	case "!=":
-		return !vm.equalValues(left, right), nil
-	case "<":
-		return vm.lessThan(left, right)
-	case ">":
-		return vm.lessThan(right, left)
-	case "<=":
-		lt, err := vm.lessThan(left, right)
-		if err != nil {
-			return false, err
+		if err := vm.checkSubqueries(&expr, resolve); err != nil {
+			return nil, err
 		}
-		return lt || vm.equalValues(left, right), nil
-	case ">=":
-		lt, err := vm.lessThan(left, right)
-		if err != nil {
-			return false, err
+		if err := types.CheckAssignable(&expr, colName, colType, resolve); err != nil {
+			return nil, err
 		}
-		return !lt || vm.equalValues(left, right), nil
-	default:
-		return false, fmt.Errorf("unknown comparison operator: %s", op)
-	}
-}
-
-// equalValues checks if two values are equal
-func (vm *VM) equalValues(left, right interface{}) bool {
-	// Handle string comparison
-	leftStr, leftIsStr := left.(string)
-	rightStr, rightIsStr := right.(string)
-	if leftIsStr && rightIsStr {
-		return leftStr == rightStr
-	}
-
-	// Handle numeric comparison
-	leftInt, leftOk := vm.toInt64(left)
-	rightInt, rightOk := vm.toInt64(right)
-	if leftOk && rightOk {
-		return leftInt == rightInt
-	}
-
-	return false
-}
-
-// lessThan checks if left < right
-func (vm *VM) lessThan(left, right interface{}) (bool, error) {
-	// String comparison
-	leftStr, leftIsStr := left.(string)
-	rightStr, rightIsStr := right.(string)
-	if leftIsStr && rightIsStr {
-		return leftStr < rightStr, nil
-	}
-
-	// Numeric comparison
-	leftInt, leftOk := vm.toInt64(left)
-	rightInt, rightOk := vm.toInt64(right)
-	if leftOk && rightOk {
-		return leftInt < rightInt, nil
+		payload.SetExprs[colName] = expr
 	}
 
-	return false, fmt.Errorf("cannot compare values of different types")
+	return colTypes, nil
 }
 
-// toInt64 converts various numeric types to int64
-func (vm *VM) toInt64(val interface{}) (int64, bool) {
-	switch v := val.(type) {
-	case int:
-		return int64(v), true
-	case int32:
-		return int64(v), true
-	case int64:
-		return v, true
-	case float64:
-		return int64(v), true
-	default:
-		return 0, false
+// bindUpdateSubqueries binds the subqueries of the SET expressions and the
+// WHERE clause of an UPDATE.
+func (vm *VM) bindUpdateSubqueries(updatePayload *types.UpdatePayload) error {
+	for colName, expr := range updatePayload.SetExprs {
+		if err := vm.storageEngine.BindSubqueries(vm.currentTxn, &expr); err != nil {
+			return err
+		}
+		updatePayload.SetExprs[colName] = expr
 	}
+	return vm.storageEngine.BindSubqueries(vm.currentTxn, updatePayload.WhereExpr)
 }
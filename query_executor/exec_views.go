@@ -0,0 +1,233 @@
+package executor
+
+import (
+	"DaemonDB/types"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/*
+This file contains CREATE / DROP VIEW and the materialized views
+
+the query of a view is type checked when it is created, which also gives the view
+its columns; the view then lives in the catalog and the parser expands it. A
+materialized view also runs its query and stores the rows in a backing table
+(fillView); REFRESH runs it again and writes the difference. Both read and write
+in the transaction block they are in, else in a transaction of their own, so
+the rows commit or roll back with it. The view definition and its backing
+table, like a table created in a transaction block, stay on a rollback.
+*/
+
+// ExecCreateView executes CREATE [OR REPLACE] [MATERIALIZED] VIEW.
+func (vm *VM) ExecCreateView(payloadJSON string) error {
+	if err := vm.storageEngine.RequireDatabase(); err != nil {
+		return fmt.Errorf("no database selected. Run: USE <dbname>")
+	}
+
+	var payload types.CreateViewPayload
+	if err := json.Unmarshal([]byte(payloadJSON), &payload); err != nil {
+		return fmt.Errorf("invalid view payload: %w", err)
+	}
+
+	query := payload.Query
+	query.OutputNames = payload.ColumnNames
+	columns, err := vm.checkSelectPayload(&query, nil)
+	if err != nil {
+		return fmt.Errorf("view %s: %w", payload.Name, err)
+	}
+
+	view := types.ViewDef{
+		Name:         payload.Name,
+		Query:        payload.SQL,
+		ColumnNames:  payload.ColumnNames,
+		Columns:      columns,
+		Materialized: payload.Materialized,
+	}
+	catalog := vm.storageEngine.CatalogManager
+	for _, ref := range payload.References {
+		if ref == view.Name {
+			return fmt.Errorf("view %s cannot read itself", view.Name)
+		}
+		if !catalog.TableExists(ref) && !catalog.ViewExists(ref) {
+			continue
+		}
+		seen := false
+		for _, dep := range view.DependsOn {
+			seen = seen || dep == ref
+		}
+		if !seen {
+			view.DependsOn = append(view.DependsOn, ref)
+		}
+	}
+
+	if !view.Materialized {
+		if old, ok := catalog.GetView(view.Name); ok && payload.OrReplace && !old.Materialized {
+			if err := checkReplacedColumns(old.Columns, view.Columns); err != nil {
+				return fmt.Errorf("view %s: %w", view.Name, err)
+			}
+		}
+		if err := vm.storageEngine.CreateView(view, payload.OrReplace); err != nil {
+			return err
+		}
+		fmt.Printf("View '%s' created\n", view.Name)
+		return nil
+	}
+
+	if catalog.TableExists(view.Name) || catalog.ViewExists(view.Name) {
+		return fmt.Errorf("'%s' already exists", view.Name)
+	}
+	for _, col := range view.Columns {
+		if strings.Contains(col.Name, ".") {
+			return fmt.Errorf("materialized view %s: column %q needs a name (use AS or a column list)", view.Name, col.Name)
+		}
+		if col.Type != types.TypeInt && col.Type != types.TypeFloat && col.Type != types.TypeVarchar {
+			return fmt.Errorf("materialized view %s: column %s is %s, only INT, FLOAT and VARCHAR can be stored (use CAST)", view.Name, col.Name, col.Type)
+		}
+	}
+	view.Payload = &query
+
+	table, err := vm.storageEngine.CreateViewTable(view.Name, view.Columns)
+	if err != nil {
+		return err
+	}
+	view.Table = table
+	_, count, err := vm.fillView(view, query, false)
+	if err == nil {
+		err = vm.storageEngine.CreateView(view, false)
+	}
+	if err != nil {
+		_ = vm.storageEngine.DropViewTable(table)
+		return err
+	}
+	fmt.Printf("Materialized view '%s' created with %d rows\n", view.Name, count)
+	return nil
+}
+
+// checkReplacedColumns checks that CREATE OR REPLACE VIEW keeps the columns of
+// the view it replaces, in order and with their types; it may add columns.
+func checkReplacedColumns(old, new []types.ColumnDef) error {
+	if len(new) < len(old) {
+		return fmt.Errorf("cannot drop columns from a view")
+	}
+	for i, col := range old {
+		if !strings.EqualFold(col.Name, new[i].Name) {
+			return fmt.Errorf("cannot change name of view column %q to %q", col.Name, new[i].Name)
+		}
+		if col.Type != new[i].Type {
+			return fmt.Errorf("cannot change type of view column %q from %s to %s", col.Name, col.Type, new[i].Type)
+		}
+	}
+	return nil
+}
+
+// checkNotView refuses INSERT, UPDATE, DELETE and TRUNCATE on a view: only
+// tables can be written, and a materialized view changes by REFRESH only.
+func (vm *VM) checkNotView(name string) error {
+	view, ok := vm.storageEngine.CatalogManager.GetView(name)
+	switch {
+	case !ok:
+		return nil
+	case view.Materialized:
+		return fmt.Errorf("cannot modify materialized view '%s' (use REFRESH MATERIALIZED VIEW)", name)
+	default:
+		return fmt.Errorf("cannot modify view '%s'", name)
+	}
+}
+
+// ExecDropView executes DROP [MATERIALIZED] VIEW.
+func (vm *VM) ExecDropView(payloadJSON string) error {
+	var payload types.ViewPayload
+	if err := json.Unmarshal([]byte(payloadJSON), &payload); err != nil {
+		return fmt.Errorf("invalid view payload: %w", err)
+	}
+	return vm.storageEngine.DropView(payload.Name, payload.Materialized)
+}
+
+// ExecRefreshView executes REFRESH MATERIALIZED VIEW [CONCURRENTLY]. A
+// refresh replaces every row of the view; CONCURRENTLY keeps the rows that
+// did not change and writes only the others, so it touches (and locks) no
+// more rows than the query results changed by. Readers never wait for
+// either: they see the old rows until the refresh commits.
+func (vm *VM) ExecRefreshView(payloadJSON string) error {
+	if err := vm.storageEngine.RequireDatabase(); err != nil {
+		return fmt.Errorf("no database selected. Run: USE <dbname>")
+	}
+
+	var payload types.ViewPayload
+	if err := json.Unmarshal([]byte(payloadJSON), &payload); err != nil {
+		return fmt.Errorf("invalid view payload: %w", err)
+	}
+
+	view, ok := vm.storageEngine.CatalogManager.GetView(payload.Name)
+	if !ok {
+		return fmt.Errorf("materialized view '%s' does not exist", payload.Name)
+	}
+	if !view.Materialized || view.Payload == nil {
+		return fmt.Errorf("'%s' is not a materialized view", payload.Name)
+	}
+
+	// the tables it reads may have changed since it was created
+	query := *view.Payload
+	if _, err := vm.checkSelectPayload(&query, nil); err != nil {
+		return fmt.Errorf("materialized view %s: %w", view.Name, err)
+	}
+
+	changed, count, err := vm.fillView(view, query, payload.Concurrently)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Materialized view '%s' refreshed with %d rows (%d row(s) deleted or inserted)\n", view.Name, count, changed)
+	return nil
+}
+
+// fillView runs query, the type checked query of a materialized view, and
+// writes its rows to the backing table of view (RefreshViewTable), in the
+// current transaction or one of its own. It returns the number of rows
+// deleted and inserted, and the number of rows of the view.
+func (vm *VM) fillView(view types.ViewDef, query types.SelectPayload, concurrently bool) (int, int, error) {
+	if vm.currentTxn == nil {
+		if err := vm.autoTransactionBegin(); err != nil {
+			return 0, 0, fmt.Errorf("failed to auto-begin transaction: %w", err)
+		}
+	}
+	fail := func(err error) (int, int, error) {
+		if vm.autoTxn {
+			_ = vm.autoTransactionAbort()
+		}
+		return 0, 0, fmt.Errorf("materialized view %s: %w", view.Name, err)
+	}
+
+	rows, columns, err := vm.storageEngine.ExecuteSelect(vm.currentTxn, query)
+	if err != nil {
+		return fail(err)
+	}
+	if len(columns) != len(view.Columns) {
+		return fail(fmt.Errorf("query returns %d columns, the view has %d", len(columns), len(view.Columns)))
+	}
+	values := make([][]any, len(rows))
+	for r, row := range rows {
+		values[r] = make([]any, len(columns))
+		for i, col := range view.Columns {
+			val, err := types.CoerceValue(row[columns[i]], col.Type)
+			if err == nil && val == nil {
+				err = fmt.Errorf("NULL values are not supported")
+			}
+			if err != nil {
+				return fail(fmt.Errorf("column %s: %w", col.Name, err))
+			}
+			values[r][i] = val
+		}
+	}
+
+	deleted, inserted, err := vm.storageEngine.RefreshViewTable(vm.currentTxn, view, values, concurrently)
+	if err != nil {
+		return fail(err)
+	}
+	if vm.autoTxn {
+		if err := vm.autoTransactionCommit(); err != nil {
+			return 0, 0, fmt.Errorf("materialized view %s: failed to auto-commit: %w", view.Name, err)
+		}
+	}
+	return deleted + inserted, len(rows), nil
+}
@@ -21,7 +21,13 @@ func (vm *VM) buildColumnDefs(columns string) ([]types.ColumnDef, error) {
 		}
 
 		isPK := len(colItr) >= 3 && strings.EqualFold(colItr[2], "pk")
-		colType := strings.ToUpper(colItr[0])
+		colType, err := types.NormalizeType(colItr[0])
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", colItr[1], err)
+		}
+		if colType != types.TypeInt && colType != types.TypeFloat && colType != types.TypeVarchar {
+			return nil, fmt.Errorf("column %s: type %s cannot be stored in a table", colItr[1], colType)
+		}
 
 		columnDefs = append(columnDefs, types.ColumnDef{
 			Name:         colItr[1],
@@ -98,6 +104,46 @@ func (vm *VM) validateForeignKeys(schema types.TableSchema) error {
 	return nil
 }
 
+// ResultHandler receives the rows of a SELECT or of a RETURNING clause, each
+// value formatted as it would be printed.
+type ResultHandler func(columns []string, rows [][]string)
+
+// SetResultHandler hands result rows to handle instead of printing them; nil
+// prints them again. Embedders and tests use it to read what a query returned.
+func (vm *VM) SetResultHandler(handle ResultHandler) {
+	vm.results = handle
+}
+
+// printRows prints a result set: the column headers, then each row.
+func (vm *VM) printRows(rows []map[string]interface{}, columns []string) {
+	if vm.results != nil {
+		formatted := make([][]string, len(rows))
+		for r, row := range rows {
+			formatted[r] = make([]string, len(columns))
+			for i, col := range columns {
+				formatted[r][i] = vm.formatValue(row[col])
+			}
+		}
+		vm.results(columns, formatted)
+		return
+	}
+	if len(rows) == 0 {
+		fmt.Println("no rows returned")
+		return
+	}
+
+	vm.PrintLine(columns)
+	vm.PrintSeparator(len(columns))
+
+	for _, row := range rows {
+		strs := make([]string, len(columns))
+		for i, col := range columns {
+			strs[i] = vm.formatValue(row[col])
+		}
+		vm.PrintLine(strs)
+	}
+}
+
 func (vm *VM) PrintLine(cells []string) {
 	for i, cell := range cells {
 		fmt.Printf("%-20s", cell)
@@ -124,3 +170,14 @@ func (vm *VM) formatValue(val interface{}) string {
 	}
 	return s
 }
+
+// checkNotGenerated rejects a write to the column colName of schema when it is
+// a generated column.
+func checkNotGenerated(schema types.TableSchema, colName string) error {
+	for _, col := range schema.Columns {
+		if strings.EqualFold(col.Name, colName) && col.Generated != nil {
+			return fmt.Errorf("column %s is a generated column and cannot be written", col.Name)
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package executor
 import (
 	storageengine "DaemonDB/storage_engine"
 	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
 )
 
 type OpCode byte
@@ -23,6 +24,15 @@ const (
 	OP_TRUNCATE
 	OP_DROP_TABLE
 	OP_DELETE
+	OP_ANALYZE
+	OP_EXPLAIN
+	OP_UPSERT    // INSERT ... ON CONFLICT
+	OP_RETURNING // RETURNING list of the INSERT / UPDATE / DELETE that follows
+	OP_CREATE_VIEW
+	OP_DROP_VIEW
+	OP_REFRESH_VIEW
+	OP_CREATE_TRIGGER
+	OP_DROP_TRIGGER
 
 	// arithmetic
 	OP_ADD
@@ -31,9 +41,14 @@ const (
 	OP_DIV
 
 	//  TRANSACTIONS (NEW)
-	OP_TXN_BEGIN
+	OP_TXN_BEGIN // BEGIN [ISOLATION LEVEL level]; Value is the level or empty
 	OP_TXN_COMMIT
 	OP_TXN_ROLLBACK
+	OP_SAVEPOINT               // SAVEPOINT name
+	OP_ROLLBACK_TO_SAVEPOINT   // ROLLBACK TO SAVEPOINT name
+	OP_RELEASE_SAVEPOINT       // RELEASE SAVEPOINT name
+	OP_SET_TRANSACTION         // SET TRANSACTION ISOLATION LEVEL level
+	OP_SET_SESSION_TRANSACTION // SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL level
 
 	OP_END
 )
@@ -49,5 +64,25 @@ type VM struct {
 	currentTxn *txn.Transaction
 	autoTxn    bool
 
+	// isolation level of the transactions the session starts, and whether
+	// the explicit transaction ran a statement (its level is fixed then)
+	isolation txn.IsolationLevel
+	txnRan    bool
+
 	stack [][]byte
+
+	// columns of the work tables of the WITH RECURSIVE queries being type
+	// checked, by lower-case CTE name
+	workTables map[string][]types.ColumnDef
+
+	// RETURNING list of the INSERT / UPDATE / DELETE being executed
+	returning *returningList
+
+	// receives result rows instead of the console (SetResultHandler)
+	results ResultHandler
+
+	// compiles the statements of trigger bodies, and the number of triggers
+	// running inside one another
+	compile      Compiler
+	triggerDepth int
 }
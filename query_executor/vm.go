@@ -21,8 +21,10 @@ package executor
 
 import (
 	storageengine "DaemonDB/storage_engine"
+	lock "DaemonDB/storage_engine/lock_manager"
+	txn "DaemonDB/storage_engine/transaction_manager"
 	"DaemonDB/types"
-	"encoding/json"
+	"errors"
 	"fmt"
 )
 
@@ -32,14 +34,105 @@ It has the Execute function which has a Switch Case based on which the Instructi
 */
 
 func NewVM(engine *storageengine.StorageEngine) *VM {
-	return &VM{
+	vm := &VM{
 		storageEngine: engine,
 		stack:         make([][]byte, 0),
+		workTables:    make(map[string][]types.ColumnDef),
+		isolation:     txn.DefaultIsolation,
 	}
+	return vm
 }
 
+// maxStatementRestarts is how often a READ COMMITTED statement starts over
+// after running into rows changed by transactions that committed meanwhile.
+const maxStatementRestarts = 10
+
+// Execute runs the instructions of one statement. Inside an explicit
+// transaction a statement that fails is rolled back on its own, leaving the
+// transaction as it was before the statement started; one chosen as the
+// victim of a deadlock, or failing to serialize, rolls back the whole
+// transaction, releasing its locks.
+//
+// Under READ COMMITTED a statement that found its rows changed by a
+// concurrent transaction is rolled back and run again with a new snapshot,
+// which sees the change.
 func (vm *VM) Execute(instructions []Instruction) error {
+	for restarts := 0; ; restarts++ {
+		readCommitted := vm.isolationLevel() == txn.ReadCommitted
+		err := vm.executeStatement(instructions, readCommitted)
+		if !storageengine.IsSerializationFailure(err) {
+			return err
+		}
+		if readCommitted && errors.Is(err, storageengine.ErrSerialization) && restarts < maxStatementRestarts {
+			fmt.Printf("[TXN] concurrent update, restarting the statement (READ COMMITTED)\n")
+			continue
+		}
+		return fmt.Errorf("%w (SQLSTATE %s)", err, storageengine.SerializationFailureCode)
+	}
+}
+
+// executeStatement runs the statement once. It reads with the snapshot of
+// the transaction, or one of its own outside a transaction (the
+// auto-transaction of a write replaces it); readCommitted keeps the
+// transaction of a statement that lost to a concurrent update, for it to
+// start over.
+func (vm *VM) executeStatement(instructions []Instruction, readCommitted bool) error {
+	tx := vm.currentTxn
+	control := isTxnControl(instructions)
+	if tx != nil && !vm.autoTxn && !control {
+		vm.storageEngine.StatementStart(tx)
+		vm.txnRan = true
+	}
+	if tx == nil || vm.autoTxn || control {
+		return vm.execute(instructions)
+	}
+
+	sp := vm.storageEngine.StatementSavepoint(tx)
+	err := vm.execute(instructions)
+	if err == nil || vm.currentTxn != tx {
+		return err
+	}
+	retry := storageengine.IsSerializationFailure(err) && !(readCommitted && errors.Is(err, storageengine.ErrSerialization))
+	if errors.Is(err, lock.ErrDeadlock) || retry {
+		if abortErr := vm.storageEngine.AbortTransaction(tx); abortErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, abortErr)
+		}
+		vm.currentTxn = nil
+		return fmt.Errorf("%w; transaction %d rolled back", err, tx.ID)
+	}
+	if rbErr := vm.storageEngine.RollbackStatement(tx, sp); rbErr != nil {
+		return fmt.Errorf("%w (statement rollback failed: %v)", err, rbErr)
+	}
+	return err
+}
+
+// isolationLevel is the level of the transaction the next statement runs in.
+func (vm *VM) isolationLevel() txn.IsolationLevel {
+	if vm.currentTxn != nil {
+		return vm.currentTxn.Isolation
+	}
+	return vm.isolation
+}
+
+// isTxnControl reports whether instructions are BEGIN, COMMIT, ROLLBACK, SET
+// TRANSACTION or a savepoint statement, which are never rolled back as a
+// statement.
+func isTxnControl(instructions []Instruction) bool {
+	if len(instructions) == 0 {
+		return false
+	}
+	switch instructions[0].Op {
+	case OP_TXN_BEGIN, OP_TXN_COMMIT, OP_TXN_ROLLBACK,
+		OP_SAVEPOINT, OP_ROLLBACK_TO_SAVEPOINT, OP_RELEASE_SAVEPOINT,
+		OP_SET_TRANSACTION, OP_SET_SESSION_TRANSACTION:
+		return true
+	}
+	return false
+}
+
+func (vm *VM) execute(instructions []Instruction) error {
 	vm.stack = nil
+	vm.returning = nil
 
 	for _, instr := range instructions {
 		switch instr.Op {
@@ -73,6 +166,14 @@ func (vm *VM) Execute(instructions []Instruction) error {
 		case OP_INSERT:
 			return vm.ExecuteInsert(instr.Value)
 
+		case OP_UPSERT:
+			return vm.ExecuteUpsert(instr.Value)
+
+		case OP_RETURNING:
+			if err := vm.ExecReturning(instr.Value); err != nil {
+				return err
+			}
+
 		case OP_SELECT:
 			return vm.ExecuteSelect(instr.Value)
 
@@ -97,38 +198,89 @@ func (vm *VM) Execute(instructions []Instruction) error {
 				return err
 			}
 
-		case OP_DELETE:
+		case OP_ANALYZE:
+			return vm.ExecAnalyze(instr.Value)
 
-			var payload types.SelectPayload
+		case OP_CREATE_VIEW:
+			return vm.ExecCreateView(instr.Value)
 
-			err := json.Unmarshal([]byte(instr.Value), &payload)
-			if err != nil {
-				return fmt.Errorf("failed to decode delete payload: %w", err)
-			}
+		case OP_DROP_VIEW:
+			return vm.ExecDropView(instr.Value)
 
-			err = vm.storageEngine.DeleteRows(payload.Table, payload.WhereCol, payload.WhereVal)
-			if err != nil {
-				return err
-			}
+		case OP_REFRESH_VIEW:
+			return vm.ExecRefreshView(instr.Value)
+
+		case OP_CREATE_TRIGGER:
+			return vm.ExecCreateTrigger(instr.Value)
+
+		case OP_DROP_TRIGGER:
+			return vm.ExecDropTrigger(instr.Value)
+
+		case OP_EXPLAIN:
+			return vm.ExecExplain(instr.Value)
+
+		case OP_DELETE:
+
+			return vm.ExecDelete(instr.Value)
 
 		case OP_TXN_BEGIN:
-			t, err := vm.storageEngine.BeginTransaction()
+			if vm.currentTxn != nil {
+				return fmt.Errorf("there is already a transaction in progress")
+			}
+			level := vm.isolation
+			if instr.Value != "" {
+				var err error
+				if level, err = txn.ParseIsolationLevel(instr.Value); err != nil {
+					return err
+				}
+			}
+			t, err := vm.storageEngine.BeginTransaction(level)
 			if err != nil {
 				return fmt.Errorf("BEGIN failed: %w", err)
 			}
+			vm.storageEngine.SetTriggerRunner(t, vm.runTrigger)
 			vm.currentTxn = t
+			vm.txnRan = false
 			return nil
 
 		case OP_TXN_COMMIT:
 			if vm.currentTxn == nil {
 				return fmt.Errorf("no active transaction")
 			}
-			if err := vm.storageEngine.CommitTransaction(vm.currentTxn.ID); err != nil {
+			err := vm.storageEngine.CommitTransaction(vm.currentTxn.ID)
+			if storageengine.IsSerializationFailure(err) {
+				// rolled back by the commit
+				vm.currentTxn = nil
+			}
+			if err != nil {
 				return fmt.Errorf("COMMIT failed: %w", err)
 			}
 			vm.currentTxn = nil
 			return nil
 
+		case OP_SET_TRANSACTION:
+			if vm.currentTxn == nil {
+				return fmt.Errorf("SET TRANSACTION can only be used in transaction blocks")
+			}
+			if vm.txnRan {
+				return fmt.Errorf("SET TRANSACTION ISOLATION LEVEL must be called before any query")
+			}
+			level, err := txn.ParseIsolationLevel(instr.Value)
+			if err != nil {
+				return err
+			}
+			vm.storageEngine.SetIsolationLevel(vm.currentTxn, level)
+			return nil
+
+		case OP_SET_SESSION_TRANSACTION:
+			level, err := txn.ParseIsolationLevel(instr.Value)
+			if err != nil {
+				return err
+			}
+			vm.isolation = level
+			fmt.Printf("default isolation level: %s\n", level)
+			return nil
+
 		case OP_TXN_ROLLBACK:
 			if vm.currentTxn == nil {
 				return fmt.Errorf("no active transaction")
@@ -139,6 +291,27 @@ func (vm *VM) Execute(instructions []Instruction) error {
 			vm.currentTxn = nil
 			return nil
 
+		case OP_SAVEPOINT:
+			if vm.currentTxn == nil {
+				return fmt.Errorf("SAVEPOINT can only be used in transaction blocks")
+			}
+			return vm.storageEngine.Savepoint(vm.currentTxn, instr.Value)
+
+		case OP_ROLLBACK_TO_SAVEPOINT:
+			if vm.currentTxn == nil {
+				return fmt.Errorf("ROLLBACK TO SAVEPOINT can only be used in transaction blocks")
+			}
+			if err := vm.storageEngine.RollbackToSavepoint(vm.currentTxn, instr.Value); err != nil {
+				return fmt.Errorf("ROLLBACK TO SAVEPOINT failed: %w", err)
+			}
+			return nil
+
+		case OP_RELEASE_SAVEPOINT:
+			if vm.currentTxn == nil {
+				return fmt.Errorf("RELEASE SAVEPOINT can only be used in transaction blocks")
+			}
+			return vm.storageEngine.ReleaseSavepoint(vm.currentTxn, instr.Value)
+
 		case OP_END:
 			return nil
 
@@ -17,20 +17,38 @@ func EmitBytecode(stmt parser.Statement) ([]executor.Instruction, error) {
 
 	case *parser.BeginTxnStmt:
 		instructions = append(instructions, executor.Instruction{
-			Op: executor.OP_TXN_BEGIN,
+			Op:    executor.OP_TXN_BEGIN,
+			Value: s.Isolation,
+		})
+
+	case *parser.SetTransactionStmt:
+		op := executor.OP_SET_TRANSACTION
+		if s.Session {
+			op = executor.OP_SET_SESSION_TRANSACTION
+		}
+		instructions = append(instructions, executor.Instruction{
+			Op:    op,
+			Value: s.Isolation,
 		})
 
 	case *parser.DeleteStatement:
 
 		deleteStmt := stmt.(*parser.DeleteStatement)
+		returning, err := emitReturning(deleteStmt.Returning)
+		if err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, returning...)
 
-		payload := types.SelectPayload{
+		payload := types.DeletePayload{
 			Table: deleteStmt.Table,
+			Alias: deleteStmt.Alias,
+			Using: convertJoins(deleteStmt.Using),
 		}
 
 		if deleteStmt.Where != nil {
-			payload.WhereCol = deleteStmt.Where.Left.Column
-			payload.WhereVal = fmt.Sprintf("%v", deleteStmt.Where.Right.Literal)
+			whereNode := convertExprToNode(deleteStmt.Where)
+			payload.WhereExpr = &whereNode
 		}
 
 		payloadJSON, err := json.Marshal(payload)
@@ -39,10 +57,15 @@ func EmitBytecode(stmt parser.Statement) ([]executor.Instruction, error) {
 		}
 
 		instructions = append(instructions, executor.Instruction{
-			Op:    executor.OP_DELETE,
+			Op:    executor.OP_PUSH_VAL,
 			Value: string(payloadJSON),
 		})
 
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_DELETE,
+			Value: deleteStmt.Table,
+		})
+
 	case *parser.CommitTxnStmt:
 		instructions = append(instructions, executor.Instruction{
 			Op: executor.OP_TXN_COMMIT,
@@ -55,6 +78,91 @@ func EmitBytecode(stmt parser.Statement) ([]executor.Instruction, error) {
 			Value: s.Table,
 		})
 
+	case *parser.AnalyzeStatement:
+
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_ANALYZE,
+			Value: s.Table,
+		})
+
+	case *parser.ExplainStatement:
+
+		payload := types.ExplainPayload{
+			Analyze: s.Analyze,
+			Format:  s.Format,
+			Select:  buildSelectPayload(s.Select),
+		}
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize explain payload: %w", err)
+		}
+
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_EXPLAIN,
+			Value: string(payloadJSON),
+		})
+
+	case *parser.CreateViewStmt:
+
+		payload := types.CreateViewPayload{
+			Name:         s.Name,
+			ColumnNames:  s.Columns,
+			OrReplace:    s.OrReplace,
+			Materialized: s.Materialized,
+			SQL:          s.SQL,
+			Query:        buildSelectPayload(s.Query),
+			References:   s.References,
+		}
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize view payload: %w", err)
+		}
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_CREATE_VIEW,
+			Value: string(payloadJSON),
+		})
+
+	case *parser.DropViewStmt:
+
+		payloadJSON, err := json.Marshal(types.ViewPayload{Name: s.Name, Materialized: s.Materialized})
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize view payload: %w", err)
+		}
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_DROP_VIEW,
+			Value: string(payloadJSON),
+		})
+
+	case *parser.RefreshViewStmt:
+
+		payloadJSON, err := json.Marshal(types.ViewPayload{Name: s.Name, Materialized: true, Concurrently: s.Concurrently})
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize view payload: %w", err)
+		}
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_REFRESH_VIEW,
+			Value: string(payloadJSON),
+		})
+
+	case *parser.CreateTriggerStmt:
+
+		trigger := types.TriggerDef{Name: s.Name, Table: s.Table, Timing: s.Timing, Event: s.Event, Body: s.Body}
+		payloadJSON, err := json.Marshal(trigger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize trigger: %w", err)
+		}
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_CREATE_TRIGGER,
+			Value: string(payloadJSON),
+		})
+
+	case *parser.DropTriggerStmt:
+
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_DROP_TRIGGER,
+			Value: s.Name,
+		})
+
 	case *parser.DropStatement:
 
 		instructions = append(instructions, executor.Instruction{
@@ -67,6 +175,24 @@ func EmitBytecode(stmt parser.Statement) ([]executor.Instruction, error) {
 			Op: executor.OP_TXN_ROLLBACK,
 		})
 
+	case *parser.SavepointStmt:
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_SAVEPOINT,
+			Value: s.Name,
+		})
+
+	case *parser.RollbackToSavepointStmt:
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_ROLLBACK_TO_SAVEPOINT,
+			Value: s.Name,
+		})
+
+	case *parser.ReleaseSavepointStmt:
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_RELEASE_SAVEPOINT,
+			Value: s.Name,
+		})
+
 	case *parser.CreateDatabaseStmt:
 		fmt.Println("CREATE DATABASE", s.DbName)
 
@@ -92,21 +218,29 @@ func EmitBytecode(stmt parser.Statement) ([]executor.Instruction, error) {
 
 		// -------- Build column schema --------
 		cols := []string{}
+		generated := map[string]types.GeneratedColumn{}
 		for _, col := range s.Columns {
 			segment := col.Type + ":" + col.Name
 			if col.IsPrimaryKey {
 				segment += ":pk"
 			}
 			cols = append(cols, segment)
+
+			if col.Generated != nil {
+				expr := convertExprToNode(col.Generated)
+				generated[col.Name] = types.GeneratedColumn{Expr: &expr, Stored: col.Stored}
+			}
 		}
 
-		// -------- Build full schema payload (with foreign keys) --------
+		// -------- Build full schema payload (with foreign keys and generated columns) --------
 		payload := struct {
-			Columns     string                 `json:"columns"`
-			ForeignKeys []parser.ForeignKeyDef `json:"foreign_keys,omitempty"`
+			Columns     string                           `json:"columns"`
+			ForeignKeys []parser.ForeignKeyDef           `json:"foreign_keys,omitempty"`
+			Generated   map[string]types.GeneratedColumn `json:"generated,omitempty"`
 		}{
 			Columns:     strings.Join(cols, ","),
 			ForeignKeys: s.ForeignKeys,
+			Generated:   generated,
 		}
 
 		payloadJSON, err := json.Marshal(payload)
@@ -128,17 +262,45 @@ func EmitBytecode(stmt parser.Statement) ([]executor.Instruction, error) {
 
 	case *parser.InsertStmt:
 		fmt.Println("INSERT", s.Table)
+		returning, err := emitReturning(s.Returning)
+		if err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, returning...)
 
+		// each value is pushed as a JSON expression node so the VM can
+		// type-check it against the column before evaluating it
 		for _, val := range s.Values {
-			fmt.Println("  PUSH_VAL", val)
+			valJSON, err := json.Marshal(convertExprToNode(val))
+			if err != nil {
+				return nil, fmt.Errorf("failed to serialize insert value: %w", err)
+			}
+			fmt.Println("  PUSH_VAL", string(valJSON))
 			instructions = append(instructions, executor.Instruction{
 				Op:    executor.OP_PUSH_VAL,
-				Value: val,
+				Value: string(valJSON),
 			})
 		}
-		// Execute insert
+		if s.OnConflict == nil {
+			// Execute insert
+			instructions = append(instructions, executor.Instruction{
+				Op:    executor.OP_INSERT,
+				Value: s.Table,
+			})
+			break
+		}
+
+		// INSERT ... ON CONFLICT: the clause is pushed after the values
+		conflictJSON, err := json.Marshal(buildOnConflict(s.OnConflict))
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize ON CONFLICT clause: %w", err)
+		}
 		instructions = append(instructions, executor.Instruction{
-			Op:    executor.OP_INSERT,
+			Op:    executor.OP_PUSH_VAL,
+			Value: string(conflictJSON),
+		})
+		instructions = append(instructions, executor.Instruction{
+			Op:    executor.OP_UPSERT,
 			Value: s.Table,
 		})
 
@@ -149,18 +311,8 @@ func EmitBytecode(stmt parser.Statement) ([]executor.Instruction, error) {
 			cols = strings.Join(s.Columns, ",") // get columns (comma seperated)
 		}
 		fmt.Printf("  values: %s", cols)
-		whereCol := s.WhereCol
-		whereVal := s.WhereValue
 		// package select metadata as JSON for executor
-		payload := types.SelectPayload{
-			Table:     s.Table,
-			WhereCol:  whereCol,
-			WhereVal:  whereVal,
-			JoinTable: s.JoinTable,
-			JoinType:  s.JoinType,
-			LeftCol:   s.LeftCol,
-			RightCol:  s.Rightcol,
-		}
+		payload := buildSelectPayload(s)
 		payloadJSON, _ := json.Marshal(payload)
 		// Execute select
 		instructions = append(instructions, executor.Instruction{
@@ -1,8 +1,11 @@
 package codegen
 
 import (
+	executor "DaemonDB/query_executor"
 	lex "DaemonDB/query_parser/lexer"
 	"DaemonDB/query_parser/parser"
+	"DaemonDB/types"
+	"encoding/json"
 	"testing"
 )
 
@@ -39,3 +42,42 @@ func TestEmitBytecode_ValidStatement_NoError(t *testing.T) {
 		t.Error("EmitBytecode expected at least one instruction (OP_END)")
 	}
 }
+
+// TestEmitBytecode_WithInlinesCTEs checks that a CTE becomes a derived table and
+// a recursive CTE's reference to itself its work table.
+func TestEmitBytecode_WithInlinesCTEs(t *testing.T) {
+	sql := "WITH RECURSIVE tree (id) AS (SELECT id FROM category WHERE id = 1 " +
+		"UNION SELECT c.id FROM category c JOIN tree t ON c.parent = t.id) SELECT id FROM tree"
+	stmt, err := parser.New(lex.New(sql)).ParseStatement()
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	instructions, err := EmitBytecode(stmt)
+	if err != nil {
+		t.Fatalf("EmitBytecode(WITH) unexpected error: %v", err)
+	}
+
+	var payload types.SelectPayload
+	for _, ins := range instructions {
+		if ins.Op == executor.OP_SELECT {
+			if err := json.Unmarshal([]byte(ins.Value), &payload); err != nil {
+				t.Fatalf("invalid select payload: %v", err)
+			}
+		}
+	}
+
+	cte := payload.FromSubquery
+	if payload.Table != "" || payload.Alias != "tree" || cte == nil {
+		t.Fatalf("FROM tree was not inlined: %+v", payload)
+	}
+	if cte.Recursive != "tree" || cte.SetOp == nil || len(cte.OutputNames) != 1 {
+		t.Fatalf("CTE query = %+v, want recursive UNION with one column name", cte)
+	}
+	if cte.SetOp.Left.Table != "category" {
+		t.Errorf("anchor reads %q, want category", cte.SetOp.Left.Table)
+	}
+	joins := cte.SetOp.Right.Joins
+	if len(joins) != 1 || joins[0].Subquery == nil || joins[0].Subquery.WorkTable != "tree" || joins[0].Alias != "t" {
+		t.Errorf("recursive part joins %+v, want the work table of tree AS t", joins)
+	}
+}
@@ -6,16 +6,22 @@ import (
 	"DaemonDB/types"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // UPDATE QUERY HELPERS
 
 func EmitUpdateBytecode(stmt *parser.UpdateStmt) ([]executor.Instruction, error) {
-	instructions := []executor.Instruction{}
+	instructions, err := emitReturning(stmt.Returning)
+	if err != nil {
+		return nil, err
+	}
 
 	payload := types.UpdatePayload{
 		Table:     stmt.Table,
+		Alias:     stmt.Alias,
 		SetExprs:  make(map[string]types.ExpressionNode),
+		From:      convertJoins(stmt.From),
 		WhereExpr: nil,
 	}
 
@@ -46,13 +52,238 @@ func EmitUpdateBytecode(stmt *parser.UpdateStmt) ([]executor.Instruction, error)
 	return instructions, nil
 }
 
+// emitReturning emits the OP_RETURNING that tells the VM to return the rows
+// the following INSERT, UPDATE or DELETE touches; an empty list is RETURNING *.
+func emitReturning(clause *parser.ReturningClause) ([]executor.Instruction, error) {
+	if clause == nil {
+		return []executor.Instruction{}, nil
+	}
+	projectionsJSON, err := json.Marshal(convertSelectItems(clause.Items))
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize RETURNING list: %w", err)
+	}
+	return []executor.Instruction{{
+		Op:    executor.OP_RETURNING,
+		Value: string(projectionsJSON),
+	}}, nil
+}
+
+// buildOnConflict converts the ON CONFLICT clause of an INSERT.
+func buildOnConflict(clause *parser.OnConflictClause) types.OnConflict {
+	conflict := types.OnConflict{Columns: clause.Columns, DoUpdate: clause.DoUpdate}
+	if clause.DoUpdate {
+		conflict.SetExprs = make(map[string]types.ExpressionNode)
+		for colName, expr := range clause.SetExprs {
+			conflict.SetExprs[colName] = convertExprToNode(expr)
+		}
+	}
+	if clause.Where != nil {
+		whereNode := convertExprToNode(clause.Where)
+		conflict.Where = &whereNode
+	}
+	return conflict
+}
+
+// SELECT QUERY HELPERS
+
+// buildSelectPayload converts a SELECT statement (or subquery) into the
+// payload executed by the storage engine.
+func buildSelectPayload(s *parser.SelectStmt) types.SelectPayload {
+	payload := types.SelectPayload{
+		Table:    s.Table,
+		Alias:    s.Alias,
+		Distinct: s.Distinct,
+	}
+	if s.SetOp != nil {
+		left := buildSelectPayload(s.SetOp.Left)
+		right := buildSelectPayload(s.SetOp.Right)
+		payload.SetOp = &types.SetOperation{Op: s.SetOp.Op, All: s.SetOp.All, Left: &left, Right: &right}
+	}
+	if s.FromSelect != nil {
+		from := buildSelectPayload(s.FromSelect)
+		payload.FromSubquery = &from
+	}
+	systemTable(&payload.Table, &payload.FromSubquery)
+	payload.Joins = convertJoins(s.Joins)
+	if s.Where != nil {
+		whereNode := convertExprToNode(s.Where)
+		payload.WhereExpr = &whereNode
+	}
+	payload.Projections = convertSelectItems(s.Items)
+	for _, item := range s.OrderBy {
+		node := convertExprToNode(item.Expr)
+		payload.OrderBy = append(payload.OrderBy, types.OrderByItem{Expr: &node, Desc: item.Desc})
+	}
+	if len(s.With) > 0 {
+		inlineCTEs(&payload, buildCTEs(s.With))
+	}
+	return payload
+}
+
+// convertJoins converts the joins of a SELECT, or the FROM / USING items of
+// UPDATE and DELETE.
+func convertJoins(joins []parser.JoinClause) []types.JoinClause {
+	var out []types.JoinClause
+	for _, j := range joins {
+		join := types.JoinClause{
+			TableRef: types.TableRef{Table: j.Table, Alias: j.Alias},
+			Type:     j.Type,
+			Using:    j.Using,
+			Natural:  j.Natural,
+		}
+		if j.Subquery != nil {
+			sub := buildSelectPayload(j.Subquery)
+			join.Subquery = &sub
+		}
+		systemTable(&join.Table, &join.Subquery)
+		if j.On != nil {
+			on := convertExprToNode(j.On)
+			join.On = &on
+		}
+		out = append(out, join)
+	}
+	return out
+}
+
+// systemTable turns a FROM item naming a system table (sys.locks) into a
+// derived table reading it.
+func systemTable(table *string, sub **types.SelectPayload) {
+	if name := strings.ToLower(*table); strings.HasPrefix(name, "sys.") {
+		*table, *sub = "", &types.SelectPayload{SystemTable: name}
+	}
+}
+
+// buildCTEs builds the query of every CTE of a WITH clause, keyed by its
+// lower-case name. A CTE sees the ones before it; a recursive one also sees
+// itself, as the work table.
+func buildCTEs(with []parser.CommonTableExpr) map[string]*types.SelectPayload {
+	ctes := make(map[string]*types.SelectPayload)
+	for _, cte := range with {
+		query := buildSelectPayload(cte.Query)
+		query.OutputNames = cte.Columns
+		if cte.Recursive {
+			self := map[string]*types.SelectPayload{
+				strings.ToLower(cte.Name): {WorkTable: cte.Name},
+			}
+			if inlineCTEs(&query, self) {
+				query.Recursive = cte.Name
+			}
+		}
+		inlineCTEs(&query, ctes)
+		ctes[strings.ToLower(cte.Name)] = &query
+	}
+	return ctes
+}
+
+// inlineCTEs turns every FROM item of payload (and of its subqueries) that
+// names one of ctes into a derived table running the CTE's query, and reports
+// whether there was any. A CTE referenced twice runs twice.
+func inlineCTEs(payload *types.SelectPayload, ctes map[string]*types.SelectPayload) bool {
+	found := false
+	inline := func(table, alias *string, sub **types.SelectPayload) {
+		if *sub != nil {
+			// a CTE's own query was resolved when the CTE was built
+			for _, cte := range ctes {
+				if cte == *sub {
+					return
+				}
+			}
+			found = inlineCTEs(*sub, ctes) || found
+			return
+		}
+		if cte, ok := ctes[strings.ToLower(*table)]; ok {
+			if *alias == "" {
+				*alias = *table
+			}
+			*table, *sub = "", cte
+			found = true
+		}
+	}
+
+	if payload.SetOp != nil {
+		found = inlineCTEs(payload.SetOp.Left, ctes) || found
+		found = inlineCTEs(payload.SetOp.Right, ctes) || found
+	}
+	if payload.Table != "" || payload.FromSubquery != nil {
+		inline(&payload.Table, &payload.Alias, &payload.FromSubquery)
+	}
+	exprs := []*types.ExpressionNode{payload.WhereExpr}
+	for i := range payload.Joins {
+		join := &payload.Joins[i]
+		inline(&join.Table, &join.Alias, &join.Subquery)
+		exprs = append(exprs, join.On)
+	}
+	for _, proj := range payload.Projections {
+		exprs = append(exprs, proj.Expr)
+	}
+	for _, item := range payload.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+
+	var walk func(expr *types.ExpressionNode)
+	walk = func(expr *types.ExpressionNode) {
+		if expr == nil {
+			return
+		}
+		if expr.Subquery != nil {
+			found = inlineCTEs(expr.Subquery, ctes) || found
+		}
+		for _, child := range expr.Children() {
+			walk(child)
+		}
+	}
+	for _, expr := range exprs {
+		walk(expr)
+	}
+	return found
+}
+
+// convertSelectItems converts the select list into projections. Output names
+// follow PostgreSQL: the alias, else the column or function name, else "?column?".
+// Repeated names get a numeric suffix so every output column stays addressable.
+func convertSelectItems(items []parser.SelectItem) []types.Projection {
+	projections := []types.Projection{}
+	seen := map[string]int{}
+
+	for _, item := range items {
+		name := item.Alias
+		if name == "" {
+			switch item.Expr.Type {
+			case parser.EXPR_COLUMN:
+				name = item.Expr.ColumnName
+			case parser.EXPR_FUNC:
+				name = strings.ToLower(item.Expr.FuncName)
+			case parser.EXPR_CASE:
+				name = "case"
+			case parser.EXPR_EXISTS:
+				name = "exists"
+			default:
+				name = "?column?"
+			}
+		}
+
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, seen[name])
+		}
+
+		node := convertExprToNode(item.Expr)
+		projections = append(projections, types.Projection{Expr: &node, Name: name})
+	}
+
+	return projections
+}
+
 // convertExprToNode converts parser.ValueExpr to executor.ExpressionNode
 func convertExprToNode(expr *parser.ValueExpr) types.ExpressionNode {
 	node := types.ExpressionNode{
-		Type:    int(expr.Type),
-		Literal: expr.Literal,
-		Column:  expr.ColumnName,
-		Op:      expr.Op,
+		Type:     int(expr.Type),
+		Literal:  expr.Literal,
+		Column:   expr.ColumnName,
+		Op:       expr.Op,
+		DataType: expr.DataType,
+		Func:     expr.FuncName,
+		Negate:   expr.Negate,
 	}
 
 	if expr.Left != nil {
@@ -65,5 +296,44 @@ func convertExprToNode(expr *parser.ValueExpr) types.ExpressionNode {
 		node.Right = &rightNode
 	}
 
+	for _, arg := range expr.Args {
+		argNode := convertExprToNode(arg)
+		node.Args = append(node.Args, &argNode)
+	}
+
+	for _, branch := range expr.Whens {
+		whenNode := convertExprToNode(branch.When)
+		thenNode := convertExprToNode(branch.Then)
+		node.Whens = append(node.Whens, types.CaseWhen{When: &whenNode, Then: &thenNode})
+	}
+
+	if expr.Else != nil {
+		elseNode := convertExprToNode(expr.Else)
+		node.Else = &elseNode
+	}
+
+	if expr.Escape != nil {
+		escapeNode := convertExprToNode(expr.Escape)
+		node.Escape = &escapeNode
+	}
+
+	if expr.Subquery != nil {
+		sub := buildSelectPayload(expr.Subquery)
+		node.Subquery = &sub
+	}
+
+	if expr.Window != nil {
+		window := &types.WindowSpec{Frame: expr.Window.Frame}
+		for _, key := range expr.Window.PartitionBy {
+			keyNode := convertExprToNode(key)
+			window.PartitionBy = append(window.PartitionBy, &keyNode)
+		}
+		for _, item := range expr.Window.OrderBy {
+			keyNode := convertExprToNode(item.Expr)
+			window.OrderBy = append(window.OrderBy, types.OrderByItem{Expr: &keyNode, Desc: item.Desc})
+		}
+		node.Window = window
+	}
+
 	return node
 }
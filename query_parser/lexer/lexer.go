@@ -24,7 +24,18 @@ func New(input string) *Lexer {
 
 func (l *Lexer) NextToken() Token {
 	l.skipWhiteSpaces()
+	pos := l.pos
+	tok := l.readToken()
+	tok.Pos = pos
+	return tok
+}
+
+// Input returns the text being tokenized.
+func (l *Lexer) Input() string {
+	return l.input
+}
 
+func (l *Lexer) readToken() Token {
 	switch l.ch {
 	case '+':
 		tok := Token{Kind: PLUS, Value: string(l.ch)}
@@ -98,10 +109,23 @@ func (l *Lexer) NextToken() Token {
 		tok := Token{Kind: CLOSEDROUNDED, Value: string(l.ch)}
 		l.readChar()
 		return tok
-	case '"':
+	case ';':
+		tok := Token{Kind: SEMICOLON, Value: string(l.ch)}
+		l.readChar()
+		return tok
+	case '"', '\'':
 		str := l.readString()
 		tok := Token{Kind: VARCHAR, Value: str}
 		return tok
+	case ':':
+		if l.peekChar() == ':' {
+			l.readChar()
+			l.readChar()
+			return Token{Kind: DOUBLECOLON, Value: "::"}
+		}
+		tok := Token{Kind: ILLEGAL, Value: string(l.ch)}
+		l.readChar()
+		return tok
 	case '.':
 		tok := Token{Kind: DOT, Value: string(l.ch)}
 		l.readChar()
@@ -114,7 +138,11 @@ func (l *Lexer) NextToken() Token {
 			str := l.keyIdentLookup() // str could be a keyword or an identifier
 			return Token{Kind: KeyIdentKind(str), Value: str}
 		} else if isNumber(l.ch) {
-			return Token{Kind: INT, Value: l.readNumber()}
+			num := l.readNumber()
+			if strings.Contains(num, ".") {
+				return Token{Kind: FLOAT, Value: num}
+			}
+			return Token{Kind: INT, Value: num}
 		} else {
 			return Token{Kind: INVALID, Value: string(l.ch)}
 		}
@@ -162,22 +190,31 @@ func (l *Lexer) keyIdentLookup() string {
 	return l.input[start:l.pos]
 }
 
+// readNumber reads an integer or a decimal literal (digits '.' digits).
 func (l *Lexer) readNumber() string {
 	start := l.pos
 	for isNumber(l.ch) {
 		l.readChar()
 	}
+	if l.ch == '.' && isNumber(l.peekChar()) {
+		l.readChar()
+		for isNumber(l.ch) {
+			l.readChar()
+		}
+	}
 	return l.input[start:l.pos]
 }
 
+// readString reads a literal quoted with either " or '.
 func (l *Lexer) readString() string {
-	l.readChar() // read start " of string
+	quote := l.ch
+	l.readChar() // read start quote of string
 	start := l.pos
-	for l.ch != '"' && l.ch != 0 { // read everything until closing "
+	for l.ch != quote && l.ch != 0 { // read everything until closing quote
 		l.readChar()
 	}
 	str := l.input[start:l.pos]
-	l.readChar() // read end " of string
+	l.readChar() // read end quote of string
 	return str
 }
 
@@ -242,6 +279,74 @@ func KeyIdentKind(str string) TokenKind {
 		return DOT
 	case "NULL":
 		return NULL
+	case "CAST":
+		return CAST
+	case "AS":
+		return AS
+	case "CASE":
+		return CASE
+	case "WHEN":
+		return WHEN
+	case "THEN":
+		return THEN
+	case "ELSE":
+		return ELSE
+	case "ORDER":
+		return ORDER
+	case "BY":
+		return BY
+	case "ASC":
+		return ASC
+	case "DESC":
+		return DESC
+	case "AND":
+		return AND
+	case "OR":
+		return OR
+	case "NOT":
+		return NOT
+	case "LIKE":
+		return LIKE
+	case "ILIKE":
+		return ILIKE
+	case "IN":
+		return IN
+	case "BETWEEN":
+		return BETWEEN
+	case "ESCAPE":
+		return ESCAPE
+	case "EXISTS":
+		return EXISTS
+	case "NATURAL":
+		return NATURAL
+	case "USING":
+		return USING
+	case "OUTER":
+		return OUTER
+	case "CROSS":
+		return CROSS
+	case "ANALYZE":
+		return ANALYZE
+	case "EXPLAIN":
+		return EXPLAIN
+	case "DISTINCT":
+		return DISTINCT
+	case "UNION":
+		return UNION
+	case "INTERSECT":
+		return INTERSECT
+	case "EXCEPT":
+		return EXCEPT
+	case "ALL":
+		return ALL
+	case "WITH":
+		return WITH
+	case "RECURSIVE":
+		return RECURSIVE
+	case "OVER":
+		return OVER
+	case "RETURNING":
+		return RETURNING
 	default:
 		return IDENT
 	}
@@ -56,12 +56,71 @@ const (
 	ON
 	DOT
 	NULL
+
+	// type casts
+	CAST
+	AS
+	DOUBLECOLON
+	FLOAT
+
+	// conditional expressions and ordering
+	CASE
+	WHEN
+	THEN
+	ELSE
+	ORDER
+	BY
+	ASC
+	DESC
+
+	// boolean connectives and predicates
+	AND
+	OR
+	NOT
+	LIKE
+	ILIKE
+	IN
+	BETWEEN
+	ESCAPE
+	EXISTS
+
+	// joins
+	NATURAL
+	USING
+	OUTER
+	CROSS
+
+	// optimizer statistics and plans
+	ANALYZE
+	EXPLAIN
+
+	// duplicate elimination and set operations
+	DISTINCT
+	UNION
+	INTERSECT
+	EXCEPT
+	ALL
+
+	// common table expressions
+	WITH
+	RECURSIVE
+
+	// window functions
+	OVER
+
+	// INSERT / UPDATE / DELETE ... RETURNING
+	RETURNING
+
+	// separates the statements of a trigger body
+	SEMICOLON
+
 	ILLEGAL
 )
 
 type Token struct {
 	Kind  TokenKind
 	Value string
+	Pos   int // offset of the token in the input
 }
 
 func (tk TokenKind) String() string {
@@ -154,6 +213,80 @@ func (tk TokenKind) String() string {
 		return "DOT"
 	case NULL:
 		return "NULL"
+	case CAST:
+		return "CAST"
+	case AS:
+		return "AS"
+	case DOUBLECOLON:
+		return "DOUBLECOLON"
+	case FLOAT:
+		return "FLOAT"
+	case CASE:
+		return "CASE"
+	case WHEN:
+		return "WHEN"
+	case THEN:
+		return "THEN"
+	case ELSE:
+		return "ELSE"
+	case ORDER:
+		return "ORDER"
+	case BY:
+		return "BY"
+	case ASC:
+		return "ASC"
+	case DESC:
+		return "DESC"
+	case AND:
+		return "AND"
+	case OR:
+		return "OR"
+	case NOT:
+		return "NOT"
+	case LIKE:
+		return "LIKE"
+	case ILIKE:
+		return "ILIKE"
+	case IN:
+		return "IN"
+	case BETWEEN:
+		return "BETWEEN"
+	case ESCAPE:
+		return "ESCAPE"
+	case EXISTS:
+		return "EXISTS"
+	case NATURAL:
+		return "NATURAL"
+	case USING:
+		return "USING"
+	case OUTER:
+		return "OUTER"
+	case CROSS:
+		return "CROSS"
+	case ANALYZE:
+		return "ANALYZE"
+	case EXPLAIN:
+		return "EXPLAIN"
+	case DISTINCT:
+		return "DISTINCT"
+	case UNION:
+		return "UNION"
+	case INTERSECT:
+		return "INTERSECT"
+	case EXCEPT:
+		return "EXCEPT"
+	case ALL:
+		return "ALL"
+	case WITH:
+		return "WITH"
+	case RECURSIVE:
+		return "RECURSIVE"
+	case OVER:
+		return "OVER"
+	case RETURNING:
+		return "RETURNING"
+	case SEMICOLON:
+		return "SEMICOLON"
 	case ILLEGAL:
 		return "ILLEGAL"
 	default:
@@ -15,8 +15,11 @@ type DropStatement struct {
 }
 
 type DeleteStatement struct {
-	Table string
-	Where *types.ExpressionNode
+	Table     string
+	Alias     string
+	Using     []JoinClause // USING items; the first is CROSS joined
+	Where     *ValueExpr
+	Returning *ReturningClause
 }
 
 // SHOW DATABASE statement
@@ -34,18 +37,77 @@ type TruncateStatement struct {
 
 func (t *TruncateStatement) statementNode() {}
 
-// SELECT statement
+// ANALYZE [table] statement; Table is empty for every table
+type AnalyzeStatement struct {
+	Table string
+}
+
+// EXPLAIN [ANALYZE] [FORMAT TEXT|JSON] select statement
+type ExplainStatement struct {
+	Analyze bool   // run the query and report what every operator did
+	Format  string // "text" (default) or "json"
+	Select  *SelectStmt
+}
+
+// SELECT statement. A query combining two others with UNION, INTERSECT or
+// EXCEPT has only SetOp and (for the whole result) OrderBy.
 type SelectStmt struct {
-	Columns    []string
+	Columns    []string // "*" or the select list as written (kept for display)
+	Distinct   bool
+	Items      []SelectItem
 	Table      string
-	WhereCol   string
-	WhereValue string
+	Alias      string
+	FromSelect *SelectStmt // FROM (SELECT ...) alias; Table is empty
+	Joins      []JoinClause
+	Where      *ValueExpr
+
+	OrderBy []OrderByItem
+
+	SetOp *SetOperation
+
+	With []CommonTableExpr // WITH clause, visible to the whole statement
+}
+
+// CommonTableExpr is one name [(col, ...)] AS (query) of a WITH clause.
+// Recursive is set for every CTE of WITH RECURSIVE; a CTE whose query does
+// not reference itself is an ordinary one even then.
+type CommonTableExpr struct {
+	Name      string
+	Columns   []string
+	Recursive bool
+	Query     *SelectStmt
+}
 
-	// join
-	JoinType  string
-	JoinTable string
-	LeftCol   string
-	Rightcol  string
+// SetOperation is left UNION | INTERSECT | EXCEPT [ALL] right
+type SetOperation struct {
+	Op    string // UNION, INTERSECT, EXCEPT
+	All   bool
+	Left  *SelectStmt
+	Right *SelectStmt
+}
+
+// JoinClause is one [NATURAL] [INNER|LEFT|RIGHT|FULL] JOIN item [ON ... | USING (...)],
+// or a CROSS JOIN item / ", item" without a condition
+type JoinClause struct {
+	Type     string // INNER, LEFT, RIGHT, FULL, CROSS
+	Table    string
+	Alias    string
+	Subquery *SelectStmt // JOIN (SELECT ...) alias
+	On       *ValueExpr
+	Using    []string
+	Natural  bool
+}
+
+// SelectItem is one expression of the select list with its optional alias.
+type SelectItem struct {
+	Expr  *ValueExpr
+	Alias string
+}
+
+// OrderByItem is one ORDER BY key.
+type OrderByItem struct {
+	Expr *ValueExpr
+	Desc bool
 }
 
 // CREATE TABLE statement
@@ -56,9 +118,11 @@ type CreateTableStmt struct {
 }
 
 type ColumnDef struct {
-	Name         string `json:"name"`
-	Type         string `json:"type"`
-	IsPrimaryKey bool   `json:"is_primary_key"`
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	IsPrimaryKey bool       `json:"is_primary_key"`
+	Generated    *ValueExpr `json:"-"` // GENERATED ALWAYS AS (expr)
+	Stored       bool       `json:"-"` // ... STORED (default VIRTUAL)
 }
 
 // For foreign key
@@ -70,8 +134,18 @@ type ForeignKeyDef struct {
 
 // INSERT statement
 type InsertStmt struct {
-	Table  string
-	Values []string
+	Table      string
+	Values     []*ValueExpr
+	OnConflict *OnConflictClause // nil: a duplicate key is an error
+	Returning  *ReturningClause
+}
+
+// OnConflictClause is ON CONFLICT [(columns)] DO NOTHING | DO UPDATE SET ...
+type OnConflictClause struct {
+	Columns  []string              // conflict target; may be empty for DO NOTHING
+	DoUpdate bool                  // false: DO NOTHING
+	SetExprs map[string]*ValueExpr // DO UPDATE SET; EXCLUDED.col is the proposed row
+	Where    *ValueExpr            // DO UPDATE ... WHERE
 }
 
 // DROP statement
@@ -87,6 +161,15 @@ const (
 	EXPR_COLUMN
 	EXPR_BINARY
 	EXPR_COMPARISON
+	EXPR_CAST
+	EXPR_FUNC
+	EXPR_CASE
+	EXPR_LOGICAL // AND, OR, NOT
+	EXPR_LIKE    // LIKE, ILIKE
+	EXPR_IN
+	EXPR_BETWEEN
+	EXPR_SUBQUERY // scalar (SELECT ...)
+	EXPR_EXISTS
 )
 
 type ValueExpr struct {
@@ -96,18 +179,113 @@ type ValueExpr struct {
 	Left       *ValueExpr
 	Right      *ValueExpr
 	Op         string // "+", "-", "*", "/"
+	DataType   string // literal type, or target type for EXPR_CAST
+
+	FuncName string       // EXPR_FUNC
+	Args     []*ValueExpr // EXPR_FUNC arguments, EXPR_IN list, EXPR_BETWEEN bounds
+	Whens    []CaseWhen   // EXPR_CASE
+	Else     *ValueExpr   // EXPR_CASE
+	Negate   bool         // NOT LIKE / NOT IN / NOT BETWEEN / NOT EXISTS
+	Escape   *ValueExpr   // EXPR_LIKE ... ESCAPE
+	Subquery *SelectStmt  // EXPR_SUBQUERY, EXPR_EXISTS, EXPR_IN (SELECT ...)
+	Window   *WindowSpec  // EXPR_FUNC ... OVER (...)
+}
+
+// WindowSpec is the OVER clause of a window function call.
+type WindowSpec struct {
+	PartitionBy []*ValueExpr
+	OrderBy     []OrderByItem
+	Frame       *types.WindowFrame // nil: the default frame
+}
+
+// CaseWhen is one WHEN ... THEN ... branch of a CASE expression.
+type CaseWhen struct {
+	When *ValueExpr
+	Then *ValueExpr
 }
 
 type UpdateStmt struct {
 	Table     string
+	Alias     string
 	SetExprs  map[string]*ValueExpr
+	From      []JoinClause // FROM items; the first is CROSS joined
 	WhereExpr *ValueExpr
+	Returning *ReturningClause
+}
+
+// ReturningClause is RETURNING * | expr [AS alias], ... of INSERT, UPDATE and DELETE.
+type ReturningClause struct {
+	Items []SelectItem // empty: RETURNING *
 }
 
 // TRANSACTION statements
 
-type BeginTxnStmt struct{}
+// BEGIN [TRANSACTION | WORK] [ISOLATION LEVEL level]; Isolation is empty for
+// the level of the session
+type BeginTxnStmt struct {
+	Isolation string
+}
 
 type CommitTxnStmt struct{}
 
 type RollbackTxnStmt struct{}
+
+// SET TRANSACTION ISOLATION LEVEL level, or with Session the level of the
+// transactions the session starts from now on
+// (SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL level)
+type SetTransactionStmt struct {
+	Isolation string
+	Session   bool
+}
+
+// SAVEPOINT name
+type SavepointStmt struct {
+	Name string
+}
+
+// ROLLBACK TO [SAVEPOINT] name
+type RollbackToSavepointStmt struct {
+	Name string
+}
+
+// RELEASE [SAVEPOINT] name
+type ReleaseSavepointStmt struct {
+	Name string
+}
+
+// CREATE [OR REPLACE] [MATERIALIZED] VIEW name [(col, ...)] AS query
+type CreateViewStmt struct {
+	Name         string
+	Columns      []string
+	OrReplace    bool
+	Materialized bool
+	Query        *SelectStmt
+	SQL          string   // the query as written, stored in the catalog
+	References   []string // table and view names in the FROM items of the query
+}
+
+// DROP [MATERIALIZED] VIEW name
+type DropViewStmt struct {
+	Name         string
+	Materialized bool
+}
+
+// REFRESH MATERIALIZED VIEW [CONCURRENTLY] name
+type RefreshViewStmt struct {
+	Name         string
+	Concurrently bool
+}
+
+// CREATE TRIGGER name {BEFORE|AFTER} {INSERT|UPDATE|DELETE} ON table FOR EACH ROW body
+type CreateTriggerStmt struct {
+	Name   string
+	Timing string // BEFORE | AFTER
+	Event  string // INSERT | UPDATE | DELETE
+	Table  string
+	Body   []string // the SQL of each statement, stored in the catalog
+}
+
+// DROP TRIGGER name
+type DropTriggerStmt struct {
+	Name string
+}
@@ -127,23 +127,32 @@ func (p *Parser) parseCreateTable() (*CreateTableStmt, error) {
 		}
 		p.nextToken()
 
-		isPK := false
-		if p.curToken.Kind == lex.IDENT &&
-			strings.EqualFold(p.curToken.Value, "primary") {
-
-			p.nextToken()
+		col := ColumnDef{
+			Name: name,
+			Type: typ,
+		}
+		for {
 			if p.curToken.Kind == lex.IDENT &&
-				strings.EqualFold(p.curToken.Value, "key") {
-				isPK = true
+				strings.EqualFold(p.curToken.Value, "primary") {
+
 				p.nextToken()
+				if p.curToken.Kind == lex.IDENT &&
+					strings.EqualFold(p.curToken.Value, "key") {
+					col.IsPrimaryKey = true
+					p.nextToken()
+				}
+				continue
+			}
+			if p.isWord("GENERATED") {
+				if err := p.parseGenerated(&col); err != nil {
+					return nil, err
+				}
+				continue
 			}
+			break
 		}
 
-		cols = append(cols, ColumnDef{
-			Name:         name,
-			Type:         typ,
-			IsPrimaryKey: isPK,
-		})
+		cols = append(cols, col)
 
 		if p.curToken.Kind == lex.COMMA {
 			p.nextToken()
@@ -162,6 +171,46 @@ func (p *Parser) parseCreateTable() (*CreateTableStmt, error) {
 	}, nil
 }
 
+// parseGenerated parses  GENERATED ALWAYS AS '(' expr ')' [STORED | VIRTUAL]
+// after the type of col.
+func (p *Parser) parseGenerated(col *ColumnDef) error {
+	if col.Generated != nil {
+		return fmt.Errorf("column %s: GENERATED given twice", col.Name)
+	}
+	p.nextToken()
+	if !p.isWord("ALWAYS") {
+		return fmt.Errorf("column %s: expected ALWAYS after GENERATED, got %s", col.Name, p.curToken.Value)
+	}
+	p.nextToken()
+	if err := p.expect(lex.AS); err != nil {
+		return err
+	}
+	p.nextToken()
+	if err := p.expect(lex.OPENROUNDED); err != nil {
+		return err
+	}
+	p.nextToken()
+
+	expr, err := p.parseExpression()
+	if err != nil {
+		return fmt.Errorf("column %s: %w", col.Name, err)
+	}
+	if err := p.expect(lex.CLOSEDROUNDED); err != nil {
+		return err
+	}
+	p.nextToken()
+	col.Generated = expr
+
+	switch {
+	case p.isWord("STORED"):
+		col.Stored = true
+		p.nextToken()
+	case p.isWord("VIRTUAL"):
+		p.nextToken()
+	}
+	return nil
+}
+
 func (p *Parser) parseTruncateStatement() (*TruncateStatement, error) {
 
 	// move to TABLE
@@ -192,6 +241,12 @@ func (p *Parser) parseDropTable() (Statement, error) {
 	// expect TABLE keyword
 	p.nextToken()
 
+	if p.isWord("VIEW") || p.isWord("MATERIALIZED") {
+		return p.parseDropView()
+	}
+	if p.isWord("TRIGGER") {
+		return p.parseDropTrigger()
+	}
 	if p.curToken.Value != "TABLE" && p.curToken.Value != "table" {
 		return nil, fmt.Errorf("expected TABLE after DROP")
 	}
@@ -2,9 +2,7 @@ package parser
 
 import (
 	lex "DaemonDB/query_parser/lexer"
-	"DaemonDB/types"
 	"fmt"
-	"strconv"
 	"strings"
 )
 
@@ -28,24 +26,138 @@ func (p *Parser) parseInsert() (*InsertStmt, error) {
 	}
 	p.nextToken()
 
-	values := []string{}
+	values := []*ValueExpr{}
 	for p.curToken.Kind != lex.CLOSEDROUNDED && p.curToken.Kind != lex.END {
-		switch p.curToken.Kind {
-		case lex.VARCHAR, lex.INT:
-			values = append(values, p.curToken.Value)
-			p.nextToken()
-		case lex.COMMA:
+		if p.curToken.Kind == lex.COMMA {
 			p.nextToken()
-		default:
+			continue
+		}
+		if !p.startsExpression() {
 			return nil, fmt.Errorf("%w: got %s (%s)", ErrUnexpectedTokenInValues, p.curToken.Kind, p.curToken.Value)
 		}
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, expr)
 	}
 
 	if p.curToken.Kind == lex.CLOSEDROUNDED {
 		p.nextToken()
 	}
 
-	return &InsertStmt{Table: table, Values: values}, nil
+	stmt := &InsertStmt{Table: table, Values: values}
+	if p.curToken.Kind == lex.ON {
+		conflict, err := p.parseOnConflict()
+		if err != nil {
+			return nil, err
+		}
+		stmt.OnConflict = conflict
+	}
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Returning = returning
+	return stmt, nil
+}
+
+// parseReturning parses an optional RETURNING * | expr [ [AS] alias ] { , ... }
+func (p *Parser) parseReturning() (*ReturningClause, error) {
+	if p.curToken.Kind != lex.RETURNING {
+		return nil, nil
+	}
+	p.nextToken()
+
+	clause := &ReturningClause{Items: []SelectItem{}}
+	if p.curToken.Kind == lex.ASTERISK {
+		p.nextToken()
+		return clause, nil
+	}
+	for {
+		if !p.startsExpression() {
+			return nil, fmt.Errorf("expected * or an expression after RETURNING, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+		}
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		clause.Items = append(clause.Items, item)
+		if p.curToken.Kind != lex.COMMA {
+			return clause, nil
+		}
+		p.nextToken()
+	}
+}
+
+// parseOnConflict parses
+//
+//	ON CONFLICT [ '(' column { ',' column } ')' ]
+//	    DO NOTHING | DO UPDATE SET column = expression { ',' ... } [ WHERE condition ]
+func (p *Parser) parseOnConflict() (*OnConflictClause, error) {
+	p.nextToken()
+	if !p.isWord("CONFLICT") {
+		return nil, fmt.Errorf("expected CONFLICT after ON, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+	}
+	p.nextToken()
+
+	clause := &OnConflictClause{}
+	if p.curToken.Kind == lex.OPENROUNDED {
+		p.nextToken()
+		for {
+			if err := p.expect(lex.IDENT); err != nil {
+				return nil, err
+			}
+			clause.Columns = append(clause.Columns, p.curToken.Value)
+			p.nextToken()
+			if p.curToken.Kind != lex.COMMA {
+				break
+			}
+			p.nextToken()
+		}
+		if err := p.expect(lex.CLOSEDROUNDED); err != nil {
+			return nil, err
+		}
+		p.nextToken()
+	}
+
+	if !p.isWord("DO") {
+		return nil, fmt.Errorf("expected DO after ON CONFLICT, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+	}
+	p.nextToken()
+
+	switch {
+	case p.isWord("NOTHING"):
+		p.nextToken()
+		return clause, nil
+	case p.curToken.Kind == lex.UPDATE:
+		p.nextToken()
+	default:
+		return nil, fmt.Errorf("expected NOTHING or UPDATE after DO, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+	}
+
+	if len(clause.Columns) == 0 {
+		return nil, fmt.Errorf("ON CONFLICT DO UPDATE requires a conflict target, e.g. ON CONFLICT (id)")
+	}
+	if err := p.expect(lex.SET); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+
+	clause.DoUpdate = true
+	sets, err := p.parseAssignments()
+	if err != nil {
+		return nil, err
+	}
+	clause.SetExprs = sets
+
+	if p.curToken.Kind == lex.WHERE {
+		p.nextToken()
+		if clause.Where, err = p.parseWhereExpression(); err != nil {
+			return nil, err
+		}
+	}
+	return clause, nil
 }
 
 func (p *Parser) parseDrop() (*DropStmt, error) {
@@ -54,14 +166,26 @@ func (p *Parser) parseDrop() (*DropStmt, error) {
 	p.nextToken()
 	return &DropStmt{Table: table}, nil
 }
+
+// parseUpdate parses
+//
+//	UPDATE table [[AS] alias] SET col = expr {, col = expr} [FROM from_item {join}] [WHERE expr] [RETURNING ...]
 func (p *Parser) parseUpdate() (*UpdateStmt, error) {
 	stmt := &UpdateStmt{
 		SetExprs: make(map[string]*ValueExpr),
 	}
 
 	p.nextToken()
+	if err := p.expect(lex.IDENT); err != nil {
+		return nil, fmt.Errorf("expected table name after UPDATE")
+	}
 	stmt.Table = p.curToken.Value
 	p.nextToken()
+	alias, err := p.parseTargetAlias()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Alias = alias
 
 	if err := p.expect(lex.SET); err != nil {
 		return nil, err
@@ -69,119 +193,68 @@ func (p *Parser) parseUpdate() (*UpdateStmt, error) {
 
 	p.nextToken()
 
-	// Parse SET clauses (e.g., SET age = age + 1, name = 'John')
-	for p.curToken.Kind != lex.WHERE && p.curToken.Kind != lex.END {
-		colName := p.curToken.Value
-		p.nextToken() // move to '='
-
-		if p.curToken.Kind != lex.EQUAL {
-			return nil, fmt.Errorf("expected '=' after column name, got %s", p.curToken.Value)
-		}
-		p.nextToken() // move to expression
-
-		expr := p.parseExpression()
-		stmt.SetExprs[colName] = expr
+	sets, err := p.parseAssignments()
+	if err != nil {
+		return nil, err
+	}
+	stmt.SetExprs = sets
 
-		if p.curToken.Kind == lex.COMMA {
-			p.nextToken()
+	if p.curToken.Kind == lex.FROM {
+		if stmt.From, err = p.parseExtraFromItems(); err != nil {
+			return nil, err
 		}
 	}
 
 	// Parse WHERE clause
 	if p.curToken.Kind == lex.WHERE {
 		p.nextToken()
-		stmt.WhereExpr = p.parseWhereExpression()
+		where, err := p.parseWhereExpression()
+		if err != nil {
+			return nil, err
+		}
+		stmt.WhereExpr = where
 	}
 
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Returning = returning
 	return stmt, nil
 }
 
-func (p *Parser) parseExpression() *ValueExpr {
-	left := p.parsePrimary()
-
-	for p.curToken.Kind == lex.PLUS ||
-		p.curToken.Kind == lex.MINUS ||
-		p.curToken.Kind == lex.ASTERISK ||
-		p.curToken.Kind == lex.DIV {
-
-		op := p.curToken.Value
-		p.nextToken()
-
-		right := p.parsePrimary()
+// parseAssignments parses the SET clauses of UPDATE and ON CONFLICT DO UPDATE
+// (e.g., SET age = age + 1, name = 'John'), up to FROM, WHERE, RETURNING, the end
+// or anything else after the last assignment (such as the ';' of a trigger body).
+func (p *Parser) parseAssignments() (map[string]*ValueExpr, error) {
+	sets := make(map[string]*ValueExpr)
+	for p.curToken.Kind != lex.FROM && p.curToken.Kind != lex.WHERE && p.curToken.Kind != lex.RETURNING && p.curToken.Kind != lex.END {
+		colName := p.curToken.Value
+		p.nextToken() // move to '='
 
-		left = &ValueExpr{
-			Type:  EXPR_BINARY,
-			Left:  left,
-			Right: right,
-			Op:    op,
+		if p.curToken.Kind != lex.EQUAL {
+			return nil, fmt.Errorf("expected '=' after column name, got %s", p.curToken.Value)
 		}
-	}
-
-	return left
-}
-
-func (p *Parser) parseWhereExpression() *ValueExpr {
-	left := p.parsePrimary()
-
-	// Handle comparison operators (=, !=, <, >, <=, >=)
-	if p.curToken.Kind == lex.EQUAL ||
-		p.curToken.Kind == lex.NOTEQUAL ||
-		p.curToken.Kind == lex.LESSTHAN ||
-		p.curToken.Kind == lex.GREATERTHAN ||
-		p.curToken.Kind == lex.LESSTHANEQUAL ||
-		p.curToken.Kind == lex.GREATERTHANEQUAL {
-
-		op := p.curToken.Value
-		p.nextToken()
-
-		right := p.parsePrimary()
+		p.nextToken() // move to expression
 
-		return &ValueExpr{
-			Type:  EXPR_COMPARISON,
-			Left:  left,
-			Right: right,
-			Op:    op,
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
 		}
-	}
+		sets[colName] = expr
 
-	return left
-}
-
-func (p *Parser) parsePrimary() *ValueExpr {
-	tok := p.curToken
-
-	switch tok.Kind {
-	case lex.INT:
-		val, _ := strconv.Atoi(tok.Value)
-		p.nextToken()
-		return &ValueExpr{
-			Type:    EXPR_LITERAL,
-			Literal: val,
+		// the list ends with the first assignment not followed by a comma
+		if p.curToken.Kind != lex.COMMA {
+			break
 		}
-	case lex.VARCHAR:
 		p.nextToken()
-		return &ValueExpr{
-			Type:    EXPR_LITERAL,
-			Literal: tok.Value,
-		}
-	case lex.IDENT:
-		p.nextToken()
-		return &ValueExpr{
-			Type:       EXPR_COLUMN,
-			ColumnName: tok.Value,
-		}
-	case lex.OPENROUNDED:
-		p.nextToken()
-		expr := p.parseExpression()
-		if p.curToken.Kind == lex.CLOSEDROUNDED {
-			p.nextToken()
-		}
-		return expr
 	}
-
-	return nil
+	return sets, nil
 }
 
+// parseDelete parses
+//
+//	DELETE FROM table [[AS] alias] [USING from_item {join}] [WHERE expr] [RETURNING ...]
 func (p *Parser) parseDelete() (Statement, error) {
 
 	// DELETE already in curToken
@@ -204,39 +277,67 @@ func (p *Parser) parseDelete() (Statement, error) {
 
 	// Move to next token
 	p.nextToken()
+	alias, err := p.parseTargetAlias()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Alias = alias
+
+	if p.curToken.Kind == lex.USING {
+		if stmt.Using, err = p.parseExtraFromItems(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Optional WHERE clause
 	if p.curToken.Kind == lex.WHERE {
-
 		p.nextToken()
-
-		if err := p.expect(lex.IDENT); err != nil {
-			return nil, fmt.Errorf("expected column name after WHERE")
+		if stmt.Where, err = p.parseWhereExpression(); err != nil {
+			return nil, err
 		}
+	}
 
-		column := p.curToken.Value
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Returning = returning
+	return stmt, nil
+}
 
+// parseTargetAlias parses the optional [AS] alias after the table of UPDATE and DELETE.
+func (p *Parser) parseTargetAlias() (string, error) {
+	if p.curToken.Kind == lex.AS {
 		p.nextToken()
-
-		operator := p.curToken.Value
-
+		if err := p.expect(lex.IDENT); err != nil {
+			return "", err
+		}
+	}
+	if p.curToken.Kind == lex.IDENT {
+		alias := p.curToken.Value
 		p.nextToken()
+		return alias, nil
+	}
+	return "", nil
+}
 
-		value := p.curToken.Value
+// parseExtraFromItems parses the FROM items of UPDATE or the USING items of DELETE
+// (curToken is FROM / USING): from_item {join}, the first item CROSS joined to the target.
+func (p *Parser) parseExtraFromItems() ([]JoinClause, error) {
+	p.nextToken()
+	first := JoinClause{Type: "CROSS"}
+	var err error
+	if first.Table, first.Alias, first.Subquery, err = p.parseFromItem(); err != nil {
+		return nil, err
+	}
 
-		stmt.Where = &types.ExpressionNode{
-			Type: 3,
-			Op:   operator,
-			Left: &types.ExpressionNode{
-				Type:   1,
-				Column: column,
-			},
-			Right: &types.ExpressionNode{
-				Type:    0,
-				Literal: value,
-			},
+	joins := []JoinClause{first}
+	for p.startsJoin() {
+		join, err := p.parseJoin()
+		if err != nil {
+			return nil, err
 		}
+		joins = append(joins, join)
 	}
-
-	return stmt, nil
+	return joins, nil
 }
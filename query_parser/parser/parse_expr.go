@@ -0,0 +1,693 @@
+package parser
+
+import (
+	lex "DaemonDB/query_parser/lexer"
+	"DaemonDB/types"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+This file contains the expression grammar shared by SELECT, INSERT, UPDATE and DELETE
+
+	where      := and { OR and }
+	and        := not { AND not }
+	not        := NOT not | predicate
+	predicate  := expression [ compareOp expression
+	                         | [NOT] (LIKE | ILIKE) expression [ ESCAPE expression ]
+	                         | [NOT] IN '(' ( select | expression { ',' expression } ) ')'
+	                         | [NOT] BETWEEN expression AND expression ]
+	expression := term { ('+' | '-') term }
+	term       := postfix { ('*' | '/') postfix }
+	postfix    := primary { '::' type }
+	primary    := literal | column | '(' where ')' | '(' select ')' | '-' primary
+	            | [NOT] EXISTS '(' select ')'
+	            | CAST '(' expression AS type ')'
+	            | name '(' [ expression { ',' expression } | '*' ] ')' [ OVER window ]
+	            | CASE [ expression ] WHEN where THEN expression { WHEN ... } [ ELSE expression ] END
+	window     := '(' [ PARTITION BY expression { ',' expression } ] [ ORDER BY ... ]
+	              [ (ROWS | RANGE) ( BETWEEN bound AND bound | bound ) ] ')'
+	bound      := UNBOUNDED (PRECEDING | FOLLOWING) | CURRENT ROW | number (PRECEDING | FOLLOWING)
+*/
+
+func isComparisonToken(kind lex.TokenKind) bool {
+	return kind == lex.EQUAL ||
+		kind == lex.NOTEQUAL ||
+		kind == lex.LESSTHAN ||
+		kind == lex.GREATERTHAN ||
+		kind == lex.LESSTHANEQUAL ||
+		kind == lex.GREATERTHANEQUAL
+}
+
+// startsExpression reports whether the current token can begin an expression.
+func (p *Parser) startsExpression() bool {
+	switch p.curToken.Kind {
+	case lex.INT, lex.FLOAT, lex.VARCHAR, lex.NULL, lex.IDENT,
+		lex.OPENROUNDED, lex.MINUS, lex.CAST, lex.CASE, lex.NOT, lex.EXISTS:
+		return true
+	}
+	return false
+}
+
+func (p *Parser) parseExpression() (*ValueExpr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.curToken.Kind == lex.PLUS || p.curToken.Kind == lex.MINUS {
+		op := p.curToken.Value
+		p.nextToken()
+
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &ValueExpr{
+			Type:  EXPR_BINARY,
+			Left:  left,
+			Right: right,
+			Op:    op,
+		}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseTerm() (*ValueExpr, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.curToken.Kind == lex.ASTERISK || p.curToken.Kind == lex.DIV {
+		op := p.curToken.Value
+		p.nextToken()
+
+		right, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &ValueExpr{
+			Type:  EXPR_BINARY,
+			Left:  left,
+			Right: right,
+			Op:    op,
+		}
+	}
+
+	return left, nil
+}
+
+// parsePostfix handles the PostgreSQL-style cast suffix: expr::type
+func (p *Parser) parsePostfix() (*ValueExpr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.curToken.Kind == lex.DOUBLECOLON {
+		p.nextToken()
+		typ, err := p.parseTypeName()
+		if err != nil {
+			return nil, err
+		}
+		expr = &ValueExpr{Type: EXPR_CAST, Left: expr, DataType: typ}
+	}
+
+	return expr, nil
+}
+
+func (p *Parser) parseWhereExpression() (*ValueExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.curToken.Kind == lex.OR {
+		p.nextToken()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &ValueExpr{Type: EXPR_LOGICAL, Left: left, Right: right, Op: "OR"}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseAnd() (*ValueExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.curToken.Kind == lex.AND {
+		p.nextToken()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &ValueExpr{Type: EXPR_LOGICAL, Left: left, Right: right, Op: "AND"}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseNot() (*ValueExpr, error) {
+	if p.curToken.Kind == lex.NOT {
+		p.nextToken()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		// NOT EXISTS stays one node so the planner can turn it into an anti join
+		if operand.Type == EXPR_EXISTS {
+			operand.Negate = !operand.Negate
+			return operand, nil
+		}
+		return &ValueExpr{Type: EXPR_LOGICAL, Left: operand, Op: "NOT"}, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *Parser) parsePredicate() (*ValueExpr, error) {
+	left, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle comparison operators (=, !=, <, >, <=, >=)
+	if isComparisonToken(p.curToken.Kind) {
+		op := p.curToken.Value
+		p.nextToken()
+
+		right, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		return &ValueExpr{
+			Type:  EXPR_COMPARISON,
+			Left:  left,
+			Right: right,
+			Op:    op,
+		}, nil
+	}
+
+	negate := false
+	if p.curToken.Kind == lex.NOT {
+		negate = true
+		p.nextToken()
+	}
+
+	switch p.curToken.Kind {
+	case lex.LIKE, lex.ILIKE:
+		return p.parseLike(left, negate)
+	case lex.IN:
+		return p.parseInList(left, negate)
+	case lex.BETWEEN:
+		return p.parseBetween(left, negate)
+	}
+
+	if negate {
+		return nil, fmt.Errorf("expected LIKE, ILIKE, IN or BETWEEN after NOT, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+	}
+	return left, nil
+}
+
+func (p *Parser) parseLike(left *ValueExpr, negate bool) (*ValueExpr, error) {
+	op := strings.ToUpper(p.curToken.Value)
+	p.nextToken()
+
+	pattern, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	expr := &ValueExpr{Type: EXPR_LIKE, Left: left, Right: pattern, Op: op, Negate: negate}
+
+	if p.curToken.Kind == lex.ESCAPE {
+		p.nextToken()
+		if expr.Escape, err = p.parseExpression(); err != nil {
+			return nil, err
+		}
+	}
+	return expr, nil
+}
+
+func (p *Parser) parseInList(left *ValueExpr, negate bool) (*ValueExpr, error) {
+	p.nextToken()
+	if err := p.expect(lex.OPENROUNDED); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+
+	expr := &ValueExpr{Type: EXPR_IN, Left: left, Negate: negate}
+	if p.curToken.Kind == lex.SELECT || p.curToken.Kind == lex.WITH {
+		sub, err := p.parseSubquerySelect()
+		if err != nil {
+			return nil, err
+		}
+		expr.Subquery = sub
+		return expr, nil
+	}
+	for {
+		item, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		expr.Args = append(expr.Args, item)
+		if p.curToken.Kind != lex.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+
+	if err := p.expect(lex.CLOSEDROUNDED); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+	return expr, nil
+}
+
+func (p *Parser) parseBetween(left *ValueExpr, negate bool) (*ValueExpr, error) {
+	p.nextToken()
+	low, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(lex.AND); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+	high, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &ValueExpr{Type: EXPR_BETWEEN, Left: left, Args: []*ValueExpr{low, high}, Negate: negate}, nil
+}
+
+func (p *Parser) parsePrimary() (*ValueExpr, error) {
+	tok := p.curToken
+
+	switch tok.Kind {
+	case lex.INT:
+		val, err := strconv.Atoi(tok.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer literal %q", tok.Value)
+		}
+		p.nextToken()
+		return &ValueExpr{
+			Type:     EXPR_LITERAL,
+			Literal:  val,
+			DataType: types.TypeInt,
+		}, nil
+	case lex.FLOAT:
+		val, err := strconv.ParseFloat(tok.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float literal %q", tok.Value)
+		}
+		p.nextToken()
+		return &ValueExpr{
+			Type:     EXPR_LITERAL,
+			Literal:  val,
+			DataType: types.TypeFloat,
+		}, nil
+	case lex.VARCHAR:
+		p.nextToken()
+		return &ValueExpr{
+			Type:     EXPR_LITERAL,
+			Literal:  tok.Value,
+			DataType: types.TypeVarchar,
+		}, nil
+	case lex.NULL:
+		p.nextToken()
+		return &ValueExpr{
+			Type:     EXPR_LITERAL,
+			DataType: types.TypeNull,
+		}, nil
+	case lex.IDENT:
+		if p.peekToken.Kind == lex.OPENROUNDED {
+			return p.parseFunctionCall()
+		}
+		name := p.parseQualifiedIdentifier()
+		if p.row != nil {
+			if expr, ok, err := p.row.ref(name); ok || err != nil {
+				return expr, err
+			}
+		}
+		return &ValueExpr{
+			Type:       EXPR_COLUMN,
+			ColumnName: name,
+		}, nil
+	case lex.MINUS:
+		p.nextToken()
+		operand, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		// Fold negative numeric literals so INSERT ... VALUES (-5) stays a literal.
+		if operand.Type == EXPR_LITERAL {
+			switch v := operand.Literal.(type) {
+			case int:
+				operand.Literal = -v
+				return operand, nil
+			case float64:
+				operand.Literal = -v
+				return operand, nil
+			}
+		}
+		return &ValueExpr{
+			Type:  EXPR_BINARY,
+			Left:  &ValueExpr{Type: EXPR_LITERAL, Literal: 0, DataType: types.TypeInt},
+			Right: operand,
+			Op:    "-",
+		}, nil
+	case lex.CAST:
+		return p.parseCast()
+	case lex.CASE:
+		return p.parseCase()
+	case lex.EXISTS:
+		p.nextToken()
+		if err := p.expect(lex.OPENROUNDED); err != nil {
+			return nil, err
+		}
+		p.nextToken()
+		sub, err := p.parseSubquerySelect()
+		if err != nil {
+			return nil, err
+		}
+		return &ValueExpr{Type: EXPR_EXISTS, Subquery: sub}, nil
+	case lex.OPENROUNDED:
+		p.nextToken()
+		if p.curToken.Kind == lex.SELECT || p.curToken.Kind == lex.WITH {
+			sub, err := p.parseSubquerySelect()
+			if err != nil {
+				return nil, err
+			}
+			return &ValueExpr{Type: EXPR_SUBQUERY, Subquery: sub}, nil
+		}
+		expr, err := p.parseWhereExpression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(lex.CLOSEDROUNDED); err != nil {
+			return nil, err
+		}
+		p.nextToken()
+		return expr, nil
+	}
+
+	return nil, fmt.Errorf("unexpected token in expression: %s (%s)", tok.Kind, tok.Value)
+}
+
+// parseSubquerySelect parses a SELECT whose opening '(' has been consumed,
+// including the closing ')'.
+func (p *Parser) parseSubquerySelect() (*SelectStmt, error) {
+	sub, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(lex.CLOSEDROUNDED); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+	return sub, nil
+}
+
+// parseCast parses CAST '(' expression AS type ')'
+func (p *Parser) parseCast() (*ValueExpr, error) {
+	p.nextToken()
+	if err := p.expect(lex.OPENROUNDED); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+
+	operand, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(lex.AS); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+
+	typ, err := p.parseTypeName()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(lex.CLOSEDROUNDED); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+
+	return &ValueExpr{Type: EXPR_CAST, Left: operand, DataType: typ}, nil
+}
+
+// parseTypeName reads a type name and normalizes it (e.g. integer → INT).
+func (p *Parser) parseTypeName() (string, error) {
+	if p.curToken.Kind != lex.IDENT && p.curToken.Kind != lex.NULL {
+		return "", fmt.Errorf("expected type name, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+	}
+	typ, err := types.NormalizeType(p.curToken.Value)
+	if err != nil {
+		return "", err
+	}
+	p.nextToken()
+	return typ, nil
+}
+
+// parseFunctionCall parses name '(' args ')' [OVER window]. Whether the
+// function exists is checked later, against the function registry, by the
+// type checker.
+func (p *Parser) parseFunctionCall() (*ValueExpr, error) {
+	name := strings.ToUpper(p.curToken.Value)
+	p.nextToken() // '('
+	p.nextToken()
+
+	args := []*ValueExpr{}
+	if name == "COUNT" && p.curToken.Kind == lex.ASTERISK {
+		p.nextToken() // COUNT(*) counts rows, like COUNT() would
+	}
+	for p.curToken.Kind != lex.CLOSEDROUNDED {
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		if p.curToken.Kind != lex.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+
+	if err := p.expect(lex.CLOSEDROUNDED); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+
+	expr := &ValueExpr{Type: EXPR_FUNC, FuncName: name, Args: args}
+	if p.curToken.Kind == lex.OVER {
+		p.nextToken()
+		window, err := p.parseWindow()
+		if err != nil {
+			return nil, fmt.Errorf("%s OVER: %w", name, err)
+		}
+		expr.Window = window
+	}
+	return expr, nil
+}
+
+// parseWindow parses the parenthesized window after OVER.
+func (p *Parser) parseWindow() (*WindowSpec, error) {
+	if err := p.expect(lex.OPENROUNDED); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+
+	window := &WindowSpec{}
+	if p.isWord("PARTITION") {
+		p.nextToken()
+		if err := p.expect(lex.BY); err != nil {
+			return nil, err
+		}
+		p.nextToken()
+		for {
+			key, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			window.PartitionBy = append(window.PartitionBy, key)
+			if p.curToken.Kind != lex.COMMA {
+				break
+			}
+			p.nextToken()
+		}
+	}
+
+	orderBy, err := p.parseOrderBy()
+	if err != nil {
+		return nil, err
+	}
+	window.OrderBy = orderBy
+
+	if p.isWord("ROWS") || p.isWord("RANGE") {
+		if window.Frame, err = p.parseFrame(); err != nil {
+			return nil, err
+		}
+		if window.Frame.Mode == "RANGE" && window.Frame.HasOffset() && len(window.OrderBy) != 1 {
+			return nil, fmt.Errorf("RANGE with offset PRECEDING/FOLLOWING requires exactly one ORDER BY column")
+		}
+	}
+
+	if err := p.expect(lex.CLOSEDROUNDED); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+	return window, nil
+}
+
+// parseFrame parses (ROWS | RANGE) (BETWEEN bound AND bound | bound).
+func (p *Parser) parseFrame() (*types.WindowFrame, error) {
+	frame := &types.WindowFrame{Mode: strings.ToUpper(p.curToken.Value)}
+	p.nextToken()
+
+	var err error
+	if p.curToken.Kind == lex.BETWEEN {
+		p.nextToken()
+		if frame.Start, err = p.parseFrameBound(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(lex.AND); err != nil {
+			return nil, err
+		}
+		p.nextToken()
+		if frame.End, err = p.parseFrameBound(); err != nil {
+			return nil, err
+		}
+	} else {
+		if frame.Start, err = p.parseFrameBound(); err != nil {
+			return nil, err
+		}
+		frame.End = types.FrameBound{Kind: types.BoundCurrentRow}
+	}
+
+	if err := frame.Validate(); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// parseFrameBound parses one bound of a window frame.
+func (p *Parser) parseFrameBound() (types.FrameBound, error) {
+	var bound types.FrameBound
+	switch {
+	case p.isWord("UNBOUNDED"):
+		p.nextToken()
+		switch {
+		case p.isWord("PRECEDING"):
+			bound.Kind = types.BoundUnboundedPreceding
+		case p.isWord("FOLLOWING"):
+			bound.Kind = types.BoundUnboundedFollowing
+		default:
+			return bound, fmt.Errorf("expected PRECEDING or FOLLOWING after UNBOUNDED, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+		}
+
+	case p.isWord("CURRENT"):
+		p.nextToken()
+		if !p.isWord("ROW") {
+			return bound, fmt.Errorf("expected ROW after CURRENT, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+		}
+		bound.Kind = types.BoundCurrentRow
+
+	case p.curToken.Kind == lex.INT || p.curToken.Kind == lex.FLOAT:
+		offset, err := strconv.ParseFloat(p.curToken.Value, 64)
+		if err != nil {
+			return bound, fmt.Errorf("invalid frame offset %q", p.curToken.Value)
+		}
+		bound.Offset = offset
+		p.nextToken()
+		switch {
+		case p.isWord("PRECEDING"):
+			bound.Kind = types.BoundPreceding
+		case p.isWord("FOLLOWING"):
+			bound.Kind = types.BoundFollowing
+		default:
+			return bound, fmt.Errorf("expected PRECEDING or FOLLOWING after %s, got %s (%s)",
+				strconv.FormatFloat(offset, 'f', -1, 64), p.curToken.Kind, p.curToken.Value)
+		}
+
+	default:
+		return bound, fmt.Errorf("expected frame bound, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+	}
+	p.nextToken()
+	return bound, nil
+}
+
+// parseCase parses both the searched form (CASE WHEN cond THEN ...) and the
+// simple form (CASE x WHEN value THEN ...), which is rewritten to x = value.
+func (p *Parser) parseCase() (*ValueExpr, error) {
+	p.nextToken()
+
+	var operand *ValueExpr
+	if p.curToken.Kind != lex.WHEN {
+		var err error
+		if operand, err = p.parseExpression(); err != nil {
+			return nil, err
+		}
+	}
+
+	expr := &ValueExpr{Type: EXPR_CASE}
+	for p.curToken.Kind == lex.WHEN {
+		p.nextToken()
+
+		var cond *ValueExpr
+		var err error
+		if operand != nil {
+			var value *ValueExpr
+			if value, err = p.parseExpression(); err != nil {
+				return nil, err
+			}
+			cond = &ValueExpr{Type: EXPR_COMPARISON, Left: operand, Right: value, Op: "="}
+		} else if cond, err = p.parseWhereExpression(); err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(lex.THEN); err != nil {
+			return nil, err
+		}
+		p.nextToken()
+
+		result, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		expr.Whens = append(expr.Whens, CaseWhen{When: cond, Then: result})
+	}
+
+	if len(expr.Whens) == 0 {
+		return nil, fmt.Errorf("expected WHEN in CASE, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+	}
+
+	if p.curToken.Kind == lex.ELSE {
+		p.nextToken()
+		elseExpr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		expr.Else = elseExpr
+	}
+
+	if !(p.curToken.Kind == lex.IDENT && strings.EqualFold(p.curToken.Value, "END")) {
+		return nil, fmt.Errorf("expected END to close CASE, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+	}
+	p.nextToken()
+
+	return expr, nil
+}
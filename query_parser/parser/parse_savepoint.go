@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"fmt"
+
+	lex "DaemonDB/query_parser/lexer"
+)
+
+/*
+Savepoints mark a point inside a transaction that it can be rolled back to
+without abandoning the whole transaction:
+
+	SAVEPOINT name
+	ROLLBACK TO [SAVEPOINT] name
+	RELEASE [SAVEPOINT] name
+
+ROLLBACK on its own still rolls back the whole transaction.
+*/
+
+func (p *Parser) parseSavepoint() (*SavepointStmt, error) {
+	p.nextToken()
+	name, err := p.savepointName()
+	if err != nil {
+		return nil, err
+	}
+	return &SavepointStmt{Name: name}, nil
+}
+
+// parseRollback parses ROLLBACK and ROLLBACK TO [SAVEPOINT] name.
+func (p *Parser) parseRollback() (Statement, error) {
+	p.nextToken()
+	if !p.isWord("TO") {
+		return &RollbackTxnStmt{}, nil
+	}
+	p.nextToken()
+	if p.isWord("SAVEPOINT") {
+		p.nextToken()
+	}
+	name, err := p.savepointName()
+	if err != nil {
+		return nil, err
+	}
+	return &RollbackToSavepointStmt{Name: name}, nil
+}
+
+func (p *Parser) parseReleaseSavepoint() (*ReleaseSavepointStmt, error) {
+	p.nextToken()
+	// RELEASE SAVEPOINT name, or RELEASE name where the name is "savepoint"
+	if p.isWord("SAVEPOINT") && p.peekToken.Kind == lex.IDENT {
+		p.nextToken()
+	}
+	name, err := p.savepointName()
+	if err != nil {
+		return nil, err
+	}
+	return &ReleaseSavepointStmt{Name: name}, nil
+}
+
+func (p *Parser) savepointName() (string, error) {
+	if err := p.expect(lex.IDENT); err != nil {
+		return "", fmt.Errorf("expected savepoint name: %w", err)
+	}
+	name := p.curToken.Value
+	p.nextToken()
+	return name, nil
+}
@@ -2,20 +2,214 @@ package parser
 
 import (
 	lex "DaemonDB/query_parser/lexer"
+	"fmt"
 	"strings"
 )
 
+// parseWith parses
+//
+//	WITH [RECURSIVE] name ['(' col {, col} ')'] AS '(' query ')' {, ...} query
+//
+// and returns the final query with the CTEs attached.
+func (p *Parser) parseWith() (*SelectStmt, error) {
+	p.nextToken()
+
+	// CTE names hide views of the same name until the end of the statement
+	scoped := []string{}
+	defer func() {
+		for _, name := range scoped {
+			p.ctes[name]--
+		}
+	}()
+	enter := func(name string) {
+		if p.ctes == nil {
+			p.ctes = make(map[string]int)
+		}
+		p.ctes[strings.ToLower(name)]++
+		scoped = append(scoped, strings.ToLower(name))
+	}
+
+	recursive := false
+	if p.curToken.Kind == lex.RECURSIVE {
+		recursive = true
+		p.nextToken()
+	}
+
+	ctes := []CommonTableExpr{}
+	for {
+		if err := p.expect(lex.IDENT); err != nil {
+			return nil, err
+		}
+		cte := CommonTableExpr{Name: p.curToken.Value, Recursive: recursive}
+		p.nextToken()
+
+		if p.curToken.Kind == lex.OPENROUNDED {
+			p.nextToken()
+			for {
+				if err := p.expect(lex.IDENT); err != nil {
+					return nil, err
+				}
+				cte.Columns = append(cte.Columns, p.curToken.Value)
+				p.nextToken()
+				if p.curToken.Kind != lex.COMMA {
+					break
+				}
+				p.nextToken()
+			}
+			if err := p.expect(lex.CLOSEDROUNDED); err != nil {
+				return nil, err
+			}
+			p.nextToken()
+		}
+
+		if err := p.expect(lex.AS); err != nil {
+			return nil, err
+		}
+		p.nextToken()
+		if err := p.expect(lex.OPENROUNDED); err != nil {
+			return nil, err
+		}
+		p.nextToken()
+		if recursive {
+			enter(cte.Name)
+		}
+		query, err := p.parseSubquerySelect()
+		if err != nil {
+			return nil, fmt.Errorf("WITH %s: %w", cte.Name, err)
+		}
+		cte.Query = query
+		if !recursive {
+			enter(cte.Name)
+		}
+
+		for _, other := range ctes {
+			if strings.EqualFold(other.Name, cte.Name) {
+				return nil, fmt.Errorf("WITH query name %q specified more than once", cte.Name)
+			}
+		}
+		ctes = append(ctes, cte)
+
+		if p.curToken.Kind != lex.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+
+	if err := p.expect(lex.SELECT); err != nil {
+		return nil, err
+	}
+	stmt, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	stmt.With = ctes
+	return stmt, nil
+}
+
+// parseQuery parses SELECT ... or WITH ... SELECT ...
+func (p *Parser) parseQuery() (*SelectStmt, error) {
+	if p.curToken.Kind == lex.WITH {
+		return p.parseWith()
+	}
+	if err := p.expect(lex.SELECT); err != nil {
+		return nil, err
+	}
+	return p.parseSelect()
+}
+
+// parseSelect parses a query: SELECT blocks combined by UNION, INTERSECT and
+// EXCEPT [ALL] (INTERSECT binds tighter, the others apply left to right),
+// then an optional ORDER BY that sorts the whole result.
 func (p *Parser) parseSelect() (*SelectStmt, error) {
+	stmt, err := p.parseIntersect()
+	if err != nil {
+		return nil, err
+	}
+	for p.curToken.Kind == lex.UNION || p.curToken.Kind == lex.EXCEPT {
+		op := p.curToken.Kind.String()
+		p.nextToken()
+		all := p.parseSetQuantifier()
+		right, err := p.parseIntersect()
+		if err != nil {
+			return nil, err
+		}
+		stmt = &SelectStmt{SetOp: &SetOperation{Op: op, All: all, Left: stmt, Right: right}}
+	}
+
+	orderBy, err := p.parseOrderBy()
+	if err != nil {
+		return nil, err
+	}
+	if orderBy != nil {
+		stmt.OrderBy = orderBy
+	}
+	return stmt, nil
+}
+
+// parseIntersect parses operands combined by INTERSECT [ALL].
+func (p *Parser) parseIntersect() (*SelectStmt, error) {
+	stmt, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.curToken.Kind == lex.INTERSECT {
+		p.nextToken()
+		all := p.parseSetQuantifier()
+		right, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		stmt = &SelectStmt{SetOp: &SetOperation{Op: "INTERSECT", All: all, Left: stmt, Right: right}}
+	}
+	return stmt, nil
+}
+
+// parseSetOperand parses one SELECT block, or a parenthesized query.
+func (p *Parser) parseSetOperand() (*SelectStmt, error) {
+	if p.curToken.Kind == lex.OPENROUNDED {
+		p.nextToken()
+		return p.parseSubquerySelect()
+	}
+	if err := p.expect(lex.SELECT); err != nil {
+		return nil, err
+	}
+	return p.parseSelectBlock()
+}
+
+// parseSetQuantifier consumes the ALL of UNION ALL etc.
+func (p *Parser) parseSetQuantifier() bool {
+	if p.curToken.Kind == lex.ALL {
+		p.nextToken()
+		return true
+	}
+	return false
+}
+
+// parseSelectBlock parses SELECT [DISTINCT] list FROM ... [WHERE ...], without ORDER BY.
+func (p *Parser) parseSelectBlock() (*SelectStmt, error) {
 	p.nextToken()
 
+	distinct := false
+	if p.curToken.Kind == lex.DISTINCT {
+		distinct = true
+		p.nextToken()
+	}
+
 	cols := []string{}
+	items := []SelectItem{}
 	if p.curToken.Kind == lex.ASTERISK {
 		cols = append(cols, "*")
 		p.nextToken()
 	} else {
-		for p.curToken.Kind == lex.IDENT {
-			cols = append(cols, p.curToken.Value)
-			p.nextToken()
+		for p.startsExpression() {
+			item, err := p.parseSelectItem()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if item.Expr.Type == EXPR_COLUMN {
+				cols = append(cols, item.Expr.ColumnName)
+			}
 			if p.curToken.Kind == lex.COMMA {
 				p.nextToken()
 			} else {
@@ -28,78 +222,250 @@ func (p *Parser) parseSelect() (*SelectStmt, error) {
 		return nil, err
 	}
 	p.nextToken()
-	table := p.curToken.Value
-	p.nextToken()
-
-	var joinTable, joinType, leftCol, rightCol string
-	isJoin := p.curToken.Kind == lex.JOIN ||
-		p.curToken.Kind == lex.INNER ||
-		p.curToken.Kind == lex.LEFT ||
-		p.curToken.Kind == lex.RIGHT ||
-		p.curToken.Kind == lex.FULL ||
-		p.curToken.Value == "JOIN" ||
-		p.curToken.Value == "INNER"
+	table, alias, fromSelect, err := p.parseFromItem()
+	if err != nil {
+		return nil, err
+	}
 
-	if isJoin {
-		var err error
-		joinTable, joinType, leftCol, rightCol, err = p.parseJoin()
+	joins := []JoinClause{}
+	for p.startsJoin() {
+		join, err := p.parseJoin()
 		if err != nil {
 			return nil, err
 		}
+		joins = append(joins, join)
 	}
 
-	var whereCol, whereVal string
+	var where *ValueExpr
 	if p.curToken.Kind == lex.WHERE {
 		p.nextToken()
-		whereCol = p.parseQualifiedIdentifier()
-		if err := p.expect(lex.EQUAL); err != nil {
+		var err error
+		where, err = p.parseWhereExpression()
+		if err != nil {
 			return nil, err
 		}
-		p.nextToken()
-		whereVal = p.curToken.Value
-		p.nextToken()
+		if where.Type == EXPR_LITERAL || where.Type == EXPR_COLUMN || where.Type == EXPR_BINARY {
+			return nil, fmt.Errorf("expected comparison in WHERE, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+		}
 	}
 
 	return &SelectStmt{
 		Columns:    cols,
+		Distinct:   distinct,
+		Items:      items,
 		Table:      table,
-		WhereCol:   whereCol,
-		WhereValue: whereVal,
-		JoinTable:  joinTable,
-		JoinType:   joinType,
-		LeftCol:    leftCol,
-		Rightcol:   rightCol,
+		Alias:      alias,
+		FromSelect: fromSelect,
+		Joins:      joins,
+		Where:      where,
 	}, nil
 }
 
-func (p *Parser) parseJoin() (joinTable, joinType, leftCol, rightCol string, err error) {
-	joinType = ""
-	if p.curToken.Kind == lex.INNER || p.curToken.Kind == lex.LEFT || p.curToken.Kind == lex.RIGHT || p.curToken.Kind == lex.FULL {
-		joinType = p.curToken.Value
+// parseSelectItem parses one select-list entry: expression [ [AS] alias ]
+func (p *Parser) parseSelectItem() (SelectItem, error) {
+	expr, err := p.parseWhereExpression()
+	if err != nil {
+		return SelectItem{}, err
+	}
+
+	item := SelectItem{Expr: expr}
+	if p.curToken.Kind == lex.AS {
+		p.nextToken()
+		if err := p.expect(lex.IDENT); err != nil {
+			return SelectItem{}, err
+		}
+	}
+	if p.curToken.Kind == lex.IDENT {
+		item.Alias = p.curToken.Value
 		p.nextToken()
 	}
+	return item, nil
+}
 
-	if err = p.expect(lex.JOIN); err != nil {
-		return "", "", "", "", err
+// parseOrderBy parses an optional ORDER BY expr [ASC|DESC] { , ... }
+func (p *Parser) parseOrderBy() ([]OrderByItem, error) {
+	if p.curToken.Kind != lex.ORDER {
+		return nil, nil
 	}
 	p.nextToken()
-
-	joinTable = strings.TrimSpace(p.curToken.Value)
+	if err := p.expect(lex.BY); err != nil {
+		return nil, err
+	}
 	p.nextToken()
 
-	if err = p.expect(lex.ON); err != nil {
-		return "", "", "", "", err
+	items := []OrderByItem{}
+	for {
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		item := OrderByItem{Expr: expr}
+		switch p.curToken.Kind {
+		case lex.ASC:
+			p.nextToken()
+		case lex.DESC:
+			item.Desc = true
+			p.nextToken()
+		}
+		items = append(items, item)
+
+		if p.curToken.Kind != lex.COMMA {
+			return items, nil
+		}
+		p.nextToken()
 	}
-	p.nextToken()
+}
+
+// parseFromItem parses  table [ [AS] alias ]  or  '(' select ')' [AS] alias.
+// The system tables are named sys.name, and known by name without an alias.
+func (p *Parser) parseFromItem() (table, alias string, sub *SelectStmt, err error) {
+	system := ""
+	if p.curToken.Kind == lex.OPENROUNDED {
+		p.nextToken()
+		if sub, err = p.parseSubquerySelect(); err != nil {
+			return "", "", nil, err
+		}
+	} else {
+		if err = p.expect(lex.IDENT); err != nil {
+			return "", "", nil, err
+		}
+		table = p.curToken.Value
+		p.nextToken()
+		if p.curToken.Kind == lex.DOT && p.peekToken.Kind == lex.IDENT {
+			p.nextToken()
+			system = p.curToken.Value
+			table += "." + system
+			p.nextToken()
+		}
+	}
+
+	if p.curToken.Kind == lex.AS {
+		p.nextToken()
+		if err = p.expect(lex.IDENT); err != nil {
+			return "", "", nil, err
+		}
+	}
+	if p.curToken.Kind == lex.IDENT {
+		alias = p.curToken.Value
+		p.nextToken()
+	}
+	if sub != nil && alias == "" {
+		return "", "", nil, fmt.Errorf("subquery in FROM must have an alias")
+	}
+	if system != "" {
+		if alias == "" {
+			alias = system
+		}
+		return table, alias, nil, nil
+	}
+
+	if table != "" {
+		if p.ctes[strings.ToLower(table)] == 0 {
+			p.refs = append(p.refs, table)
+		}
+		name := table
+		if sub, table, err = p.expandView(name); err != nil {
+			return "", "", nil, err
+		}
+		if table != name && alias == "" {
+			alias = name
+		}
+	}
+	return table, alias, sub, nil
+}
 
-	leftCol = p.parseQualifiedIdentifier()
-	if err = p.expect(lex.EQUAL); err != nil {
-		return "", "", "", "", err
+func (p *Parser) startsJoin() bool {
+	switch p.curToken.Kind {
+	case lex.JOIN, lex.INNER, lex.LEFT, lex.RIGHT, lex.FULL, lex.NATURAL, lex.CROSS, lex.COMMA:
+		return true
+	}
+	return false
+}
+
+// parseJoin parses
+//
+//	[NATURAL] [INNER | {LEFT|RIGHT|FULL} [OUTER]] JOIN from_item [ON where | USING '(' col {, col} ')']
+//	CROSS JOIN from_item
+//	, from_item                                   (same as CROSS JOIN)
+func (p *Parser) parseJoin() (JoinClause, error) {
+	if p.curToken.Kind == lex.COMMA || p.curToken.Kind == lex.CROSS {
+		join := JoinClause{Type: "CROSS"}
+		if p.curToken.Kind == lex.CROSS {
+			p.nextToken()
+			if err := p.expect(lex.JOIN); err != nil {
+				return JoinClause{}, err
+			}
+		}
+		p.nextToken()
+
+		var err error
+		if join.Table, join.Alias, join.Subquery, err = p.parseFromItem(); err != nil {
+			return JoinClause{}, err
+		}
+		return join, nil
+	}
+
+	join := JoinClause{Type: "INNER"}
+	if p.curToken.Kind == lex.NATURAL {
+		join.Natural = true
+		p.nextToken()
+	}
+
+	switch p.curToken.Kind {
+	case lex.INNER:
+		p.nextToken()
+	case lex.LEFT, lex.RIGHT, lex.FULL:
+		join.Type = strings.ToUpper(p.curToken.Value)
+		p.nextToken()
+		if p.curToken.Kind == lex.OUTER {
+			p.nextToken()
+		}
+	}
+
+	if err := p.expect(lex.JOIN); err != nil {
+		return JoinClause{}, err
 	}
 	p.nextToken()
-	rightCol = p.parseQualifiedIdentifier()
 
-	return joinTable, joinType, leftCol, rightCol, nil
+	var err error
+	if join.Table, join.Alias, join.Subquery, err = p.parseFromItem(); err != nil {
+		return JoinClause{}, err
+	}
+	if join.Natural {
+		return join, nil
+	}
+
+	switch p.curToken.Kind {
+	case lex.ON:
+		p.nextToken()
+		if join.On, err = p.parseWhereExpression(); err != nil {
+			return JoinClause{}, err
+		}
+	case lex.USING:
+		p.nextToken()
+		if err := p.expect(lex.OPENROUNDED); err != nil {
+			return JoinClause{}, err
+		}
+		p.nextToken()
+		for {
+			if err := p.expect(lex.IDENT); err != nil {
+				return JoinClause{}, err
+			}
+			join.Using = append(join.Using, p.curToken.Value)
+			p.nextToken()
+			if p.curToken.Kind != lex.COMMA {
+				break
+			}
+			p.nextToken()
+		}
+		if err := p.expect(lex.CLOSEDROUNDED); err != nil {
+			return JoinClause{}, err
+		}
+		p.nextToken()
+	default:
+		return JoinClause{}, fmt.Errorf("expected ON or USING after JOIN %s, got %s (%s)", join.Table, p.curToken.Kind, p.curToken.Value)
+	}
+	return join, nil
 }
 
 func (p *Parser) parseQualifiedIdentifier() string {
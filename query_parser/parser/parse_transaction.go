@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"fmt"
+
+	lex "DaemonDB/query_parser/lexer"
+)
+
+/*
+Isolation levels of a transaction:
+
+	BEGIN [TRANSACTION | WORK] [ISOLATION LEVEL level]
+	SET TRANSACTION ISOLATION LEVEL level
+	SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL level
+
+	level: SERIALIZABLE | REPEATABLE READ | READ COMMITTED | READ UNCOMMITTED
+
+The level is kept as its name; the executor decides what each one means
+(READ UNCOMMITTED runs as READ COMMITTED).
+*/
+
+func (p *Parser) parseBegin() (*BeginTxnStmt, error) {
+	p.nextToken()
+	if p.isWord("TRANSACTION") || p.isWord("WORK") {
+		p.nextToken()
+	}
+	stmt := &BeginTxnStmt{}
+	if p.isWord("ISOLATION") {
+		level, err := p.parseIsolationLevel()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Isolation = level
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseSetTransaction() (*SetTransactionStmt, error) {
+	p.nextToken()
+	stmt := &SetTransactionStmt{}
+	if p.isWord("SESSION") {
+		p.nextToken()
+		if !p.isWord("CHARACTERISTICS") {
+			return nil, fmt.Errorf("expected CHARACTERISTICS after SET SESSION, got %s", p.curToken.Value)
+		}
+		p.nextToken()
+		if err := p.expect(lex.AS); err != nil {
+			return nil, fmt.Errorf("expected AS after SET SESSION CHARACTERISTICS: %w", err)
+		}
+		p.nextToken()
+		stmt.Session = true
+	}
+	if !p.isWord("TRANSACTION") {
+		return nil, fmt.Errorf("expected TRANSACTION after SET, got %s", p.curToken.Value)
+	}
+	p.nextToken()
+	if !p.isWord("ISOLATION") {
+		return nil, fmt.Errorf("expected ISOLATION LEVEL, got %s", p.curToken.Value)
+	}
+	level, err := p.parseIsolationLevel()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Isolation = level
+	return stmt, nil
+}
+
+// parseIsolationLevel parses ISOLATION LEVEL level, from ISOLATION on.
+func (p *Parser) parseIsolationLevel() (string, error) {
+	p.nextToken()
+	if !p.isWord("LEVEL") {
+		return "", fmt.Errorf("expected LEVEL after ISOLATION, got %s", p.curToken.Value)
+	}
+	p.nextToken()
+
+	switch {
+	case p.isWord("SERIALIZABLE"):
+		p.nextToken()
+		return "SERIALIZABLE", nil
+	case p.isWord("REPEATABLE"):
+		p.nextToken()
+		if !p.isWord("READ") {
+			return "", fmt.Errorf("expected READ after REPEATABLE, got %s", p.curToken.Value)
+		}
+		p.nextToken()
+		return "REPEATABLE READ", nil
+	case p.isWord("READ"):
+		p.nextToken()
+		switch {
+		case p.isWord("COMMITTED"):
+			p.nextToken()
+			return "READ COMMITTED", nil
+		case p.isWord("UNCOMMITTED"):
+			p.nextToken()
+			return "READ UNCOMMITTED", nil
+		}
+		return "", fmt.Errorf("expected COMMITTED or UNCOMMITTED after READ, got %s", p.curToken.Value)
+	}
+	return "", fmt.Errorf("expected an isolation level, got %s", p.curToken.Value)
+}
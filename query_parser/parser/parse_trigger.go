@@ -0,0 +1,168 @@
+package parser
+
+import (
+	lex "DaemonDB/query_parser/lexer"
+	"DaemonDB/types"
+	"fmt"
+	"strings"
+)
+
+/*
+This file contains triggers
+
+CREATE TRIGGER keeps the SQL of each statement of the body. When the trigger
+fires, every statement is parsed again with SetTriggerRow, which turns the
+references NEW.col and OLD.col into literals holding the values of the row.
+*/
+
+// triggerRow holds the rows NEW and OLD refer to, by lower-case column; a nil
+// map is a row the trigger does not have (OLD on INSERT, NEW on DELETE).
+type triggerRow struct {
+	old, new map[string]interface{}
+}
+
+// SetTriggerRow makes NEW.col and OLD.col refer to the values of new and old.
+func (p *Parser) SetTriggerRow(old, new map[string]interface{}) {
+	p.row = &triggerRow{old: old, new: new}
+}
+
+// ref returns the literal a NEW.col or OLD.col reference stands for; ok is
+// false for any other name.
+func (r *triggerRow) ref(name string) (expr *ValueExpr, ok bool, err error) {
+	qualifier, column, found := strings.Cut(name, ".")
+	if !found {
+		return nil, false, nil
+	}
+	var row map[string]interface{}
+	switch strings.ToUpper(qualifier) {
+	case "NEW":
+		row = r.new
+	case "OLD":
+		row = r.old
+	default:
+		return nil, false, nil
+	}
+	if row == nil {
+		return nil, true, fmt.Errorf("%s is not available in this trigger", strings.ToUpper(qualifier))
+	}
+	val, exists := row[strings.ToLower(column)]
+	if !exists {
+		return nil, true, fmt.Errorf("%s has no column %s", strings.ToUpper(qualifier), column)
+	}
+	return &ValueExpr{Type: EXPR_LITERAL, Literal: val, DataType: types.TypeOfValue(val)}, true, nil
+}
+
+// parseCreateTrigger parses (after CREATE)
+//
+//	TRIGGER name {BEFORE|AFTER} {INSERT|UPDATE|DELETE} ON table FOR EACH ROW body
+//
+// where body is an INSERT, UPDATE or DELETE, or several of them separated by
+// ';' in BEGIN ... END.
+func (p *Parser) parseCreateTrigger() (*CreateTriggerStmt, error) {
+	p.nextToken()
+	if err := p.expect(lex.IDENT); err != nil {
+		return nil, fmt.Errorf("expected trigger name: %w", err)
+	}
+	stmt := &CreateTriggerStmt{Name: p.curToken.Value}
+	p.nextToken()
+
+	switch {
+	case p.isWord("BEFORE"):
+		stmt.Timing = "BEFORE"
+	case p.isWord("AFTER"):
+		stmt.Timing = "AFTER"
+	default:
+		return nil, fmt.Errorf("expected BEFORE or AFTER, got %s", p.curToken.Value)
+	}
+	p.nextToken()
+
+	switch p.curToken.Kind {
+	case lex.INSERT:
+		stmt.Event = "INSERT"
+	case lex.UPDATE:
+		stmt.Event = "UPDATE"
+	case lex.DELETE:
+		stmt.Event = "DELETE"
+	default:
+		return nil, fmt.Errorf("expected INSERT, UPDATE or DELETE, got %s", p.curToken.Value)
+	}
+	p.nextToken()
+
+	if err := p.expect(lex.ON); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+	if err := p.expect(lex.IDENT); err != nil {
+		return nil, fmt.Errorf("expected table name: %w", err)
+	}
+	stmt.Table = p.curToken.Value
+	p.nextToken()
+
+	for _, word := range []string{"FOR", "EACH", "ROW"} {
+		if !p.isWord(word) {
+			return nil, fmt.Errorf("expected FOR EACH ROW (only row-level triggers are supported), got %s", p.curToken.Value)
+		}
+		p.nextToken()
+	}
+
+	if p.curToken.Kind == lex.BEGIN {
+		p.nextToken()
+		for !p.isWord("END") {
+			sql, err := p.parseTriggerStatement()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Body = append(stmt.Body, sql)
+			if p.curToken.Kind == lex.SEMICOLON {
+				p.nextToken()
+			} else if !p.isWord("END") {
+				return nil, fmt.Errorf("expected ; or END after a statement of trigger %s, got %s", stmt.Name, p.curToken.Value)
+			}
+		}
+		if len(stmt.Body) == 0 {
+			return nil, fmt.Errorf("trigger %s has an empty body", stmt.Name)
+		}
+		p.nextToken()
+	} else {
+		sql, err := p.parseTriggerStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Body = []string{sql}
+		if p.curToken.Kind == lex.SEMICOLON {
+			p.nextToken()
+		}
+	}
+
+	if p.curToken.Kind != lex.END {
+		return nil, fmt.Errorf("unexpected %s (%s) after the body of trigger %s", p.curToken.Kind, p.curToken.Value, stmt.Name)
+	}
+	return stmt, nil
+}
+
+// parseTriggerStatement parses one statement of a trigger body and returns its SQL.
+func (p *Parser) parseTriggerStatement() (string, error) {
+	switch p.curToken.Kind {
+	case lex.INSERT, lex.UPDATE, lex.DELETE:
+	default:
+		return "", fmt.Errorf("a trigger body may only contain INSERT, UPDATE and DELETE, got %s", p.curToken.Value)
+	}
+	start := p.curToken.Pos
+	if _, err := p.ParseStatement(); err != nil {
+		return "", err
+	}
+	input := p.l.Input()
+	end := min(p.curToken.Pos, len(input))
+	return strings.TrimSpace(input[start:end]), nil
+}
+
+// parseDropTrigger parses (after DROP)  TRIGGER name
+func (p *Parser) parseDropTrigger() (*DropTriggerStmt, error) {
+	p.nextToken()
+	if err := p.expect(lex.IDENT); err != nil {
+		return nil, fmt.Errorf("expected trigger name: %w", err)
+	}
+	stmt := &DropTriggerStmt{Name: p.curToken.Value}
+	p.nextToken()
+	return stmt, nil
+}
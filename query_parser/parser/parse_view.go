@@ -0,0 +1,180 @@
+package parser
+
+import (
+	lex "DaemonDB/query_parser/lexer"
+	"DaemonDB/types"
+	"fmt"
+	"strings"
+)
+
+/*
+This file contains views
+
+A view is expanded at parse time: a FROM item naming it becomes a derived table
+running the view's query, parsed again from the SQL kept in the catalog (so a
+view always sees the current definition of the views it reads). A materialized
+view becomes its backing table. Both keep the view name as the item's alias.
+*/
+
+// maxViewDepth bounds how deeply views may be nested in one another.
+const maxViewDepth = 32
+
+// ViewLookup returns the view called name, if there is one.
+type ViewLookup func(name string) (types.ViewDef, bool)
+
+// SetViews makes the parser expand the views views returns.
+func (p *Parser) SetViews(views ViewLookup) {
+	p.views = views
+}
+
+// expandView returns what a FROM item naming name reads: the query of a view
+// (as a derived table, table empty), the backing table of a materialized view,
+// or name itself.
+func (p *Parser) expandView(name string) (sub *SelectStmt, table string, err error) {
+	if p.views == nil || p.ctes[strings.ToLower(name)] > 0 {
+		return nil, name, nil
+	}
+	view, ok := p.views(name)
+	if !ok {
+		return nil, name, nil
+	}
+	if view.Materialized {
+		return nil, view.Table, nil
+	}
+	if p.depth >= maxViewDepth {
+		return nil, "", fmt.Errorf("view %s: views nested more than %d deep", name, maxViewDepth)
+	}
+
+	inner := New(lex.New(view.Query))
+	inner.views, inner.depth = p.views, p.depth+1
+	query, err := inner.parseQuery()
+	if err != nil {
+		return nil, "", fmt.Errorf("view %s: %w", name, err)
+	}
+
+	// the column list renames the query's columns, as that of a CTE
+	if len(view.ColumnNames) > 0 {
+		query = &SelectStmt{
+			Columns: []string{"*"},
+			Items:   []SelectItem{},
+			Table:   name,
+			With:    []CommonTableExpr{{Name: name, Columns: view.ColumnNames, Query: query}},
+		}
+	}
+	return query, "", nil
+}
+
+// parseCreateView parses (after CREATE)
+//
+//	[OR REPLACE] [MATERIALIZED] VIEW name [(col, ...)] AS query
+func (p *Parser) parseCreateView() (*CreateViewStmt, error) {
+	stmt := &CreateViewStmt{}
+	if p.curToken.Kind == lex.OR {
+		p.nextToken()
+		if !p.isWord("REPLACE") {
+			return nil, fmt.Errorf("expected REPLACE after CREATE OR, got %s", p.curToken.Value)
+		}
+		stmt.OrReplace = true
+		p.nextToken()
+	}
+	if p.isWord("MATERIALIZED") {
+		if stmt.OrReplace {
+			return nil, fmt.Errorf("CREATE OR REPLACE is not supported for materialized views")
+		}
+		stmt.Materialized = true
+		p.nextToken()
+	}
+	if !p.isWord("VIEW") {
+		return nil, fmt.Errorf("expected VIEW, got %s", p.curToken.Value)
+	}
+	p.nextToken()
+
+	if err := p.expect(lex.IDENT); err != nil {
+		return nil, fmt.Errorf("expected view name: %w", err)
+	}
+	stmt.Name = p.curToken.Value
+	p.nextToken()
+
+	if p.curToken.Kind == lex.OPENROUNDED {
+		p.nextToken()
+		for {
+			if err := p.expect(lex.IDENT); err != nil {
+				return nil, err
+			}
+			stmt.Columns = append(stmt.Columns, p.curToken.Value)
+			p.nextToken()
+			if p.curToken.Kind != lex.COMMA {
+				break
+			}
+			p.nextToken()
+		}
+		if err := p.expect(lex.CLOSEDROUNDED); err != nil {
+			return nil, err
+		}
+		p.nextToken()
+	}
+
+	if err := p.expect(lex.AS); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+
+	// the rest of the statement is the query, kept as written
+	start := p.curToken.Pos
+	p.refs = nil
+	query, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	if p.curToken.Kind != lex.END {
+		return nil, fmt.Errorf("unexpected %s (%s) after the query of view %s", p.curToken.Kind, p.curToken.Value, stmt.Name)
+	}
+	stmt.Query = query
+	stmt.SQL = strings.TrimSpace(p.l.Input()[start:])
+	stmt.References = p.refs
+	return stmt, nil
+}
+
+// parseDropView parses (after DROP)  [MATERIALIZED] VIEW name
+func (p *Parser) parseDropView() (*DropViewStmt, error) {
+	stmt := &DropViewStmt{}
+	if p.isWord("MATERIALIZED") {
+		stmt.Materialized = true
+		p.nextToken()
+	}
+	if !p.isWord("VIEW") {
+		return nil, fmt.Errorf("expected VIEW, got %s", p.curToken.Value)
+	}
+	p.nextToken()
+	if err := p.expect(lex.IDENT); err != nil {
+		return nil, fmt.Errorf("expected view name: %w", err)
+	}
+	stmt.Name = p.curToken.Value
+	p.nextToken()
+	return stmt, nil
+}
+
+// parseRefreshView parses  REFRESH MATERIALIZED VIEW [CONCURRENTLY] name
+func (p *Parser) parseRefreshView() (*RefreshViewStmt, error) {
+	p.nextToken()
+	if !p.isWord("MATERIALIZED") {
+		return nil, fmt.Errorf("expected MATERIALIZED after REFRESH, got %s", p.curToken.Value)
+	}
+	p.nextToken()
+	if !p.isWord("VIEW") {
+		return nil, fmt.Errorf("expected VIEW, got %s", p.curToken.Value)
+	}
+	p.nextToken()
+
+	stmt := &RefreshViewStmt{}
+	if p.isWord("CONCURRENTLY") && p.peekToken.Kind == lex.IDENT {
+		stmt.Concurrently = true
+		p.nextToken()
+	}
+	if err := p.expect(lex.IDENT); err != nil {
+		return nil, fmt.Errorf("expected view name: %w", err)
+	}
+	stmt.Name = p.curToken.Value
+	p.nextToken()
+	return stmt, nil
+}
@@ -4,12 +4,20 @@ import (
 	lex "DaemonDB/query_parser/lexer"
 	"errors"
 	"fmt"
+	"strings"
 )
 
 type Parser struct {
 	l         *lex.Lexer
 	curToken  lex.Token
 	peekToken lex.Token
+
+	views ViewLookup     // nil: views are not expanded
+	depth int            // views being expanded around this parser
+	ctes  map[string]int // CTE names in scope (lower-case), which hide views
+	refs  []string       // table and view names of the FROM items parsed
+
+	row *triggerRow // NEW / OLD of the trigger whose body is parsed, nil outside one
 }
 
 func New(l *lex.Lexer) *Parser {
@@ -32,26 +40,35 @@ func (p *Parser) expect(kind lex.TokenKind) error {
 	return nil
 }
 
+// isWord reports whether the current token is the identifier word, for the
+// words that are keywords only in one place (PARTITION, ROWS, PRECEDING ...).
+func (p *Parser) isWord(word string) bool {
+	return p.curToken.Kind == lex.IDENT && strings.EqualFold(p.curToken.Value, word)
+}
+
 // ParseStatement is the entry point; returns (nil, error) on parse error instead of panicking.
 func (p *Parser) ParseStatement() (Statement, error) {
 	switch p.curToken.Kind {
 
 	case lex.BEGIN:
-		p.nextToken()
-		return &BeginTxnStmt{}, nil
+		return p.parseBegin()
+
+	case lex.SET:
+		return p.parseSetTransaction()
 
 	case lex.COMMIT:
 		p.nextToken()
 		return &CommitTxnStmt{}, nil
 
 	case lex.ROLLBACK:
-		p.nextToken()
-		return &RollbackTxnStmt{}, nil
+		return p.parseRollback()
 
 	case lex.SHOW:
 		return p.parseShowDatabases()
 	case lex.SELECT:
 		return p.parseSelect()
+	case lex.WITH:
+		return p.parseWith()
 	case lex.INSERT:
 		return p.parseInsert()
 	case lex.UPDATE:
@@ -60,6 +77,10 @@ func (p *Parser) ParseStatement() (Statement, error) {
 		return p.parseTruncate()
 	case lex.DELETE:
 		return p.parseDelete()
+	case lex.ANALYZE:
+		return p.parseAnalyze()
+	case lex.EXPLAIN:
+		return p.parseExplain()
 
 	case lex.USE:
 		return p.parseUseDatabase()
@@ -74,6 +95,21 @@ func (p *Parser) ParseStatement() (Statement, error) {
 			case "table", "TABLE":
 				return p.parseCreateTable()
 			}
+			if p.curToken.Kind == lex.OR || p.isWord("MATERIALIZED") || p.isWord("VIEW") {
+				return p.parseCreateView()
+			}
+			if p.isWord("TRIGGER") {
+				return p.parseCreateTrigger()
+			}
+		}
+		if p.isWord("REFRESH") {
+			return p.parseRefreshView()
+		}
+		if p.isWord("SAVEPOINT") {
+			return p.parseSavepoint()
+		}
+		if p.isWord("RELEASE") {
+			return p.parseReleaseSavepoint()
 		}
 	}
 
@@ -113,3 +149,60 @@ func (p *Parser) parseTruncate() (Statement, error) {
 		Table: table,
 	}, nil
 }
+
+// parseAnalyze parses ANALYZE [table]; without a table every table is analyzed.
+func (p *Parser) parseAnalyze() (Statement, error) {
+
+	// move past ANALYZE
+	p.nextToken()
+
+	switch p.curToken.Kind {
+	case lex.END:
+		return &AnalyzeStatement{}, nil
+	case lex.IDENT:
+		table := p.curToken.Value
+		p.nextToken()
+		return &AnalyzeStatement{Table: table}, nil
+	}
+	return nil, fmt.Errorf("expected table name after ANALYZE, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+}
+
+// parseExplain parses EXPLAIN [ANALYZE] [FORMAT TEXT|JSON] SELECT ...
+func (p *Parser) parseExplain() (Statement, error) {
+
+	// move past EXPLAIN
+	p.nextToken()
+
+	stmt := &ExplainStatement{Format: "text"}
+	if p.curToken.Kind == lex.ANALYZE {
+		stmt.Analyze = true
+		p.nextToken()
+	}
+
+	// FORMAT is not a keyword, so it stays usable as a column name
+	if p.curToken.Kind == lex.IDENT && strings.EqualFold(p.curToken.Value, "FORMAT") {
+		p.nextToken()
+		format := strings.ToLower(p.curToken.Value)
+		if p.curToken.Kind != lex.IDENT || (format != "text" && format != "json") {
+			return nil, fmt.Errorf("expected TEXT or JSON after FORMAT, got %s (%s)", p.curToken.Kind, p.curToken.Value)
+		}
+		stmt.Format = format
+		p.nextToken()
+	}
+
+	var sel *SelectStmt
+	var err error
+	switch p.curToken.Kind {
+	case lex.SELECT:
+		sel, err = p.parseSelect()
+	case lex.WITH:
+		sel, err = p.parseWith()
+	default:
+		return nil, fmt.Errorf("EXPLAIN supports only SELECT, got %s", p.curToken.Value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	stmt.Select = sel
+	return stmt, nil
+}
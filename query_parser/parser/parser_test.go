@@ -2,6 +2,8 @@ package parser
 
 import (
 	lex "DaemonDB/query_parser/lexer"
+	"DaemonDB/types"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -18,7 +20,76 @@ func TestParseStatement_InvalidSQL_ReturnsError(t *testing.T) {
 		{"INSERT missing parens", "INSERT INTO students VALUES \"S001\", \"Alice\""},
 		{"CREATE TABLE missing paren", "CREATE TABLE students id int"},
 		{"WHERE without value", "SELECT * FROM students WHERE id"},
+		{"CAST missing AS", "SELECT * FROM students WHERE CAST(id int) = 1"},
+		{"CAST unknown type", "SELECT * FROM students WHERE id::money = 1"},
+		{"INSERT unterminated expression", "INSERT INTO students VALUES (1 +)"},
+		{"CASE without END", "SELECT CASE WHEN id = 1 THEN 'a' FROM students"},
+		{"CASE without WHEN", "SELECT CASE ELSE 1 END FROM students"},
+		{"ORDER without BY", "SELECT * FROM students ORDER id"},
+		{"function missing paren", "SELECT UPPER(name FROM students"},
+		{"IN without list", "SELECT * FROM students WHERE id IN 1, 2"},
+		{"BETWEEN without AND", "SELECT * FROM students WHERE age BETWEEN 1 OR 2"},
+		{"dangling NOT", "SELECT * FROM students WHERE age NOT 5"},
+		{"unclosed subquery", "SELECT * FROM students WHERE id IN (SELECT id FROM grads"},
+		{"derived table without alias", "SELECT * FROM (SELECT id FROM students)"},
+		{"EXISTS without subquery", "SELECT * FROM students WHERE EXISTS (1)"},
+		{"JOIN without condition", "SELECT * FROM a JOIN b WHERE a.id = 1"},
+		{"USING without parens", "SELECT * FROM a JOIN b USING id"},
+		{"OUTER without JOIN", "SELECT * FROM a LEFT OUTER b ON a.id = b.id"},
+		{"CROSS without JOIN", "SELECT * FROM a CROSS b"},
+		{"trailing comma in FROM", "SELECT * FROM a, WHERE a.id = 1"},
+		{"ANALYZE with number", "ANALYZE 123"},
+		{"ANALYZE TABLE keyword", "ANALYZE TABLE students"},
+		{"EXPLAIN without query", "EXPLAIN"},
+		{"EXPLAIN of DELETE", "EXPLAIN DELETE FROM students"},
+		{"EXPLAIN unknown format", "EXPLAIN FORMAT XML SELECT * FROM students"},
+		{"UNION without right query", "SELECT id FROM a UNION"},
+		{"UNION of non-query", "SELECT id FROM a UNION DELETE FROM b"},
+		{"EXCEPT with unclosed paren", "SELECT id FROM a EXCEPT (SELECT id FROM b"},
+		{"WITH without query", "WITH x AS (SELECT id FROM a)"},
+		{"WITH without AS", "WITH x (SELECT id FROM a) SELECT * FROM x"},
+		{"WITH duplicate name", "WITH x AS (SELECT id FROM a), x AS (SELECT id FROM b) SELECT * FROM x"},
+		{"WITH empty column list", "WITH x () AS (SELECT id FROM a) SELECT * FROM x"},
+		{"OVER without parens", "SELECT RANK() OVER ORDER BY id FROM a"},
+		{"PARTITION without BY", "SELECT RANK() OVER (PARTITION id) FROM a"},
+		{"frame without bound", "SELECT SUM(x) OVER (ORDER BY id ROWS) FROM a"},
+		{"frame ends before start", "SELECT SUM(x) OVER (ORDER BY id ROWS BETWEEN CURRENT ROW AND 1 PRECEDING) FROM a"},
+		{"frame starts at unbounded following", "SELECT SUM(x) OVER (ROWS UNBOUNDED FOLLOWING) FROM a"},
+		{"fractional ROWS offset", "SELECT SUM(x) OVER (ROWS 1.5 PRECEDING) FROM a"},
+		{"RANGE offset without ORDER BY", "SELECT SUM(x) OVER (RANGE BETWEEN 1 PRECEDING AND CURRENT ROW) FROM a"},
+		{"CURRENT without ROW", "SELECT SUM(x) OVER (ROWS BETWEEN CURRENT AND UNBOUNDED FOLLOWING) FROM a"},
+		{"ON without CONFLICT", "INSERT INTO a VALUES (1) ON DO NOTHING"},
+		{"ON CONFLICT without DO", "INSERT INTO a VALUES (1) ON CONFLICT (id) NOTHING"},
+		{"UPDATE FROM without table", "UPDATE a SET x = 1 FROM WHERE a.id = 1"},
+		{"DELETE USING without table", "DELETE FROM a USING WHERE a.id = 1"},
+		{"DELETE with unterminated WHERE", "DELETE FROM a WHERE id > 1 AND"},
+		{"UPDATE alias AS without name", "UPDATE a AS SET x = 1"},
+		{"DO without action", "INSERT INTO a VALUES (1) ON CONFLICT (id) DO"},
+		{"DO UPDATE without target", "INSERT INTO a VALUES (1) ON CONFLICT DO UPDATE SET x = 1"},
+		{"DO UPDATE without SET", "INSERT INTO a VALUES (1) ON CONFLICT (id) DO UPDATE x = 1"},
+		{"RETURNING without list", "INSERT INTO a VALUES (1) RETURNING"},
+		{"RETURNING trailing comma", "UPDATE a SET x = 1 RETURNING x,"},
 		{"empty", ""},
+		{"CREATE VIEW missing AS", "CREATE VIEW v SELECT * FROM t"},
+		{"CREATE OR REPLACE MATERIALIZED VIEW", "CREATE OR REPLACE MATERIALIZED VIEW v AS SELECT * FROM t"},
+		{"REFRESH plain VIEW", "REFRESH VIEW v"},
+		{"DROP VIEW missing name", "DROP VIEW"},
+		{"GENERATED without ALWAYS", "CREATE TABLE t (a INT, b INT GENERATED AS (a + 1))"},
+		{"GENERATED without parens", "CREATE TABLE t (a INT, b INT GENERATED ALWAYS AS a + 1)"},
+		{"GENERATED twice", "CREATE TABLE t (a INT, b INT GENERATED ALWAYS AS (a) GENERATED ALWAYS AS (a))"},
+		{"CREATE TRIGGER missing timing", "CREATE TRIGGER tr INSERT ON t FOR EACH ROW DELETE FROM u"},
+		{"CREATE TRIGGER statement level", "CREATE TRIGGER tr AFTER INSERT ON t FOR EACH STATEMENT DELETE FROM u"},
+		{"CREATE TRIGGER SELECT body", "CREATE TRIGGER tr AFTER INSERT ON t FOR EACH ROW SELECT * FROM u"},
+		{"SAVEPOINT without name", "SAVEPOINT"},
+		{"ROLLBACK TO without name", "ROLLBACK TO SAVEPOINT"},
+		{"RELEASE without name", "RELEASE"},
+		{"BEGIN ISOLATION without LEVEL", "BEGIN ISOLATION SERIALIZABLE"},
+		{"BEGIN unknown isolation level", "BEGIN ISOLATION LEVEL SNAPSHOT"},
+		{"REPEATABLE without READ", "SET TRANSACTION ISOLATION LEVEL REPEATABLE"},
+		{"SET without TRANSACTION", "SET ISOLATION LEVEL SERIALIZABLE"},
+		{"SET SESSION without AS", "SET SESSION CHARACTERISTICS TRANSACTION ISOLATION LEVEL SERIALIZABLE"},
+		{"CREATE TRIGGER empty body", "CREATE TRIGGER tr AFTER INSERT ON t FOR EACH ROW BEGIN END"},
+		{"CREATE TRIGGER unterminated body", "CREATE TRIGGER tr AFTER INSERT ON t FOR EACH ROW BEGIN DELETE FROM u"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -46,6 +117,36 @@ func TestParseStatement_ValidSQL_NoPanic(t *testing.T) {
 		{"SELECT * FROM students"},
 		{"SELECT * FROM students WHERE id = \"S001\""},
 		{"INSERT INTO students VALUES (\"S001\", \"Alice\", 20)"},
+		{"INSERT INTO students VALUES ('S001', -3.5, CAST('20' AS int))"},
+		{"SELECT * FROM students WHERE age::varchar = '20'"},
+		{"SELECT * FROM students WHERE age * 2 >= 40.5"},
+		{"UPDATE students SET age = CAST(name AS integer) WHERE id = 'S001'"},
+		{"SELECT id, UPPER(name) AS n, COALESCE(NULL, age, 0) FROM students ORDER BY n DESC, id"},
+		{"SELECT CASE WHEN age >= 18 THEN 'adult' ELSE 'minor' END AS bracket FROM students"},
+		{"SELECT * FROM students WHERE LENGTH(TRIM(name)) > 3 ORDER BY ROUND(gpa, 1) ASC"},
+		{"UPDATE students SET name = CONCAT(UPPER(SUBSTR(name, 1, 1)), LOWER(SUBSTR(name, 2)))"},
+		{"SELECT * FROM students WHERE name LIKE 'Al%' AND id NOT IN (1, 5, 9)"},
+		{"SELECT * FROM students WHERE name NOT ILIKE 'a!_%' ESCAPE '!' OR age NOT BETWEEN 18 AND 21"},
+		{"SELECT name, (SELECT age FROM ages WHERE ages.id = students.id) AS age FROM students"},
+		{"SELECT * FROM (SELECT id, age * 2 AS a FROM students) AS s WHERE s.a > 10 ORDER BY a"},
+		{"SELECT e.name, m.name FROM employees e LEFT OUTER JOIN employees m ON e.manager_id = m.id"},
+		{"SELECT * FROM a NATURAL JOIN b JOIN c USING (x, y) FULL JOIN d AS dd ON c.z = dd.z"},
+		{"SELECT e.id, w.id FROM events e JOIN windows w ON e.ts BETWEEN w.start AND w.finish"},
+		{"SELECT * FROM a CROSS JOIN b, c AS cc WHERE a.x < cc.y"},
+		{"UPDATE students SET age = 0 WHERE NOT (age > 1 AND age < 5)"},
+		{"ANALYZE"},
+		{"ANALYZE students"},
+		{"EXPLAIN SELECT * FROM students"},
+		{"EXPLAIN ANALYZE FORMAT JSON SELECT * FROM students WHERE id = 1"},
+		{"SELECT DISTINCT name, age FROM students ORDER BY name"},
+		{"SELECT id FROM a UNION ALL SELECT id FROM b INTERSECT SELECT id FROM c ORDER BY id DESC"},
+		{"SELECT * FROM students WHERE id IN (SELECT id FROM a EXCEPT ALL SELECT id FROM b)"},
+		{"WITH s AS (SELECT id FROM students) SELECT * FROM s"},
+		{"EXPLAIN WITH RECURSIVE t (n) AS (SELECT id FROM a UNION ALL SELECT n + 1 FROM t WHERE n < 5) SELECT n FROM t"},
+		{"SELECT * FROM students WHERE id IN (WITH s AS (SELECT id FROM a) SELECT id FROM s)"},
+		{"SELECT name, ROW_NUMBER() OVER (PARTITION BY major ORDER BY age DESC) AS rn FROM students ORDER BY rn"},
+		{"SELECT COUNT(*) OVER (), SUM(age) OVER (ORDER BY id RANGE BETWEEN 5 PRECEDING AND 5 FOLLOWING) FROM students"},
+		{"INSERT INTO students VALUES (1, 'Alice', 20) ON CONFLICT (id) DO UPDATE SET age = EXCLUDED.age WHERE students.age < EXCLUDED.age"},
 		{"BEGIN"},
 		{"COMMIT"},
 		{"ROLLBACK"},
@@ -62,3 +163,695 @@ func TestParseStatement_ValidSQL_NoPanic(t *testing.T) {
 		}
 	}
 }
+
+// TestParseStatement_CastSyntax ensures CAST(x AS t) and x::t produce the same cast node.
+func TestParseStatement_CastSyntax(t *testing.T) {
+	tests := []struct {
+		sql      string
+		dataType string
+	}{
+		{"SELECT * FROM students WHERE CAST(age AS varchar) = '20'", "VARCHAR"},
+		{"SELECT * FROM students WHERE age::text = '20'", "VARCHAR"},
+		{"SELECT * FROM students WHERE CAST(gpa AS integer) = 3", "INT"},
+	}
+	for _, tt := range tests {
+		l := lex.New(tt.sql)
+		p := New(l)
+		stmt, err := p.ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		sel := stmt.(*SelectStmt)
+		cast := sel.Where.Left
+		if cast.Type != EXPR_CAST || cast.DataType != tt.dataType {
+			t.Errorf("ParseStatement(%q) expected cast to %s, got %#v", tt.sql, tt.dataType, cast)
+		}
+	}
+}
+
+// TestParseStatement_FunctionsAndCase checks the shape of function calls, CASE and ORDER BY.
+func TestParseStatement_FunctionsAndCase(t *testing.T) {
+	sql := "SELECT upper(name) AS n, CASE age WHEN 1 THEN 'one' ELSE 'many' END FROM students ORDER BY n DESC, age"
+	stmt, err := New(lex.New(sql)).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement(%q) unexpected error: %v", sql, err)
+	}
+	sel := stmt.(*SelectStmt)
+
+	if len(sel.Items) != 2 {
+		t.Fatalf("expected 2 select items, got %d", len(sel.Items))
+	}
+	fn := sel.Items[0]
+	if fn.Expr.Type != EXPR_FUNC || fn.Expr.FuncName != "UPPER" || len(fn.Expr.Args) != 1 || fn.Alias != "n" {
+		t.Errorf("unexpected function item %#v", fn)
+	}
+	cs := sel.Items[1].Expr
+	if cs.Type != EXPR_CASE || len(cs.Whens) != 1 || cs.Else == nil || cs.Whens[0].When.Op != "=" {
+		t.Errorf("simple CASE should become a searched CASE with one = branch, got %#v", cs)
+	}
+
+	if len(sel.OrderBy) != 2 || !sel.OrderBy[0].Desc || sel.OrderBy[1].Desc {
+		t.Errorf("unexpected ORDER BY %#v", sel.OrderBy)
+	}
+}
+
+// TestParseStatement_Predicates checks precedence of AND/OR and the shape of LIKE, IN and BETWEEN.
+func TestParseStatement_Predicates(t *testing.T) {
+	sql := "SELECT * FROM t WHERE a LIKE 'x%' ESCAPE '!' OR b NOT IN (1, 2) AND c BETWEEN 1 AND 3"
+	stmt, err := New(lex.New(sql)).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement(%q) unexpected error: %v", sql, err)
+	}
+	where := stmt.(*SelectStmt).Where
+
+	// OR binds looser than AND: like OR (in AND between)
+	if where.Type != EXPR_LOGICAL || where.Op != "OR" {
+		t.Fatalf("expected OR at the root, got %#v", where)
+	}
+	like := where.Left
+	if like.Type != EXPR_LIKE || like.Op != "LIKE" || like.Escape == nil || like.Negate {
+		t.Errorf("unexpected LIKE node %#v", like)
+	}
+	and := where.Right
+	if and.Type != EXPR_LOGICAL || and.Op != "AND" {
+		t.Fatalf("expected AND on the right, got %#v", and)
+	}
+	if in := and.Left; in.Type != EXPR_IN || !in.Negate || len(in.Args) != 2 {
+		t.Errorf("unexpected IN node %#v", in)
+	}
+	if between := and.Right; between.Type != EXPR_BETWEEN || len(between.Args) != 2 {
+		t.Errorf("unexpected BETWEEN node %#v", between)
+	}
+}
+
+// TestParseStatement_Subqueries checks IN (SELECT ...), NOT EXISTS and derived tables.
+func TestParseStatement_Subqueries(t *testing.T) {
+	sql := "SELECT * FROM (SELECT id FROM orders) o WHERE id NOT IN (SELECT oid FROM refunds) AND NOT EXISTS (SELECT 1 FROM bans WHERE bans.id = o.id)"
+	stmt, err := New(lex.New(sql)).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement(%q) unexpected error: %v", sql, err)
+	}
+	sel := stmt.(*SelectStmt)
+
+	if sel.Table != "" || sel.Alias != "o" || sel.FromSelect == nil || sel.FromSelect.Table != "orders" {
+		t.Errorf("unexpected derived table: Table=%q Alias=%q FromSelect=%#v", sel.Table, sel.Alias, sel.FromSelect)
+	}
+
+	where := sel.Where
+	if where.Type != EXPR_LOGICAL || where.Op != "AND" {
+		t.Fatalf("expected AND at the root, got %#v", where)
+	}
+	if in := where.Left; in.Type != EXPR_IN || !in.Negate || in.Subquery == nil || len(in.Args) != 0 {
+		t.Errorf("unexpected IN node %#v", in)
+	}
+	// NOT EXISTS is folded into the EXISTS node instead of wrapping it in NOT
+	exists := where.Right
+	if exists.Type != EXPR_EXISTS || !exists.Negate || exists.Subquery == nil || exists.Subquery.Table != "bans" {
+		t.Errorf("unexpected EXISTS node %#v", exists)
+	}
+}
+
+// TestParseStatement_Joins checks aliases, join types and the ON / USING / NATURAL forms.
+func TestParseStatement_Joins(t *testing.T) {
+	sql := "SELECT * FROM employees AS e JOIN employees m ON e.manager_id = m.id " +
+		"LEFT OUTER JOIN depts USING (dept_id, site) NATURAL RIGHT JOIN (SELECT id FROM x) AS sub"
+	stmt, err := New(lex.New(sql)).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement(%q) unexpected error: %v", sql, err)
+	}
+	sel := stmt.(*SelectStmt)
+
+	if sel.Table != "employees" || sel.Alias != "e" {
+		t.Errorf("unexpected FROM item: Table=%q Alias=%q", sel.Table, sel.Alias)
+	}
+	if len(sel.Joins) != 3 {
+		t.Fatalf("expected 3 joins, got %d", len(sel.Joins))
+	}
+
+	self := sel.Joins[0]
+	if self.Type != "INNER" || self.Table != "employees" || self.Alias != "m" || self.On == nil || self.On.Type != EXPR_COMPARISON {
+		t.Errorf("unexpected self join %#v", self)
+	}
+	using := sel.Joins[1]
+	if using.Type != "LEFT" || using.Table != "depts" || len(using.Using) != 2 || using.Using[1] != "site" {
+		t.Errorf("unexpected USING join %#v", using)
+	}
+	natural := sel.Joins[2]
+	if !natural.Natural || natural.Type != "RIGHT" || natural.Subquery == nil || natural.Alias != "sub" || natural.On != nil {
+		t.Errorf("unexpected NATURAL join %#v", natural)
+	}
+}
+
+// TestParseStatement_CrossJoins checks CROSS JOIN and comma-separated FROM items.
+func TestParseStatement_CrossJoins(t *testing.T) {
+	sql := "SELECT * FROM a, b AS bb CROSS JOIN (SELECT id FROM c) AS sub LEFT JOIN d ON a.x > d.y"
+	stmt, err := New(lex.New(sql)).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement(%q) unexpected error: %v", sql, err)
+	}
+	sel := stmt.(*SelectStmt)
+
+	if len(sel.Joins) != 3 {
+		t.Fatalf("expected 3 joins, got %d", len(sel.Joins))
+	}
+	comma := sel.Joins[0]
+	if comma.Type != "CROSS" || comma.Table != "b" || comma.Alias != "bb" || comma.On != nil {
+		t.Errorf("unexpected comma join %#v", comma)
+	}
+	cross := sel.Joins[1]
+	if cross.Type != "CROSS" || cross.Subquery == nil || cross.Alias != "sub" {
+		t.Errorf("unexpected CROSS join %#v", cross)
+	}
+	band := sel.Joins[2]
+	if band.Type != "LEFT" || band.On == nil || band.On.Op != ">" {
+		t.Errorf("unexpected non-equi join %#v", band)
+	}
+}
+
+// TestParseStatement_Analyze checks ANALYZE with and without a table name.
+func TestParseStatement_Analyze(t *testing.T) {
+	tests := []struct {
+		sql   string
+		table string
+	}{
+		{"ANALYZE", ""},
+		{"analyze students", "students"},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		analyze, ok := stmt.(*AnalyzeStatement)
+		if !ok {
+			t.Fatalf("ParseStatement(%q) expected *AnalyzeStatement, got %T", tt.sql, stmt)
+		}
+		if analyze.Table != tt.table {
+			t.Errorf("ParseStatement(%q) table = %q, want %q", tt.sql, analyze.Table, tt.table)
+		}
+	}
+}
+
+// TestParseStatement_Explain checks the EXPLAIN options and the wrapped SELECT.
+func TestParseStatement_Explain(t *testing.T) {
+	tests := []struct {
+		sql     string
+		analyze bool
+		format  string
+	}{
+		{"EXPLAIN SELECT * FROM students", false, "text"},
+		{"EXPLAIN ANALYZE SELECT * FROM students", true, "text"},
+		{"explain format json select * from students", false, "json"},
+		{"EXPLAIN ANALYZE FORMAT TEXT SELECT * FROM students", true, "text"},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		explain, ok := stmt.(*ExplainStatement)
+		if !ok {
+			t.Fatalf("ParseStatement(%q) expected *ExplainStatement, got %T", tt.sql, stmt)
+		}
+		if explain.Analyze != tt.analyze || explain.Format != tt.format {
+			t.Errorf("ParseStatement(%q) = analyze %v format %q, want %v %q", tt.sql, explain.Analyze, explain.Format, tt.analyze, tt.format)
+		}
+		if explain.Select == nil || explain.Select.Table != "students" {
+			t.Errorf("ParseStatement(%q) select = %+v, want FROM students", tt.sql, explain.Select)
+		}
+	}
+}
+
+// TestParseStatement_SetOperations checks DISTINCT and the grouping of UNION,
+// INTERSECT and EXCEPT: INTERSECT binds tighter, the others associate left.
+func TestParseStatement_SetOperations(t *testing.T) {
+	var shape func(s *SelectStmt) string
+	shape = func(s *SelectStmt) string {
+		if s.SetOp == nil {
+			if s.Distinct {
+				return "distinct " + s.Table
+			}
+			return s.Table
+		}
+		op := s.SetOp.Op
+		if s.SetOp.All {
+			op += " ALL"
+		}
+		return "(" + shape(s.SetOp.Left) + " " + op + " " + shape(s.SetOp.Right) + ")"
+	}
+
+	tests := []struct {
+		sql     string
+		want    string
+		orderBy int
+	}{
+		{"SELECT DISTINCT id FROM a", "distinct a", 0},
+		{"SELECT id FROM a UNION SELECT id FROM b", "(a UNION b)", 0},
+		{"SELECT id FROM a union all SELECT id FROM b EXCEPT SELECT id FROM c", "((a UNION ALL b) EXCEPT c)", 0},
+		{"SELECT id FROM a UNION SELECT id FROM b INTERSECT ALL SELECT id FROM c", "(a UNION (b INTERSECT ALL c))", 0},
+		{"SELECT id FROM a EXCEPT (SELECT id FROM b UNION SELECT id FROM c) ORDER BY id", "(a EXCEPT (b UNION c))", 1},
+		{"SELECT DISTINCT id FROM a INTERSECT SELECT id FROM b ORDER BY id, name", "(distinct a INTERSECT b)", 2},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		sel, ok := stmt.(*SelectStmt)
+		if !ok {
+			t.Fatalf("ParseStatement(%q) expected *SelectStmt, got %T", tt.sql, stmt)
+		}
+		if got := shape(sel); got != tt.want {
+			t.Errorf("ParseStatement(%q) = %s, want %s", tt.sql, got, tt.want)
+		}
+		if len(sel.OrderBy) != tt.orderBy {
+			t.Errorf("ParseStatement(%q) has %d ORDER BY items, want %d", tt.sql, len(sel.OrderBy), tt.orderBy)
+		}
+	}
+}
+
+// TestParseStatement_With checks the CTEs of WITH [RECURSIVE] and the query
+// they are attached to.
+func TestParseStatement_With(t *testing.T) {
+	tests := []struct {
+		sql       string
+		names     []string
+		columns   int // of the first CTE
+		recursive bool
+		setOp     bool // final query is a UNION
+	}{
+		{"WITH s AS (SELECT id FROM students) SELECT * FROM s", []string{"s"}, 0, false, false},
+		{"with a (x, y) as (select id, age from students), b as (select x from a) select * from b", []string{"a", "b"}, 2, false, false},
+		{"WITH RECURSIVE t (n) AS (SELECT id FROM a UNION ALL SELECT n + 1 FROM t WHERE n < 5) SELECT n FROM t UNION SELECT 0 FROM a", []string{"t"}, 1, true, true},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		sel, ok := stmt.(*SelectStmt)
+		if !ok {
+			t.Fatalf("ParseStatement(%q) expected *SelectStmt, got %T", tt.sql, stmt)
+		}
+		if len(sel.With) != len(tt.names) {
+			t.Fatalf("ParseStatement(%q) has %d CTEs, want %d", tt.sql, len(sel.With), len(tt.names))
+		}
+		for i, cte := range sel.With {
+			if cte.Name != tt.names[i] || cte.Recursive != tt.recursive || cte.Query == nil {
+				t.Errorf("ParseStatement(%q) CTE %d = %+v, want %s (recursive %v)", tt.sql, i, cte, tt.names[i], tt.recursive)
+			}
+		}
+		if len(sel.With[0].Columns) != tt.columns {
+			t.Errorf("ParseStatement(%q) first CTE has %d columns, want %d", tt.sql, len(sel.With[0].Columns), tt.columns)
+		}
+		if (sel.SetOp != nil) != tt.setOp {
+			t.Errorf("ParseStatement(%q) set operation = %v, want %v", tt.sql, sel.SetOp != nil, tt.setOp)
+		}
+	}
+}
+
+func TestParseStatement_Window(t *testing.T) {
+	tests := []struct {
+		sql       string
+		fn        string
+		args      int
+		partition int
+		order     int
+		frame     string // "" for the default frame
+	}{
+		{"SELECT RANK() OVER () FROM a", "RANK", 0, 0, 0, ""},
+		{"SELECT COUNT(*) OVER (PARTITION BY x, y) FROM a", "COUNT", 0, 2, 0, ""},
+		{"SELECT lag(x, 2, 0) over (order by t desc, id) FROM a", "LAG", 3, 0, 2, ""},
+		{"SELECT SUM(x) OVER (PARTITION BY g ORDER BY t ROWS BETWEEN 2 PRECEDING AND 1 FOLLOWING) FROM a", "SUM", 1, 1, 1, "ROWS BETWEEN 2 PRECEDING AND 1 FOLLOWING"},
+		{"SELECT AVG(x) OVER (ORDER BY t RANGE 0.5 PRECEDING) FROM a", "AVG", 1, 0, 1, "RANGE BETWEEN 0.5 PRECEDING AND CURRENT ROW"},
+		{"SELECT MIN(x) OVER (ROWS BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING) FROM a", "MIN", 1, 0, 0, "ROWS BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING"},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		call := stmt.(*SelectStmt).Items[0].Expr
+		if call.Type != EXPR_FUNC || call.FuncName != tt.fn || len(call.Args) != tt.args || call.Window == nil {
+			t.Fatalf("ParseStatement(%q) select item = %+v, want window call of %s with %d args", tt.sql, call, tt.fn, tt.args)
+		}
+		w := call.Window
+		if len(w.PartitionBy) != tt.partition || len(w.OrderBy) != tt.order {
+			t.Errorf("ParseStatement(%q) window has %d partition and %d order keys, want %d and %d",
+				tt.sql, len(w.PartitionBy), len(w.OrderBy), tt.partition, tt.order)
+		}
+		frame := ""
+		if w.Frame != nil {
+			frame = w.Frame.String()
+		}
+		if frame != tt.frame {
+			t.Errorf("ParseStatement(%q) frame = %q, want %q", tt.sql, frame, tt.frame)
+		}
+	}
+}
+
+func TestParseStatement_OnConflict(t *testing.T) {
+	tests := []struct {
+		sql      string
+		target   []string
+		doUpdate bool
+		sets     int
+		where    bool
+	}{
+		{"INSERT INTO a VALUES (1, 2) ON CONFLICT DO NOTHING", nil, false, 0, false},
+		{"INSERT INTO a VALUES (1, 2) on conflict (id) do nothing", []string{"id"}, false, 0, false},
+		{"INSERT INTO a VALUES (1, 2) ON CONFLICT (id) DO UPDATE SET x = EXCLUDED.x", []string{"id"}, true, 1, false},
+		{"INSERT INTO a VALUES (1, 2) ON CONFLICT (id) DO UPDATE SET x = a.x + EXCLUDED.x, y = 0 WHERE a.y < 10", []string{"id"}, true, 2, true},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		clause := stmt.(*InsertStmt).OnConflict
+		if clause == nil {
+			t.Fatalf("ParseStatement(%q) has no ON CONFLICT clause", tt.sql)
+		}
+		if strings.Join(clause.Columns, ",") != strings.Join(tt.target, ",") || clause.DoUpdate != tt.doUpdate {
+			t.Errorf("ParseStatement(%q) clause = %+v, want target %v, do update %v", tt.sql, clause, tt.target, tt.doUpdate)
+		}
+		if len(clause.SetExprs) != tt.sets || (clause.Where != nil) != tt.where {
+			t.Errorf("ParseStatement(%q) has %d SET columns and WHERE %v, want %d and %v",
+				tt.sql, len(clause.SetExprs), clause.Where != nil, tt.sets, tt.where)
+		}
+	}
+}
+
+func TestParseStatement_Returning(t *testing.T) {
+	tests := []struct {
+		sql   string
+		items int // -1: no RETURNING, 0: RETURNING *
+	}{
+		{"INSERT INTO a VALUES (1, 2)", -1},
+		{"INSERT INTO a VALUES (1, 2) RETURNING *", 0},
+		{"INSERT INTO a VALUES (1, 2) ON CONFLICT (id) DO UPDATE SET x = EXCLUDED.x WHERE a.x < 5 RETURNING id, x", 2},
+		{"UPDATE a SET x = x + 1 RETURNING x AS new_x", 1},
+		{"UPDATE a SET x = 1, y = 2 WHERE id = 3 returning id, x * 2 doubled, UPPER(name)", 3},
+		{"DELETE FROM a WHERE id = 3 RETURNING *", 0},
+		{"DELETE FROM a RETURNING id", 1},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		var returning *ReturningClause
+		switch s := stmt.(type) {
+		case *InsertStmt:
+			returning = s.Returning
+		case *UpdateStmt:
+			returning = s.Returning
+			if len(s.SetExprs) == 0 {
+				t.Errorf("ParseStatement(%q) has no SET columns", tt.sql)
+			}
+		case *DeleteStatement:
+			returning = s.Returning
+		}
+		items := -1
+		if returning != nil {
+			items = len(returning.Items)
+		}
+		if items != tt.items {
+			t.Errorf("ParseStatement(%q) RETURNING has %d items, want %d", tt.sql, items, tt.items)
+		}
+	}
+}
+
+func TestParseStatement_UpdateFromDeleteUsing(t *testing.T) {
+	tests := []struct {
+		sql   string
+		alias string
+		items int // FROM / USING items, joins included
+		where bool
+	}{
+		{"UPDATE a SET x = 1", "", 0, false},
+		{"UPDATE a AS t SET x = b.y FROM b WHERE b.id = t.id", "t", 1, true},
+		{"UPDATE a t SET x = b.y + c.z FROM b JOIN c ON b.id = c.id, d WHERE b.id = t.id RETURNING x", "t", 3, true},
+		{"DELETE FROM a", "", 0, false},
+		{"DELETE FROM a WHERE id BETWEEN 1 AND 5 OR (name LIKE 'x%' AND NOT age > 3)", "", 0, true},
+		{"DELETE FROM a AS t USING b WHERE b.id = t.id", "t", 1, true},
+		{"DELETE FROM a t USING b, (SELECT id FROM c) s WHERE b.id = t.id AND s.id = b.id RETURNING t.id", "t", 2, true},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		var alias string
+		var items []JoinClause
+		var where bool
+		switch s := stmt.(type) {
+		case *UpdateStmt:
+			alias, items, where = s.Alias, s.From, s.WhereExpr != nil
+		case *DeleteStatement:
+			alias, items, where = s.Alias, s.Using, s.Where != nil
+		default:
+			t.Fatalf("ParseStatement(%q) returned %T", tt.sql, stmt)
+		}
+		if alias != tt.alias || len(items) != tt.items || where != tt.where {
+			t.Errorf("ParseStatement(%q) = alias %q, %d items, WHERE %v; want %q, %d, %v",
+				tt.sql, alias, len(items), where, tt.alias, tt.items, tt.where)
+		}
+		if len(items) > 0 && items[0].Type != "CROSS" {
+			t.Errorf("ParseStatement(%q) first item is %s joined, want CROSS", tt.sql, items[0].Type)
+		}
+	}
+}
+
+func TestParseStatement_Views(t *testing.T) {
+	tests := []struct {
+		sql          string
+		name         string
+		columns      int
+		orReplace    bool
+		materialized bool
+		refs         string
+	}{
+		{"CREATE VIEW v AS SELECT id FROM t", "v", 0, false, false, "t"},
+		{"CREATE OR REPLACE VIEW v (a, b) AS SELECT t.id, u.n FROM t JOIN u ON u.id = t.id", "v", 2, true, false, "t,u"},
+		{"CREATE MATERIALIZED VIEW m AS SELECT id FROM t WHERE id IN (SELECT id FROM u)", "m", 0, false, true, "t,u"},
+		{"CREATE VIEW v AS WITH c AS (SELECT id FROM t) SELECT id FROM c", "v", 0, false, false, "t"},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		s, ok := stmt.(*CreateViewStmt)
+		if !ok {
+			t.Fatalf("ParseStatement(%q) returned %T", tt.sql, stmt)
+		}
+		refs := strings.Join(s.References, ",")
+		if s.Name != tt.name || len(s.Columns) != tt.columns || s.OrReplace != tt.orReplace ||
+			s.Materialized != tt.materialized || refs != tt.refs {
+			t.Errorf("ParseStatement(%q) = %s, %d columns, OR REPLACE %v, MATERIALIZED %v, refs %q",
+				tt.sql, s.Name, len(s.Columns), s.OrReplace, s.Materialized, refs)
+		}
+		if !strings.HasPrefix(s.SQL, "SELECT") && !strings.HasPrefix(s.SQL, "WITH") {
+			t.Errorf("ParseStatement(%q) kept query text %q", tt.sql, s.SQL)
+		}
+	}
+
+	views := map[string]types.ViewDef{
+		"v":  {Name: "v", Query: "SELECT id FROM t"},
+		"vc": {Name: "vc", Query: "SELECT id FROM v", ColumnNames: []string{"x"}},
+		"m":  {Name: "m", Materialized: true, Table: "m$1"},
+	}
+	lookup := func(name string) (types.ViewDef, bool) {
+		v, ok := views[strings.ToLower(name)]
+		return v, ok
+	}
+	expand := []struct {
+		sql   string
+		table string // FROM table after expansion, "" for a derived table
+		alias string
+	}{
+		{"SELECT * FROM v", "", "v"},
+		{"SELECT x FROM vc WHERE x > 1", "", "vc"},
+		{"SELECT * FROM m", "m$1", "m"},
+		{"SELECT * FROM m AS z", "m$1", "z"},
+		{"WITH v AS (SELECT id FROM u) SELECT * FROM v", "v", ""},
+	}
+	for _, tt := range expand {
+		p := New(lex.New(tt.sql))
+		p.SetViews(lookup)
+		stmt, err := p.ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		sel := stmt.(*SelectStmt)
+		if sel.Table != tt.table || sel.Alias != tt.alias || (tt.table == "") != (sel.FromSelect != nil) {
+			t.Errorf("ParseStatement(%q) = table %q alias %q derived %v; want %q, %q",
+				tt.sql, sel.Table, sel.Alias, sel.FromSelect != nil, tt.table, tt.alias)
+		}
+	}
+}
+
+func TestParseStatement_Triggers(t *testing.T) {
+	tests := []struct {
+		sql    string
+		timing string
+		event  string
+		body   []string
+	}{
+		{"CREATE TRIGGER tr AFTER INSERT ON t FOR EACH ROW INSERT INTO log VALUES (NEW.id)",
+			"AFTER", "INSERT", []string{"INSERT INTO log VALUES (NEW.id)"}},
+		{"CREATE TRIGGER tr BEFORE DELETE ON t FOR EACH ROW DELETE FROM u WHERE u.tid = OLD.id;",
+			"BEFORE", "DELETE", []string{"DELETE FROM u WHERE u.tid = OLD.id"}},
+		{"CREATE TRIGGER tr AFTER UPDATE ON t FOR EACH ROW BEGIN INSERT INTO log VALUES (OLD.n, NEW.n); UPDATE c SET n = n + 1 END",
+			"AFTER", "UPDATE", []string{"INSERT INTO log VALUES (OLD.n, NEW.n)", "UPDATE c SET n = n + 1"}},
+		{"CREATE TRIGGER tr AFTER UPDATE ON t FOR EACH ROW BEGIN UPDATE c SET n = CASE WHEN NEW.n > 0 THEN 1 ELSE 0 END; END",
+			"AFTER", "UPDATE", []string{"UPDATE c SET n = CASE WHEN NEW.n > 0 THEN 1 ELSE 0 END"}},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+		}
+		s, ok := stmt.(*CreateTriggerStmt)
+		if !ok {
+			t.Fatalf("ParseStatement(%q) returned %T", tt.sql, stmt)
+		}
+		if s.Name != "tr" || s.Table != "t" || s.Timing != tt.timing || s.Event != tt.event ||
+			strings.Join(s.Body, "|") != strings.Join(tt.body, "|") {
+			t.Errorf("ParseStatement(%q) = %+v", tt.sql, s)
+		}
+	}
+
+	// NEW / OLD become literals once the trigger row is set
+	p := New(lex.New("UPDATE c SET n = n + NEW.n WHERE name = OLD.name"))
+	p.SetTriggerRow(map[string]interface{}{"name": "a", "n": 1}, map[string]interface{}{"name": "b", "n": 2})
+	stmt, err := p.ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement with trigger row: %v", err)
+	}
+	upd := stmt.(*UpdateStmt)
+	if rhs := upd.SetExprs["n"].Right; rhs == nil || rhs.Type != EXPR_LITERAL || rhs.Literal != 2 {
+		t.Errorf("NEW.n = %+v, want literal 2", rhs)
+	}
+	if where := upd.WhereExpr; where == nil || where.Right.Type != EXPR_LITERAL || where.Right.Literal != "a" {
+		t.Errorf("OLD.name in WHERE = %+v, want literal a", where)
+	}
+
+	for _, sql := range []string{"INSERT INTO log VALUES (NEW.id)", "INSERT INTO log VALUES (OLD.missing)"} {
+		p := New(lex.New(sql))
+		p.SetTriggerRow(map[string]interface{}{"id": 1}, nil)
+		if _, err := p.ParseStatement(); err == nil {
+			t.Errorf("ParseStatement(%q) with no NEW row expected error", sql)
+		}
+	}
+}
+
+func TestParseStatement_GeneratedColumns(t *testing.T) {
+	sql := "CREATE TABLE t (a INT, b FLOAT GENERATED ALWAYS AS (a * 1.5) STORED, " +
+		"c VARCHAR GENERATED ALWAYS AS (CONCAT('x', a)) VIRTUAL, d INT PRIMARY KEY GENERATED ALWAYS AS (a + 1), " +
+		"e INT GENERATED ALWAYS AS (a - 1) PRIMARY KEY)"
+	stmt, err := New(lex.New(sql)).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement(%q) unexpected error: %v", sql, err)
+	}
+	cols := stmt.(*CreateTableStmt).Columns
+	want := []struct {
+		name      string
+		generated bool
+		stored    bool
+		pk        bool
+	}{
+		{"a", false, false, false},
+		{"b", true, true, false},
+		{"c", true, false, false},
+		{"d", true, false, true},
+		{"e", true, false, true},
+	}
+	if len(cols) != len(want) {
+		t.Fatalf("ParseStatement(%q) = %d columns, want %d", sql, len(cols), len(want))
+	}
+	for i, w := range want {
+		col := cols[i]
+		if col.Name != w.name || (col.Generated != nil) != w.generated || col.Stored != w.stored || col.IsPrimaryKey != w.pk {
+			t.Errorf("column %d = %s generated %v stored %v pk %v; want %+v",
+				i, col.Name, col.Generated != nil, col.Stored, col.IsPrimaryKey, w)
+		}
+	}
+	if b := cols[1].Generated; b.Type != EXPR_BINARY || b.Op != "*" {
+		t.Errorf("b is generated as %+v, want a * 1.5", b)
+	}
+}
+
+func TestParseStatement_Savepoints(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want Statement
+	}{
+		{"SAVEPOINT a", &SavepointStmt{Name: "a"}},
+		{"ROLLBACK", &RollbackTxnStmt{}},
+		{"ROLLBACK TO SAVEPOINT a", &RollbackToSavepointStmt{Name: "a"}},
+		{"ROLLBACK TO a", &RollbackToSavepointStmt{Name: "a"}},
+		{"RELEASE SAVEPOINT a", &ReleaseSavepointStmt{Name: "a"}},
+		{"RELEASE a", &ReleaseSavepointStmt{Name: "a"}},
+		{"RELEASE savepoint", &ReleaseSavepointStmt{Name: "savepoint"}},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Errorf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(stmt, tt.want) {
+			t.Errorf("ParseStatement(%q) = %#v, want %#v", tt.sql, stmt, tt.want)
+		}
+	}
+}
+
+func TestParseStatement_IsolationLevels(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want Statement
+	}{
+		{"BEGIN", &BeginTxnStmt{}},
+		{"BEGIN TRANSACTION", &BeginTxnStmt{}},
+		{"BEGIN ISOLATION LEVEL SERIALIZABLE", &BeginTxnStmt{Isolation: "SERIALIZABLE"}},
+		{"BEGIN WORK ISOLATION LEVEL read committed", &BeginTxnStmt{Isolation: "READ COMMITTED"}},
+		{"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ", &SetTransactionStmt{Isolation: "REPEATABLE READ"}},
+		{"SET TRANSACTION ISOLATION LEVEL READ UNCOMMITTED", &SetTransactionStmt{Isolation: "READ UNCOMMITTED"}},
+		{"SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL SERIALIZABLE", &SetTransactionStmt{Isolation: "SERIALIZABLE", Session: true}},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Errorf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(stmt, tt.want) {
+			t.Errorf("ParseStatement(%q) = %#v, want %#v", tt.sql, stmt, tt.want)
+		}
+	}
+}
+
+func TestParseStatement_SystemTables(t *testing.T) {
+	tests := []struct {
+		sql   string
+		table string
+		alias string
+	}{
+		{"SELECT * FROM sys.locks", "sys.locks", "locks"},
+		{"SELECT l.mode FROM sys.locks l WHERE l.mode = 'X'", "sys.locks", "l"},
+		{"SELECT * FROM sys.locks AS x", "sys.locks", "x"},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lex.New(tt.sql)).ParseStatement()
+		if err != nil {
+			t.Errorf("ParseStatement(%q) unexpected error: %v", tt.sql, err)
+			continue
+		}
+		sel := stmt.(*SelectStmt)
+		if sel.Table != tt.table || sel.Alias != tt.alias {
+			t.Errorf("ParseStatement(%q) = FROM %s %s, want %s %s", tt.sql, sel.Table, sel.Alias, tt.table, tt.alias)
+		}
+	}
+}
@@ -76,7 +76,11 @@ func GetLastAppliedLSN(pg *page.Page) uint64 {
 	return binary.LittleEndian.Uint64(pg.Data[heapOffLSN:])
 }
 
+// SetLastAppliedLSN records that the change logged at lsn is on pg. The LSN
+// never goes back: records are not always applied in LSN order, and redo
+// skips every record at or below it.
 func SetLastAppliedLSN(pg *page.Page, lsn uint64) {
+	lsn = max(lsn, GetLastAppliedLSN(pg))
 	binary.LittleEndian.PutUint64(pg.Data[heapOffLSN:], lsn)
 	pg.LSN = lsn
 	pg.IsDirty = true
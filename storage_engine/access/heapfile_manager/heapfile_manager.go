@@ -160,8 +160,16 @@ func (hm *HeapFileManager) DropHeapFile(fileID uint32) error {
 		return err
 	}
 
-	// remove from manager cache
+	// remove from manager cache, so the table name can be given a new heap file
+	hm.mu.Lock()
 	delete(hm.files, fileID)
+	if id, ok := hm.tableIndex[hf.tableName]; ok && id == fileID {
+		delete(hm.tableIndex, hf.tableName)
+	}
+	hm.mu.Unlock()
+
+	// its pages were flushed by the caller
+	_ = hm.diskManager.CloseFile(fileID)
 
 	// delete heap file from disk
 	return os.Remove(hf.filePath)
@@ -128,6 +128,15 @@ func (hf *HeapFile) findSuitablePage(requiredSpace uint16) (*page.Page, uint32,
 	return pg, localPageNum, nil
 }
 
+// PageCount returns the number of pages allocated to this heap file.
+func (hf *HeapFile) PageCount() int {
+	fd, err := hf.diskManager.GetFileDescriptor(hf.fileID)
+	if err != nil {
+		return 0
+	}
+	return int(fd.NextPageID)
+}
+
 // Flush flushes all dirty pages for this heap file
 func (hf *HeapFile) Flush() error {
 	return hf.bufferPool.FlushAllPages()
@@ -141,7 +150,8 @@ func getFileIDs(files map[uint32]*HeapFile) []uint32 {
 	return keys
 }
 
-// for truncate command
+// for truncate command; pages that already have the truncate logged at lsn
+// (it is being redone) are left as they are
 func (hm *HeapFileManager) TruncateHeapFile(fileID uint32, lsn uint64) error {
 
 	hf, err := hm.GetHeapFileByID(fileID)
@@ -152,8 +162,20 @@ func (hm *HeapFileManager) TruncateHeapFile(fileID uint32, lsn uint64) error {
 	// Get all row pointers from heap
 	rowPtrs := hf.GetAllRowPointers()
 
+	// the page LSNs are read before any row goes: deleting sets them to lsn
+	done := make(map[uint32]bool)
+	for _, rp := range rowPtrs {
+		if _, seen := done[rp.PageNumber]; !seen {
+			pageLSN, err := hm.GetPageLSN(fileID, rp.PageNumber)
+			done[rp.PageNumber] = err == nil && pageLSN >= lsn
+		}
+	}
+
 	// Delete rows one by one
 	for _, rp := range rowPtrs {
+		if done[rp.PageNumber] {
+			continue
+		}
 
 		if err := hm.DeleteRow(&rp, lsn); err != nil {
 			return err
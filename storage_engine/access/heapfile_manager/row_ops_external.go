@@ -10,8 +10,8 @@ it is to be ensured that the internal functions of these should not contain lock
 otherwise two or more dependent function (like UPDATE calling both INSERT and DELETE) will get into Deadlock
 */
 
-// InsertRow inserts a row into the specified heap file (delegates to HeapFile.insertRow).
-func (hfm *HeapFileManager) InsertRow(fileID uint32, rowData []byte, opLSN uint64) (*types.RowPointer, error) {
+// InsertRow inserts a row with the tuple header hdr into the specified heap file (delegates to HeapFile.insertRow).
+func (hfm *HeapFileManager) InsertRow(fileID uint32, hdr types.TupleHeader, rowData []byte, opLSN uint64) (*types.RowPointer, error) {
 	hfm.mu.RLock()
 	heapFile, exists := hfm.files[fileID]
 	hfm.mu.RUnlock()
@@ -23,10 +23,10 @@ func (hfm *HeapFileManager) InsertRow(fileID uint32, rowData []byte, opLSN uint6
 	heapFile.mu.Lock()
 	defer heapFile.mu.Unlock()
 
-	return heapFile.insertRow(rowData, opLSN)
+	return heapFile.insertRow(encodeTuple(hdr, rowData), opLSN)
 }
 
-func (hfm *HeapFileManager) InsertRowAtPointer(fileID uint32, rp *types.RowPointer, rowData []byte, lsn uint64) error {
+func (hfm *HeapFileManager) InsertRowAtPointer(fileID uint32, rp *types.RowPointer, hdr types.TupleHeader, rowData []byte, lsn uint64) error {
 	hfm.mu.RLock()
 	hf, exists := hfm.files[fileID]
 	hfm.mu.RUnlock()
@@ -47,7 +47,7 @@ func (hfm *HeapFileManager) InsertRowAtPointer(fileID uint32, rp *types.RowPoint
 	pg.Lock()
 
 	// Write directly to the specific slot
-	if err := InsertRecordAtSlot(pg, rp.SlotIndex, rowData); err != nil {
+	if err := InsertRecordAtSlot(pg, rp.SlotIndex, encodeTuple(hdr, rowData)); err != nil {
 		pg.Unlock()
 		hf.bufferPool.UnpinPage(pg.ID, false)
 		return fmt.Errorf("failed to insert at slot %d: %w", rp.SlotIndex, err)
@@ -60,9 +60,16 @@ func (hfm *HeapFileManager) InsertRowAtPointer(fileID uint32, rp *types.RowPoint
 }
 
 // // GetRow retrieves a row from the heap file using a RowPointer.
+// The row data comes without its tuple header, whatever version it is.
 func (hfm *HeapFileManager) GetRow(rp *types.RowPointer) ([]byte, error) {
+	_, rowData, err := hfm.GetTuple(rp)
+	return rowData, err
+}
+
+// GetTuple retrieves the MVCC header and the row data of the tuple at rp.
+func (hfm *HeapFileManager) GetTuple(rp *types.RowPointer) (types.TupleHeader, []byte, error) {
 	if rp == nil {
-		return nil, fmt.Errorf("row pointer is nil")
+		return types.TupleHeader{}, nil, fmt.Errorf("row pointer is nil")
 	}
 
 	// Lock manager to get the heap file
@@ -71,18 +78,39 @@ func (hfm *HeapFileManager) GetRow(rp *types.RowPointer) ([]byte, error) {
 	hfm.mu.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("heap file not found")
+		return types.TupleHeader{}, nil, fmt.Errorf("heap file not found")
 	}
 
 	// Lock the heap file for reading before calling its method
 	heapFile.mu.RLock()
 	defer heapFile.mu.RUnlock()
 
-	return heapFile.getRow(rp)
+	return heapFile.getTuple(rp)
+}
+
+// SetXmax marks the tuple at rp as deleted (or replaced) by transaction xmax;
+// xmax 0 makes it the live version again.
+func (hfm *HeapFileManager) SetXmax(rp *types.RowPointer, xmax uint64, opLSN uint64) error {
+	if rp == nil {
+		return fmt.Errorf("row pointer is nil")
+	}
+
+	hfm.mu.RLock()
+	heapFile, exists := hfm.files[rp.FileID]
+	hfm.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("heap file %d not found", rp.FileID)
+	}
+
+	heapFile.mu.Lock()
+	defer heapFile.mu.Unlock()
+
+	return heapFile.setXmax(rp, xmax, opLSN)
 }
 
 // // UpdateRow updates an existing row in the heap file
-// // It replaces the row data at the given RowPointer with new data
+// // It replaces the row data at the given RowPointer with new data, the tuple header stays
 func (hfm *HeapFileManager) UpdateRow(rp *types.RowPointer, newRowData []byte, opLSN uint64) error {
 
 	if rp == nil {
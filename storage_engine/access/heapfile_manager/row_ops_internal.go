@@ -8,10 +8,10 @@ import (
 // this file contains internal functions, they do not contain locks.
 // but it is to be ensured that the external functions for each should contain locks to avoid cirtical section
 
-// insertRow inserts a row into the heap file and returns a RowPointer.
-func (hf *HeapFile) insertRow(rowData []byte, opLSN uint64) (*types.RowPointer, error) {
+// insertRow inserts a tuple (header + row data) into the heap file and returns a RowPointer.
+func (hf *HeapFile) insertRow(tuple []byte, opLSN uint64) (*types.RowPointer, error) {
 
-	rowLen := uint16(len(rowData))
+	rowLen := uint16(len(tuple))
 	maxRowSize := uint16(types.PageSize - types.HeapPageHeaderSize - types.SlotSize - 1) // -1 for page type
 	if rowLen > maxRowSize {
 		return nil, fmt.Errorf("row too large: %d bytes (max: %d)", rowLen, maxRowSize)
@@ -33,7 +33,7 @@ func (hf *HeapFile) insertRow(rowData []byte, opLSN uint64) (*types.RowPointer,
 			continue // retry — findSuitablePage will allocate a new page
 		}
 
-		slotIndex, err := InsertRecord(pg, rowData)
+		slotIndex, err := InsertRecord(pg, tuple)
 		if err != nil {
 			// InsertRecord only fails if space check is wrong — shouldn't happen
 			// after FreeSpace check above, but handle it cleanly.
@@ -56,7 +56,16 @@ func (hf *HeapFile) insertRow(rowData []byte, opLSN uint64) (*types.RowPointer,
 	}
 }
 
-func (hf *HeapFile) getRow(ptr *types.RowPointer) ([]byte, error) {
+// getTuple returns the MVCC header and the row data of the tuple at ptr.
+func (hf *HeapFile) getTuple(ptr *types.RowPointer) (types.TupleHeader, []byte, error) {
+	record, err := hf.getRecord(ptr)
+	if err != nil {
+		return types.TupleHeader{}, nil, err
+	}
+	return decodeTuple(hf.fileID, record)
+}
+
+func (hf *HeapFile) getRecord(ptr *types.RowPointer) ([]byte, error) {
 
 	globalPageID, err := hf.diskManager.GetGlobalPageID(hf.fileID, int64(ptr.PageNumber))
 	if err != nil {
@@ -149,10 +158,41 @@ func (hf *HeapFile) deleteRow(ptr *types.RowPointer, opLSN uint64) error {
 	return nil
 }
 
+// setXmax stamps xmax on the tuple at ptr: the version was deleted or
+// replaced by that transaction (0 makes it live again).
+func (hf *HeapFile) setXmax(ptr *types.RowPointer, xmax uint64, opLSN uint64) error {
+	globalPageID, err := hf.diskManager.GetGlobalPageID(hf.fileID, int64(ptr.PageNumber))
+	if err != nil {
+		return fmt.Errorf("failed to resolve page %d: %w", ptr.PageNumber, err)
+	}
+
+	pg, err := hf.bufferPool.FetchPage(globalPageID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch page %d: %w", globalPageID, err)
+	}
+	defer hf.bufferPool.UnpinPage(pg.ID, true)
+
+	pg.Lock()
+	defer pg.Unlock()
+
+	if err := setTupleXmax(pg, ptr.SlotIndex, xmax); err != nil {
+		return err
+	}
+	SetLastAppliedLSN(pg, opLSN)
+	return nil
+}
+
+// updateRow replaces the row data at ptr, keeping its tuple header.
 func (hf *HeapFile) updateRow(ptr *types.RowPointer, newRowData []byte, opLSN uint64) error {
 
 	fmt.Printf("[Heap] UPDATE fileID=%d page=%d slot=%d lsn=%d\n", ptr.FileID, ptr.PageNumber, ptr.SlotIndex, opLSN)
 
+	hdr, _, err := hf.getTuple(ptr)
+	if err != nil {
+		return fmt.Errorf("failed to read tuple header: %w", err)
+	}
+	newTuple := encodeTuple(hdr, newRowData)
+
 	globalPageID, err := hf.diskManager.GetGlobalPageID(hf.fileID, int64(ptr.PageNumber))
 	if err != nil {
 		return fmt.Errorf("failed to resolve page %d: %w", ptr.PageNumber, err)
@@ -165,7 +205,7 @@ func (hf *HeapFile) updateRow(ptr *types.RowPointer, newRowData []byte, opLSN ui
 
 	pg.Lock()
 
-	updated, err := UpdateRecord(pg, ptr.SlotIndex, newRowData)
+	updated, err := UpdateRecord(pg, ptr.SlotIndex, newTuple)
 	if err != nil {
 		pg.Unlock()
 		hf.bufferPool.UnpinPage(pg.ID, false)
@@ -178,7 +218,7 @@ func (hf *HeapFile) updateRow(ptr *types.RowPointer, newRowData []byte, opLSN ui
 
 	if !updated {
 		// UpdateRecord already tombstoned the slot — just re-insert on a new page.
-		newRP, err := hf.insertRow(newRowData, opLSN)
+		newRP, err := hf.insertRow(newTuple, opLSN)
 		if err != nil {
 			return fmt.Errorf("failed to insert updated row: %w", err)
 		}
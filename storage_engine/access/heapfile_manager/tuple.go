@@ -0,0 +1,84 @@
+package heapfile
+
+import (
+	page "DaemonDB/storage_engine/page"
+	"DaemonDB/types"
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+Every record in a heap page is a tuple: a fixed MVCC header followed by the
+serialized row.
+
+	Offset  Size  Field
+	──────────────────────────────────────────────────────
+	0       8     Xmin      uint64  — transaction that created the version
+	8       8     Xmax      uint64  — transaction that deleted / replaced it, 0 = live
+	16      4     PrevPage  uint32  — older version of the row, noPrevPage = none
+	20      2     PrevSlot  uint16
+	──────────────────────────────────────────────────────
+	22            TupleHeaderSize
+
+The older version is always in the same heap file, so the header only keeps
+its page and slot. Xmax is the only field that changes after the insert
+(SetXmax), and it is overwritten in place.
+*/
+const (
+	tupleOffXmin     = 0
+	tupleOffXmax     = 8
+	tupleOffPrevPage = 16
+	tupleOffPrevSlot = 20
+
+	TupleHeaderSize = 22
+
+	noPrevPage = ^uint32(0)
+)
+
+// encodeTuple prepends the header hdr to the row data.
+func encodeTuple(hdr types.TupleHeader, rowData []byte) []byte {
+	buf := make([]byte, TupleHeaderSize+len(rowData))
+	binary.LittleEndian.PutUint64(buf[tupleOffXmin:], hdr.Xmin)
+	binary.LittleEndian.PutUint64(buf[tupleOffXmax:], hdr.Xmax)
+	prevPage, prevSlot := noPrevPage, uint16(0)
+	if hdr.Prev != nil {
+		prevPage, prevSlot = hdr.Prev.PageNumber, hdr.Prev.SlotIndex
+	}
+	binary.LittleEndian.PutUint32(buf[tupleOffPrevPage:], prevPage)
+	binary.LittleEndian.PutUint16(buf[tupleOffPrevSlot:], prevSlot)
+	copy(buf[TupleHeaderSize:], rowData)
+	return buf
+}
+
+// decodeTuple splits a record of heap file fileID into its header and row data.
+func decodeTuple(fileID uint32, record []byte) (types.TupleHeader, []byte, error) {
+	if len(record) < TupleHeaderSize {
+		return types.TupleHeader{}, nil, fmt.Errorf("record of %d bytes has no tuple header", len(record))
+	}
+	hdr := types.TupleHeader{
+		Xmin: binary.LittleEndian.Uint64(record[tupleOffXmin:]),
+		Xmax: binary.LittleEndian.Uint64(record[tupleOffXmax:]),
+	}
+	if prevPage := binary.LittleEndian.Uint32(record[tupleOffPrevPage:]); prevPage != noPrevPage {
+		hdr.Prev = &types.RowPointer{
+			FileID:     fileID,
+			PageNumber: prevPage,
+			SlotIndex:  binary.LittleEndian.Uint16(record[tupleOffPrevSlot:]),
+		}
+	}
+	return hdr, record[TupleHeaderSize:], nil
+}
+
+// setTupleXmax overwrites the Xmax of the tuple at slotIdx in place.
+func setTupleXmax(pg *page.Page, slotIdx uint16, xmax uint64) error {
+	if slotIdx >= GetSlotCount(pg) {
+		return fmt.Errorf("setTupleXmax: slot %d out of range (count=%d)", slotIdx, GetSlotCount(pg))
+	}
+	offset, length := readSlot(pg, slotIdx)
+	if length < TupleHeaderSize {
+		return fmt.Errorf("setTupleXmax: slot %d holds no tuple", slotIdx)
+	}
+	binary.LittleEndian.PutUint64(pg.Data[int(offset)+tupleOffXmax:], xmax)
+	pg.IsDirty = true
+	return nil
+}
@@ -1,8 +1,11 @@
 package bplus
 
-func (t *BPlusTree) Delete(key []byte) error {
+// Delete removes key, for the logged change at lsn (0 when the change is not
+// logged).
+func (t *BPlusTree) Delete(key []byte, lsn uint64) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	defer t.applying(lsn)()
 
 	if t.root == 0 {
 		return nil // empty tree
@@ -2,9 +2,12 @@ package bplus
 
 import "fmt"
 
-func (t *BPlusTree) Insertion(key []byte, value []byte) error {
+// Insertion sets key to value, for the logged change at lsn (0 when the
+// change is not logged).
+func (t *BPlusTree) Insertion(key []byte, value []byte, lsn uint64) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	defer t.applying(lsn)()
 
 	// If tree is empty
 	if t.root < 0 {
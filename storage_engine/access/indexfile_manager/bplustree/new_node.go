@@ -23,6 +23,7 @@ func (t *BPlusTree) newNode(nodeType NodeType) (*Node, error) {
 		values:   make([][]byte, 0),
 		next:     -1,
 		parent:   -1,
+		lsn:      t.lsn,
 		isDirty:  true,
 		pincnt:   1,
 	}
@@ -32,6 +33,7 @@ func (t *BPlusTree) newNode(nodeType NodeType) (*Node, error) {
 		_ = t.bufferPool.UnpinPage(pg.ID, false)
 		return nil, fmt.Errorf("newNode: initial serialize failed: %w", err)
 	}
+	pg.LSN = n.lsn
 	pg.IsDirty = true
 
 	return n, nil
@@ -50,9 +52,15 @@ func (t *BPlusTree) writeNode(n *Node) error {
 		_ = t.bufferPool.UnpinPage(n.pageID, false)
 	}()
 
+	// the page carries the LSN of the change, so the buffer pool keeps it
+	// until the WAL has the change (WAL before data)
+	if t.lsn > n.lsn {
+		n.lsn = t.lsn
+	}
 	if err := SerializeNode(n, pg.Data); err != nil {
 		return fmt.Errorf("writeNode: serialize failed for page %d: %w", n.pageID, err)
 	}
+	pg.LSN = n.lsn
 
 	// since a Node is the in-memory representation of a page
 	// marks the page for as dirty in bufferpool for it to be synced later
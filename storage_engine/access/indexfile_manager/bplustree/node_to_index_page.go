@@ -8,14 +8,15 @@ import (
 
 /*
 SerializeNode writes a Node into a 4KB page buffer.
-All page IDs (pageID, parent, next, children) are stored as LOCAL page IDs
+All page IDs (parent, next, children) are stored as LOCAL page IDs
 (lower 32 bits only) so they remain valid across restarts regardless of
 how global IDs are reassigned.
 
 Layout:
 
-	Header (34 bytes):
-	  localPageID  int64  (8 bytes)
+	Header (35 bytes):
+	  LSN          uint64 (8 bytes) — last logged change, first in every page type
+	  pageType     uint8  (1 byte)  — stamped by DiskManager on write
 	  isLeaf       bool   (1 byte)  — 1=leaf, 0=internal
 	  numKeys      int16  (2 bytes)
 	  localParent  int64  (8 bytes) — -1 if no parent
@@ -46,13 +47,10 @@ func SerializeNode(node *Node, data []byte) error {
 
 	// ── Header ────────────────────────────────────────────────────────────────
 
-	// Store local pageID (lower 32 bits).
-	localPageID := node.pageID & 0xFFFFFFFF
-	// SerializeNode
 	offset := 0
 
-	// pageID at 0-7
-	binary.LittleEndian.PutUint64(data[offset:], uint64(localPageID))
+	// LSN at 0-7, where the buffer pool reads it
+	binary.LittleEndian.PutUint64(data[offset:], node.lsn)
 	offset += 8
 
 	// byte 8 is reserved for WritePage page type stamp — skip it
@@ -140,8 +138,8 @@ func SerializeNode(node *Node, data []byte) error {
 
 // DeserializeNode reads a Node from a 4KB page buffer.
 // fileID is required to reconstruct global page IDs from stored local IDs.
-// The caller (fetchNode) always overrides node.pageID with the actual global
-// page ID used to fetch the page — so the stored pageID is informational only.
+// The page does not store its own ID: the caller (fetchNode) sets node.pageID
+// to the global page ID used to fetch the page.
 func DeserializeNode(data []byte, fileID uint32) (*Node, error) {
 	if len(data) != page.PageSize {
 		return nil, fmt.Errorf("deserializeNode: data must be %d bytes", page.PageSize)
@@ -150,8 +148,7 @@ func DeserializeNode(data []byte, fileID uint32) (*Node, error) {
 	node := &Node{}
 	offset := 0
 
-	localPageID := int64(binary.LittleEndian.Uint64(data[offset:]))
-	node.pageID = int64(fileID)<<32 | (localPageID & 0xFFFFFFFF)
+	node.lsn = binary.LittleEndian.Uint64(data[offset:])
 	offset += 8
 
 	offset += 1 // skip byte 8 (page type stamp)
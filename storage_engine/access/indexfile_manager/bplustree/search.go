@@ -26,3 +26,24 @@ func (t *BPlusTree) Search(key []byte) ([]byte, error) {
 	}
 	return nil, nil
 }
+
+// LeafLSN returns the LSN of the leaf key is in, or would be inserted in:
+// the last logged change that leaf has.
+func (t *BPlusTree) LeafLSN(key []byte) (uint64, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.root < 0 {
+		return 0, nil
+	}
+
+	leaf, err := t.FindLeaf(t.root, key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find leaf: %w", err)
+	}
+	if leaf == nil {
+		return 0, nil
+	}
+	defer t.bufferPool.UnpinPage(leaf.pageID, false)
+	return leaf.lsn, nil
+}
@@ -44,6 +44,7 @@ type Node struct {
 	values   [][]byte // leaf nodes
 	next     int64    // only for leaf node
 	parent   int64
+	lsn      uint64 // LSN of the last logged change, first 8 bytes of the page
 
 	isDirty bool         // to check if the node is modified
 	pincnt  int16        // buffer pool pin count
@@ -57,13 +58,19 @@ type BPlusTree struct {
 	diskManager *diskmanager.DiskManager // shared disk manager
 	cmp         func(a, b []byte) int    // key comparator (typically bytes.Compare)
 	mu          sync.RWMutex             // protects tree structure during splits/merges
+
+	// LSN of the logged change the running operation applies, stamped on the
+	// nodes it writes (0: not logged, the nodes keep theirs); set under mu
+	lsn uint64
 }
 
 // BufferPool structure and methods are implemented in buffer_pool.go
 
-func (tree *BPlusTree) Reset() error {
+// Reset replaces the tree by an empty root leaf, for the logged change at lsn.
+func (tree *BPlusTree) Reset(lsn uint64) error {
 	tree.mu.Lock()
 	defer tree.mu.Unlock()
+	defer tree.applying(lsn)()
 
 	// create a new empty leaf node
 	root, err := tree.newNode(NodeLeaf)
@@ -87,3 +94,10 @@ func (tree *BPlusTree) Reset() error {
 
 	return nil
 }
+
+// applying makes lsn the LSN the nodes written until the returned function
+// runs are stamped with; tree.mu must be held.
+func (tree *BPlusTree) applying(lsn uint64) func() {
+	tree.lsn = lsn
+	return func() { tree.lsn = 0 }
+}
@@ -0,0 +1,507 @@
+package storageengine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	bplus "DaemonDB/storage_engine/access/indexfile_manager/bplustree"
+	"DaemonDB/types"
+)
+
+/*
+This file contains access path selection for single-table SELECT, and for
+the target table of UPDATE and DELETE (dml_target.go).
+
+The WHERE predicate is split into its top-level AND conjuncts, and every
+conjunct on the primary key that the index can answer is a candidate path:
+
+	pk = v                  → point lookup
+	pk IN (v1, v2, ...)     → multi-point lookup (one B+ tree Search per value)
+	pk LIKE 'prefix%'       → prefix range scan (VARCHAR keys only)
+	pk < | <= | > | >= v,
+	pk BETWEEN a AND b      → range scan: the bounds of every such conjunct are
+	                          combined; VARCHAR keys are scanned, INT keys of a
+	                          bounded range (at most maxRangeKeys values) are
+	                          looked up one by one, as their little-endian
+	                          encoding does not keep them in order in the tree
+	anything else           → full scan
+
+When the table has statistics (ANALYZE) the cheapest candidate wins, a full
+scan included: reading many rows through the index costs a random page each
+and loses to a sequential scan (cost.go). Without statistics the first
+candidate is taken.
+
+Rows fetched through the index are still filtered by the whole WHERE clause,
+so the index only has to return a superset of the matching rows.
+*/
+
+type accessKind int
+
+const (
+	accessFullScan accessKind = iota
+	accessPKPoints
+	accessPKPrefix
+	accessPKRange
+)
+
+// maxRangeKeys is the widest INT key range looked up value by value.
+const maxRangeKeys = 1024
+
+type accessPath struct {
+	kind   accessKind
+	keys   [][]byte  // accessPKPoints, accessPKRange on an INT key: encoded key values
+	prefix string    // accessPKPrefix: literal LIKE prefix
+	lo, hi *keyBound // accessPKRange on a VARCHAR key: the bounds (nil: unbounded)
+
+	conj *types.ExpressionNode // the conjunct(s) the index answers
+}
+
+// keyBound is one end of a range of VARCHAR keys.
+type keyBound struct {
+	value     string
+	inclusive bool
+}
+
+// splitConjuncts flattens a tree of ANDs into its operands.
+func splitConjuncts(expr *types.ExpressionNode) []*types.ExpressionNode {
+	if expr == nil {
+		return nil
+	}
+	if expr.Type == types.ExprLogical && strings.EqualFold(expr.Op, "AND") {
+		return append(splitConjuncts(expr.Left), splitConjuncts(expr.Right)...)
+	}
+	return []*types.ExpressionNode{expr}
+}
+
+// isConstantExpr reports whether expr can be evaluated without a row.
+func isConstantExpr(expr *types.ExpressionNode) bool {
+	if expr == nil {
+		return true
+	}
+	if expr.Type == types.ExprColumn || expr.Subquery != nil || expr.Window != nil {
+		return false
+	}
+	for _, child := range expr.Children() {
+		if !isConstantExpr(child) {
+			return false
+		}
+	}
+	return true
+}
+
+// isColumnRef reports whether expr references column col of table.
+func isColumnRef(expr *types.ExpressionNode, table, col string) bool {
+	if expr == nil || expr.Type != types.ExprColumn {
+		return false
+	}
+	name := expr.Column
+	if dot := strings.LastIndex(name, "."); dot != -1 {
+		if !strings.EqualFold(name[:dot], table) {
+			return false
+		}
+		name = name[dot+1:]
+	}
+	return strings.EqualFold(name, col)
+}
+
+func (se *StorageEngine) chooseAccessPath(tableName string, schema types.TableSchema, where *types.ExpressionNode) accessPath {
+	var pkCol *types.ColumnDef
+	for i := range schema.Columns {
+		if schema.Columns[i].IsPrimaryKey {
+			pkCol = &schema.Columns[i]
+			break
+		}
+	}
+	if pkCol == nil {
+		return accessPath{kind: accessFullScan}
+	}
+
+	candidates := []accessPath{}
+	ranges := []*types.ExpressionNode{}
+	for _, conj := range splitConjuncts(where) {
+		switch conj.Type {
+		case types.ExprComparison:
+			if conj.Op != "=" {
+				ranges = append(ranges, conj)
+				continue
+			}
+			value := conj.Right
+			if !isColumnRef(conj.Left, tableName, pkCol.Name) {
+				value = conj.Left
+				if !isColumnRef(conj.Right, tableName, pkCol.Name) {
+					continue
+				}
+			}
+			if keys, ok := encodeKeyValues(*pkCol, value); ok {
+				candidates = append(candidates, accessPath{kind: accessPKPoints, keys: keys, conj: conj})
+			}
+
+		case types.ExprIn:
+			if conj.Negate || conj.Subquery != nil || !isColumnRef(conj.Left, tableName, pkCol.Name) {
+				continue
+			}
+			if keys, ok := encodeKeyValues(*pkCol, conj.Args...); ok {
+				candidates = append(candidates, accessPath{kind: accessPKPoints, keys: keys, conj: conj})
+			}
+
+		case types.ExprLike:
+			if !isColumnRef(conj.Left, tableName, pkCol.Name) || !strings.EqualFold(pkCol.Type, types.TypeVarchar) {
+				continue
+			}
+			if prefix, ok := likePrefix(conj); ok {
+				candidates = append(candidates, accessPath{kind: accessPKPrefix, prefix: prefix, conj: conj})
+			}
+
+		case types.ExprBetween:
+			ranges = append(ranges, conj)
+		}
+	}
+	if path, ok := rangePath(tableName, *pkCol, ranges); ok {
+		candidates = append(candidates, path)
+	}
+
+	stats, ok := se.tableStats(schema.TableName)
+	if !ok {
+		if len(candidates) > 0 {
+			return candidates[0]
+		}
+		return accessPath{kind: accessFullScan}
+	}
+
+	best := accessPath{kind: accessFullScan}
+	bestCost := scanCost(stats)
+	for _, path := range candidates {
+		if cost := pathCost(path, stats); cost < bestCost {
+			best, bestCost = path, cost
+		}
+	}
+	return best
+}
+
+// rangePath combines the bounds the comparisons and BETWEENs in conjs put
+// on the primary key into a range scan, if the key type allows one.
+func rangePath(tableName string, pkCol types.ColumnDef, conjs []*types.ExpressionNode) (accessPath, bool) {
+	pkType, err := types.NormalizeType(pkCol.Type)
+	if err != nil || (pkType != types.TypeInt && pkType != types.TypeVarchar) {
+		return accessPath{}, false
+	}
+
+	var lo, hi *keyBound
+	var lowNum, highNum = math.Inf(-1), math.Inf(1)
+	var used *types.ExpressionNode
+
+	// add narrows the range by pk op value; false if value is not usable
+	add := func(op string, expr *types.ExpressionNode) bool {
+		if !isConstantExpr(expr) {
+			return false
+		}
+		val, err := types.EvalExpression(expr, nil)
+		if err != nil || val == nil {
+			return false
+		}
+		inclusive := op == "<=" || op == ">="
+		lower := op == ">" || op == ">="
+
+		if pkType == types.TypeInt {
+			f, ok := numericValue(val)
+			if !ok {
+				return false
+			}
+			// the integer bounds of the range
+			switch {
+			case lower && inclusive:
+				lowNum = math.Max(lowNum, math.Ceil(f))
+			case lower:
+				lowNum = math.Max(lowNum, math.Floor(f)+1)
+			case inclusive:
+				highNum = math.Min(highNum, math.Floor(f))
+			default:
+				highNum = math.Min(highNum, math.Ceil(f)-1)
+			}
+			return true
+		}
+
+		s, ok := val.(string)
+		if !ok {
+			return false
+		}
+		b := &keyBound{value: s, inclusive: inclusive}
+		if lower {
+			if lo == nil || s > lo.value || (s == lo.value && !inclusive) {
+				lo = b
+			}
+		} else if hi == nil || s < hi.value || (s == hi.value && !inclusive) {
+			hi = b
+		}
+		return true
+	}
+
+	for _, conj := range conjs {
+		ok := false
+		if conj.Type == types.ExprBetween {
+			if !conj.Negate && len(conj.Args) == 2 && isColumnRef(conj.Left, tableName, pkCol.Name) &&
+				isConstantExpr(conj.Args[0]) && isConstantExpr(conj.Args[1]) {
+				ok = add(">=", conj.Args[0]) && add("<=", conj.Args[1])
+			}
+		} else {
+			op := conj.Op
+			if _, isRange := map[string]bool{"<": true, "<=": true, ">": true, ">=": true}[op]; !isRange {
+				continue
+			}
+			switch {
+			case isColumnRef(conj.Left, tableName, pkCol.Name):
+				ok = add(op, conj.Right)
+			case isColumnRef(conj.Right, tableName, pkCol.Name):
+				// v < pk is pk > v
+				ok = add(map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<="}[op], conj.Left)
+			}
+		}
+		if ok {
+			used = andExpr(used, conj)
+		}
+	}
+	if used == nil {
+		return accessPath{}, false
+	}
+
+	path := accessPath{kind: accessPKRange, conj: used}
+	if pkType == types.TypeVarchar {
+		path.lo, path.hi = lo, hi
+		return path, true
+	}
+
+	// INT keys are stored as int32
+	lowNum, highNum = math.Max(lowNum, math.MinInt32), math.Min(highNum, math.MaxInt32)
+	if highNum-lowNum+1 > maxRangeKeys {
+		return accessPath{}, false
+	}
+	path.keys = [][]byte{}
+	for v := lowNum; v <= highNum; v++ {
+		key, err := ValueToBytes(int(v), types.TypeInt)
+		if err != nil {
+			return accessPath{}, false
+		}
+		path.keys = append(path.keys, key)
+	}
+	return path, true
+}
+
+// likePrefix returns the literal prefix every string matching the LIKE
+// predicate conj starts with, if its pattern is a constant with such a prefix.
+func likePrefix(conj *types.ExpressionNode) (string, bool) {
+	if conj.Negate || !strings.EqualFold(conj.Op, "LIKE") ||
+		!isConstantExpr(conj.Right) || !isConstantExpr(conj.Escape) {
+		return "", false
+	}
+	pattern, err := types.EvalExpression(conj.Right, nil)
+	if err != nil {
+		return "", false
+	}
+	var escape interface{} = types.DefaultLikeEscape
+	if conj.Escape != nil {
+		if escape, err = types.EvalExpression(conj.Escape, nil); err != nil {
+			return "", false
+		}
+	}
+	p, ok1 := pattern.(string)
+	e, ok2 := escape.(string)
+	if !ok1 || !ok2 {
+		return "", false
+	}
+	prefix, _, err := types.LikePrefix(p, e)
+	if err != nil || prefix == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+// encodeKeyValues evaluates constant expressions and encodes them as index
+// keys. Values that can never equal a key (NULL, 2.5 for an INT key) are
+// dropped; ok is false when some value cannot be used with the index at all.
+func encodeKeyValues(pkCol types.ColumnDef, exprs ...*types.ExpressionNode) ([][]byte, bool) {
+	pkType, err := types.NormalizeType(pkCol.Type)
+	if err != nil {
+		return nil, false
+	}
+
+	keys := [][]byte{}
+	seen := map[string]bool{}
+	for _, expr := range exprs {
+		if !isConstantExpr(expr) {
+			return nil, false
+		}
+		val, err := types.EvalExpression(expr, nil)
+		if err != nil {
+			return nil, false
+		}
+		if val == nil {
+			continue
+		}
+
+		if f, isFloat := val.(float64); isFloat && pkType == types.TypeInt {
+			if f != math.Trunc(f) {
+				continue
+			}
+			val = int(f)
+		}
+		val, err = types.CoerceValue(val, pkType)
+		if err != nil {
+			return nil, false
+		}
+
+		key, err := ValueToBytes(val, pkType)
+		if err != nil {
+			return nil, false
+		}
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, true
+}
+
+// lookupRowPointers returns the row pointers stored under the given keys.
+func (se *StorageEngine) lookupRowPointers(btree *bplus.BPlusTree, keys [][]byte) ([][]byte, error) {
+	rowPtrs := [][]byte{}
+	for _, key := range keys {
+		rowPtrBytes, err := btree.Search(key)
+		if err != nil {
+			return nil, fmt.Errorf("index search failed: %w", err)
+		}
+		if rowPtrBytes != nil {
+			rowPtrs = append(rowPtrs, rowPtrBytes)
+		}
+	}
+	return rowPtrs, nil
+}
+
+// prefixRowPointers returns the row pointers of every VARCHAR key starting
+// with prefix.
+//
+// VARCHAR keys are encoded as a 2-byte length followed by the bytes and the
+// tree orders them with bytes.Compare, so keys of one length form a contiguous
+// group and, inside a group, keys sharing a prefix are contiguous too. The scan
+// therefore skips from length group to length group, seeking straight to
+// length+prefix in each one: O(groups · log n + matches) instead of a full scan.
+func (se *StorageEngine) prefixRowPointers(btree *bplus.BPlusTree, prefix string) [][]byte {
+	rowPtrs := [][]byte{}
+
+	it := btree.SeekGE([]byte{})
+	defer func() { it.Close() }()
+
+	for key := it.Key(); key != nil; key = it.Key() {
+		if len(key) < 2 {
+			it.Next()
+			continue
+		}
+
+		group := key[:2]
+		target := append(append([]byte{}, group...), prefix...)
+
+		switch {
+		case int(binary.LittleEndian.Uint16(group)) < len(prefix):
+			// too short to contain the prefix
+		case bytes.Compare(key, target) < 0:
+			it.Close()
+			it = btree.SeekGE(target)
+			continue
+		case bytes.HasPrefix(key, target):
+			rowPtrs = append(rowPtrs, append([]byte{}, it.Value()...))
+			it.Next()
+			continue
+		}
+
+		// move on to the next length group
+		next, ok := nextGroup(group)
+		if !ok {
+			break
+		}
+		it.Close()
+		it = btree.SeekGE(next)
+	}
+
+	return rowPtrs
+}
+
+// pathRowPointers returns the row pointers an index access path reads.
+func (se *StorageEngine) pathRowPointers(btree *bplus.BPlusTree, path accessPath) ([][]byte, error) {
+	switch {
+	case path.kind == accessPKPrefix:
+		return se.prefixRowPointers(btree, path.prefix), nil
+	case path.kind == accessPKRange && path.keys == nil:
+		return se.rangeRowPointers(btree, path.lo, path.hi), nil
+	}
+	return se.lookupRowPointers(btree, path.keys)
+}
+
+// rangeRowPointers returns the row pointers of every VARCHAR key between lo
+// and hi (nil: unbounded).
+//
+// As for prefixRowPointers, only keys of one length are in string order, so
+// the scan seeks to the lower bound in every length group and leaves the group
+// at the first key past the upper bound.
+func (se *StorageEngine) rangeRowPointers(btree *bplus.BPlusTree, lo, hi *keyBound) [][]byte {
+	rowPtrs := [][]byte{}
+
+	it := btree.SeekGE([]byte{})
+	defer func() { it.Close() }()
+
+	for key := it.Key(); key != nil; key = it.Key() {
+		if len(key) < 2 {
+			it.Next()
+			continue
+		}
+
+		group := key[:2]
+		s := string(key[2:])
+
+		switch {
+		case lo != nil && (s < lo.value || (s == lo.value && !lo.inclusive)):
+			// every key of the group at least lo comes at or after group+lo,
+			// cut to the group's length
+			start := lo.value
+			if n := int(binary.LittleEndian.Uint16(group)); len(start) > n {
+				start = start[:n]
+			}
+			target := append(append([]byte{}, group...), start...)
+			if bytes.Compare(key, target) < 0 {
+				it.Close()
+				it = btree.SeekGE(target)
+			} else {
+				it.Next()
+			}
+			continue
+		case hi == nil || s < hi.value || (s == hi.value && hi.inclusive):
+			rowPtrs = append(rowPtrs, append([]byte{}, it.Value()...))
+			it.Next()
+			continue
+		}
+
+		// past hi: so is the rest of the group
+		next, ok := nextGroup(group)
+		if !ok {
+			break
+		}
+		it.Close()
+		it = btree.SeekGE(next)
+	}
+
+	return rowPtrs
+}
+
+// nextGroup returns the smallest 2-byte string greater than group.
+func nextGroup(group []byte) ([]byte, bool) {
+	next := []byte{group[0], group[1]}
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i] < 0xFF {
+			next[i]++
+			return next, true
+		}
+		next[i] = 0
+	}
+	return nil, false
+}
@@ -70,7 +70,7 @@ func (bp *BufferPool) FetchPage(pageID int64) (*page.Page, error) {
 	}
 	_ = time.Since(start)
 
-	if pg.PageType == types.PageTypeHeapData {
+	if pg.PageType == types.PageTypeHeapData || pg.PageType == types.PageTypeBPlusNode {
 		if len(pg.Data) >= 8 {
 			pg.LSN = binary.LittleEndian.Uint64(pg.Data[page.PageLSNOffset:])
 		}
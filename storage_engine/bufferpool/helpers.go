@@ -38,6 +38,14 @@ func (bp *BufferPool) GetStats() BufferPoolStats {
 	return stats
 }
 
+// Counters returns the hit and miss counters alone; cheaper than GetStats,
+// which walks every cached page.
+func (bp *BufferPool) Counters() (hits, misses int64) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	return bp.hits, bp.misses
+}
+
 func (bp *BufferPool) ResetStats() {
 	bp.mu.Lock()
 	defer bp.mu.Unlock()
@@ -12,7 +12,8 @@ import (
 /*
 This file is the main acess of Catalog Manager
 Catalog manager maintains the metadata of the database and also persist it on the disk
-It persists Heap File Counting, Table to fileId mapping and Schema of tables on the disk
+It persists Heap File Counting, Table to fileId mapping, Schema of tables,
+the optimizer statistics of ANALYZE, the view definitions and the triggers on the disk
 All these mappings are loaded when USE command is executed
 */
 
@@ -22,6 +23,10 @@ func NewCatalogManager(dbRoot string) (*CatalogManager, error) {
 		nextFileID:    1,
 		TableToFileId: make(map[string]TableFileMapping),
 		tableSchemas:  make(map[string]types.TableSchema),
+		tableStats:    make(map[string]types.TableStats),
+		modifiedRows:  make(map[string]int),
+		views:         make(map[string]types.ViewDef),
+		triggers:      make(map[string]types.TriggerDef),
 	}, nil
 }
 
@@ -133,12 +138,17 @@ func (cm *CatalogManager) UnregisterTable(tableName string) error {
 	// remove from in-memory maps
 	delete(cm.tableSchemas, tableName)
 	delete(cm.TableToFileId, tableName)
-
-	// two files were allocated per table
-	if cm.nextFileID >= 2 {
-		cm.nextFileID -= 2
+	cm.modifiedMu.Lock()
+	delete(cm.modifiedRows, tableName)
+	cm.modifiedMu.Unlock()
+	if _, ok := cm.tableStats[tableName]; ok {
+		delete(cm.tableStats, tableName)
+		if err := cm.persistTableStats(); err != nil {
+			return err
+		}
 	}
 
+	// file IDs are not reused: pages of the dropped files may still be cached
 	schemaPath := filepath.Join(cm.dbRoot, cm.currDb, "tables", tableName+"_schema.json")
 	if err := os.Remove(schemaPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete schema file: %w", err)
@@ -294,3 +304,73 @@ func (cm *CatalogManager) GetAllTableMappings() map[string]TableFileMapping {
 	}
 	return result
 }
+
+// GetTableStats returns the statistics of the last ANALYZE of a table.
+func (cm *CatalogManager) GetTableStats(tableName string) (types.TableStats, bool) {
+	stats, ok := cm.tableStats[tableName]
+	return stats, ok
+}
+
+// SetTableStats stores freshly collected statistics and resets the count of
+// modified rows of the table.
+func (cm *CatalogManager) SetTableStats(tableName string, stats types.TableStats) error {
+	if cm.tableStats == nil {
+		cm.tableStats = make(map[string]types.TableStats)
+	}
+	cm.tableStats[tableName] = stats
+	cm.modifiedMu.Lock()
+	delete(cm.modifiedRows, tableName)
+	cm.modifiedMu.Unlock()
+	return cm.persistTableStats()
+}
+
+// RecordModifications counts n rows of a table as inserted, updated or deleted.
+func (cm *CatalogManager) RecordModifications(tableName string, n int) {
+	cm.modifiedMu.Lock()
+	defer cm.modifiedMu.Unlock()
+	if cm.modifiedRows == nil {
+		cm.modifiedRows = make(map[string]int)
+	}
+	cm.modifiedRows[tableName] += n
+}
+
+// ModifiedRows returns the number of rows of a table modified since its
+// statistics were collected (or since the database was opened).
+func (cm *CatalogManager) ModifiedRows(tableName string) int {
+	cm.modifiedMu.Lock()
+	defer cm.modifiedMu.Unlock()
+	return cm.modifiedRows[tableName]
+}
+
+func (cm *CatalogManager) persistTableStats() error {
+	metaDir := filepath.Join(cm.dbRoot, cm.currDb, "metadata")
+	if err := os.MkdirAll(metaDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cm.tableStats, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(metaDir, "table_stats.json"), data, 0644)
+}
+
+// LoadTableStats loads the statistics of the current database; tables that
+// were never analyzed have none.
+func (cm *CatalogManager) LoadTableStats() error {
+	cm.tableStats = make(map[string]types.TableStats)
+	cm.modifiedMu.Lock()
+	cm.modifiedRows = make(map[string]int)
+	cm.modifiedMu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(cm.dbRoot, cm.currDb, "metadata", "table_stats.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read table statistics: %w", err)
+	}
+	if err := json.Unmarshal(data, &cm.tableStats); err != nil {
+		return fmt.Errorf("failed to unmarshal table statistics: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package catalog
 
 import (
 	types "DaemonDB/types"
+	"sync"
 )
 
 type CatalogManager struct {
@@ -10,6 +11,19 @@ type CatalogManager struct {
 	TableToFileId map[string]TableFileMapping
 	nextFileID    uint32
 	tableSchemas  map[string]types.TableSchema
+
+	// optimizer statistics (metadata/table_stats.json) and the rows changed
+	// per table since they were collected (in memory only), counted by the
+	// writes of every session, hence the mutex
+	tableStats   map[string]types.TableStats
+	modifiedMu   sync.Mutex
+	modifiedRows map[string]int
+
+	// views and materialized views (metadata/views.json)
+	views map[string]types.ViewDef
+
+	// row-level triggers (metadata/triggers.json)
+	triggers map[string]types.TriggerDef
 }
 
 type TableFileMapping struct {
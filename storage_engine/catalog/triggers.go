@@ -0,0 +1,103 @@
+package catalog
+
+import (
+	types "DaemonDB/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+This file keeps the triggers of the current database in metadata/triggers.json
+
+Trigger names are unique in a database; TableTriggers returns those of one
+table, timing and event in the order they fire (by name, as in PostgreSQL).
+*/
+
+// GetTrigger returns the trigger called name.
+func (cm *CatalogManager) GetTrigger(name string) (types.TriggerDef, bool) {
+	trigger, ok := cm.triggers[name]
+	return trigger, ok
+}
+
+// PutTrigger adds a trigger.
+func (cm *CatalogManager) PutTrigger(trigger types.TriggerDef) error {
+	if cm.triggers == nil {
+		cm.triggers = make(map[string]types.TriggerDef)
+	}
+	cm.triggers[trigger.Name] = trigger
+	return cm.persistTriggers()
+}
+
+// RemoveTrigger drops a trigger from the catalog.
+func (cm *CatalogManager) RemoveTrigger(name string) error {
+	if _, ok := cm.triggers[name]; !ok {
+		return fmt.Errorf("trigger '%s' not found in catalog", name)
+	}
+	delete(cm.triggers, name)
+	return cm.persistTriggers()
+}
+
+// RemoveTableTriggers drops the triggers of a table.
+func (cm *CatalogManager) RemoveTableTriggers(table string) error {
+	removed := false
+	for name, trigger := range cm.triggers {
+		if trigger.Table == table {
+			delete(cm.triggers, name)
+			removed = true
+		}
+	}
+	if !removed {
+		return nil
+	}
+	return cm.persistTriggers()
+}
+
+// TableTriggers returns the triggers of table that fire at timing on event, by name.
+func (cm *CatalogManager) TableTriggers(table, timing, event string) []types.TriggerDef {
+	var triggers []types.TriggerDef
+	for _, trigger := range cm.triggers {
+		if trigger.Table == table && strings.EqualFold(trigger.Timing, timing) && strings.EqualFold(trigger.Event, event) {
+			triggers = append(triggers, trigger)
+		}
+	}
+	sort.Slice(triggers, func(i, j int) bool { return triggers[i].Name < triggers[j].Name })
+	return triggers
+}
+
+func (cm *CatalogManager) persistTriggers() error {
+	metaDir := filepath.Join(cm.dbRoot, cm.currDb, "metadata")
+	if err := os.MkdirAll(metaDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cm.triggers, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(metaDir, "triggers.json")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// LoadTriggers loads the triggers of the current database.
+func (cm *CatalogManager) LoadTriggers() error {
+	cm.triggers = make(map[string]types.TriggerDef)
+
+	data, err := os.ReadFile(filepath.Join(cm.dbRoot, cm.currDb, "metadata", "triggers.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read triggers: %w", err)
+	}
+	if err := json.Unmarshal(data, &cm.triggers); err != nil {
+		return fmt.Errorf("failed to unmarshal triggers: %w", err)
+	}
+	return nil
+}
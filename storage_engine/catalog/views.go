@@ -0,0 +1,98 @@
+package catalog
+
+import (
+	types "DaemonDB/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+/*
+This file keeps the views of the current database in metadata/views.json
+
+A view shares the namespace of tables. Every view records the tables and views
+its query reads (DependsOn), so that dropping one of them can report the views
+that would break.
+*/
+
+// GetView returns the view called name.
+func (cm *CatalogManager) GetView(name string) (types.ViewDef, bool) {
+	view, ok := cm.views[name]
+	return view, ok
+}
+
+// ViewExists reports whether name is a view or a materialized view.
+func (cm *CatalogManager) ViewExists(name string) bool {
+	_, ok := cm.views[name]
+	return ok
+}
+
+// PutView adds a view, or replaces the one of the same name.
+func (cm *CatalogManager) PutView(view types.ViewDef) error {
+	if cm.views == nil {
+		cm.views = make(map[string]types.ViewDef)
+	}
+	cm.views[view.Name] = view
+	return cm.persistViews()
+}
+
+// RemoveView drops a view from the catalog.
+func (cm *CatalogManager) RemoveView(name string) error {
+	if _, ok := cm.views[name]; !ok {
+		return fmt.Errorf("view '%s' not found in catalog", name)
+	}
+	delete(cm.views, name)
+	return cm.persistViews()
+}
+
+// DependentViews returns the views whose query reads the table or view name, sorted.
+func (cm *CatalogManager) DependentViews(name string) []string {
+	dependents := []string{}
+	for _, view := range cm.views {
+		for _, dep := range view.DependsOn {
+			if dep == name {
+				dependents = append(dependents, view.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+func (cm *CatalogManager) persistViews() error {
+	metaDir := filepath.Join(cm.dbRoot, cm.currDb, "metadata")
+	if err := os.MkdirAll(metaDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cm.views, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// written aside and renamed, so a crash leaves the old or the new set of views
+	path := filepath.Join(metaDir, "views.json")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// LoadViews loads the views of the current database.
+func (cm *CatalogManager) LoadViews() error {
+	cm.views = make(map[string]types.ViewDef)
+
+	data, err := os.ReadFile(filepath.Join(cm.dbRoot, cm.currDb, "metadata", "views.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read views: %w", err)
+	}
+	if err := json.Unmarshal(data, &cm.views); err != nil {
+		return fmt.Errorf("failed to unmarshal views: %w", err)
+	}
+	return nil
+}
@@ -13,6 +13,11 @@ This file is the main file of the NewCheckPointManager
 Checkpoint manager creates a checkpoint file which is saved on queries that were able to successfully write to the heap and index file
 It is important to have a checkpoint manager as it helps in knowing which commands already ran successfully while WAL replay
 Therefore preventing double execution of the same commands
+
+Every page change logged before LSN is on disk when the checkpoint is saved, so
+recovery redoes from LSN on. The transactions running at that point are listed
+with the LSN they began at: their records before the checkpoint are read too,
+for the undo pass, if they never committed.
 */
 
 func NewCheckpointManager(dbPath string) (*CheckpointManager, error) {
@@ -21,8 +26,9 @@ func NewCheckpointManager(dbPath string) (*CheckpointManager, error) {
 	}, nil
 }
 
-// SaveCheckpoint atomically saves a checkpoint
-func (cm *CheckpointManager) SaveCheckpoint(lsn uint64, database string) error {
+// SaveCheckpoint atomically saves a checkpoint at lsn, with the transactions
+// still running
+func (cm *CheckpointManager) SaveCheckpoint(lsn uint64, database string, active []ActiveTxn) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
@@ -30,6 +36,7 @@ func (cm *CheckpointManager) SaveCheckpoint(lsn uint64, database string) error {
 		LSN:       lsn,
 		Timestamp: getCurrentTimestamp(),
 		Database:  database,
+		Active:    active,
 	}
 
 	// Serialize to JSON
@@ -79,6 +86,18 @@ func (cm *CheckpointManager) SaveCheckpoint(lsn uint64, database string) error {
 	return nil
 }
 
+// StartLSN is where recovery starts reading the WAL: the checkpoint, or the
+// begin of the oldest transaction running at it.
+func (c *Checkpoint) StartLSN() uint64 {
+	start := c.LSN
+	for _, t := range c.Active {
+		if t.BeginLSN < start {
+			start = t.BeginLSN
+		}
+	}
+	return start
+}
+
 // LoadCheckpoint loads the last checkpoint
 func (cm *CheckpointManager) LoadCheckpoint() (*Checkpoint, error) {
 	cm.mu.RLock()
@@ -10,7 +10,15 @@ type CheckpointManager struct {
 
 // Checkpoint represents a recovery point in the WAL
 type Checkpoint struct {
-	LSN       uint64 `json:"lsn"`
-	Timestamp int64  `json:"timestamp"` // only for writing the last checkpoint time, not used for replaying
-	Database  string `json:"database"`
+	LSN       uint64      `json:"lsn"`
+	Timestamp int64       `json:"timestamp"` // only for writing the last checkpoint time, not used for replaying
+	Database  string      `json:"database"`
+	Active    []ActiveTxn `json:"active,omitempty"` // transactions running at the checkpoint
+}
+
+// ActiveTxn is a transaction that was running at a checkpoint: recovery reads
+// its records from BeginLSN on, in case it has to be undone.
+type ActiveTxn struct {
+	ID       uint64 `json:"id"`
+	BeginLSN uint64 `json:"begin_lsn"`
 }
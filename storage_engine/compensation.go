@@ -0,0 +1,217 @@
+package storageengine
+
+import (
+	"DaemonDB/types"
+	"bytes"
+	"fmt"
+)
+
+/*
+Compensation log records (CLRs)
+
+A row change is undone by a compensation record, logged first and then
+applied with its own LSN like any other change:
+
+	OpInsert → the new version goes; its key points back at Prev (or goes)
+	OpUpdate → the new version goes and the old one loses its Xmax; the new
+	           key points back at Prev, the old key at the old version
+	OpDelete → the version loses its Xmax; its key points at it
+
+The CLR repeats the pointers and row images of the record it undoes
+(TargetLSN), so it can be applied again from the log alone. Recovery redoes
+CLRs like any other change and never undoes them, nor the records they name.
+
+ROLLBACK, ROLLBACK TO SAVEPOINT, a failed statement and the undo pass of
+recovery (recover_wal.go) all undo through compensate, so a crash in the
+middle of any of them leaves a log the next recovery finishes from.
+
+A version is only touched while its header still carries the transaction
+that wrote it: a change that never reached the page is left alone.
+*/
+
+// compensate logs the undo of the row change op (an OpInsert, OpUpdate or
+// OpDelete record), then applies it.
+func (se *StorageEngine) compensate(op *types.Operation) error {
+	clr := *op
+	clr.Type = types.OpCLR
+	clr.Undone = op.Type
+	clr.TargetLSN = op.LSN
+
+	lsn, err := se.WalManager.AppendOperation(&clr)
+	if err != nil {
+		return fmt.Errorf("failed to log compensation of LSN %d: %w", op.LSN, err)
+	}
+	fmt.Printf("[WAL] CLR lsn=%d undoes lsn=%d op=%d txnID=%d table=%s\n", lsn, op.LSN, op.Type, op.TxnID, op.Table)
+	return se.applyCompensation(&clr, false)
+}
+
+// applyCompensation applies the CLR clr. When redoing it (redo), a page
+// that already has the CLR is left as it is.
+func (se *StorageEngine) applyCompensation(clr *types.Operation, redo bool) error {
+	switch clr.Undone {
+	case types.OpInsert:
+		return se.undoInsert(clr, redo)
+	case types.OpUpdate:
+		return se.undoUpdate(clr, redo)
+	case types.OpDelete:
+		return se.undoDelete(clr, redo)
+	}
+	return fmt.Errorf("compensation at LSN %d undoes op %d, which has no undo", clr.LSN, clr.Undone)
+}
+
+// undoInsert removes the version an insert wrote, and points its key back at
+// the version before it.
+func (se *StorageEngine) undoInsert(clr *types.Operation, redo bool) error {
+	rp := clr.RowPtr
+	key, err := se.recoveredKey(clr.Table, clr.RowData, rp)
+	if err != nil {
+		return err
+	}
+	heapTodo := se.needsChange(rp, clr.LSN, redo)
+	indexTodo := se.indexNeedsChange(clr.Table, key, clr.LSN, redo)
+
+	if heapTodo && se.versionWrittenBy(rp, clr.TxnID, false) {
+		if err := se.HeapManager.DeleteRow(&rp, clr.LSN); err != nil {
+			return fmt.Errorf("remove inserted row failed (table=%s page=%d slot=%d): %w", clr.Table, rp.PageNumber, rp.SlotIndex, err)
+		}
+	}
+	if !indexTodo {
+		return nil
+	}
+	return se.setIndexEntry(clr.Table, key, clr.Prev, clr.LSN)
+}
+
+// undoUpdate removes the new version of an update and makes the old one the
+// newest again, in the heap and in the index.
+func (se *StorageEngine) undoUpdate(clr *types.Operation, redo bool) error {
+	rp, oldPtr := clr.RowPtr, clr.OldPtr
+
+	// the before-image is in the record; a record written without it reads
+	// the old version, which stays in the heap until the update commits
+	oldRowData := clr.OldRowData
+	if oldRowData == nil {
+		var err error
+		if oldRowData, err = se.HeapManager.GetRow(&oldPtr); err != nil {
+			return err
+		}
+	}
+	newKey, err := se.recoveredKey(clr.Table, clr.RowData, rp)
+	if err != nil {
+		return err
+	}
+	oldKey, err := se.recoveredKey(clr.Table, oldRowData, oldPtr)
+	if err != nil {
+		return err
+	}
+	keyChanged := !bytes.Equal(newKey, oldKey)
+
+	// every page is checked before any is written: they may be the same
+	newTodo := se.needsChange(rp, clr.LSN, redo)
+	oldTodo := se.needsChange(oldPtr, clr.LSN, redo)
+	newKeyTodo := keyChanged && se.indexNeedsChange(clr.Table, newKey, clr.LSN, redo)
+	oldKeyTodo := se.indexNeedsChange(clr.Table, oldKey, clr.LSN, redo)
+
+	if newTodo && se.versionWrittenBy(rp, clr.TxnID, false) {
+		if err := se.HeapManager.DeleteRow(&rp, clr.LSN); err != nil {
+			return fmt.Errorf("remove new row version failed (table=%s page=%d slot=%d): %w", clr.Table, rp.PageNumber, rp.SlotIndex, err)
+		}
+	}
+	if oldTodo && se.versionWrittenBy(oldPtr, clr.TxnID, true) {
+		if err := se.HeapManager.SetXmax(&oldPtr, 0, clr.LSN); err != nil {
+			return fmt.Errorf("restore updated row failed (table=%s page=%d slot=%d): %w", clr.Table, oldPtr.PageNumber, oldPtr.SlotIndex, err)
+		}
+	}
+	if newKeyTodo {
+		if err := se.setIndexEntry(clr.Table, newKey, clr.Prev, clr.LSN); err != nil {
+			return err
+		}
+	}
+	if !oldKeyTodo {
+		return nil
+	}
+	return se.setIndexEntry(clr.Table, oldKey, &oldPtr, clr.LSN)
+}
+
+// undoDelete makes the version a delete stamped live again, and points its
+// key (from the before-image) back at it.
+func (se *StorageEngine) undoDelete(clr *types.Operation, redo bool) error {
+	rp := clr.RowPtr
+	if clr.RowData == nil {
+		return fmt.Errorf("undoDelete: nil row data at LSN %d", clr.TargetLSN)
+	}
+	key, err := se.recoveredKey(clr.Table, clr.RowData, rp)
+	if err != nil {
+		return err
+	}
+	heapTodo := se.needsChange(rp, clr.LSN, redo)
+	indexTodo := se.indexNeedsChange(clr.Table, key, clr.LSN, redo)
+
+	if heapTodo && se.versionWrittenBy(rp, clr.TxnID, true) {
+		if err := se.HeapManager.SetXmax(&rp, 0, clr.LSN); err != nil {
+			return fmt.Errorf("restore deleted row failed (table=%s page=%d slot=%d): %w", clr.Table, rp.PageNumber, rp.SlotIndex, err)
+		}
+	}
+	if !indexTodo {
+		return nil
+	}
+	return se.setIndexEntry(clr.Table, key, &rp, clr.LSN)
+}
+
+// needsChange reports whether the heap page of rp still needs the change
+// logged at lsn: always, unless it is being redone.
+func (se *StorageEngine) needsChange(rp types.RowPointer, lsn uint64, redo bool) bool {
+	return !redo || !se.pageHasLSN(rp.FileID, rp.PageNumber, lsn)
+}
+
+// indexNeedsChange is needsChange for the leaf of key in the index of table.
+func (se *StorageEngine) indexNeedsChange(table string, key []byte, lsn uint64, redo bool) bool {
+	if !redo {
+		return true
+	}
+	idx, err := se.GetIndex(table)
+	if err != nil {
+		return true
+	}
+	leafLSN, err := idx.LeafLSN(key)
+	return err != nil || leafLSN < lsn
+}
+
+// setIndexEntry points key of table at ptr, or removes it when ptr is nil,
+// for the change logged at lsn.
+func (se *StorageEngine) setIndexEntry(table string, key []byte, ptr *types.RowPointer, lsn uint64) error {
+	idx, err := se.GetIndex(table)
+	if err != nil {
+		return fmt.Errorf("index open failed (table=%s): %w", table, err)
+	}
+	if err := se.restoreIndexEntry(idx, key, ptr, lsn); err != nil {
+		return fmt.Errorf("index restore failed (table=%s): %w", table, err)
+	}
+	return nil
+}
+
+// versionWrittenBy reports whether the tuple at rp was created (or, with
+// deleted, deleted) by txnID: only then does an undo of txnID touch it.
+func (se *StorageEngine) versionWrittenBy(rp types.RowPointer, txnID uint64, deleted bool) bool {
+	hdr, _, err := se.HeapManager.GetTuple(&rp)
+	if err != nil {
+		return false
+	}
+	if deleted {
+		return hdr.Xmax == txnID
+	}
+	return hdr.Xmin == txnID
+}
+
+// recoveredKey returns the index key of the row rowData of table at rp.
+func (se *StorageEngine) recoveredKey(table string, rowData []byte, rp types.RowPointer) ([]byte, error) {
+	schema, err := se.CatalogManager.GetTableSchema(table)
+	if err != nil {
+		return nil, err
+	}
+	values, err := se.DeserializeRow(rowData, schema.Columns)
+	if err != nil {
+		return nil, err
+	}
+	key, _, err := se.ExtractPrimaryKey(schema, values, &rp)
+	return key, err
+}
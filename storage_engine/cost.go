@@ -0,0 +1,285 @@
+package storageengine
+
+import (
+	"math"
+	"strings"
+
+	bplus "DaemonDB/storage_engine/access/indexfile_manager/bplustree"
+	"DaemonDB/types"
+)
+
+/*
+This file contains the cost model built on the statistics of ANALYZE
+(exec_analyze.go).
+
+Costs are in units of one sequential page read:
+
+	full scan        pages · seqPageCost + rows · cpuTupleCost
+	pk lookup        keys · (index depth + 1) · randomPageCost
+	pk prefix scan   index depth · randomPageCost + matches · (randomPageCost + cpuTupleCost)
+
+A row fetched through the index costs a random page, so a full scan wins as
+soon as the index would return more than a few percent of the table.
+
+Selectivity (the fraction of rows a predicate keeps) is estimated per column:
+
+	col = c                (1 - null_frac) / distinct
+	col < c, BETWEEN ...   share of the histogram below / between the bounds,
+	                       interpolated inside a bucket for numbers; the
+	                       rows equal to c count for <= and > only when c
+	                       is a histogram bound
+	col IN (c1, ..., cn)   n · the selectivity of col = c
+	col LIKE 'p%'          share of the histogram in ['p', 'p\uffff')
+	AND / OR / NOT         s1 · s2 / s1 + s2 - s1 · s2 / 1 - s
+
+Anything else (and columns without statistics) gets defaultSelectivity.
+*/
+
+const (
+	seqPageCost    = 1.0
+	randomPageCost = 4.0
+	cpuTupleCost   = 0.01
+
+	defaultSelectivity = 1.0 / 3
+	// a comparison is never estimated to keep nothing: statistics are a
+	// sample, and 0 rows would make every plan above it look free
+	minSelectivity = 0.0001
+)
+
+// scanCost is the cost of reading every row of a table.
+func scanCost(stats types.TableStats) float64 {
+	return float64(stats.PageCount)*seqPageCost + float64(stats.RowCount)*cpuTupleCost
+}
+
+// indexDepth is the number of B+ tree pages a lookup reads in an index on
+// rows keys.
+func indexDepth(rows int) float64 {
+	return math.Max(1, math.Ceil(math.Log(float64(rows)+1)/math.Log(bplus.MaxKeys)))
+}
+
+// pathCost is the cost of reading a table through an index access path.
+func pathCost(path accessPath, stats types.TableStats) float64 {
+	depth := indexDepth(stats.RowCount)
+	switch path.kind {
+	case accessPKPoints:
+		return float64(len(path.keys)) * ((depth+1)*randomPageCost + cpuTupleCost)
+	case accessPKRange:
+		if path.keys != nil {
+			return float64(len(path.keys)) * ((depth+1)*randomPageCost + cpuTupleCost)
+		}
+		matches := float64(stats.RowCount) * selectivity(path.conj, stats)
+		return depth*randomPageCost + matches*(randomPageCost+cpuTupleCost)
+	case accessPKPrefix:
+		matches := float64(stats.RowCount) * selectivity(path.conj, stats)
+		return depth*randomPageCost + matches*(randomPageCost+cpuTupleCost)
+	}
+	return scanCost(stats)
+}
+
+// estimateRows estimates the number of rows of a table that satisfy filter.
+func estimateRows(stats types.TableStats, filter *types.ExpressionNode) float64 {
+	return float64(stats.RowCount) * selectivity(filter, stats)
+}
+
+// selectivity estimates the fraction of the rows of a table that satisfy expr
+// (nil: all).
+func selectivity(expr *types.ExpressionNode, stats types.TableStats) float64 {
+	if expr == nil {
+		return 1
+	}
+	s := defaultSelectivity
+
+	switch expr.Type {
+	case types.ExprLiteral:
+		if b, ok := boolLiteral(expr); ok && !b {
+			return 0
+		}
+		return 1
+
+	case types.ExprLogical:
+		switch strings.ToUpper(expr.Op) {
+		case "AND":
+			s = selectivity(expr.Left, stats) * selectivity(expr.Right, stats)
+		case "OR":
+			l, r := selectivity(expr.Left, stats), selectivity(expr.Right, stats)
+			s = l + r - l*r
+		case "NOT":
+			s = 1 - selectivity(expr.Left, stats)
+		}
+
+	case types.ExprComparison:
+		col, colOK := columnStatsOf(expr.Left, stats)
+		value, valueOK := constantValue(expr.Right)
+		op := expr.Op
+		if !colOK || !valueOK {
+			// c < col is col > c
+			col, colOK = columnStatsOf(expr.Right, stats)
+			value, valueOK = constantValue(expr.Left)
+			op = map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<="}[op]
+			if op == "" {
+				op = expr.Op
+			}
+		}
+		if colOK && valueOK {
+			s = comparisonSelectivity(col, op, value)
+		}
+
+	case types.ExprBetween:
+		col, ok := columnStatsOf(expr.Left, stats)
+		if !ok || len(expr.Args) != 2 {
+			break
+		}
+		low, lowOK := constantValue(expr.Args[0])
+		high, highOK := constantValue(expr.Args[1])
+		if !lowOK || !highOK {
+			break
+		}
+		s = histogramFraction(col, high) - histogramFraction(col, low) + equalSelectivity(col)
+		s = clampFraction(s) * (1 - col.NullFrac)
+		if expr.Negate {
+			s = 1 - col.NullFrac - s
+		}
+
+	case types.ExprIn:
+		col, ok := columnStatsOf(expr.Left, stats)
+		if !ok || expr.Subquery != nil {
+			break
+		}
+		s = math.Min(1-col.NullFrac, float64(len(expr.Args))*equalSelectivity(col))
+		if expr.Negate {
+			s = 1 - col.NullFrac - s
+		}
+
+	case types.ExprLike:
+		col, ok := columnStatsOf(expr.Left, stats)
+		if !ok {
+			break
+		}
+		if prefix, ok := likePrefix(expr); ok {
+			s = histogramFraction(col, prefix+"\uffff") - histogramFraction(col, prefix)
+			s = clampFraction(s)*(1-col.NullFrac) + equalSelectivity(col)
+		}
+	}
+	return clampFraction(s)
+}
+
+func comparisonSelectivity(col types.ColumnStats, op string, value interface{}) float64 {
+	if value == nil {
+		return 0 // a comparison with NULL is never true
+	}
+	eq := equalSelectivity(col)
+	below := histogramFraction(col, value) * (1 - col.NullFrac)
+	// the rows equal to value are split off a range only when value is
+	// known to be in the column, that is when it is one of the bounds
+	at := 0.0
+	if onBoundary(col, value) {
+		at = eq
+	}
+	var s float64
+	switch op {
+	case "=":
+		s = eq
+	case "!=", "<>":
+		s = 1 - col.NullFrac - eq
+	case "<":
+		s = below
+	case "<=":
+		s = below + at
+	case ">":
+		s = 1 - col.NullFrac - below - at
+	case ">=":
+		s = 1 - col.NullFrac - below
+	default:
+		return defaultSelectivity
+	}
+	return math.Max(minSelectivity, s)
+}
+
+// onBoundary reports whether value is one of the histogram bounds of col.
+func onBoundary(col types.ColumnStats, value interface{}) bool {
+	for _, bound := range col.Histogram {
+		if types.CompareValues(value, bound) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// equalSelectivity is the fraction of rows holding one given value of col.
+func equalSelectivity(col types.ColumnStats) float64 {
+	if col.Distinct == 0 {
+		return 0
+	}
+	return (1 - col.NullFrac) / float64(col.Distinct)
+}
+
+// histogramFraction estimates the fraction of the non-NULL values of col
+// that are smaller than value.
+func histogramFraction(col types.ColumnStats, value interface{}) float64 {
+	bounds := col.Histogram
+	buckets := len(bounds) - 1
+	if buckets < 1 {
+		return 0.5
+	}
+	if types.CompareValues(value, bounds[0]) <= 0 {
+		return 0
+	}
+	if types.CompareValues(value, bounds[buckets]) > 0 {
+		return 1
+	}
+
+	for i := 0; i < buckets; i++ {
+		if types.CompareValues(value, bounds[i+1]) > 0 {
+			continue
+		}
+		within := 0.5
+		lo, loOK := numericValue(bounds[i])
+		hi, hiOK := numericValue(bounds[i+1])
+		v, vOK := numericValue(value)
+		if loOK && hiOK && vOK && hi > lo {
+			within = (v - lo) / (hi - lo)
+		}
+		return (float64(i) + within) / float64(buckets)
+	}
+	return 1
+}
+
+// columnStatsOf returns the statistics of the column expr refers to.
+func columnStatsOf(expr *types.ExpressionNode, stats types.TableStats) (types.ColumnStats, bool) {
+	if expr == nil || expr.Type != types.ExprColumn {
+		return types.ColumnStats{}, false
+	}
+	name := strings.ToLower(expr.Column)
+	name = name[strings.LastIndex(name, ".")+1:]
+	col, ok := stats.Columns[name]
+	return col, ok
+}
+
+// constantValue evaluates expr if it does not depend on a row.
+func constantValue(expr *types.ExpressionNode) (interface{}, bool) {
+	if !isConstantExpr(expr) {
+		return nil, false
+	}
+	val, err := types.EvalExpression(expr, nil)
+	return val, err == nil
+}
+
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func clampFraction(f float64) float64 {
+	return math.Max(0, math.Min(1, f))
+}
@@ -0,0 +1,155 @@
+package storageengine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+)
+
+/*
+This file finds the rows an UPDATE or DELETE changes
+
+	UPDATE t SET ... [FROM items] [WHERE cond]
+	DELETE FROM t [USING items] [WHERE cond]
+	     ↓
+	t alone:    chooseAccessPath(cond) → pk lookup / range scan / full scan → filter by cond
+	with items: the join pipeline of SELECT * FROM t, items WHERE cond (join_plan.go),
+	            with t read up front along with its row pointers
+	     ↓
+	one TargetRow per matching row of t, in table order. A row of t that joins
+	several rows of the items is changed once, with the first of them.
+*/
+
+// targetRowKey is the row key holding, through the joins, the index of the
+// target row a joined row came from.
+const targetRowKey = "#target"
+
+// TargetRow is a row an UPDATE or DELETE changes.
+type TargetRow struct {
+	Pointer types.RowPointer
+	Row     types.Row              // its values, by lower-case column
+	Env     map[string]interface{} // what SET expressions see: its columns and those of the rows it joined
+}
+
+// TargetRows returns the rows of target that satisfy where, joined with the
+// FROM / USING items in joins (the first of which is CROSS joined), as the
+// snapshot of tx sees them.
+func (se *StorageEngine) TargetRows(tx *txn.Transaction, target types.TableRef, joins []types.JoinClause, where *types.ExpressionNode) ([]TargetRow, error) {
+	if err := se.RequireDatabase(); err != nil {
+		return nil, err
+	}
+	snap := se.readSnapshot(tx)
+	schema, err := se.CatalogManager.GetTableSchema(target.Table)
+	if err != nil {
+		return nil, fmt.Errorf("table '%s' not found: %w", target.Table, err)
+	}
+
+	payload := types.SelectPayload{Table: target.Table, Alias: target.Alias, Joins: joins, WhereExpr: where}
+	foldSelect(&payload)
+	name := target.Name()
+
+	if len(joins) == 0 {
+		_, targets, err := se.readTargetRows(snap, target.Table, name, schema, payload.WhereExpr)
+		return targets, err
+	}
+
+	filters, rw, err := se.rewriteJoins(&payload)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]joinInput, len(rw.refs))
+	for i, ref := range rw.refs {
+		if inputs[i], err = se.openFromItem(snap, ref, filters[i], nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// the target is read here instead of by the joins, to keep its row pointers
+	rows, targets, err := se.readTargetRows(snap, target.Table, name, schema, filters[0])
+	if err != nil {
+		return nil, err
+	}
+	inputs[0].rows, inputs[0].size, inputs[0].table = rows, len(rows), ""
+
+	joined, _, _, err := se.joinFromItems(snap, payload, rw, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []int{}
+	seen := make(map[int]bool, len(joined))
+	for _, row := range joined {
+		i, ok := row[targetRowKey].(int)
+		if !ok {
+			return nil, fmt.Errorf("joined row lost its %s row", name)
+		}
+		if !seen[i] {
+			seen[i] = true
+			targets[i].Env = row
+			matched = append(matched, i)
+		}
+	}
+	sort.Ints(matched)
+
+	result := make([]TargetRow, len(matched))
+	for k, i := range matched {
+		result[k] = targets[i]
+	}
+	return result, nil
+}
+
+// readTargetRows reads the rows of tableName (known as refName) that satisfy
+// filter, through the primary key index when filter allows it. The rows are
+// returned both as join rows keyed "refName.column", which hold the index of
+// their TargetRow under targetRowKey, and as TargetRows.
+func (se *StorageEngine) readTargetRows(snap *txn.Snapshot, tableName, refName string, schema types.TableSchema, filter *types.ExpressionNode) ([]map[string]interface{}, []TargetRow, error) {
+	rowPtrs, err := se.tableRowPointers(snap, tableName, refName, schema, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := []map[string]interface{}{}
+	targets := []TargetRow{}
+	for _, rp := range rowPtrs {
+		rawRow, err := se.HeapManager.GetRow(&rp)
+		if err != nil {
+			continue
+		}
+		values, err := se.DeserializeRow(rawRow, schema.Columns)
+		if err != nil {
+			continue
+		}
+
+		row := types.Row{Values: make(map[string]interface{}, len(values))}
+		env := make(map[string]interface{}, 2*len(values)+1)
+		for i, col := range schema.Columns {
+			row.Set(col.Name, values[i])
+			env[strings.ToLower(col.Name)] = values[i]
+			env[refName+"."+col.Name] = values[i]
+		}
+
+		if filter != nil {
+			match, err := types.EvalPredicate(filter, env)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error evaluating WHERE: %w", err)
+			}
+			if !match {
+				continue
+			}
+		}
+
+		// join rows hold only qualified columns, like those of loadTableRows
+		joinRow := make(map[string]interface{}, len(values)+1)
+		for i, col := range schema.Columns {
+			joinRow[refName+"."+col.Name] = values[i]
+		}
+		joinRow[targetRowKey] = len(targets)
+
+		rows = append(rows, joinRow)
+		targets = append(targets, TargetRow{Pointer: rp, Row: row, Env: env})
+	}
+	return rows, targets, nil
+}
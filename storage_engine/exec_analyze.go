@@ -0,0 +1,160 @@
+package storageengine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"DaemonDB/types"
+)
+
+/*
+ANALYZE implementation.
+
+ANALYZE reads every row of a table and stores, in the catalog, what the cost
+model (cost.go) needs to estimate how many rows a predicate keeps:
+
+	table    row count, heap page count
+	column   distinct values, fraction of NULLs, equi-depth histogram
+
+The histogram cuts the sorted non-NULL values into histogramBuckets buckets of
+(about) the same number of rows and keeps their bounds, so a range predicate
+covering two buckets keeps about 2/histogramBuckets of the rows however skewed
+the values are.
+
+Statistics go stale as rows change. Inserts, updates, deletes and truncates
+count the rows they touch; when the statistics of a table are used and more
+than DAEMONDB_STATS_REFRESH_FRACTION (default 0.2) of its rows changed since
+they were collected, the table is analyzed again first.
+*/
+
+const (
+	histogramBuckets            = 10
+	defaultStatsRefreshFraction = 0.2
+)
+
+// AnalyzeTable collects the statistics of a table and stores them in the catalog.
+func (se *StorageEngine) AnalyzeTable(tableName string) (types.TableStats, error) {
+	if err := se.RequireDatabase(); err != nil {
+		return types.TableStats{}, err
+	}
+
+	schema, err := se.CatalogManager.GetTableSchema(tableName)
+	if err != nil {
+		return types.TableStats{}, err
+	}
+	hf, err := se.HeapManager.GetHeapFileByTable(tableName)
+	if err != nil {
+		return types.TableStats{}, err
+	}
+
+	columns := make([][]interface{}, len(schema.Columns))
+	rowCount := 0
+	// the committed state, read without SIREAD locks: statistics are not a
+	// read of the statement that asked for them
+	rowPtrs, err := se.visibleRowPointers(se.readSnapshot(nil), tableName, hf.GetAllRowPointers())
+	if err != nil {
+		return types.TableStats{}, err
+	}
+	for _, rp := range rowPtrs {
+		rawRow, err := se.HeapManager.GetRow(&rp)
+		if err != nil {
+			continue
+		}
+		values, err := se.DeserializeRow(rawRow, schema.Columns)
+		if err != nil {
+			continue
+		}
+		for i := range schema.Columns {
+			columns[i] = append(columns[i], values[i])
+		}
+		rowCount++
+	}
+
+	stats := types.TableStats{
+		RowCount:  rowCount,
+		PageCount: hf.PageCount(),
+		Columns:   make(map[string]types.ColumnStats, len(schema.Columns)),
+	}
+	for i, col := range schema.Columns {
+		stats.Columns[strings.ToLower(col.Name)] = columnStats(columns[i])
+	}
+
+	if err := se.CatalogManager.SetTableStats(tableName, stats); err != nil {
+		return types.TableStats{}, fmt.Errorf("failed to store statistics: %w", err)
+	}
+	return stats, nil
+}
+
+// AnalyzeAllTables analyzes every table of the current database, by name.
+func (se *StorageEngine) AnalyzeAllTables() ([]string, error) {
+	if err := se.RequireDatabase(); err != nil {
+		return nil, err
+	}
+
+	tables := []string{}
+	for name := range se.CatalogManager.GetAllTableMappings() {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+
+	for _, name := range tables {
+		if _, err := se.AnalyzeTable(name); err != nil {
+			return nil, fmt.Errorf("analyze %s: %w", name, err)
+		}
+	}
+	return tables, nil
+}
+
+func columnStats(values []interface{}) types.ColumnStats {
+	nonNull := make([]interface{}, 0, len(values))
+	distinct := map[string]bool{}
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		nonNull = append(nonNull, v)
+		var b strings.Builder
+		writeValueKey(&b, v)
+		distinct[b.String()] = true
+	}
+
+	stats := types.ColumnStats{Distinct: len(distinct)}
+	if len(values) > 0 {
+		stats.NullFrac = float64(len(values)-len(nonNull)) / float64(len(values))
+	}
+	if len(nonNull) == 0 {
+		return stats
+	}
+
+	sort.SliceStable(nonNull, func(i, j int) bool {
+		return types.CompareValues(nonNull[i], nonNull[j]) < 0
+	})
+	buckets := min(histogramBuckets, len(nonNull))
+	for i := 0; i <= buckets; i++ {
+		stats.Histogram = append(stats.Histogram, nonNull[i*(len(nonNull)-1)/buckets])
+	}
+	return stats
+}
+
+// tableStats returns the statistics of a table, analyzing it again first when
+// too many of its rows changed since. ok is false for tables never analyzed.
+func (se *StorageEngine) tableStats(tableName string) (types.TableStats, bool) {
+	stats, ok := se.CatalogManager.GetTableStats(tableName)
+	if !ok {
+		return stats, false
+	}
+
+	changed := se.CatalogManager.ModifiedRows(tableName)
+	if changed == 0 || float64(changed) <= se.statsRefreshFraction*float64(stats.RowCount) {
+		return stats, true
+	}
+
+	fmt.Printf("auto analyze %s: %d rows changed since the last ANALYZE (%d rows)\n", tableName, changed, stats.RowCount)
+	fresh, err := se.AnalyzeTable(tableName)
+	if err != nil {
+		fmt.Printf("auto analyze %s failed: %v\n", tableName, err)
+		return stats, true
+	}
+	return fresh, true
+}
@@ -6,10 +6,11 @@ import (
 	"DaemonDB/storage_engine/bufferpool"
 	checkpoint "DaemonDB/storage_engine/checkpoint_manager"
 	diskmanager "DaemonDB/storage_engine/disk_manager"
+	lock "DaemonDB/storage_engine/lock_manager"
+	ssi "DaemonDB/storage_engine/ssi_manager"
 	txn "DaemonDB/storage_engine/transaction_manager"
 	"DaemonDB/storage_engine/wal_manager"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -135,7 +136,7 @@ func (se *StorageEngine) UseDatabase(name string) error {
 	}
 
 	// Initialize TransactionManager
-	txnManager, err := txn.NewTxnManager()
+	txnManager, err := txn.NewTxnManager(filepath.Join(dbDir, "metadata"))
 	if err != nil {
 		return err
 	}
@@ -152,6 +153,8 @@ func (se *StorageEngine) UseDatabase(name string) error {
 	se.IndexManager = indexManager
 	se.WalManager = walManager
 	se.TxnManager = txnManager
+	se.LockManager = lock.NewLockManager(se.lockTimeout)
+	se.SSIManager = ssi.NewSSIManager()
 	se.CheckpointManager = checkpointManager
 	se.currDb = name
 
@@ -173,8 +176,17 @@ func (se *StorageEngine) UseDatabase(name string) error {
 	if err := se.CatalogManager.LoadAllTableSchemas(); err != nil {
 		return err
 	}
+	if err := se.CatalogManager.LoadTableStats(); err != nil {
+		return err
+	}
+	if err := se.CatalogManager.LoadViews(); err != nil {
+		return err
+	}
+	if err := se.CatalogManager.LoadTriggers(); err != nil {
+		return err
+	}
 
-	fmt.Printf("[DB] CatalogManager loaded table schemas and table to file mapping\n")
+	fmt.Printf("[DB] CatalogManager loaded table schemas, table to file mapping and statistics\n")
 
 	for tableName, mapping := range se.CatalogManager.GetAllTableMappings() {
 		if _, err := se.HeapManager.LoadHeapFile(mapping.HeapFileID, tableName); err != nil {
@@ -185,8 +197,11 @@ func (se *StorageEngine) UseDatabase(name string) error {
 		}
 	}
 
+	// a database recovery could not bring back to a consistent state is not
+	// opened; what recovery did so far is logged, so the next USE resumes it
 	if err := se.RecoverFromWAL(); err != nil {
-		log.Printf("Warning: recovery failed: %v", err)
+		se.closeCurrentDatabase()
+		return fmt.Errorf("recovery of database %s failed: %w", name, err)
 	}
 
 	fmt.Printf("Switched to database: %s\n", name)
@@ -213,6 +228,9 @@ func (se *StorageEngine) closeCurrentDatabase() {
 	se.BufferPool = nil
 	se.HeapManager = nil
 	se.WalManager = nil
+	se.deadMu.Lock()
+	se.deadVersions = nil
+	se.deadMu.Unlock()
 	se.currDb = ""
 }
 
@@ -22,6 +22,9 @@ func (se *StorageEngine) CreateTable(schema types.TableSchema) error {
 	if se.CatalogManager.TableExists(tableName) {
 		return fmt.Errorf("table '%s' already exists", tableName)
 	}
+	if _, ok := se.CatalogManager.GetView(tableName); ok {
+		return fmt.Errorf("view '%s' already exists", tableName)
+	}
 
 	op := &types.Operation{
 		Type:   types.OpCreateTable,
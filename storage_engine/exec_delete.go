@@ -1,115 +1,110 @@
 package storageengine
 
 import (
+	txn "DaemonDB/storage_engine/transaction_manager"
 	"DaemonDB/types"
 	"fmt"
-	"strings"
 )
 
-func (se *StorageEngine) DeleteRows(tableName string, whereCol string, whereVal string) error {
+/*
+This file contains the delete functionality
 
-	// Ensure database selected
-	if err := se.RequireDatabase(); err != nil {
-		return err
-	}
-
-	// Validate table
-	if !se.CatalogManager.TableExists(tableName) {
-		return fmt.Errorf("table '%s' does not exist", tableName)
-	}
+DELETE ... WHERE: the vm finds the rows with TargetRows (dml_target.go), which
+evaluates the whole predicate and uses the primary key index when it can, and
+passes their pointers to DeleteRowsAt:
 
-	// Load schema
-	schema, err := se.CatalogManager.GetTableSchema(tableName)
-	if err != nil {
-		return err
-	}
+	for each row: lock → still the newest version? (else ErrSerialization, mvcc.go)
+	              → BEFORE DELETE triggers → WAL OpDelete (txn, row pointer + before-image)
+	              → Xmax of the version = txn → AFTER DELETE triggers
+	     ↓
+	WAL synced once at the end
 
-	// WAL record
-	op := &types.Operation{
-		Type:     types.OpDelete,
-		Table:    tableName,
-		WhereCol: whereCol,
-		WhereVal: whereVal,
-	}
+The row version and its index entry stay for the snapshots that still see
+it; they are pruned once none does. A rollback clears the Xmax again, and so
+does crash recovery for a transaction that never committed (recover_wal.go).
+*/
 
-	lsn, err := se.WalManager.AppendOperation(op)
+// DeleteRowsAt deletes the rows of tableName at ptrs and returns them. The
+// DELETE triggers of the table run in transaction tx.
+func (se *StorageEngine) DeleteRowsAt(tx *txn.Transaction, tableName string, ptrs []types.RowPointer) ([]types.Row, error) {
+	deleted, err := se.deleteRowsAt(tx, tableName, ptrs)
 	if err != nil {
-		return err
-	}
-
-	if err := se.WalManager.Sync(); err != nil {
-		return err
+		return nil, err
 	}
+	fmt.Printf("Deleted %d rows from '%s'\n", len(deleted), tableName)
+	return deleted, nil
+}
 
-	// Get heap file
-	hf, err := se.HeapManager.GetHeapFileByTable(tableName)
+// deleteRowsAt is DeleteRowsAt without the message, for tables the user
+// does not see (the backing tables of materialized views).
+func (se *StorageEngine) deleteRowsAt(tx *txn.Transaction, tableName string, ptrs []types.RowPointer) ([]types.Row, error) {
+	schema, err := se.CatalogManager.GetTableSchema(tableName)
 	if err != nil {
-		return err
-	}
-
-	rowPtrs := hf.GetAllRowPointers()
-
-	if len(rowPtrs) == 0 {
-		fmt.Printf("Table '%s' already empty\n", tableName)
-		return nil
-	}
-
-	// Get index
-	index, _ := se.GetIndex(tableName)
-
-	// Determine column index for WHERE
-	colIndex := -1
-	if whereCol != "" {
-		for i, col := range schema.Columns {
-			if strings.EqualFold(col.Name, whereCol) {
-				colIndex = i
-				break
-			}
-		}
-
-		if colIndex == -1 {
-			return fmt.Errorf("column '%s' not found in table '%s'", whereCol, tableName)
-		}
+		return nil, fmt.Errorf("table '%s' not found: %w", tableName, err)
 	}
+	txnID := versionTxnID(tx)
 
-	deleted := 0
-
-	for _, rp := range rowPtrs {
-
+	deleted := []types.Row{}
+	for _, rp := range ptrs {
 		rawRow, err := se.HeapManager.GetRow(&rp)
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("failed to read row: %w", err)
 		}
-
 		values, err := se.DeserializeRow(rawRow, schema.Columns)
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("failed to deserialize row: %w", err)
 		}
 
-		// WHERE filtering
-		if whereCol != "" {
-			val := values[colIndex]
+		if err := se.lockRow(tx, tableName, schema, values, &rp); err != nil {
+			return nil, err
+		}
+		if _, _, err := se.writableVersion(tx, rp); err != nil {
+			return nil, err
+		}
 
-			if fmt.Sprintf("%v", val) != whereVal {
-				continue
-			}
+		if err := se.fireTriggers(tx, tableName, schema, "BEFORE", "DELETE", values, nil); err != nil {
+			return nil, err
 		}
 
-		// Remove index entry
-		pkBytes, _, err := se.ExtractPrimaryKey(schema, values, &rp)
-		if err == nil && index != nil {
-			index.Delete(pkBytes)
+		// the before-image goes to the WAL ahead of the page change
+		op := &types.Operation{
+			Type:    types.OpDelete,
+			TxnID:   txnID,
+			Table:   tableName,
+			RowPtr:  rp,
+			RowData: rawRow,
+		}
+		lsn, err := se.WalManager.AppendOperation(op)
+		if err != nil {
+			return nil, err
 		}
 
-		// Delete from heap
-		if err := se.HeapManager.DeleteRow(&rp, lsn); err != nil {
-			return err
+		// the version stays for older snapshots, and so does its index entry
+		if err := se.HeapManager.SetXmax(&rp, txnID, lsn); err != nil {
+			return nil, err
+		}
+		if tx != nil {
+			pkBytes, _, err := se.ExtractPrimaryKey(schema, values, &rp)
+			if err != nil {
+				return nil, err
+			}
+			tx.RecordDelete(tableName, rp, pkBytes, op)
+		}
+		if err := se.fireTriggers(tx, tableName, schema, "AFTER", "DELETE", values, nil); err != nil {
+			return nil, err
 		}
 
-		deleted++
+		row := types.Row{Values: make(map[string]interface{}, len(values))}
+		for i, col := range schema.Columns {
+			row.Set(col.Name, values[i])
+		}
+		deleted = append(deleted, row)
 	}
 
-	fmt.Printf("Deleted %d rows from '%s'\n", deleted, tableName)
+	if err := se.WalManager.Sync(); err != nil {
+		return nil, err
+	}
 
-	return nil
+	se.CatalogManager.RecordModifications(tableName, len(deleted))
+	return deleted, nil
 }
@@ -7,15 +7,31 @@ import (
 	"path/filepath"
 )
 
+// DropTable drops a table with its heap and index files and its triggers.
 func (se *StorageEngine) DropTable(tableName string) error {
+	if err := se.dropTable(tableName); err != nil {
+		return err
+	}
+	fmt.Printf("Table '%s' dropped\n", tableName)
+	return nil
+}
 
+// dropTable is DropTable without the message, for the backing tables of
+// materialized views.
+func (se *StorageEngine) dropTable(tableName string) error {
 	if err := se.RequireDatabase(); err != nil {
 		return err
 	}
 
 	if !se.CatalogManager.TableExists(tableName) {
+		if se.CatalogManager.ViewExists(tableName) {
+			return fmt.Errorf("'%s' is a view (use DROP VIEW)", tableName)
+		}
 		return fmt.Errorf("table '%s' does not exist", tableName)
 	}
+	if err := se.checkNoDependents("table", tableName); err != nil {
+		return err
+	}
 
 	// ---------------------------
 	// WAL log
@@ -34,46 +50,48 @@ func (se *StorageEngine) DropTable(tableName string) error {
 		return fmt.Errorf("wal sync failed: %w", err)
 	}
 
+	se.forgetVersions(tableName)
+
+	// dirty pages of the table must not be written after its files are gone
+	if err := se.BufferPool.FlushAllPages(); err != nil {
+		return fmt.Errorf("failed to flush pages: %w", err)
+	}
+
 	// ---------------------------
 	// Remove heap file
 	// ---------------------------
 	fileID, err := se.CatalogManager.GetTableFileID(tableName)
 	if err == nil {
-
-		heapPath := filepath.Join(
-			se.DbRoot,
-			se.currDb,
-			"tables",
-			fmt.Sprintf("%d.heap", fileID),
-		)
-
-		_ = os.Remove(heapPath)
+		if err := se.HeapManager.DropHeapFile(fileID); err != nil {
+			// not loaded by the heap file manager: remove it directly
+			heapPath := filepath.Join(
+				se.DbRoot,
+				se.currDb,
+				"tables",
+				fmt.Sprintf("%d.heap", fileID),
+			)
+			_ = os.Remove(heapPath)
+		}
 	}
 
 	// ---------------------------
 	// Remove index file
 	// ---------------------------
-	indexFileID, err := se.CatalogManager.GetIndexFileID(tableName)
-	if err == nil {
-
-		indexPath := filepath.Join(
-			se.DbRoot,
-			se.currDb,
-			"indexes",
-			fmt.Sprintf("%d.idx", indexFileID),
-		)
-
-		_ = os.Remove(indexPath)
+	if err := se.IndexManager.DropIndex(tableName); err != nil {
+		return fmt.Errorf("failed to drop index of table '%s': %w", tableName, err)
+	}
+	if indexFileID, err := se.CatalogManager.GetIndexFileID(tableName); err == nil {
+		_ = se.DiskManager.CloseFile(indexFileID)
 	}
 
 	// ---------------------------
 	// Remove catalog metadata
 	// ---------------------------
+	if err := se.CatalogManager.RemoveTableTriggers(tableName); err != nil {
+		return err
+	}
 	if err := se.CatalogManager.UnregisterTable(tableName); err != nil {
 		return err
 	}
-
-	fmt.Printf("Table '%s' dropped\n", tableName)
-
 	return nil
 }
@@ -39,15 +39,32 @@ This is where the magic happens. A transaction is only "Real" once the WAL is sy
          ↓
     StorageEngine.InsertRow(txn, "mytable", [5])
          ├── CatalogManager.GetTableSchema("mytable")
+         ├── computeGenerated(values) → generated columns (generated_columns.go)
+         ├── BTree.Search(pkBytes) → live version: *DuplicateKeyError (ON CONFLICT handles it in the VM)
+         │                         → deleted version: Prev of the new one (mvcc.go)
          ├── SerializeRow([5], schema) → rowBytes
          ├── WAL.AllocateLSN()
-         ├── HeapManager.InsertRow(heapFileID, rowBytes, lsn)
+         ├── HeapManager.InsertRow(heapFileID, {Xmin: txn, Prev}, rowBytes, lsn)
          │       └── findSuitablePage → InsertRecord → RowPointer{file=1, page=0, slot=0}
          ├── WAL.AppendToBuffer(OpInsert, rowBytes, rowPtr)
-         ├── BTree.Insertion(pkBytes, rowPtrBytes)
-         └── txn.RecordInsert(table, rowPtr, pkBytes)
+         ├── BTree.Insertion(pkBytes, rowPtrBytes, lsn)
+         ├── txn.RecordInsert(table, rowPtr, pkBytes, op)
+         └── AFTER INSERT triggers (BEFORE INSERT ones run first of all, exec_triggers.go)
 */
 
+// DuplicateKeyError is returned by InsertRow when a row with the same primary
+// key exists; Existing points to that row.
+type DuplicateKeyError struct {
+	Table    string
+	Column   string
+	Value    any
+	Existing types.RowPointer
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key value violates primary key of '%s': %s = %v already exists", e.Table, e.Column, e.Value)
+}
+
 func (se *StorageEngine) InsertRow(txn *txn.Transaction, tableName string, values []any) error {
 	fmt.Printf("values :%+v", values)
 	// ── Step 1: Load schema ───────────────────────────────────────────────────
@@ -61,6 +78,19 @@ func (se *StorageEngine) InsertRow(txn *txn.Transaction, tableName string, value
 			len(schema.Columns), len(values))
 	}
 
+	// generated columns are computed here, in values, so the caller sees them
+	if err := computeGenerated(schema.Columns, values, false); err != nil {
+		return err
+	}
+
+	if err := se.lockRow(txn, tableName, schema, values, nil); err != nil {
+		return err
+	}
+
+	if err := se.fireTriggers(txn, tableName, schema, "BEFORE", "INSERT", nil, values); err != nil {
+		return err
+	}
+
 	// ── Step 2: Validate foreign key constraints ─────────────────────────────
 	for _, fk := range schema.ForeignKeys {
 		// Find the FK column in the schema.
@@ -89,8 +119,18 @@ func (se *StorageEngine) InsertRow(txn *txn.Transaction, tableName string, value
 			return fmt.Errorf("referenced table '%s' index not found: %w", fk.RefTable, err)
 		}
 
-		refRowPtr, err := refTree.Search(fkValueBytes)
-		if err != nil || refRowPtr == nil {
+		// a serializable transaction depends on the parent row staying
+		snap := se.readSnapshot(txn)
+		if err := se.readRow(snap, fk.RefTable, pkLockKey(fkCol.Type, fkValueBytes)); err != nil {
+			return err
+		}
+		var refRowPtr *types.RowPointer
+		if ptrBytes, err := refTree.Search(fkValueBytes); err == nil && ptrBytes != nil {
+			if refRowPtr, err = se.visibleIndexEntry(snap, ptrBytes); err != nil {
+				return err
+			}
+		}
+		if refRowPtr == nil {
 			return fmt.Errorf(
 				"foreign key constraint violation: %s.%s → %s.%s (value not found in parent)",
 				tableName, fk.Column, fk.RefTable, fk.RefColumn,
@@ -98,32 +138,59 @@ func (se *StorageEngine) InsertRow(txn *txn.Transaction, tableName string, value
 		}
 	}
 
-	// ── Step 3: Serialize row to binary format ───────────────────────────────
+	// ── Step 3: Reject a duplicate primary key ───────────────────────────────
+	// the newest version of the key decides, visible to txn or not; a deleted
+	// one is the older version of the row being inserted (mvcc.go)
+	var prev *types.RowPointer
+	for i, col := range schema.Columns {
+		if !col.IsPrimaryKey {
+			continue
+		}
+		existing, err := se.findByPrimaryKey(tableName, col, values[i])
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			var taken bool
+			prev, taken, err = se.keyPredecessor(*existing)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return &DuplicateKeyError{Table: tableName, Column: col.Name, Value: values[i], Existing: *existing}
+			}
+		}
+		break
+	}
+
+	// ── Step 4: Serialize row to binary format ───────────────────────────────
 	row, err := se.SerializeRow(schema.Columns, values)
 	if err != nil {
 		return fmt.Errorf("failed to serialize row: %w", err)
 	}
 
-	// ── Step 4: Write to WAL ──────────────────────────────────────────────────
-	var txnID uint64 = 0
-	if txn != nil {
-		txnID = txn.ID
-	}
+	// ── Step 5: Write to WAL ──────────────────────────────────────────────────
+	txnID := versionTxnID(txn)
 
 	fmt.Printf(" txid: %d", txnID)
 
 	lsn := se.WalManager.AllocateLSN(len(row))
 
-	// ── Step 5: Write to heap file ────────────────────────────────────────────
+	// ── Step 6: Write to heap file ────────────────────────────────────────────
 	fileID, err := se.CatalogManager.GetTableFileID(tableName)
 	if err != nil {
 		return fmt.Errorf("no heap file registered for table '%s': %w", tableName, err)
 	}
 	fmt.Printf("hehehehehe %d %+v %d", fileID, row, lsn)
-	rowPtr, err := se.HeapManager.InsertRow(fileID, row, lsn)
+	rowPtr, err := se.HeapManager.InsertRow(fileID, types.TupleHeader{Xmin: txnID, Prev: prev}, row, lsn)
 	if err != nil {
 		return fmt.Errorf("heap insert failed: %w", err)
 	}
+	// a row without a primary key is locked once it has a location
+	if err := se.lockRow(txn, tableName, schema, values, rowPtr); err != nil {
+		_ = se.HeapManager.DeleteRow(rowPtr, lsn)
+		return err
+	}
 
 	op := &types.Operation{
 		Type:    types.OpInsert,
@@ -131,6 +198,7 @@ func (se *StorageEngine) InsertRow(txn *txn.Transaction, tableName string, value
 		Table:   tableName,
 		RowData: row,
 		RowPtr:  *rowPtr,
+		Prev:    prev,
 	}
 
 	if err := se.WalManager.AppendToBuffer(op, lsn); err != nil {
@@ -138,7 +206,7 @@ func (se *StorageEngine) InsertRow(txn *txn.Transaction, tableName string, value
 		return fmt.Errorf("WAL buffer append failed: %w", err)
 	}
 
-	// ── Step 6: Update primary key index ──────────────────────────────────────
+	// ── Step 7: Update primary key index ──────────────────────────────────────
 	primaryKeyBytes, _, err := se.ExtractPrimaryKey(schema, values, rowPtr)
 	if err != nil {
 		_ = se.HeapManager.DeleteRow(rowPtr, lsn) // compensate
@@ -151,13 +219,14 @@ func (se *StorageEngine) InsertRow(txn *txn.Transaction, tableName string, value
 		_ = se.HeapManager.DeleteRow(rowPtr, lsn)
 		return fmt.Errorf("failed to get index for '%s': %w", tableName, err)
 	}
-	if err := btree.Insertion(primaryKeyBytes, rowPtrBytes); err != nil {
+	if err := btree.Insertion(primaryKeyBytes, rowPtrBytes, lsn); err != nil {
 		_ = se.HeapManager.DeleteRow(rowPtr, lsn)
 		return fmt.Errorf("index insert failed: %w", err)
 	}
 
 	// Record for rollback — only after both heap and index succeed
-	txn.RecordInsert(tableName, *rowPtr, primaryKeyBytes)
+	txn.RecordInsert(tableName, *rowPtr, primaryKeyBytes, op)
+	se.CatalogManager.RecordModifications(tableName, 1)
 
-	return nil
+	return se.fireTriggers(txn, tableName, schema, "AFTER", "INSERT", nil, values)
 }
@@ -0,0 +1,80 @@
+package storageengine
+
+import (
+	lock "DaemonDB/storage_engine/lock_manager"
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+	"fmt"
+	"time"
+)
+
+/*
+Locking (strict two-phase)
+
+	INSERT / DELETE of a row  → IX on the table, X on the row
+	UPDATE of a row           → IX on the table, X on its old and new key
+	COMMIT / ABORT            → every lock of the transaction released
+
+InsertRow, UpdateRow and DeleteRowsAt lock a row before they change it and
+before its triggers fire. Locks are only released by CommitTransaction and
+AbortTransaction, after the undo of an abort, so two writers of a row never
+overlap. Readers take no locks at all: a SELECT reads the row versions its
+snapshot sees (mvcc.go), so it never waits for a writer and no writer waits
+for it. A serializable transaction leaves SIREAD locks on what it reads
+(ssi.go); they block nothing and only tell later writers who read the row.
+
+Rows are named by their primary key value (so an INSERT and an UPDATE of
+the same key conflict even before the row exists) or, in tables without a
+primary key, by their location.
+*/
+
+const defaultLockTimeout = 5 * time.Second
+
+// lockTable locks tableName for tx; nothing is locked without a transaction.
+func (se *StorageEngine) lockTable(tx *txn.Transaction, tableName string, mode lock.Mode) error {
+	if tx == nil || se.LockManager == nil {
+		return nil
+	}
+	return se.LockManager.Acquire(tx.ID, lock.Resource{Table: tableName}, mode)
+}
+
+// lockRow locks the row of tableName holding values exclusively for tx, after
+// locking the table in IX. A row of a table without a primary key that has no
+// location yet (being inserted) only gets the table lock. The write is then
+// checked against the SIREAD locks of serializable readers (ssi.go).
+func (se *StorageEngine) lockRow(tx *txn.Transaction, tableName string, schema types.TableSchema, values []any, ptr *types.RowPointer) error {
+	if err := se.lockTable(tx, tableName, lock.IX); err != nil {
+		return err
+	}
+	key := rowLockKey(schema, values, ptr)
+	if tx != nil && se.LockManager != nil && key != "" {
+		if err := se.LockManager.Acquire(tx.ID, lock.Resource{Table: tableName, Row: key}, lock.X); err != nil {
+			return err
+		}
+	}
+	return se.writeConflicts(tx, tableName, key)
+}
+
+// rowLockKey names a row for the lock manager: its primary key value, as the
+// key index would store it.
+func rowLockKey(schema types.TableSchema, values []any, ptr *types.RowPointer) string {
+	for i, col := range schema.Columns {
+		if col.IsPrimaryKey {
+			if key, err := ValueToBytes(values[i], col.Type); err == nil {
+				return pkLockKey(col.Type, key)
+			}
+			return fmt.Sprint(values[i])
+		}
+	}
+	if ptr == nil {
+		return ""
+	}
+	return fmt.Sprintf("(%d,%d)", ptr.PageNumber, ptr.SlotIndex)
+}
+
+// releaseLocks releases the locks of a transaction that has ended.
+func (se *StorageEngine) releaseLocks(txnID uint64) {
+	if se.LockManager != nil {
+		se.LockManager.ReleaseAll(txnID)
+	}
+}
@@ -0,0 +1,110 @@
+package storageengine
+
+import (
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+	"fmt"
+)
+
+/*
+Savepoints and statement rollback
+
+	SAVEPOINT s            → OpSavepoint{Savepoint: s} at LSN L, t.Savepoints += {s, L, undo lengths}
+	ROLLBACK TO SAVEPOINT s → OpRollbackToSavepoint{TargetLSN: L}, undo rows recorded after
+	                          s (heap + index, an OpCLR each), savepoints after s dropped
+	RELEASE SAVEPOINT s     → OpReleaseSavepoint, s and the savepoints after it dropped
+
+A statement that fails inside an explicit transaction is rolled back the same
+way to an unnamed savepoint taken when it started; that one is not logged
+(its LSN is just the WAL position) and is only logged as a rollback if the
+statement wrote to the WAL.
+
+Every row undone is logged as a compensation record (compensation.go), so
+recovery redoes a transaction that rolled back to a savepoint and then
+committed with the rolled back part undone again.
+*/
+
+// Savepoint records a named savepoint in t.
+func (se *StorageEngine) Savepoint(t *txn.Transaction, name string) error {
+	op := &types.Operation{
+		Type:      types.OpSavepoint,
+		TxnID:     t.ID,
+		Savepoint: name,
+	}
+	lsn := se.WalManager.AllocateLSN(0)
+	if err := se.WalManager.AppendToBuffer(op, lsn); err != nil {
+		return fmt.Errorf("failed to log savepoint: %w", err)
+	}
+	t.Savepoints = append(t.Savepoints, t.Mark(name, lsn))
+	fmt.Printf("[TXN] SAVEPOINT %s txnID=%d lsn=%d\n", name, t.ID, lsn)
+	return nil
+}
+
+// RollbackToSavepoint undoes what t wrote after the savepoint called name.
+// The savepoint stays defined; the ones taken after it are dropped.
+func (se *StorageEngine) RollbackToSavepoint(t *txn.Transaction, name string) error {
+	i := t.FindSavepoint(name)
+	if i < 0 {
+		return fmt.Errorf("savepoint '%s' does not exist", name)
+	}
+	sp := t.Savepoints[i]
+	if err := se.rollbackTo(t, sp); err != nil {
+		return err
+	}
+	t.Savepoints = t.Savepoints[:i+1]
+	return nil
+}
+
+// ReleaseSavepoint forgets the savepoint called name and the ones taken
+// after it, keeping what was written since.
+func (se *StorageEngine) ReleaseSavepoint(t *txn.Transaction, name string) error {
+	i := t.FindSavepoint(name)
+	if i < 0 {
+		return fmt.Errorf("savepoint '%s' does not exist", name)
+	}
+	op := &types.Operation{
+		Type:      types.OpReleaseSavepoint,
+		TxnID:     t.ID,
+		Savepoint: name,
+		TargetLSN: t.Savepoints[i].LSN,
+	}
+	lsn := se.WalManager.AllocateLSN(0)
+	if err := se.WalManager.AppendToBuffer(op, lsn); err != nil {
+		return fmt.Errorf("failed to log savepoint release: %w", err)
+	}
+	t.Savepoints = t.Savepoints[:i]
+	return nil
+}
+
+// StatementSavepoint returns the unnamed savepoint a statement of t can be
+// rolled back to if it fails.
+func (se *StorageEngine) StatementSavepoint(t *txn.Transaction) txn.Savepoint {
+	return t.Mark("", se.WalManager.GetCurrentLSN())
+}
+
+// RollbackStatement undoes what the failed statement started at sp wrote.
+func (se *StorageEngine) RollbackStatement(t *txn.Transaction, sp txn.Savepoint) error {
+	if se.WalManager.GetCurrentLSN() == sp.LSN {
+		return nil // nothing written
+	}
+	return se.rollbackTo(t, sp)
+}
+
+// rollbackTo logs the rollback to sp, then undoes the rows written after it.
+func (se *StorageEngine) rollbackTo(t *txn.Transaction, sp txn.Savepoint) error {
+	op := &types.Operation{
+		Type:      types.OpRollbackToSavepoint,
+		TxnID:     t.ID,
+		Savepoint: sp.Name,
+		TargetLSN: sp.LSN,
+	}
+	lsn := se.WalManager.AllocateLSN(0)
+	if err := se.WalManager.AppendToBuffer(op, lsn); err != nil {
+		return fmt.Errorf("failed to log rollback to savepoint: %w", err)
+	}
+
+	fmt.Printf("[TXN] ROLLBACK TO %q txnID=%d insertedRows=%d updatedRows=%d\n", sp.Name, t.ID,
+		len(t.InsertedRows)-sp.Inserted, len(t.UpdatedRows)-sp.Updated)
+
+	return se.undoSince(t, sp)
+}
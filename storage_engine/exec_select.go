@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	txn "DaemonDB/storage_engine/transaction_manager"
 	"DaemonDB/types"
 )
 
@@ -13,26 +14,168 @@ It works for both normal select query (with or without a filter) and also for se
 
 Returns:
 
-	rows: slice of row maps (keys are qualified column names: "table.column")
+	rows: slice of row maps (keys are column names; with joins "alias.column")
 	columns: ordered list of column names to display
 
 
 	SQL: SELECT * FROM mytable WHERE id = 5
 	     ↓
-	StorageEngine.ExecuteSelect
+	StorageEngine.ExecuteSelect → constant folding (rewrite.go)
 	     ├── [PK column] → BTree.Search(pkBytes) → rowPtrBytes
 	     │       └── HeapManager.GetRow(rowPtr) → rowBytes → deserialize → result
-	     └── [non-PK column] → GetAllRowPointers → for each: GetRow → filter → result
+	     ├── [non-PK column] → GetAllRowPointers → for each: GetRow → filter → result
+	     └── [JOINs] → executeSelectWithJoin (join_plan.go) → rewrite → join → filter → result
+	     ↓
+	semi / anti joins for decorrelated IN and EXISTS subqueries (subquery.go)
+	     ↓
+	window functions (window.go)
+	     ↓
+	projectAndSort → ORDER BY, then evaluate the select list
+
+Every step also returns the operator it ran as a plan node, with its estimated
+and actual rows, time and buffer pool traffic, for EXPLAIN ANALYZE (explain.go).
 */
-func (se *StorageEngine) ExecuteSelect(payload types.SelectPayload) ([]map[string]interface{}, []string, error) {
-	if payload.JoinTable != "" {
-		return se.executeSelectWithJoin(payload)
+func (se *StorageEngine) ExecuteSelect(tx *txn.Transaction, payload types.SelectPayload) ([]map[string]interface{}, []string, error) {
+	rows, columns, _, err := se.executeSelect(se.readSnapshot(tx), payload)
+	return rows, columns, err
+}
+
+// executeSelect executes a SELECT and returns its rows, columns and plan.
+func (se *StorageEngine) executeSelect(snap *txn.Snapshot, payload types.SelectPayload) ([]map[string]interface{}, []string, *types.PlanNode, error) {
+	foldSelect(&payload)
+	var needed map[string]bool
+	if len(payload.Joins) > 0 {
+		needed = neededColumns(&payload)
 	}
-	return se.executeSimpleSelect(payload)
+
+	semiJoins, err := se.planSubqueries(snap, &payload)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var rows []map[string]interface{}
+	var columns []string
+	var plan *types.PlanNode
+	switch {
+	case payload.WorkTable != "":
+		rows, columns, plan, err = se.readWorkTable(payload)
+	case payload.SystemTable != "":
+		rows, columns, plan, err = se.readSystemTable(payload)
+	case payload.Recursive != "":
+		rows, columns, plan, err = se.executeRecursive(snap, payload)
+	case payload.SetOp != nil:
+		rows, columns, plan, err = se.executeSetOperation(snap, payload.SetOp)
+	case len(payload.Joins) > 0:
+		rows, columns, plan, err = se.executeSelectWithJoin(snap, payload, needed)
+	case payload.FromSubquery != nil:
+		rows, columns, plan, err = se.executeDerivedSelect(snap, payload)
+	default:
+		if plan, err = se.simpleSelectPlan(payload); err != nil {
+			return nil, nil, nil, err
+		}
+		m := se.startOp()
+		rows, columns, err = se.executeSimpleSelect(snap, payload)
+		se.finishOp(plan, m, len(rows))
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, sj := range semiJoins {
+		if rows, plan, err = se.applySemiJoin(snap, rows, plan, sj); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	query := payload
+	payload, windows := extractWindows(payload)
+	for _, group := range windows {
+		m := se.startOp()
+		spilled, err := se.computeWindow(rows, group)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		out := se.windowNode(plan, group)
+		se.finishOp(out, m, len(rows), plan)
+		spilled.record(out)
+		plan = out
+	}
+
+	m := se.startOp()
+	rows, columns, err = se.projectAndSort(rows, columns, payload)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if out := outputNode(plan, query); out != plan {
+		se.finishOp(out, m, len(rows), plan)
+		plan = out
+	}
+
+	if payload.Distinct {
+		m := se.startOp()
+		var spilled spillStats
+		if rows, spilled, err = se.distinctRows(rows, columns); err != nil {
+			return nil, nil, nil, err
+		}
+		out := se.distinctNode(plan)
+		se.finishOp(out, m, len(rows), plan)
+		spilled.record(out)
+		plan = out
+	}
+
+	if len(payload.OutputNames) > 0 {
+		if rows, columns, err = renameRows(rows, columns, payload.OutputNames); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return rows, columns, plan, nil
+}
+
+// renameRows renames the columns of rows to names, by position.
+func renameRows(rows []map[string]interface{}, columns, names []string) ([]map[string]interface{}, []string, error) {
+	if len(names) != len(columns) {
+		return nil, nil, fmt.Errorf("query has %d columns but %d column names were given", len(columns), len(names))
+	}
+	if strings.Join(names, ",") == strings.Join(columns, ",") {
+		return rows, columns, nil
+	}
+	renamed := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		renamed[i] = make(map[string]interface{}, len(names))
+		for j, col := range columns {
+			renamed[i][names[j]] = row[col]
+		}
+	}
+	return renamed, names, nil
+}
+
+// executeDerivedSelect handles FROM (SELECT ...) alias: the inner query is
+// materialized and filtered by the outer WHERE clause.
+func (se *StorageEngine) executeDerivedSelect(snap *txn.Snapshot, payload types.SelectPayload) ([]map[string]interface{}, []string, *types.PlanNode, error) {
+	m := se.startOp()
+	innerRows, columns, innerPlan, err := se.executeSelect(snap, *payload.FromSubquery)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("subquery %s: %w", payload.Alias, err)
+	}
+
+	rows := make([]map[string]interface{}, 0, len(innerRows))
+	for _, row := range innerRows {
+		match, err := se.matchWhere(payload, row)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if match {
+			rows = append(rows, row)
+		}
+	}
+
+	plan := derivedNode(payload.Alias, innerPlan, payload.WhereExpr)
+	se.finishOp(plan, m, len(rows))
+	return rows, columns, plan, nil
 }
 
 // executeSimpleSelect handles single-table SELECT.
-func (se *StorageEngine) executeSimpleSelect(payload types.SelectPayload) ([]map[string]interface{}, []string, error) {
+func (se *StorageEngine) executeSimpleSelect(snap *txn.Snapshot, payload types.SelectPayload) ([]map[string]interface{}, []string, error) {
 	tableName := payload.Table
 	if tableName == "" {
 		return nil, nil, fmt.Errorf("table name missing in SELECT payload")
@@ -50,91 +193,105 @@ func (se *StorageEngine) executeSimpleSelect(payload types.SelectPayload) ([]map
 		columns = append(columns, col.Name)
 	}
 
-	// ── Step 3: WHERE clause with primary key (index lookup) ─────────────────
-	if payload.WhereCol != "" {
-		// Find the PK column in schema.
-		pkColIdx := -1
-		var pkCol types.ColumnDef
-		for i, col := range schema.Columns {
-			if strings.EqualFold(col.Name, payload.WhereCol) && col.IsPrimaryKey {
-				pkColIdx = i
-				pkCol = col
-				break
+	// ── Step 3: WHERE clause — pick an index access path if one applies ──────
+	if payload.WhereExpr != nil {
+		path := se.chooseAccessPath(payload.From().Name(), schema, payload.WhereExpr)
+		switch path.kind {
+		case accessPKPoints:
+			return se.selectWithPKKeys(snap, tableName, schema, payload, columns, path.keys)
+		case accessPKPrefix, accessPKRange:
+			btree, err := se.GetIndex(tableName)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get index: %w", err)
 			}
+			if err := se.readPath(snap, tableName, schema, path); err != nil {
+				return nil, nil, err
+			}
+			rowPtrs, err := se.pathRowPointers(btree, path)
+			if err != nil {
+				return nil, nil, err
+			}
+			return se.selectByRowPointers(snap, schema, payload, columns, rowPtrs)
 		}
-
-		if pkColIdx != -1 {
-			fmt.Print("pk lookup\n")
-			return se.selectWithPKLookup(tableName, schema, payload, columns, pkCol)
-		}
-		fmt.Print("full scan lookup\n")
-		// Non-PK WHERE — full scan with filter.
-		return se.selectFullScanWithFilter(tableName, schema, payload, columns)
+		return se.selectFullScanWithFilter(snap, tableName, schema, payload, columns)
 	}
-
 	// ── Step 4: Full table scan ──────────────────────────────────────────────
-	return se.selectFullScan(tableName, schema, columns)
+	return se.selectFullScan(snap, tableName, schema, columns)
 }
 
-// selectWithPKLookup performs a point lookup via the primary key index.
-func (se *StorageEngine) selectWithPKLookup(tableName string, schema types.TableSchema, payload types.SelectPayload, columns []string, pkCol types.ColumnDef) ([]map[string]interface{}, []string, error) {
-
-	// Encode the WHERE value as bytes.
-	pkBytes, err := ValueToBytes([]byte(payload.WhereVal), pkCol.Type)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to encode WHERE value: %w", err)
-	}
-
-	// Look up in the index.
+// selectWithPKKeys performs one index lookup per key (=, IN lists).
+func (se *StorageEngine) selectWithPKKeys(snap *txn.Snapshot, tableName string, schema types.TableSchema, payload types.SelectPayload, columns []string, keys [][]byte) ([]map[string]interface{}, []string, error) {
 	btree, err := se.GetIndex(tableName)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get index: %w", err)
 	}
 
-	rowPtrBytes, err := btree.Search(pkBytes)
-	if err != nil {
-		return nil, nil, fmt.Errorf("index search failed: %w", err)
+	if err := se.readKeys(snap, tableName, schema, keys); err != nil {
+		return nil, nil, err
 	}
-	if rowPtrBytes == nil {
-		// Not found — return empty result.
-		return []map[string]interface{}{}, columns, nil
-	}
-
 	fmt.Println("[B+ Tree Search for PkBytes]")
-	// Deserialize RowPointer.
-	rowPtr, err := se.DeserializeRowPointer(rowPtrBytes)
+	rowPtrs, err := se.lookupRowPointers(btree, keys)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to decode row pointer: %w", err)
+		return nil, nil, err
 	}
+	return se.selectByRowPointers(snap, schema, payload, columns, rowPtrs)
+}
 
-	rawRow, err := se.HeapManager.GetRow(&rowPtr)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read row: %w", err)
-	}
+// selectByRowPointers fetches the rows found through the index and applies
+// the full WHERE clause to them.
+func (se *StorageEngine) selectByRowPointers(snap *txn.Snapshot, schema types.TableSchema, payload types.SelectPayload, columns []string, rowPtrs [][]byte) ([]map[string]interface{}, []string, error) {
+	rows := []map[string]interface{}{}
 
-	// Deserialize the row.
-	values, err := se.DeserializeRow(rawRow, schema.Columns)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to deserialize row: %w", err)
-	}
+	for _, rowPtrBytes := range rowPtrs {
+		// Deserialize RowPointer, and find the version the snapshot sees.
+		rowPtr, err := se.visibleIndexEntry(snap, rowPtrBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode row pointer: %w", err)
+		}
+		if rowPtr == nil {
+			continue
+		}
+
+		rawRow, err := se.HeapManager.GetRow(rowPtr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read row: %w", err)
+		}
+
+		// Deserialize the row.
+		values, err := se.DeserializeRow(rawRow, schema.Columns)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to deserialize row: %w", err)
+		}
+
+		// Build the result map.
+		rowMap := make(map[string]interface{})
+		for i, col := range schema.Columns {
+			rowMap[col.Name] = values[i]
+		}
 
-	// Build the result map.
-	rowMap := make(map[string]interface{})
-	for i, col := range schema.Columns {
-		rowMap[col.Name] = values[i]
+		match, err := se.matchWhere(payload, rowMap)
+		if err != nil {
+			return nil, nil, err
+		}
+		if match {
+			rows = append(rows, rowMap)
+		}
 	}
 
-	return []map[string]interface{}{rowMap}, columns, nil
+	return rows, columns, nil
 }
 
 // selectFullScan scans all rows in the table.
-func (se *StorageEngine) selectFullScan(tableName string, schema types.TableSchema, columns []string) ([]map[string]interface{}, []string, error) {
+func (se *StorageEngine) selectFullScan(snap *txn.Snapshot, tableName string, schema types.TableSchema, columns []string) ([]map[string]interface{}, []string, error) {
 	hf, err := se.HeapManager.GetHeapFileByTable(tableName)
 	if err != nil {
 		return nil, nil, fmt.Errorf("heap file not found: %w", err)
 	}
 
-	rowPtrs := hf.GetAllRowPointers()
+	rowPtrs, err := se.visibleRowPointers(snap, tableName, hf.GetAllRowPointers())
+	if err != nil {
+		return nil, nil, err
+	}
 	if len(rowPtrs) == 0 {
 		return []map[string]interface{}{}, columns, nil
 	}
@@ -162,20 +319,7 @@ func (se *StorageEngine) selectFullScan(tableName string, schema types.TableSche
 	return rows, columns, nil
 }
 
-func (se *StorageEngine) selectFullScanWithFilter(tableName string, schema types.TableSchema, payload types.SelectPayload, columns []string) ([]map[string]interface{}, []string, error) {
-
-	// Find WHERE column in schema for type info.
-	var whereCol *types.ColumnDef
-	for _, col := range schema.Columns {
-		if strings.EqualFold(col.Name, payload.WhereCol) {
-			c := col
-			whereCol = &c
-			break
-		}
-	}
-	if whereCol == nil {
-		return nil, nil, fmt.Errorf("column '%s' not found in table '%s'", payload.WhereCol, tableName)
-	}
+func (se *StorageEngine) selectFullScanWithFilter(snap *txn.Snapshot, tableName string, schema types.TableSchema, payload types.SelectPayload, columns []string) ([]map[string]interface{}, []string, error) {
 
 	// Get heap file — same as selectFullScan.
 	hf, err := se.HeapManager.GetHeapFileByTable(tableName)
@@ -183,7 +327,10 @@ func (se *StorageEngine) selectFullScanWithFilter(tableName string, schema types
 		return nil, nil, fmt.Errorf("heap file not found: %w", err)
 	}
 
-	rowPtrs := hf.GetAllRowPointers()
+	rowPtrs, err := se.visibleRowPointers(snap, tableName, hf.GetAllRowPointers())
+	if err != nil {
+		return nil, nil, err
+	}
 	rows := make([]map[string]interface{}, 0)
 
 	for _, rp := range rowPtrs {
@@ -197,107 +344,64 @@ func (se *StorageEngine) selectFullScanWithFilter(tableName string, schema types
 			continue
 		}
 
-		// Find WHERE column value and compare.
-		for i, col := range schema.Columns {
-			if strings.EqualFold(col.Name, payload.WhereCol) {
-				if fmt.Sprintf("%v", values[i]) == payload.WhereVal {
-					rowMap := make(map[string]interface{})
-					for j, c := range schema.Columns {
-						rowMap[c.Name] = values[j]
-					}
-					rows = append(rows, rowMap)
-				}
-				break
-			}
+		rowMap := make(map[string]interface{})
+		for j, c := range schema.Columns {
+			rowMap[c.Name] = values[j]
+		}
+
+		match, err := se.matchWhere(payload, rowMap)
+		if err != nil {
+			return nil, nil, err
+		}
+		if match {
+			rows = append(rows, rowMap)
 		}
 	}
 
 	return rows, columns, nil
 }
 
-// executeSelectWithJoin handles JOIN queries.
-func (se *StorageEngine) executeSelectWithJoin(payload types.SelectPayload) ([]map[string]interface{}, []string, error) {
-	// Load left table.
-	leftRows, leftSchema, err := se.loadTableRows(payload.Table)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to load left table: %w", err)
+// matchWhere evaluates the WHERE clause of payload against one row; every
+// row matches when there is none.
+func (se *StorageEngine) matchWhere(payload types.SelectPayload, row map[string]interface{}) (bool, error) {
+	if payload.WhereExpr == nil {
+		return true, nil
 	}
-
-	// Load right table.
-	rightRows, rightSchema, err := se.loadTableRows(payload.JoinTable)
+	match, err := types.EvalPredicate(payload.WhereExpr, row)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to load right table: %w", err)
-	}
-
-	// Resolve column keys (prefix with table name if not already qualified).
-	resolveKey := func(table, col string) string {
-		if strings.Contains(col, ".") {
-			return col
-		}
-		return table + "." + col
-	}
-
-	leftKey := resolveKey(payload.Table, payload.LeftCol)
-	rightKey := resolveKey(payload.JoinTable, payload.RightCol)
-
-	// Sort both sides by join key.
-	se.sortRowsByColumn(leftRows, leftKey)
-	se.sortRowsByColumn(rightRows, rightKey)
-
-	// Perform the join.
-	var joinedRows []map[string]interface{}
-	switch strings.ToUpper(payload.JoinType) {
-	case "INNER", "":
-		joinedRows = se.mergeSortInnerJoin(leftRows, rightRows, leftKey, rightKey)
-	case "LEFT":
-		joinedRows = se.mergeSortOuterJoin(leftRows, rightRows, leftKey, rightKey)
-	case "RIGHT":
-		joinedRows = se.mergeSortOuterJoin(rightRows, leftRows, rightKey, leftKey)
-	case "FULL":
-		joinedRows = se.mergeSortFullJoin(leftRows, rightRows, leftKey, rightKey)
-	default:
-		return nil, nil, fmt.Errorf("unsupported join type: %s", payload.JoinType)
-	}
-
-	// Apply WHERE filter if present.
-	if payload.WhereCol != "" {
-		whereKey := payload.WhereCol
-		if !strings.Contains(whereKey, ".") {
-			whereKey = payload.Table + "." + payload.WhereCol
-		}
-		joinedRows = se.filterJoinedRows(joinedRows, whereKey, payload.WhereVal)
+		return false, fmt.Errorf("error evaluating WHERE: %w", err)
 	}
+	return match, nil
+}
 
-	// Determine display columns.
-	displayCols := payload.Columns
-	if len(displayCols) == 0 || (len(displayCols) == 1 && displayCols[0] == "*") {
-		displayCols = []string{}
-		for _, col := range leftSchema.Columns {
-			displayCols = append(displayCols, payload.Table+"."+col.Name)
-		}
-		for _, col := range rightSchema.Columns {
-			displayCols = append(displayCols, payload.JoinTable+"."+col.Name)
-		}
+// loadTableRows loads the rows of a table as maps keyed "refName.column",
+// holding only the keys in keep (nil: every column). filter (if any) is applied
+// to every row, and picks an index access path when it can.
+func (se *StorageEngine) loadTableRows(snap *txn.Snapshot, tableName, refName string, keep map[string]bool, filter *types.ExpressionNode) ([]map[string]interface{}, error) {
+	rows := []map[string]interface{}{}
+	err := se.scanTableRows(snap, tableName, refName, keep, filter, func(row map[string]interface{}) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	return joinedRows, displayCols, nil
+	return rows, nil
 }
 
-// loadTableRows loads all rows from a table as maps.
-func (se *StorageEngine) loadTableRows(tableName string) ([]map[string]interface{}, types.TableSchema, error) {
+// scanTableRows is loadTableRows calling emit with every row as it is read,
+// for consumers that do not keep them all.
+func (se *StorageEngine) scanTableRows(snap *txn.Snapshot, tableName, refName string, keep map[string]bool, filter *types.ExpressionNode, emit func(map[string]interface{}) error) error {
 	schema, err := se.CatalogManager.GetTableSchema(tableName)
 	if err != nil {
-		return nil, types.TableSchema{}, err
+		return err
 	}
 
-	hf, err := se.HeapManager.GetHeapFileByTable(tableName)
+	rowPtrs, err := se.tableRowPointers(snap, tableName, refName, schema, filter)
 	if err != nil {
-		return nil, types.TableSchema{}, err
+		return err
 	}
 
-	rowPtrs := hf.GetAllRowPointers()
-	rows := make([]map[string]interface{}, 0, len(rowPtrs))
-
 	for _, rp := range rowPtrs {
 		rawRow, err := se.HeapManager.GetRow(&rp)
 		if err != nil {
@@ -311,11 +415,67 @@ func (se *StorageEngine) loadTableRows(tableName string) ([]map[string]interface
 
 		rowMap := make(map[string]interface{})
 		for i, col := range schema.Columns {
-			// Qualify column names with table name for join.
-			rowMap[tableName+"."+col.Name] = values[i]
+			// Qualify column names with the table name (or alias) for join.
+			key := refName + "." + col.Name
+			if keep == nil || keep[key] {
+				rowMap[key] = values[i]
+			}
 		}
-		rows = append(rows, rowMap)
+
+		if filter != nil {
+			match, err := types.EvalPredicate(filter, rowMap)
+			if err != nil {
+				return fmt.Errorf("error evaluating WHERE: %w", err)
+			}
+			if !match {
+				continue
+			}
+		}
+		if err := emit(rowMap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableRowPointers returns the row pointers of the rows of a table that may
+// satisfy filter: found through the primary key index when filter allows it,
+// else every row. They point at the versions the snapshot sees (mvcc.go).
+func (se *StorageEngine) tableRowPointers(snap *txn.Snapshot, tableName, refName string, schema types.TableSchema, filter *types.ExpressionNode) ([]types.RowPointer, error) {
+	var ptrBytes [][]byte
+	if filter != nil {
+		path := se.chooseAccessPath(refName, schema, filter)
+		if path.kind != accessFullScan {
+			btree, err := se.GetIndex(tableName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get index: %w", err)
+			}
+			if err := se.readPath(snap, tableName, schema, path); err != nil {
+				return nil, err
+			}
+			if ptrBytes, err = se.pathRowPointers(btree, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if ptrBytes == nil {
+		hf, err := se.HeapManager.GetHeapFileByTable(tableName)
+		if err != nil {
+			return nil, err
+		}
+		return se.visibleRowPointers(snap, tableName, hf.GetAllRowPointers())
 	}
 
-	return rows, schema, nil
+	rowPtrs := make([]types.RowPointer, 0, len(ptrBytes))
+	for _, b := range ptrBytes {
+		rp, err := se.visibleIndexEntry(snap, b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode row pointer: %w", err)
+		}
+		if rp != nil {
+			rowPtrs = append(rowPtrs, *rp)
+		}
+	}
+	return rowPtrs, nil
 }
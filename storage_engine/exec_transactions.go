@@ -1,9 +1,12 @@
 package storageengine
 
 import (
+	bplus "DaemonDB/storage_engine/access/indexfile_manager/bplustree"
+	checkpoint "DaemonDB/storage_engine/checkpoint_manager"
 	txn "DaemonDB/storage_engine/transaction_manager"
 	"DaemonDB/types"
 	"fmt"
+	"sort"
 )
 
 // Transaction WAL logging methods
@@ -11,15 +14,15 @@ import (
 They write OpTxnBegin/Commit/Abort records to the WAL and sync.
 */
 
-// LogTransactionBegin writes an OpTxnBegin record to the WAL.
+// LogTransactionBegin writes an OpTxnBegin record to the WAL and returns its LSN.
 // Called by VM.autoTransactionBegin after TxnManager.Begin().
-func (se *StorageEngine) LogTransactionBegin(txnID uint64) error {
+func (se *StorageEngine) LogTransactionBegin(txnID uint64) (uint64, error) {
 	op := &types.Operation{
 		Type:  types.OpTxnBegin,
 		TxnID: txnID,
 	}
 	lsn := se.WalManager.AllocateLSN(0)
-	return se.WalManager.AppendToBuffer(op, lsn)
+	return lsn, se.WalManager.AppendToBuffer(op, lsn)
 }
 
 // LogTransactionCommit writes an OpTxnCommit record to the WAL.
@@ -54,34 +57,92 @@ func (se *StorageEngine) LogTransactionAbort(txnID uint64) error {
 // background thread, or after N transactions, or after N bytes written to WAL.
 //
 // For now, we checkpoint after every auto-committed transaction.
+//
+// The WAL is synced and the dirty pages flushed first, so every change logged
+// before the checkpoint LSN is on disk. The transactions still running are
+// saved with it: recovery may have to undo what they wrote before it.
 func (se *StorageEngine) SaveCheckpoint() error {
 	if se.CheckpointManager == nil || se.WalManager == nil {
 		return nil // checkpointing not enabled
 	}
 
 	currentLSN := se.WalManager.GetCurrentLSN()
-	fmt.Printf("[Checkpoint] Saving at LSN=%d db=%s\n", currentLSN, se.currDb)
+	if err := se.WalManager.Sync(); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	if err := se.BufferPool.FlushAllPages(); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
 
-	return se.CheckpointManager.SaveCheckpoint(currentLSN, se.currDb)
+	var active []checkpoint.ActiveTxn
+	if se.TxnManager != nil {
+		for _, t := range se.TxnManager.ActiveTransactions() {
+			active = append(active, checkpoint.ActiveTxn{ID: t.ID, BeginLSN: t.BeginLSN})
+		}
+	}
+	fmt.Printf("[Checkpoint] Saving at LSN=%d db=%s active=%d\n", currentLSN, se.currDb, len(active))
+
+	return se.CheckpointManager.SaveCheckpoint(currentLSN, se.currDb, active)
 }
 
 // ── Transaction state management wrappers ─────────────────────────────────────
 // These delegate to TxnManager so the VM doesn't need direct access to it.
 
-// BeginTransaction starts a new transaction and returns it.
-func (se *StorageEngine) BeginTransaction() (*txn.Transaction, error) {
-	t := se.TxnManager.Begin()
+// BeginTransaction starts a new transaction at isolation level and returns it.
+func (se *StorageEngine) BeginTransaction(level txn.IsolationLevel) (*txn.Transaction, error) {
+	t, err := se.TxnManager.Begin(level)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
 
-	fmt.Printf("[TXN] BEGIN txnID=%d\n", t.ID)
-	if err := se.LogTransactionBegin(t.ID); err != nil {
+	fmt.Printf("[TXN] BEGIN txnID=%d isolation=%s\n", t.ID, level)
+	if t.BeginLSN, err = se.LogTransactionBegin(t.ID); err != nil {
 		return nil, fmt.Errorf("failed to log transaction begin: %w", err)
 	}
+	se.registerSerializable(t)
 	return t, nil
 }
 
+// SetIsolationLevel changes the isolation level of t, which has not run a
+// statement yet, and takes its snapshot again.
+func (se *StorageEngine) SetIsolationLevel(t *txn.Transaction, level txn.IsolationLevel) {
+	if t.Isolation == level {
+		return
+	}
+	if t.Isolation == txn.Serializable && se.SSIManager != nil {
+		se.SSIManager.Release(t.ID)
+	}
+	t.Isolation = level
+	se.TxnManager.RefreshSnapshot(t)
+	se.registerSerializable(t)
+	fmt.Printf("[TXN] txnID=%d isolation=%s\n", t.ID, level)
+}
+
+// StatementStart gives t a new snapshot before each of its statements under
+// READ COMMITTED.
+func (se *StorageEngine) StatementStart(t *txn.Transaction) {
+	if t.Isolation == txn.ReadCommitted {
+		se.TxnManager.RefreshSnapshot(t)
+	}
+}
+
 // CommitTransaction marks a transaction as committed in the TxnManager.
 // Called AFTER LogTransactionCommit has synced the WAL record.
+//
+// A serializable transaction that can not commit without breaking
+// serializability is rolled back instead, and the error is a serialization
+// failure (ssi.go).
 func (se *StorageEngine) CommitTransaction(txnID uint64) error {
+	if se.SSIManager != nil {
+		if err := se.SSIManager.Commit(txnID); err != nil {
+			if t := se.TxnManager.GetTransaction(txnID); t != nil {
+				if abortErr := se.AbortTransaction(t); abortErr != nil {
+					return fmt.Errorf("%w (rollback failed: %v)", err, abortErr)
+				}
+			}
+			return err
+		}
+	}
 
 	fmt.Printf("[TXN] COMMIT txnID=%d\n", txnID)
 	if err := se.LogTransactionCommit(txnID); err != nil {
@@ -102,7 +163,16 @@ func (se *StorageEngine) CommitTransaction(txnID uint64) error {
 		fmt.Printf("warning: buffer pool flush failed after commit: %v\n", err)
 	}
 
-	return se.TxnManager.Commit(txnID)
+	// strict 2PL: the locks go only once the commit is durable
+	defer se.releaseLocks(txnID)
+	defer se.forgetTriggerRunner(txnID)
+	t := se.TxnManager.GetTransaction(txnID)
+	if err := se.TxnManager.Commit(txnID); err != nil {
+		return err
+	}
+	// the versions it replaced or deleted are pruned once no snapshot needs them
+	se.retireVersions(t)
+	return nil
 }
 
 // AbortTransaction marks a transaction as aborted in the TxnManager.
@@ -111,58 +181,69 @@ func (se *StorageEngine) AbortTransaction(t *txn.Transaction) error {
 	if t == nil {
 		return fmt.Errorf("AbortTransaction: nil transaction")
 	}
+	// the locks are held until the writes are undone
+	defer se.releaseLocks(t.ID)
+	defer se.forgetTriggerRunner(t.ID)
+	if se.SSIManager != nil {
+		defer se.SSIManager.Release(t.ID)
+	}
 
-	fmt.Printf("[TXN] ABORT txnID=%d insertedRows=%d updatedRows=%d\n", t.ID, len(t.InsertedRows), len(t.UpdatedRows))
+	fmt.Printf("[TXN] ABORT txnID=%d insertedRows=%d updatedRows=%d deletedRows=%d\n", t.ID, len(t.InsertedRows), len(t.UpdatedRows), len(t.DeletedRows))
 
 	if err := se.LogTransactionAbort(t.ID); err != nil {
 		return err
 	}
 
-	abortLSN := se.WalManager.GetCurrentLSN()
-
-	// Undo updates first (reverse order — last write first)
-	for i := len(t.UpdatedRows) - 1; i >= 0; i-- {
-		u := t.UpdatedRows[i]
-		rp := u.NewRowPtr
-
-		if err := se.HeapManager.UpdateRow(&rp, u.OldRowData, abortLSN); err != nil {
-			return fmt.Errorf("rollback: restore updated row failed (table=%s page=%d slot=%d): %w",
-				u.Table, rp.PageNumber, rp.SlotIndex, err)
-		}
+	if err := se.undoSince(t, txn.Savepoint{}); err != nil {
+		return err
+	}
+	// the compensation records reach the disk before the pages they changed
+	if err := se.WalManager.Sync(); err != nil {
+		return err
+	}
 
-		idx, err := se.GetIndex(u.Table)
-		if err != nil {
-			return fmt.Errorf("rollback: index open failed (table=%s): %w", u.Table, err)
-		}
-		idx.Delete(u.PrimaryKey)
-		oldPtrBytes := se.SerializeRowPointer(u.OldRowPtr)
-		if err := idx.Insertion(u.PrimaryKey, oldPtrBytes); err != nil {
-			return fmt.Errorf("rollback: index reinsert failed (table=%s): %w", u.Table, err)
-		}
+	if err := se.BufferPool.FlushAllPages(); err != nil {
+		fmt.Printf("warning: buffer pool flush failed after abort: %v\n", err)
 	}
 
-	// Undo inserts (reverse order)
-	for i := len(t.InsertedRows) - 1; i >= 0; i-- {
-		ins := t.InsertedRows[i]
-		rp := ins.RowPtr
+	if err := se.TxnManager.Abort(t.ID); err != nil {
+		return err
+	}
+	// its snapshot may have been the one holding back pruning
+	se.pruneVersions()
+	return nil
+}
 
-		if err := se.HeapManager.DeleteRow(&rp, abortLSN); err != nil {
-			return fmt.Errorf("rollback: delete inserted row failed (table=%s page=%d slot=%d): %w",
-				ins.Table, rp.PageNumber, rp.SlotIndex, err)
-		}
+// undoSince undoes the rows t wrote after sp (heap + index), last write
+// first, each with a compensation record (compensation.go), and forgets them.
+func (se *StorageEngine) undoSince(t *txn.Transaction, sp txn.Savepoint) error {
+	var records []*types.Operation
+	for _, ins := range t.InsertedRows[sp.Inserted:] {
+		records = append(records, ins.Record)
+	}
+	for _, u := range t.UpdatedRows[sp.Updated:] {
+		records = append(records, u.Record)
+	}
+	for _, d := range t.DeletedRows[sp.Deleted:] {
+		records = append(records, d.Record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].LSN > records[j].LSN })
 
-		idx, err := se.GetIndex(ins.Table)
-		if err != nil {
-			return fmt.Errorf("rollback: index open failed (table=%s): %w", ins.Table, err)
+	for _, op := range records {
+		if err := se.compensate(op); err != nil {
+			return fmt.Errorf("rollback: %w", err)
 		}
-		idx.Delete(ins.PrimaryKey)
-
-		fmt.Printf("[TXN] ABORT undid insert table=%s page=%d slot=%d\n", ins.Table, rp.PageNumber, rp.SlotIndex)
 	}
 
-	if err := se.BufferPool.FlushAllPages(); err != nil {
-		fmt.Printf("warning: buffer pool flush failed after abort: %v\n", err)
-	}
+	t.Truncate(sp)
+	return nil
+}
 
-	return se.TxnManager.Abort(t.ID)
+// restoreIndexEntry points key back at prev, the version a removed one had
+// replaced, or removes it when there was none, for the change logged at lsn.
+func (se *StorageEngine) restoreIndexEntry(idx *bplus.BPlusTree, key []byte, prev *types.RowPointer, lsn uint64) error {
+	if prev == nil {
+		return idx.Delete(key, lsn)
+	}
+	return idx.Insertion(key, se.SerializeRowPointer(*prev), lsn)
 }
@@ -0,0 +1,126 @@
+package storageengine
+
+import (
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+	"fmt"
+	"strings"
+)
+
+/*
+This file contains row-level triggers
+
+	CREATE TRIGGER name {BEFORE|AFTER} {INSERT|UPDATE|DELETE} ON t FOR EACH ROW body
+	     ↓
+	catalog entry (triggers.json)
+	     ↓
+	InsertRow / UpdateRow / DeleteRowsAt on t
+	     ├── BEFORE triggers (before the row is written)
+	     ├── heap + index + WAL
+	     └── AFTER triggers
+
+The storage engine cannot run SQL itself: the VM that begins a transaction
+registers a TriggerRunner for it, which compiles the body with NEW / OLD bound
+to the row and executes it in that transaction. Each session's triggers thus run
+in its own VM, however many VMs share the engine; the runner goes with the
+transaction's end. An error from a trigger fails that
+statement, and its transaction is rolled back with everything the triggers wrote.
+*/
+
+// TriggerRunner runs the body of trigger for one row, in transaction tx. old is
+// nil for INSERT and new is nil for DELETE; both map lower-case columns to values.
+type TriggerRunner func(tx *txn.Transaction, trigger types.TriggerDef, old, new map[string]interface{}) error
+
+// SetTriggerRunner sets the function that runs the bodies of the triggers
+// the statements of transaction t fire.
+func (se *StorageEngine) SetTriggerRunner(t *txn.Transaction, runner TriggerRunner) {
+	se.triggerMu.Lock()
+	defer se.triggerMu.Unlock()
+	se.triggerRunners[t.ID] = runner
+}
+
+// triggerRunner returns the runner set for tx, nil when there is none.
+func (se *StorageEngine) triggerRunner(tx *txn.Transaction) TriggerRunner {
+	if tx == nil {
+		return nil
+	}
+	se.triggerMu.Lock()
+	defer se.triggerMu.Unlock()
+	return se.triggerRunners[tx.ID]
+}
+
+// forgetTriggerRunner drops the runner of a transaction that ended.
+func (se *StorageEngine) forgetTriggerRunner(txnID uint64) {
+	se.triggerMu.Lock()
+	defer se.triggerMu.Unlock()
+	delete(se.triggerRunners, txnID)
+}
+
+// CreateTrigger adds trigger to the catalog.
+func (se *StorageEngine) CreateTrigger(trigger types.TriggerDef) error {
+	if err := se.RequireDatabase(); err != nil {
+		return err
+	}
+	if _, ok := se.CatalogManager.GetTrigger(trigger.Name); ok {
+		return fmt.Errorf("trigger '%s' already exists", trigger.Name)
+	}
+	if se.CatalogManager.ViewExists(trigger.Table) {
+		return fmt.Errorf("'%s' is a view: triggers can only be created on tables", trigger.Table)
+	}
+	if !se.CatalogManager.TableExists(trigger.Table) {
+		return fmt.Errorf("table '%s' does not exist", trigger.Table)
+	}
+	if err := se.CatalogManager.PutTrigger(trigger); err != nil {
+		return err
+	}
+	fmt.Printf("Trigger '%s' created on '%s'\n", trigger.Name, trigger.Table)
+	return nil
+}
+
+// DropTrigger removes a trigger from the catalog.
+func (se *StorageEngine) DropTrigger(name string) error {
+	if err := se.RequireDatabase(); err != nil {
+		return err
+	}
+	if _, ok := se.CatalogManager.GetTrigger(name); !ok {
+		return fmt.Errorf("trigger '%s' does not exist", name)
+	}
+	if err := se.CatalogManager.RemoveTrigger(name); err != nil {
+		return err
+	}
+	fmt.Printf("Trigger '%s' dropped\n", name)
+	return nil
+}
+
+// fireTriggers runs the triggers of tableName that fire at timing on event,
+// for the row whose values (in schema order) are old and new.
+func (se *StorageEngine) fireTriggers(tx *txn.Transaction, tableName string, schema types.TableSchema, timing, event string, old, new []any) error {
+	triggers := se.CatalogManager.TableTriggers(tableName, timing, event)
+	if len(triggers) == 0 {
+		return nil
+	}
+	run := se.triggerRunner(tx)
+	if run == nil {
+		return fmt.Errorf("table '%s' has triggers, but nothing to run them", tableName)
+	}
+
+	oldRow, newRow := rowByColumn(schema, old), rowByColumn(schema, new)
+	for _, trigger := range triggers {
+		if err := run(tx, trigger, oldRow, newRow); err != nil {
+			return fmt.Errorf("trigger %s: %w", trigger.Name, err)
+		}
+	}
+	return nil
+}
+
+// rowByColumn maps the lower-case columns of schema to values; nil for no row.
+func rowByColumn(schema types.TableSchema, values []any) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	row := make(map[string]interface{}, len(values))
+	for i, col := range schema.Columns {
+		row[strings.ToLower(col.Name)] = values[i]
+	}
+	return row
+}
@@ -42,6 +42,9 @@ func (se *StorageEngine) TruncateTable(tableName string) error {
 		return fmt.Errorf("wal sync failed: %w", err)
 	}
 
+	// every version goes, including the ones waiting to be pruned
+	se.forgetVersions(tableName)
+
 	// ---------------------------
 	// Load schema
 	// ---------------------------
@@ -87,7 +90,7 @@ func (se *StorageEngine) TruncateTable(tableName string) error {
 
 		pkBytes, _, err := se.ExtractPrimaryKey(schema, values, &rp)
 		if err == nil && index != nil {
-			index.Delete(pkBytes)
+			index.Delete(pkBytes, lsn)
 		}
 
 		if err := se.HeapManager.DeleteRow(&rp, lsn); err != nil {
@@ -96,6 +99,7 @@ func (se *StorageEngine) TruncateTable(tableName string) error {
 	}
 
 	fmt.Printf("Table '%s' truncated (%d rows removed)\n", tableName, len(rowPtrs))
+	se.CatalogManager.RecordModifications(tableName, len(rowPtrs))
 
 	return nil
 }
@@ -3,15 +3,29 @@ package storageengine
 import (
 	txn "DaemonDB/storage_engine/transaction_manager"
 	types "DaemonDB/types"
+	"bytes"
 	"fmt"
+	"strings"
 )
 
 /*
 This file contains the Update row functionality
 It searches for the row pointer
 
-this is similar to Insert Row
+this is similar to Insert Row, BEFORE / AFTER UPDATE triggers included
 
+An update never overwrites a row: it writes a new version that points back
+at the old one and stamps the old one with the transaction's ID (mvcc.go),
+so transactions whose snapshot does not see the update keep reading the old
+version.
+
+	lock old + new key → old version still the newest? (else ErrSerialization)
+	     → BEFORE UPDATE triggers
+	     → heap: new version {Xmin: txn, Prev: old}, Xmax of old = txn
+	     → WAL OpUpdate (new version, before-image, OldPtr, Prev)
+	     → index: new key → new version (a changed key leaves the old key on
+	       the old version, for older snapshots)
+	     → AFTER UPDATE triggers
 */
 
 func (se *StorageEngine) UpdateRow(txn *txn.Transaction, tableName string, ptr types.RowPointer, newRow types.Row) error {
@@ -20,10 +34,9 @@ func (se *StorageEngine) UpdateRow(txn *txn.Transaction, tableName string, ptr t
 		return fmt.Errorf("table '%s' not found: %w", tableName, err)
 	}
 
-	// Read old row BEFORE overwriting — needed for rollback
 	oldRowData, err := se.HeapManager.GetRow(&ptr)
 	if err != nil {
-		return fmt.Errorf("failed to read old row for undo log: %w", err)
+		return fmt.Errorf("failed to read old row: %w", err)
 	}
 
 	oldValues, err := se.DeserializeRow(oldRowData, schema.Columns)
@@ -35,70 +48,120 @@ func (se *StorageEngine) UpdateRow(txn *txn.Transaction, tableName string, ptr t
 		return fmt.Errorf("failed to extract old PK: %w", err)
 	}
 
+	// generated columns follow the new values (set in newRow, for the caller)
+	if hasGenerated(schema.Columns) {
+		values := make([]any, len(schema.Columns))
+		for i, col := range schema.Columns {
+			values[i] = newRow.Values[strings.ToLower(col.Name)]
+		}
+		if err := computeGenerated(schema.Columns, values, false); err != nil {
+			return err
+		}
+		for i, col := range schema.Columns {
+			if col.Generated != nil {
+				newRow.Set(col.Name, values[i])
+			}
+		}
+	}
+
 	// Serialize row to bytes
 	serialized, err := se.SerializeRowFromMap(schema.Columns, newRow)
 	if err != nil {
 		return err
 	}
+	newValues, err := se.DeserializeRow(serialized, schema.Columns)
+	if err != nil {
+		return fmt.Errorf("failed to deserialize updated row: %w", err)
+	}
 
-	var txnID uint64
-	if txn != nil {
-		txnID = txn.ID
+	if err := se.lockRow(txn, tableName, schema, oldValues, &ptr); err != nil {
+		return err
+	}
+	if err := se.lockRow(txn, tableName, schema, newValues, &ptr); err != nil {
+		return err
+	}
+	// with the lock held, nobody else can replace it any more
+	if _, _, err := se.writableVersion(txn, ptr); err != nil {
+		return err
 	}
 
-	lsn := se.WalManager.AllocateLSN(len(serialized))
+	newPKBytes, pkCol, err := se.ExtractPrimaryKey(schema, newValues, &ptr)
+	if err != nil {
+		return fmt.Errorf("failed to extract new PK: %w", err)
+	}
 
-	oldPtr := ptr
-	if err := se.HeapManager.UpdateRow(&ptr, serialized, lsn); err != nil {
-		return fmt.Errorf("heap update failed: %w", err)
+	btree, err := se.GetIndex(tableName)
+	if err != nil {
+		return fmt.Errorf("failed to get index: %w", err)
 	}
 
-	op := &types.Operation{
-		Type:    types.OpUpdate,
-		TxnID:   txnID,
-		Table:   tableName,
-		RowPtr:  ptr,
-		OldPtr:  oldPtr,
-		RowData: serialized,
+	// the new version continues the chain of its key: the old version, or a
+	// deleted row the new key had
+	prev := &ptr
+	if !bytes.Equal(oldPKBytes, newPKBytes) {
+		prev = nil
+		if ptrBytes, err := btree.Search(newPKBytes); err == nil && ptrBytes != nil {
+			existing, err := se.DeserializeRowPointer(ptrBytes)
+			if err != nil {
+				return err
+			}
+			var taken bool
+			prev, taken, err = se.keyPredecessor(existing)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return &DuplicateKeyError{Table: tableName, Column: pkCol, Value: newRow.Values[strings.ToLower(pkCol)], Existing: existing}
+			}
+		}
 	}
 
-	if err := se.WalManager.AppendToBuffer(op, lsn); err != nil {
-		_ = se.HeapManager.DeleteRow(&ptr, lsn)
-		return fmt.Errorf("WAL buffer append failed: %w", err)
+	if err := se.fireTriggers(txn, tableName, schema, "BEFORE", "UPDATE", oldValues, newValues); err != nil {
+		return err
 	}
 
-	newValues, err := se.DeserializeRow(serialized, schema.Columns)
+	txnID := versionTxnID(txn)
+
+	lsn := se.WalManager.AllocateLSN(len(serialized) + len(oldRowData))
+
+	fileID, err := se.CatalogManager.GetTableFileID(tableName)
 	if err != nil {
-		return fmt.Errorf("failed to deserialize updated row: %w", err)
+		return fmt.Errorf("no heap file registered for table '%s': %w", tableName, err)
 	}
-
-	newPKBytes, _, err := se.ExtractPrimaryKey(schema, newValues, &ptr)
+	newPtr, err := se.HeapManager.InsertRow(fileID, types.TupleHeader{Xmin: txnID, Prev: prev}, serialized, lsn)
 	if err != nil {
-		return fmt.Errorf("failed to extract new PK: %w", err)
+		return fmt.Errorf("heap update failed: %w", err)
+	}
+	if err := se.HeapManager.SetXmax(&ptr, txnID, lsn); err != nil {
+		_ = se.HeapManager.DeleteRow(newPtr, lsn)
+		return fmt.Errorf("heap update failed: %w", err)
 	}
 
-	btree, err := se.GetIndex(tableName)
-	if err != nil {
-		return fmt.Errorf("failed to get index: %w", err)
+	op := &types.Operation{
+		Type:       types.OpUpdate,
+		TxnID:      txnID,
+		Table:      tableName,
+		RowPtr:     *newPtr,
+		OldPtr:     ptr,
+		Prev:       prev,
+		RowData:    serialized,
+		OldRowData: oldRowData,
 	}
 
-	// If row moved (delete+reinsert path), old index entry is now stale.
-	if oldPtr != ptr {
-		oldValues, err := se.DeserializeRow(oldRowData, schema.Columns)
-		if err == nil {
-			oldPKBytes, _, _ := se.ExtractPrimaryKey(schema, oldValues, &oldPtr)
-			_ = btree.Delete(oldPKBytes)
-		}
+	if err := se.WalManager.AppendToBuffer(op, lsn); err != nil {
+		_ = se.HeapManager.DeleteRow(newPtr, lsn)
+		_ = se.HeapManager.SetXmax(&ptr, 0, lsn)
+		return fmt.Errorf("WAL buffer append failed: %w", err)
 	}
 
-	// Insert updated index entry.
-	rowPtrBytes := se.SerializeRowPointer(ptr)
-	if err := btree.Insertion(newPKBytes, rowPtrBytes); err != nil {
+	rowPtrBytes := se.SerializeRowPointer(*newPtr)
+	if err := btree.Insertion(newPKBytes, rowPtrBytes, lsn); err != nil {
 		return fmt.Errorf("index update failed: %w", err)
 	}
 
 	// Record for rollback — only after both heap and index succeed
-	txn.RecordUpdate(tableName, oldPtr, ptr, oldRowData, oldPKBytes)
+	txn.RecordUpdate(tableName, ptr, *newPtr, oldRowData, oldPKBytes, newPKBytes, op)
+	se.CatalogManager.RecordModifications(tableName, 1)
 
-	return nil
+	return se.fireTriggers(txn, tableName, schema, "AFTER", "UPDATE", oldValues, newValues)
 }
@@ -0,0 +1,186 @@
+package storageengine
+
+import (
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+	"fmt"
+	"strings"
+)
+
+/*
+This file contains views and materialized views
+
+	CREATE VIEW v AS query                      → catalog entry (views.json); the parser expands v
+	CREATE MATERIALIZED VIEW m AS query         → catalog entry + backing table "m$1" holding the rows
+	REFRESH MATERIALIZED VIEW m                 → every row of "m$1" deleted, the new ones inserted
+	REFRESH MATERIALIZED VIEW CONCURRENTLY m    → only the rows that differ deleted and inserted
+
+The backing table is an ordinary table without primary key (heap file, implicit
+row-id index, WAL), which the user never names: the messages of its writes are
+left out, and INSERT / UPDATE / DELETE on the view are refused by the VM.
+Its rows are written in the transaction of the statement, so readers see the
+old contents until it commits, and a rollback, a failed refresh or a crash
+before the commit leaves the view as it was (recover_wal.go).
+*/
+
+// LookupView returns the view called name in the current database; the parser
+// expands views through it.
+func (se *StorageEngine) LookupView(name string) (types.ViewDef, bool) {
+	if se.RequireDatabase() != nil {
+		return types.ViewDef{}, false
+	}
+	return se.CatalogManager.GetView(name)
+}
+
+// CreateView adds view to the catalog, replacing the view of the same name
+// if orReplace is set.
+func (se *StorageEngine) CreateView(view types.ViewDef, orReplace bool) error {
+	if err := se.RequireDatabase(); err != nil {
+		return err
+	}
+	if se.CatalogManager.TableExists(view.Name) {
+		return fmt.Errorf("table '%s' already exists", view.Name)
+	}
+	if old, ok := se.CatalogManager.GetView(view.Name); ok {
+		if !orReplace {
+			return fmt.Errorf("view '%s' already exists", view.Name)
+		}
+		if old.Materialized || view.Materialized {
+			return fmt.Errorf("'%s' is a materialized view", view.Name)
+		}
+	}
+	return se.CatalogManager.PutView(view)
+}
+
+// DropView drops a view, or a materialized view with its backing table.
+// Views that read it must be dropped first.
+func (se *StorageEngine) DropView(name string, materialized bool) error {
+	if err := se.RequireDatabase(); err != nil {
+		return err
+	}
+	view, ok := se.CatalogManager.GetView(name)
+	switch {
+	case !ok && se.CatalogManager.TableExists(name):
+		return fmt.Errorf("'%s' is a table (use DROP TABLE)", name)
+	case !ok:
+		return fmt.Errorf("view '%s' does not exist", name)
+	case view.Materialized && !materialized:
+		return fmt.Errorf("'%s' is a materialized view (use DROP MATERIALIZED VIEW)", name)
+	case !view.Materialized && materialized:
+		return fmt.Errorf("'%s' is not a materialized view (use DROP VIEW)", name)
+	}
+	if err := se.checkNoDependents("view", name); err != nil {
+		return err
+	}
+
+	if err := se.CatalogManager.RemoveView(name); err != nil {
+		return err
+	}
+	if view.Materialized && se.CatalogManager.TableExists(view.Table) {
+		if err := se.dropTable(view.Table); err != nil {
+			return fmt.Errorf("view '%s' dropped, but not its table '%s': %w", name, view.Table, err)
+		}
+	}
+	fmt.Printf("View '%s' dropped\n", name)
+	return nil
+}
+
+// checkNoDependents returns an error naming the views that read the table or
+// view name, if there are any.
+func (se *StorageEngine) checkNoDependents(kind, name string) error {
+	dependents := se.CatalogManager.DependentViews(name)
+	if len(dependents) == 0 {
+		return nil
+	}
+	return fmt.Errorf("cannot drop %s '%s' because other objects depend on it: view %s (drop them first)",
+		kind, name, strings.Join(dependents, ", view "))
+}
+
+// CreateViewTable creates a new, empty backing table for the materialized
+// view name and returns its name.
+func (se *StorageEngine) CreateViewTable(name string, columns []types.ColumnDef) (string, error) {
+	table := ""
+	for n := 1; table == ""; n++ {
+		candidate := fmt.Sprintf("%s$%d", name, n)
+		if !se.CatalogManager.TableExists(candidate) {
+			table = candidate
+		}
+	}
+
+	schema := types.TableSchema{TableName: table}
+	for _, col := range columns {
+		schema.Columns = append(schema.Columns, types.ColumnDef{Name: col.Name, Type: col.Type})
+	}
+	if err := se.CreateTable(schema); err != nil {
+		return "", err
+	}
+	return table, nil
+}
+
+// DropViewTable drops the backing table of a materialized view that could not
+// be created.
+func (se *StorageEngine) DropViewTable(table string) error {
+	return se.dropTable(table)
+}
+
+// RefreshViewTable writes rows, the new contents of the materialized view
+// view in the order of its columns, to its backing table in transaction tx.
+// A full refresh deletes every row and inserts the new ones; with
+// concurrently the rows that are in both stay, and only the others are
+// deleted or inserted. It returns the number of rows deleted and inserted.
+func (se *StorageEngine) RefreshViewTable(tx *txn.Transaction, view types.ViewDef, rows [][]any, concurrently bool) (int, int, error) {
+	schema, err := se.CatalogManager.GetTableSchema(view.Table)
+	if err != nil {
+		return 0, 0, fmt.Errorf("materialized view '%s' lost its table: %w", view.Name, err)
+	}
+	_, current, err := se.readTargetRows(se.readSnapshot(tx), view.Table, view.Table, schema, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// the new rows not matched by a current one, by their values
+	missing := make(map[string]int, len(rows))
+	for _, row := range rows {
+		missing[viewRowKey(row)]++
+	}
+	var stale []types.RowPointer
+	for _, old := range current {
+		values := make([]any, len(schema.Columns))
+		for i, col := range schema.Columns {
+			values[i] = old.Row.Values[strings.ToLower(col.Name)]
+		}
+		if key := viewRowKey(values); concurrently && missing[key] > 0 {
+			missing[key]--
+			continue
+		}
+		stale = append(stale, old.Pointer)
+	}
+
+	if _, err := se.deleteRowsAt(tx, view.Table, stale); err != nil {
+		return 0, 0, err
+	}
+	inserted := 0
+	for _, row := range rows {
+		key := viewRowKey(row)
+		if concurrently {
+			if missing[key] == 0 {
+				continue
+			}
+			missing[key]--
+		}
+		if err := se.InsertRow(tx, view.Table, row); err != nil {
+			return 0, 0, err
+		}
+		inserted++
+	}
+	return len(stale), inserted, nil
+}
+
+// viewRowKey identifies a row of a materialized view by its values.
+func viewRowKey(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i], _ = types.ToString(v)
+	}
+	return strings.Join(parts, "\x00")
+}
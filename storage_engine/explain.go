@@ -0,0 +1,474 @@
+package storageengine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+)
+
+/*
+This file contains EXPLAIN and EXPLAIN ANALYZE for SELECT.
+
+A SELECT runs as a tree of operators; every step of ExecuteSelect returns the
+one it ran as a plan node:
+
+	Seq Scan / Index Lookup / Index Prefix Scan    one table, its access path (access_path.go)
+	Subquery Scan                                  a derived table
+	Merge / Hash / Index Nested Loop /
+	Block Nested Loop Join                         one join (join_plan.go)
+	Filter                                         WHERE on the joined rows
+	Semi Join / Anti Join                          a decorrelated IN / EXISTS (subquery.go)
+	Sort / Project                                 ORDER BY and the select list
+
+Each node carries the planner's estimates: rows from the statistics (cost.go,
+defaultSelectivity for tables never analyzed) and a cost in units of one
+sequential page read, including its children. Joins, sorts and filters cost
+cpuTupleCost per row they touch.
+
+EXPLAIN plans the query without running it. The join order and algorithms
+are chosen once, on the estimated sizes of the inputs (planJoins), and a query
+runs with the joins planned that way, so EXPLAIN shows the joins it will run.
+
+EXPLAIN ANALYZE runs the query and discards its rows. Every operator also
+records its actual rows, elapsed time and the buffer pool hits and misses
+while it ran, its children included. The hits and misses are the change in
+the buffer pool's counters, which every session shares: pages that other
+sessions fetch while the operator runs are counted too, so the numbers are
+only the query's own when it runs alone.
+
+Subqueries evaluated inside expressions (scalar, correlated) are not shown as
+operators; their work counts toward the operator that evaluates them.
+*/
+
+// ExplainSelect returns the plan of a SELECT. With analyze the query is
+// executed, as the snapshot of tx sees the rows, and the plan holds what
+// every operator actually did.
+func (se *StorageEngine) ExplainSelect(tx *txn.Transaction, payload types.SelectPayload, analyze bool) (*types.PlanNode, error) {
+	if err := se.RequireDatabase(); err != nil {
+		return nil, err
+	}
+	snap := se.readSnapshot(tx)
+	if !analyze {
+		return se.planSelect(snap, payload)
+	}
+	_, _, plan, err := se.executeSelect(snap, payload)
+	return plan, err
+}
+
+// opMeter measures one operator from startOp to finishOp. Its buffer pool
+// counts include the pages concurrent sessions fetch meanwhile.
+type opMeter struct {
+	start  time.Time
+	hits   int64
+	misses int64
+}
+
+func (se *StorageEngine) startOp() opMeter {
+	m := opMeter{start: time.Now()}
+	if se.BufferPool != nil {
+		m.hits, m.misses = se.BufferPool.Counters()
+	}
+	return m
+}
+
+// finishOp records that node produced rows since m started. before are its
+// children that ran before m started; their time and buffer pool accesses are
+// added to the node's.
+func (se *StorageEngine) finishOp(node *types.PlanNode, m opMeter, rows int, before ...*types.PlanNode) {
+	if node == nil {
+		return
+	}
+	actual := &types.PlanActual{
+		Rows:   rows,
+		TimeMs: float64(time.Since(m.start).Microseconds()) / 1000,
+	}
+	if se.BufferPool != nil {
+		hits, misses := se.BufferPool.Counters()
+		actual.BufferHits, actual.BufferMisses = hits-m.hits, misses-m.misses
+	}
+	for _, child := range before {
+		if child != nil && child.Actual != nil {
+			actual.TimeMs += child.Actual.TimeMs
+			actual.BufferHits += child.Actual.BufferHits
+			actual.BufferMisses += child.Actual.BufferMisses
+		}
+	}
+	node.Actual = actual
+}
+
+// planSelect builds the plan of a SELECT without executing it: the operators
+// executeSelect would run, with their estimates. The joins come from
+// planJoins, which the execution uses too.
+func (se *StorageEngine) planSelect(snap *txn.Snapshot, payload types.SelectPayload) (*types.PlanNode, error) {
+	foldSelect(&payload)
+	var needed map[string]bool
+	if len(payload.Joins) > 0 {
+		needed = neededColumns(&payload)
+	}
+
+	semiJoins, err := se.planSubqueries(snap, &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan *types.PlanNode
+	switch {
+	case payload.WorkTable != "":
+		plan, err = se.planWorkTable(payload)
+	case payload.SystemTable != "":
+		plan, err = se.planSystemTable(payload)
+	case payload.Recursive != "":
+		plan, err = se.planRecursive(snap, payload)
+	case payload.SetOp != nil:
+		var left, right *types.PlanNode
+		if left, err = se.planSelect(snap, *payload.SetOp.Left); err != nil {
+			return nil, err
+		}
+		if right, err = se.planSelect(snap, *payload.SetOp.Right); err != nil {
+			return nil, err
+		}
+		plan = se.setOpNode(payload.SetOp, left, right)
+	case len(payload.Joins) > 0:
+		plan, err = se.planJoinSelect(snap, payload, needed)
+	case payload.FromSubquery != nil:
+		var inner *types.PlanNode
+		if inner, err = se.planSelect(snap, *payload.FromSubquery); err == nil {
+			plan = derivedNode(payload.Alias, inner, payload.WhereExpr)
+		}
+	default:
+		plan, err = se.simpleSelectPlan(payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sj := range semiJoins {
+		inner, err := se.planSelect(snap, sj.inner)
+		if err != nil {
+			return nil, err
+		}
+		plan = semiJoinNode(plan, inner, sj)
+	}
+	_, windows := extractWindows(payload)
+	for _, group := range windows {
+		plan = se.windowNode(plan, group)
+	}
+	plan = outputNode(plan, payload)
+	if payload.Distinct {
+		plan = se.distinctNode(plan)
+	}
+	return plan, nil
+}
+
+// planJoinSelect plans a query with joins: the FROM items as openFromItem
+// opens them, a derived table planned instead of executed, then the joins
+// as planJoins plans them for joinFromItems.
+func (se *StorageEngine) planJoinSelect(snap *txn.Snapshot, payload types.SelectPayload, needed map[string]bool) (*types.PlanNode, error) {
+	filters, rw, err := se.rewriteJoins(&payload)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := make([]joinInput, len(rw.refs))
+	for i, ref := range rw.refs {
+		if ref.Subquery == nil {
+			if inputs[i], err = se.openFromItem(snap, ref, filters[i], needed); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		inner, err := se.planSelect(snap, *ref.Subquery)
+		if err != nil {
+			return nil, fmt.Errorf("subquery %s: %w", ref.Name(), err)
+		}
+		cols, err := se.outputColumns(ref.Subquery)
+		if err != nil {
+			return nil, err
+		}
+		_, keys := derivedKeys(ref.Name(), cols, needed)
+		plan := derivedNode(ref.Name(), inner, filters[i])
+		inputs[i] = joinInput{keys: keys, display: keys, size: int(math.Ceil(plan.EstRows)), plan: plan}
+	}
+
+	order, joins := se.orderJoins(&payload, rw, inputs)
+	_, left, err := se.planJoins(inputs, order, joins)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.WhereExpr != nil {
+		return filterNode(left.plan, payload), nil
+	}
+	return left.plan, nil
+}
+
+// plannerStats returns the statistics of a table or, for a table never
+// analyzed, only its row and page counts.
+func (se *StorageEngine) plannerStats(tableName string) types.TableStats {
+	if stats, ok := se.tableStats(tableName); ok {
+		return stats
+	}
+	stats := types.TableStats{}
+	if hf, err := se.HeapManager.GetHeapFileByTable(tableName); err == nil {
+		stats.RowCount = len(hf.GetAllRowPointers())
+		stats.PageCount = hf.PageCount()
+	}
+	return stats
+}
+
+// scanNode describes reading table (known as refName in the query) through
+// path, keeping the rows that satisfy filter.
+func (se *StorageEngine) scanNode(tableName, refName string, path accessPath, filter *types.ExpressionNode) *types.PlanNode {
+	stats := se.plannerStats(tableName)
+	node := &types.PlanNode{
+		Operator: "Seq Scan",
+		Relation: relationName(tableName, refName),
+		Filter:   types.FormatExpression(filter),
+		EstRows:  estimateRows(stats, filter),
+		EstCost:  pathCost(path, stats),
+	}
+	switch path.kind {
+	case accessPKPoints:
+		node.Operator = "Index Lookup"
+		node.Condition = types.FormatExpression(path.conj)
+		node.EstRows = math.Min(node.EstRows, float64(len(path.keys)))
+	case accessPKPrefix:
+		node.Operator = "Index Prefix Scan"
+		node.Condition = types.FormatExpression(path.conj)
+	case accessPKRange:
+		node.Operator = "Index Range Scan"
+		node.Condition = types.FormatExpression(path.conj)
+		if path.keys != nil {
+			node.EstRows = math.Min(node.EstRows, float64(len(path.keys)))
+		}
+	}
+	return node
+}
+
+// simpleSelectPlan describes how executeSimpleSelect reads the table of payload.
+func (se *StorageEngine) simpleSelectPlan(payload types.SelectPayload) (*types.PlanNode, error) {
+	schema, err := se.CatalogManager.GetTableSchema(payload.Table)
+	if err != nil {
+		return nil, fmt.Errorf("table '%s' not found: %w", payload.Table, err)
+	}
+	name := payload.From().Name()
+
+	path := accessPath{kind: accessFullScan}
+	if payload.WhereExpr != nil {
+		path = se.chooseAccessPath(name, schema, payload.WhereExpr)
+	}
+	return se.scanNode(payload.Table, name, path, payload.WhereExpr), nil
+}
+
+// relationName names a FROM item: the table and, if it has one, its alias.
+func relationName(tableName, refName string) string {
+	if refName == "" || strings.EqualFold(refName, tableName) {
+		return tableName
+	}
+	return tableName + " AS " + refName
+}
+
+// whereText renders the WHERE clause of payload.
+func whereText(payload types.SelectPayload) string {
+	return types.FormatExpression(payload.WhereExpr)
+}
+
+// derivedNode describes reading the rows of a derived table (planned as
+// inner) that satisfy filter.
+func derivedNode(alias string, inner *types.PlanNode, filter *types.ExpressionNode) *types.PlanNode {
+	return &types.PlanNode{
+		Operator: "Subquery Scan",
+		Relation: alias,
+		Filter:   types.FormatExpression(filter),
+		EstRows:  inner.EstRows * selectivity(filter, types.TableStats{}),
+		EstCost:  inner.EstCost + inner.EstRows*cpuTupleCost,
+		Children: []*types.PlanNode{inner},
+	}
+}
+
+var joinOperators = map[joinStrategy]string{
+	joinSortMerge: "Merge",
+	joinHash:      "Hash",
+	joinIndexNL:   "Index Nested Loop",
+	joinBlockNL:   "Block Nested Loop",
+}
+
+// joinNode describes joining right to left as step says. An index
+// nested-loop join probes the right table, so it has only the left child.
+func joinNode(left, right joinInput, join types.JoinClause, step joinStep) *types.PlanNode {
+	l, r := left.plan.EstRows, right.plan.EstRows
+
+	conds := []string{}
+	rows := l * r
+	for i := range step.leftKeys {
+		conds = append(conds, step.leftKeys[i]+" = "+step.rightKeys[i])
+		rows /= math.Max(1, math.Max(distinctOf(left, step.leftKeys[i], l), distinctOf(right, step.rightKeys[i], r)))
+	}
+	rows *= selectivity(step.residual, types.TableStats{})
+	switch step.joinType {
+	case "LEFT":
+		rows = math.Max(rows, l)
+	case "RIGHT":
+		rows = math.Max(rows, r)
+	case "FULL":
+		rows = math.Max(rows, math.Max(l, r))
+	}
+
+	operator := []string{joinOperators[step.plan.strategy]}
+	if step.joinType != "INNER" && step.joinType != "CROSS" {
+		operator = append(operator, step.joinType[:1]+strings.ToLower(step.joinType[1:]))
+	}
+	operator = append(operator, "Join")
+
+	node := &types.PlanNode{
+		Operator:  strings.Join(operator, " "),
+		Condition: strings.Join(conds, " AND "),
+		Filter:    types.FormatExpression(step.residual),
+		EstRows:   rows,
+		EstCost:   left.plan.EstCost + right.plan.EstCost + step.plan.cost*cpuTupleCost,
+		Children:  []*types.PlanNode{left.plan, right.plan},
+	}
+	switch {
+	case len(step.using) > 0:
+		node.Condition = "USING (" + strings.Join(step.using, ", ") + ")"
+	case step.plan.strategy == joinBlockNL:
+		node.Condition, node.Filter = types.FormatExpression(join.On), ""
+	case step.plan.strategy == joinIndexNL:
+		node.Relation = relationName(right.table, join.Name())
+		node.Filter = types.FormatExpression(andExpr(right.filter, step.residual))
+		node.EstCost = left.plan.EstCost + step.plan.cost*cpuTupleCost
+		node.Children = node.Children[:1]
+	}
+	return node
+}
+
+// distinctOf is the number of distinct values of key in in, at most rows.
+func distinctOf(in joinInput, key string, rows float64) float64 {
+	if d, ok := in.distinct[key]; ok && d > 0 {
+		return math.Min(d, rows)
+	}
+	return rows
+}
+
+// filterNode describes applying the WHERE clause of payload to the rows of child.
+func filterNode(child *types.PlanNode, payload types.SelectPayload) *types.PlanNode {
+	rows := child.EstRows * selectivity(payload.WhereExpr, types.TableStats{})
+	if payload.WhereExpr == nil {
+		rows = child.EstRows * defaultSelectivity
+	}
+	return &types.PlanNode{
+		Operator: "Filter",
+		Filter:   whereText(payload),
+		EstRows:  rows,
+		EstCost:  child.EstCost + child.EstRows*cpuTupleCost,
+		Children: []*types.PlanNode{child},
+	}
+}
+
+// semiJoinNode describes the semi (anti) join of the rows of outer with the
+// decorrelated subquery planned as inner. It keeps defaultSelectivity (the
+// rest) of the outer rows.
+func semiJoinNode(outer, inner *types.PlanNode, sj semiJoin) *types.PlanNode {
+	node := &types.PlanNode{
+		Operator: "Semi Join",
+		EstRows:  outer.EstRows * defaultSelectivity,
+		Children: []*types.PlanNode{outer, inner},
+	}
+	if sj.anti {
+		node.Operator = "Anti Join"
+		node.EstRows = outer.EstRows - node.EstRows
+	}
+
+	innerKey := "(SELECT ...)"
+	if len(sj.inner.Projections) == 1 {
+		innerKey = types.FormatExpression(sj.inner.Projections[0].Expr)
+	}
+	node.Condition = types.FormatExpression(sj.outerKey) + " = " + innerKey
+
+	o, i := outer.EstRows, inner.EstRows
+	sortMerge := o*math.Log2(o+1) + i*math.Log2(i+1) + o + i
+	node.EstCost = outer.EstCost + inner.EstCost + sortMerge*cpuTupleCost
+	return node
+}
+
+// outputNode describes projectAndSort on the rows of child, or is child when
+// the query has neither a select list nor ORDER BY.
+func outputNode(child *types.PlanNode, payload types.SelectPayload) *types.PlanNode {
+	n := child.EstRows
+	switch {
+	case len(payload.OrderBy) > 0:
+		keys := make([]string, len(payload.OrderBy))
+		for i, item := range payload.OrderBy {
+			keys[i] = types.FormatExpression(item.Expr)
+			if item.Desc {
+				keys[i] += " DESC"
+			}
+		}
+		return &types.PlanNode{
+			Operator:  "Sort",
+			Condition: strings.Join(keys, ", "),
+			EstRows:   n,
+			EstCost:   child.EstCost + (n*math.Log2(n+1)+n)*cpuTupleCost,
+			Children:  []*types.PlanNode{child},
+		}
+	case len(payload.Projections) > 0:
+		return &types.PlanNode{
+			Operator: "Project",
+			EstRows:  n,
+			EstCost:  child.EstCost + n*cpuTupleCost,
+			Children: []*types.PlanNode{child},
+		}
+	}
+	return child
+}
+
+// setOpNode describes a set operation between the plans of its two sides.
+func (se *StorageEngine) setOpNode(setOp *types.SetOperation, left, right *types.PlanNode) *types.PlanNode {
+	l, r := left.EstRows, right.EstRows
+	node := &types.PlanNode{
+		Operator: map[string]string{"UNION": "Union", "INTERSECT": "Intersect", "EXCEPT": "Except"}[setOp.Op],
+		Children: []*types.PlanNode{left, right},
+	}
+	if setOp.All {
+		node.Operator += " All"
+	}
+
+	switch setOp.Op {
+	case "UNION":
+		node.EstRows = l + r
+	case "INTERSECT":
+		node.EstRows = math.Min(l, r)
+	default:
+		node.EstRows = l
+	}
+	own := se.dedupCost(l + r)
+	if setOp.Op == "UNION" && setOp.All {
+		own = (l + r) * cpuTupleCost // concatenation only
+	}
+	node.EstCost = left.EstCost + right.EstCost + own
+	return node
+}
+
+// distinctNode describes SELECT DISTINCT on the rows of child.
+func (se *StorageEngine) distinctNode(child *types.PlanNode) *types.PlanNode {
+	return &types.PlanNode{
+		Operator: "Distinct",
+		EstRows:  child.EstRows,
+		EstCost:  child.EstCost + se.dedupCost(child.EstRows),
+		Children: []*types.PlanNode{child},
+	}
+}
+
+// dedupCost is the cost of hashing n rows to remove duplicates.
+func (se *StorageEngine) dedupCost(n float64) float64 {
+	cost := n * cpuTupleCost
+	if n > float64(se.joinMemoryRows) {
+		cost *= 3 // write and read back every row
+	}
+	return cost
+}
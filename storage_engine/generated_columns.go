@@ -0,0 +1,62 @@
+package storageengine
+
+import (
+	"fmt"
+	"strings"
+
+	"DaemonDB/types"
+)
+
+/*
+This file computes generated columns
+
+	col type GENERATED ALWAYS AS (expr) STORED   → computed by InsertRow / UpdateRow, kept in the row
+	col type GENERATED ALWAYS AS (expr) VIRTUAL  → not serialized; computed by DeserializeRow
+
+expr reads only the ordinary columns of its row, so the generated columns can be
+computed in any order. InsertRow and UpdateRow compute the virtual ones too: they
+are checked when the row is written, and are there for the primary key index and
+for triggers.
+*/
+
+// computeGenerated sets the generated columns of values (in the order of
+// columns) from the ordinary ones; with virtualOnly, only the virtual columns.
+func computeGenerated(columns []types.ColumnDef, values []any, virtualOnly bool) error {
+	var env map[string]interface{}
+	for i, col := range columns {
+		if col.Generated == nil || (virtualOnly && col.Generated.Stored) {
+			continue
+		}
+		if env == nil {
+			env = make(map[string]interface{}, len(columns))
+			for j, c := range columns {
+				if c.Generated == nil {
+					env[strings.ToLower(c.Name)] = values[j]
+				}
+			}
+		}
+
+		val, err := types.EvalExpression(col.Generated.Expr, env)
+		if err == nil {
+			val, err = types.CoerceValue(val, col.Type)
+		}
+		if err == nil && val == nil {
+			err = fmt.Errorf("NULL values are not supported")
+		}
+		if err != nil {
+			return fmt.Errorf("generated column %s: %w", col.Name, err)
+		}
+		values[i] = val
+	}
+	return nil
+}
+
+// hasGenerated reports whether any of columns is generated.
+func hasGenerated(columns []types.ColumnDef) bool {
+	for _, col := range columns {
+		if col.Generated != nil {
+			return true
+		}
+	}
+	return false
+}
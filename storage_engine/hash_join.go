@@ -0,0 +1,277 @@
+package storageengine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+This file contains the hash join.
+
+The smaller input is the build side: its rows are put in a hash table on the
+join key and the other input (the probe side) looks its keys up in it. Outer
+joins keep the unmatched rows of the probe side as they go and the unmatched
+build rows at the end, so one build side serves INNER, LEFT, RIGHT and FULL.
+
+The probe side is fed to the join one row at a time (rowFeed): from a slice,
+or straight from the heap when it is a table not read yet (join_plan.go), so
+a large table joined to a small one is never loaded.
+
+When the build side does not fit in joinMemoryRows rows the join becomes a
+grace hash join (spill.go):
+
+	1. both inputs are split into N partitions by a hash of the join key and
+	   written to temporary files; every input row is dropped once written, so
+	   the inputs are gone when the partitions are joined
+	2. each pair of partitions is joined on its own (rows with equal keys always
+	   land in the same pair): the build partition is loaded in a hash table and
+	   the probe partition read past it one row at a time. A build partition
+	   still over the budget is partitioned again first
+
+EXPLAIN ANALYZE shows the partitions written and the most build rows held in
+memory at once (peak_rows), which stays within the budget unless one key has
+more rows than the budget. The rows the join returns are in memory like the
+result of every operator.
+
+NULL keys never match; their rows are only kept by the outer joins.
+*/
+
+const defaultJoinMemoryRows = 10000
+
+// rowFeed calls emit with every row of one input, in order.
+type rowFeed func(emit func(map[string]interface{}) error) error
+
+// sliceFeed feeds rows, dropping each from the slice once it is used: the
+// join is the only reader of its inputs.
+func sliceFeed(rows []map[string]interface{}) rowFeed {
+	return func(emit func(map[string]interface{}) error) error {
+		return releaseRows(rows, emit)
+	}
+}
+
+// hashJoiner is one hash join: the keys and outer join flags of each side,
+// and the rows joined so far.
+type hashJoiner struct {
+	se                   *StorageEngine
+	buildKeys, probeKeys []string
+	keepBuild, keepProbe bool
+	result               []map[string]interface{}
+	stats                spillStats
+}
+
+// hashJoin joins build and probe on buildKeys = probeKeys. keepBuild / keepProbe
+// keep the unmatched rows of that side (outer joins). The rows of both inputs
+// are dropped from build and from the slice probe reads, if any.
+func (se *StorageEngine) hashJoin(build []map[string]interface{}, probe rowFeed, buildKeys, probeKeys []string, keepBuild, keepProbe bool) ([]map[string]interface{}, spillStats, error) {
+	j := &hashJoiner{
+		se:        se,
+		buildKeys: buildKeys,
+		probeKeys: probeKeys,
+		keepBuild: keepBuild,
+		keepProbe: keepProbe,
+		result:    []map[string]interface{}{},
+	}
+	var err error
+	if len(build) <= se.joinMemoryRows {
+		err = j.inMemory(build, probe)
+	} else {
+		err = j.grace(build, probe)
+	}
+	return j.result, j.stats, err
+}
+
+func (j *hashJoiner) inMemory(build []map[string]interface{}, probe rowFeed) error {
+	table := newHashTable(build, j.buildKeys)
+	if err := probe(func(row map[string]interface{}) error {
+		j.probe(table, row)
+		return nil
+	}); err != nil {
+		return err
+	}
+	j.finish(table)
+	return nil
+}
+
+// grace is the join through partitions on disk.
+func (j *hashJoiner) grace(build []map[string]interface{}, probe rowFeed) error {
+	d, err := j.se.newSpillDir("hashjoin")
+	if err != nil {
+		return fmt.Errorf("hash join: %w", err)
+	}
+	defer d.remove()
+
+	n := j.se.spillPartitions(len(build))
+	buildParts, err := j.partition(d, "build", j.buildKeys, j.keepBuild, n, sliceFeed(build))
+	if err != nil {
+		return err
+	}
+	probeParts, err := j.partition(d, "probe", j.probeKeys, j.keepProbe, n, probe)
+	if err != nil {
+		return err
+	}
+	j.stats.partitions = n
+	for i := 0; i < n; i++ {
+		if err := j.joinPartition(d, buildParts, probeParts, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partition writes the rows of feed to n partitions on keys. Rows with a NULL
+// key never match; outer joins (keep) keep them right away.
+func (j *hashJoiner) partition(d *spillDir, side string, keys []string, keep bool, n int, feed rowFeed) (*partitioner, error) {
+	p, err := d.partitioner(side, keys, n, 0)
+	if err != nil {
+		return nil, fmt.Errorf("hash join: %w", err)
+	}
+	err = feed(func(row map[string]interface{}) error {
+		if hasNullKey(row, keys) {
+			if keep {
+				j.result = append(j.result, j.se.copyRowWithNulls(row))
+			}
+			return nil
+		}
+		return p.add(row)
+	})
+	if cerr := p.close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("hash join: %w", err)
+	}
+	return p, nil
+}
+
+// joinPartition joins partition i of build to partition i of probe. A build
+// partition over the budget is partitioned again, with its probe partition.
+func (j *hashJoiner) joinPartition(d *spillDir, build, probe *partitioner, i int) error {
+	if size := build.counts[i]; size > j.se.joinMemoryRows && build.level < maxSpillLevel {
+		n := j.se.spillPartitions(size)
+		subBuild, err := d.repartition(build, i, "build", n)
+		if err != nil {
+			return fmt.Errorf("hash join: %w", err)
+		}
+		subProbe, err := d.repartition(probe, i, "probe", n)
+		if err != nil {
+			return fmt.Errorf("hash join: %w", err)
+		}
+		j.stats.partitions += n
+		for k := 0; k < n; k++ {
+			if err := j.joinPartition(d, subBuild, subProbe, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	rows, err := readPartition(build.names[i], build.counts[i])
+	if err != nil {
+		return fmt.Errorf("hash join: %w", err)
+	}
+	j.stats.hold(len(rows))
+	table := newHashTable(rows, j.buildKeys)
+	if err := eachPartitionRow(probe.names[i], func(row map[string]interface{}) error {
+		j.probe(table, row)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("hash join: %w", err)
+	}
+	j.finish(table)
+	return nil
+}
+
+// probe joins row to the build rows of table with the same key, or keeps it
+// padded with NULLs when there are none and the probe side is kept.
+func (j *hashJoiner) probe(table *hashTable, row map[string]interface{}) {
+	var hits []int
+	if !hasNullKey(row, j.probeKeys) {
+		hits = table.buckets[hashKey(row, j.probeKeys)]
+	}
+	for _, i := range hits {
+		table.matched[i] = true
+		j.result = append(j.result, mergeRows(table.rows[i], row))
+	}
+	if len(hits) == 0 && j.keepProbe {
+		j.result = append(j.result, j.se.copyRowWithNulls(row))
+	}
+}
+
+// finish keeps the build rows of table no probe row matched, when the build
+// side is kept.
+func (j *hashJoiner) finish(table *hashTable) {
+	if !j.keepBuild {
+		return
+	}
+	for i, row := range table.rows {
+		if !table.matched[i] {
+			j.result = append(j.result, j.se.copyRowWithNulls(row))
+		}
+	}
+}
+
+// hashTable is the build side of a hash join in memory.
+type hashTable struct {
+	rows    []map[string]interface{}
+	buckets map[string][]int // join key -> rows
+	matched []bool
+}
+
+func newHashTable(rows []map[string]interface{}, keys []string) *hashTable {
+	table := &hashTable{
+		rows:    rows,
+		buckets: make(map[string][]int, len(rows)),
+		matched: make([]bool, len(rows)),
+	}
+	for i, row := range rows {
+		if hasNullKey(row, keys) {
+			continue
+		}
+		key := hashKey(row, keys)
+		table.buckets[key] = append(table.buckets[key], i)
+	}
+	return table
+}
+
+// hashKey encodes the join key of row so that keys comparing equal (1 and 1.0
+// included) encode the same.
+func hashKey(row map[string]interface{}, cols []string) string {
+	var b strings.Builder
+	for _, col := range cols {
+		writeValueKey(&b, row[col])
+		b.WriteString("|")
+	}
+	return b.String()
+}
+
+func writeValueKey(b *strings.Builder, val interface{}) {
+	switch v := val.(type) {
+	case int:
+		writeNumberKey(b, float64(v))
+	case int32:
+		writeNumberKey(b, float64(v))
+	case int64:
+		writeNumberKey(b, float64(v))
+	case float32:
+		writeNumberKey(b, float64(v))
+	case float64:
+		writeNumberKey(b, v)
+	case string:
+		b.WriteString("s")
+		b.WriteString(strconv.Itoa(len(v)))
+		b.WriteString(":")
+		b.WriteString(v)
+	default:
+		fmt.Fprintf(b, "%T:%v", v, v)
+	}
+}
+
+func writeNumberKey(b *strings.Builder, f float64) {
+	if f == 0 {
+		f = math.Abs(f) // -0 == 0
+	}
+	b.WriteString("n")
+	b.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+}
@@ -2,6 +2,7 @@ package storageengine
 
 import (
 	"encoding/binary"
+	"fmt"
 
 	bplus "DaemonDB/storage_engine/access/indexfile_manager/bplustree"
 	"DaemonDB/types"
@@ -33,6 +34,27 @@ func (se *StorageEngine) ExtractPrimaryKey(schema types.TableSchema, values []an
 	return se.GenerateImplicitKey(rowPtr), "__rowid__", nil
 }
 
+// findByPrimaryKey returns the row whose primary key col is val, or nil.
+func (se *StorageEngine) findByPrimaryKey(tableName string, col types.ColumnDef, val any) (*types.RowPointer, error) {
+	keyBytes, err := ValueToBytes(val, col.Type)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize primary key: %w", err)
+	}
+	btree, err := se.GetIndex(tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index for '%s': %w", tableName, err)
+	}
+	ptrBytes, err := btree.Search(keyBytes)
+	if err != nil || ptrBytes == nil {
+		return nil, err
+	}
+	ptr, err := se.DeserializeRowPointer(ptrBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &ptr, nil
+}
+
 func (se *StorageEngine) GenerateImplicitKey(rowPtr *types.RowPointer) []byte {
 	buf := make([]byte, 8)
 	binary.BigEndian.PutUint32(buf[0:4], rowPtr.FileID)
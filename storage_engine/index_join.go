@@ -0,0 +1,127 @@
+package storageengine
+
+import (
+	"fmt"
+	"strings"
+
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+)
+
+/*
+This file contains the index nested-loop join.
+
+When the right side of a join is a base table and the join key is its primary
+key, the right table is never scanned: every left row probes the B+ tree with
+its key (BPlusTree.Search) and fetches the one matching row from the heap. A
+predicate pushed down to the right table is checked on the fetched row.
+
+	for each left row:
+	    key  = encode(left.key as the PK type)
+	    ptr  = BTree.Search(key)        → nil: no match
+	    row  = Heap.GetRow(ptr)
+	    emit left ⋈ row
+
+Left rows whose key is NULL, or cannot be a key (2.5 for an INT key), have no
+match. A LEFT join keeps them with NULL columns.
+*/
+
+// indexJoinColumn returns the primary key of right's table if the join can
+// probe it: a single equality on that key, and an INNER or LEFT join.
+func (se *StorageEngine) indexJoinColumn(right joinInput, join types.JoinClause, rightKeys []string) (types.ColumnDef, bool) {
+	if right.table == "" || len(rightKeys) != 1 {
+		return types.ColumnDef{}, false
+	}
+	switch strings.ToUpper(join.Type) {
+	case "INNER", "LEFT", "":
+	default:
+		return types.ColumnDef{}, false
+	}
+
+	schema, err := se.CatalogManager.GetTableSchema(right.table)
+	if err != nil {
+		return types.ColumnDef{}, false
+	}
+	for _, col := range schema.Columns {
+		if col.IsPrimaryKey && rightKeys[0] == join.Name()+"."+col.Name {
+			return col, true
+		}
+	}
+	return types.ColumnDef{}, false
+}
+
+// indexNestedLoopJoin joins left with right's table by probing its primary key
+// index with the leftKey column of every left row.
+func (se *StorageEngine) indexNestedLoopJoin(snap *txn.Snapshot, left []map[string]interface{}, right joinInput, refName, leftKey string, pkCol types.ColumnDef, keepLeft bool) ([]map[string]interface{}, error) {
+	schema, err := se.CatalogManager.GetTableSchema(right.table)
+	if err != nil {
+		return nil, err
+	}
+	btree, err := se.GetIndex(right.table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index: %w", err)
+	}
+
+	keep := make(map[string]bool, len(right.keys))
+	for _, key := range right.keys {
+		keep[key] = true
+	}
+
+	result := []map[string]interface{}{}
+	for _, row := range left {
+		keys, ok := encodeKeyValues(pkCol, &types.ExpressionNode{Type: types.ExprLiteral, Literal: row[leftKey]})
+		if !ok {
+			return nil, fmt.Errorf("JOIN %s: can not use %v as a %s key", refName, row[leftKey], pkCol.Type)
+		}
+		if err := se.readKeys(snap, right.table, schema, keys); err != nil {
+			return nil, err
+		}
+		rowPtrs, err := se.lookupRowPointers(btree, keys)
+		if err != nil {
+			return nil, err
+		}
+
+		var rowPtr *types.RowPointer
+		if len(rowPtrs) > 0 {
+			if rowPtr, err = se.visibleIndexEntry(snap, rowPtrs[0]); err != nil {
+				return nil, fmt.Errorf("failed to decode row pointer: %w", err)
+			}
+		}
+		if rowPtr == nil {
+			if keepLeft {
+				result = append(result, se.copyRowWithNulls(row))
+			}
+			continue
+		}
+
+		rawRow, err := se.HeapManager.GetRow(rowPtr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		values, err := se.DeserializeRow(rawRow, schema.Columns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize row: %w", err)
+		}
+
+		match := make(map[string]interface{}, len(right.keys))
+		for i, col := range schema.Columns {
+			if key := refName + "." + col.Name; keep[key] {
+				match[key] = values[i]
+			}
+		}
+
+		ok = true
+		if right.filter != nil {
+			if ok, err = types.EvalPredicate(right.filter, match); err != nil {
+				return nil, fmt.Errorf("error evaluating WHERE: %w", err)
+			}
+		}
+		switch {
+		case ok:
+			result = append(result, mergeRows(row, match))
+		case keepLeft:
+			result = append(result, se.copyRowWithNulls(row))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,251 @@
+package storageengine
+
+import (
+	"math"
+	"math/bits"
+	"strings"
+
+	"DaemonDB/types"
+)
+
+/*
+This file contains the join order search.
+
+Inner joins can run in any order once the rewriter has moved every join
+predicate into an ON clause (rewrite.go). When all joins of a query are INNER
+or CROSS joins (USING and NATURAL merge columns, so their order is kept), and
+every table of the query has statistics, the order with the lowest estimated
+cost is found by dynamic programming over left-deep trees:
+
+	best({i})   = read item i
+	best(S)     = min over j in S of  best(S - j) ⋈ j
+	cost(P ⋈ j) = cost(P) + cost of the cheapest join algorithm + rows(P ⋈ j)
+	rows(P ⋈ j) = rows(P) · rows(j) · selectivity of the predicates joining j to P
+
+An equality a.x = b.y keeps 1 / max(distinct(a.x), distinct(b.y)) of the row
+pairs, any other predicate defaultSelectivity. A join without a predicate (a
+cartesian product) is only considered when no item of S has one. Queries of up
+to maxJoinOrderItems FROM items are ordered (2^n subsets); larger ones, and
+plans no cheaper than the written order, keep the written order.
+
+Every predicate then goes to the ON clause of the first join at which all the
+items it references are joined.
+*/
+
+const maxJoinOrderItems = 10
+
+// joinPredicate is one conjunct of the ON clauses of a query.
+type joinPredicate struct {
+	expr  *types.ExpressionNode
+	items uint // bit i: references FROM item i
+	equi  bool // column = column of two items
+	cols  [2]string
+	sides [2]int
+	sel   float64
+}
+
+type joinOrderPlan struct {
+	order []int
+	rows  float64
+	cost  float64
+}
+
+// orderJoins returns the order to join the FROM items in and the joins that
+// add items order[1:] to order[0]. Without a better order it returns the
+// written one.
+func (se *StorageEngine) orderJoins(payload *types.SelectPayload, rw *joinRewriter, inputs []joinInput) ([]int, []types.JoinClause) {
+	n := len(rw.refs)
+	written := make([]int, n)
+	for i := range written {
+		written[i] = i
+	}
+
+	preds, ok := se.joinPredicates(payload, rw, inputs)
+	if !ok || n < 2 || n > maxJoinOrderItems {
+		return written, payload.Joins
+	}
+
+	// primary key of every base table; only those can be probed
+	pks := make([]string, n)
+	for i, ref := range rw.refs {
+		if ref.Subquery != nil {
+			continue
+		}
+		schema, err := se.CatalogManager.GetTableSchema(ref.Table)
+		if err != nil {
+			return written, payload.Joins
+		}
+		for _, col := range schema.Columns {
+			if col.IsPrimaryKey {
+				pks[i] = strings.ToLower(col.Name)
+			}
+		}
+	}
+
+	step := func(prev *joinOrderPlan, j int) *joinOrderPlan {
+		set := uint(0)
+		for _, i := range prev.order {
+			set |= 1 << i
+		}
+		bit := uint(1) << j
+
+		rows := prev.rows * float64(inputs[j].size)
+		equi, probes := false, 0
+		for _, p := range preds {
+			if p.items&bit == 0 || p.items&^(set|bit) != 0 {
+				continue
+			}
+			rows *= p.sel
+			if !p.equi {
+				continue
+			}
+			equi = true
+			for k := range p.sides {
+				if p.sides[k] == j && p.cols[k] == pks[j] {
+					probes++
+				}
+			}
+		}
+
+		l, r := prev.rows, float64(inputs[j].size)
+		cost := l * r // block nested-loop
+		if equi {
+			sortMerge := l*math.Log2(l+1) + r*math.Log2(r+1) + l + r
+			cost = math.Min(sortMerge, se.hashJoinCost(l, r))
+			if probes == 1 && inputs[j].table != "" {
+				cost = math.Min(cost, indexJoinCost(l, r))
+			}
+		}
+
+		order := append(append([]int{}, prev.order...), j)
+		return &joinOrderPlan{order: order, rows: rows, cost: prev.cost + cost + rows}
+	}
+
+	// linked reports whether a predicate joins item j to the items of set
+	linked := func(set uint, j int) bool {
+		bit := uint(1) << j
+		for _, p := range preds {
+			if p.items&bit != 0 && p.items&set != 0 && p.items&^(set|bit) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	full := uint(1)<<n - 1
+	best := make([]*joinOrderPlan, full+1)
+	for i := 0; i < n; i++ {
+		best[1<<i] = &joinOrderPlan{order: []int{i}, rows: float64(inputs[i].size)}
+	}
+	for set := uint(1); set <= full; set++ {
+		if bits.OnesCount(set) < 2 {
+			continue
+		}
+		connected := false
+		for j := 0; j < n && !connected; j++ {
+			connected = set&(1<<j) != 0 && linked(set&^(1<<j), j)
+		}
+		for j := 0; j < n; j++ {
+			bit := uint(1) << j
+			if set&bit == 0 || (connected && !linked(set&^bit, j)) {
+				continue
+			}
+			plan := step(best[set&^bit], j)
+			if best[set] == nil || plan.cost < best[set].cost {
+				best[set] = plan
+			}
+		}
+	}
+
+	plan := best[1]
+	for j := 1; j < n; j++ {
+		plan = step(plan, j)
+	}
+	if best[full].cost >= plan.cost*(1-1e-9) {
+		return written, payload.Joins
+	}
+	order := best[full].order
+
+	joins := make([]types.JoinClause, 0, n-1)
+	set := uint(1) << order[0]
+	used := make([]bool, len(preds))
+	for _, i := range order[1:] {
+		set |= 1 << i
+		join := types.JoinClause{TableRef: rw.refs[i], Type: "CROSS"}
+		for k, p := range preds {
+			if !used[k] && p.items&^set == 0 {
+				used[k] = true
+				join.On = andExpr(join.On, p.expr)
+			}
+		}
+		if join.On != nil {
+			join.Type = "INNER"
+		}
+		joins = append(joins, join)
+	}
+	return order, joins
+}
+
+// joinPredicates collects the ON conjuncts of a query whose joins can be
+// reordered, with their estimated selectivity. ok is false when they can not.
+func (se *StorageEngine) joinPredicates(payload *types.SelectPayload, rw *joinRewriter, inputs []joinInput) ([]joinPredicate, bool) {
+	stats := make([]types.TableStats, len(rw.refs))
+	for i, ref := range rw.refs {
+		if ref.Subquery != nil {
+			continue
+		}
+		var ok bool
+		if stats[i], ok = se.CatalogManager.GetTableStats(ref.Table); !ok {
+			return nil, false
+		}
+	}
+
+	// distinct values of column col of item i, or the row count without statistics
+	distinct := func(i int, col string) float64 {
+		if colStats, ok := stats[i].Columns[col]; ok && colStats.Distinct > 0 {
+			return float64(colStats.Distinct)
+		}
+		return math.Max(1, float64(inputs[i].size))
+	}
+
+	preds := []joinPredicate{}
+	for _, join := range payload.Joins {
+		switch strings.ToUpper(join.Type) {
+		case "", "INNER", "CROSS":
+		default:
+			return nil, false
+		}
+		if join.Natural || len(join.Using) > 0 {
+			return nil, false
+		}
+
+		for _, conj := range splitConjuncts(join.On) {
+			if b, isBool := boolLiteral(conj); isBool && b {
+				continue
+			}
+			items, ok := rw.itemsOf(conj)
+			if !ok || len(items) < 2 {
+				return nil, false
+			}
+			p := joinPredicate{expr: conj, sel: defaultSelectivity}
+			for i := range items {
+				p.items |= 1 << i
+			}
+
+			if conj.Type == types.ExprComparison && conj.Op == "=" &&
+				conj.Left.Type == types.ExprColumn && conj.Right.Type == types.ExprColumn {
+				for k, col := range []string{conj.Left.Column, conj.Right.Column} {
+					name := strings.ToLower(col)
+					p.cols[k] = name[strings.LastIndex(name, ".")+1:]
+					p.sides[k] = rw.itemOf(col)
+				}
+				if p.sides[0] != p.sides[1] {
+					p.equi = true
+					p.sel = 1 / math.Max(distinct(p.sides[0], p.cols[0]), distinct(p.sides[1], p.cols[1]))
+				}
+			}
+			preds = append(preds, p)
+		}
+	}
+	return preds, true
+}
@@ -0,0 +1,693 @@
+package storageengine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+)
+
+/*
+This file contains the execution of multi-way joins.
+
+	FROM a [AS x] JOIN b [AS y] ON x.k = y.k JOIN c USING (k2) NATURAL JOIN d ...
+
+The joins are applied left to right (a left-deep tree), in the written order
+or, for inner joins over analyzed tables, the cheapest one (join_order.go).
+Every row of a join is keyed "name.column", where name is the alias of the FROM
+item or, without an alias, the table name, so both sides of a self-join stay
+apart.
+
+	ON      any condition; its column equalities between the two sides are
+	        the join key, the other conjuncts are checked on the joined rows
+	USING   equality on the listed columns; the column is output once,
+	        unqualified, as COALESCE(left, right)
+	NATURAL USING over every column name the two sides share
+	CROSS   no condition (also FROM a, b)
+
+Each join picks the cheapest of three algorithms (costs in rows touched):
+
+	sort-merge          sort(L) + sort(R) + L + R, a sort is free when the
+	                    input is already ordered on the key (previous merge join)
+	hash                B + P, B the smaller side; 3·(B + P) when B exceeds the
+	                    join memory budget and the partitions spill (hash_join.go)
+	index nested-loop   L · (log2 R + 1); only when the right side is a table
+	                    joined on its primary key, INNER or LEFT (index_join.go)
+
+The right table is only read when the chosen algorithm needs its rows; its size
+is estimated from its statistics (cost.go) or, for a table never analyzed, is
+the row count of its heap file.
+
+A join without a join key (CROSS, band joins), or an outer join whose ON clause
+has more than the key, runs as a block nested-loop join (nested_loop_join.go).
+*/
+
+type joinStrategy int
+
+const (
+	joinSortMerge joinStrategy = iota
+	joinHash
+	joinIndexNL
+	joinBlockNL
+)
+
+func (s joinStrategy) String() string {
+	switch s {
+	case joinHash:
+		return "hash"
+	case joinIndexNL:
+		return "index nested-loop"
+	case joinBlockNL:
+		return "block nested-loop"
+	}
+	return "merge"
+}
+
+type joinPlan struct {
+	strategy joinStrategy
+	pkCol    types.ColumnDef // joinIndexNL: the probed primary key
+	cost     float64         // estimated, in rows touched
+}
+
+// joinInput is an intermediate join result.
+type joinInput struct {
+	rows     []map[string]interface{}
+	keys     []string              // every key a row may hold
+	display  []string              // the columns SELECT * shows, in order
+	table    string                // base table whose rows have not been read yet
+	filter   *types.ExpressionNode // pushed-down predicate of table
+	size     int                   // number of rows
+	sortedOn []string              // key columns the rows are known to be ordered by
+	distinct map[string]float64    // distinct values of a key, from the table statistics
+	plan     *types.PlanNode       // the operator producing the rows (EXPLAIN)
+}
+
+// joinStep is how one join runs: its type, the key columns compared on each
+// side, the USING columns it merges, the rest of its ON clause and its
+// algorithm.
+type joinStep struct {
+	joinType  string
+	leftKeys  []string
+	rightKeys []string
+	using     []string
+	residual  *types.ExpressionNode
+	plan      joinPlan
+}
+
+// executeSelectWithJoin handles queries with one or more JOINs. needed lists
+// the columns the query references (nil: all), see neededColumns.
+func (se *StorageEngine) executeSelectWithJoin(snap *txn.Snapshot, payload types.SelectPayload, needed map[string]bool) ([]map[string]interface{}, []string, *types.PlanNode, error) {
+	filters, rw, err := se.rewriteJoins(&payload)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	inputs := make([]joinInput, len(rw.refs))
+	for i, ref := range rw.refs {
+		if inputs[i], err = se.openFromItem(snap, ref, filters[i], needed); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return se.joinFromItems(snap, payload, rw, inputs)
+}
+
+// joinFromItems joins the opened FROM items of payload, in the order the
+// planner picks, and applies what is left of its WHERE clause.
+func (se *StorageEngine) joinFromItems(snap *txn.Snapshot, payload types.SelectPayload, rw *joinRewriter, inputs []joinInput) ([]map[string]interface{}, []string, *types.PlanNode, error) {
+	// the joins are planned once, on estimates, exactly as EXPLAIN plans them:
+	// a derived table counts as its estimated size, not as the rows it returned
+	estimated := append([]joinInput{}, inputs...)
+	for i, ref := range rw.refs {
+		if ref.Subquery != nil {
+			estimated[i].size = int(math.Ceil(estimated[i].plan.EstRows))
+		}
+	}
+	order, joins := se.orderJoins(&payload, rw, estimated)
+	steps, _, err := se.planJoins(estimated, order, joins)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	left := inputs[order[0]]
+	if err := se.readFromItem(snap, &left, rw.refs[order[0]]); err != nil {
+		return nil, nil, nil, err
+	}
+	for i, join := range joins {
+		if left, err = se.joinInputs(snap, left, inputs[order[i+1]], join, steps[i]); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// SELECT * shows the columns in FROM order, whatever order the joins ran in
+	if !sort.IntsAreSorted(order) {
+		left.display = nil
+		for _, in := range inputs {
+			left.display = append(left.display, in.display...)
+		}
+	}
+
+	// Apply WHERE filter if present.
+	rows, plan := left.rows, left.plan
+	if payload.WhereExpr != nil {
+		m := se.startOp()
+		if rows, err = se.filterJoinedRows(rows, payload); err != nil {
+			return nil, nil, nil, err
+		}
+		plan = filterNode(plan, payload)
+		se.finishOp(plan, m, len(rows), left.plan)
+	}
+	return rows, left.display, plan, nil
+}
+
+// openFromItem returns the shape and size of a FROM item. A derived table is
+// executed (and filtered) right away; the rows of a base table are left unread.
+// Only the columns in needed are kept (nil: all).
+func (se *StorageEngine) openFromItem(snap *txn.Snapshot, ref types.TableRef, filter *types.ExpressionNode, needed map[string]bool) (joinInput, error) {
+	name := ref.Name()
+
+	if ref.Subquery != nil {
+		m := se.startOp()
+		rows, cols, innerPlan, err := se.executeSelect(snap, *ref.Subquery)
+		if err != nil {
+			return joinInput{}, fmt.Errorf("subquery %s: %w", name, err)
+		}
+		kept, keys := derivedKeys(name, cols, needed)
+		filtered := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			qualified := make(map[string]interface{}, len(keys))
+			for k, col := range kept {
+				qualified[keys[k]] = row[col]
+			}
+			if filter != nil {
+				match, err := types.EvalPredicate(filter, qualified)
+				if err != nil {
+					return joinInput{}, fmt.Errorf("error evaluating WHERE: %w", err)
+				}
+				if !match {
+					continue
+				}
+			}
+			filtered = append(filtered, qualified)
+		}
+		plan := derivedNode(name, innerPlan, filter)
+		se.finishOp(plan, m, len(filtered))
+		return joinInput{rows: filtered, keys: keys, display: keys, size: len(filtered), plan: plan}, nil
+	}
+
+	schema, err := se.CatalogManager.GetTableSchema(ref.Table)
+	if err != nil {
+		return joinInput{}, fmt.Errorf("failed to load table %s: %w", ref.Table, err)
+	}
+	hf, err := se.HeapManager.GetHeapFileByTable(ref.Table)
+	if err != nil {
+		return joinInput{}, fmt.Errorf("failed to load table %s: %w", ref.Table, err)
+	}
+	stats, analyzed := se.tableStats(ref.Table)
+
+	keys := []string{}
+	distinct := map[string]float64{}
+	for _, col := range schema.Columns {
+		if !keepColumn(needed, col.Name) {
+			continue
+		}
+		key := name + "." + col.Name
+		keys = append(keys, key)
+		if colStats, ok := stats.Columns[strings.ToLower(col.Name)]; ok && analyzed {
+			distinct[key] = float64(colStats.Distinct)
+		}
+	}
+
+	path := accessPath{kind: accessFullScan}
+	if filter != nil {
+		path = se.chooseAccessPath(name, schema, filter)
+	}
+
+	var size int
+	if analyzed {
+		size = int(math.Ceil(estimateRows(stats, filter)))
+	} else {
+		size = len(hf.GetAllRowPointers())
+		if path.kind == accessPKPoints || (path.kind == accessPKRange && path.keys != nil) {
+			size = len(path.keys)
+		}
+	}
+	return joinInput{
+		keys:     keys,
+		display:  keys,
+		table:    ref.Table,
+		filter:   filter,
+		size:     size,
+		distinct: distinct,
+		plan:     se.scanNode(ref.Table, name, path, filter),
+	}, nil
+}
+
+// derivedKeys returns the columns of a derived table name (of all its columns
+// cols) that are kept, and their row keys.
+func derivedKeys(name string, cols []string, needed map[string]bool) (kept, keys []string) {
+	for _, col := range cols {
+		if keepColumn(needed, col[strings.LastIndex(col, ".")+1:]) {
+			kept = append(kept, col)
+			keys = append(keys, name+"."+col)
+		}
+	}
+	return kept, keys
+}
+
+func keepColumn(needed map[string]bool, col string) bool {
+	return needed == nil || needed[strings.ToLower(col)]
+}
+
+// readFromItem reads the rows of a base table opened by openFromItem.
+func (se *StorageEngine) readFromItem(snap *txn.Snapshot, in *joinInput, ref types.TableRef) error {
+	if in.table == "" {
+		return nil
+	}
+	keep := make(map[string]bool, len(in.keys))
+	for _, key := range in.keys {
+		keep[key] = true
+	}
+	m := se.startOp()
+	rows, err := se.loadTableRows(snap, in.table, ref.Name(), keep, in.filter)
+	if err != nil {
+		return fmt.Errorf("failed to load table %s: %w", in.table, err)
+	}
+	se.finishOp(in.plan, m, len(rows))
+	in.rows, in.size, in.table = rows, len(rows), ""
+	return nil
+}
+
+// streamFromItem reads the rows of the base table of in like readFromItem, but
+// hands them to emit one at a time instead of keeping them. The scan's time
+// includes what emit does with the rows.
+func (se *StorageEngine) streamFromItem(snap *txn.Snapshot, in *joinInput, ref types.TableRef, emit func(map[string]interface{}) error) error {
+	keep := make(map[string]bool, len(in.keys))
+	for _, key := range in.keys {
+		keep[key] = true
+	}
+	m := se.startOp()
+	n := 0
+	err := se.scanTableRows(snap, in.table, ref.Name(), keep, in.filter, func(row map[string]interface{}) error {
+		n++
+		return emit(row)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load table %s: %w", in.table, err)
+	}
+	se.finishOp(in.plan, m, n)
+	in.size, in.table = n, ""
+	return nil
+}
+
+// planJoin picks the join algorithm with the lowest estimated cost.
+func (se *StorageEngine) planJoin(left, right joinInput, join types.JoinClause, leftKeys, rightKeys []string) joinPlan {
+	l, r := float64(left.size), float64(right.size)
+
+	best := joinPlan{strategy: joinSortMerge, cost: sortCost(left, leftKeys) + sortCost(right, rightKeys) + l + r}
+
+	if cost := se.hashJoinCost(l, r); cost < best.cost {
+		best = joinPlan{strategy: joinHash, cost: cost}
+	}
+
+	if pkCol, ok := se.indexJoinColumn(right, join, rightKeys); ok {
+		if cost := indexJoinCost(l, r); cost < best.cost {
+			best = joinPlan{strategy: joinIndexNL, pkCol: pkCol, cost: cost}
+		}
+	}
+	return best
+}
+
+// hashJoinCost is the cost of hash joining l and r rows.
+func (se *StorageEngine) hashJoinCost(l, r float64) float64 {
+	build, probe := math.Min(l, r), math.Max(l, r)
+	cost := build + probe
+	if build > float64(se.joinMemoryRows) {
+		cost *= 3 // write and read back both inputs
+	}
+	return cost
+}
+
+// indexJoinCost is the cost of probing the index of a table of r rows with l rows.
+func indexJoinCost(l, r float64) float64 {
+	return l * (math.Log2(r+1) + 1)
+}
+
+// sortCost is the cost of sorting in on keys; nothing if it already is.
+func sortCost(in joinInput, keys []string) float64 {
+	if isSortedOn(in, keys) {
+		return 0
+	}
+	n := float64(in.size)
+	return n * math.Log2(n+1)
+}
+
+func isSortedOn(in joinInput, keys []string) bool {
+	if len(in.sortedOn) < len(keys) {
+		return false
+	}
+	for i, key := range keys {
+		if in.sortedOn[i] != key {
+			return false
+		}
+	}
+	return true
+}
+
+// prepareJoin works out how join runs: the keys it compares and the algorithm.
+func (se *StorageEngine) prepareJoin(left, right joinInput, join types.JoinClause) (joinStep, error) {
+	step := joinStep{joinType: strings.ToUpper(join.Type)}
+	switch step.joinType {
+	case "":
+		step.joinType = "INNER"
+	case "INNER", "LEFT", "RIGHT", "FULL", "CROSS":
+	default:
+		return joinStep{}, fmt.Errorf("unsupported join type: %s", join.Type)
+	}
+
+	var err error
+	step.leftKeys, step.rightKeys, step.using, step.residual, err = joinKeyColumns(left, right, join)
+	if err != nil {
+		return joinStep{}, err
+	}
+
+	// the residual of an outer join decides which rows are matched, so it can
+	// not be applied after the join
+	step.plan = joinPlan{strategy: joinBlockNL, cost: float64(left.size) * float64(right.size)}
+	if len(step.leftKeys) > 0 && (step.residual == nil || step.joinType == "INNER") {
+		step.plan = se.planJoin(left, right, join, step.leftKeys, step.rightKeys)
+	}
+	return step, nil
+}
+
+// joinedInput returns the shape of the result of joining right to left: its
+// keys, the columns SELECT * shows and its plan node, without rows.
+func (se *StorageEngine) joinedInput(left, right joinInput, join types.JoinClause, step joinStep) joinInput {
+	out := joinInput{
+		keys:     append(append([]string{}, left.keys...), right.keys...),
+		distinct: make(map[string]float64, len(left.distinct)+len(right.distinct)),
+		plan:     joinNode(left, right, join, step),
+	}
+	for _, in := range []joinInput{left, right} {
+		for key, d := range in.distinct {
+			out.distinct[key] = d
+		}
+	}
+
+	if len(step.using) == 0 {
+		out.display = append(append([]string{}, left.display...), right.display...)
+		return out
+	}
+
+	// USING / NATURAL: one merged, unqualified column per join column, shown first
+	merged := map[string]bool{}
+	for i, name := range step.using {
+		merged[step.leftKeys[i]] = true
+		merged[step.rightKeys[i]] = true
+		if !containsFold(out.keys, name) {
+			out.keys = append(out.keys, name)
+		}
+	}
+	out.display = append([]string{}, step.using...)
+	for _, col := range append(append([]string{}, left.display...), right.display...) {
+		if !merged[col] {
+			out.display = append(out.display, col)
+		}
+	}
+	return out
+}
+
+// planJoins works out how each of joins runs, the FROM items joined in order,
+// on the estimated size of every input and intermediate result. It returns
+// the steps and the estimated result of the last join.
+func (se *StorageEngine) planJoins(inputs []joinInput, order []int, joins []types.JoinClause) ([]joinStep, joinInput, error) {
+	steps := make([]joinStep, len(joins))
+	left := inputs[order[0]]
+	for i, join := range joins {
+		right := inputs[order[i+1]]
+		step, err := se.prepareJoin(left, right, join)
+		if err != nil {
+			return nil, joinInput{}, err
+		}
+		out := se.joinedInput(left, right, join, step)
+		out.size = int(math.Ceil(out.plan.EstRows))
+		out.sortedOn = expectedOrder(left, right, step)
+		steps[i], left = step, out
+	}
+	return steps, left, nil
+}
+
+// expectedOrder is the key order the result of a join will have, as far as
+// it can be known before it runs (joinInputs).
+func expectedOrder(left, right joinInput, step joinStep) []string {
+	switch step.plan.strategy {
+	case joinSortMerge:
+		switch step.joinType {
+		case "INNER", "LEFT":
+			return step.leftKeys
+		case "RIGHT":
+			return step.rightKeys
+		}
+	case joinHash:
+		if left.size >= right.size && step.joinType != "RIGHT" && step.joinType != "FULL" {
+			return left.sortedOn
+		}
+	case joinIndexNL:
+		return left.sortedOn
+	}
+	return nil
+}
+
+// joinInputs joins right to left according to join, as planned in step.
+func (se *StorageEngine) joinInputs(snap *txn.Snapshot, left, right joinInput, join types.JoinClause, step joinStep) (joinInput, error) {
+	var err error
+	joinType, leftKeys, rightKeys, residual := step.joinType, step.leftKeys, step.rightKeys, step.residual
+	m := se.startOp()
+
+	var rows []map[string]interface{}
+	var sortedOn []string
+	var spilled spillStats
+	switch step.plan.strategy {
+	case joinIndexNL:
+		rows, err = se.indexNestedLoopJoin(snap, left.rows, right, join.Name(), leftKeys[0], step.plan.pkCol, joinType == "LEFT")
+		sortedOn = left.sortedOn
+	case joinBlockNL:
+		if err := se.readFromItem(snap, &right, join.TableRef); err != nil {
+			return joinInput{}, err
+		}
+		rows, err = se.blockNestedLoopJoin(left.rows, right.rows, join.On,
+			joinType == "LEFT" || joinType == "FULL", joinType == "RIGHT" || joinType == "FULL")
+		residual = nil
+	case joinHash:
+		rows, sortedOn, spilled, err = se.hashJoinInputs(snap, left, &right, join.TableRef, joinType, leftKeys, rightKeys)
+	default:
+		if err := se.readFromItem(snap, &right, join.TableRef); err != nil {
+			return joinInput{}, err
+		}
+		rows, sortedOn = se.mergeJoinInputs(left, right, joinType, leftKeys, rightKeys)
+	}
+	if err != nil {
+		return joinInput{}, err
+	}
+
+	if residual != nil {
+		filtered := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			match, err := types.EvalPredicate(residual, row)
+			if err != nil {
+				return joinInput{}, fmt.Errorf("error evaluating ON: %w", err)
+			}
+			if match {
+				filtered = append(filtered, row)
+			}
+		}
+		rows = filtered
+	}
+
+	out := se.joinedInput(left, right, join, step)
+	out.rows, out.size, out.sortedOn = rows, len(rows), sortedOn
+
+	// Outer joins: columns of the missing side are NULL, not absent, so a
+	// qualified reference never falls back to a same-named column of the other side.
+	for _, row := range rows {
+		for _, key := range out.keys {
+			if _, ok := row[key]; !ok {
+				row[key] = nil
+			}
+		}
+	}
+
+	// USING / NATURAL: the merged column holds whichever side is not NULL
+	for i, name := range step.using {
+		for _, row := range rows {
+			val := row[leftKeys[i]]
+			if val == nil {
+				val = row[rightKeys[i]]
+			}
+			row[name] = val
+		}
+	}
+
+	se.finishOp(out.plan, m, len(rows), left.plan)
+	spilled.record(out.plan)
+	return out, nil
+}
+
+// mergeJoinInputs sort-merge joins left and right; the result is ordered on
+// the returned key columns.
+func (se *StorageEngine) mergeJoinInputs(left, right joinInput, joinType string, leftKeys, rightKeys []string) ([]map[string]interface{}, []string) {
+	if !isSortedOn(left, leftKeys) {
+		se.sortRowsByColumns(left.rows, leftKeys)
+	}
+	if !isSortedOn(right, rightKeys) {
+		se.sortRowsByColumns(right.rows, rightKeys)
+	}
+
+	switch joinType {
+	case "LEFT":
+		return se.mergeSortOuterJoin(left.rows, right.rows, leftKeys, rightKeys), leftKeys
+	case "RIGHT":
+		return se.mergeSortOuterJoin(right.rows, left.rows, rightKeys, leftKeys), rightKeys
+	case "FULL":
+		return se.mergeSortFullJoin(left.rows, right.rows, leftKeys, rightKeys), nil
+	}
+	return se.mergeSortInnerJoin(left.rows, right.rows, leftKeys, rightKeys), leftKeys
+}
+
+// hashJoinInputs hash joins left and right, building on the smaller side. The
+// result keeps the order of left when left is probed in memory. A right table
+// not read yet that is expected to be the larger side is not loaded: its rows
+// are probed (or partitioned) as they are read from the heap.
+func (se *StorageEngine) hashJoinInputs(snap *txn.Snapshot, left joinInput, right *joinInput, ref types.TableRef, joinType string, leftKeys, rightKeys []string) (rows []map[string]interface{}, sortedOn []string, spilled spillStats, err error) {
+	keepLeft := joinType == "LEFT" || joinType == "FULL"
+	keepRight := joinType == "RIGHT" || joinType == "FULL"
+
+	if right.table != "" && left.size < right.size {
+		stream := func(emit func(map[string]interface{}) error) error {
+			return se.streamFromItem(snap, right, ref, emit)
+		}
+		rows, spilled, err = se.hashJoin(left.rows, stream, leftKeys, rightKeys, keepLeft, keepRight)
+		return rows, nil, spilled, err
+	}
+
+	if err := se.readFromItem(snap, right, ref); err != nil {
+		return nil, nil, spilled, err
+	}
+	if len(left.rows) < len(right.rows) {
+		rows, spilled, err = se.hashJoin(left.rows, sliceFeed(right.rows), leftKeys, rightKeys, keepLeft, keepRight)
+		return rows, nil, spilled, err
+	}
+	rows, spilled, err = se.hashJoin(right.rows, sliceFeed(left.rows), rightKeys, leftKeys, keepRight, keepLeft)
+	if spilled.partitions > 0 || keepRight {
+		return rows, nil, spilled, err
+	}
+	return rows, left.sortedOn, spilled, err
+}
+
+// joinKeyColumns returns the row keys compared by the join on each side, for
+// USING / NATURAL joins the names of the merged output columns, and the part
+// of an ON clause that is not a column equality between the two sides.
+func joinKeyColumns(left, right joinInput, join types.JoinClause) (leftKeys, rightKeys, using []string, residual *types.ExpressionNode, err error) {
+	switch {
+	case strings.EqualFold(join.Type, "CROSS"):
+		return nil, nil, nil, nil, nil
+	case join.Natural:
+		for _, key := range right.keys {
+			name := key[strings.LastIndex(key, ".")+1:]
+			if _, err := resolveRowKey(left.keys, name); err == nil {
+				using = append(using, name)
+			}
+		}
+		if len(using) == 0 {
+			return nil, nil, nil, nil, fmt.Errorf("NATURAL JOIN %s: no common columns", join.Name())
+		}
+	case len(join.Using) > 0:
+		using = join.Using
+	case join.On != nil:
+		for _, conj := range splitConjuncts(join.On) {
+			if lk, rk, ok := equiJoinKey(left, right, conj); ok {
+				leftKeys = append(leftKeys, lk)
+				rightKeys = append(rightKeys, rk)
+				continue
+			}
+			if residual == nil {
+				residual = conj
+			} else {
+				residual = &types.ExpressionNode{Type: types.ExprLogical, Op: "AND", Left: residual, Right: conj}
+			}
+		}
+		return leftKeys, rightKeys, nil, residual, nil
+	default:
+		return nil, nil, nil, nil, fmt.Errorf("JOIN %s: missing join condition", join.Name())
+	}
+
+	for _, name := range using {
+		lk, err := resolveRowKey(left.keys, name)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("USING column %s: %w", name, err)
+		}
+		rk, err := resolveRowKey(right.keys, name)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("USING column %s: %w", name, err)
+		}
+		leftKeys = append(leftKeys, lk)
+		rightKeys = append(rightKeys, rk)
+	}
+	return leftKeys, rightKeys, using, nil, nil
+}
+
+// equiJoinKey reports whether conj is "column = column" with one column on
+// each side of the join, and returns the two row keys.
+func equiJoinKey(left, right joinInput, conj *types.ExpressionNode) (leftKey, rightKey string, ok bool) {
+	if conj.Type != types.ExprComparison || conj.Op != "=" ||
+		conj.Left.Type != types.ExprColumn || conj.Right.Type != types.ExprColumn {
+		return "", "", false
+	}
+	for _, pair := range [][2]string{{conj.Left.Column, conj.Right.Column}, {conj.Right.Column, conj.Left.Column}} {
+		lk, lerr := resolveRowKey(left.keys, pair[0])
+		rk, rerr := resolveRowKey(right.keys, pair[1])
+		if lerr == nil && rerr == nil {
+			return lk, rk, true
+		}
+	}
+	return "", "", false
+}
+
+// resolveRowKey finds the row key a column reference names: an exact
+// (case-insensitive) match, or else the only key ending in ".column".
+func resolveRowKey(keys []string, column string) (string, error) {
+	for _, key := range keys {
+		if strings.EqualFold(key, column) {
+			return key, nil
+		}
+	}
+	if strings.Contains(column, ".") {
+		return "", fmt.Errorf("column %s not found", column)
+	}
+
+	found := ""
+	suffix := "." + strings.ToLower(column)
+	for _, key := range keys {
+		if strings.HasSuffix(strings.ToLower(key), suffix) {
+			if found != "" {
+				return "", fmt.Errorf("column reference %s is ambiguous", column)
+			}
+			found = key
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("column %s not found", column)
+	}
+	return found, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
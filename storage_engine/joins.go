@@ -2,67 +2,93 @@ package storageengine
 
 import (
 	"DaemonDB/types"
-	"fmt"
 	"sort"
-	"strings"
 )
 
 /*
 This file contains JOIN implementation using merge sort algo
+Join keys may span several columns (USING (a, b), ON x.a = y.a AND x.b = y.b);
+rows are ordered by comparing the key columns one after another.
+Semi / anti joins (used for decorrelated IN and EXISTS subqueries) share the
+same sorted merge.
 */
 
-func (se *StorageEngine) sortRowsByColumn(rows []map[string]interface{}, colName string) {
+func (se *StorageEngine) sortRowsByColumns(rows []map[string]interface{}, cols []string) {
 	sort.Slice(rows, func(i, j int) bool {
-		return types.CompareValues(rows[i][colName], rows[j][colName]) < 0
+		return compareKeys(rows[i], rows[j], cols, cols) < 0
 	})
 }
 
-func (se *StorageEngine) mergeSortInnerJoin(left, right []map[string]interface{}, leftCol, rightCol string) []map[string]interface{} {
+// compareKeys compares the key of left (leftCols) with the key of right (rightCols).
+func compareKeys(left, right map[string]interface{}, leftCols, rightCols []string) int {
+	for k := range leftCols {
+		if cmp := types.CompareValues(left[leftCols[k]], right[rightCols[k]]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// hasNullKey reports whether any key column of row is NULL; such rows never match.
+func hasNullKey(row map[string]interface{}, cols []string) bool {
+	for _, col := range cols {
+		if row[col] == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeRows(left, right map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(left)+len(right))
+	for k, v := range left {
+		merged[k] = v
+	}
+	for k, v := range right {
+		merged[k] = v
+	}
+	return merged
+}
+
+func (se *StorageEngine) mergeSortInnerJoin(left, right []map[string]interface{}, leftCols, rightCols []string) []map[string]interface{} {
 	result := []map[string]interface{}{}
 	i, j := 0, 0
 	lenL, lenR := len(left), len(right)
 	for i < lenL && j < lenR {
-		leftVal := left[i][leftCol]
-		rightVal := right[j][rightCol]
+		leftNull := hasNullKey(left[i], leftCols)
+		rightNull := hasNullKey(right[j], rightCols)
 
-		if leftVal == nil || rightVal == nil {
-			if leftVal == nil {
+		if leftNull || rightNull {
+			if leftNull {
 				i++
 			}
-			if rightVal == nil {
+			if rightNull {
 				j++
 			}
 			continue
 		}
 
-		cmp := types.CompareValues(leftVal, rightVal)
+		cmp := compareKeys(left[i], right[j], leftCols, rightCols)
 
 		if cmp < 0 {
 			i++
 		} else if cmp > 0 {
 			j++
 		} else {
-			target := left[i][leftCol]
+			target := left[i]
 			leftStart := i
-			for i < len(left) && types.CompareValues(left[i][leftCol], target) == 0 {
+			for i < len(left) && compareKeys(left[i], target, leftCols, leftCols) == 0 {
 				i++
 			}
 
 			rightStart := j
-			for j < len(right) && types.CompareValues(right[j][rightCol], target) == 0 {
+			for j < len(right) && compareKeys(target, right[j], leftCols, rightCols) == 0 {
 				j++
 			}
 
 			for li := leftStart; li < i; li++ {
 				for ri := rightStart; ri < j; ri++ {
-					merged := make(map[string]interface{})
-					for k, v := range left[li] {
-						merged[k] = v
-					}
-					for k, v := range right[ri] {
-						merged[k] = v
-					}
-					result = append(result, merged)
+					result = append(result, mergeRows(left[li], right[ri]))
 				}
 			}
 		}
@@ -70,26 +96,23 @@ func (se *StorageEngine) mergeSortInnerJoin(left, right []map[string]interface{}
 	return result
 }
 
-func (se *StorageEngine) mergeSortOuterJoin(left, right []map[string]interface{}, leftCol, rightCol string) []map[string]interface{} {
+func (se *StorageEngine) mergeSortOuterJoin(left, right []map[string]interface{}, leftCols, rightCols []string) []map[string]interface{} {
 	result := []map[string]interface{}{}
 	i, j := 0, 0
 
 	for i < len(left) {
-		valL := left[i][leftCol]
-
-		if valL == nil || j >= len(right) {
+		if hasNullKey(left[i], leftCols) || j >= len(right) {
 			result = append(result, se.copyRowWithNulls(left[i]))
 			i++
 			continue
 		}
 
-		valR := right[j][rightCol]
-		if valR == nil {
+		if hasNullKey(right[j], rightCols) {
 			j++
 			continue
 		}
 
-		cmp := types.CompareValues(valL, valR)
+		cmp := compareKeys(left[i], right[j], leftCols, rightCols)
 
 		if cmp < 0 {
 			result = append(result, se.copyRowWithNulls(left[i]))
@@ -97,26 +120,19 @@ func (se *StorageEngine) mergeSortOuterJoin(left, right []map[string]interface{}
 		} else if cmp > 0 {
 			j++
 		} else {
-			matchVal := valL
+			target := left[i]
 			leftStart, rightStart := i, j
 
-			for i < len(left) && types.CompareValues(left[i][leftCol], matchVal) == 0 {
+			for i < len(left) && compareKeys(left[i], target, leftCols, leftCols) == 0 {
 				i++
 			}
-			for j < len(right) && types.CompareValues(right[j][rightCol], matchVal) == 0 {
+			for j < len(right) && compareKeys(target, right[j], leftCols, rightCols) == 0 {
 				j++
 			}
 
 			for li := leftStart; li < i; li++ {
 				for ri := rightStart; ri < j; ri++ {
-					merged := make(map[string]interface{})
-					for k, v := range left[li] {
-						merged[k] = v
-					}
-					for k, v := range right[ri] {
-						merged[k] = v
-					}
-					result = append(result, merged)
+					result = append(result, mergeRows(left[li], right[ri]))
 				}
 			}
 		}
@@ -124,7 +140,7 @@ func (se *StorageEngine) mergeSortOuterJoin(left, right []map[string]interface{}
 	return result
 }
 
-func (se *StorageEngine) mergeSortFullJoin(left, right []map[string]interface{}, leftCol, rightCol string) []map[string]interface{} {
+func (se *StorageEngine) mergeSortFullJoin(left, right []map[string]interface{}, leftCols, rightCols []string) []map[string]interface{} {
 	result := []map[string]interface{}{}
 	i, j := 0, 0
 
@@ -141,21 +157,18 @@ func (se *StorageEngine) mergeSortFullJoin(left, right []map[string]interface{},
 			continue
 		}
 
-		valL := left[i][leftCol]
-		valR := right[j][rightCol]
-
-		if valL == nil {
+		if hasNullKey(left[i], leftCols) {
 			result = append(result, se.copyRowWithNulls(left[i]))
 			i++
 			continue
 		}
-		if valR == nil {
+		if hasNullKey(right[j], rightCols) {
 			result = append(result, se.copyRowWithNulls(right[j]))
 			j++
 			continue
 		}
 
-		cmp := types.CompareValues(valL, valR)
+		cmp := compareKeys(left[i], right[j], leftCols, rightCols)
 
 		if cmp < 0 {
 			result = append(result, se.copyRowWithNulls(left[i]))
@@ -164,26 +177,19 @@ func (se *StorageEngine) mergeSortFullJoin(left, right []map[string]interface{},
 			result = append(result, se.copyRowWithNulls(right[j]))
 			j++
 		} else {
-			matchVal := valL
+			target := left[i]
 			leftStart, rightStart := i, j
 
-			for i < len(left) && types.CompareValues(left[i][leftCol], matchVal) == 0 {
+			for i < len(left) && compareKeys(left[i], target, leftCols, leftCols) == 0 {
 				i++
 			}
-			for j < len(right) && types.CompareValues(right[j][rightCol], matchVal) == 0 {
+			for j < len(right) && compareKeys(target, right[j], leftCols, rightCols) == 0 {
 				j++
 			}
 
 			for li := leftStart; li < i; li++ {
 				for ri := rightStart; ri < j; ri++ {
-					merged := make(map[string]interface{})
-					for k, v := range left[li] {
-						merged[k] = v
-					}
-					for k, v := range right[ri] {
-						merged[k] = v
-					}
-					result = append(result, merged)
+					result = append(result, mergeRows(left[li], right[ri]))
 				}
 			}
 		}
@@ -191,24 +197,42 @@ func (se *StorageEngine) mergeSortFullJoin(left, right []map[string]interface{},
 	return result
 }
 
-func (se *StorageEngine) filterJoinedRows(rows []map[string]interface{}, whereCol, whereVal string) []map[string]interface{} {
+// mergeSortSemiJoin returns the left rows that have at least one match in
+// right, or, when anti is set, the left rows that have none. Unlike the inner
+// join every left row appears at most once and no right columns are added.
+// NULL keys never match.
+func (se *StorageEngine) mergeSortSemiJoin(left, right []map[string]interface{}, leftCols, rightCols []string, anti bool) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	j := 0
+	for i := 0; i < len(left); i++ {
+		matched := false
+		if !hasNullKey(left[i], leftCols) {
+			for j < len(right) && (hasNullKey(right[j], rightCols) || compareKeys(right[j], left[i], rightCols, leftCols) < 0) {
+				j++
+			}
+			matched = j < len(right) && compareKeys(right[j], left[i], rightCols, leftCols) == 0
+		}
+
+		if matched != anti {
+			result = append(result, left[i])
+		}
+	}
+	return result
+}
+
+func (se *StorageEngine) filterJoinedRows(rows []map[string]interface{}, payload types.SelectPayload) ([]map[string]interface{}, error) {
 	filtered := []map[string]interface{}{}
 
 	for _, row := range rows {
-		val := row[whereCol]
-
-		if strings.ToUpper(whereVal) == "NULL" || whereVal == "" {
-			if val == nil {
-				filtered = append(filtered, row)
-			}
-			continue
+		match, err := se.matchWhere(payload, row)
+		if err != nil {
+			return nil, err
 		}
-
-		if val != nil && fmt.Sprintf("%v", val) == whereVal {
+		if match {
 			filtered = append(filtered, row)
 		}
 	}
-	return filtered
+	return filtered, nil
 }
 
 func (se *StorageEngine) copyRowWithNulls(rows map[string]interface{}) map[string]interface{} {
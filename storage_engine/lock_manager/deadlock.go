@@ -0,0 +1,67 @@
+package lock
+
+/*
+Deadlock detection on the wait-for graph.
+
+A waiting transaction waits for every other transaction that holds a
+conflicting lock on the resource it asked for, and for every request ahead
+of its own in the queue that conflicts with it (those are granted first).
+The graph is checked each time a transaction starts to wait; a new cycle
+always goes through that transaction.
+*/
+
+// waitsFor returns the transactions txnID is waiting for.
+func (lm *LockManager) waitsFor(txnID uint64) []uint64 {
+	w, ok := lm.waits[txnID]
+	if !ok {
+		return nil
+	}
+	q := lm.queues[w.res]
+
+	var ids []uint64
+	for id, held := range q.granted {
+		if id != txnID && !compatible[held][w.req.mode] {
+			ids = append(ids, id)
+		}
+	}
+	for _, req := range q.waiting {
+		if req == w.req {
+			break
+		}
+		if req.txnID != txnID && !compatible[req.mode][w.req.mode] {
+			ids = append(ids, req.txnID)
+		}
+	}
+	return ids
+}
+
+// findCycle returns the transactions of a wait-for cycle through txnID,
+// starting with txnID, or nil if there is none.
+func (lm *LockManager) findCycle(txnID uint64) []uint64 {
+	visited := make(map[uint64]bool)
+	var path []uint64
+
+	var visit func(id uint64) bool
+	visit = func(id uint64) bool {
+		path = append(path, id)
+		for _, next := range lm.waitsFor(id) {
+			if next == txnID {
+				return true
+			}
+			if !visited[next] {
+				visited[next] = true
+				if visit(next) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+
+	visited[txnID] = true
+	if visit(txnID) {
+		return path
+	}
+	return nil
+}
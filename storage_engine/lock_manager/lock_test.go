@@ -0,0 +1,294 @@
+package lock
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Every test runs its transactions in goroutines against one lock manager
+// and checks who gets what, and in which order.
+//
+// Run:
+//
+//	go test -race ./storage_engine/lock_manager
+
+const (
+	longWait  = 5 * time.Second       // lock timeout for tests that must not time out
+	shortWait = 50 * time.Millisecond // how long a blocked request is watched
+)
+
+var table = Resource{Table: "t"}
+
+// acquire asks for res in mode for txnID in a goroutine; the channel receives
+// the result.
+func acquire(lm *LockManager, txnID uint64, res Resource, mode Mode) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- lm.Acquire(txnID, res, mode) }()
+	return done
+}
+
+// mustAcquire locks res in mode for txnID, which must not wait.
+func mustAcquire(t *testing.T, lm *LockManager, txnID uint64, res Resource, mode Mode) {
+	t.Helper()
+	if err := lm.Acquire(txnID, res, mode); err != nil {
+		t.Fatalf("txn %d %s on %s: %v", txnID, mode, res, err)
+	}
+}
+
+// granted waits for a request to end and fails unless it was granted.
+func granted(t *testing.T, done <-chan error, what string) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+	case <-time.After(longWait):
+		t.Fatalf("%s: still waiting", what)
+	}
+}
+
+// blocked fails if a request ends within shortWait.
+func blocked(t *testing.T, done <-chan error, what string) {
+	t.Helper()
+	select {
+	case err := <-done:
+		t.Fatalf("%s: should wait, ended with %v", what, err)
+	case <-time.After(shortWait):
+	}
+}
+
+// waiting waits until txnID is queued for a lock.
+func waiting(t *testing.T, lm *LockManager, txnID uint64) {
+	t.Helper()
+	deadline := time.Now().Add(longWait)
+	for time.Now().Before(deadline) {
+		lm.mu.Lock()
+		_, ok := lm.waits[txnID]
+		lm.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("txn %d never waited", txnID)
+}
+
+// heldMode returns the mode txnID holds res in.
+func heldMode(lm *LockManager, txnID uint64, res Resource) (Mode, bool) {
+	for _, l := range lm.Locks() {
+		if l.Granted && l.TxnID == txnID && l.Table == res.Table && l.Row == res.Row {
+			return l.Mode, true
+		}
+	}
+	return 0, false
+}
+
+// A request is granted next to a lock of another transaction exactly when the
+// two modes are compatible; otherwise it waits for that lock to be released.
+func TestCompatibilityMatrix(t *testing.T) {
+	modes := []Mode{IS, IX, S, SIX, X}
+	want := map[[2]Mode]bool{
+		{IS, IS}: true, {IS, IX}: true, {IS, S}: true, {IS, SIX}: true,
+		{IX, IS}: true, {IX, IX}: true,
+		{S, IS}: true, {S, S}: true,
+		{SIX, IS}: true,
+	}
+	for _, held := range modes {
+		for _, asked := range modes {
+			held, asked := held, asked
+			t.Run(held.String()+"_"+asked.String(), func(t *testing.T) {
+				t.Parallel()
+				lm := NewLockManager(longWait)
+				mustAcquire(t, lm, 1, table, held)
+
+				done := acquire(lm, 2, table, asked)
+				if want[[2]Mode{held, asked}] {
+					granted(t, done, "compatible request")
+					return
+				}
+				blocked(t, done, "conflicting request")
+				lm.ReleaseAll(1)
+				granted(t, done, "request after release")
+			})
+		}
+	}
+}
+
+// A transaction asking for more than it holds is upgraded to the smallest
+// mode covering both, once the other holders allow it, ahead of the
+// requests already waiting.
+func TestUpgrades(t *testing.T) {
+	tests := []struct {
+		name        string
+		held, asked Mode
+		other       Mode // held by txn 2
+		want        Mode
+		waits       bool // other conflicts with want
+	}{
+		{"S to X", S, X, S, X, true},
+		{"IS to SIX", IS, SIX, IX, SIX, true},
+		{"IS to SIX next to IS", IS, SIX, IS, SIX, false},
+		{"S plus IX is SIX", S, IX, IS, SIX, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			lm := NewLockManager(longWait)
+			mustAcquire(t, lm, 1, table, tt.held)
+			mustAcquire(t, lm, 2, table, tt.other)
+
+			if !tt.waits {
+				mustAcquire(t, lm, 1, table, tt.asked)
+				if got, _ := heldMode(lm, 1, table); got != tt.want {
+					t.Fatalf("txn 1 holds %s, want %s", got, tt.want)
+				}
+				return
+			}
+
+			// txn 3 queues before the upgrade is asked for, and is passed
+			third := acquire(lm, 3, table, X)
+			waiting(t, lm, 3)
+			upgrade := acquire(lm, 1, table, tt.asked)
+			blocked(t, upgrade, "upgrade")
+
+			lm.ReleaseAll(2)
+			granted(t, upgrade, "upgrade after release")
+			blocked(t, third, "request queued before the upgrade")
+			if got, _ := heldMode(lm, 1, table); got != tt.want {
+				t.Fatalf("txn 1 holds %s, want %s", got, tt.want)
+			}
+			lm.ReleaseAll(1)
+			granted(t, third, "request after the upgraded lock is released")
+		})
+	}
+}
+
+// Waiting requests are granted in the order they came, and a request
+// compatible with the holders still waits behind an earlier one that is not.
+func TestFIFOGrantOrder(t *testing.T) {
+	lm := NewLockManager(longWait)
+	mustAcquire(t, lm, 1, table, X)
+
+	queue := []struct {
+		txnID uint64
+		mode  Mode
+	}{{2, S}, {3, X}, {4, S}, {5, IS}}
+	done := make(map[uint64]<-chan error)
+	for _, r := range queue {
+		done[r.txnID] = acquire(lm, r.txnID, table, r.mode)
+		waiting(t, lm, r.txnID)
+	}
+
+	lm.ReleaseAll(1)
+	granted(t, done[2], "txn 2, first in the queue")
+	blocked(t, done[3], "txn 3, X next to S")
+	blocked(t, done[4], "txn 4, S behind txn 3")
+
+	lm.ReleaseAll(2)
+	granted(t, done[3], "txn 3 after txn 2")
+	blocked(t, done[4], "txn 4 behind the X of txn 3")
+
+	lm.ReleaseAll(3)
+	granted(t, done[4], "txn 4 after txn 3")
+	granted(t, done[5], "txn 5 next to the S of txn 4")
+}
+
+// The youngest transaction of a wait-for cycle (the highest ID) is chosen as
+// the victim, whichever request closed the cycle; the others go on once its
+// locks are released.
+func TestDeadlockVictimIsYoungest(t *testing.T) {
+	tests := []struct {
+		name string
+		// txn i holds rows[i] in X, then asks for rows[i+1], in this order
+		txns   []uint64
+		victim uint64
+	}{
+		{"two transactions, the younger closes the cycle", []uint64{1, 2}, 2},
+		{"two transactions, the older closes the cycle", []uint64{2, 1}, 2},
+		{"three transactions, the youngest in the middle", []uint64{3, 5, 4}, 5},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			lm := NewLockManager(longWait)
+			rows := make([]Resource, len(tt.txns))
+			for i, id := range tt.txns {
+				rows[i] = Resource{Table: "t", Row: string(rune('a' + i))}
+				mustAcquire(t, lm, id, rows[i], X)
+			}
+
+			done := make(map[uint64]<-chan error)
+			for i, id := range tt.txns {
+				done[id] = acquire(lm, id, rows[(i+1)%len(rows)], X)
+				if i < len(tt.txns)-1 {
+					waiting(t, lm, id)
+				}
+			}
+
+			select {
+			case err := <-done[tt.victim]:
+				if !errors.Is(err, ErrDeadlock) {
+					t.Fatalf("victim txn %d: got %v, want ErrDeadlock", tt.victim, err)
+				}
+			case <-time.After(longWait):
+				t.Fatalf("victim txn %d still waiting", tt.victim)
+			}
+			for _, id := range tt.txns {
+				if id != tt.victim {
+					blocked(t, done[id], "a transaction that is not the victim")
+				}
+			}
+
+			// the survivors are granted one after the other, each as the one it
+			// waits for ends
+			lm.ReleaseAll(tt.victim)
+			delete(done, tt.victim)
+			deadline := time.Now().Add(longWait)
+			for len(done) > 0 {
+				if time.Now().After(deadline) {
+					t.Fatalf("survivors still waiting: %d", len(done))
+				}
+				for id, d := range done {
+					select {
+					case err := <-d:
+						if err != nil {
+							t.Fatalf("txn %d: %v", id, err)
+						}
+						lm.ReleaseAll(id)
+						delete(done, id)
+					default:
+					}
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+// A request that waits longer than the lock timeout fails with
+// ErrLockTimeout and leaves the queue; the lock it waited for is untouched.
+func TestLockTimeout(t *testing.T) {
+	const timeout = 30 * time.Millisecond
+	lm := NewLockManager(timeout)
+	mustAcquire(t, lm, 1, table, X)
+
+	start := time.Now()
+	err := lm.Acquire(2, table, S)
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("got %v, want ErrLockTimeout", err)
+	}
+	if waited := time.Since(start); waited < timeout {
+		t.Fatalf("gave up after %v, before the timeout of %v", waited, timeout)
+	}
+	locks := lm.Locks()
+	if len(locks) != 1 || locks[0].TxnID != 1 || !locks[0].Granted {
+		t.Fatalf("locks after the timeout: %+v", locks)
+	}
+
+	lm.ReleaseAll(1)
+	mustAcquire(t, lm, 2, table, S)
+}
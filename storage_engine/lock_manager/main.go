@@ -0,0 +1,279 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+/*
+Lock manager for strict two-phase locking.
+
+The storage engine locks what a transaction reads and writes as it goes
+(Acquire) and releases everything when the transaction commits or aborts
+(ReleaseAll), never earlier. A request that conflicts with a lock another
+transaction holds waits in the resource's FIFO queue until it is granted,
+until it times out (ErrLockTimeout), or until the deadlock detector picks
+its transaction as the victim of a cycle (ErrDeadlock); the caller must then
+abort the whole transaction so its locks are released.
+
+	          IS   IX   S    SIX  X
+	   IS     ✓    ✓    ✓    ✓
+	   IX     ✓    ✓
+	   S      ✓         ✓
+	   SIX    ✓
+	   X
+
+A transaction asking for a mode on a resource it already holds gets the
+smallest mode covering both (S held + IX asked = SIX); such upgrades wait
+ahead of new requests.
+
+Nothing is printed: sys.locks shows who waits for what, and the errors name
+the deadlock cycle or the lock waited for.
+*/
+
+var (
+	ErrDeadlock    = errors.New("deadlock detected")
+	ErrLockTimeout = errors.New("lock wait timeout exceeded")
+)
+
+var compatible = [5][5]bool{
+	IS:  {IS: true, IX: true, S: true, SIX: true},
+	IX:  {IS: true, IX: true},
+	S:   {IS: true, S: true},
+	SIX: {IS: true},
+	X:   {},
+}
+
+func (m Mode) String() string {
+	switch m {
+	case IS:
+		return "IS"
+	case IX:
+		return "IX"
+	case S:
+		return "S"
+	case SIX:
+		return "SIX"
+	case X:
+		return "X"
+	}
+	return "UNKNOWN"
+}
+
+// covers reports whether holding m gives everything want does.
+func (m Mode) covers(want Mode) bool {
+	switch want {
+	case IS:
+		return true
+	case IX:
+		return m == IX || m == SIX || m == X
+	case S:
+		return m == S || m == SIX || m == X
+	case SIX:
+		return m == SIX || m == X
+	}
+	return m == X
+}
+
+// join is the smallest mode covering both a and b.
+func join(a, b Mode) Mode {
+	switch {
+	case a.covers(b):
+		return a
+	case b.covers(a):
+		return b
+	}
+	return SIX // IX and S
+}
+
+func NewLockManager(timeout time.Duration) *LockManager {
+	return &LockManager{
+		queues:  make(map[Resource]*queue),
+		held:    make(map[uint64]map[Resource]bool),
+		waits:   make(map[uint64]waitEntry),
+		timeout: timeout,
+	}
+}
+
+// Acquire locks res in mode for txnID, waiting while other transactions hold
+// conflicting locks.
+func (lm *LockManager) Acquire(txnID uint64, res Resource, mode Mode) error {
+	lm.mu.Lock()
+
+	q, ok := lm.queues[res]
+	if !ok {
+		q = &queue{granted: make(map[uint64]Mode)}
+		lm.queues[res] = q
+	}
+
+	held, upgrade := q.granted[txnID]
+	if upgrade {
+		if held.covers(mode) {
+			lm.mu.Unlock()
+			return nil
+		}
+		mode = join(held, mode)
+	}
+
+	if q.compatible(txnID, mode) && (upgrade || len(q.waiting) == 0) {
+		lm.grant(q, res, txnID, mode)
+		lm.mu.Unlock()
+		return nil
+	}
+
+	req := &request{txnID: txnID, mode: mode, done: make(chan error, 1)}
+	if upgrade {
+		// ahead of the requests that are not upgrades
+		i := 0
+		for i < len(q.waiting) {
+			if _, holds := q.granted[q.waiting[i].txnID]; !holds {
+				break
+			}
+			i++
+		}
+		q.waiting = append(q.waiting[:i], append([]*request{req}, q.waiting[i:]...)...)
+	} else {
+		q.waiting = append(q.waiting, req)
+	}
+	lm.waits[txnID] = waitEntry{res: res, req: req}
+
+	if cycle := lm.findCycle(txnID); cycle != nil {
+		victim := cycle[0]
+		for _, id := range cycle {
+			if id > victim {
+				victim = id // the youngest transaction has done the least work
+			}
+		}
+		lm.cancel(victim, fmt.Errorf("%w: transactions %v wait for each other, txn %d chosen as victim", ErrDeadlock, cycle, victim))
+	}
+	lm.mu.Unlock()
+
+	timer := time.NewTimer(lm.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-req.done:
+		return err
+	case <-timer.C:
+	}
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	select {
+	case err := <-req.done: // granted or cancelled just now
+		return err
+	default:
+	}
+	lm.cancel(txnID, nil)
+	return fmt.Errorf("%w: txn %d waited %v for %s on %s", ErrLockTimeout, txnID, lm.timeout, mode, res)
+}
+
+// ReleaseAll releases every lock of txnID and grants the requests that can
+// now go ahead. Called when the transaction commits or aborts.
+func (lm *LockManager) ReleaseAll(txnID uint64) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.cancel(txnID, fmt.Errorf("transaction %d ended while waiting for a lock", txnID))
+	for res := range lm.held[txnID] {
+		q := lm.queues[res]
+		delete(q.granted, txnID)
+		lm.grantWaiting(q, res)
+	}
+	delete(lm.held, txnID)
+}
+
+// Locks returns the granted and waiting locks, by resource.
+func (lm *LockManager) Locks() []LockInfo {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	var locks []LockInfo
+	for res, q := range lm.queues {
+		for id, mode := range q.granted {
+			locks = append(locks, LockInfo{TxnID: id, Table: res.Table, Row: res.Row, Mode: mode, Granted: true})
+		}
+		for _, req := range q.waiting {
+			locks = append(locks, LockInfo{TxnID: req.txnID, Table: res.Table, Row: res.Row, Mode: req.mode})
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		a, b := locks[i], locks[j]
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		if a.Row != b.Row {
+			return a.Row < b.Row
+		}
+		if a.Granted != b.Granted {
+			return a.Granted
+		}
+		return a.TxnID < b.TxnID
+	})
+	return locks
+}
+
+func (r Resource) String() string {
+	if r.Row == "" {
+		return "table " + r.Table
+	}
+	return fmt.Sprintf("row %s of %s", r.Row, r.Table)
+}
+
+// compatible reports whether txnID may hold mode next to the other holders.
+func (q *queue) compatible(txnID uint64, mode Mode) bool {
+	for id, held := range q.granted {
+		if id != txnID && !compatible[held][mode] {
+			return false
+		}
+	}
+	return true
+}
+
+func (lm *LockManager) grant(q *queue, res Resource, txnID uint64, mode Mode) {
+	q.granted[txnID] = mode
+	if lm.held[txnID] == nil {
+		lm.held[txnID] = make(map[Resource]bool)
+	}
+	lm.held[txnID][res] = true
+}
+
+// grantWaiting grants the waiting requests of q in order, up to the first
+// one that still conflicts, and forgets q once it is unused.
+func (lm *LockManager) grantWaiting(q *queue, res Resource) {
+	for len(q.waiting) > 0 {
+		req := q.waiting[0]
+		if !q.compatible(req.txnID, req.mode) {
+			break
+		}
+		q.waiting = q.waiting[1:]
+		delete(lm.waits, req.txnID)
+		lm.grant(q, res, req.txnID, req.mode)
+		req.done <- nil
+	}
+	if len(q.granted) == 0 && len(q.waiting) == 0 {
+		delete(lm.queues, res)
+	}
+}
+
+// cancel ends the wait of txnID, if it is waiting, with err.
+func (lm *LockManager) cancel(txnID uint64, err error) {
+	w, ok := lm.waits[txnID]
+	if !ok {
+		return
+	}
+	delete(lm.waits, txnID)
+	q := lm.queues[w.res]
+	for i, req := range q.waiting {
+		if req == w.req {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			break
+		}
+	}
+	if err != nil {
+		w.req.done <- err
+	}
+	// the requests behind it may not conflict with the holders
+	lm.grantWaiting(q, w.res)
+}
@@ -0,0 +1,60 @@
+package lock
+
+import (
+	"sync"
+	"time"
+)
+
+// Mode is a lock mode. Tables are locked in an intention mode (IS, IX, SIX)
+// before rows of them are locked in S or X.
+type Mode uint8
+
+const (
+	IS  Mode = iota // intention shared: will lock rows in S
+	IX              // intention exclusive: will lock rows in X
+	S               // shared
+	SIX             // S on the table plus IX (read all of it, write some rows)
+	X               // exclusive
+)
+
+// Resource is a table (Row empty) or one row of it. Rows are named by their
+// primary key value, or by their location in tables without one.
+type Resource struct {
+	Table string
+	Row   string
+}
+
+// LockInfo is one granted or waiting lock, as shown by sys.locks.
+type LockInfo struct {
+	TxnID   uint64
+	Table   string
+	Row     string
+	Mode    Mode
+	Granted bool
+}
+
+type request struct {
+	txnID uint64
+	mode  Mode
+	done  chan error // receives nil when granted, or why the wait ended
+}
+
+// queue is the lock state of one resource: the transactions holding it and
+// the requests waiting for it, in the order they are granted.
+type queue struct {
+	granted map[uint64]Mode
+	waiting []*request
+}
+
+type waitEntry struct {
+	res Resource
+	req *request
+}
+
+type LockManager struct {
+	mu      sync.Mutex
+	queues  map[Resource]*queue
+	held    map[uint64]map[Resource]bool // txnID → resources it holds
+	waits   map[uint64]waitEntry         // txnID → the request it is blocked on
+	timeout time.Duration
+}
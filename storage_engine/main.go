@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 /*
@@ -26,9 +28,43 @@ func NewStorageEngine(dbRoot string) (*StorageEngine, error) {
 		return nil, fmt.Errorf("failed to init catalog manager: %w", err)
 	}
 
+	joinMemoryRows := defaultJoinMemoryRows
+	if v := os.Getenv("DAEMONDB_JOIN_MEMORY_ROWS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			joinMemoryRows = n
+		}
+	}
+
+	statsRefreshFraction := defaultStatsRefreshFraction
+	if v := os.Getenv("DAEMONDB_STATS_REFRESH_FRACTION"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			statsRefreshFraction = f
+		}
+	}
+
+	maxRecursion := defaultMaxRecursion
+	if v := os.Getenv("DAEMONDB_MAX_RECURSION"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxRecursion = n
+		}
+	}
+
+	lockTimeout := defaultLockTimeout
+	if v := os.Getenv("DAEMONDB_LOCK_TIMEOUT_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			lockTimeout = time.Duration(n) * time.Millisecond
+		}
+	}
+
 	se := &StorageEngine{
-		DbRoot:         dbRoot,
-		CatalogManager: catalogManager,
+		DbRoot:               dbRoot,
+		CatalogManager:       catalogManager,
+		joinMemoryRows:       joinMemoryRows,
+		statsRefreshFraction: statsRefreshFraction,
+		maxRecursion:         maxRecursion,
+		lockTimeout:          lockTimeout,
+		workTables:           make(map[string]*workTable),
+		triggerRunners:       make(map[uint64]TriggerRunner),
 	}
 
 	return se, nil
@@ -73,8 +109,11 @@ func (se *StorageEngine) Scan(transaction *txn.Transaction, tableName string) ([
 			fmt.Errorf("failed to access heap file: %w", err)
 	}
 
-	// Get all row pointers
-	rowPtrs := hf.GetAllRowPointers()
+	// Get the row pointers of the versions the snapshot sees
+	rowPtrs, err := se.visibleRowPointers(se.readSnapshot(transaction), tableName, hf.GetAllRowPointers())
+	if err != nil {
+		return nil, types.TableSchema{}, err
+	}
 
 	if len(rowPtrs) == 0 {
 		return []types.RowWithPointer{}, schema, nil
@@ -118,3 +157,25 @@ func (se *StorageEngine) RequireDatabase() error {
 	}
 	return nil
 }
+
+// ReadRow returns the row ptr points to, keyed by lower-case column name.
+func (se *StorageEngine) ReadRow(tableName string, ptr types.RowPointer) (types.Row, error) {
+	schema, err := se.CatalogManager.GetTableSchema(tableName)
+	if err != nil {
+		return types.Row{}, fmt.Errorf("table '%s' not found: %w", tableName, err)
+	}
+	rawRow, err := se.HeapManager.GetRow(&ptr)
+	if err != nil {
+		return types.Row{}, fmt.Errorf("failed to read row: %w", err)
+	}
+	values, err := se.DeserializeRow(rawRow, schema.Columns)
+	if err != nil {
+		return types.Row{}, fmt.Errorf("failed to deserialize row: %w", err)
+	}
+
+	rowMap := make(map[string]interface{}, len(values))
+	for i, col := range schema.Columns {
+		rowMap[strings.ToLower(col.Name)] = values[i]
+	}
+	return types.Row{Values: rowMap}, nil
+}
@@ -0,0 +1,289 @@
+package storageengine
+
+import (
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+	"errors"
+	"fmt"
+)
+
+/*
+Multi-version concurrency control
+
+Every heap tuple carries the transaction that created it (Xmin), the one that
+deleted or replaced it (Xmax) and the older version of the row it replaced
+(Prev, heapfile/tuple.go):
+
+	INSERT  → new version {Xmin: tx}; Prev is the deleted version of the same
+	          key, if the key had one
+	UPDATE  → new version {Xmin: tx, Prev: old} + Xmax of the old one = tx
+	DELETE  → Xmax of the version = tx, the index entry stays
+
+so a row is a chain of versions, newest first, and the primary key index
+points at the newest. Readers use a snapshot (transaction_manager/snapshot.go):
+a transaction's own, taken at BEGIN, or one per statement outside a
+transaction (readSnapshot). It is passed down with the statement, from the
+transaction the VM runs it in, to every function that reads rows.
+
+	full scan     → every tuple of the heap, kept when the snapshot sees it
+	index lookup  → newest version, then down Prev until one whose creator the
+	                snapshot sees; the row is there unless the snapshot also
+	                sees its deleter
+
+A writer locks the row (exec_locks.go) and then writes the newest version
+only: when the version it read was already replaced or deleted by a
+transaction its snapshot does not see, it fails with ErrSerialization (first
+updater wins) rather than overwrite a change it never saw.
+
+Rolling back a transaction undoes its versions: the new ones are removed and
+the Xmax of the old ones cleared, so aborted transactions leave nothing
+behind. After a commit, the versions it replaced or deleted are removed from
+the heap (and the index) once no snapshot in use can see them any more
+(pruneVersions). Pruning is logged (OpPrune) and redone like a row change.
+*/
+
+// ErrSerialization is returned when a transaction writes a row that a
+// transaction its snapshot does not see changed first; retrying the
+// transaction will see the change.
+var ErrSerialization = errors.New("could not serialize access due to concurrent update")
+
+// deadVersion is a version a committed transaction replaced or deleted,
+// waiting to be pruned.
+type deadVersion struct {
+	table string
+	ptr   types.RowPointer
+	pk    []byte
+	txnID uint64
+}
+
+// readSnapshot is the snapshot a statement of tx reads with: the one of tx, or
+// for a statement outside a transaction (tx nil) the committed state now.
+func (se *StorageEngine) readSnapshot(tx *txn.Transaction) *txn.Snapshot {
+	if tx != nil {
+		return &tx.Snapshot
+	}
+	if se.TxnManager == nil {
+		return &txn.Snapshot{Xmax: ^uint64(0)}
+	}
+	return se.TxnManager.Snapshot()
+}
+
+// visibleRowPointers keeps the tuples of a full scan of tableName the
+// snapshot sees. A serializable reader locks the table and depends on the
+// writers of the versions it does not see (ssi.go).
+func (se *StorageEngine) visibleRowPointers(snap *txn.Snapshot, tableName string, ptrs []types.RowPointer) ([]types.RowPointer, error) {
+	if err := se.readTable(snap, tableName); err != nil {
+		return nil, err
+	}
+	visible := ptrs[:0:0]
+	for _, rp := range ptrs {
+		hdr, _, err := se.HeapManager.GetTuple(&rp)
+		if err != nil {
+			continue
+		}
+		if err := se.skippedWriters(snap, hdr); err != nil {
+			return nil, err
+		}
+		if snap.Visible(hdr) {
+			visible = append(visible, rp)
+		}
+	}
+	return visible, nil
+}
+
+// skippedWriters records the rw-dependencies of a reader of a version with
+// header h: on its creator when the snapshot does not see it, else on its
+// deleter when that one is not seen.
+func (se *StorageEngine) skippedWriters(snap *txn.Snapshot, h types.TupleHeader) error {
+	if !snap.Sees(h.Xmin) {
+		return se.readConflict(snap, h.Xmin)
+	}
+	if h.Xmax != 0 && !snap.Sees(h.Xmax) {
+		return se.readConflict(snap, h.Xmax)
+	}
+	return nil
+}
+
+// visibleVersion returns the version of the row whose newest version is at
+// ptr (an index entry) that the snapshot sees; false when the row does not
+// exist for it.
+func (se *StorageEngine) visibleVersion(snap *txn.Snapshot, ptr types.RowPointer) (types.RowPointer, bool, error) {
+	hdr, _, err := se.HeapManager.GetTuple(&ptr)
+	if err != nil {
+		return ptr, false, err
+	}
+	for !snap.Sees(hdr.Xmin) {
+		if err := se.readConflict(snap, hdr.Xmin); err != nil {
+			return ptr, false, err
+		}
+		if hdr.Prev == nil {
+			return ptr, false, nil
+		}
+		prev := *hdr.Prev
+		prevHdr, _, err := se.HeapManager.GetTuple(&prev)
+		// an older version always has an Xmax; anything else in its slot means
+		// it was pruned, and no snapshot that needs it is left
+		if err != nil || prevHdr.Xmax == 0 {
+			return ptr, false, nil
+		}
+		ptr, hdr = prev, prevHdr
+	}
+	if err := se.skippedWriters(snap, hdr); err != nil {
+		return ptr, false, err
+	}
+	return ptr, hdr.Xmax == 0 || !snap.Sees(hdr.Xmax), nil
+}
+
+// visibleIndexEntry resolves an index entry to the version the snapshot sees,
+// or nil.
+func (se *StorageEngine) visibleIndexEntry(snap *txn.Snapshot, ptrBytes []byte) (*types.RowPointer, error) {
+	ptr, err := se.DeserializeRowPointer(ptrBytes)
+	if err != nil {
+		return nil, err
+	}
+	ptr, ok, err := se.visibleVersion(snap, ptr)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &ptr, nil
+}
+
+// writableVersion reads the version at ptr for tx to replace or delete, once
+// tx holds the row lock: it must still be the newest version, or its writer
+// must be tx itself.
+func (se *StorageEngine) writableVersion(tx *txn.Transaction, ptr types.RowPointer) (types.TupleHeader, []byte, error) {
+	hdr, rowData, err := se.HeapManager.GetTuple(&ptr)
+	if err != nil {
+		return hdr, nil, fmt.Errorf("failed to read row: %w", err)
+	}
+	if hdr.Xmax == 0 {
+		return hdr, rowData, nil
+	}
+	if tx != nil && hdr.Xmax == tx.ID {
+		return hdr, nil, fmt.Errorf("row (%d,%d) was already changed by this statement", ptr.PageNumber, ptr.SlotIndex)
+	}
+	return hdr, nil, ErrSerialization
+}
+
+// keyPredecessor decides what a new version with a primary key finds in the
+// index: newest is the version the key points to. A live one means the key
+// is taken; a deleted one becomes the Prev of the new version.
+func (se *StorageEngine) keyPredecessor(newest types.RowPointer) (prev *types.RowPointer, taken bool, err error) {
+	hdr, _, err := se.HeapManager.GetTuple(&newest)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read row: %w", err)
+	}
+	if hdr.Xmax == 0 {
+		return nil, true, nil
+	}
+	return &newest, false, nil
+}
+
+// versionTxnID is the ID the row versions tx writes are stamped with.
+func versionTxnID(tx *txn.Transaction) uint64 {
+	if tx == nil {
+		return 0
+	}
+	return tx.ID
+}
+
+// retireVersions queues the versions committed transaction t replaced or
+// deleted for pruning, then prunes what no snapshot needs.
+func (se *StorageEngine) retireVersions(t *txn.Transaction) {
+	if t != nil {
+		se.deadMu.Lock()
+		for _, u := range t.UpdatedRows {
+			se.deadVersions = append(se.deadVersions, deadVersion{table: u.Table, ptr: u.OldRowPtr, pk: u.PrimaryKey, txnID: t.ID})
+		}
+		for _, d := range t.DeletedRows {
+			se.deadVersions = append(se.deadVersions, deadVersion{table: d.Table, ptr: d.RowPtr, pk: d.PrimaryKey, txnID: t.ID})
+		}
+		se.deadMu.Unlock()
+	}
+	se.pruneVersions()
+}
+
+// pruneVersions removes the dead versions whose deleter committed before the
+// oldest snapshot in use: every snapshot sees them deleted, so no reader
+// needs them. An index entry still pointing at one (a deleted row, or the
+// old key of an updated one) goes too.
+func (se *StorageEngine) pruneVersions() {
+	se.deadMu.Lock()
+	defer se.deadMu.Unlock()
+	if len(se.deadVersions) == 0 || se.TxnManager == nil {
+		return
+	}
+	horizon := se.TxnManager.Horizon()
+
+	kept := se.deadVersions[:0]
+	for _, d := range se.deadVersions {
+		if d.txnID >= horizon {
+			kept = append(kept, d)
+			continue
+		}
+		if err := se.pruneVersion(d); err != nil {
+			// the version stays in the heap, where no snapshot sees it
+			fmt.Printf("[MVCC] warning: prune of table=%s page=%d slot=%d failed: %v\n", d.table, d.ptr.PageNumber, d.ptr.SlotIndex, err)
+		}
+	}
+	se.deadVersions = kept
+}
+
+// pruneVersion logs the removal of the dead version d (OpPrune), then
+// removes it, so that redo removes it again from a page that lost it.
+func (se *StorageEngine) pruneVersion(d deadVersion) error {
+	_, rowData, err := se.HeapManager.GetTuple(&d.ptr)
+	if err != nil {
+		return err
+	}
+	op := &types.Operation{Type: types.OpPrune, TxnID: d.txnID, Table: d.table, RowPtr: d.ptr, RowData: rowData}
+	if _, err := se.WalManager.AppendOperation(op); err != nil {
+		return fmt.Errorf("failed to log prune: %w", err)
+	}
+	return se.applyPrune(op, false)
+}
+
+// applyPrune removes the version an OpPrune names, if its slot still holds a
+// version deleted by op.TxnID, and the index entry of its key, if that still
+// points at it. When redoing it (redo), a page or leaf that already has the
+// record is left as it is.
+func (se *StorageEngine) applyPrune(op *types.Operation, redo bool) error {
+	rp := op.RowPtr
+	key, err := se.recoveredKey(op.Table, op.RowData, rp)
+	if err != nil {
+		return err
+	}
+	heapTodo := se.needsChange(rp, op.LSN, redo)
+
+	if se.indexNeedsChange(op.Table, key, op.LSN, redo) {
+		idx, err := se.GetIndex(op.Table)
+		if err != nil {
+			return err
+		}
+		if ptrBytes, err := idx.Search(key); err == nil && ptrBytes != nil {
+			if ptr, err := se.DeserializeRowPointer(ptrBytes); err == nil && ptr == rp {
+				if err := idx.Delete(key, op.LSN); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if heapTodo && se.versionWrittenBy(rp, op.TxnID, true) {
+		return se.HeapManager.DeleteRow(&rp, op.LSN)
+	}
+	return nil
+}
+
+// forgetVersions drops the dead versions of tableName, whose heap was
+// truncated or dropped under them.
+func (se *StorageEngine) forgetVersions(tableName string) {
+	se.deadMu.Lock()
+	defer se.deadMu.Unlock()
+	kept := se.deadVersions[:0]
+	for _, d := range se.deadVersions {
+		if d.table != tableName {
+			kept = append(kept, d)
+		}
+	}
+	se.deadVersions = kept
+}
@@ -0,0 +1,70 @@
+package storageengine
+
+import (
+	"fmt"
+
+	"DaemonDB/types"
+)
+
+/*
+This file contains the block nested-loop join, used for joins the other
+algorithms can not run: CROSS JOIN / FROM a, b (no condition), and ON clauses
+without a column equality between the two sides, such as band joins:
+
+	a JOIN b ON a.ts BETWEEN b.start AND b.end
+
+The left input is cut into blocks of joinMemoryRows rows; for every block the
+right input is read once and each right row is compared with every row of the
+block, so the right side is scanned ceil(L / block) times instead of L times.
+
+Outer joins remember which rows found a match: unmatched left rows are emitted
+after their block, unmatched right rows after the last block.
+*/
+
+// blockNestedLoopJoin joins every left row with every right row for which on
+// (nil: always) is true.
+func (se *StorageEngine) blockNestedLoopJoin(left, right []map[string]interface{}, on *types.ExpressionNode, keepLeft, keepRight bool) ([]map[string]interface{}, error) {
+	result := []map[string]interface{}{}
+	block := se.joinMemoryRows
+	rightMatched := make([]bool, len(right))
+
+	for start := 0; start < len(left); start += block {
+		end := min(start+block, len(left))
+		leftMatched := make([]bool, end-start)
+
+		for ri, r := range right {
+			for li, l := range left[start:end] {
+				row := mergeRows(l, r)
+				if on != nil {
+					match, err := types.EvalPredicate(on, row)
+					if err != nil {
+						return nil, fmt.Errorf("error evaluating ON: %w", err)
+					}
+					if !match {
+						continue
+					}
+				}
+				leftMatched[li] = true
+				rightMatched[ri] = true
+				result = append(result, row)
+			}
+		}
+
+		if keepLeft {
+			for li, l := range left[start:end] {
+				if !leftMatched[li] {
+					result = append(result, se.copyRowWithNulls(l))
+				}
+			}
+		}
+	}
+
+	if keepRight {
+		for ri, r := range right {
+			if !rightMatched[ri] {
+				result = append(result, se.copyRowWithNulls(r))
+			}
+		}
+	}
+	return result, nil
+}
@@ -20,9 +20,10 @@ for heap page: the implementation is at : /DaemonDB/storage_engine/access/heapfi
 for index page: the implementation is at: /DaemonDB/storage_engine/access/indexfile_manager/bplustree/node_to_index_page.go
 
 
-Additionally the concept of LSN for WAL replay is used only for heap page, since they are the ones that are replay on a bigger level, internally they create/read the indexes like normal queries
-so for index pages lsn remains untouched more or less (the Node of B+ tree doesnt have to do anything with lsn too)
-so keeping it simple
+Both page types start with the LSN of the last logged change they hold (first 8 bytes), a heap
+page for the row change itself and a B+ tree node for the index entry that goes with it.
+Recovery redoes a change only on pages whose LSN is below it, and the buffer pool never writes
+a page whose LSN the WAL has not flushed yet
 */
 
 type Page struct {
@@ -0,0 +1,101 @@
+package storageengine
+
+import (
+	"fmt"
+	"sort"
+
+	"DaemonDB/types"
+)
+
+/*
+This file contains the last two steps of a SELECT, applied after the scan/join
+and WHERE filter have produced the source rows:
+
+	ORDER BY → sort source rows; keys may use source columns or select-list aliases
+	project  → evaluate the select list into the output rows and column names
+
+SELECT * (no projections) keeps the source rows and columns unchanged.
+*/
+
+func (se *StorageEngine) projectAndSort(rows []map[string]interface{}, columns []string, payload types.SelectPayload) ([]map[string]interface{}, []string, error) {
+	if len(payload.Projections) == 0 && len(payload.OrderBy) == 0 {
+		return rows, columns, nil
+	}
+
+	// ── Step 1: Evaluate the select list for every row ───────────────────────
+	outRows := rows
+	outCols := columns
+	if len(payload.Projections) > 0 {
+		outRows = make([]map[string]interface{}, len(rows))
+		outCols = make([]string, len(payload.Projections))
+		for i, proj := range payload.Projections {
+			outCols[i] = proj.Name
+		}
+
+		for i, row := range rows {
+			out := make(map[string]interface{}, len(payload.Projections))
+			for _, proj := range payload.Projections {
+				val, err := types.EvalExpression(proj.Expr, row)
+				if err != nil {
+					return nil, nil, fmt.Errorf("error evaluating %s: %w", proj.Name, err)
+				}
+				out[proj.Name] = val
+			}
+			outRows[i] = out
+		}
+	}
+
+	if len(payload.OrderBy) == 0 {
+		return outRows, outCols, nil
+	}
+
+	// ── Step 2: Compute sort keys ────────────────────────────────────────────
+	// Aliases shadow source columns, as in SQL.
+	keys := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		env := row
+		if len(payload.Projections) > 0 {
+			env = make(map[string]interface{}, len(row)+len(outRows[i]))
+			for k, v := range row {
+				env[k] = v
+			}
+			for k, v := range outRows[i] {
+				env[k] = v
+			}
+		}
+
+		keys[i] = make([]interface{}, len(payload.OrderBy))
+		for j, item := range payload.OrderBy {
+			val, err := types.EvalExpression(item.Expr, env)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error evaluating ORDER BY: %w", err)
+			}
+			keys[i][j] = val
+		}
+	}
+
+	// ── Step 3: Sort output rows by their keys ───────────────────────────────
+	order := make([]int, len(outRows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		for j, item := range payload.OrderBy {
+			cmp := types.CompareValues(keys[order[a]][j], keys[order[b]][j])
+			if cmp == 0 {
+				continue
+			}
+			if item.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+
+	sorted := make([]map[string]interface{}, len(outRows))
+	for i, idx := range order {
+		sorted[i] = outRows[idx]
+	}
+	return sorted, outCols, nil
+}
@@ -6,33 +6,61 @@ import (
 	"DaemonDB/types"
 )
 
+/*
+Crash recovery (ARIES)
+
+RecoverFromWAL runs three passes over the log:
+
+	analysis  from the checkpoint (or the begin of the oldest transaction
+	          running at it): which transactions committed, which row
+	          changes were already undone by a compensation record (OpCLR)
+	redo      from the checkpoint: every change is applied again, committed
+	          or not, CLRs included, unless its page already has it
+	undo      the row changes of transactions that never committed and were
+	          not compensated yet are undone, last first, each through
+	          compensate (compensation.go), so a CLR is logged for each
+
+A heap page carries the LSN of the last change applied to it (bytes 0-7,
+GetLastAppliedLSN), and so does a B+ tree node: a change is redone on a page
+only when the page LSN is below the record LSN. Redo is therefore idempotent,
+and since undo logs what it does, a crash during recovery is recovered from
+the same way: the next run redoes the CLRs and undoes only what is left.
+
+Every checkpoint flushes the pages, so redo never needs a record before it;
+the transactions running at it are saved with it, for the undo pass.
+*/
+
 // RecoverFromWAL is called once at startup before the engine accepts any
-// queries.  It loads the last checkpoint, replays all WAL operations that
-// follow it, and skips anything that was explicitly aborted or that belongs
-// to an uncommitted transaction.
+// queries. It runs the analysis, redo and undo passes above, ends each
+// transaction it undid with an OpTxnAbort record and takes a checkpoint.
 func (se *StorageEngine) RecoverFromWAL() error {
 
-	// find the starting LSN from the last checkpoint
+	// find where the passes start from the last checkpoint
 
-	var startLSN uint64 = 0
+	var startLSN, redoLSN uint64
+	activeAtCheckpoint := make(map[uint64]bool)
 
 	if se.CheckpointManager != nil {
-		checkpoint, err := se.CheckpointManager.LoadCheckpoint()
+		cp, err := se.CheckpointManager.LoadCheckpoint()
 		if err != nil {
 			fmt.Printf("Warning: failed to load checkpoint: %v — replaying from LSN 0\n", err)
 		} else {
-			startLSN = checkpoint.LSN
-			// if startLSN > 0 {
-			// 	// fmt.Printf("Loaded checkpoint at LSN %d\n", startLSN)
-			// }
+			startLSN, redoLSN = cp.StartLSN(), cp.LSN
+			for _, t := range cp.Active {
+				activeAtCheckpoint[t.ID] = true
+			}
 		}
 	}
 
-	//  collect all WAL operations from startLSN onwards
+	//  collect the WAL operations the passes need: everything from the
+	//  checkpoint, and before it only those of transactions running at it
 
 	var ops []*types.Operation
 
 	err := se.WalManager.ReplayFromLSN(startLSN, func(op *types.Operation) error {
+		if op.LSN < redoLSN && !activeAtCheckpoint[op.TxnID] {
+			return nil
+		}
 		ops = append(ops, op)
 		return nil
 	})
@@ -45,21 +73,24 @@ func (se *StorageEngine) RecoverFromWAL() error {
 		return nil
 	}
 
-	fmt.Printf("Found %d WAL operations after checkpoint LSN %d\n", len(ops), startLSN)
+	fmt.Printf("Found %d WAL operations after LSN %d\n", len(ops), startLSN)
 
-	//  single pass to build committed and aborted sets
+	//  analysis: a single pass to build the transaction and record sets
 	//
 	// committed:   txnID → true  for transactions that reached OpTxnCommit.
-	//              DML ops whose TxnID is not in this set are skipped.
-	// aborted:   txnID → true  for transactions that reached OpTxnAbort.
-	//              Ops that failed to run, aborted is run to stop that on ongoing commit
-	// abortedLSN: original-op-LSN → true  for DDL ops followed by an
+	//              The others are losers: their row changes are undone.
+	// aborted:     txnID → true  for transactions that reached OpTxnAbort.
+	//              A loser without one gets it once it is undone.
+	// abortedLSN:  original-op-LSN → true  for DDL ops followed by an
 	//              OpAbort compensation record.  These are skipped even
 	//              though they carry no TxnID.
+	// compensated: original-op-LSN → true  for row changes an OpCLR undid
+	//              (rollback, rollback to savepoint, an earlier recovery).
 
 	committed := make(map[uint64]bool)
 	aborted := make(map[uint64]bool)
 	abortedLSN := make(map[uint64]bool)
+	compensated := make(map[uint64]bool)
 
 	for _, op := range ops {
 		switch op.Type {
@@ -69,28 +100,30 @@ func (se *StorageEngine) RecoverFromWAL() error {
 			aborted[op.TxnID] = true
 		case types.OpAbort:
 			abortedLSN[op.TargetLSN] = true
+		case types.OpCLR:
+			compensated[op.TargetLSN] = true
 		}
 	}
 
 	fmt.Println("[Recovery] Starting WAL recovery")
-	fmt.Printf("[Recovery] Checkpoint LSN=%d\n", startLSN)
-	fmt.Printf("[Recovery] Found %d ops after checkpoint\n", len(ops))
+	fmt.Printf("[Recovery] Checkpoint LSN=%d start LSN=%d\n", redoLSN, startLSN)
+	fmt.Printf("[Recovery] Found %d ops\n", len(ops))
 	fmt.Printf("[Recovery] Committed txns: %v\n", printIds(committed))
 	fmt.Printf("[Recovery] Aborted txns:   %v\n", printIds(aborted))
 
-	// replay in WAL order, skipping aborted / uncommitted ops
+	// redo in WAL order: repeat history from the checkpoint
 
 	replayed := 0
 
 	for _, op := range ops {
-		// Control records are never replayed as state changes.
-		switch op.Type {
-		case types.OpTxnBegin, types.OpTxnCommit, types.OpTxnAbort, types.OpAbort:
-			continue
+		if op.LSN < redoLSN {
+			continue // on the pages since the checkpoint
 		}
 
-		// Skip DML that belongs to an uncommitted transaction.
-		if op.TxnID != 0 && !committed[op.TxnID] {
+		// Control records are never replayed as state changes.
+		switch op.Type {
+		case types.OpTxnBegin, types.OpTxnCommit, types.OpTxnAbort, types.OpAbort,
+			types.OpSavepoint, types.OpRollbackToSavepoint, types.OpReleaseSavepoint:
 			continue
 		}
 
@@ -108,13 +141,14 @@ func (se *StorageEngine) RecoverFromWAL() error {
 			err = se.replayCreateTable(op)
 		case types.OpInsert:
 			err = se.replayInsert(op)
-		// case types.OpDrop:
-		// 	err = se.replayDrop(op)
 		case types.OpDelete:
 			err = se.replayDelete(op)
-
 		case types.OpUpdate:
 			err = se.replayUpdate(op)
+		case types.OpCLR:
+			err = se.replayCompensation(op)
+		case types.OpPrune:
+			err = se.replayPrune(op)
 		case types.OpTruncateTable:
 			err = se.replayTruncate(op)
 		case types.OpDrop:
@@ -128,58 +162,66 @@ func (se *StorageEngine) RecoverFromWAL() error {
 		replayed++
 	}
 
-	// UNDO — physically remove writes from uncommitted transactions ─
+	// UNDO — compensate the row changes of the transactions that never
+	// committed, except those a CLR already undid.
 	// Iterate in REVERSE order — last write first.
 	undone := 0
+	losers := make(map[uint64]bool)
 	for i := len(ops) - 1; i >= 0; i-- {
 		op := ops[i]
 
-		// Only undo DML from transactions that never committed
 		if op.TxnID == 0 || committed[op.TxnID] {
 			continue
 		}
+		losers[op.TxnID] = true
+		if compensated[op.LSN] {
+			continue
+		}
+		switch op.Type {
+		case types.OpInsert, types.OpUpdate, types.OpDelete:
+		default:
+			continue
+		}
+		if !se.CatalogManager.TableExists(op.Table) {
+			continue // dropped since: nothing left to undo
+		}
 
 		fmt.Printf("[Recovery] UNDO op=%d lsn=%d table=%s txnID=%d\n", op.Type, op.LSN, op.Table, op.TxnID)
 
-		switch op.Type {
-		case types.OpInsert:
-			rp := op.RowPtr
-			if err := se.HeapManager.DeleteRow(&rp, op.LSN); err != nil {
-				fmt.Printf("  Warning: undo insert failed at LSN %d (table=%s): %v\n",
-					op.LSN, op.Table, err)
-				continue
-			}
-			// Remove from index
-			schema, err := se.CatalogManager.GetTableSchema(op.Table)
-			if err == nil {
-				values, err := se.DeserializeRow(op.RowData, schema.Columns)
-				if err == nil {
-					pkBytes, _, _ := se.ExtractPrimaryKey(schema, values, &rp)
-					btree, err := se.GetIndex(op.Table)
-					if err == nil {
-						btree.Delete(pkBytes)
-					}
-				}
-			}
-			undone++
+		// a loser left half undone would be seen as committed: stop here, the
+		// next recovery redoes the CLRs logged so far and undoes the rest
+		if err := se.compensate(op); err != nil {
+			return fmt.Errorf("undo failed at LSN %d (op=%d table=%s txnID=%d): %w",
+				op.LSN, op.Type, op.Table, op.TxnID, err)
+		}
+		undone++
+	}
 
-		case types.OpUpdate:
-			// op.RowData is the NEW data, we need to restore old data
-			// Old data isn't stored in WAL currently — this is a limitation.
-			// For now, log a warning. Full MVCC would store before-image in WAL.
-			fmt.Printf("  Warning: cannot undo update at LSN %d (table=%s) — before-image not in WAL\n",
-				op.LSN, op.Table)
+	for txnID := range losers {
+		if aborted[txnID] {
+			continue
+		}
+		if err := se.LogTransactionAbort(txnID); err != nil {
+			return fmt.Errorf("failed to log abort of txn %d: %w", txnID, err)
 		}
 	}
 
 	fmt.Printf("[Recovery] Complete — redone=%d undone=%d\n", replayed, undone)
+
+	// the log the next recovery would need stops here
+	if err := se.SaveCheckpoint(); err != nil {
+		return fmt.Errorf("failed to checkpoint after recovery: %w", err)
+	}
 	return nil
 }
 
 // individual replay handlers
-// Each handler is intentionally thin: it delegates to the same public methods
-// that normal query execution uses, so compensation, locking, and state
-// updates are never duplicated.
+// The row handlers (insert, update, delete, CLR, prune) write the logged
+// change at its logged row pointer, straight to the heap page and the index
+// leaf, and only where the page or leaf LSN shows the change is missing. They
+// neither lock nor log: redo repeats history, it does not make any. The table
+// handlers (create, truncate, drop) reuse the methods of the statements,
+// skipping what is already done.
 
 func (se *StorageEngine) replayCreateTable(op *types.Operation) error {
 	if op.Schema == nil {
@@ -199,62 +241,101 @@ func (se *StorageEngine) replayCreateTable(op *types.Operation) error {
 	return se.CreateTable(*op.Schema)
 }
 
+// replayInsert redoes an insert: the version (RowPtr) unless its page has
+// it, and the key pointing at it unless its leaf has it.
 func (se *StorageEngine) replayInsert(op *types.Operation) error {
 	if op.RowData == nil {
 		return fmt.Errorf("replayInsert: nil row data at LSN %d", op.LSN)
 	}
 	if !se.CatalogManager.TableExists(op.Table) {
-		return fmt.Errorf("replayInsert: table '%s' does not exist", op.Table)
+		return nil // dropped since: nothing to redo
 	}
 
 	fileID, err := se.CatalogManager.GetTableFileID(op.Table)
 	if err != nil {
 		return err
 	}
-
-	// Check if page already has this write — page was flushed before crash
-	if op.RowPtr.PageNumber != 0 {
-		pageLSN, err := se.HeapManager.GetPageLSN(fileID, op.RowPtr.PageNumber)
-		if err == nil && pageLSN >= op.LSN {
-			fmt.Printf("  replayInsert: skipping LSN %d — page %d already up to date (pageLSN=%d)\n",
-				op.LSN, op.RowPtr.PageNumber, pageLSN)
-			return nil
-		}
+	key, err := se.recoveredKey(op.Table, op.RowData, op.RowPtr)
+	if err != nil {
+		return err
 	}
+	keyTodo := se.indexNeedsChange(op.Table, key, op.LSN, true)
 
-	return se.HeapManager.InsertRowAtPointer(fileID, &op.RowPtr, op.RowData, op.LSN)
+	if se.pageHasLSN(fileID, op.RowPtr.PageNumber, op.LSN) {
+		fmt.Printf("  replayInsert: skipping LSN %d — page %d already up to date\n", op.LSN, op.RowPtr.PageNumber)
+	} else if err := se.HeapManager.InsertRowAtPointer(fileID, &op.RowPtr, types.TupleHeader{Xmin: op.TxnID, Prev: op.Prev}, op.RowData, op.LSN); err != nil {
+		return err
+	}
+	if !keyTodo {
+		return nil
+	}
+	return se.setIndexEntry(op.Table, key, &op.RowPtr, op.LSN)
 }
 
-// func (se *StorageEngine) replayDrop(op *types.Operation) error {
-// 	if !se.CatalogManager.TableExists(op.Table) {
-// 		fmt.Printf("  replayDrop: '%s' does not exist, skipping\n", op.Table)
-// 		return nil
-// 	}
-
-// 	return se.DropTable(op.Table)
-// }
-
+// replayUpdate redoes both halves of an update: the new version (RowPtr)
+// and the Xmax of the one it replaced (OldPtr), each unless its page has it,
+// and the new key pointing at the new version unless its leaf has it.
 func (se *StorageEngine) replayUpdate(op *types.Operation) error {
 	if op.RowData == nil {
 		return fmt.Errorf("replayUpdate: nil row data at LSN %d", op.LSN)
 	}
 
 	if !se.CatalogManager.TableExists(op.Table) {
-		return fmt.Errorf("replayUpdate: table '%s' does not exist at LSN %d", op.Table, op.LSN)
+		return nil // dropped since: nothing to redo
 	}
 
 	fileID, err := se.CatalogManager.GetTableFileID(op.Table)
 	if err != nil {
 		return err
 	}
-	pageLSN, err := se.HeapManager.GetPageLSN(fileID, op.RowPtr.PageNumber)
-	if err == nil && pageLSN >= op.LSN {
+	key, err := se.recoveredKey(op.Table, op.RowData, op.RowPtr)
+	if err != nil {
+		return err
+	}
+	// both pages are checked before either is written: they may be the same
+	newDone := se.pageHasLSN(fileID, op.RowPtr.PageNumber, op.LSN)
+	oldDone := se.pageHasLSN(fileID, op.OldPtr.PageNumber, op.LSN)
+	keyTodo := se.indexNeedsChange(op.Table, key, op.LSN, true)
+
+	if !oldDone {
+		oldPtr := op.OldPtr
+		if err := se.HeapManager.SetXmax(&oldPtr, op.TxnID, op.LSN); err != nil {
+			return err
+		}
+	}
+	if newDone {
 		fmt.Printf("  replayUpdate: skipping LSN %d — page already up to date\n", op.LSN)
+	} else if err := se.HeapManager.InsertRowAtPointer(fileID, &op.RowPtr, types.TupleHeader{Xmin: op.TxnID, Prev: op.Prev}, op.RowData, op.LSN); err != nil {
+		return err
+	}
+	if !keyTodo {
 		return nil
 	}
+	return se.setIndexEntry(op.Table, key, &op.RowPtr, op.LSN)
+}
 
-	rp := op.RowPtr
-	return se.HeapManager.UpdateRow(&rp, op.RowData, op.LSN)
+// replayCompensation redoes a CLR, on the pages that do not have it yet.
+func (se *StorageEngine) replayCompensation(op *types.Operation) error {
+	if !se.CatalogManager.TableExists(op.Table) {
+		return nil // dropped since: nothing to redo
+	}
+	return se.applyCompensation(op, true)
+}
+
+// replayPrune redoes the removal of a dead version, on the pages that do not
+// have it yet.
+func (se *StorageEngine) replayPrune(op *types.Operation) error {
+	if !se.CatalogManager.TableExists(op.Table) {
+		return nil // dropped since: nothing to redo
+	}
+	return se.applyPrune(op, true)
+}
+
+// pageHasLSN reports whether heap page pageNumber of fileID already holds the
+// change logged at lsn.
+func (se *StorageEngine) pageHasLSN(fileID uint32, pageNumber uint32, lsn uint64) bool {
+	pageLSN, err := se.HeapManager.GetPageLSN(fileID, pageNumber)
+	return err == nil && pageLSN >= lsn
 }
 
 // helpers used only during recovery
@@ -288,7 +369,7 @@ func (se *StorageEngine) replayTruncate(op *types.Operation) error {
 	// Reset index
 	index, err := se.GetIndex(op.Table)
 	if err == nil {
-		index.Reset()
+		index.Reset(op.LSN)
 	}
 
 	return nil
@@ -310,5 +391,19 @@ func (se *StorageEngine) replayDelete(op *types.Operation) error {
 		return nil
 	}
 
-	return se.DeleteRows(op.Table, op.WhereCol, op.WhereVal)
+	// one row, logged with its before-image by DeleteRowsAt: the version gets
+	// its deleter back, its index entry stayed
+	if op.RowData == nil {
+		return fmt.Errorf("replayDelete: nil row data at LSN %d", op.LSN)
+	}
+	fileID, err := se.CatalogManager.GetTableFileID(op.Table)
+	if err != nil {
+		return err
+	}
+	if se.pageHasLSN(fileID, op.RowPtr.PageNumber, op.LSN) {
+		fmt.Printf("  replayDelete: skipping LSN %d — page already up to date\n", op.LSN)
+		return nil
+	}
+	rp := op.RowPtr
+	return se.HeapManager.SetXmax(&rp, op.TxnID, op.LSN)
 }
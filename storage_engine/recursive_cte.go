@@ -0,0 +1,211 @@
+package storageengine
+
+import (
+	"fmt"
+	"strings"
+
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+)
+
+/*
+This file contains WITH RECURSIVE. Ordinary CTEs never get here: the code
+generator inlines them as derived tables. A recursive CTE
+
+	WITH RECURSIVE tree(id, parent) AS (
+		SELECT id, parent FROM category WHERE parent IS NULL      -- anchor
+		UNION
+		SELECT c.id, c.parent FROM category c JOIN tree t ON c.parent = t.id
+	)
+
+is evaluated with a work table:
+
+	result, work ← rows of the anchor
+	while work is not empty:
+		work ← rows of the recursive part, reading the CTE as work
+		UNION: drop the rows already in result
+		result ← result + work
+
+UNION keeps every row once, which also stops the iteration when the data has
+a cycle. UNION ALL does not, so after maxRecursion iterations the query fails
+instead of running forever.
+*/
+
+const defaultMaxRecursion = 1000
+
+// workTable holds the rows the recursive part of a running query reads.
+type workTable struct {
+	columns []string
+	rows    []map[string]interface{}
+	estRows float64 // planning only
+}
+
+// executeRecursive runs the query of a recursive CTE.
+func (se *StorageEngine) executeRecursive(snap *txn.Snapshot, payload types.SelectPayload) ([]map[string]interface{}, []string, *types.PlanNode, error) {
+	setOp := payload.SetOp
+	m := se.startOp()
+
+	anchorRows, anchorCols, anchorPlan, err := se.executeSelect(snap, *setOp.Left)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	columns := anchorCols
+	if len(payload.OutputNames) > 0 {
+		columns = payload.OutputNames
+	}
+	work, err := conformRows(anchorRows, anchorCols, columns, setOp.Types)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	seen := make(map[string]bool)
+	if !setOp.All {
+		work = unseenRows(work, columns, seen)
+	}
+	result := append([]map[string]interface{}{}, work...)
+
+	key := strings.ToLower(payload.Recursive)
+	defer se.restoreWorkTable(key, se.workTables[key]) // a CTE of the same name around this one
+
+	var stepPlan *types.PlanNode
+	for iteration := 1; len(work) > 0; iteration++ {
+		if iteration > se.maxRecursion {
+			return nil, nil, nil, fmt.Errorf("recursive query %q did not finish after %d iterations; a cycle with UNION ALL? (use UNION or raise DAEMONDB_MAX_RECURSION)",
+				payload.Recursive, se.maxRecursion)
+		}
+
+		se.workTables[key] = &workTable{columns: columns, rows: work}
+		stepRows, stepCols, plan, err := se.executeSelect(snap, *setOp.Right)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if stepPlan == nil {
+			stepPlan = plan
+		}
+		if len(stepCols) != len(columns) {
+			return nil, nil, nil, fmt.Errorf("each UNION query must have the same number of columns (%d and %d)", len(columns), len(stepCols))
+		}
+
+		if work, err = conformRows(stepRows, stepCols, columns, setOp.Types); err != nil {
+			return nil, nil, nil, err
+		}
+		if !setOp.All {
+			work = unseenRows(work, columns, seen)
+		}
+		result = append(result, work...)
+	}
+
+	if stepPlan == nil {
+		// the anchor had no rows, so the recursive part never ran
+		se.workTables[key] = &workTable{columns: columns}
+		if stepPlan, err = se.planSelect(snap, *setOp.Right); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	plan := recursiveNode(payload, anchorPlan, stepPlan)
+	se.finishOp(plan, m, len(result))
+	return result, columns, plan, nil
+}
+
+// unseenRows returns the rows not in seen, each once, and adds them to seen.
+func unseenRows(rows []map[string]interface{}, columns []string, seen map[string]bool) []map[string]interface{} {
+	fresh := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		key := hashKey(row, columns)
+		if !seen[key] {
+			seen[key] = true
+			fresh = append(fresh, row)
+		}
+	}
+	return fresh
+}
+
+// restoreWorkTable puts back the work table a query replaced, if any.
+func (se *StorageEngine) restoreWorkTable(key string, wt *workTable) {
+	if wt == nil {
+		delete(se.workTables, key)
+		return
+	}
+	se.workTables[key] = wt
+}
+
+// readWorkTable returns the rows of the work table named by payload. They are
+// copied, since the operators above may add keys to the rows they get.
+func (se *StorageEngine) readWorkTable(payload types.SelectPayload) ([]map[string]interface{}, []string, *types.PlanNode, error) {
+	m := se.startOp()
+	wt, ok := se.workTables[strings.ToLower(payload.WorkTable)]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("work table of recursive query %q is not available", payload.WorkTable)
+	}
+
+	rows := make([]map[string]interface{}, len(wt.rows))
+	for i, row := range wt.rows {
+		rows[i] = make(map[string]interface{}, len(row))
+		for k, v := range row {
+			rows[i][k] = v
+		}
+	}
+
+	plan := workTableNode(payload, wt)
+	se.finishOp(plan, m, len(rows))
+	return rows, wt.columns, plan, nil
+}
+
+// planWorkTable plans reading the work table named by payload.
+func (se *StorageEngine) planWorkTable(payload types.SelectPayload) (*types.PlanNode, error) {
+	wt, ok := se.workTables[strings.ToLower(payload.WorkTable)]
+	if !ok {
+		return nil, fmt.Errorf("work table of recursive query %q is not available", payload.WorkTable)
+	}
+	return workTableNode(payload, wt), nil
+}
+
+// planRecursive plans the query of a recursive CTE; the recursive part is
+// planned for one iteration on the anchor's estimated rows.
+func (se *StorageEngine) planRecursive(snap *txn.Snapshot, payload types.SelectPayload) (*types.PlanNode, error) {
+	anchor, err := se.planSelect(snap, *payload.SetOp.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strings.ToLower(payload.Recursive)
+	defer se.restoreWorkTable(key, se.workTables[key])
+	se.workTables[key] = &workTable{estRows: anchor.EstRows}
+
+	step, err := se.planSelect(snap, *payload.SetOp.Right)
+	if err != nil {
+		return nil, err
+	}
+	return recursiveNode(payload, anchor, step), nil
+}
+
+// recursiveNode describes the iteration of a recursive CTE. Under EXPLAIN
+// ANALYZE the recursive part shows its first iteration.
+func recursiveNode(payload types.SelectPayload, anchor, step *types.PlanNode) *types.PlanNode {
+	node := &types.PlanNode{
+		Operator: "Recursive Union",
+		Relation: payload.Recursive,
+		EstRows:  anchor.EstRows + step.EstRows,
+		EstCost:  anchor.EstCost + step.EstCost + (anchor.EstRows+step.EstRows)*cpuTupleCost,
+		Children: []*types.PlanNode{anchor, step},
+	}
+	if payload.SetOp.All {
+		node.Operator = "Recursive Union All"
+	}
+	return node
+}
+
+// workTableNode describes reading the work table of a recursive CTE.
+func workTableNode(payload types.SelectPayload, wt *workTable) *types.PlanNode {
+	n := wt.estRows
+	if wt.rows != nil {
+		n = float64(len(wt.rows))
+	}
+	return &types.PlanNode{
+		Operator: "WorkTable Scan",
+		Relation: payload.WorkTable,
+		EstRows:  n,
+		EstCost:  n * cpuTupleCost,
+	}
+}
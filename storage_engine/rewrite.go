@@ -0,0 +1,448 @@
+package storageengine
+
+import (
+	"strings"
+
+	"DaemonDB/types"
+)
+
+/*
+This file contains the rule-based rewriter applied to a SELECT before it runs.
+
+	constant folding     constant sub-expressions are evaluated once:
+	                     price > 2 * 50  →  price > 100,  x AND TRUE  →  x
+	outer → inner        a WHERE conjunct that can not be true when a table's
+	                     columns are NULL removes the rows an outer join pads
+	                     with NULLs for it, so the join can be an inner join:
+	                     a LEFT JOIN b ON ... WHERE b.x > 5  →  a JOIN b ON ...
+	predicate pushdown   WHERE conjuncts (and ON conjuncts of the side an outer
+	                     join does not preserve) that reference a single FROM
+	                     item filter that item while it is read, through its
+	                     primary key index when they can, instead of the joined rows;
+	                     WHERE conjuncts over several items join them: they move
+	                     to the ON clause of the inner join of the last of them,
+	                     so FROM a, b WHERE a.k = b.k is an equi-join
+	projection pruning   columns the query never references are not put in the
+	                     rows of a join
+
+Expressions are never modified in place: a correlated subquery is rewritten
+again for every set of outer values, so rewritten nodes are copies.
+
+Nothing is printed: EXPLAIN shows the rewritten query, with the join types it
+ended up with and every pushed-down predicate as the Filter of its scan.
+*/
+
+// foldConstants returns expr with its constant sub-expressions evaluated.
+// Expressions whose evaluation fails (1 / 0) are left for execution to report.
+func foldConstants(expr *types.ExpressionNode) *types.ExpressionNode {
+	if expr == nil || expr.Type == types.ExprLiteral {
+		return expr
+	}
+	if isConstantExpr(expr) {
+		val, err := types.EvalExpression(expr, nil)
+		if err != nil {
+			return expr
+		}
+		return &types.ExpressionNode{Type: types.ExprLiteral, Literal: val, DataType: types.TypeOfValue(val)}
+	}
+
+	folded := expr.MapChildren(foldConstants)
+	if folded.Type != types.ExprLogical || folded.Left == nil || folded.Right == nil {
+		return folded
+	}
+
+	// x AND TRUE → x, x AND FALSE → FALSE, x OR TRUE → TRUE, x OR FALSE → x
+	and := strings.EqualFold(folded.Op, "AND")
+	for _, pair := range [][2]*types.ExpressionNode{{folded.Left, folded.Right}, {folded.Right, folded.Left}} {
+		b, ok := boolLiteral(pair[0])
+		if !ok {
+			continue
+		}
+		if b == and {
+			return pair[1]
+		}
+		return pair[0]
+	}
+	return folded
+}
+
+func boolLiteral(expr *types.ExpressionNode) (bool, bool) {
+	if expr.Type != types.ExprLiteral {
+		return false, false
+	}
+	b, ok := expr.Literal.(bool)
+	return b, ok
+}
+
+// foldSelect folds the constants of every expression of payload.
+func foldSelect(payload *types.SelectPayload) {
+	if payload.WhereExpr != nil {
+		payload.WhereExpr = foldConstants(payload.WhereExpr)
+		if b, ok := boolLiteral(payload.WhereExpr); ok && b {
+			payload.WhereExpr = nil
+		}
+	}
+
+	if len(payload.Joins) > 0 {
+		payload.Joins = append([]types.JoinClause{}, payload.Joins...)
+		for i := range payload.Joins {
+			payload.Joins[i].On = foldConstants(payload.Joins[i].On)
+		}
+	}
+	if len(payload.Projections) > 0 {
+		payload.Projections = append([]types.Projection{}, payload.Projections...)
+		for i := range payload.Projections {
+			payload.Projections[i].Expr = foldConstants(payload.Projections[i].Expr)
+		}
+	}
+	if len(payload.OrderBy) > 0 {
+		payload.OrderBy = append([]types.OrderByItem{}, payload.OrderBy...)
+		for i := range payload.OrderBy {
+			payload.OrderBy[i].Expr = foldConstants(payload.OrderBy[i].Expr)
+		}
+	}
+}
+
+// neededColumns returns the (lower-case, unqualified) names of the columns a
+// join query may reference, or nil when every column is needed (SELECT *,
+// NATURAL JOIN). Names are matched without their qualifier, so a column is
+// kept whenever any table's column of that name is referenced.
+func neededColumns(payload *types.SelectPayload) map[string]bool {
+	if len(payload.Projections) == 0 {
+		return nil
+	}
+	needed := map[string]bool{}
+	add := func(name string) {
+		name = strings.ToLower(name)
+		needed[name[strings.LastIndex(name, ".")+1:]] = true
+	}
+
+	var walkPayload func(p *types.SelectPayload) bool
+	var walk func(expr *types.ExpressionNode) bool
+	walk = func(expr *types.ExpressionNode) bool {
+		if expr == nil {
+			return true
+		}
+		if expr.Type == types.ExprColumn {
+			add(expr.Column)
+		}
+		if expr.Subquery != nil && !walkPayload(expr.Subquery) {
+			return false
+		}
+		for _, child := range expr.Children() {
+			if !walk(child) {
+				return false
+			}
+		}
+		return true
+	}
+	walkPayload = func(p *types.SelectPayload) bool {
+		exprs := []*types.ExpressionNode{p.WhereExpr}
+		for _, ref := range p.TableRefs() {
+			if ref.Subquery != nil && !walkPayload(ref.Subquery) {
+				return false
+			}
+		}
+		for _, join := range p.Joins {
+			if join.Natural {
+				return false
+			}
+			for _, col := range join.Using {
+				add(col)
+			}
+			exprs = append(exprs, join.On)
+		}
+		for _, proj := range p.Projections {
+			exprs = append(exprs, proj.Expr)
+		}
+		for _, item := range p.OrderBy {
+			exprs = append(exprs, item.Expr)
+		}
+		for _, expr := range exprs {
+			if !walk(expr) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !walkPayload(payload) {
+		return nil
+	}
+	return needed
+}
+
+// joinRewriter rewrites the joins and WHERE clause of one join query. Items
+// are the FROM items in order: 0 is the FROM table, i+1 the item of Joins[i].
+type joinRewriter struct {
+	payload *types.SelectPayload
+	refs    []types.TableRef
+	columns []map[string]bool // lower-case column names of every item
+}
+
+// rewriteJoins converts outer joins to inner joins where WHERE allows it and
+// moves single-item predicates out of WHERE and ON. It returns the filter of
+// every FROM item (nil: none) and the rewriter, which knows the item of every
+// column.
+func (se *StorageEngine) rewriteJoins(payload *types.SelectPayload) ([]*types.ExpressionNode, *joinRewriter, error) {
+	rw := &joinRewriter{payload: payload, refs: payload.TableRefs()}
+	for _, ref := range rw.refs {
+		cols, err := se.tableRefColumns(ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		set := make(map[string]bool, len(cols))
+		for _, col := range cols {
+			set[strings.ToLower(col)] = true
+		}
+		rw.columns = append(rw.columns, set)
+	}
+	payload.Joins = append([]types.JoinClause{}, payload.Joins...)
+
+	where := splitConjuncts(payload.WhereExpr)
+	rw.simplifyOuterJoins(where)
+
+	filters := make([]*types.ExpressionNode, len(rw.refs))
+	push := func(item int, conj *types.ExpressionNode) {
+		filters[item] = andExpr(filters[item], conj)
+	}
+
+	// ON: conjuncts on the side the join does not preserve
+	nullable := make([]bool, len(rw.refs))
+	for j := range payload.Joins {
+		join := &payload.Joins[j]
+		typ := strings.ToUpper(join.Type)
+		if join.On != nil && (typ == "INNER" || typ == "LEFT" || typ == "RIGHT" || typ == "") {
+			var rest *types.ExpressionNode
+			for _, conj := range splitConjuncts(join.On) {
+				item, ok := rw.singleItem(conj)
+				switch {
+				case ok && item == j+1 && typ != "RIGHT":
+					push(item, conj)
+				case ok && item <= j && typ != "LEFT" && !nullable[item]:
+					push(item, conj)
+				default:
+					rest = andExpr(rest, conj)
+				}
+			}
+			if rest == nil {
+				rest = &types.ExpressionNode{Type: types.ExprLiteral, Literal: true, DataType: types.TypeBool}
+			}
+			join.On = rest
+		}
+		markNullable(nullable, j, typ)
+	}
+
+	// WHERE: conjuncts on items no outer join pads with NULLs
+	var rest *types.ExpressionNode
+	for _, conj := range where {
+		items, ok := rw.itemsOf(conj)
+		for item := range items {
+			ok = ok && !nullable[item]
+		}
+		last := -1
+		for item := range items {
+			last = max(last, item)
+		}
+
+		switch {
+		case ok && len(items) == 1:
+			push(last, conj)
+		case ok && len(items) > 1:
+			join := &payload.Joins[last-1]
+			typ := strings.ToUpper(join.Type)
+			if (typ != "INNER" && typ != "CROSS" && typ != "") || join.Natural || len(join.Using) > 0 {
+				rest = andExpr(rest, conj)
+				continue
+			}
+			on := join.On
+			if on != nil {
+				if b, isBool := boolLiteral(on); isBool && b {
+					on = nil
+				}
+			}
+			join.Type = "INNER"
+			join.On = andExpr(on, conj)
+		default:
+			rest = andExpr(rest, conj)
+		}
+	}
+	payload.WhereExpr = rest
+	return filters, rw, nil
+}
+
+// simplifyOuterJoins turns outer joins into inner (or one-sided) joins when a
+// WHERE conjunct rejects the NULL-padded rows of their null-supplying side.
+func (rw *joinRewriter) simplifyOuterJoins(where []*types.ExpressionNode) {
+	rejected := func(items ...int) bool {
+		for _, conj := range where {
+			for _, item := range items {
+				if rw.rejectsNull(conj, item) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for j := range rw.payload.Joins {
+		join := &rw.payload.Joins[j]
+		left := make([]int, j+1)
+		for i := range left {
+			left[i] = i
+		}
+
+		typ := strings.ToUpper(join.Type)
+		newType := typ
+		switch typ {
+		case "LEFT":
+			if rejected(j + 1) {
+				newType = "INNER"
+			}
+		case "RIGHT":
+			if rejected(left...) {
+				newType = "INNER"
+			}
+		case "FULL":
+			l, r := rejected(left...), rejected(j+1)
+			switch {
+			case l && r:
+				newType = "INNER"
+			case l:
+				newType = "LEFT"
+			case r:
+				newType = "RIGHT"
+			}
+		}
+		if newType != typ {
+			join.Type = newType
+		}
+	}
+}
+
+// markNullable records the items join j pads with NULLs.
+func markNullable(nullable []bool, j int, typ string) {
+	switch typ {
+	case "LEFT":
+		nullable[j+1] = true
+	case "RIGHT":
+		for i := 0; i <= j; i++ {
+			nullable[i] = true
+		}
+	case "FULL":
+		for i := 0; i <= j+1; i++ {
+			nullable[i] = true
+		}
+	}
+}
+
+// itemOf returns the FROM item a column reference belongs to, or -1 when that
+// is not known (ambiguous names, merged USING columns, outer references).
+func (rw *joinRewriter) itemOf(column string) int {
+	name := strings.ToLower(column)
+	if dot := strings.LastIndex(name, "."); dot != -1 {
+		for i, ref := range rw.refs {
+			if strings.EqualFold(ref.Name(), name[:dot]) && rw.columns[i][name[dot+1:]] {
+				return i
+			}
+		}
+		return -1
+	}
+
+	found := -1
+	for i := range rw.refs {
+		if rw.columns[i][name] {
+			if found != -1 {
+				return -1
+			}
+			found = i
+		}
+	}
+	return found
+}
+
+// itemsOf returns the FROM items the columns of expr belong to. It fails for
+// expressions without columns, with columns of unknown items, or with subqueries.
+func (rw *joinRewriter) itemsOf(expr *types.ExpressionNode) (map[int]bool, bool) {
+	items := map[int]bool{}
+	ok := true
+	var walk func(e *types.ExpressionNode)
+	walk = func(e *types.ExpressionNode) {
+		if e.Subquery != nil {
+			ok = false
+		}
+		if e.Type == types.ExprColumn {
+			i := rw.itemOf(e.Column)
+			if i == -1 {
+				ok = false
+			}
+			items[i] = true
+		}
+		for _, child := range e.Children() {
+			walk(child)
+		}
+	}
+	walk(expr)
+	return items, ok && len(items) > 0
+}
+
+// singleItem returns the one FROM item every column of expr belongs to.
+func (rw *joinRewriter) singleItem(expr *types.ExpressionNode) (int, bool) {
+	items, ok := rw.itemsOf(expr)
+	if !ok || len(items) != 1 {
+		return -1, false
+	}
+	for item := range items {
+		return item, true
+	}
+	return -1, false
+}
+
+// strictIn reports whether expr is NULL whenever the columns of item are NULL.
+func (rw *joinRewriter) strictIn(expr *types.ExpressionNode, item int) bool {
+	if expr == nil {
+		return false
+	}
+	switch expr.Type {
+	case types.ExprColumn:
+		return rw.itemOf(expr.Column) == item
+	case types.ExprBinary, types.ExprComparison, types.ExprLike:
+		return rw.strictIn(expr.Left, item) || rw.strictIn(expr.Right, item)
+	case types.ExprCast, types.ExprBetween, types.ExprIn:
+		return rw.strictIn(expr.Left, item)
+	case types.ExprLogical:
+		if strings.EqualFold(expr.Op, "NOT") {
+			return rw.strictIn(expr.Left, item)
+		}
+		return rw.strictIn(expr.Left, item) && rw.strictIn(expr.Right, item)
+	}
+	return false
+}
+
+// rejectsNull reports whether the predicate expr can not be true when the
+// columns of item are NULL.
+func (rw *joinRewriter) rejectsNull(expr *types.ExpressionNode, item int) bool {
+	if rw.strictIn(expr, item) {
+		return true
+	}
+	if expr.Type == types.ExprLogical {
+		switch strings.ToUpper(expr.Op) {
+		case "AND":
+			return rw.rejectsNull(expr.Left, item) || rw.rejectsNull(expr.Right, item)
+		case "OR":
+			return rw.rejectsNull(expr.Left, item) && rw.rejectsNull(expr.Right, item)
+		}
+	}
+	return false
+}
+
+// andExpr returns left AND right, or the one that is not nil.
+func andExpr(left, right *types.ExpressionNode) *types.ExpressionNode {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	return &types.ExpressionNode{Type: types.ExprLogical, Op: "AND", Left: left, Right: right}
+}
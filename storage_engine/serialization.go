@@ -13,7 +13,8 @@ import (
 // SerializeRow converts column definitions and values (as a slice) into binary.
 // This is the version called by InsertRow when values come from the VM stack.
 //
-// values must be in the same order as cols.
+// values must be in the same order as cols. Virtual generated columns are
+// not serialized.
 func (se *StorageEngine) SerializeRow(cols []types.ColumnDef, values []any) ([]byte, error) {
 	if len(cols) != len(values) {
 		return nil, fmt.Errorf("column count (%d) != value count (%d)", len(cols), len(values))
@@ -22,6 +23,9 @@ func (se *StorageEngine) SerializeRow(cols []types.ColumnDef, values []any) ([]b
 	buf := new(bytes.Buffer)
 
 	for i, col := range cols {
+		if col.IsVirtual() {
+			continue
+		}
 		b, err := ValueToBytes(values[i], col.Type)
 		if err != nil {
 			return nil, fmt.Errorf("column %s: %w", col.Name, err)
@@ -38,6 +42,9 @@ func (se *StorageEngine) SerializeRowFromMap(cols []types.ColumnDef, row types.R
 	buf := new(bytes.Buffer)
 
 	for _, col := range cols {
+		if col.IsVirtual() {
+			continue
+		}
 		val, ok := row.Values[strings.ToLower(col.Name)]
 		if !ok {
 			return nil, fmt.Errorf("missing value for column %s", col.Name)
@@ -128,11 +135,18 @@ func BytesToValue(b []byte, typ string) (any, int, error) {
 	return nil, 0, fmt.Errorf("unknown type %s", typ)
 }
 
+// DeserializeRow decodes a row of a table with columns cols; its virtual
+// generated columns are computed from the others.
 func (se *StorageEngine) DeserializeRow(row []byte, cols []types.ColumnDef) ([]any, error) {
 	out := make([]any, len(cols))
 	offset := 0
+	virtual := false
 
 	for i, col := range cols {
+		if col.IsVirtual() {
+			virtual = true
+			continue
+		}
 		if offset >= len(row) {
 			return nil, fmt.Errorf("not enough data for column %s (offset %d >= row length %d)",
 				col.Name, offset, len(row))
@@ -150,6 +164,11 @@ func (se *StorageEngine) DeserializeRow(row []byte, cols []types.ColumnDef) ([]a
 		return nil, fmt.Errorf("extra bytes at end of row: expected total %d bytes, got %d bytes (unused: %d bytes)",
 			offset, len(row), len(row)-offset)
 	}
+	if virtual {
+		if err := computeGenerated(cols, out, true); err != nil {
+			return nil, err
+		}
+	}
 	return out, nil
 }
 
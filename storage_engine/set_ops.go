@@ -0,0 +1,265 @@
+package storageengine
+
+import (
+	"fmt"
+	"sort"
+
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+)
+
+/*
+This file contains SELECT DISTINCT and the set operations between queries:
+
+	left UNION [ALL] right        rows of either side (ALL keeps duplicates)
+	left INTERSECT [ALL] right    rows of left that right has too
+	left EXCEPT [ALL] right       rows of left that right does not have
+
+Both sides are executed, their rows renamed to the left side's columns and
+converted to the common column types the type checker chose (INT UNION FLOAT
+gives FLOAT). Rows are compared on all their columns, NULL equal to NULL.
+
+Deduplication is hash based. Without ALL every distinct row is kept once;
+INTERSECT ALL keeps min(m, n) copies of a row found m times on the left and n
+times on the right, EXCEPT ALL max(m - n, 0). UNION ALL needs no hashing.
+
+When both sides together have more than joinMemoryRows rows, they are hash
+partitioned to disk on all columns like the grace hash join does (spill.go),
+so equal rows land in the same partition, and one partition pair at a time is
+processed in memory; a pair still over the budget is partitioned again. The
+inputs are dropped as they are written. Rows carry their input position
+through the partitions; the result is put back in that order, so output order
+never depends on the partitioning: first occurrences, in left-then-right order.
+EXPLAIN ANALYZE shows the partitions and the most rows held at once on the
+Distinct, Union, Intersect or Except node; the result itself stays in memory.
+*/
+
+// setPosKey is the temporary row key holding a row's input position; '#' can
+// not appear in identifiers, so it never clashes with a column.
+const setPosKey = "#set_pos"
+
+// executeSetOperation runs left UNION | INTERSECT | EXCEPT [ALL] right.
+func (se *StorageEngine) executeSetOperation(snap *txn.Snapshot, setOp *types.SetOperation) ([]map[string]interface{}, []string, *types.PlanNode, error) {
+	m := se.startOp()
+	leftRows, columns, leftPlan, err := se.executeSelect(snap, *setOp.Left)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rightRows, rightCols, rightPlan, err := se.executeSelect(snap, *setOp.Right)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(rightCols) != len(columns) {
+		return nil, nil, nil, fmt.Errorf("each %s query must have the same number of columns (%d and %d)", setOp.Op, len(columns), len(rightCols))
+	}
+
+	if leftRows, err = conformRows(leftRows, columns, columns, setOp.Types); err != nil {
+		return nil, nil, nil, err
+	}
+	if rightRows, err = conformRows(rightRows, rightCols, columns, setOp.Types); err != nil {
+		return nil, nil, nil, err
+	}
+
+	rows, spilled, err := se.combineRows(setOp.Op, setOp.All, leftRows, rightRows, columns)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	plan := se.setOpNode(setOp, leftPlan, rightPlan)
+	se.finishOp(plan, m, len(rows))
+	spilled.record(plan)
+	return rows, columns, plan, nil
+}
+
+// conformRows renames the columns of rows from "from" to "to", by position,
+// and converts every value to the column's common type. The rows are replaced
+// in place, so the originals can be freed as it goes.
+func conformRows(rows []map[string]interface{}, from, to, colTypes []string) ([]map[string]interface{}, error) {
+	for i, row := range rows {
+		conformed := make(map[string]interface{}, len(to))
+		for j, col := range to {
+			val := row[from[j]]
+			if j < len(colTypes) && val != nil {
+				cast, err := types.CastValue(val, colTypes[j])
+				if err != nil {
+					return nil, fmt.Errorf("column %s: %w", col, err)
+				}
+				val = cast
+			}
+			conformed[col] = val
+		}
+		rows[i] = conformed
+	}
+	return rows, nil
+}
+
+// distinctRows removes duplicate rows, keeping the first of each in place.
+func (se *StorageEngine) distinctRows(rows []map[string]interface{}, columns []string) ([]map[string]interface{}, spillStats, error) {
+	return se.combineRows("UNION", false, rows, nil, columns)
+}
+
+// combineRows applies a set operation to two row sets with the same columns.
+func (se *StorageEngine) combineRows(op string, all bool, left, right []map[string]interface{}, columns []string) ([]map[string]interface{}, spillStats, error) {
+	if op == "UNION" && all {
+		return append(left, right...), spillStats{}, nil
+	}
+	if len(left)+len(right) <= se.joinMemoryRows {
+		return setKernel(op, all, left, right, columns), spillStats{}, nil
+	}
+	s := &setSpiller{se: se, op: op, all: all, columns: columns}
+	if err := s.run(left, right); err != nil {
+		return nil, spillStats{}, err
+	}
+	return s.result, s.stats, nil
+}
+
+// setKernel is the in-memory set operation; see the top of the file.
+func setKernel(op string, all bool, left, right []map[string]interface{}, columns []string) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	seen := make(map[string]bool)
+
+	if op == "UNION" {
+		for _, rows := range [][]map[string]interface{}{left, right} {
+			for _, row := range rows {
+				key := hashKey(row, columns)
+				if !seen[key] {
+					seen[key] = true
+					result = append(result, row)
+				}
+			}
+		}
+		return result
+	}
+
+	// INTERSECT and EXCEPT: how often every row occurs on the right
+	counts := make(map[string]int, len(right))
+	for _, row := range right {
+		counts[hashKey(row, columns)]++
+	}
+	intersect := op == "INTERSECT"
+	for _, row := range left {
+		key := hashKey(row, columns)
+		if !all {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if (counts[key] > 0) == intersect {
+				result = append(result, row)
+			}
+			continue
+		}
+		// every right row cancels out one left row
+		if counts[key] > 0 {
+			counts[key]--
+			if intersect {
+				result = append(result, row)
+			}
+		} else if !intersect {
+			result = append(result, row)
+		}
+	}
+	return result
+}
+
+// setSpiller is one set operation that spills: what it computes and the rows
+// it has kept so far.
+type setSpiller struct {
+	se      *StorageEngine
+	op      string
+	all     bool
+	columns []string
+	result  []map[string]interface{}
+	stats   spillStats
+}
+
+// run hash partitions both inputs to disk and runs setKernel on one partition
+// pair at a time.
+func (s *setSpiller) run(left, right []map[string]interface{}) error {
+	d, err := s.se.newSpillDir("setop")
+	if err != nil {
+		return err
+	}
+	defer d.remove()
+
+	n := s.se.spillPartitions(len(left) + len(right))
+	leftParts, err := s.partition(d, "left", left, 0, n)
+	if err != nil {
+		return err
+	}
+	rightParts, err := s.partition(d, "right", right, len(left), n)
+	if err != nil {
+		return err
+	}
+	s.stats.partitions = n
+	for i := 0; i < n; i++ {
+		if err := s.combinePartition(d, leftParts, rightParts, i); err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(s.result, func(a, b int) bool {
+		return s.result[a][setPosKey].(int) < s.result[b][setPosKey].(int)
+	})
+	for _, row := range s.result {
+		delete(row, setPosKey)
+	}
+	return nil
+}
+
+// partition writes rows to n partitions, tagged with their input position
+// from first on, and drops them from the slice.
+func (s *setSpiller) partition(d *spillDir, side string, rows []map[string]interface{}, first, n int) (*partitioner, error) {
+	p, err := d.partitioner(side, s.columns, n, 0)
+	if err != nil {
+		return nil, err
+	}
+	pos := first
+	err = releaseRows(rows, func(row map[string]interface{}) error {
+		row[setPosKey] = pos
+		pos++
+		return p.add(row)
+	})
+	if cerr := p.close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// combinePartition runs setKernel on partition i of left and right. A pair
+// over the budget is partitioned again.
+func (s *setSpiller) combinePartition(d *spillDir, left, right *partitioner, i int) error {
+	if size := left.counts[i] + right.counts[i]; size > s.se.joinMemoryRows && left.level < maxSpillLevel {
+		n := s.se.spillPartitions(size)
+		subLeft, err := d.repartition(left, i, "left", n)
+		if err != nil {
+			return err
+		}
+		subRight, err := d.repartition(right, i, "right", n)
+		if err != nil {
+			return err
+		}
+		s.stats.partitions += n
+		for k := 0; k < n; k++ {
+			if err := s.combinePartition(d, subLeft, subRight, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	leftRows, err := readPartition(left.names[i], left.counts[i])
+	if err != nil {
+		return err
+	}
+	rightRows, err := readPartition(right.names[i], right.counts[i])
+	if err != nil {
+		return err
+	}
+	s.stats.hold(len(leftRows) + len(rightRows))
+	s.result = append(s.result, setKernel(s.op, s.all, leftRows, rightRows, s.columns)...)
+	return nil
+}
@@ -0,0 +1,232 @@
+package storageengine
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+
+	"DaemonDB/types"
+)
+
+/*
+This file contains the spill files of the operators that do not fit in
+joinMemoryRows rows: the grace hash join, the set operations and the windows.
+
+	spillDir          a temporary directory in the database directory,
+	                  removed when the operator is done
+	partitioner       hash partitions rows on a list of keys into n files; a
+	                  row is gob-encoded onto its file as it is added, so the
+	                  caller can drop it right away
+	eachPartitionRow  reads a partition back one row at a time
+
+A partition that is still larger than the budget is partitioned again on the
+same keys by the hash of the next level. Rows whose keys are all equal never
+split, so that stops after maxSpillLevel levels and the partition is processed
+as it is.
+
+Operators release their input as they spill it (releaseRows): the rows of one
+operator are handed to the next in a slice, so a row the partitioner has
+written stays in memory only if the slice still points at it.
+*/
+
+const maxSpillLevel = 3
+
+// spillStats is what an operator that may spill reports to EXPLAIN ANALYZE:
+// the partitions it wrote and the most rows it held in memory at once, apart
+// from its input and its result. Both are 0 when it ran in memory.
+type spillStats struct {
+	partitions int
+	peakRows   int
+}
+
+// hold records that n rows are in memory at once.
+func (s *spillStats) hold(n int) {
+	if n > s.peakRows {
+		s.peakRows = n
+	}
+}
+
+// record puts s on node, the operator's plan node, once finishOp has run.
+func (s spillStats) record(node *types.PlanNode) {
+	if node == nil || node.Actual == nil {
+		return
+	}
+	node.Actual.Partitions, node.Actual.PeakRows = s.partitions, s.peakRows
+}
+
+// spillPartitions is the number of partitions rows rows are split into, so
+// that a partition holds about half the budget.
+func (se *StorageEngine) spillPartitions(rows int) int {
+	return 2 * ((rows + se.joinMemoryRows - 1) / se.joinMemoryRows)
+}
+
+type spillDir struct {
+	dir  string
+	next int // number of the next partitioner, for unique file names
+}
+
+func (se *StorageEngine) newSpillDir(prefix string) (*spillDir, error) {
+	dir, err := os.MkdirTemp(filepath.Join(se.DbRoot, se.currDb), prefix+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+	return &spillDir{dir: dir}, nil
+}
+
+func (d *spillDir) remove() {
+	os.RemoveAll(d.dir)
+}
+
+// partitioner writes rows to n partition files by a hash of their keys.
+type partitioner struct {
+	names    []string
+	counts   []int // rows in every partition
+	keys     []string
+	level    int
+	files    []*os.File
+	writers  []*bufio.Writer
+	encoders []*gob.Encoder
+}
+
+// partitioner returns a partitioner of n files named after side, hashing on
+// keys at level.
+func (d *spillDir) partitioner(side string, keys []string, n, level int) (*partitioner, error) {
+	p := &partitioner{
+		names:    make([]string, n),
+		counts:   make([]int, n),
+		keys:     keys,
+		level:    level,
+		files:    make([]*os.File, n),
+		writers:  make([]*bufio.Writer, n),
+		encoders: make([]*gob.Encoder, n),
+	}
+	d.next++
+	for i := 0; i < n; i++ {
+		p.names[i] = filepath.Join(d.dir, fmt.Sprintf("%s_%d_%d.part", side, d.next, i))
+		f, err := os.Create(p.names[i])
+		if err != nil {
+			p.closeFiles()
+			return nil, fmt.Errorf("failed to create partition: %w", err)
+		}
+		p.files[i] = f
+		p.writers[i] = bufio.NewWriter(f)
+		p.encoders[i] = gob.NewEncoder(p.writers[i])
+	}
+	return p, nil
+}
+
+// add writes row to its partition.
+func (p *partitioner) add(row map[string]interface{}) error {
+	h := fnv.New32a()
+	h.Write([]byte(hashKey(row, p.keys)))
+	i := int(spillHash(h.Sum32(), p.level) % uint32(len(p.names)))
+	if err := p.encoders[i].Encode(row); err != nil {
+		p.closeFiles()
+		return fmt.Errorf("failed to spill row: %w", err)
+	}
+	p.counts[i]++
+	return nil
+}
+
+// spillHash mixes the key hash h with level, so that the rows of one partition
+// spread over all the partitions of the next level.
+func spillHash(h uint32, level int) uint32 {
+	h ^= uint32(level) * 0x9e3779b9
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// close flushes and closes the partition files; they can then be read.
+func (p *partitioner) close() error {
+	defer p.closeFiles()
+	for _, w := range p.writers {
+		if w == nil {
+			continue
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to write partition: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *partitioner) closeFiles() {
+	for i, f := range p.files {
+		if f != nil {
+			f.Close()
+			p.files[i] = nil
+		}
+	}
+}
+
+// repartition splits partition i of p into the partitions of a new
+// partitioner, one level down, and removes its file.
+func (d *spillDir) repartition(p *partitioner, i int, side string, n int) (*partitioner, error) {
+	sub, err := d.partitioner(side, p.keys, n, p.level+1)
+	if err != nil {
+		return nil, err
+	}
+	err = eachPartitionRow(p.names[i], sub.add)
+	if cerr := sub.close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(p.names[i])
+	return sub, nil
+}
+
+// eachPartitionRow calls fn with every row of the partition file name, in
+// the order they were written, reading one row at a time.
+func eachPartitionRow(name string, fn func(map[string]interface{}) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open partition: %w", err)
+	}
+	defer f.Close()
+	dec := gob.NewDecoder(bufio.NewReader(f))
+	for {
+		row := map[string]interface{}{}
+		if err := dec.Decode(&row); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read partition: %w", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// readPartition returns every row of the partition file name.
+func readPartition(name string, size int) ([]map[string]interface{}, error) {
+	rows := make([]map[string]interface{}, 0, size)
+	err := eachPartitionRow(name, func(row map[string]interface{}) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+// releaseRows calls fn with every row of rows and drops it from the slice
+// once fn has returned, so that a row fn wrote to disk can be freed.
+func releaseRows(rows []map[string]interface{}, fn func(map[string]interface{}) error) error {
+	for i, row := range rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+		rows[i] = nil
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package storageengine
+
+import (
+	ssi "DaemonDB/storage_engine/ssi_manager"
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+	"errors"
+	"fmt"
+)
+
+/*
+Serializable transactions (SERIALIZABLE isolation level)
+
+A serializable transaction reads like a REPEATABLE READ one, and the SSI
+manager (ssi_manager/) is told what it reads and writes:
+
+	full scan, range scan        → SIREAD lock on the table
+	primary key lookup, FK check → SIREAD lock on the key, found or not
+	version skipped by a read    → rw-dependency reader → its writer
+	  (mvcc.go: its writer is not in the snapshot)
+	row locked for a write       → rw-dependencies from the holders of
+	  (exec_locks.go)              SIREAD locks on the row and its table
+	COMMIT                       → checked before the commit record
+
+A transaction completing a dangerous structure gets ssi.ErrSerializationFailure
+and is rolled back whole, like the loser of a first-updater-wins conflict
+(ErrSerialization); both are serialization failures (SQLSTATE 40001) and
+the transaction can be retried.
+
+Keys are named like the row locks (rowLockKey), so a key looked up and not
+found conflicts with the INSERT of it.
+*/
+
+// SerializationFailureCode is the SQLSTATE of a serialization failure.
+const SerializationFailureCode = "40001"
+
+// IsSerializationFailure reports whether err rolled back a transaction that
+// may succeed when retried: a concurrent update, or a dangerous structure of
+// serializable transactions.
+func IsSerializationFailure(err error) bool {
+	return errors.Is(err, ErrSerialization) || errors.Is(err, ssi.ErrSerializationFailure)
+}
+
+// registerSerializable starts tracking t when it runs SERIALIZABLE.
+func (se *StorageEngine) registerSerializable(t *txn.Transaction) {
+	if t.Isolation == txn.Serializable && se.SSIManager != nil {
+		se.SSIManager.Register(t)
+	}
+}
+
+// readTable takes a SIREAD lock on all of tableName for the transaction
+// reading.
+func (se *StorageEngine) readTable(snap *txn.Snapshot, tableName string) error {
+	return se.readTarget(snap, ssi.Target{Table: tableName})
+}
+
+// readRow takes a SIREAD lock on the row of tableName named key.
+func (se *StorageEngine) readRow(snap *txn.Snapshot, tableName, key string) error {
+	return se.readTarget(snap, ssi.Target{Table: tableName, Row: key})
+}
+
+// readKeys takes SIREAD locks on the encoded primary keys looked up in
+// tableName.
+func (se *StorageEngine) readKeys(snap *txn.Snapshot, tableName string, schema types.TableSchema, keys [][]byte) error {
+	if !se.readsSerializable(snap) {
+		return nil
+	}
+	for _, col := range schema.Columns {
+		if !col.IsPrimaryKey {
+			continue
+		}
+		for _, key := range keys {
+			if err := se.readRow(snap, tableName, pkLockKey(col.Type, key)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readPath takes the SIREAD locks of an index access path: the keys it looks
+// up, or the table for a range.
+func (se *StorageEngine) readPath(snap *txn.Snapshot, tableName string, schema types.TableSchema, path accessPath) error {
+	if path.keys != nil {
+		return se.readKeys(snap, tableName, schema, path.keys)
+	}
+	return se.readTable(snap, tableName)
+}
+
+func (se *StorageEngine) readTarget(snap *txn.Snapshot, target ssi.Target) error {
+	if !se.readsSerializable(snap) {
+		return nil
+	}
+	return se.SSIManager.Read(snap.Self, target)
+}
+
+// readConflict records that the reader of snap read past a version written
+// by writerID, which snap does not see.
+func (se *StorageEngine) readConflict(snap *txn.Snapshot, writerID uint64) error {
+	if snap.Self == 0 || se.SSIManager == nil {
+		return nil
+	}
+	return se.SSIManager.ReadConflict(snap.Self, writerID)
+}
+
+// readsSerializable reports whether the statement reads for a transaction
+// the SSI manager may track.
+func (se *StorageEngine) readsSerializable(snap *txn.Snapshot) bool {
+	return se.SSIManager != nil && snap.Self != 0
+}
+
+// writeConflicts records that tx writes the row of tableName named key (""
+// when it has no name yet), for the readers of it.
+func (se *StorageEngine) writeConflicts(tx *txn.Transaction, tableName, key string) error {
+	if tx == nil || se.SSIManager == nil {
+		return nil
+	}
+	return se.SSIManager.Write(tx.ID, tableName, key)
+}
+
+// pkLockKey names the row whose primary key of type keyType encodes as key,
+// for the lock manager and the SSI manager.
+func pkLockKey(keyType string, key []byte) string {
+	if v, _, err := BytesToValue(key, keyType); err == nil {
+		return fmt.Sprint(v)
+	}
+	return fmt.Sprintf("%x", key)
+}
@@ -0,0 +1,71 @@
+package ssi
+
+import "fmt"
+
+// addConflict records reader →rw writer and checks the structures it closes.
+// current is the transaction doing the read or write: when it is the one to
+// roll back it gets the error, any other one is doomed. m.mu must be held.
+func (m *SSIManager) addConflict(reader, writer, current *sxact) error {
+	if reader.out[writer.id] {
+		return nil
+	}
+	reader.out[writer.id] = true
+	writer.in[reader.id] = true
+
+	// writer as the pivot: reader →rw writer →rw out
+	for outID := range writer.out {
+		if out := m.txns[outID]; out != nil && committedFirst(out, reader, writer) {
+			return m.doom(writer, reader, out).failIf(current)
+		}
+	}
+	// reader as the pivot: in →rw reader →rw writer
+	for inID := range reader.in {
+		if in := m.txns[inID]; in != nil && committedFirst(writer, in, reader) {
+			return m.doom(reader, in, writer).failIf(current)
+		}
+	}
+	return nil
+}
+
+// committedFirst reports whether in →rw pivot →rw out is a dangerous
+// structure: out committed before the other two did.
+func committedFirst(out, in, pivot *sxact) bool {
+	if !out.committed {
+		return false
+	}
+	if pivot.committed && pivot.commitSeq < out.commitSeq {
+		return false
+	}
+	return in == out || !in.committed || in.commitSeq > out.commitSeq
+}
+
+// victim is the transaction a dangerous structure rolls back, nil when all of
+// it committed already.
+type victim struct {
+	s      *sxact
+	reason string
+}
+
+// doom picks the victim of in →rw pivot →rw out, the pivot when it can still
+// roll back, and marks it; m.mu must be held.
+func (m *SSIManager) doom(pivot, in, out *sxact) victim {
+	s := pivot
+	if s.committed {
+		s = in
+	}
+	if s.committed {
+		return victim{}
+	}
+	reason := fmt.Sprintf("txn %d →rw txn %d →rw txn %d, txn %d committed first", in.id, pivot.id, out.id, out.id)
+	s.doomed = reason
+	return victim{s: s, reason: reason}
+}
+
+// failIf returns the error of the victim when it is current, which rolls
+// back at once; any other victim fails at its next step.
+func (v victim) failIf(current *sxact) error {
+	if v.s == nil || v.s != current {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrSerializationFailure, v.reason)
+}
@@ -0,0 +1,278 @@
+package ssi
+
+import (
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+/*
+Serializable snapshot isolation (Cahill et al., as in PostgreSQL).
+
+Snapshot isolation lets two transactions each read what the other one
+writes and both commit (write skew), an outcome no serial order gives. SSI
+watches the rw-dependencies between serializable transactions:
+
+	R →rw W   R read a version and the concurrent W wrote a newer one
+	          (or a row R looked for and did not find)
+
+Every serializable history that is not serializable has a "dangerous
+structure" of two of them in a row, T_in →rw T_pivot →rw T_out (T_in may be
+T_out), where T_out commits first. A transaction is rolled back, with
+ErrSerializationFailure, once it would complete one; the pivot is chosen when
+it has not committed yet, else T_in. A transaction chosen by another one's
+check is doomed and fails at its next read, write or COMMIT.
+
+Dependencies are found from both sides:
+
+	read   → the reader skipped a version written by a transaction its
+	         snapshot does not see (ReadConflict), and keeps a SIREAD lock on
+	         what it read (Read): a table it scanned, or a key it looked up
+	write  → the writer checks the SIREAD locks on the row and its table held
+	         by concurrent transactions (Write)
+
+SIREAD locks never block anything, and they and the dependencies outlive the
+commit: they are dropped once every serializable transaction still running
+started after it. Only serializable transactions are tracked; reads and
+writes of the others are never part of a structure.
+
+The structures are checked on tables and primary keys, not on the WHERE
+clause, so a transaction can be rolled back although the rows involved did
+not overlap (a false positive, safe to retry); it is never kept when they
+did.
+*/
+
+// ErrSerializationFailure is returned when a serializable transaction is
+// rolled back to keep the history serializable. SQLSTATE 40001: retrying
+// the transaction from the start can succeed.
+var ErrSerializationFailure = errors.New("could not serialize access due to read/write dependencies among transactions")
+
+func NewSSIManager() *SSIManager {
+	return &SSIManager{
+		txns:    make(map[uint64]*sxact),
+		sireads: make(map[Target]map[uint64]bool),
+	}
+}
+
+// Register starts tracking the serializable transaction t.
+func (m *SSIManager) Register(t *txn.Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.txns[t.ID] = &sxact{
+		id:       t.ID,
+		snapshot: &t.Snapshot,
+		in:       make(map[uint64]bool),
+		out:      make(map[uint64]bool),
+		locks:    make(map[Target]bool),
+	}
+}
+
+// Read takes the SIREAD lock of transaction id on target. A key of a table
+// it holds whole is not locked again.
+func (m *SSIManager) Read(id uint64, target Target) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.txns[id]
+	if s == nil {
+		return nil
+	}
+	if err := s.check(); err != nil {
+		return err
+	}
+	if s.locks[target] || s.locks[Target{Table: target.Table}] {
+		return nil
+	}
+	s.locks[target] = true
+	if m.sireads[target] == nil {
+		m.sireads[target] = make(map[uint64]bool)
+	}
+	m.sireads[target][id] = true
+	return nil
+}
+
+// ReadConflict records that reader read past a version written by writer,
+// which its snapshot does not see.
+func (m *SSIManager) ReadConflict(readerID, writerID uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reader, writer := m.txns[readerID], m.txns[writerID]
+	if reader == nil {
+		return nil
+	}
+	if err := reader.check(); err != nil {
+		return err
+	}
+	if writer == nil || writer == reader {
+		return nil
+	}
+	return m.addConflict(reader, writer, reader)
+}
+
+// Write records that transaction id writes the row of table named row (""
+// for a row with no name yet): the concurrent holders of a SIREAD lock on it
+// or on the table read what it overwrites.
+func (m *SSIManager) Write(id uint64, table, row string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writer := m.txns[id]
+	if writer == nil {
+		return nil
+	}
+	if err := writer.check(); err != nil {
+		return err
+	}
+
+	targets := []Target{{Table: table}}
+	if row != "" {
+		targets = append(targets, Target{Table: table, Row: row})
+	}
+	for _, target := range targets {
+		for readerID := range m.sireads[target] {
+			reader := m.txns[readerID]
+			// a reader that committed before the writer began is serialized
+			// before it already
+			if reader == nil || reader == writer || writer.snapshot.Sees(readerID) {
+				continue
+			}
+			if err := m.addConflict(reader, writer, writer); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Commit checks that transaction id can commit and marks it committed. On
+// ErrSerializationFailure it must be rolled back (Release) instead.
+func (m *SSIManager) Commit(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.txns[id]
+	if s == nil {
+		return nil
+	}
+	if err := s.check(); err != nil {
+		return err
+	}
+	// as the pivot of a structure whose T_out committed first
+	for inID := range s.in {
+		for outID := range s.out {
+			in, out := m.txns[inID], m.txns[outID]
+			if in != nil && out != nil && committedFirst(out, in, s) {
+				return fmt.Errorf("%w: txn %d would be the pivot of %d →rw %d →rw %d at commit", ErrSerializationFailure, s.id, in.id, s.id, out.id)
+			}
+		}
+	}
+
+	m.commitSeq++
+	s.committed = true
+	s.commitSeq = m.commitSeq
+
+	// as the T_out committing first: the pivots that read what it wrote and
+	// have a dependency in can not commit any more
+	for pivotID := range s.in {
+		pivot := m.txns[pivotID]
+		if pivot == nil || pivot.committed {
+			continue
+		}
+		for inID := range pivot.in {
+			if in := m.txns[inID]; in != nil && committedFirst(s, in, pivot) {
+				m.doom(pivot, in, s)
+				break
+			}
+		}
+	}
+
+	m.cleanup()
+	return nil
+}
+
+// Release stops tracking transaction id, which rolled back, with its SIREAD
+// locks and dependencies.
+func (m *SSIManager) Release(id uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.txns[id]; s != nil {
+		m.forget(s)
+	}
+	m.cleanup()
+}
+
+// Locks returns the SIREAD locks held, by transaction and target.
+func (m *SSIManager) Locks() []LockInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var infos []LockInfo
+	for target, holders := range m.sireads {
+		for id := range holders {
+			infos = append(infos, LockInfo{TxnID: id, Table: target.Table, Row: target.Row})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if a.TxnID != b.TxnID {
+			return a.TxnID < b.TxnID
+		}
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Row < b.Row
+	})
+	return infos
+}
+
+// check fails a transaction another one's check doomed.
+func (s *sxact) check() error {
+	if s.doomed != "" {
+		return fmt.Errorf("%w: txn %d was chosen to roll back: %s", ErrSerializationFailure, s.id, s.doomed)
+	}
+	return nil
+}
+
+// forget drops s with its SIREAD locks and its dependencies; m.mu must be held.
+func (m *SSIManager) forget(s *sxact) {
+	for target := range s.locks {
+		delete(m.sireads[target], s.id)
+		if len(m.sireads[target]) == 0 {
+			delete(m.sireads, target)
+		}
+	}
+	for id := range s.in {
+		if other := m.txns[id]; other != nil {
+			delete(other.out, s.id)
+		}
+	}
+	for id := range s.out {
+		if other := m.txns[id]; other != nil {
+			delete(other.in, s.id)
+		}
+	}
+	delete(m.txns, s.id)
+}
+
+// cleanup drops the committed transactions no running serializable
+// transaction is concurrent with: every one of them sees their writes, so no
+// new dependency on them can appear; m.mu must be held.
+func (m *SSIManager) cleanup() {
+	for _, s := range m.txns {
+		if !s.committed {
+			continue
+		}
+		needed := false
+		for _, other := range m.txns {
+			if !other.committed && !other.snapshot.Sees(s.id) {
+				needed = true
+				break
+			}
+		}
+		if !needed {
+			m.forget(s)
+		}
+	}
+}
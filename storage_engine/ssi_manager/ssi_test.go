@@ -0,0 +1,394 @@
+package ssi
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	txn "DaemonDB/storage_engine/transaction_manager"
+)
+
+// The tests play histories of serializable transactions against one SSI
+// manager, with snapshots taken the way the transaction manager takes them,
+// and check which steps fail with ErrSerializationFailure.
+//
+// Run:
+//
+//	go test -race ./storage_engine/ssi_manager
+
+// history hands out transaction IDs 1, 2, ... in BEGIN order, each with the
+// snapshot of the transactions that finished before it began.
+type history struct {
+	m       *SSIManager
+	next    uint64
+	running map[uint64]bool
+}
+
+func newHistory() *history {
+	return &history{m: NewSSIManager(), next: 1, running: make(map[uint64]bool)}
+}
+
+func (h *history) begin() uint64 {
+	id := h.next
+	h.next++
+	snap := txn.Snapshot{Xmin: id, Xmax: id, Active: make(map[uint64]bool), Self: id}
+	for other := range h.running {
+		snap.Active[other] = true
+		if other < snap.Xmin {
+			snap.Xmin = other
+		}
+	}
+	h.running[id] = true
+	h.m.Register(&txn.Transaction{ID: id, Isolation: txn.Serializable, Snapshot: snap})
+	return id
+}
+
+// commit commits id, rolling it back when SSI refuses, as the engine does.
+func (h *history) commit(id uint64) error {
+	delete(h.running, id)
+	err := h.m.Commit(id)
+	if err != nil {
+		h.m.Release(id)
+	}
+	return err
+}
+
+func (h *history) rollback(id uint64) {
+	delete(h.running, id)
+	h.m.Release(id)
+}
+
+// step is one step of a history on table t.
+type step struct {
+	op    string // begin, read, write, readpast (read past a version of writer), commit, rollback
+	txn   uint64
+	row   string // the key read or written, "" for the whole table
+	other uint64 // readpast: the writer
+	fails bool   // the step must fail with ErrSerializationFailure
+}
+
+func (h *history) play(t *testing.T, steps []step) {
+	t.Helper()
+	for i, s := range steps {
+		var err error
+		switch s.op {
+		case "begin":
+			if id := h.begin(); id != s.txn {
+				t.Fatalf("step %d: began txn %d, history expects %d", i, id, s.txn)
+			}
+		case "read":
+			err = h.m.Read(s.txn, Target{Table: "t", Row: s.row})
+		case "write":
+			err = h.m.Write(s.txn, "t", s.row)
+		case "readpast":
+			err = h.m.ReadConflict(s.txn, s.other)
+		case "commit":
+			err = h.commit(s.txn)
+		case "rollback":
+			h.rollback(s.txn)
+		default:
+			t.Fatalf("step %d: unknown op %q", i, s.op)
+		}
+
+		what := fmt.Sprintf("step %d: txn %d %s %q", i, s.txn, s.op, s.row)
+		switch {
+		case s.fails && !errors.Is(err, ErrSerializationFailure):
+			t.Fatalf("%s: want a serialization failure, got %v", what, err)
+		case !s.fails && err != nil:
+			t.Fatalf("%s: %v", what, err)
+		}
+		if s.fails && s.op != "commit" {
+			h.rollback(s.txn)
+		}
+	}
+}
+
+func TestHistories(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			// each reads both rows and writes one: the second to commit is
+			// the pivot of 1 →rw 2 →rw 1, doomed by the first commit
+			name: "write skew",
+			steps: []step{
+				{op: "begin", txn: 1}, {op: "begin", txn: 2},
+				{op: "read", txn: 1, row: "a"}, {op: "read", txn: 1, row: "b"},
+				{op: "read", txn: 2, row: "a"}, {op: "read", txn: 2, row: "b"},
+				{op: "write", txn: 1, row: "a"},
+				{op: "write", txn: 2, row: "b"},
+				{op: "commit", txn: 1},
+				{op: "commit", txn: 2, fails: true},
+			},
+		},
+		{
+			name: "write skew over table scans",
+			steps: []step{
+				{op: "begin", txn: 1}, {op: "begin", txn: 2},
+				{op: "read", txn: 1}, {op: "read", txn: 2},
+				{op: "write", txn: 1, row: "a"},
+				{op: "write", txn: 2, row: "b"},
+				{op: "commit", txn: 2},
+				{op: "commit", txn: 1, fails: true},
+			},
+		},
+		{
+			name: "doomed transaction fails at its next read",
+			steps: []step{
+				{op: "begin", txn: 1}, {op: "begin", txn: 2},
+				{op: "read", txn: 1, row: "a"}, {op: "read", txn: 2, row: "b"},
+				{op: "write", txn: 1, row: "b"},
+				{op: "write", txn: 2, row: "a"},
+				{op: "commit", txn: 1},
+				{op: "read", txn: 2, row: "c", fails: true},
+			},
+		},
+		{
+			// a single rw-dependency is no structure: the reader is
+			// serialized before the writer
+			name: "read-only transaction overlapping a writer",
+			steps: []step{
+				{op: "begin", txn: 1}, {op: "begin", txn: 2},
+				{op: "read", txn: 1, row: "a"},
+				{op: "read", txn: 2, row: "a"},
+				{op: "write", txn: 2, row: "a"},
+				{op: "commit", txn: 2},
+				{op: "read", txn: 1, row: "b"},
+				{op: "readpast", txn: 1, other: 2},
+				{op: "commit", txn: 1},
+			},
+		},
+		{
+			name: "read-only transaction reading two committed writers",
+			steps: []step{
+				{op: "begin", txn: 1}, {op: "begin", txn: 2}, {op: "begin", txn: 3},
+				{op: "read", txn: 1},
+				{op: "write", txn: 2, row: "a"},
+				{op: "write", txn: 3, row: "b"},
+				{op: "commit", txn: 2}, {op: "commit", txn: 3},
+				{op: "commit", txn: 1},
+			},
+		},
+		{
+			name: "disjoint keys",
+			steps: []step{
+				{op: "begin", txn: 1}, {op: "begin", txn: 2},
+				{op: "read", txn: 1, row: "a"}, {op: "read", txn: 2, row: "b"},
+				{op: "write", txn: 1, row: "a"}, {op: "write", txn: 2, row: "b"},
+				{op: "commit", txn: 1}, {op: "commit", txn: 2},
+			},
+		},
+		{
+			name: "writer that began after the reader committed",
+			steps: []step{
+				{op: "begin", txn: 1},
+				{op: "read", txn: 1, row: "a"},
+				{op: "commit", txn: 1},
+				{op: "begin", txn: 2},
+				{op: "read", txn: 2, row: "b"},
+				{op: "write", txn: 2, row: "a"},
+				{op: "commit", txn: 2},
+			},
+		},
+		{
+			// 2 committed before its dependency in appeared, so 1, the
+			// T_in, is the one left to roll back
+			name: "committed pivot rolls back T_in",
+			steps: []step{
+				{op: "begin", txn: 1}, {op: "begin", txn: 2}, {op: "begin", txn: 3},
+				{op: "read", txn: 2, row: "x"},
+				{op: "write", txn: 3, row: "x"},
+				{op: "commit", txn: 3},
+				{op: "write", txn: 2, row: "y"},
+				{op: "commit", txn: 2},
+				{op: "readpast", txn: 1, other: 2, fails: true},
+			},
+		},
+		{
+			// 1 →rw 2 →rw 3 with 3 committed first: 2 can not commit
+			name: "pivot refused at commit",
+			steps: []step{
+				{op: "begin", txn: 1}, {op: "begin", txn: 2}, {op: "begin", txn: 3},
+				{op: "read", txn: 2, row: "x"},
+				{op: "write", txn: 3, row: "x"},
+				{op: "read", txn: 1, row: "y"},
+				{op: "write", txn: 2, row: "y"},
+				{op: "commit", txn: 3},
+				{op: "commit", txn: 2, fails: true},
+				{op: "commit", txn: 1},
+			},
+		},
+		{
+			name: "rolled back writer leaves no dependency",
+			steps: []step{
+				{op: "begin", txn: 1}, {op: "begin", txn: 2},
+				{op: "read", txn: 1, row: "a"}, {op: "read", txn: 2, row: "b"},
+				{op: "write", txn: 1, row: "b"},
+				{op: "rollback", txn: 1},
+				{op: "write", txn: 2, row: "a"},
+				{op: "commit", txn: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			newHistory().play(t, tt.steps)
+		})
+	}
+}
+
+// TestDependencies checks the rw-dependencies recorded from both sides, and
+// that a writer ignores readers its snapshot sees.
+func TestDependencies(t *testing.T) {
+	h := newHistory()
+	h.play(t, []step{
+		{op: "begin", txn: 1}, {op: "begin", txn: 2},
+		{op: "read", txn: 1, row: "a"},
+		{op: "commit", txn: 1}, // kept: 2 is concurrent with it
+		{op: "begin", txn: 3}, {op: "begin", txn: 4},
+		{op: "read", txn: 2, row: "a"},
+		{op: "write", txn: 3, row: "a"},    // 2 →rw 3 through the SIREAD lock of 2; 3 sees 1
+		{op: "readpast", txn: 4, other: 3}, // 4 →rw 3 from the reader's side
+		{op: "readpast", txn: 4, other: 3}, // recorded once
+	})
+
+	want := map[uint64]struct{ in, out []uint64 }{
+		1: {},
+		2: {out: []uint64{3}},
+		3: {in: []uint64{2, 4}},
+		4: {out: []uint64{3}},
+	}
+	for id, deps := range want {
+		s := h.m.txns[id]
+		if s == nil {
+			t.Fatalf("txn %d not tracked", id)
+		}
+		if !sameIDs(s.in, deps.in) || !sameIDs(s.out, deps.out) {
+			t.Errorf("txn %d: in %v out %v, want in %v out %v", id, s.in, s.out, deps.in, deps.out)
+		}
+	}
+}
+
+func sameIDs(got map[uint64]bool, want []uint64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for _, id := range want {
+		if !got[id] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCommittedFirst(t *testing.T) {
+	running := func(id uint64) *sxact { return &sxact{id: id} }
+	committed := func(id, seq uint64) *sxact { return &sxact{id: id, committed: true, commitSeq: seq} }
+	self := committed(1, 1)
+
+	tests := []struct {
+		name           string
+		out, in, pivot *sxact
+		want           bool
+	}{
+		{"out running", running(3), running(1), running(2), false},
+		{"out committed, others running", committed(3, 1), running(1), running(2), true},
+		{"T_in is T_out", self, self, running(2), true},
+		{"pivot committed before out", committed(3, 2), running(1), committed(2, 1), false},
+		{"pivot committed after out", committed(3, 1), running(1), committed(2, 2), true},
+		{"in committed before out", committed(3, 2), committed(1, 1), running(2), false},
+		{"in committed after out", committed(3, 1), committed(1, 2), running(2), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := committedFirst(tt.out, tt.in, tt.pivot); got != tt.want {
+				t.Errorf("committedFirst = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoom(t *testing.T) {
+	running := func(id uint64) *sxact { return &sxact{id: id} }
+	committed := func(id, seq uint64) *sxact { return &sxact{id: id, committed: true, commitSeq: seq} }
+
+	tests := []struct {
+		name           string
+		pivot, in, out *sxact
+		victim         uint64 // 0: none
+	}{
+		{"pivot running", running(2), running(1), committed(3, 1), 2},
+		{"pivot committed", committed(2, 2), running(1), committed(3, 1), 1},
+		{"all committed", committed(2, 2), committed(1, 3), committed(3, 1), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewSSIManager()
+			v := m.doom(tt.pivot, tt.in, tt.out)
+
+			if tt.victim == 0 {
+				if v.s != nil {
+					t.Fatalf("victim txn %d, want none", v.s.id)
+				}
+				if err := v.failIf(tt.pivot); err != nil {
+					t.Fatalf("failIf: %v", err)
+				}
+				return
+			}
+			if v.s == nil || v.s.id != tt.victim {
+				t.Fatalf("victim %+v, want txn %d", v.s, tt.victim)
+			}
+			if err := v.s.check(); !errors.Is(err, ErrSerializationFailure) {
+				t.Fatalf("victim check: %v", err)
+			}
+			// only the victim gets the error at once; any other one fails later
+			if err := v.failIf(v.s); !errors.Is(err, ErrSerializationFailure) {
+				t.Fatalf("failIf(victim): %v", err)
+			}
+			if err := v.failIf(tt.out); err != nil {
+				t.Fatalf("failIf(other): %v", err)
+			}
+		})
+	}
+}
+
+// TestSIREADCleanup checks that SIREAD locks outlive the commit of their
+// holder until the last transaction concurrent with it ends.
+func TestSIREADCleanup(t *testing.T) {
+	h := newHistory()
+	locks := func(want ...uint64) {
+		t.Helper()
+		var got []uint64
+		for _, l := range h.m.Locks() {
+			got = append(got, l.TxnID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("SIREAD locks held by %v, want %v", got, want)
+		}
+	}
+
+	h.play(t, []step{
+		{op: "begin", txn: 1}, {op: "begin", txn: 2},
+		{op: "read", txn: 1},
+		{op: "read", txn: 1, row: "a"}, // covered by the table lock
+		{op: "read", txn: 2, row: "a"},
+		{op: "commit", txn: 1},
+	})
+	locks(1, 2) // 2 is concurrent with 1
+
+	h.play(t, []step{
+		{op: "begin", txn: 3},
+		{op: "read", txn: 3, row: "b"},
+		{op: "commit", txn: 2},
+	})
+	locks(2, 3) // 3 sees 1 but not 2, which was running when it began
+
+	h.play(t, []step{{op: "rollback", txn: 3}})
+	locks()
+	if len(h.m.txns) != 0 || len(h.m.sireads) != 0 {
+		t.Fatalf("left tracked: %d transactions, %d targets", len(h.m.txns), len(h.m.sireads))
+	}
+}
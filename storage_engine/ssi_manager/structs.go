@@ -0,0 +1,43 @@
+package ssi
+
+import (
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"sync"
+)
+
+// Target is what a SIREAD lock covers: a table (Row empty), or one primary
+// key value of it, whether a row has that key or not. Keys are named like the
+// row locks of the lock manager.
+type Target struct {
+	Table string
+	Row   string
+}
+
+// LockInfo is one SIREAD lock, as shown by sys.locks.
+type LockInfo struct {
+	TxnID uint64
+	Table string
+	Row   string
+}
+
+// sxact is the state of one serializable transaction. It outlives the
+// commit until no transaction running concurrently with it is left.
+type sxact struct {
+	id       uint64
+	snapshot *txn.Snapshot
+
+	committed bool
+	commitSeq uint64 // order of the commits
+	doomed    string // the structure another transaction's check chose it to roll back for
+
+	in    map[uint64]bool // rw-dependencies in: who read what it wrote after
+	out   map[uint64]bool // rw-dependencies out: who wrote what it read after
+	locks map[Target]bool
+}
+
+type SSIManager struct {
+	mu        sync.Mutex
+	txns      map[uint64]*sxact
+	sireads   map[Target]map[uint64]bool // target → transactions holding it
+	commitSeq uint64
+}
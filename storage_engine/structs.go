@@ -8,9 +8,12 @@ import (
 	"DaemonDB/storage_engine/catalog"
 	checkpoint "DaemonDB/storage_engine/checkpoint_manager"
 	diskmanager "DaemonDB/storage_engine/disk_manager"
+	lock "DaemonDB/storage_engine/lock_manager"
+	ssi "DaemonDB/storage_engine/ssi_manager"
 	txn "DaemonDB/storage_engine/transaction_manager"
 	"DaemonDB/storage_engine/wal_manager"
 	"sync"
+	"time"
 )
 
 type StorageEngine struct {
@@ -22,6 +25,8 @@ type StorageEngine struct {
 	HeapManager       *heapfile.HeapFileManager
 	WalManager        *wal_manager.WALManager
 	TxnManager        *txn.TxnManager
+	LockManager       *lock.LockManager
+	SSIManager        *ssi.SSIManager
 	CheckpointManager *checkpoint.CheckpointManager
 
 	DbRoot          string
@@ -32,4 +37,31 @@ type StorageEngine struct {
 	// Cleared and closed when switching DB or on VM shutdown.
 	indexCacheMu    sync.RWMutex
 	tableIndexCache map[string]*bplus.BPlusTree
+
+	// Rows a hash join or a DISTINCT / set operation keeps in memory before
+	// it spills its partitions to disk (DAEMONDB_JOIN_MEMORY_ROWS).
+	joinMemoryRows int
+
+	// Fraction of the rows of a table that may change before its statistics
+	// are collected again (DAEMONDB_STATS_REFRESH_FRACTION).
+	statsRefreshFraction float64
+
+	// Iterations a WITH RECURSIVE query may run before it is assumed to
+	// cycle (DAEMONDB_MAX_RECURSION), and the work tables of the ones running.
+	maxRecursion int
+	workTables   map[string]*workTable
+
+	// How long a transaction waits for a lock before its statement fails
+	// (DAEMONDB_LOCK_TIMEOUT_MS).
+	lockTimeout time.Duration
+
+	// MVCC (mvcc.go): the row versions committed transactions left to
+	// prune, shared by every session
+	deadMu       sync.Mutex
+	deadVersions []deadVersion
+
+	// run the bodies of triggers, by transaction: each is set by the VM
+	// that began it (SetTriggerRunner), so a session's triggers run in it
+	triggerMu      sync.Mutex
+	triggerRunners map[uint64]TriggerRunner
 }
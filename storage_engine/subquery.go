@@ -0,0 +1,434 @@
+package storageengine
+
+import (
+	"fmt"
+	"strings"
+
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+)
+
+/*
+This file contains subquery planning and execution for SELECT (and the WHERE /
+SET expressions of UPDATE through BindSubqueries).
+
+Every subquery node is bound to a runner before the outer query is evaluated:
+
+	uncorrelated    → executed once, the result is cached on the node
+	correlated      → outer references are replaced by the outer row's values and
+	                  the subquery is executed once per distinct set of values
+
+Two common WHERE forms are decorrelated instead, when they are top-level
+conjuncts of the outer query:
+
+	x [NOT] IN (SELECT y FROM ...)                            (uncorrelated)
+	[NOT] EXISTS (SELECT ... WHERE inner_expr = outer.col AND ...)
+
+The conjunct is removed from WHERE, the inner query is executed once (without
+the correlation predicate, projecting only the join key) and the outer rows are
+filtered by a semi join (IN, EXISTS) or an anti join (NOT IN, NOT EXISTS)
+built on the merge join in joins.go.
+*/
+
+// semiJoinKey is the temporary row key holding the outer join key; '#' can not
+// appear in identifiers, so it never clashes with a column.
+const semiJoinKey = "#semi_key"
+
+type semiJoin struct {
+	outerKey *types.ExpressionNode // evaluated on every outer row
+	inner    types.SelectPayload   // projects the inner join key as its only column
+	anti     bool
+	notIn    bool // NOT IN: a NULL in the subquery result makes every row fail
+}
+
+// planSubqueries decorrelates the EXISTS / IN conjuncts of payload.WhereExpr
+// into semi joins and binds every other subquery to a runner.
+func (se *StorageEngine) planSubqueries(snap *txn.Snapshot, payload *types.SelectPayload) ([]semiJoin, error) {
+	joins := []semiJoin{}
+
+	if payload.WhereExpr != nil {
+		var residual *types.ExpressionNode
+		for _, conj := range splitConjuncts(payload.WhereExpr) {
+			sj, ok, err := se.decorrelate(conj)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				joins = append(joins, sj)
+				continue
+			}
+			if residual == nil {
+				residual = conj
+			} else {
+				residual = &types.ExpressionNode{Type: types.ExprLogical, Op: "AND", Left: residual, Right: conj}
+			}
+		}
+		payload.WhereExpr = residual
+	}
+
+	exprs := []*types.ExpressionNode{payload.WhereExpr}
+	for _, join := range payload.Joins {
+		exprs = append(exprs, join.On)
+	}
+	for _, proj := range payload.Projections {
+		exprs = append(exprs, proj.Expr)
+	}
+	for _, item := range payload.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+	for _, sj := range joins {
+		exprs = append(exprs, sj.outerKey)
+	}
+	for _, expr := range exprs {
+		if err := se.bindSubqueries(snap, expr); err != nil {
+			return nil, err
+		}
+	}
+	return joins, nil
+}
+
+// decorrelate turns one WHERE conjunct into a semi/anti join if it has one of
+// the supported shapes.
+func (se *StorageEngine) decorrelate(conj *types.ExpressionNode) (semiJoin, bool, error) {
+	if conj.Subquery == nil {
+		return semiJoin{}, false, nil
+	}
+	refs, err := se.outerRefs(conj.Subquery)
+	if err != nil {
+		return semiJoin{}, false, err
+	}
+
+	switch conj.Type {
+	case types.ExprIn:
+		if len(refs) > 0 {
+			return semiJoin{}, false, nil
+		}
+		return semiJoin{outerKey: conj.Left, inner: *conj.Subquery, anti: conj.Negate, notIn: conj.Negate}, true, nil
+
+	case types.ExprExists:
+		// exactly one outer reference, used in an "inner = outer" conjunct
+		if len(refs) != 1 {
+			return semiJoin{}, false, nil
+		}
+		inner := *conj.Subquery
+		var innerKey *types.ExpressionNode
+		var rest *types.ExpressionNode
+		for _, c := range splitConjuncts(inner.WhereExpr) {
+			if innerKey == nil && c.Type == types.ExprComparison && c.Op == "=" {
+				switch refs[0] {
+				case c.Left:
+					innerKey = c.Right
+					continue
+				case c.Right:
+					innerKey = c.Left
+					continue
+				}
+			}
+			if rest == nil {
+				rest = c
+			} else {
+				rest = &types.ExpressionNode{Type: types.ExprLogical, Op: "AND", Left: rest, Right: c}
+			}
+		}
+		if innerKey == nil {
+			return semiJoin{}, false, nil
+		}
+		inner.WhereExpr = rest
+		inner.Projections = []types.Projection{{Expr: innerKey, Name: semiJoinKey}}
+		inner.OrderBy = nil
+		outerKey := *refs[0]
+		return semiJoin{outerKey: &outerKey, inner: inner, anti: conj.Negate}, true, nil
+	}
+	return semiJoin{}, false, nil
+}
+
+// applySemiJoin executes the inner query once and keeps the outer rows that
+// have a match (semi join) or have none (anti join). plan is the operator that
+// produced rows; the semi join's own is returned.
+func (se *StorageEngine) applySemiJoin(snap *txn.Snapshot, rows []map[string]interface{}, plan *types.PlanNode, sj semiJoin) ([]map[string]interface{}, *types.PlanNode, error) {
+	m := se.startOp()
+
+	innerRows, innerCols, innerPlan, err := se.executeSelect(snap, sj.inner)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(innerCols) != 1 {
+		return nil, nil, fmt.Errorf("subquery must return only one column, got %d", len(innerCols))
+	}
+
+	if sj.notIn && len(innerRows) > 0 {
+		// x NOT IN (..., NULL) is never true, and NULL NOT IN (non-empty) is NULL
+		for _, r := range innerRows {
+			if r[innerCols[0]] == nil {
+				node := semiJoinNode(plan, innerPlan, sj)
+				se.finishOp(node, m, 0, plan)
+				return []map[string]interface{}{}, node, nil
+			}
+		}
+	}
+
+	outer := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		key, err := types.EvalExpression(sj.outerKey, row)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error evaluating WHERE: %w", err)
+		}
+		if key == nil && sj.notIn && len(innerRows) > 0 {
+			continue
+		}
+		row[semiJoinKey] = key
+		outer = append(outer, row)
+	}
+
+	outerKey, innerKey := []string{semiJoinKey}, innerCols[:1]
+	se.sortRowsByColumns(outer, outerKey)
+	se.sortRowsByColumns(innerRows, innerKey)
+	result := se.mergeSortSemiJoin(outer, innerRows, outerKey, innerKey, sj.anti)
+
+	for _, row := range outer {
+		delete(row, semiJoinKey)
+	}
+
+	node := semiJoinNode(plan, innerPlan, sj)
+	se.finishOp(node, m, len(result), plan)
+	return result, node, nil
+}
+
+// BindSubqueries attaches a runner to every subquery in expr. Uncorrelated
+// subqueries are executed at most once; correlated ones once per distinct
+// combination of outer values. They read with the snapshot of tx.
+func (se *StorageEngine) BindSubqueries(tx *txn.Transaction, expr *types.ExpressionNode) error {
+	return se.bindSubqueries(se.readSnapshot(tx), expr)
+}
+
+func (se *StorageEngine) bindSubqueries(snap *txn.Snapshot, expr *types.ExpressionNode) error {
+	if expr == nil {
+		return nil
+	}
+	for _, child := range expr.Children() {
+		if err := se.bindSubqueries(snap, child); err != nil {
+			return err
+		}
+	}
+	if expr.Subquery == nil {
+		return nil
+	}
+
+	sub := expr.Subquery
+	refs, err := se.outerRefs(sub)
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		rows    []map[string]interface{}
+		columns []string
+	}
+	cache := make(map[string]result)
+
+	expr.BindSubquery(func(outer map[string]interface{}) ([]map[string]interface{}, []string, error) {
+		values := make([]interface{}, len(refs))
+		for i, ref := range refs {
+			val, ok := types.LookupColumn(outer, ref.Column)
+			if !ok {
+				return nil, nil, fmt.Errorf("column %s not found", ref.Column)
+			}
+			values[i] = val
+		}
+		key := fmt.Sprintf("%#v", values)
+		if res, ok := cache[key]; ok {
+			return res.rows, res.columns, nil
+		}
+
+		// substitute the outer values in place for the duration of the run
+		saved := make([]types.ExpressionNode, len(refs))
+		for i, ref := range refs {
+			saved[i] = *ref
+			*ref = types.ExpressionNode{Type: types.ExprLiteral, Literal: values[i], DataType: types.TypeOfValue(values[i])}
+		}
+		rows, columns, _, err := se.executeSelect(snap, *sub)
+		for i, ref := range refs {
+			*ref = saved[i]
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		cache[key] = result{rows: rows, columns: columns}
+		return rows, columns, nil
+	})
+	return nil
+}
+
+// queryScope is the set of names a query's FROM clause makes visible.
+type queryScope struct {
+	tables  map[string]bool
+	columns map[string]bool
+}
+
+func (s queryScope) resolves(column string) bool {
+	name := strings.ToLower(column)
+	if dot := strings.LastIndex(name, "."); dot != -1 {
+		return s.tables[name[:dot]]
+	}
+	return s.columns[name]
+}
+
+func (se *StorageEngine) scopeOf(payload *types.SelectPayload) (queryScope, error) {
+	scope := queryScope{tables: map[string]bool{}, columns: map[string]bool{}}
+	addColumn := func(name string) {
+		name = strings.ToLower(name)
+		scope.columns[name] = true
+		if dot := strings.LastIndex(name, "."); dot != -1 {
+			scope.columns[name[dot+1:]] = true
+		}
+	}
+
+	for _, ref := range payload.TableRefs() {
+		cols, err := se.tableRefColumns(ref)
+		if err != nil {
+			return queryScope{}, err
+		}
+		scope.tables[strings.ToLower(ref.Name())] = true
+		for _, col := range cols {
+			addColumn(col)
+		}
+	}
+
+	// ORDER BY may name select-list aliases
+	for _, proj := range payload.Projections {
+		addColumn(proj.Name)
+	}
+	return scope, nil
+}
+
+// tableRefColumns returns the column names of one FROM item.
+func (se *StorageEngine) tableRefColumns(ref types.TableRef) ([]string, error) {
+	if ref.Subquery != nil {
+		return se.outputColumns(ref.Subquery)
+	}
+	schema, err := se.CatalogManager.GetTableSchema(ref.Table)
+	if err != nil {
+		return nil, fmt.Errorf("table '%s' not found: %w", ref.Table, err)
+	}
+	cols := make([]string, len(schema.Columns))
+	for i, col := range schema.Columns {
+		cols[i] = col.Name
+	}
+	return cols, nil
+}
+
+// outputColumns returns the names of the columns payload produces.
+func (se *StorageEngine) outputColumns(payload *types.SelectPayload) ([]string, error) {
+	if len(payload.OutputNames) > 0 {
+		return payload.OutputNames, nil
+	}
+	if payload.SetOp != nil {
+		return se.outputColumns(payload.SetOp.Left)
+	}
+	if len(payload.Projections) > 0 {
+		cols := make([]string, len(payload.Projections))
+		for i, proj := range payload.Projections {
+			cols[i] = proj.Name
+		}
+		return cols, nil
+	}
+
+	refs := payload.TableRefs()
+	if len(refs) == 1 {
+		return se.tableRefColumns(refs[0])
+	}
+	cols := []string{}
+	for _, ref := range refs {
+		refCols, err := se.tableRefColumns(ref)
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range refCols {
+			cols = append(cols, ref.Name()+"."+col)
+		}
+	}
+	return cols, nil
+}
+
+// outerRefs returns the column references inside payload (including nested
+// subqueries and derived tables) that none of the enclosed queries resolve,
+// i.e. the references to an enclosing query.
+func (se *StorageEngine) outerRefs(payload *types.SelectPayload) ([]*types.ExpressionNode, error) {
+	if payload.WorkTable != "" || payload.SystemTable != "" {
+		return nil, nil
+	}
+	// ORDER BY of a compound query only names its result columns
+	if payload.SetOp != nil {
+		left, err := se.outerRefs(payload.SetOp.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := se.outerRefs(payload.SetOp.Right)
+		if err != nil {
+			return nil, err
+		}
+		return append(left, right...), nil
+	}
+
+	scope, err := se.scopeOf(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []*types.ExpressionNode{}
+	for _, ref := range payload.TableRefs() {
+		if ref.Subquery == nil {
+			continue
+		}
+		inner, err := se.outerRefs(ref.Subquery)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, inner...)
+	}
+
+	var walk func(expr *types.ExpressionNode) error
+	walk = func(expr *types.ExpressionNode) error {
+		if expr == nil {
+			return nil
+		}
+		if expr.Type == types.ExprColumn && !scope.resolves(expr.Column) {
+			refs = append(refs, expr)
+		}
+		if expr.Subquery != nil {
+			inner, err := se.outerRefs(expr.Subquery)
+			if err != nil {
+				return err
+			}
+			for _, ref := range inner {
+				if !scope.resolves(ref.Column) {
+					refs = append(refs, ref)
+				}
+			}
+		}
+		for _, child := range expr.Children() {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	exprs := []*types.ExpressionNode{payload.WhereExpr}
+	for _, join := range payload.Joins {
+		exprs = append(exprs, join.On)
+	}
+	for _, proj := range payload.Projections {
+		exprs = append(exprs, proj.Expr)
+	}
+	for _, item := range payload.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+	for _, expr := range exprs {
+		if err := walk(expr); err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
@@ -0,0 +1,98 @@
+package storageengine
+
+import (
+	"DaemonDB/types"
+	"fmt"
+	"strings"
+)
+
+/*
+System tables are read-only views of the engine's state, named sys.<name> in
+FROM. The code generator turns such a FROM item into a derived table whose
+query has only SystemTable set; its rows are produced when it is read.
+
+	sys.locks   one row per granted or waiting lock of the lock manager, and
+	            per SIREAD lock of a serializable transaction (ssi.go)
+*/
+
+var systemTables = map[string][]types.ColumnDef{
+	"sys.locks": {
+		{Name: "txn_id", Type: types.TypeInt},
+		{Name: "table_name", Type: types.TypeVarchar},
+		{Name: "row_key", Type: types.TypeVarchar}, // empty for a table lock
+		{Name: "mode", Type: types.TypeVarchar},    // IS, IX, S, SIX, X or SIREAD
+		{Name: "granted", Type: types.TypeBool},    // false while waiting
+	},
+}
+
+// SystemTableColumns returns the columns of the system table called name.
+func SystemTableColumns(name string) ([]types.ColumnDef, error) {
+	cols, ok := systemTables[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("system table %s does not exist", name)
+	}
+	return cols, nil
+}
+
+// readSystemTable returns the current rows of the system table named by payload.
+func (se *StorageEngine) readSystemTable(payload types.SelectPayload) ([]map[string]interface{}, []string, *types.PlanNode, error) {
+	m := se.startOp()
+	cols, err := SystemTableColumns(payload.SystemTable)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	columns := make([]string, len(cols))
+	for i, col := range cols {
+		columns[i] = col.Name
+	}
+
+	var rows []map[string]interface{}
+	switch strings.ToLower(payload.SystemTable) {
+	case "sys.locks":
+		if se.LockManager == nil {
+			break
+		}
+		for _, l := range se.LockManager.Locks() {
+			rows = append(rows, map[string]interface{}{
+				"txn_id":     int(l.TxnID),
+				"table_name": l.Table,
+				"row_key":    l.Row,
+				"mode":       l.Mode.String(),
+				"granted":    l.Granted,
+			})
+		}
+		if se.SSIManager == nil {
+			break
+		}
+		for _, l := range se.SSIManager.Locks() {
+			rows = append(rows, map[string]interface{}{
+				"txn_id":     int(l.TxnID),
+				"table_name": l.Table,
+				"row_key":    l.Row,
+				"mode":       "SIREAD",
+				"granted":    true,
+			})
+		}
+	}
+
+	plan := systemTableNode(payload, float64(len(rows)))
+	se.finishOp(plan, m, len(rows))
+	return rows, columns, plan, nil
+}
+
+// planSystemTable plans reading the system table named by payload.
+func (se *StorageEngine) planSystemTable(payload types.SelectPayload) (*types.PlanNode, error) {
+	if _, err := SystemTableColumns(payload.SystemTable); err != nil {
+		return nil, err
+	}
+	return systemTableNode(payload, 10), nil
+}
+
+func systemTableNode(payload types.SelectPayload, n float64) *types.PlanNode {
+	return &types.PlanNode{
+		Operator: "System Table Scan",
+		Relation: payload.SystemTable,
+		EstRows:  n,
+		EstCost:  n * cpuTupleCost,
+	}
+}
@@ -0,0 +1,60 @@
+package txn
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Isolation levels decide which snapshot the statements of a transaction read
+with (snapshot.go) and what it takes for it to commit:
+
+	READ COMMITTED   — a new snapshot for every statement; a statement that
+	                   finds its row changed by a transaction that committed
+	                   meanwhile starts over with a new one
+	REPEATABLE READ  — one snapshot, taken at BEGIN (snapshot isolation); a
+	                   write to a row changed since fails (first updater wins)
+	SERIALIZABLE     — REPEATABLE READ, plus the rw-dependencies with other
+	                   serializable transactions are tracked (ssi_manager) and
+	                   a transaction that could make the outcome differ from
+	                   every serial order is rolled back
+
+READ UNCOMMITTED is accepted and runs as READ COMMITTED: no transaction ever
+reads rows that were not committed.
+*/
+
+type IsolationLevel uint8
+
+const (
+	ReadCommitted IsolationLevel = iota
+	RepeatableRead
+	Serializable
+)
+
+// DefaultIsolation is the level of a session that did not choose one.
+const DefaultIsolation = RepeatableRead
+
+func (l IsolationLevel) String() string {
+	switch l {
+	case ReadCommitted:
+		return "READ COMMITTED"
+	case RepeatableRead:
+		return "REPEATABLE READ"
+	case Serializable:
+		return "SERIALIZABLE"
+	}
+	return "UNKNOWN"
+}
+
+// ParseIsolationLevel returns the level called name (REPEATABLE READ ...).
+func ParseIsolationLevel(name string) (IsolationLevel, error) {
+	switch strings.ToUpper(strings.Join(strings.Fields(name), " ")) {
+	case "READ UNCOMMITTED", "READ COMMITTED":
+		return ReadCommitted, nil
+	case "REPEATABLE READ":
+		return RepeatableRead, nil
+	case "SERIALIZABLE":
+		return Serializable, nil
+	}
+	return 0, fmt.Errorf("unknown isolation level %q", name)
+}
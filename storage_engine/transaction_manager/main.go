@@ -1,38 +1,139 @@
 package txn
 
 import (
+	"encoding/json"
 	"fmt"
-	"sync/atomic"
+	"os"
+	"path/filepath"
 )
 
 /*
 Transaction manager manages the BEGIN, COMMIT, ABORT state of quries that are to be made Atomically
 (either all queries should run or none)
+
+It also hands out the snapshots of MVCC (snapshot.go): tuples are stamped with
+transaction IDs, so an ID must never be handed out twice, not even after a
+restart. The next ID is kept in metadata/next_txn_id.json, reserved a block
+(txnIDBlock) at a time so BEGIN rarely writes the file; a restart skips the
+rest of the block.
 */
 
-func NewTxnManager() (*TxnManager, error) {
-	return &TxnManager{
+const txnIDBlock = 1000
+
+// NewTxnManager starts at the transaction ID persisted in metaDir.
+func NewTxnManager(metaDir string) (*TxnManager, error) {
+	tm := &TxnManager{
 		nextID:     1,
 		activeTxns: make(map[uint64]*Transaction),
-	}, nil
+		idFile:     filepath.Join(metaDir, "next_txn_id.json"),
+	}
+
+	data, err := os.ReadFile(tm.idFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read transaction ID file: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &tm.nextID); err != nil {
+			return nil, fmt.Errorf("failed to parse transaction ID file: %w", err)
+		}
+	}
+	tm.reservedID = tm.nextID
+	return tm, nil
 }
 
-// Begin starts a new transaction and registers it as active.
-func (tm *TxnManager) Begin() *Transaction {
-	// Use atomic increment to safely issue txn IDs from multiple goroutines.
-	txnID := atomic.AddUint64(&tm.nextID, 1) - 1
+// Begin starts a new transaction at isolation level, registers it as active
+// and takes its snapshot: every transaction active now is invisible to it.
+func (tm *TxnManager) Begin(level IsolationLevel) (*Transaction, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.nextID >= tm.reservedID {
+		if err := tm.reserveIDs(tm.nextID + txnIDBlock); err != nil {
+			return nil, err
+		}
+	}
+	txnID := tm.nextID
+	tm.nextID++
 
 	txn := &Transaction{
 		ID:           txnID,
 		State:        TxnActive,
+		Isolation:    level,
+		Snapshot:     tm.snapshot(),
 		InsertedRows: make([]InsertedRow, 0),
 	}
+	txn.Snapshot.Self = txnID
+	txn.Snapshot.Xmax = txnID
 
-	tm.mu.Lock()
 	tm.activeTxns[txnID] = txn
-	tm.mu.Unlock()
 
-	return txn
+	return txn, nil
+}
+
+// Snapshot returns a snapshot of the committed state, for a statement that
+// runs outside a transaction.
+func (tm *TxnManager) Snapshot() *Snapshot {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	s := tm.snapshot()
+	return &s
+}
+
+// RefreshSnapshot gives t a new snapshot of the transactions committed by
+// now, for its next statement under READ COMMITTED.
+func (tm *TxnManager) RefreshSnapshot(t *Transaction) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	t.Snapshot = tm.snapshot()
+	t.Snapshot.Self = t.ID
+}
+
+// Horizon returns the oldest transaction ID some snapshot in use may not see:
+// a row version deleted by a committed transaction below it is invisible to
+// every transaction and can be removed.
+func (tm *TxnManager) Horizon() uint64 {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	horizon := tm.nextID
+	for _, t := range tm.activeTxns {
+		if t.Snapshot.Xmin < horizon {
+			horizon = t.Snapshot.Xmin
+		}
+	}
+	return horizon
+}
+
+// snapshot takes a snapshot of the active transactions; tm.mu must be held.
+func (tm *TxnManager) snapshot() Snapshot {
+	s := Snapshot{
+		Xmin:   tm.nextID,
+		Xmax:   tm.nextID,
+		Active: make(map[uint64]bool, len(tm.activeTxns)),
+	}
+	for id := range tm.activeTxns {
+		s.Active[id] = true
+		if id < s.Xmin {
+			s.Xmin = id
+		}
+	}
+	return s
+}
+
+// reserveIDs persists upTo as the next ID to use after a restart; tm.mu must be held.
+func (tm *TxnManager) reserveIDs(upTo uint64) error {
+	if err := os.MkdirAll(filepath.Dir(tm.idFile), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(upTo, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(tm.idFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to persist transaction IDs: %w", err)
+	}
+	tm.reservedID = upTo
+	return nil
 }
 
 // Commit marks a transaction as committed and removes it from the active set.
@@ -61,13 +162,8 @@ func (tm *TxnManager) Commit(txnID uint64) error {
 // Abort marks a transaction as aborted and removes it from the active set.
 // Called AFTER OpTxnAbort has been written to WAL and synced.
 //
-// In a full implementation, this would also roll back all writes:
-//   - Delete inserted rows from heap file
-//   - Remove inserted keys from indexes
-//   - Restore old versions for updated rows (MVCC)
-//
-// For now, rollback is implicit: during recovery, uncommitted ops are skipped
-// because their TxnID never appears in an OpTxnCommit record.
+// The writes are undone before (StorageEngine.AbortTransaction), so an
+// aborted transaction leaves no row versions for the snapshots to hide.
 func (tm *TxnManager) Abort(txnID uint64) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
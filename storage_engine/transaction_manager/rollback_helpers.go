@@ -1,31 +1,77 @@
 package txn
 
-import "DaemonDB/types"
+import (
+	"DaemonDB/types"
+	"strings"
+)
 
 /*
 Before the transaction gets completed, it is not sure whether it will actually be commited or not (rollbacked or aborted)
 
-the InsertedRows and UpdatedRows slices helps in keeping track of the changes made in case they might be rollbacked
+the InsertedRows, UpdatedRows and DeletedRows slices help in keeping track of the changes made in case they might be rollbacked
 
 */
 
 // RecordInsert adds a row to the transaction's InsertedRows list for rollback.
 // Called by StorageEngine.InsertRow after the row is written to the heap file.
-func (txn *Transaction) RecordInsert(table string, rowPtr types.RowPointer, primaryKey []byte) {
+func (txn *Transaction) RecordInsert(table string, rowPtr types.RowPointer, primaryKey []byte, record *types.Operation) {
 	txn.InsertedRows = append(txn.InsertedRows, InsertedRow{
 		Table:      table,
 		RowPtr:     rowPtr,
 		PrimaryKey: primaryKey,
+		Record:     record,
 	})
 }
 
-// RecordUpdate saves the old row state before an update for rollback.
-func (txn *Transaction) RecordUpdate(table string, oldPtr, newPtr types.RowPointer, oldRowData []byte, primaryKey []byte) {
+// RecordUpdate saves both versions of an updated row for rollback.
+func (txn *Transaction) RecordUpdate(table string, oldPtr, newPtr types.RowPointer, oldRowData []byte, primaryKey, newPrimaryKey []byte, record *types.Operation) {
 	txn.UpdatedRows = append(txn.UpdatedRows, UpdatedRow{
+		Table:         table,
+		OldRowPtr:     oldPtr,
+		NewRowPtr:     newPtr,
+		OldRowData:    oldRowData,
+		PrimaryKey:    primaryKey,
+		NewPrimaryKey: newPrimaryKey,
+		Record:        record,
+	})
+}
+
+// RecordDelete saves a row version the transaction deleted for rollback.
+func (txn *Transaction) RecordDelete(table string, rowPtr types.RowPointer, primaryKey []byte, record *types.Operation) {
+	txn.DeletedRows = append(txn.DeletedRows, DeletedRow{
 		Table:      table,
-		OldRowPtr:  oldPtr,
-		NewRowPtr:  newPtr,
-		OldRowData: oldRowData,
+		RowPtr:     rowPtr,
 		PrimaryKey: primaryKey,
+		Record:     record,
 	})
 }
+
+// Mark returns a savepoint for the current end of the undo lists; lsn is the
+// WAL position the rows written after it start at.
+func (txn *Transaction) Mark(name string, lsn uint64) Savepoint {
+	return Savepoint{
+		Name:     name,
+		LSN:      lsn,
+		Inserted: len(txn.InsertedRows),
+		Updated:  len(txn.UpdatedRows),
+		Deleted:  len(txn.DeletedRows),
+	}
+}
+
+// FindSavepoint returns the position in Savepoints of the most recent
+// savepoint called name, or -1. Names are case-insensitive.
+func (txn *Transaction) FindSavepoint(name string) int {
+	for i := len(txn.Savepoints) - 1; i >= 0; i-- {
+		if strings.EqualFold(txn.Savepoints[i].Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Truncate forgets the rows recorded after sp, once they have been undone.
+func (txn *Transaction) Truncate(sp Savepoint) {
+	txn.InsertedRows = txn.InsertedRows[:sp.Inserted]
+	txn.UpdatedRows = txn.UpdatedRows[:sp.Updated]
+	txn.DeletedRows = txn.DeletedRows[:sp.Deleted]
+}
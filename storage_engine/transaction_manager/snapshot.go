@@ -0,0 +1,44 @@
+package txn
+
+import "DaemonDB/types"
+
+/*
+Snapshot isolation: a snapshot says which transactions' writes a reader sees.
+
+	Xmax    — the next transaction ID when it was taken; IDs from it on
+	          started later and are never seen
+	Active  — the transactions running when it was taken, never seen either
+	Xmin    — the oldest of them (Xmax when none was running); every ID below
+	          it had finished
+	Self    — the transaction the snapshot belongs to, whose own writes are
+	          always seen (0 for a statement outside a transaction)
+
+A transaction gets its snapshot at BEGIN and keeps it to the end, so all its
+statements read the same database plus its own writes. A statement outside a
+transaction takes one of its own (TxnManager.Snapshot).
+
+A row version is visible when its creator (Xmin of the tuple) is seen and its
+deleter (Xmax of the tuple) is not. Aborted transactions leave no versions
+behind (their writes are undone), so "finished" means committed.
+*/
+
+type Snapshot struct {
+	Xmin   uint64
+	Xmax   uint64
+	Active map[uint64]bool
+	Self   uint64
+}
+
+// Sees reports whether the writes of transaction id are visible in s.
+// ID 0 (rows written outside a transaction) is always seen.
+func (s *Snapshot) Sees(id uint64) bool {
+	if id == s.Self {
+		return true
+	}
+	return id < s.Xmax && !s.Active[id]
+}
+
+// Visible reports whether the row version with header h is visible in s.
+func (s *Snapshot) Visible(h types.TupleHeader) bool {
+	return s.Sees(h.Xmin) && (h.Xmax == 0 || !s.Sees(h.Xmax))
+}
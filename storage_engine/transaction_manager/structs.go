@@ -14,30 +14,73 @@ const (
 )
 
 type Transaction struct {
-	ID    uint64
-	State TxnState
+	ID        uint64
+	State     TxnState
+	Isolation IsolationLevel
+
+	// LSN of its OpTxnBegin record, where recovery starts reading it when it
+	// was running at a checkpoint
+	BeginLSN uint64
+
+	// the transactions whose writes it sees, taken at BEGIN (at every
+	// statement under READ COMMITTED)
+	Snapshot Snapshot
 
 	// Logical UNDO support
 	InsertedRows []InsertedRow
 	UpdatedRows  []UpdatedRow
+	DeletedRows  []DeletedRow
+
+	// named savepoints, oldest first
+	Savepoints []Savepoint
+}
+
+// Savepoint marks a point in a transaction that it can be rolled back to:
+// the WAL position and the lengths of the undo lists when it was taken.
+// Rolling back to it undoes the rows recorded after those lengths, each
+// logged as a compensation record.
+type Savepoint struct {
+	Name     string
+	LSN      uint64
+	Inserted int
+	Updated  int
+	Deleted  int
 }
 
 type InsertedRow struct {
 	Table      string
 	RowPtr     types.RowPointer
 	PrimaryKey []byte
+	Record     *types.Operation // its WAL record, compensated by a rollback
 }
 
+// UpdatedRow is an update of a row: the old version was stamped with the
+// transaction's ID and the new one written next to it.
 type UpdatedRow struct {
+	Table         string
+	OldRowPtr     types.RowPointer // the version the update replaced
+	NewRowPtr     types.RowPointer // the version it wrote
+	OldRowData    []byte           // serialized old row
+	PrimaryKey    []byte           // key of the old version
+	NewPrimaryKey []byte           // key of the new version
+	Record        *types.Operation // its WAL record, compensated by a rollback
+}
+
+// DeletedRow is a row version the transaction stamped as deleted.
+type DeletedRow struct {
 	Table      string
-	OldRowPtr  types.RowPointer // location before update (may move on delete+reinsert)
-	NewRowPtr  types.RowPointer // location after update
-	OldRowData []byte           // serialized old row, used to restore on rollback
+	RowPtr     types.RowPointer
 	PrimaryKey []byte
+	Record     *types.Operation // its WAL record, compensated by a rollback
 }
 
 type TxnManager struct {
 	nextID     uint64
 	activeTxns map[uint64]*Transaction // all currently active transactions
 	mu         sync.RWMutex
+
+	// IDs are never reused, also across restarts: nextID is persisted in
+	// idFile ahead of use, a block at a time, up to reservedID
+	idFile     string
+	reservedID uint64
 }
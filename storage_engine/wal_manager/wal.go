@@ -137,7 +137,10 @@ func (w *WALManager) recoverWALEntries() error {
 		stat, _ := os.Stat(w.Segments[segmentID].FilePath)
 		totalSize += uint64(stat.Size())
 	}
-	w.CurrentLSN = totalSize
+	// LSNs are allocated from size estimates and run ahead of the file size:
+	// the next one must still be above every LSN already logged, or pages
+	// would carry LSNs from before the restart that new records fall under
+	w.CurrentLSN = max(totalSize, maxLSN+1)
 
 	// fmt.Printf("Recovered Successful: %+v current lsn: %d\n", w, w.CurrentLSN)
 
@@ -0,0 +1,629 @@
+package storageengine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"DaemonDB/types"
+)
+
+/*
+This file contains the window functions (ROW_NUMBER() OVER (...) and the
+others listed in types/window.go). They are computed after the WHERE filter
+and the semi joins, before the select list:
+
+	SELECT name, dept, RANK() OVER (PARTITION BY dept ORDER BY salary DESC)
+	FROM emp
+
+	extractWindows  the call is replaced by a column "#win0" in the select
+	                list and ORDER BY; calls with the same PARTITION BY and
+	                ORDER BY form one group, sorted once
+	computeWindow   sort a copy of the rows by partition keys, then ORDER BY
+	                keys, and put the value of every call in each row as #winN
+	projectAndSort  reads #win0 like any other column
+
+The rows keep their order, so the output is only sorted by the query's own
+ORDER BY.
+
+Within a partition, rows with equal ORDER BY keys are peers: they get the same
+RANK, and a RANGE frame treats them as one. Aggregates are computed on a running
+state that is extended as the frame grows and started over when it loses rows,
+so the usual frames (running totals, whole partition, n PRECEDING AND n
+FOLLOWING) cost one pass, or n × the frame width. Frames that end at UNBOUNDED
+FOLLOWING shrink from the front and are computed back to front instead.
+
+When there are more than joinMemoryRows rows and the window has PARTITION BY,
+the rows are hash partitioned to disk on the partition keys like the grace hash
+join does (spill.go), and dropped from memory as they are written. Every window
+partition is then in one file, and one file at a time is sorted and computed in
+memory; a file over the budget is partitioned again first. The computed rows go
+back to their input positions, so the operator's output is in memory like any
+other's. EXPLAIN ANALYZE shows the partitions and the most rows held at once on
+the WindowAgg node.
+
+Limits: a window partition is never split, so one with more rows than the
+budget is computed in memory as a whole. A window without PARTITION BY is one
+partition, so it never spills and is always computed in memory.
+*/
+
+// winPosKey is the temporary row key holding a row's input position while
+// the rows are spilled; '#' can not appear in identifiers.
+const winPosKey = "#win_pos"
+
+// windowCall is one window function call; its value is put in the rows
+// under key.
+type windowCall struct {
+	expr *types.ExpressionNode
+	key  string
+}
+
+// windowGroup is the calls with the same PARTITION BY and ORDER BY.
+type windowGroup struct {
+	spec  *types.WindowSpec
+	calls []windowCall
+}
+
+// extractWindows replaces the window function calls in the select list and
+// ORDER BY of payload by references to the columns computeWindow fills in.
+func extractWindows(payload types.SelectPayload) (types.SelectPayload, []*windowGroup) {
+	var groups []*windowGroup
+	keys := make(map[string]string)
+	bySpec := make(map[string]*windowGroup)
+
+	var rewrite func(expr *types.ExpressionNode) *types.ExpressionNode
+	rewrite = func(expr *types.ExpressionNode) *types.ExpressionNode {
+		if !types.ContainsWindow(expr) {
+			return expr
+		}
+		if expr.Type != types.ExprFunc || expr.Window == nil {
+			return expr.MapChildren(rewrite)
+		}
+
+		text := types.FormatExpression(expr)
+		key, ok := keys[text]
+		if !ok {
+			key = fmt.Sprintf("#win%d", len(keys))
+			keys[text] = key
+
+			sortKeys := (&types.WindowSpec{PartitionBy: expr.Window.PartitionBy, OrderBy: expr.Window.OrderBy}).String()
+			group := bySpec[sortKeys]
+			if group == nil {
+				group = &windowGroup{spec: expr.Window}
+				bySpec[sortKeys] = group
+				groups = append(groups, group)
+			}
+			group.calls = append(group.calls, windowCall{expr: expr, key: key})
+		}
+		return &types.ExpressionNode{Type: types.ExprColumn, Column: key}
+	}
+
+	projections := make([]types.Projection, len(payload.Projections))
+	for i, proj := range payload.Projections {
+		proj.Expr = rewrite(proj.Expr)
+		projections[i] = proj
+	}
+	orderBy := make([]types.OrderByItem, len(payload.OrderBy))
+	for i, item := range payload.OrderBy {
+		item.Expr = rewrite(item.Expr)
+		orderBy[i] = item
+	}
+	if len(groups) == 0 {
+		return payload, nil
+	}
+
+	payload.Projections, payload.OrderBy = projections, orderBy
+	return payload, groups
+}
+
+// computeWindow puts the value of every call of group into the rows.
+func (se *StorageEngine) computeWindow(rows []map[string]interface{}, group *windowGroup) (spillStats, error) {
+	spec := group.spec
+	partCols := make([]string, len(spec.PartitionBy))
+	for j := range partCols {
+		partCols[j] = fmt.Sprintf("#win_part%d", j)
+	}
+	orderCols := make([]string, len(spec.OrderBy))
+	for j := range orderCols {
+		orderCols[j] = fmt.Sprintf("#win_order%d", j)
+	}
+	defer func() {
+		for _, row := range rows {
+			for _, col := range append(partCols, orderCols...) {
+				delete(row, col)
+			}
+		}
+	}()
+
+	for _, row := range rows {
+		for j, expr := range spec.PartitionBy {
+			val, err := types.EvalExpression(expr, row)
+			if err != nil {
+				return spillStats{}, fmt.Errorf("error evaluating PARTITION BY: %w", err)
+			}
+			row[partCols[j]] = val
+		}
+		for j, item := range spec.OrderBy {
+			val, err := types.EvalExpression(item.Expr, row)
+			if err != nil {
+				return spillStats{}, fmt.Errorf("error evaluating window ORDER BY: %w", err)
+			}
+			row[orderCols[j]] = val
+		}
+	}
+
+	if len(rows) <= se.joinMemoryRows || len(partCols) == 0 {
+		return spillStats{}, windowKernel(rows, group, partCols, orderCols)
+	}
+	w := &windowSpiller{se: se, group: group, rows: rows, partCols: partCols, orderCols: orderCols}
+	err := w.run()
+	return w.stats, err
+}
+
+// windowSpiller is one window group that spills: the rows it computes, which
+// are put back in place as their partition is done.
+type windowSpiller struct {
+	se                  *StorageEngine
+	group               *windowGroup
+	rows                []map[string]interface{}
+	partCols, orderCols []string
+	stats               spillStats
+}
+
+// run hash partitions the rows to disk on the partition keys, dropping them
+// from w.rows, and computes one partition file at a time.
+func (w *windowSpiller) run() error {
+	d, err := w.se.newSpillDir("window")
+	if err != nil {
+		return err
+	}
+	defer d.remove()
+
+	n := w.se.spillPartitions(len(w.rows))
+	p, err := d.partitioner("window", w.partCols, n, 0)
+	if err != nil {
+		return err
+	}
+	pos := 0
+	err = releaseRows(w.rows, func(row map[string]interface{}) error {
+		row[winPosKey] = pos
+		pos++
+		return p.add(row)
+	})
+	if cerr := p.close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	w.stats.partitions = n
+	for i := 0; i < n; i++ {
+		if err := w.computePartition(d, p, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// computePartition runs windowKernel on partition i of p and puts its rows
+// back at their input positions. A partition over the budget is partitioned
+// again.
+func (w *windowSpiller) computePartition(d *spillDir, p *partitioner, i int) error {
+	if size := p.counts[i]; size > w.se.joinMemoryRows && p.level < maxSpillLevel {
+		n := w.se.spillPartitions(size)
+		sub, err := d.repartition(p, i, "window", n)
+		if err != nil {
+			return err
+		}
+		w.stats.partitions += n
+		for k := 0; k < n; k++ {
+			if err := w.computePartition(d, sub, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	part, err := readPartition(p.names[i], p.counts[i])
+	if err != nil {
+		return err
+	}
+	w.stats.hold(len(part))
+	if err := windowKernel(part, w.group, w.partCols, w.orderCols); err != nil {
+		return err
+	}
+	for _, row := range part {
+		pos := row[winPosKey].(int)
+		delete(row, winPosKey)
+		w.rows[pos] = row
+	}
+	return nil
+}
+
+// windowKernel computes group on rows in memory. The partition and ORDER BY
+// keys are already in the rows, under partCols and orderCols.
+func windowKernel(rows []map[string]interface{}, group *windowGroup, partCols, orderCols []string) error {
+	sorted := append([]map[string]interface{}{}, rows...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		for _, col := range partCols {
+			if cmp := types.CompareValues(sorted[a][col], sorted[b][col]); cmp != 0 {
+				return cmp < 0
+			}
+		}
+		for j, col := range orderCols {
+			cmp := types.CompareValues(sorted[a][col], sorted[b][col])
+			if cmp == 0 {
+				continue
+			}
+			if group.spec.OrderBy[j].Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+
+	for start := 0; start < len(sorted); {
+		key := hashKey(sorted[start], partCols)
+		end := start + 1
+		for end < len(sorted) && hashKey(sorted[end], partCols) == key {
+			end++
+		}
+		p := newWindowPartition(sorted[start:end], group.spec, orderCols)
+		for _, call := range group.calls {
+			if err := p.compute(call); err != nil {
+				return err
+			}
+		}
+		start = end
+	}
+	return nil
+}
+
+// windowPartition is the sorted rows of one partition and their peer groups.
+type windowPartition struct {
+	rows      []map[string]interface{}
+	orderCols []string
+	desc      bool  // the first ORDER BY key is descending
+	peerStart []int // first row of every row's peer group
+	peerEnd   []int // one past its last row
+	peerRank  []int // number of the peer group, from 1
+}
+
+func newWindowPartition(rows []map[string]interface{}, spec *types.WindowSpec, orderCols []string) *windowPartition {
+	n := len(rows)
+	p := &windowPartition{
+		rows:      rows,
+		orderCols: orderCols,
+		desc:      len(spec.OrderBy) > 0 && spec.OrderBy[0].Desc,
+		peerStart: make([]int, n),
+		peerEnd:   make([]int, n),
+		peerRank:  make([]int, n),
+	}
+
+	// without ORDER BY every row of the partition is a peer of the others
+	rank := 0
+	for i := 0; i < n; {
+		j := n
+		if len(orderCols) > 0 {
+			key := hashKey(rows[i], orderCols)
+			for j = i + 1; j < n && hashKey(rows[j], orderCols) == key; j++ {
+			}
+		}
+		rank++
+		for r := i; r < j; r++ {
+			p.peerStart[r], p.peerEnd[r], p.peerRank[r] = i, j, rank
+		}
+		i = j
+	}
+	return p
+}
+
+// compute puts the value of call into every row of the partition.
+func (p *windowPartition) compute(call windowCall) error {
+	name := strings.ToUpper(call.expr.Func)
+	args := call.expr.Args
+
+	switch name {
+	case "ROW_NUMBER":
+		for i, row := range p.rows {
+			row[call.key] = i + 1
+		}
+		return nil
+
+	case "RANK":
+		for i, row := range p.rows {
+			row[call.key] = p.peerStart[i] + 1
+		}
+		return nil
+
+	case "DENSE_RANK":
+		for i, row := range p.rows {
+			row[call.key] = p.peerRank[i]
+		}
+		return nil
+
+	case "LAG", "LEAD":
+		vals, err := p.evalArg(args[0])
+		if err != nil {
+			return err
+		}
+		for i, row := range p.rows {
+			offset := 1
+			if len(args) > 1 {
+				val, err := types.EvalExpression(args[1], row)
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				if val == nil {
+					row[call.key] = nil
+					continue
+				}
+				n, err := types.ToInt(val)
+				if err != nil {
+					return fmt.Errorf("%s: offset: %w", name, err)
+				}
+				offset = int(n)
+			}
+			target := i - offset
+			if name == "LEAD" {
+				target = i + offset
+			}
+
+			var val interface{}
+			switch {
+			case target >= 0 && target < len(p.rows):
+				val = vals[target]
+			case len(args) > 2:
+				if val, err = types.EvalExpression(args[2], row); err != nil {
+					return fmt.Errorf("%s: default: %w", name, err)
+				}
+			}
+			row[call.key] = val
+		}
+		return nil
+	}
+
+	// FIRST_VALUE, LAST_VALUE and the aggregates read the frame
+	var vals []interface{}
+	if len(args) > 0 {
+		var err error
+		if vals, err = p.evalArg(args[0]); err != nil {
+			return err
+		}
+	}
+	frame := call.expr.Window.Frame
+
+	order := make([]int, len(p.rows))
+	for i := range order {
+		order[i] = i
+	}
+	if frame != nil && frame.End.Kind == types.BoundUnboundedFollowing && frame.Start.Kind != types.BoundUnboundedPreceding {
+		// the frame only shrinks going forward, but grows going backward
+		for i := range order {
+			order[i] = len(order) - 1 - i
+		}
+	}
+
+	agg := &frameAggregate{fn: name, vals: vals}
+	for _, i := range order {
+		lo, hi := p.frame(i, frame)
+		switch name {
+		case "FIRST_VALUE":
+			p.rows[i][call.key] = nil
+			if lo < hi {
+				p.rows[i][call.key] = vals[lo]
+			}
+		case "LAST_VALUE":
+			p.rows[i][call.key] = nil
+			if lo < hi {
+				p.rows[i][call.key] = vals[hi-1]
+			}
+		default:
+			agg.cover(lo, hi)
+			p.rows[i][call.key] = agg.result()
+		}
+	}
+	return nil
+}
+
+// evalArg evaluates a function argument on every row of the partition.
+func (p *windowPartition) evalArg(expr *types.ExpressionNode) ([]interface{}, error) {
+	vals := make([]interface{}, len(p.rows))
+	for i, row := range p.rows {
+		val, err := types.EvalExpression(expr, row)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return vals, nil
+}
+
+// frame returns the rows [lo, hi) in the frame of row i.
+func (p *windowPartition) frame(i int, frame *types.WindowFrame) (lo, hi int) {
+	if frame == nil {
+		// RANGE BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW, which without
+		// ORDER BY is the whole partition
+		return 0, p.peerEnd[i]
+	}
+	lo = p.bound(i, frame.Mode, frame.Start, true)
+	hi = p.bound(i, frame.Mode, frame.End, false)
+	lo = max(0, min(lo, len(p.rows)))
+	hi = max(lo, min(hi, len(p.rows)))
+	return lo, hi
+}
+
+// bound returns the first row of the frame of row i (start) or one past its
+// last row.
+func (p *windowPartition) bound(i int, mode string, b types.FrameBound, start bool) int {
+	switch b.Kind {
+	case types.BoundUnboundedPreceding:
+		return 0
+	case types.BoundUnboundedFollowing:
+		return len(p.rows)
+	case types.BoundCurrentRow:
+		if mode == "ROWS" {
+			if start {
+				return i
+			}
+			return i + 1
+		}
+		if start {
+			return p.peerStart[i]
+		}
+		return p.peerEnd[i]
+	}
+
+	offset := b.Offset
+	if b.Kind == types.BoundPreceding {
+		offset = -offset
+	}
+	if mode == "ROWS" {
+		if start {
+			return i + int(offset)
+		}
+		return i + int(offset) + 1
+	}
+
+	// RANGE: rows whose ORDER BY value is within offset of the current row's.
+	// A NULL value has only its peers in range.
+	v, ok := numericValue(p.rows[i][p.orderCols[0]])
+	if !ok {
+		if start {
+			return p.peerStart[i]
+		}
+		return p.peerEnd[i]
+	}
+	if p.desc {
+		offset = -offset
+	}
+	target := v + offset
+	if start {
+		return sort.Search(len(p.rows), func(j int) bool { return !p.sortsBefore(j, target) })
+	}
+	return sort.Search(len(p.rows), func(j int) bool { return p.sortsAfter(j, target) })
+}
+
+// sortsBefore reports whether row j comes before the ORDER BY value target in
+// the partition's order. NULLs sort first ascending and last descending.
+func (p *windowPartition) sortsBefore(j int, target float64) bool {
+	v, ok := numericValue(p.rows[j][p.orderCols[0]])
+	if p.desc {
+		return ok && v > target
+	}
+	return !ok || v < target
+}
+
+// sortsAfter reports whether row j comes after target in the partition's order.
+func (p *windowPartition) sortsAfter(j int, target float64) bool {
+	v, ok := numericValue(p.rows[j][p.orderCols[0]])
+	if p.desc {
+		return !ok || v < target
+	}
+	return ok && v > target
+}
+
+// frameAggregate is the state of COUNT, SUM, AVG, MIN or MAX over the rows
+// [lo, hi) of a partition.
+type frameAggregate struct {
+	fn     string
+	vals   []interface{} // the argument on every row; nil for COUNT(*)
+	lo, hi int
+
+	count   int // rows, or non-NULL values
+	intSum  int
+	sum     float64
+	isFloat bool
+	best    interface{} // MIN / MAX
+}
+
+// cover moves the aggregate to the rows [lo, hi), adding rows when the frame
+// grew and starting over when it lost rows.
+func (a *frameAggregate) cover(lo, hi int) {
+	if lo > a.lo || hi < a.hi {
+		*a = frameAggregate{fn: a.fn, vals: a.vals, lo: lo, hi: lo}
+	}
+	for j := a.lo - 1; j >= lo; j-- {
+		a.add(j)
+	}
+	for j := a.hi; j < hi; j++ {
+		a.add(j)
+	}
+	a.lo, a.hi = lo, hi
+}
+
+func (a *frameAggregate) add(j int) {
+	if a.vals == nil {
+		a.count++
+		return
+	}
+	v := a.vals[j]
+	if v == nil {
+		return
+	}
+	a.count++
+
+	switch a.fn {
+	case "SUM", "AVG":
+		f, _ := numericValue(v)
+		a.sum += f
+		switch x := v.(type) {
+		case float32, float64:
+			a.isFloat = true
+		case int:
+			a.intSum += x
+		case int32:
+			a.intSum += int(x)
+		case int64:
+			a.intSum += int(x)
+		}
+	case "MIN":
+		if a.best == nil || types.CompareValues(v, a.best) < 0 {
+			a.best = v
+		}
+	case "MAX":
+		if a.best == nil || types.CompareValues(v, a.best) > 0 {
+			a.best = v
+		}
+	}
+}
+
+func (a *frameAggregate) result() interface{} {
+	switch a.fn {
+	case "COUNT":
+		return a.count
+	case "SUM":
+		if a.count == 0 {
+			return nil
+		}
+		if a.isFloat {
+			return a.sum
+		}
+		return a.intSum
+	case "AVG":
+		if a.count == 0 {
+			return nil
+		}
+		return a.sum / float64(a.count)
+	}
+	return a.best
+}
+
+// windowNode describes computing the calls of group on the rows of child.
+func (se *StorageEngine) windowNode(child *types.PlanNode, group *windowGroup) *types.PlanNode {
+	n := child.EstRows
+	cost := (n*math.Log2(n+1) + n*float64(len(group.calls))) * cpuTupleCost
+	if n > float64(se.joinMemoryRows) && len(group.spec.PartitionBy) > 0 {
+		cost *= 3 // write and read back every row
+	}
+	return &types.PlanNode{
+		Operator:  "WindowAgg",
+		Condition: (&types.WindowSpec{PartitionBy: group.spec.PartitionBy, OrderBy: group.spec.OrderBy}).String(),
+		EstRows:   n,
+		EstCost:   child.EstCost + cost,
+		Children:  []*types.PlanNode{child},
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	storageengine "DaemonDB/storage_engine"
 	"DaemonDB/storage_engine/bufferpool"
+	txnmgr "DaemonDB/storage_engine/transaction_manager"
 	"DaemonDB/types"
 	"fmt"
 	"math/rand"
@@ -102,7 +103,7 @@ func insertRows(b *testing.B, engine *storageengine.StorageEngine, n int) {
 	b.Helper()
 	const batchSize = 500
 	for start := 0; start < n; start += batchSize {
-		txn, err := engine.BeginTransaction()
+		txn, err := engine.BeginTransaction(txnmgr.DefaultIsolation)
 		if err != nil {
 			b.Fatalf("BeginTransaction: %v", err)
 		}
@@ -125,16 +126,15 @@ func insertRows(b *testing.B, engine *storageengine.StorageEngine, n int) {
 }
 
 func pkLookup(engine *storageengine.StorageEngine, id int) {
-	_, _, _ = engine.ExecuteSelect(types.SelectPayload{
-		Table:    "t",
-		Columns:  []string{"*"},
-		WhereCol: "id",
-		WhereVal: fmt.Sprintf("%d", id),
+	_, _, _ = engine.ExecuteSelect(nil, types.SelectPayload{
+		Table:     "t",
+		Columns:   []string{"*"},
+		WhereExpr: idEquals(id),
 	})
 }
 
 func fullScan(engine *storageengine.StorageEngine) {
-	_, _, _ = engine.ExecuteSelect(types.SelectPayload{
+	_, _, _ = engine.ExecuteSelect(nil, types.SelectPayload{
 		Table:   "t",
 		Columns: []string{"*"},
 	})
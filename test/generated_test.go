@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Generated column tests: the columns are computed on every write that
+// changes what they read, and can not be written themselves.
+//
+// Run:
+//
+//	go test -run Generated -v ./test
+
+func TestGeneratedColumns(t *testing.T) {
+	db := newCrashDB(t)
+	db.exec("CREATE TABLE g (id INT PRIMARY KEY, a INT, s INT GENERATED ALWAYS AS (a * 2) STORED, " +
+		"w INT GENERATED ALWAYS AS (a + id) VIRTUAL)")
+	db.exec("INSERT INTO g VALUES (1, 5)")
+	db.exec("INSERT INTO g VALUES (2, 6)")
+	all := "SELECT * FROM g ORDER BY id"
+	db.expectQuery(all, "1|5|10|6", "2|6|12|8")
+
+	for _, tt := range []struct{ sql, want string }{
+		{"INSERT INTO g VALUES (3, 7, 14, 10)", "column s is a generated column and cannot be written (leave it out of VALUES)"},
+		{"UPDATE g SET s = 0 WHERE id = 1", "column s is a generated column and cannot be written"},
+		{"UPDATE g SET a = 0, w = 0", "column w is a generated column and cannot be written"},
+		{"INSERT INTO g VALUES (1, 9) ON CONFLICT (id) DO UPDATE SET s = EXCLUDED.s", "column s is a generated column and cannot be written"},
+		{"CREATE TABLE bad (id INT PRIMARY KEY, a INT GENERATED ALWAYS AS (id), b INT GENERATED ALWAYS AS (a))", "cannot refer to generated column a"},
+		{"CREATE TABLE bad (id INT PRIMARY KEY, a INT GENERATED ALWAYS AS ((SELECT id FROM g)))", "subqueries are not allowed"},
+	} {
+		if err := db.tryExec(tt.sql); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.sql, err, tt.want)
+		}
+	}
+	db.expectQuery(all, "1|5|10|6", "2|6|12|8")
+
+	// both kinds follow the columns they read
+	db.exec("UPDATE g SET a = 7 WHERE id = 1")
+	db.exec("INSERT INTO g VALUES (2, 1) ON CONFLICT (id) DO UPDATE SET a = g.a + EXCLUDED.a")
+	db.expectQuery(all, "1|7|14|8", "2|7|14|9")
+	db.expectQuery("SELECT id FROM g WHERE s = 14 AND w > 8", "2")
+
+	db.crash(false)
+	db.expectQuery(all, "1|7|14|8", "2|7|14|9")
+}
+
+// A generated primary key is computed before the row is indexed, and looked
+// up like any other key.
+func TestGeneratedPrimaryKey(t *testing.T) {
+	db := newCrashDB(t)
+	db.exec("CREATE TABLE k (a INT, id INT GENERATED ALWAYS AS (a * 10) STORED PRIMARY KEY)")
+	db.exec("INSERT INTO k VALUES (1)")
+	db.exec("INSERT INTO k VALUES (2)")
+	if err := db.tryExec("INSERT INTO k VALUES (1)"); err == nil {
+		t.Fatal("duplicate generated key inserted")
+	}
+	db.exec("UPDATE k SET a = 3 WHERE id = 20")
+	db.expectQuery("SELECT a, id FROM k ORDER BY id", "1|10", "3|30")
+	db.expectQuery("SELECT a FROM k WHERE id = 30", "3")
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// INT range tests: an INT is stored in 4 bytes, and a value that does not
+// fit is an error wherever it is made, never a wrapped number.
+//
+// Run:
+//
+//	go test -run IntRange -v ./test
+
+func TestIntRange(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+	db.exec("INSERT INTO t VALUES (4, 2147483647)")
+	db.exec("INSERT INTO t VALUES (5, -2147483648)")
+	db.expectQuery("SELECT v FROM t WHERE id >= 4 ORDER BY id", "2147483647", "-2147483648")
+	db.expectQuery("SELECT CAST(2147483647.9 AS INT), CAST(\"-2147483648\" AS INT) FROM t WHERE id = 1", "2147483647|-2147483648")
+
+	for _, sql := range []string{
+		"INSERT INTO t VALUES (6, 3000000000)",
+		"INSERT INTO t VALUES (6, 2147483647 + 1)",
+		"INSERT INTO t VALUES (3000000000, 1)",
+		"UPDATE t SET v = v + 1 WHERE id = 4",
+		"UPDATE t SET v = v * 2 WHERE id = 5",
+		"UPDATE t SET v = v / -1 WHERE id = 5",
+		"INSERT INTO t VALUES (4, 1) ON CONFLICT (id) DO UPDATE SET v = t.v + EXCLUDED.v",
+		"SELECT 9223372036854775807 FROM t",
+		"SELECT CAST(3000000000.5 AS INT) FROM t",
+		"SELECT CAST(\"3000000000\" AS INT) FROM t",
+	} {
+		if err := db.tryExec(sql); err == nil || !strings.Contains(err.Error(), "integer out of range") {
+			t.Errorf("%s: got %v, want integer out of range", sql, err)
+		}
+	}
+	db.expect([]string{"1=10", "2=20", "3=30", "4=2147483647", "5=-2147483648"})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Join order tests: once every table of a query has statistics the joins
+// run in the cheapest order, and return the rows the written order does.
+//
+// Run:
+//
+//	go test -run JoinOrder -v ./test
+
+// firstScan returns the table of the first scan of plan: the item the joins
+// start from.
+func firstScan(plan string) string {
+	for _, line := range strings.Split(plan, "\n") {
+		if _, table, ok := strings.Cut(line, "Seq Scan on "); ok {
+			return strings.Fields(table)[0]
+		}
+	}
+	return ""
+}
+
+func TestJoinOrder(t *testing.T) {
+	db := newCrashDB(t)
+	joinTables(db)
+	db.exec("CREATE TABLE c (id INT PRIMARY KEY, a_id INT, b_id INT)")
+	db.exec("BEGIN")
+	for i := 1; i <= 4; i++ {
+		db.exec(fmt.Sprintf("INSERT INTO c VALUES (%d, %d, %d)", i, i, 2*i))
+	}
+	db.exec("COMMIT")
+
+	// written order: a and b have no predicate between them
+	sql := "SELECT c.id, a.x, b.y FROM a, b, c WHERE a.id = c.a_id AND b.id = c.b_id ORDER BY c.id"
+	want := []string{"1|10|17", "2|20|37", "3|30|57", "4|40|77"}
+
+	check := func(state string, reordered bool) {
+		t.Helper()
+		plan := db.plan(sql)
+		if got := firstScan(plan); reordered != (got == "c") {
+			t.Errorf("%s: joins start from %s:\n%s", state, got, plan)
+		}
+		if reordered == strings.Contains(plan, "Block Nested Loop Join") {
+			t.Errorf("%s: cartesian product of a and b is %v:\n%s", state, !reordered, plan)
+		}
+		db.expectQuery(sql, want...)
+	}
+
+	check("no statistics", false)
+	db.exec("ANALYZE a")
+	db.exec("ANALYZE b")
+	check("c without statistics", false)
+	db.exec("ANALYZE c")
+	check("every table analyzed", true)
+
+	// an outer join keeps the written order
+	outer := "SELECT a.id, c.id, b.y FROM a LEFT JOIN c ON a.id = c.a_id LEFT JOIN b ON b.id = c.b_id WHERE a.id <= 5 ORDER BY a.id"
+	if plan := db.plan(outer); firstScan(plan) != "a" {
+		t.Errorf("outer join reordered:\n%s", plan)
+	}
+	db.expectQuery(outer, "1|1|17", "2|2|37", "3|3|57", "4|4|77", "5|NULL|NULL")
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Join tests: each join algorithm returns the same rows, and EXPLAIN shows
+// the one that ran.
+//
+// Run:
+//
+//	go test -run Join -v ./test
+
+// joinTables creates a (id, x = 10·id) and b (id, a_id, y = 10·id - 3), 20
+// rows each. Rows 1-16 of b reference rows 1-8 of a, two each; rows 17-20
+// reference no row.
+func joinTables(db *crashDB) {
+	db.exec("CREATE TABLE a (id INT PRIMARY KEY, x INT)")
+	db.exec("CREATE TABLE b (id INT PRIMARY KEY, a_id INT, y INT)")
+	db.exec("BEGIN")
+	for i := 1; i <= 20; i++ {
+		aID := (i + 1) / 2
+		if i > 16 {
+			aID = 100 + i
+		}
+		db.exec(fmt.Sprintf("INSERT INTO a VALUES (%d, %d)", i, 10*i))
+		db.exec(fmt.Sprintf("INSERT INTO b VALUES (%d, %d, %d)", i, aID, 10*i-3))
+	}
+	db.exec("COMMIT")
+}
+
+// plan returns what EXPLAIN prints for sql.
+func (db *crashDB) plan(sql string) string {
+	db.t.Helper()
+	return strings.Join(db.query("EXPLAIN "+sql), "\n")
+}
+
+// joinCase is a join query, the operator EXPLAIN must show for it and the
+// rows it returns.
+type joinCase struct {
+	name, sql, operator string
+	want                []string
+}
+
+func (db *crashDB) checkJoins(tests []joinCase) {
+	for _, tt := range tests {
+		db.t.Run(tt.name, func(t *testing.T) {
+			if plan := db.plan(tt.sql); !strings.Contains(plan, tt.operator) {
+				t.Fatalf("plan has no %s:\n%s", tt.operator, plan)
+			}
+			if got := db.query(tt.sql); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Fatalf("%s:\n got %q\nwant %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinAlgorithms(t *testing.T) {
+	db := newCrashDB(t)
+	joinTables(db)
+
+	var matched, leftPadded []string
+	for i := 1; i <= 20; i++ {
+		if i <= 16 {
+			matched = append(matched, fmt.Sprintf("%d|%d", i, 10*((i+1)/2)))
+			leftPadded = append(leftPadded, fmt.Sprintf("%d|%d", i, 10*((i+1)/2)))
+		} else {
+			leftPadded = append(leftPadded, fmt.Sprintf("%d|NULL", i))
+		}
+	}
+	var diagonal []string
+	for i := 1; i <= 20; i++ {
+		diagonal = append(diagonal, fmt.Sprintf("%d|%d", i, i))
+	}
+
+	db.checkJoins([]joinCase{
+		{
+			name:     "hash",
+			sql:      "SELECT b.id, a.x FROM a JOIN b ON a.id = b.a_id ORDER BY b.id",
+			operator: "Hash Join",
+			want:     matched,
+		},
+		{
+			name:     "hash left",
+			sql:      "SELECT b.id, a.x FROM b LEFT JOIN a ON b.a_id = a.id ORDER BY b.id",
+			operator: "Hash Left Join",
+			want:     leftPadded,
+		},
+		{
+			// one left row probes the primary key of a
+			name:     "index nested-loop",
+			sql:      "SELECT b.id, a.x FROM b JOIN a ON b.a_id = a.id WHERE b.id = 3",
+			operator: "Index Nested Loop Join",
+			want:     []string{"3|20"},
+		},
+		{
+			name:     "index nested-loop left",
+			sql:      "SELECT b.id, a.x FROM b LEFT JOIN a ON b.a_id = a.id WHERE b.id = 17",
+			operator: "Index Nested Loop Left Join",
+			want:     []string{"17|NULL"},
+		},
+		{
+			name:     "block nested-loop band join",
+			sql:      "SELECT a.id, b.id FROM a JOIN b ON a.x BETWEEN b.y AND b.y + 5 ORDER BY a.id",
+			operator: "Block Nested Loop Join",
+			want:     diagonal,
+		},
+		{
+			name:     "block nested-loop cross join",
+			sql:      "SELECT a.id, b.id FROM a CROSS JOIN b WHERE a.id <= 2 AND b.id <= 2 ORDER BY a.id, b.id",
+			operator: "Block Nested Loop Join",
+			want:     []string{"1|1", "1|2", "2|1", "2|2"},
+		},
+	})
+}
+
+// With a join memory of 4 rows the hash join spills to partitions and the
+// nested-loop join runs in blocks; the rows stay the same.
+func TestJoinAlgorithmsSpilled(t *testing.T) {
+	t.Setenv("DAEMONDB_JOIN_MEMORY_ROWS", "4")
+	db := newCrashDB(t)
+	joinTables(db)
+
+	var matched, diagonal []string
+	for i := 1; i <= 20; i++ {
+		if i <= 16 {
+			matched = append(matched, fmt.Sprintf("%d|%d", i, 10*((i+1)/2)))
+		}
+		diagonal = append(diagonal, fmt.Sprintf("%d|%d", i, i))
+	}
+
+	db.checkJoins([]joinCase{
+		{
+			name:     "grace hash",
+			sql:      "SELECT b.id, a.x FROM a JOIN b ON a.id = b.a_id ORDER BY b.id",
+			operator: "Hash Join",
+			want:     matched,
+		},
+		{
+			name:     "block nested-loop",
+			sql:      "SELECT a.id, b.id FROM a JOIN b ON a.x BETWEEN b.y AND b.y + 5 ORDER BY a.id",
+			operator: "Block Nested Loop Join",
+			want:     diagonal,
+		},
+	})
+
+	analyzed := strings.Join(db.query("EXPLAIN ANALYZE SELECT b.id, a.x FROM a JOIN b ON a.id = b.a_id"), "\n")
+	partitions, peak := spillActuals(t, analyzed, "Hash Join")
+	if partitions == 0 {
+		t.Fatalf("the hash join did not spill:\n%s", analyzed)
+	}
+	if peak > 4 {
+		t.Fatalf("the hash join held %d rows at once, more than the 4 it may:\n%s", peak, analyzed)
+	}
+}
+
+// spillActuals returns the partitions and peak_rows EXPLAIN ANALYZE reports
+// for the first node named operator, 0 and 0 if it did not spill.
+func spillActuals(t *testing.T, analyzed, operator string) (partitions, peak int) {
+	t.Helper()
+	for _, line := range strings.Split(analyzed, "\n") {
+		if !strings.Contains(line, operator+" ") {
+			continue
+		}
+		if i := strings.Index(line, "partitions="); i >= 0 {
+			if _, err := fmt.Sscanf(line[i:], "partitions=%d peak_rows=%d", &partitions, &peak); err != nil {
+				t.Fatalf("bad spill actuals in %q: %v", line, err)
+			}
+		}
+		return partitions, peak
+	}
+	t.Fatalf("no %s node in:\n%s", operator, analyzed)
+	return 0, 0
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	lock "DaemonDB/storage_engine/lock_manager"
+	txn "DaemonDB/storage_engine/transaction_manager"
+	"DaemonDB/types"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// MVCC tests with concurrent sessions: every session is a VM of its own on
+// the same engine, run from its own goroutine, as the sessions of a server
+// would be.
+//
+// Run:
+//
+//	go test -race -run MVCC -v ./test
+
+// snapshotRows returns the rows of table t as "id=v", sorted, as the
+// snapshot of tx sees them (nil: a statement outside a transaction).
+func snapshotRows(db *crashDB, tx *txn.Transaction) ([]string, error) {
+	rows, _, err := db.engine.ExecuteSelect(tx, types.SelectPayload{Table: "t", Columns: []string{"*"}})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, fmt.Sprintf("%v=%v", row["id"], row["v"]))
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Two sessions move value between their own pair of rows, one transaction per
+// move, while a transaction reads the table over and over: it must see the
+// same rows every time, and a statement outside a transaction must never see
+// half a move.
+func TestMVCCConcurrentSessions(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+	db.exec("INSERT INTO t VALUES (4, 40)")
+
+	const moves = 15
+	done := make(chan error, 2)
+	for _, pair := range [][2]int{{1, 2}, {3, 4}} {
+		vm := db.session()
+		from, to := pair[0], pair[1]
+		go func() {
+			for i := 0; i < moves; i++ {
+				for _, sql := range []string{
+					"BEGIN",
+					fmt.Sprintf("UPDATE t SET v = v - 1 WHERE id = %d", from),
+					fmt.Sprintf("UPDATE t SET v = v + 1 WHERE id = %d", to),
+					"COMMIT",
+				} {
+					if err := db.tryExecOn(vm, sql); err != nil {
+						done <- fmt.Errorf("%s: %w", sql, err)
+						return
+					}
+				}
+			}
+			done <- nil
+		}()
+	}
+
+	reader, err := db.engine.BeginTransaction(txn.RepeatableRead)
+	if err != nil {
+		t.Fatalf("BEGIN: %v", err)
+	}
+	first, err := snapshotRows(db, reader)
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+
+	for running := 2; running > 0; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			running--
+		default:
+		}
+
+		got, err := snapshotRows(db, reader)
+		if err != nil {
+			t.Fatalf("select in transaction: %v", err)
+		}
+		if strings.Join(got, " ") != strings.Join(first, " ") {
+			t.Fatalf("transaction snapshot changed: got %v, first read %v", got, first)
+		}
+
+		committed, err := snapshotRows(db, nil)
+		if err != nil {
+			t.Fatalf("select: %v", err)
+		}
+		sum := 0
+		for _, row := range committed {
+			var id, v int
+			fmt.Sscanf(row, "%d=%d", &id, &v)
+			sum += v
+		}
+		if len(committed) != 4 || sum != 100 {
+			t.Fatalf("statement saw a move half done: %v", committed)
+		}
+	}
+
+	if err := db.engine.CommitTransaction(reader.ID); err != nil {
+		t.Fatalf("COMMIT: %v", err)
+	}
+	db.expect([]string{
+		fmt.Sprintf("1=%d", 10-moves), fmt.Sprintf("2=%d", 20+moves),
+		fmt.Sprintf("3=%d", 30-moves), fmt.Sprintf("4=%d", 40+moves),
+	})
+}
+
+// DAEMONDB_LOCK_TIMEOUT_MS bounds how long a session waits for a row another
+// one has locked; the statement fails and the row keeps the first change.
+func TestMVCCLockTimeoutSetting(t *testing.T) {
+	t.Setenv("DAEMONDB_LOCK_TIMEOUT_MS", "100")
+	db := newCrashDB(t)
+	seed(db)
+	db.exec("BEGIN")
+	db.exec("UPDATE t SET v = 11 WHERE id = 1")
+
+	other := db.session()
+	start := time.Now()
+	err := db.tryExecOn(other, "UPDATE t SET v = 12 WHERE id = 1")
+	waited := time.Since(start)
+	if !errors.Is(err, lock.ErrLockTimeout) {
+		t.Fatalf("got %v, want a lock timeout", err)
+	}
+	if waited < 100*time.Millisecond || waited > 2*time.Second {
+		t.Fatalf("waited %v for a timeout of 100ms", waited)
+	}
+
+	db.exec("COMMIT")
+	db.expect([]string{"1=11"}, 1)
+	if err := db.tryExecOn(other, "UPDATE t SET v = 12 WHERE id = 1"); err != nil {
+		t.Fatalf("update after the commit: %v", err)
+	}
+	db.expect([]string{"1=12"}, 1)
+}
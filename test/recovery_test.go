@@ -0,0 +1,341 @@
+package main
+
+import (
+	executor "DaemonDB/query_executor"
+	codegen "DaemonDB/query_parser/code-generator"
+	lex "DaemonDB/query_parser/lexer"
+	parser "DaemonDB/query_parser/parser"
+	storageengine "DaemonDB/storage_engine"
+	"DaemonDB/storage_engine/bufferpool"
+	"DaemonDB/types"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Crash recovery tests.
+//
+// A crash is simulated by dropping the engine without closing it: the dirty
+// pages still in its buffer pool and the WAL records not yet synced are lost,
+// as they would be if the process died. A new engine is then opened on the
+// same root and recovers when the database is used.
+//
+// Each test crashes twice over: once with the pages flushed before the crash
+// (redo finds its changes on the pages and must skip them) and once with only
+// the WAL on disk (redo must apply again what the transaction still running
+// wrote; a commit flushes the pages it wrote itself).
+//
+// Run:
+//
+//	go test -run Recovery -v ./test
+
+type crashDB struct {
+	t      *testing.T
+	root   string
+	engine *storageengine.StorageEngine
+	vm     *executor.VM
+}
+
+func newCrashDB(t *testing.T) *crashDB {
+	t.Helper()
+	bufferpool.SilenceLogs = true
+
+	root := fmt.Sprintf("./_crash_%s", strings.ReplaceAll(t.Name(), "/", "_"))
+	_ = os.RemoveAll(root)
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+
+	db := &crashDB{t: t, root: root}
+	db.open()
+	db.exec("CREATE DATABASE d")
+	db.exec("USE d")
+	return db
+}
+
+// open starts an engine on the root, without using a database yet.
+func (db *crashDB) open() {
+	db.t.Helper()
+	engine, err := storageengine.NewStorageEngine(db.root)
+	if err != nil {
+		db.t.Fatalf("NewStorageEngine: %v", err)
+	}
+	db.engine = engine
+	db.vm = db.session()
+}
+
+// session returns a new VM on the engine, as a new client connection would
+// get, able to run trigger bodies.
+func (db *crashDB) session() *executor.VM {
+	vm := executor.NewVM(db.engine)
+	vm.SetCompiler(db.compile)
+	return vm
+}
+
+// compile parses and compiles sql; in the body of a trigger, with NEW / OLD
+// bound to the rows new and old, like main does.
+func (db *crashDB) compile(sql string, old, new map[string]interface{}) ([]executor.Instruction, error) {
+	p := parser.New(lex.New(sql))
+	p.SetViews(db.engine.LookupView)
+	if old != nil || new != nil {
+		p.SetTriggerRow(old, new)
+	}
+	stmt, err := p.ParseStatement()
+	if err != nil {
+		return nil, err
+	}
+	return codegen.EmitBytecode(stmt)
+}
+
+func (db *crashDB) exec(sql string) {
+	db.t.Helper()
+	if err := db.tryExec(sql); err != nil {
+		db.t.Fatalf("%s: %v", sql, err)
+	}
+}
+
+func (db *crashDB) tryExec(sql string) error {
+	return db.tryExecOn(db.vm, sql)
+}
+
+// tryExecOn runs sql in the session of vm, a VM on the same engine.
+func (db *crashDB) tryExecOn(vm *executor.VM, sql string) error {
+	instructions, err := db.compile(sql, nil, nil)
+	if err != nil {
+		return err
+	}
+	return vm.Execute(instructions)
+}
+
+// query runs sql on the session and returns the rows it printed, in order,
+// each as its values joined by "|".
+func (db *crashDB) query(sql string) []string {
+	db.t.Helper()
+	got, err := db.tryQueryOn(db.vm, sql)
+	if err != nil {
+		db.t.Fatalf("%s: %v", sql, err)
+	}
+	return got
+}
+
+// tryQueryOn runs sql in the session of vm and returns the rows it printed.
+func (db *crashDB) tryQueryOn(vm *executor.VM, sql string) ([]string, error) {
+	got := []string{}
+	vm.SetResultHandler(func(_ []string, rows [][]string) {
+		for _, row := range rows {
+			got = append(got, strings.Join(row, "|"))
+		}
+	})
+	defer vm.SetResultHandler(nil)
+	err := db.tryExecOn(vm, sql)
+	return got, err
+}
+
+// expectQuery fails unless sql returns want, in order.
+func (db *crashDB) expectQuery(sql string, want ...string) {
+	db.t.Helper()
+	if got := db.query(sql); strings.Join(got, " ") != strings.Join(want, " ") {
+		db.t.Fatalf("%s:\n got %q\nwant %q", sql, got, want)
+	}
+}
+
+// crash drops the engine after syncing the WAL and, with flush, the pages,
+// then opens a new one and recovers.
+func (db *crashDB) crash(flush bool) {
+	db.t.Helper()
+	if err := db.engine.WalManager.Sync(); err != nil {
+		db.t.Fatalf("WAL sync: %v", err)
+	}
+	if flush {
+		if err := db.engine.BufferPool.FlushAllPages(); err != nil {
+			db.t.Fatalf("FlushAllPages: %v", err)
+		}
+	}
+	db.open()
+	db.exec("USE d")
+}
+
+// idEquals is the predicate id = id.
+func idEquals(id int) *types.ExpressionNode {
+	return &types.ExpressionNode{
+		Type:  types.ExprComparison,
+		Op:    "=",
+		Left:  &types.ExpressionNode{Type: types.ExprColumn, Column: "id"},
+		Right: &types.ExpressionNode{Type: types.ExprLiteral, Literal: id, DataType: "INT"},
+	}
+}
+
+// rows returns the visible rows of table t as "id=v", sorted, looked up by
+// primary key when id is given.
+func (db *crashDB) rows(id ...int) []string {
+	db.t.Helper()
+	payload := types.SelectPayload{Table: "t", Columns: []string{"*"}}
+	if len(id) > 0 {
+		payload.WhereExpr = idEquals(id[0])
+	}
+	rows, _, err := db.engine.ExecuteSelect(nil, payload)
+	if err != nil {
+		db.t.Fatalf("select: %v", err)
+	}
+	out := make([]string, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, fmt.Sprintf("%v=%v", row["id"], row["v"]))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (db *crashDB) expect(want []string, id ...int) {
+	db.t.Helper()
+	if got := db.rows(id...); strings.Join(got, " ") != strings.Join(want, " ") {
+		db.t.Fatalf("rows %v: got %v, want %v", id, got, want)
+	}
+}
+
+func bothCrashes(t *testing.T, run func(t *testing.T, flush bool)) {
+	t.Run("pages-flushed", func(t *testing.T) { run(t, true) })
+	t.Run("wal-only", func(t *testing.T) { run(t, false) })
+}
+
+func seed(db *crashDB) {
+	db.exec("CREATE TABLE t ( id INT PRIMARY KEY, v INT )")
+	db.exec("INSERT INTO t VALUES (1, 10)")
+	db.exec("INSERT INTO t VALUES (2, 20)")
+	db.exec("INSERT INTO t VALUES (3, 30)")
+}
+
+// An uncommitted transaction is undone: updates (one changing the key),
+// a delete and the reinsert of the deleted key.
+func TestRecoveryUndoesUncommitted(t *testing.T) {
+	bothCrashes(t, func(t *testing.T, flush bool) {
+		db := newCrashDB(t)
+		seed(db)
+		db.exec("BEGIN")
+		db.exec("UPDATE t SET v = 11 WHERE id = 1")
+		db.exec("UPDATE t SET id = 5 WHERE id = 2")
+		db.exec("DELETE FROM t WHERE id = 3")
+		db.exec("INSERT INTO t VALUES (3, 33)")
+
+		db.crash(flush)
+		db.expect([]string{"1=10", "2=20", "3=30"})
+		db.expect([]string{"2=20"}, 2)
+		db.expect([]string{}, 5)
+		db.expect([]string{"3=30"}, 3)
+
+		// the recovered rows take new writes
+		db.exec("UPDATE t SET v = 12 WHERE id = 1")
+		db.expect([]string{"1=12", "2=20", "3=30"})
+	})
+}
+
+// A committed transaction is redone whole, and a later crash does not redo
+// or undo anything twice.
+func TestRecoveryRedoesCommitted(t *testing.T) {
+	bothCrashes(t, func(t *testing.T, flush bool) {
+		db := newCrashDB(t)
+		seed(db)
+		db.exec("BEGIN")
+		db.exec("UPDATE t SET v = 11 WHERE id = 1")
+		db.exec("UPDATE t SET id = 5 WHERE id = 2")
+		db.exec("DELETE FROM t WHERE id = 3")
+		db.exec("INSERT INTO t VALUES (4, 40)")
+		db.exec("COMMIT")
+
+		want := []string{"1=11", "4=40", "5=20"}
+		db.crash(flush)
+		db.expect(want)
+		db.crash(flush)
+		db.expect(want)
+		db.expect([]string{"5=20"}, 5)
+		db.expect([]string{}, 2)
+	})
+}
+
+// A rollback to a savepoint leaves the log as a crash in the middle of a
+// rollback would: some records compensated, the rest not. Recovery redoes
+// the compensation records and undoes only the rest.
+func TestRecoveryAfterPartialRollback(t *testing.T) {
+	bothCrashes(t, func(t *testing.T, flush bool) {
+		db := newCrashDB(t)
+		seed(db)
+		db.exec("BEGIN")
+		db.exec("INSERT INTO t VALUES (4, 40)")
+		db.exec("SAVEPOINT s")
+		db.exec("UPDATE t SET v = 11 WHERE id = 1")
+		db.exec("DELETE FROM t WHERE id = 2")
+		db.exec("ROLLBACK TO SAVEPOINT s")
+		db.exec("UPDATE t SET v = 31 WHERE id = 3")
+
+		db.crash(flush)
+		db.expect([]string{"1=10", "2=20", "3=30"})
+		db.crash(flush)
+		db.expect([]string{"1=10", "2=20", "3=30"})
+	})
+}
+
+// A transaction rolled back before the crash stays rolled back, and one
+// committed after a rollback to a savepoint keeps only what it kept.
+func TestRecoveryKeepsRollbacks(t *testing.T) {
+	bothCrashes(t, func(t *testing.T, flush bool) {
+		db := newCrashDB(t)
+		seed(db)
+		db.exec("BEGIN")
+		db.exec("UPDATE t SET v = 11 WHERE id = 1")
+		db.exec("DELETE FROM t WHERE id = 2")
+		db.exec("ROLLBACK")
+
+		db.exec("BEGIN")
+		db.exec("INSERT INTO t VALUES (4, 40)")
+		db.exec("SAVEPOINT s")
+		db.exec("UPDATE t SET id = 6 WHERE id = 3")
+		db.exec("ROLLBACK TO SAVEPOINT s")
+		db.exec("COMMIT")
+
+		db.crash(flush)
+		db.expect([]string{"1=10", "2=20", "3=30", "4=40"})
+		db.expect([]string{}, 6)
+	})
+}
+
+// The before-images logged by UPDATE and DELETE bring back every row an
+// uncommitted transaction changed, whatever WHERE clause picked the rows:
+// updates through a range and an expression, then deletes of rows it had
+// updated and of rows it had not.
+func TestRecoveryRestoresBeforeImages(t *testing.T) {
+	bothCrashes(t, func(t *testing.T, flush bool) {
+		db := newCrashDB(t)
+		seed(db)
+		db.exec("INSERT INTO t VALUES (4, 40)")
+		db.exec("BEGIN")
+		db.exec("UPDATE t SET v = v + 100 WHERE v > 15")
+		db.exec("DELETE FROM t WHERE v > 125 AND id < 4")
+		db.exec("DELETE FROM t WHERE id = 1")
+
+		db.crash(flush)
+		db.expect([]string{"1=10", "2=20", "3=30", "4=40"})
+		db.expect([]string{"3=30"}, 3)
+		db.crash(flush)
+		db.expect([]string{"1=10", "2=20", "3=30", "4=40"})
+	})
+}
+
+// The versions a commit prunes are removed again by redo, and the rows they
+// belonged to read the same as before the crash.
+func TestRecoveryRedoesPrunes(t *testing.T) {
+	bothCrashes(t, func(t *testing.T, flush bool) {
+		db := newCrashDB(t)
+		seed(db)
+		db.exec("BEGIN")
+		db.exec("UPDATE t SET v = 11 WHERE id = 1")
+		db.exec("UPDATE t SET id = 5 WHERE id = 2")
+		db.exec("DELETE FROM t WHERE id = 3")
+		db.exec("COMMIT")
+
+		db.crash(flush)
+		db.expect([]string{"1=11", "5=20"})
+		db.expect([]string{}, 2)
+		db.expect([]string{}, 3)
+		db.exec("INSERT INTO t VALUES (3, 33)")
+		db.expect([]string{"1=11", "3=33", "5=20"})
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+// RETURNING tests: the rows INSERT, UPDATE, DELETE and the two ON CONFLICT
+// actions return.
+//
+// Run:
+//
+//	go test -run Returning -v ./test
+
+func TestReturning(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+
+	tests := []struct {
+		name, sql string
+		want      []string
+	}{
+		{"INSERT", "INSERT INTO t VALUES (4, 40) RETURNING *", []string{"4|40"}},
+		{"expressions", "INSERT INTO t VALUES (5, 50) RETURNING v * 2 AS double, id", []string{"100|5"}},
+		{"UPDATE returns the new values", "UPDATE t SET v = v + 1 WHERE id <= 2 RETURNING id, v", []string{"1|11", "2|21"}},
+		{"UPDATE of no rows", "UPDATE t SET v = 0 WHERE id > 100 RETURNING id", nil},
+		{"DELETE returns the old values", "DELETE FROM t WHERE id = 3 RETURNING v", []string{"30"}},
+		{"DO UPDATE returns the updated row", "INSERT INTO t VALUES (1, 5) ON CONFLICT (id) DO UPDATE SET v = t.v + EXCLUDED.v RETURNING *", []string{"1|16"}},
+		{"DO UPDATE without a conflict", "INSERT INTO t VALUES (6, 60) ON CONFLICT (id) DO UPDATE SET v = 0 RETURNING *", []string{"6|60"}},
+		{"DO UPDATE whose WHERE does not hold", "INSERT INTO t VALUES (2, 0) ON CONFLICT (id) DO UPDATE SET v = 0 WHERE t.v > 100 RETURNING *", nil},
+		{"DO NOTHING returns nothing", "INSERT INTO t VALUES (2, 0) ON CONFLICT DO NOTHING RETURNING *", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db.expectQuery(tt.sql, tt.want...)
+		})
+	}
+	db.expect([]string{"1=16", "2=21", "4=40", "5=50", "6=60"})
+
+	// the list is checked before any row is written
+	if got, err := db.tryQueryOn(db.vm, "INSERT INTO t VALUES (7, 70) RETURNING w"); err == nil || len(got) > 0 {
+		t.Fatalf("RETURNING of no such column: got %v, %v", got, err)
+	}
+	if got, err := db.tryQueryOn(db.vm, "DELETE FROM t WHERE id = 1 RETURNING 1 / (v - 16)"); err == nil || len(got) > 0 {
+		t.Fatalf("RETURNING that fails: got %v, %v", got, err)
+	}
+	db.expect([]string{"1=16", "2=21", "4=40", "5=50", "6=60"})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Rewrite tests: constant folding, outer to inner joins and predicate
+// pushdown change the plan, never the rows.
+//
+// Run:
+//
+//	go test -run Rewrite -v ./test
+
+func TestRewrites(t *testing.T) {
+	db := newCrashDB(t)
+	joinTables(db)
+
+	tests := []struct {
+		name, sql string
+		want      []string
+		plan      []string // in the plan
+		notPlan   []string // not in the plan
+	}{
+		{
+			name:    "constant folding",
+			sql:     "SELECT id FROM a WHERE x > 2 * 80 ORDER BY id",
+			want:    []string{"17", "18", "19", "20"},
+			plan:    []string{"Filter: x > 160"},
+			notPlan: []string{"2 * 80"},
+		},
+		{
+			name:    "WHERE folding to TRUE disappears",
+			sql:     "SELECT id FROM a WHERE 1 = 1 AND id < 3 ORDER BY id",
+			want:    []string{"1", "2"},
+			notPlan: []string{"1 = 1"},
+		},
+		{
+			// a.x > 50 can not hold on a row padded with NULLs
+			name:    "outer join to inner join",
+			sql:     "SELECT b.id, a.x FROM b LEFT JOIN a ON b.a_id = a.id WHERE a.x > 50 ORDER BY b.id",
+			want:    []string{"11|60", "12|60", "13|70", "14|70", "15|80", "16|80"},
+			plan:    []string{"Hash Join"},
+			notPlan: []string{"Left Join"},
+		},
+		{
+			// b.id = 20 holds on a row padded with NULLs
+			name: "OR with the preserved side keeps the outer join",
+			sql:  "SELECT b.id, a.x FROM b LEFT JOIN a ON b.a_id = a.id WHERE a.x > 70 OR b.id = 20 ORDER BY b.id",
+			want: []string{"15|80", "16|80", "20|NULL"},
+			plan: []string{"Left Join"},
+		},
+		{
+			// the ON conjunct filters a while it is read, b keeps every row
+			name: "ON conjunct on the padded side",
+			sql:  "SELECT b.id, a.x FROM b LEFT JOIN a ON b.a_id = a.id AND a.x > 70 WHERE b.id >= 14 ORDER BY b.id",
+			want: []string{"14|NULL", "15|80", "16|80", "17|NULL", "18|NULL", "19|NULL", "20|NULL"},
+			plan: []string{"Filter: a.x > 70"},
+		},
+		{
+			name: "ON conjunct on the preserved side",
+			sql:  "SELECT b.id, a.x FROM b LEFT JOIN a ON b.a_id = a.id AND b.id = 2 WHERE b.id <= 3 ORDER BY b.id",
+			want: []string{"1|NULL", "2|10", "3|NULL"},
+		},
+		{
+			name:    "WHERE equality makes an equi-join",
+			sql:     "SELECT a.id, b.id FROM a, b WHERE a.id = b.a_id AND a.id = 2 ORDER BY b.id",
+			want:    []string{"2|3", "2|4"},
+			plan:    []string{"Join Cond: a.id = b.a_id"},
+			notPlan: []string{"Block Nested Loop"},
+		},
+		{
+			// each conjunct filters its own table below the join
+			name: "predicate pushdown",
+			sql:  "SELECT a.id, b.id FROM a JOIN b ON a.id = b.a_id WHERE a.x >= 70 AND b.y < 150 ORDER BY b.id",
+			want: []string{"7|13", "7|14", "8|15"},
+			plan: []string{"Seq Scan on a", "Filter: a.x >= 70", "Seq Scan on b", "Filter: b.y < 150"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := db.plan(tt.sql)
+			for _, s := range tt.plan {
+				if !strings.Contains(plan, s) {
+					t.Errorf("plan has no %q:\n%s", s, plan)
+				}
+			}
+			for _, s := range tt.notPlan {
+				if strings.Contains(plan, s) {
+					t.Errorf("plan has %q:\n%s", s, plan)
+				}
+			}
+			db.expectQuery(tt.sql, tt.want...)
+		})
+	}
+}
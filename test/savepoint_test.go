@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Savepoint tests: what a transaction sees after ROLLBACK TO and RELEASE, and
+// what it commits. Recovery of the same is in recovery_test.go.
+//
+// Run:
+//
+//	go test -run Savepoint -v ./test
+
+func TestSavepoints(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+	all := "SELECT id, v FROM t ORDER BY id"
+	missing := func(sql, name string) {
+		t.Helper()
+		if err := db.tryExec(sql); err == nil || !strings.Contains(err.Error(), "savepoint '"+name+"' does not exist") {
+			t.Fatalf("%s: got %v", sql, err)
+		}
+	}
+
+	db.exec("BEGIN")
+	db.exec("UPDATE t SET v = 11 WHERE id = 1")
+	db.exec("SAVEPOINT a")
+	db.exec("INSERT INTO t VALUES (4, 40)")
+	db.exec("UPDATE t SET v = 21 WHERE id = 2")
+	db.exec("DELETE FROM t WHERE id = 3")
+	db.exec("SAVEPOINT b")
+	db.exec("INSERT INTO t VALUES (5, 50)")
+
+	// back to b: only the insert after it is undone
+	db.exec("ROLLBACK TO SAVEPOINT b")
+	db.expectQuery(all, "1|11", "2|21", "4|40")
+
+	// back to a: the insert, update and delete are undone, the update before
+	// a is kept; a stays and b is gone
+	db.exec("ROLLBACK TO SAVEPOINT a")
+	db.expectQuery(all, "1|11", "2|20", "3|30")
+	db.exec("INSERT INTO t VALUES (6, 60)")
+	db.exec("ROLLBACK TO a")
+	db.expectQuery(all, "1|11", "2|20", "3|30")
+	missing("ROLLBACK TO SAVEPOINT b", "b")
+
+	// RELEASE keeps the writes and forgets the savepoint
+	db.exec("SAVEPOINT c")
+	db.exec("INSERT INTO t VALUES (7, 70)")
+	db.exec("RELEASE SAVEPOINT c")
+	missing("ROLLBACK TO SAVEPOINT c", "c")
+	db.expectQuery(all, "1|11", "2|20", "3|30", "7|70")
+
+	// a name used twice is the most recent savepoint
+	db.exec("SAVEPOINT d")
+	db.exec("INSERT INTO t VALUES (8, 80)")
+	db.exec("SAVEPOINT d")
+	db.exec("INSERT INTO t VALUES (9, 90)")
+	db.exec("ROLLBACK TO SAVEPOINT d")
+	db.expectQuery(all, "1|11", "2|20", "3|30", "7|70", "8|80")
+
+	// a statement failing half way is undone on its own (row 1 is updated
+	// before row 2 divides by zero) and the transaction goes on
+	if err := db.tryExec("UPDATE t SET v = 100 / (v - 20)"); err == nil {
+		t.Fatal("division by zero did not fail the update")
+	}
+	db.expectQuery(all, "1|11", "2|20", "3|30", "7|70", "8|80")
+
+	// other sessions see nothing before the commit
+	db.expect([]string{"1=10", "2=20", "3=30"})
+	db.exec("COMMIT")
+	db.expect([]string{"1=11", "2=20", "3=30", "7=70", "8=80"})
+
+	// ROLLBACK undoes the whole transaction whatever its savepoints
+	db.exec("BEGIN")
+	db.exec("INSERT INTO t VALUES (10, 100)")
+	db.exec("SAVEPOINT e")
+	db.exec("INSERT INTO t VALUES (11, 110)")
+	db.exec("RELEASE SAVEPOINT e")
+	db.exec("ROLLBACK")
+	db.expect([]string{"1=11", "2=20", "3=30", "7=70", "8=80"})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Set operation tests: with a memory of 4 rows, DISTINCT and the set
+// operations spill to partitions, return the rows they return in memory, in
+// the same order, and report the spill on their own EXPLAIN ANALYZE node.
+//
+// Run:
+//
+//	go test -run SetOps -v ./test
+
+func TestSetOpsSpilled(t *testing.T) {
+	t.Setenv("DAEMONDB_JOIN_MEMORY_ROWS", "4")
+	db := newCrashDB(t)
+	joinTables(db)
+
+	var referenced, unreferenced []string
+	for i := 1; i <= 8; i++ {
+		referenced = append(referenced, fmt.Sprint(i))
+	}
+	for i := 9; i <= 20; i++ {
+		unreferenced = append(unreferenced, fmt.Sprint(i))
+	}
+	orphans := []string{"117", "118", "119", "120"}
+
+	tests := []struct {
+		name, sql, operator string
+		want                []string
+	}{
+		{
+			name:     "distinct",
+			sql:      "SELECT DISTINCT a_id FROM b",
+			operator: "Distinct",
+			want:     append(append([]string{}, referenced...), orphans...),
+		},
+		{
+			name:     "union",
+			sql:      "SELECT a_id FROM b UNION SELECT id FROM a",
+			operator: "Union",
+			want:     append(append(append([]string{}, referenced...), orphans...), unreferenced...),
+		},
+		{
+			name:     "intersect all",
+			sql:      "SELECT a_id FROM b INTERSECT ALL SELECT id FROM a",
+			operator: "Intersect All",
+			want:     referenced,
+		},
+		{
+			name:     "except",
+			sql:      "SELECT id FROM a EXCEPT SELECT a_id FROM b",
+			operator: "Except",
+			want:     unreferenced,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := db.query(tt.sql); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Fatalf("%s:\n got %q\nwant %q", tt.sql, got, tt.want)
+			}
+			analyzed := strings.Join(db.query("EXPLAIN ANALYZE "+tt.sql), "\n")
+			partitions, peak := spillActuals(t, analyzed, tt.operator)
+			if partitions == 0 {
+				t.Fatalf("%s did not spill:\n%s", tt.operator, analyzed)
+			}
+			if peak > 4 {
+				t.Fatalf("%s held %d rows at once, more than the 4 it may:\n%s", tt.operator, peak, analyzed)
+			}
+		})
+	}
+}
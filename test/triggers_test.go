@@ -0,0 +1,119 @@
+package main
+
+import (
+	executor "DaemonDB/query_executor"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Trigger tests: the bodies run in the session whose statement fired them.
+//
+// Run:
+//
+//	go test -race -run Trigger -v ./test
+
+// copyTrigger creates table src, whose inserted rows a trigger copies into t.
+func copyTrigger(db *crashDB) {
+	db.exec("CREATE TABLE src (id INT PRIMARY KEY, v INT)")
+	db.exec("CREATE TRIGGER copy AFTER INSERT ON src FOR EACH ROW INSERT INTO t VALUES (NEW.id, NEW.v)")
+}
+
+// A session opened later must not take over the triggers of the others: a
+// VM that can not run trigger bodies fails its own statements only.
+func TestTriggersRunInFiringSession(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+	copyTrigger(db)
+
+	bare := executor.NewVM(db.engine) // no compiler for trigger bodies
+	db.exec("INSERT INTO src VALUES (4, 40)")
+	db.exec("BEGIN")
+	db.exec("INSERT INTO src VALUES (5, 50)")
+	db.exec("COMMIT")
+	all := []string{"1=10", "2=20", "3=30", "4=40", "5=50"}
+	db.expect(all)
+
+	err := db.tryExecOn(bare, "INSERT INTO src VALUES (6, 60)")
+	if err == nil || !strings.Contains(err.Error(), "no compiler") {
+		t.Fatalf("insert in a session without a compiler: got %v", err)
+	}
+	db.expect(all)
+}
+
+// Sessions firing triggers at the same time each run their own.
+func TestTriggersConcurrentSessions(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+	copyTrigger(db)
+
+	const inserts = 10
+	done := make(chan error, 2)
+	for s := 0; s < 2; s++ {
+		vm, first := db.session(), 100*(s+1)
+		go func() {
+			for i := 0; i < inserts; i++ {
+				if err := db.tryExecOn(vm, fmt.Sprintf("INSERT INTO src VALUES (%d, %d)", first+i, i)); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+	}
+	for s := 0; s < 2; s++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"1=10", "2=20", "3=30"}
+	for _, first := range []int{100, 200} {
+		for i := 0; i < inserts; i++ {
+			want = append(want, fmt.Sprintf("%d=%d", first+i, i))
+		}
+	}
+	sort.Strings(want)
+	db.expect(want)
+}
+
+// Triggers may fire one another up to 16 deep; one level more fails the
+// statement, and everything the chain wrote rolls back with it.
+func TestTriggerNestingLimit(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+
+	// each update of row 1 updates it again while NEW.v < limit: the trigger
+	// runs for v = 0 ... limit, the last time at depth limit
+	for _, tt := range []struct {
+		limit int
+		err   bool
+	}{{15, false}, {16, true}} {
+		db.exec(fmt.Sprintf("CREATE TRIGGER again AFTER UPDATE ON t FOR EACH ROW UPDATE t SET v = NEW.v + 1 WHERE id = NEW.id AND NEW.v < %d", tt.limit))
+		err := db.tryExec("UPDATE t SET v = 0 WHERE id = 1")
+		if !tt.err {
+			if err != nil {
+				t.Fatalf("chain of %d: %v", tt.limit+1, err)
+			}
+			db.expect([]string{"1=15"}, 1)
+		} else if err == nil || !strings.Contains(err.Error(), "triggers nested more than 16 deep") {
+			t.Fatalf("chain of %d: got %v", tt.limit+1, err)
+		}
+		db.exec("DROP TRIGGER again")
+	}
+	db.expect([]string{"1=15", "2=20", "3=30"})
+
+	// a trigger inserting into its own table never stops
+	db.exec("CREATE TRIGGER again AFTER INSERT ON t FOR EACH ROW INSERT INTO t VALUES (NEW.id + 1, NEW.v)")
+	if err := db.tryExec("INSERT INTO t VALUES (10, 0)"); err == nil || !strings.Contains(err.Error(), "nested more than 16 deep") {
+		t.Fatalf("recursive insert: got %v", err)
+	}
+	db.expect([]string{"1=15", "2=20", "3=30"})
+
+	// the session is usable afterwards: the depth went back to zero
+	db.exec("DROP TRIGGER again")
+	copyTrigger(db)
+	db.exec("INSERT INTO src VALUES (4, 40)")
+	db.expect([]string{"1=15", "2=20", "3=30", "4=40"})
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+// INSERT ... ON CONFLICT tests: each way a conflict on the primary key is
+// resolved, checked against the rows of the table.
+//
+// Run:
+//
+//	go test -run Upsert -v ./test
+
+func TestUpsert(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+
+	if err := db.tryExec("INSERT INTO t VALUES (1, 11)"); err == nil {
+		t.Fatal("duplicate key inserted without ON CONFLICT")
+	}
+	db.expect([]string{"1=10", "2=20", "3=30"})
+
+	// DO NOTHING skips the row, with or without a target
+	db.exec("INSERT INTO t VALUES (1, 11) ON CONFLICT DO NOTHING")
+	db.exec("INSERT INTO t VALUES (2, 21) ON CONFLICT (id) DO NOTHING")
+	db.exec("INSERT INTO t VALUES (4, 40) ON CONFLICT DO NOTHING")
+	db.expect([]string{"1=10", "2=20", "3=30", "4=40"})
+
+	// DO UPDATE: plain columns are the existing row, EXCLUDED the proposed one
+	db.exec("INSERT INTO t VALUES (1, 5) ON CONFLICT (id) DO UPDATE SET v = t.v + EXCLUDED.v")
+	db.exec("INSERT INTO t VALUES (2, 25) ON CONFLICT (id) DO UPDATE SET v = EXCLUDED.v")
+	db.exec("INSERT INTO t VALUES (5, 50) ON CONFLICT (id) DO UPDATE SET v = 0")
+	db.expect([]string{"1=15", "2=25", "3=30", "4=40", "5=50"})
+
+	// a WHERE that does not hold leaves the row alone
+	db.exec("INSERT INTO t VALUES (3, 1) ON CONFLICT (id) DO UPDATE SET v = EXCLUDED.v WHERE t.v > 100")
+	db.exec("INSERT INTO t VALUES (4, 1) ON CONFLICT (id) DO UPDATE SET v = EXCLUDED.v WHERE EXCLUDED.v < t.v")
+	db.expect([]string{"1=15", "2=25", "3=30", "4=1", "5=50"})
+
+	for _, sql := range []string{
+		"INSERT INTO t VALUES (1, 0) ON CONFLICT (v) DO NOTHING",                    // not the primary key
+		"INSERT INTO t VALUES (1, 0) ON CONFLICT (id) DO UPDATE SET id = 9",         // changes the key
+		"INSERT INTO t VALUES (1, 0) ON CONFLICT (id) DO UPDATE SET w = 1",          // no such column
+		"INSERT INTO t VALUES (1, 0) ON CONFLICT (id) DO UPDATE SET v = EXCLUDED.w", // no such column
+	} {
+		if err := db.tryExec(sql); err == nil {
+			t.Errorf("%s: no error", sql)
+		}
+	}
+	db.expect([]string{"1=15", "2=25", "3=30", "4=1", "5=50"})
+
+	// the update commits or rolls back with its transaction
+	db.exec("BEGIN")
+	db.exec("INSERT INTO t VALUES (1, 100) ON CONFLICT (id) DO UPDATE SET v = EXCLUDED.v")
+	db.exec("INSERT INTO t VALUES (6, 60) ON CONFLICT (id) DO UPDATE SET v = EXCLUDED.v")
+	db.exec("ROLLBACK")
+	db.expect([]string{"1=15", "2=25", "3=30", "4=1", "5=50"})
+
+	// after a crash the committed updates are there
+	db.crash(false)
+	db.expect([]string{"1=15", "2=25", "3=30", "4=1", "5=50"})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// View tests: what queries on views and materialized views return, and what
+// may be done to them.
+//
+// Run:
+//
+//	go test -run View -v ./test
+
+// A refresh writes the view's rows in the transaction block it runs in:
+// other sessions see the old rows until the commit, and a rollback keeps
+// them.
+func TestMaterializedViewRefreshInTransaction(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+	db.exec("CREATE MATERIALIZED VIEW mv AS SELECT id, v FROM t")
+	const read = "SELECT id, v FROM mv ORDER BY id"
+	db.expectQuery(read, "1|10", "2|20", "3|30")
+
+	other := db.session()
+	for _, refresh := range []string{"REFRESH MATERIALIZED VIEW mv", "REFRESH MATERIALIZED VIEW CONCURRENTLY mv"} {
+		t.Run(refresh, func(t *testing.T) {
+			db.exec("BEGIN")
+			db.exec("INSERT INTO t VALUES (4, 40)")
+			db.exec(refresh)
+			db.expectQuery(read, "1|10", "2|20", "3|30", "4|40")
+			db.exec("ROLLBACK")
+			db.expectQuery(read, "1|10", "2|20", "3|30")
+
+			db.exec("BEGIN")
+			db.exec("UPDATE t SET v = v + 1 WHERE id = 2")
+			db.exec(refresh)
+			got, err := db.tryQueryOn(other, read)
+			if err != nil || strings.Join(got, " ") != "1|10 2|20 3|30" {
+				t.Fatalf("other session before the commit: %q, %v", got, err)
+			}
+			db.exec("COMMIT")
+			got, err = db.tryQueryOn(other, read)
+			if err != nil || strings.Join(got, " ") != "1|10 2|21 3|30" {
+				t.Fatalf("other session after the commit: %q, %v", got, err)
+			}
+			db.exec("UPDATE t SET v = 20 WHERE id = 2")
+			db.exec(refresh)
+		})
+	}
+}
+
+// CONCURRENTLY writes only the rows that changed, a full refresh all of them.
+func TestMaterializedViewRefreshConcurrently(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+	db.exec("CREATE MATERIALIZED VIEW mv AS SELECT id, v FROM t")
+	db.exec("UPDATE t SET v = 21 WHERE id = 2")
+
+	// the rows a refresh writes are the ones it locks
+	written := func(refresh string) int {
+		db.exec("BEGIN")
+		db.exec(refresh)
+		locks := db.query(`SELECT row_key FROM sys.locks WHERE mode = "X" AND row_key <> ""`)
+		db.exec("ROLLBACK")
+		return len(locks)
+	}
+	if got := written("REFRESH MATERIALIZED VIEW CONCURRENTLY mv"); got != 2 {
+		t.Fatalf("CONCURRENTLY wrote %d rows, want 2 (one deleted, one inserted)", got)
+	}
+	if got := written("REFRESH MATERIALIZED VIEW mv"); got != 6 {
+		t.Fatalf("a full refresh wrote %d rows, want 6", got)
+	}
+	db.exec("REFRESH MATERIALIZED VIEW CONCURRENTLY mv")
+	db.expectQuery("SELECT id, v FROM mv ORDER BY id", "1|10", "2|21", "3|30")
+}
+
+// Views can only be read; a materialized view changes by REFRESH only.
+func TestViewsAreReadOnly(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+	db.exec("CREATE VIEW v AS SELECT id, v FROM t")
+	db.exec("CREATE MATERIALIZED VIEW mv AS SELECT id, v FROM t")
+
+	for _, tt := range []struct{ sql, want string }{
+		{"INSERT INTO mv VALUES (4, 40)", "cannot modify materialized view 'mv'"},
+		{"UPDATE mv SET v = 0 WHERE id = 1", "cannot modify materialized view 'mv'"},
+		{"DELETE FROM mv WHERE id = 1", "cannot modify materialized view 'mv'"},
+		{"INSERT INTO v VALUES (4, 40)", "cannot modify view 'v'"},
+		{"UPDATE v SET v = 0", "cannot modify view 'v'"},
+		{"DELETE FROM v", "cannot modify view 'v'"},
+	} {
+		if err := db.tryExec(tt.sql); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.sql, err, tt.want)
+		}
+	}
+	db.expectQuery("SELECT id, v FROM mv ORDER BY id", "1|10", "2|20", "3|30")
+}
+
+// A table or view other views read can not be dropped until they are; the
+// error names them.
+func TestViewDependencies(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+	db.exec("CREATE VIEW v1 AS SELECT id, v FROM t")
+	db.exec("CREATE VIEW v2 AS SELECT id FROM v1 WHERE v > 15")
+	db.exec("CREATE MATERIALIZED VIEW mv AS SELECT id FROM v1 WHERE v < 25")
+	db.expectQuery("SELECT id FROM v2 ORDER BY id", "2", "3")
+	db.expectQuery("SELECT id FROM mv ORDER BY id", "1", "2")
+
+	for _, tt := range []struct {
+		sql  string
+		want []string
+	}{
+		{"DROP TABLE t", []string{"cannot drop table 't'", "view v1"}},
+		{"DROP VIEW v1", []string{"cannot drop view 'v1'", "view mv", "view v2"}},
+		{"DROP VIEW mv", []string{"use DROP MATERIALIZED VIEW"}},
+		{"DROP MATERIALIZED VIEW v2", []string{"use DROP VIEW"}},
+	} {
+		err := db.tryExec(tt.sql)
+		for _, want := range tt.want {
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got %v, want %q", tt.sql, err, want)
+			}
+		}
+	}
+	db.expectQuery("SELECT id FROM v2 ORDER BY id", "2", "3")
+
+	db.exec("DROP VIEW v2")
+	if err := db.tryExec("DROP VIEW v1"); err == nil || strings.Contains(err.Error(), "v2") {
+		t.Fatalf("DROP VIEW v1 with mv left: got %v", err)
+	}
+	db.exec("DROP MATERIALIZED VIEW mv")
+	db.exec("DROP VIEW v1")
+	db.exec("DROP TABLE t")
+}
+
+// OR REPLACE keeps the columns of a view and may add new ones at the end.
+func TestCreateOrReplaceView(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+	db.exec("CREATE VIEW v AS SELECT id, v FROM t")
+	db.exec("CREATE VIEW big AS SELECT id FROM v WHERE v >= 20")
+
+	for _, tt := range []struct{ sql, want string }{
+		{"CREATE VIEW v AS SELECT id, v FROM t", "already exists"},
+		{"CREATE OR REPLACE VIEW v AS SELECT id FROM t", "cannot drop columns from a view"},
+		{"CREATE OR REPLACE VIEW v AS SELECT id, v AS w FROM t", `cannot change name of view column "v" to "w"`},
+		{"CREATE OR REPLACE VIEW v AS SELECT v, id FROM t", `cannot change name of view column "id" to "v"`},
+		{"CREATE OR REPLACE VIEW v AS SELECT id, CAST(v AS FLOAT) AS v FROM t", `cannot change type of view column "v"`},
+	} {
+		if err := db.tryExec(tt.sql); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.sql, err, tt.want)
+		}
+	}
+	db.expectQuery("SELECT * FROM v ORDER BY id", "1|10", "2|20", "3|30")
+
+	// the new query is what the view and the views on it read
+	db.exec("CREATE OR REPLACE VIEW v AS SELECT id, v + 1 AS v, v * 2 AS twice FROM t")
+	db.expectQuery("SELECT * FROM v ORDER BY id", "1|11|20", "2|21|40", "3|31|60")
+	db.expectQuery("SELECT id FROM big ORDER BY id", "2", "3")
+}
+
+// Tables and views share one name space: neither can take the name of the
+// other.
+func TestViewAndTableNames(t *testing.T) {
+	db := newCrashDB(t)
+	seed(db)
+	db.exec("CREATE VIEW vv AS SELECT id FROM t")
+	db.exec("CREATE MATERIALIZED VIEW mv AS SELECT id FROM t")
+
+	for _, tt := range []struct{ sql, want string }{
+		{"CREATE TABLE vv (id INT PRIMARY KEY)", "view 'vv' already exists"},
+		{"CREATE TABLE mv (id INT PRIMARY KEY)", "view 'mv' already exists"},
+		{"CREATE VIEW t AS SELECT id FROM vv", "table 't' already exists"},
+		{"CREATE OR REPLACE VIEW t AS SELECT id FROM vv", "table 't' already exists"},
+	} {
+		if err := db.tryExec(tt.sql); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.sql, err, tt.want)
+		}
+	}
+
+	// the view is still what the name reads, and can be replaced
+	db.expectQuery("SELECT id FROM vv ORDER BY id", "1", "2", "3")
+	db.exec("CREATE OR REPLACE VIEW vv AS SELECT id FROM t WHERE id > 1")
+	db.expectQuery("SELECT id FROM vv ORDER BY id", "2", "3")
+
+	// once the view is dropped the name is free
+	db.exec("DROP VIEW vv")
+	db.exec("CREATE TABLE vv (id INT PRIMARY KEY)")
+	db.exec("INSERT INTO vv VALUES (7)")
+	db.expectQuery("SELECT id FROM vv", "7")
+}
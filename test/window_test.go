@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Window tests: ROWS and RANGE frames, peers and running totals, and windows
+// that spill.
+//
+// Run:
+//
+//	go test -run Window -v ./test
+
+func TestWindowFrames(t *testing.T) {
+	db := newCrashDB(t)
+	db.exec("CREATE TABLE w (id INT PRIMARY KEY, g INT, t INT, v INT)")
+	db.exec("BEGIN")
+	// rows 2 and 3 are peers on t
+	for _, row := range [][4]int{{1, 1, 1, 10}, {2, 1, 2, 20}, {3, 1, 2, 30}, {4, 1, 5, 40}, {5, 2, 1, 5}, {6, 2, 3, 15}} {
+		db.exec(fmt.Sprintf("INSERT INTO w VALUES (%d, %d, %d, %d)", row[0], row[1], row[2], row[3]))
+	}
+	db.exec("COMMIT")
+
+	tests := []struct {
+		name, call string
+		want       []string // by id
+	}{
+		{"running total takes peers", "SUM(v) OVER (PARTITION BY g ORDER BY t)",
+			[]string{"10", "60", "60", "100", "5", "20"}},
+		{"ROWS running total", "SUM(v) OVER (PARTITION BY g ORDER BY t, id ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW)",
+			[]string{"10", "30", "60", "100", "5", "20"}},
+		{"ROWS with offsets", "SUM(v) OVER (PARTITION BY g ORDER BY t, id ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING)",
+			[]string{"30", "60", "90", "70", "20", "20"}},
+		{"RANGE with offsets", "SUM(v) OVER (PARTITION BY g ORDER BY t RANGE BETWEEN 1 PRECEDING AND 1 FOLLOWING)",
+			[]string{"60", "60", "60", "40", "5", "15"}},
+		{"RANGE current row is the peers", "COUNT(*) OVER (PARTITION BY g ORDER BY t RANGE BETWEEN CURRENT ROW AND CURRENT ROW)",
+			[]string{"1", "2", "2", "1", "1", "1"}},
+		{"to UNBOUNDED FOLLOWING", "SUM(v) OVER (PARTITION BY g ORDER BY t, id ROWS BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING)",
+			[]string{"100", "90", "70", "40", "20", "15"}},
+		{"empty frame", "MAX(v) OVER (ORDER BY id ROWS BETWEEN 2 PRECEDING AND 1 PRECEDING)",
+			[]string{"NULL", "10", "20", "30", "40", "40"}},
+		{"shorthand frame", "AVG(v) OVER (ORDER BY id ROWS 1 PRECEDING)",
+			[]string{"10", "15", "25", "35", "22.5", "10"}},
+		{"whole partition", "LAST_VALUE(v) OVER (PARTITION BY g ORDER BY t, id ROWS BETWEEN UNBOUNDED PRECEDING AND UNBOUNDED FOLLOWING)",
+			[]string{"40", "40", "40", "40", "15", "15"}},
+		{"no ORDER BY", "MIN(v) OVER (PARTITION BY g)",
+			[]string{"10", "10", "10", "10", "5", "5"}},
+		{"RANK of peers", "RANK() OVER (PARTITION BY g ORDER BY t)",
+			[]string{"1", "2", "2", "4", "1", "2"}},
+		{"DENSE_RANK of peers", "DENSE_RANK() OVER (PARTITION BY g ORDER BY t)",
+			[]string{"1", "2", "2", "3", "1", "2"}},
+		{"LAG with a default", "LAG(v, 2, 0) OVER (PARTITION BY g ORDER BY t, id)",
+			[]string{"0", "0", "10", "20", "0", "0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := make([]string, len(tt.want))
+			for i, v := range tt.want {
+				want[i] = fmt.Sprintf("%d|%s", i+1, v)
+			}
+			db.expectQuery("SELECT id, "+tt.call+" FROM w ORDER BY id", want...)
+		})
+	}
+
+	// a window is filtered on from an outer query
+	db.expectQuery("SELECT id FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY g ORDER BY v DESC) AS rn FROM w) r WHERE rn = 1 ORDER BY id",
+		"4", "6")
+}
+
+// With a memory of 4 rows a window with PARTITION BY spills, one partition
+// file at a time, and returns the same rows in the same order; one without
+// PARTITION BY is computed in memory.
+func TestWindowSpilled(t *testing.T) {
+	t.Setenv("DAEMONDB_JOIN_MEMORY_ROWS", "4")
+	db := newCrashDB(t)
+	joinTables(db)
+
+	// b pairs rows 2k-1 and 2k on a_id for k <= 8; rows 17-20 are alone
+	var partitioned, running []string
+	for i := 1; i <= 20; i++ {
+		rn, sum := 2-(i+1)%2, 40*((i+1)/2)-16
+		if i > 16 {
+			rn, sum = 1, 10*i-3
+		}
+		partitioned = append(partitioned, fmt.Sprintf("%d|%d|%d", i, rn, sum))
+		running = append(running, fmt.Sprintf("%d|%d", i, i))
+	}
+
+	sql := "SELECT id, ROW_NUMBER() OVER (PARTITION BY a_id ORDER BY id DESC), SUM(y) OVER (PARTITION BY a_id) FROM b"
+	db.expectQuery(sql, partitioned...)
+	analyzed := strings.Join(db.query("EXPLAIN ANALYZE "+sql), "\n")
+	partitions, peak := spillActuals(t, analyzed, "WindowAgg")
+	if partitions == 0 {
+		t.Fatalf("the window did not spill:\n%s", analyzed)
+	}
+	if peak > 4 {
+		t.Fatalf("the window held %d rows at once, more than the 4 it may:\n%s", peak, analyzed)
+	}
+
+	sql = "SELECT id, ROW_NUMBER() OVER (ORDER BY id) FROM b"
+	db.expectQuery(sql, running...)
+	analyzed = strings.Join(db.query("EXPLAIN ANALYZE "+sql), "\n")
+	if partitions, _ := spillActuals(t, analyzed, "WindowAgg"); partitions != 0 {
+		t.Fatalf("a window without PARTITION BY spilled:\n%s", analyzed)
+	}
+}
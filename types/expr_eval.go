@@ -0,0 +1,353 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+This file contains the expression evaluator shared by the VM (UPDATE SET/WHERE,
+INSERT values) and the storage engine (SELECT filters, join predicates).
+
+Rows are maps keyed by column name. Single-table rows use the bare column
+name, joined rows use "table.column"; LookupColumn resolves both forms.
+*/
+
+// EvalExpression evaluates expr against row and returns its value.
+func EvalExpression(expr *ExpressionNode, row map[string]interface{}) (interface{}, error) {
+	if expr == nil {
+		return nil, fmt.Errorf("nil expression")
+	}
+
+	switch expr.Type {
+	case ExprLiteral:
+		return expr.LiteralValue()
+
+	case ExprColumn:
+		val, ok := LookupColumn(row, expr.Column)
+		if !ok {
+			return nil, fmt.Errorf("column %s not found", expr.Column)
+		}
+		return normalizeValue(val), nil
+
+	case ExprBinary:
+		left, err := EvalExpression(expr.Left, row)
+		if err != nil {
+			return nil, err
+		}
+		right, err := EvalExpression(expr.Right, row)
+		if err != nil {
+			return nil, err
+		}
+		return ApplyArithmetic(left, right, expr.Op)
+
+	case ExprComparison:
+		left, err := EvalExpression(expr.Left, row)
+		if err != nil {
+			return nil, err
+		}
+		right, err := EvalExpression(expr.Right, row)
+		if err != nil {
+			return nil, err
+		}
+		return ApplyComparison(left, right, expr.Op)
+
+	case ExprCast:
+		val, err := EvalExpression(expr.Left, row)
+		if err != nil {
+			return nil, err
+		}
+		return CastValue(val, expr.DataType)
+
+	case ExprFunc:
+		if expr.Window != nil {
+			return nil, fmt.Errorf("window function %s is not allowed here", strings.ToUpper(expr.Func))
+		}
+		fn, ok := LookupFunction(expr.Func)
+		if !ok {
+			return nil, fmt.Errorf("function %s does not exist", expr.Func)
+		}
+		args := make([]any, len(expr.Args))
+		for i, arg := range expr.Args {
+			val, err := EvalExpression(arg, row)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = val
+		}
+		return fn.Call(args)
+
+	case ExprCase:
+		for _, branch := range expr.Whens {
+			match, err := EvalPredicate(branch.When, row)
+			if err != nil {
+				return nil, err
+			}
+			if match {
+				return EvalExpression(branch.Then, row)
+			}
+		}
+		if expr.Else != nil {
+			return EvalExpression(expr.Else, row)
+		}
+		return nil, nil
+
+	case ExprLogical:
+		left, err := EvalExpression(expr.Left, row)
+		if err != nil {
+			return nil, err
+		}
+		// short-circuit when the left side already decides the result
+		if b, ok := left.(bool); ok && ((b && strings.EqualFold(expr.Op, "OR")) || (!b && strings.EqualFold(expr.Op, "AND"))) {
+			return b, nil
+		}
+		var right interface{}
+		if expr.Right != nil {
+			if right, err = EvalExpression(expr.Right, row); err != nil {
+				return nil, err
+			}
+		}
+		return ApplyLogical(left, right, expr.Op)
+
+	case ExprLike:
+		vals, err := evalAll(row, expr.Left, expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		var escape interface{} = DefaultLikeEscape
+		if expr.Escape != nil {
+			if escape, err = EvalExpression(expr.Escape, row); err != nil {
+				return nil, err
+			}
+		}
+		res, err := ApplyLike(vals[0], vals[1], escape, strings.EqualFold(expr.Op, "ILIKE"))
+		return negate(res, expr.Negate), err
+
+	case ExprIn:
+		value, err := EvalExpression(expr.Left, row)
+		if err != nil {
+			return nil, err
+		}
+		var list []interface{}
+		if expr.Subquery != nil {
+			list, err = expr.subqueryColumn(row)
+		} else {
+			list, err = evalAll(row, expr.Args...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res, err := ApplyIn(value, list)
+		return negate(res, expr.Negate), err
+
+	case ExprSubquery:
+		values, err := expr.subqueryColumn(row)
+		if err != nil {
+			return nil, err
+		}
+		switch len(values) {
+		case 0:
+			return nil, nil
+		case 1:
+			return normalizeValue(values[0]), nil
+		}
+		return nil, fmt.Errorf("more than one row returned by a subquery used as an expression")
+
+	case ExprExists:
+		if expr.run == nil {
+			return nil, fmt.Errorf("subquery is not bound")
+		}
+		rows, _, err := expr.run(row)
+		if err != nil {
+			return nil, err
+		}
+		return (len(rows) > 0) != expr.Negate, nil
+
+	case ExprBetween:
+		if len(expr.Args) != 2 {
+			return nil, fmt.Errorf("BETWEEN requires two bounds")
+		}
+		vals, err := evalAll(row, expr.Left, expr.Args[0], expr.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		res, err := ApplyBetween(vals[0], vals[1], vals[2])
+		return negate(res, expr.Negate), err
+	}
+
+	return nil, fmt.Errorf("unsupported expression type: %d", expr.Type)
+}
+
+// subqueryColumn runs the bound subquery and returns its only column.
+func (n *ExpressionNode) subqueryColumn(row map[string]interface{}) ([]interface{}, error) {
+	if n.run == nil {
+		return nil, fmt.Errorf("subquery is not bound")
+	}
+	rows, columns, err := n.run(row)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != 1 {
+		return nil, fmt.Errorf("subquery must return only one column, got %d", len(columns))
+	}
+	values := make([]interface{}, len(rows))
+	for i, r := range rows {
+		values[i] = r[columns[0]]
+	}
+	return values, nil
+}
+
+func evalAll(row map[string]interface{}, exprs ...*ExpressionNode) ([]interface{}, error) {
+	vals := make([]interface{}, len(exprs))
+	for i, e := range exprs {
+		val, err := EvalExpression(e, row)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return vals, nil
+}
+
+// EvalPredicate evaluates a boolean expression. NULL (unknown) is treated as
+// false, as in a SQL WHERE clause.
+func EvalPredicate(expr *ExpressionNode, row map[string]interface{}) (bool, error) {
+	val, err := EvalExpression(expr, row)
+	if err != nil {
+		return false, err
+	}
+	switch b := val.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return b, nil
+	}
+	return false, fmt.Errorf("predicate must be boolean, got %s", TypeOfValue(val))
+}
+
+// LiteralValue returns the literal converted to its declared DataType.
+func (n *ExpressionNode) LiteralValue() (interface{}, error) {
+	if n.DataType == "" {
+		return normalizeValue(n.Literal), nil
+	}
+	return CastValue(n.Literal, n.DataType)
+}
+
+// LookupColumn finds a column value in a row. It tries the exact key, then a
+// case-insensitive match, then (for unqualified names) a unique "table.col"
+// key, and (for qualified names) the bare column.
+func LookupColumn(row map[string]interface{}, name string) (interface{}, bool) {
+	if val, ok := row[name]; ok {
+		return val, true
+	}
+	if val, ok := row[strings.ToLower(name)]; ok {
+		return val, true
+	}
+
+	var (
+		found  interface{}
+		hits   int
+		suffix = "." + strings.ToLower(name)
+	)
+	for key, val := range row {
+		lower := strings.ToLower(key)
+		if lower == strings.ToLower(name) {
+			return val, true
+		}
+		if !strings.Contains(name, ".") && strings.HasSuffix(lower, suffix) {
+			found = val
+			hits++
+		}
+	}
+	if hits == 1 {
+		return found, true
+	}
+
+	if dot := strings.LastIndex(name, "."); dot != -1 && hits == 0 {
+		return LookupColumn(row, name[dot+1:])
+	}
+	return nil, false
+}
+
+// ApplyArithmetic applies +, -, * or / after casting both operands to their
+// common numeric type. INT op INT stays INT (integer division) and fails with
+// ErrIntOutOfRange when the result does not fit; any FLOAT operand makes the
+// result FLOAT. NULL propagates.
+func ApplyArithmetic(left, right interface{}, op string) (interface{}, error) {
+	left, right = normalizeValue(left), normalizeValue(right)
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	lt, rt := TypeOfValue(left), TypeOfValue(right)
+	if !IsNumericType(lt) || !IsNumericType(rt) {
+		return nil, fmt.Errorf("operator %s requires numeric operands, got %s and %s", op, lt, rt)
+	}
+
+	if lt == TypeInt && rt == TypeInt {
+		// both operands are INTs, so the result fits in an int and only
+		// has to be checked against the range of an INT
+		l, r := left.(int), right.(int)
+		switch op {
+		case "+":
+			return checkInt(l + r)
+		case "-":
+			return checkInt(l - r)
+		case "*":
+			return checkInt(l * r)
+		case "/":
+			if r == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return checkInt(l / r)
+		}
+		return nil, fmt.Errorf("unknown operator: %s", op)
+	}
+
+	lv, _ := CastValue(left, TypeFloat)
+	rv, _ := CastValue(right, TypeFloat)
+	l, r := lv.(float64), rv.(float64)
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	}
+	return nil, fmt.Errorf("unknown operator: %s", op)
+}
+
+// ApplyComparison compares two values with a SQL comparison operator.
+// Returns nil (unknown) when either side is NULL.
+func ApplyComparison(left, right interface{}, op string) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	cmp, err := CompareTyped(left, right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "=":
+		return cmp == 0, nil
+	case "!=", "<>":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return nil, fmt.Errorf("unknown comparison operator: %s", op)
+}
@@ -0,0 +1,319 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+This file contains the registry of built-in scalar functions.
+
+Each function declares its parameter types so calls can be type checked at plan
+time (InferType), and an Eval implementation used by the evaluator at run time.
+Unless a function is marked NullSafe, a NULL argument makes the result NULL
+without calling Eval.
+
+	string:      UPPER, LOWER, LENGTH, SUBSTR, TRIM, CONCAT, REPLACE
+	math:        ABS, ROUND, FLOOR, CEIL, MOD, POWER
+	null:        COALESCE, NULLIF
+*/
+
+// Pseudo parameter types accepted in ScalarFunction.Params.
+const (
+	paramNumeric = "NUMERIC" // INT or FLOAT
+	paramAny     = "ANY"     // every type
+)
+
+// ScalarFunction describes a built-in function callable from expressions.
+type ScalarFunction struct {
+	Name     string
+	Params   []string // declared parameter types
+	MinArgs  int      // parameters from MinArgs onwards are optional
+	Variadic bool     // the last parameter may be repeated
+	NullSafe bool     // Eval receives NULL arguments instead of short-circuiting to NULL
+
+	Result func(args []string) (string, error)
+	Eval   func(args []any) (any, error)
+}
+
+var scalarFunctions = map[string]*ScalarFunction{}
+
+// RegisterFunction adds fn to the registry, replacing any function with the same name.
+func RegisterFunction(fn *ScalarFunction) {
+	scalarFunctions[strings.ToUpper(fn.Name)] = fn
+}
+
+// LookupFunction returns the function registered under name (case-insensitive).
+func LookupFunction(name string) (*ScalarFunction, bool) {
+	fn, ok := scalarFunctions[strings.ToUpper(name)]
+	return fn, ok
+}
+
+// CheckArgs validates the argument count and types of a call and returns
+// the result type.
+func (fn *ScalarFunction) CheckArgs(args []string) (string, error) {
+	if len(args) < fn.MinArgs || (!fn.Variadic && len(args) > len(fn.Params)) {
+		return "", fmt.Errorf("function %s: wrong number of arguments (%d)", fn.Name, len(args))
+	}
+
+	for i, got := range args {
+		want := fn.Params[min(i, len(fn.Params)-1)]
+		switch {
+		case want == paramAny, got == TypeNull:
+			continue
+		case want == paramNumeric && IsNumericType(got):
+			continue
+		case CanImplicitCast(got, want):
+			continue
+		}
+		return "", fmt.Errorf("function %s: argument %d must be %s, got %s (use CAST)", fn.Name, i+1, want, got)
+	}
+
+	return fn.Result(args)
+}
+
+// Call evaluates fn on already evaluated arguments.
+func (fn *ScalarFunction) Call(args []any) (any, error) {
+	for i := range args {
+		args[i] = normalizeValue(args[i])
+		if args[i] == nil && !fn.NullSafe {
+			return nil, nil
+		}
+	}
+	return fn.Eval(args)
+}
+
+func returns(typ string) func([]string) (string, error) {
+	return func([]string) (string, error) { return typ, nil }
+}
+
+// sameAsFirst returns the type of the first argument (ABS, ROUND, FLOOR, CEIL).
+func sameAsFirst(args []string) (string, error) {
+	return args[0], nil
+}
+
+// numericResult is INT when every argument is INT, FLOAT otherwise.
+func numericResult(args []string) (string, error) {
+	for _, a := range args {
+		if a == TypeFloat {
+			return TypeFloat, nil
+		}
+	}
+	return TypeInt, nil
+}
+
+// commonResult folds CommonType over all arguments (COALESCE, NULLIF).
+func commonResult(args []string) (string, error) {
+	result := TypeNull
+	for _, a := range args {
+		var err error
+		if result, err = CommonType(result, a); err != nil {
+			return "", err
+		}
+	}
+	return result, nil
+}
+
+func toFloat64(v any) float64 {
+	if i, ok := v.(int); ok {
+		return float64(i)
+	}
+	return v.(float64)
+}
+
+func init() {
+	// ── string functions ─────────────────────────────────────────────────────
+	RegisterFunction(&ScalarFunction{
+		Name: "UPPER", Params: []string{TypeVarchar}, MinArgs: 1,
+		Result: returns(TypeVarchar),
+		Eval:   func(a []any) (any, error) { return strings.ToUpper(a[0].(string)), nil },
+	})
+	RegisterFunction(&ScalarFunction{
+		Name: "LOWER", Params: []string{TypeVarchar}, MinArgs: 1,
+		Result: returns(TypeVarchar),
+		Eval:   func(a []any) (any, error) { return strings.ToLower(a[0].(string)), nil },
+	})
+	RegisterFunction(&ScalarFunction{
+		Name: "TRIM", Params: []string{TypeVarchar}, MinArgs: 1,
+		Result: returns(TypeVarchar),
+		Eval:   func(a []any) (any, error) { return strings.TrimSpace(a[0].(string)), nil },
+	})
+	RegisterFunction(&ScalarFunction{
+		Name: "LENGTH", Params: []string{TypeVarchar}, MinArgs: 1,
+		Result: returns(TypeInt),
+		Eval:   func(a []any) (any, error) { return utf8.RuneCountInString(a[0].(string)), nil },
+	})
+	RegisterFunction(&ScalarFunction{
+		// SUBSTR(s, start [, length]) with a 1-based start position
+		Name: "SUBSTR", Params: []string{TypeVarchar, TypeInt, TypeInt}, MinArgs: 2,
+		Result: returns(TypeVarchar),
+		Eval: func(a []any) (any, error) {
+			runes := []rune(a[0].(string))
+			begin := a[1].(int) - 1
+			end := len(runes)
+			if len(a) == 3 {
+				length := a[2].(int)
+				if length < 0 {
+					return nil, fmt.Errorf("negative substring length not allowed")
+				}
+				end = begin + length
+			}
+			begin = max(0, min(begin, len(runes)))
+			end = max(begin, min(end, len(runes)))
+			return string(runes[begin:end]), nil
+		},
+	})
+	RegisterFunction(&ScalarFunction{
+		// CONCAT skips NULL arguments and casts everything else to VARCHAR
+		Name: "CONCAT", Params: []string{paramAny}, MinArgs: 1, Variadic: true, NullSafe: true,
+		Result: returns(TypeVarchar),
+		Eval: func(a []any) (any, error) {
+			var sb strings.Builder
+			for _, v := range a {
+				if v == nil {
+					continue
+				}
+				s, err := CastValue(v, TypeVarchar)
+				if err != nil {
+					return nil, err
+				}
+				sb.WriteString(s.(string))
+			}
+			return sb.String(), nil
+		},
+	})
+	RegisterFunction(&ScalarFunction{
+		Name: "REPLACE", Params: []string{TypeVarchar, TypeVarchar, TypeVarchar}, MinArgs: 3,
+		Result: returns(TypeVarchar),
+		Eval: func(a []any) (any, error) {
+			if a[1].(string) == "" {
+				return a[0], nil
+			}
+			return strings.ReplaceAll(a[0].(string), a[1].(string), a[2].(string)), nil
+		},
+	})
+
+	// ── math functions ───────────────────────────────────────────────────────
+	RegisterFunction(&ScalarFunction{
+		Name: "ABS", Params: []string{paramNumeric}, MinArgs: 1,
+		Result: sameAsFirst,
+		Eval: func(a []any) (any, error) {
+			if i, ok := a[0].(int); ok {
+				return max(i, -i), nil
+			}
+			return math.Abs(a[0].(float64)), nil
+		},
+	})
+	RegisterFunction(&ScalarFunction{
+		// ROUND(x [, digits]) rounds half away from zero
+		Name: "ROUND", Params: []string{paramNumeric, TypeInt}, MinArgs: 1,
+		Result: sameAsFirst,
+		Eval: func(a []any) (any, error) {
+			digits := 0
+			if len(a) == 2 {
+				digits = a[1].(int)
+			}
+			scale := math.Pow(10, float64(digits))
+			if i, ok := a[0].(int); ok {
+				if digits >= 0 {
+					return i, nil
+				}
+				return int(math.Round(float64(i)*scale) / scale), nil
+			}
+			return math.Round(a[0].(float64)*scale) / scale, nil
+		},
+	})
+	RegisterFunction(&ScalarFunction{
+		Name: "FLOOR", Params: []string{paramNumeric}, MinArgs: 1,
+		Result: sameAsFirst,
+		Eval: func(a []any) (any, error) {
+			if f, ok := a[0].(float64); ok {
+				return math.Floor(f), nil
+			}
+			return a[0], nil
+		},
+	})
+	RegisterFunction(&ScalarFunction{
+		Name: "CEIL", Params: []string{paramNumeric}, MinArgs: 1,
+		Result: sameAsFirst,
+		Eval: func(a []any) (any, error) {
+			if f, ok := a[0].(float64); ok {
+				return math.Ceil(f), nil
+			}
+			return a[0], nil
+		},
+	})
+	RegisterFunction(&ScalarFunction{
+		Name: "MOD", Params: []string{paramNumeric, paramNumeric}, MinArgs: 2,
+		Result: numericResult,
+		Eval: func(a []any) (any, error) {
+			l, lok := a[0].(int)
+			r, rok := a[1].(int)
+			if lok && rok {
+				if r == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return l % r, nil
+			}
+			if toFloat64(a[1]) == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return math.Mod(toFloat64(a[0]), toFloat64(a[1])), nil
+		},
+	})
+	RegisterFunction(&ScalarFunction{
+		Name: "POWER", Params: []string{paramNumeric, paramNumeric}, MinArgs: 2,
+		Result: returns(TypeFloat),
+		Eval: func(a []any) (any, error) {
+			return math.Pow(toFloat64(a[0]), toFloat64(a[1])), nil
+		},
+	})
+
+	// ── null handling ────────────────────────────────────────────────────────
+	RegisterFunction(&ScalarFunction{
+		// COALESCE returns the first non-NULL argument
+		Name: "COALESCE", Params: []string{paramAny}, MinArgs: 1, Variadic: true, NullSafe: true,
+		Result: commonResult,
+		Eval: func(a []any) (any, error) {
+			argTypes := make([]string, len(a))
+			for i, v := range a {
+				argTypes[i] = TypeOfValue(v)
+			}
+			typ, err := commonResult(argTypes)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range a {
+				if v != nil {
+					return CastValue(v, typ)
+				}
+			}
+			return nil, nil
+		},
+	})
+	RegisterFunction(&ScalarFunction{
+		// NULLIF(a, b) returns NULL when a = b, otherwise a
+		Name: "NULLIF", Params: []string{paramAny, paramAny}, MinArgs: 2, NullSafe: true,
+		Result: func(args []string) (string, error) {
+			if _, err := CommonType(args[0], args[1]); err != nil {
+				return "", fmt.Errorf("function NULLIF: %w", err)
+			}
+			return args[0], nil
+		},
+		Eval: func(a []any) (any, error) {
+			if a[0] == nil || a[1] == nil {
+				return a[0], nil
+			}
+			cmp, err := CompareTyped(a[0], a[1])
+			if err != nil {
+				return nil, err
+			}
+			if cmp == 0 {
+				return nil, nil
+			}
+			return a[0], nil
+		},
+	})
+}
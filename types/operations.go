@@ -21,6 +21,21 @@ const (
 	OpDrop          OperationType = 9
 	OpTruncateTable OperationType = 10
 	OpDropTable     OperationType = 11
+
+	// savepoints: ROLLBACK TO carries the LSN of the savepoint it returns to
+	// in TargetLSN; the rows it undoes are logged as OpCLR
+	OpSavepoint           OperationType = 12
+	OpRollbackToSavepoint OperationType = 13
+	OpReleaseSavepoint    OperationType = 14
+
+	// compensation log record: the undo of the DML record at TargetLSN (of
+	// type Undone, whose row images and pointers it repeats), written by a
+	// rollback and by recovery; it is redone like any change and never undone
+	OpCLR OperationType = 15
+
+	// pruning: the version at RowPtr (RowData its row), which committed
+	// transaction TxnID replaced or deleted, is removed with its index entry
+	OpPrune OperationType = 16
 )
 
 type Operation struct {
@@ -29,17 +44,22 @@ type Operation struct {
 
 	LSN       uint64
 	TargetLSN uint64
+	Undone    OperationType `json:"undone,omitempty"` // OpCLR
 
-	// DML
-	Table   string     `json:"table,omitempty"`
-	RowData []byte     `json:"row_data,omitempty"`
-	RowPtr  RowPointer `json:"row_ptr,omitempty"`
-	OldPtr  RowPointer `json:"old_ptr,omitempty"`
+	Savepoint string `json:"savepoint,omitempty"`
 
-	Where *ExpressionNode `json:"where,omitempty"`
+	// DML: RowData is the after-image of OpInsert / OpUpdate and the
+	// before-image of OpDelete; OldRowData the before-image of OpUpdate
+	Table      string     `json:"table,omitempty"`
+	RowData    []byte     `json:"row_data,omitempty"`
+	OldRowData []byte     `json:"old_row_data,omitempty"`
+	RowPtr     RowPointer `json:"row_ptr,omitempty"`
+	OldPtr     RowPointer `json:"old_ptr,omitempty"`
 
-	WhereCol string `json:"where_col,omitempty"`
-	WhereVal string `json:"where_val,omitempty"`
+	// MVCC: the older version a new one (OpInsert / OpUpdate) links to
+	Prev *RowPointer `json:"prev,omitempty"`
+
+	Where *ExpressionNode `json:"where,omitempty"`
 
 	// DDL
 	Schema *TableSchema `json:"schema,omitempty"`
@@ -51,28 +71,276 @@ func (op *Operation) Encode() []byte {
 }
 
 type SelectPayload struct {
-	Table     string   `json:"table"`
-	Columns   []string `json:"columns"`
-	WhereCol  string   `json:"where_col,omitempty"`
-	WhereVal  string   `json:"where_val,omitempty"`
-	JoinTable string   `json:"join_table,omitempty"`
-	JoinType  string   `json:"join_type,omitempty"`
-	LeftCol   string   `json:"left_col,omitempty"`
-	RightCol  string   `json:"right_col,omitempty"`
+	Table   string   `json:"table"`
+	Alias   string   `json:"alias,omitempty"`
+	Columns []string `json:"columns"`
+
+	// FROM (SELECT ...) alias: Table is empty and Alias names the subquery
+	FromSubquery *SelectPayload `json:"from_subquery,omitempty"`
+
+	// JOINs applied left to right to the FROM table
+	Joins []JoinClause `json:"joins,omitempty"`
+
+	WhereExpr *ExpressionNode `json:"where_expr,omitempty"`
+
+	Distinct    bool          `json:"distinct,omitempty"`
+	Projections []Projection  `json:"projections,omitempty"` // empty means SELECT *
+	OrderBy     []OrderByItem `json:"order_by,omitempty"`
+
+	// left UNION | INTERSECT | EXCEPT right: the other fields except OrderBy are empty
+	SetOp *SetOperation `json:"set_op,omitempty"`
+
+	// WITH RECURSIVE: Recursive names the CTE whose query this is. SetOp is
+	// anchor UNION [ALL] step, and step is run again on the rows it produced
+	// last (the work table) until it produces none. The step reads the work
+	// table through a FROM item whose query has only WorkTable set.
+	Recursive string `json:"recursive,omitempty"`
+	WorkTable string `json:"work_table,omitempty"`
+
+	// SystemTable names the system table (sys.locks) the query reads; the
+	// other fields are empty
+	SystemTable string `json:"system_table,omitempty"`
+
+	// OutputNames renames the result columns by position (WITH name (col, ...))
+	OutputNames []string `json:"output_names,omitempty"`
+}
+
+// SetOperation combines the rows of two queries. Types holds the common type
+// of each output column; the type checker fills it in and rows of either side
+// are converted to it (INT UNION FLOAT gives FLOAT).
+type SetOperation struct {
+	Op    string         `json:"op"` // UNION, INTERSECT, EXCEPT
+	All   bool           `json:"all,omitempty"`
+	Left  *SelectPayload `json:"left"`
+	Right *SelectPayload `json:"right"`
+	Types []string       `json:"types,omitempty"`
+}
+
+// CreateViewPayload is CREATE [OR REPLACE] [MATERIALIZED] VIEW name [(cols)] AS query.
+type CreateViewPayload struct {
+	Name         string        `json:"name"`
+	ColumnNames  []string      `json:"column_names,omitempty"`
+	OrReplace    bool          `json:"or_replace,omitempty"`
+	Materialized bool          `json:"materialized,omitempty"`
+	SQL          string        `json:"sql"`
+	Query        SelectPayload `json:"query"`
+	References   []string      `json:"references,omitempty"` // names in the FROM items of the query, views included
+}
+
+// ViewPayload names the view of DROP [MATERIALIZED] VIEW and REFRESH MATERIALIZED VIEW.
+type ViewPayload struct {
+	Name         string `json:"name"`
+	Materialized bool   `json:"materialized,omitempty"`
+	Concurrently bool   `json:"concurrently,omitempty"`
+}
+
+// ExplainPayload is an EXPLAIN [ANALYZE] of a SELECT.
+type ExplainPayload struct {
+	Analyze bool          `json:"analyze,omitempty"`
+	Format  string        `json:"format"` // "text" or "json"
+	Select  SelectPayload `json:"select"`
+}
+
+// From returns the first FROM item of the query.
+func (p *SelectPayload) From() TableRef {
+	return TableRef{Table: p.Table, Alias: p.Alias, Subquery: p.FromSubquery}
+}
+
+// TableRefs returns every FROM item: the FROM table followed by the joined ones.
+func (p *SelectPayload) TableRefs() []TableRef {
+	refs := []TableRef{p.From()}
+	for _, join := range p.Joins {
+		refs = append(refs, join.TableRef)
+	}
+	return refs
+}
+
+// TableRef is one FROM item: a base table or a derived table (subquery),
+// optionally renamed by an alias.
+type TableRef struct {
+	Table    string         `json:"table,omitempty"`
+	Alias    string         `json:"alias,omitempty"`
+	Subquery *SelectPayload `json:"subquery,omitempty"`
+}
+
+// Name is the name columns of the item are qualified with: the alias if
+// there is one, otherwise the table name.
+func (t TableRef) Name() string {
+	if t.Alias != "" {
+		return t.Alias
+	}
+	return t.Table
+}
+
+// JoinClause joins one FROM item to the rows produced by the items before it.
+// Exactly one of On, Using or Natural describes the join condition.
+type JoinClause struct {
+	TableRef
+	Type    string          `json:"type,omitempty"` // INNER (default), LEFT, RIGHT, FULL, CROSS
+	On      *ExpressionNode `json:"on,omitempty"`
+	Using   []string        `json:"using,omitempty"`
+	Natural bool            `json:"natural,omitempty"`
+}
+
+// Projection is one select-list expression and its output column name.
+type Projection struct {
+	Expr *ExpressionNode `json:"expr"`
+	Name string          `json:"name"`
+}
+
+// OrderByItem is one ORDER BY key.
+type OrderByItem struct {
+	Expr *ExpressionNode `json:"expr"`
+	Desc bool            `json:"desc,omitempty"`
 }
 
 type UpdatePayload struct {
 	Table     string                    `json:"table"`
+	Alias     string                    `json:"alias,omitempty"`
 	SetExprs  map[string]ExpressionNode `json:"set_exprs"`
+	From      []JoinClause              `json:"from,omitempty"` // UPDATE ... FROM items, joined to the table
 	WhereExpr *ExpressionNode           `json:"where_expr,omitempty"`
 }
 
+// DeletePayload is DELETE FROM table [alias] [USING items] [WHERE expr].
+type DeletePayload struct {
+	Table     string          `json:"table"`
+	Alias     string          `json:"alias,omitempty"`
+	Using     []JoinClause    `json:"using,omitempty"` // joined to the table like UPDATE ... FROM
+	WhereExpr *ExpressionNode `json:"where_expr,omitempty"`
+}
+
+// OnConflict is the ON CONFLICT clause of an INSERT: what to do when the
+// row's primary key already exists. In SetExprs and Where, unqualified
+// columns are the existing row and EXCLUDED.col the row proposed for insertion.
+type OnConflict struct {
+	Columns  []string                  `json:"columns,omitempty"`
+	DoUpdate bool                      `json:"do_update,omitempty"`
+	SetExprs map[string]ExpressionNode `json:"set_exprs,omitempty"`
+	Where    *ExpressionNode           `json:"where,omitempty"`
+}
+
+// Expression node kinds (must stay in sync with parser.ExprType)
+const (
+	ExprLiteral    = 0
+	ExprColumn     = 1
+	ExprBinary     = 2
+	ExprComparison = 3
+	ExprCast       = 4
+	ExprFunc       = 5
+	ExprCase       = 6
+	ExprLogical    = 7
+	ExprLike       = 8
+	ExprIn         = 9
+	ExprBetween    = 10
+	ExprSubquery   = 11 // scalar subquery
+	ExprExists     = 12
+)
+
 // ExpressionNode represents an expression tree for evaluation
 type ExpressionNode struct {
-	Type    int             `json:"type"` // 0=LITERAL, 1=COLUMN, 2=BINARY, 3=COMPARISON
+	Type    int             `json:"type"` // see the Expr* constants above
 	Literal interface{}     `json:"literal,omitempty"`
 	Column  string          `json:"column,omitempty"`
 	Op      string          `json:"op,omitempty"`
 	Left    *ExpressionNode `json:"left,omitempty"`
 	Right   *ExpressionNode `json:"right,omitempty"`
+
+	// DataType is the SQL type of a literal, the target type of a CAST, or the
+	// output type of a scalar/IN subquery (filled in by the type checker).
+	// Literals need it because JSON decodes every number as float64.
+	DataType string `json:"data_type,omitempty"`
+
+	// FUNC: function name and arguments; IN: the value list; BETWEEN: low and high bounds
+	Func string            `json:"func,omitempty"`
+	Args []*ExpressionNode `json:"args,omitempty"`
+
+	// FUNC called as a window function: the OVER clause
+	Window *WindowSpec `json:"window,omitempty"`
+
+	// LIKE/ILIKE/IN/BETWEEN: NOT variant; LIKE: optional ESCAPE character
+	Negate bool            `json:"negate,omitempty"`
+	Escape *ExpressionNode `json:"escape,omitempty"`
+
+	// CASE: WHEN/THEN branches and the optional ELSE
+	Whens []CaseWhen      `json:"whens,omitempty"`
+	Else  *ExpressionNode `json:"else,omitempty"`
+
+	// SUBQUERY / EXISTS / IN (SELECT ...): the inner query. The storage engine
+	// binds a runner to the node before it is evaluated.
+	Subquery *SelectPayload `json:"subquery,omitempty"`
+	run      SubqueryFunc
+}
+
+// SubqueryFunc executes a bound subquery for one outer row.
+type SubqueryFunc func(outer map[string]interface{}) (rows []map[string]interface{}, columns []string, err error)
+
+// BindSubquery attaches the function used to execute n.Subquery.
+func (n *ExpressionNode) BindSubquery(fn SubqueryFunc) {
+	n.run = fn
+}
+
+// Children returns the direct sub-expressions of n (not the nodes inside
+// n.Subquery, which belong to another query).
+func (n *ExpressionNode) Children() []*ExpressionNode {
+	children := []*ExpressionNode{}
+	for _, child := range append([]*ExpressionNode{n.Left, n.Right, n.Else, n.Escape}, n.Args...) {
+		if child != nil {
+			children = append(children, child)
+		}
+	}
+	for _, branch := range n.Whens {
+		children = append(children, branch.When, branch.Then)
+	}
+	if n.Window != nil {
+		children = append(children, n.Window.PartitionBy...)
+		for _, item := range n.Window.OrderBy {
+			children = append(children, item.Expr)
+		}
+	}
+	return children
+}
+
+// MapChildren returns a shallow copy of n with every direct sub-expression
+// replaced by f(child); n itself is left unchanged.
+func (n *ExpressionNode) MapChildren(f func(*ExpressionNode) *ExpressionNode) *ExpressionNode {
+	out := *n
+	apply := func(child *ExpressionNode) *ExpressionNode {
+		if child == nil {
+			return nil
+		}
+		return f(child)
+	}
+	out.Left, out.Right, out.Else, out.Escape = apply(n.Left), apply(n.Right), apply(n.Else), apply(n.Escape)
+	if n.Args != nil {
+		out.Args = make([]*ExpressionNode, len(n.Args))
+		for i, arg := range n.Args {
+			out.Args[i] = apply(arg)
+		}
+	}
+	if n.Whens != nil {
+		out.Whens = make([]CaseWhen, len(n.Whens))
+		for i, branch := range n.Whens {
+			out.Whens[i] = CaseWhen{When: apply(branch.When), Then: apply(branch.Then)}
+		}
+	}
+	if n.Window != nil {
+		w := *n.Window
+		w.PartitionBy = make([]*ExpressionNode, len(n.Window.PartitionBy))
+		for i, key := range n.Window.PartitionBy {
+			w.PartitionBy[i] = apply(key)
+		}
+		w.OrderBy = make([]OrderByItem, len(n.Window.OrderBy))
+		for i, item := range n.Window.OrderBy {
+			w.OrderBy[i] = OrderByItem{Expr: apply(item.Expr), Desc: item.Desc}
+		}
+		out.Window = &w
+	}
+	return &out
+}
+
+// CaseWhen is one WHEN condition THEN result branch of a CASE expression.
+type CaseWhen struct {
+	When *ExpressionNode `json:"when"`
+	Then *ExpressionNode `json:"then"`
 }
@@ -0,0 +1,161 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PlanNode is one operator of a query plan, as shown by EXPLAIN. Estimated
+// rows and cost come from the planner; Actual is filled in by EXPLAIN ANALYZE.
+type PlanNode struct {
+	Operator  string      `json:"operator"`
+	Relation  string      `json:"relation,omitempty"`  // table or derived table read ("table AS alias")
+	Condition string      `json:"condition,omitempty"` // index condition, join key, sort keys ...
+	Filter    string      `json:"filter,omitempty"`    // predicate checked on every row
+	EstRows   float64     `json:"estimated_rows"`
+	EstCost   float64     `json:"estimated_cost"` // including the children
+	Actual    *PlanActual `json:"actual,omitempty"`
+	Children  []*PlanNode `json:"children,omitempty"`
+}
+
+// PlanActual is what one operator did when the query ran. Time and buffer
+// pool accesses include those of the operator's children.
+type PlanActual struct {
+	Rows         int     `json:"rows"`
+	TimeMs       float64 `json:"time_ms"`
+	BufferHits   int64   `json:"buffer_hits"`
+	BufferMisses int64   `json:"buffer_misses"`
+	Partitions   int     `json:"partitions,omitempty"` // spilled to disk (grace hash join)
+	PeakRows     int     `json:"peak_rows,omitempty"`  // most rows held at once besides input and result, when spilled
+}
+
+// FormatExpression renders expr as SQL text.
+func FormatExpression(expr *ExpressionNode) string {
+	if expr == nil {
+		return ""
+	}
+
+	switch expr.Type {
+	case ExprLiteral:
+		val, err := expr.LiteralValue()
+		if err != nil {
+			val = expr.Literal
+		}
+		switch v := val.(type) {
+		case nil:
+			return "NULL"
+		case string:
+			return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		case bool:
+			return strings.ToUpper(fmt.Sprint(v))
+		}
+		if s, err := ToString(val); err == nil {
+			return s
+		}
+		return fmt.Sprint(val)
+
+	case ExprColumn:
+		return expr.Column
+
+	case ExprBinary, ExprComparison:
+		return formatOperand(expr.Left) + " " + expr.Op + " " + formatOperand(expr.Right)
+
+	case ExprCast:
+		return "CAST(" + FormatExpression(expr.Left) + " AS " + expr.DataType + ")"
+
+	case ExprFunc:
+		args := make([]string, len(expr.Args))
+		for i, arg := range expr.Args {
+			args[i] = FormatExpression(arg)
+		}
+		if len(args) == 0 && strings.EqualFold(expr.Func, "COUNT") {
+			args = []string{"*"}
+		}
+		call := strings.ToUpper(expr.Func) + "(" + strings.Join(args, ", ") + ")"
+		if expr.Window != nil {
+			call += " OVER (" + expr.Window.String() + ")"
+		}
+		return call
+
+	case ExprCase:
+		var b strings.Builder
+		b.WriteString("CASE")
+		for _, branch := range expr.Whens {
+			b.WriteString(" WHEN " + FormatExpression(branch.When) + " THEN " + FormatExpression(branch.Then))
+		}
+		if expr.Else != nil {
+			b.WriteString(" ELSE " + FormatExpression(expr.Else))
+		}
+		b.WriteString(" END")
+		return b.String()
+
+	case ExprLogical:
+		op := strings.ToUpper(expr.Op)
+		if op == "NOT" {
+			return "NOT " + formatOperand(expr.Left)
+		}
+		// a AND b AND c needs no parentheses
+		side := func(child *ExpressionNode) string {
+			if child != nil && child.Type == ExprLogical && strings.EqualFold(child.Op, op) {
+				return FormatExpression(child)
+			}
+			return formatOperand(child)
+		}
+		return side(expr.Left) + " " + op + " " + side(expr.Right)
+
+	case ExprLike:
+		s := formatOperand(expr.Left) + negatedOp(expr.Negate, strings.ToUpper(expr.Op)) + formatOperand(expr.Right)
+		if expr.Escape != nil {
+			s += " ESCAPE " + FormatExpression(expr.Escape)
+		}
+		return s
+
+	case ExprIn:
+		if expr.Subquery != nil {
+			return formatOperand(expr.Left) + negatedOp(expr.Negate, "IN") + "(SELECT ...)"
+		}
+		args := make([]string, len(expr.Args))
+		for i, arg := range expr.Args {
+			args[i] = FormatExpression(arg)
+		}
+		return formatOperand(expr.Left) + negatedOp(expr.Negate, "IN") + "(" + strings.Join(args, ", ") + ")"
+
+	case ExprBetween:
+		if len(expr.Args) != 2 {
+			break
+		}
+		return formatOperand(expr.Left) + negatedOp(expr.Negate, "BETWEEN") +
+			formatOperand(expr.Args[0]) + " AND " + formatOperand(expr.Args[1])
+
+	case ExprSubquery:
+		return "(SELECT ...)"
+
+	case ExprExists:
+		if expr.Negate {
+			return "NOT EXISTS (SELECT ...)"
+		}
+		return "EXISTS (SELECT ...)"
+	}
+	return "?"
+}
+
+// formatOperand renders an operand of an operator, parenthesized unless it
+// is a single term.
+func formatOperand(expr *ExpressionNode) string {
+	s := FormatExpression(expr)
+	if expr == nil {
+		return s
+	}
+	switch expr.Type {
+	case ExprBinary, ExprComparison, ExprLogical, ExprLike, ExprIn, ExprBetween:
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func negatedOp(negate bool, op string) string {
+	if negate {
+		return " NOT " + op + " "
+	}
+	return " " + op + " "
+}
@@ -0,0 +1,232 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+This file contains the boolean predicates of the expression language:
+
+	AND / OR / NOT                 three-valued logic (NULL = unknown)
+	x [NOT] LIKE | ILIKE p [ESCAPE e]
+	x [NOT] IN (v1, v2, ...)
+	x [NOT] BETWEEN lo AND hi
+
+LIKE patterns use % (any run of characters) and _ (exactly one character).
+The escape character defaults to backslash; ESCAPE '' disables escaping.
+*/
+
+// DefaultLikeEscape is the escape character used when LIKE has no ESCAPE clause.
+const DefaultLikeEscape = "\\"
+
+// ApplyLogical combines two boolean values with AND or OR, or negates left
+// for NOT, following SQL three-valued logic.
+func ApplyLogical(left, right interface{}, op string) (interface{}, error) {
+	l, err := asTruth(left)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToUpper(op) {
+	case "NOT":
+		if l == nil {
+			return nil, nil
+		}
+		return !*l, nil
+	case "AND", "OR":
+	default:
+		return nil, fmt.Errorf("unknown logical operator: %s", op)
+	}
+
+	r, err := asTruth(right)
+	if err != nil {
+		return nil, err
+	}
+
+	// the dominant value decides regardless of NULLs: false for AND, true for OR
+	dominant := strings.EqualFold(op, "OR")
+	if (l != nil && *l == dominant) || (r != nil && *r == dominant) {
+		return dominant, nil
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	return !dominant, nil
+}
+
+func asTruth(v interface{}) (*bool, error) {
+	switch b := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return &b, nil
+	}
+	return nil, fmt.Errorf("boolean operator requires BOOL operands, got %s", TypeOfValue(v))
+}
+
+// negate flips a non-NULL boolean when not is set (NOT LIKE, NOT IN, NOT BETWEEN).
+func negate(v interface{}, not bool) interface{} {
+	if b, ok := v.(bool); ok && not {
+		return !b
+	}
+	return v
+}
+
+// ApplyIn reports whether value equals one of list. The result is NULL when
+// there is no match and either value or some list element is NULL.
+func ApplyIn(value interface{}, list []interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	sawNull := false
+	for _, item := range list {
+		if item == nil {
+			sawNull = true
+			continue
+		}
+		cmp, err := CompareTyped(value, item)
+		if err != nil {
+			return nil, err
+		}
+		if cmp == 0 {
+			return true, nil
+		}
+	}
+	if sawNull {
+		return nil, nil
+	}
+	return false, nil
+}
+
+// ApplyBetween evaluates low <= value AND value <= high.
+func ApplyBetween(value, low, high interface{}) (interface{}, error) {
+	geLow, err := ApplyComparison(value, low, ">=")
+	if err != nil {
+		return nil, err
+	}
+	leHigh, err := ApplyComparison(value, high, "<=")
+	if err != nil {
+		return nil, err
+	}
+	return ApplyLogical(geLow, leHigh, "AND")
+}
+
+// ApplyLike matches value against a LIKE pattern. ILIKE compares case-insensitively.
+func ApplyLike(value, pattern, escape interface{}, caseInsensitive bool) (interface{}, error) {
+	if value == nil || pattern == nil || escape == nil {
+		return nil, nil
+	}
+	s, ok1 := value.(string)
+	p, ok2 := pattern.(string)
+	e, ok3 := escape.(string)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, fmt.Errorf("LIKE requires VARCHAR operands")
+	}
+
+	tokens, err := compileLike(p, e)
+	if err != nil {
+		return nil, err
+	}
+	if caseInsensitive {
+		s = strings.ToLower(s)
+		for i := range tokens {
+			tokens[i].r = unicode.ToLower(tokens[i].r)
+		}
+	}
+	return matchLike([]rune(s), tokens), nil
+}
+
+// LikePrefix returns the literal text before the first wildcard of pattern,
+// and whether the pattern is exactly "prefix%" (so a prefix range fully
+// answers it). Used by the planner to turn LIKE into an index range scan.
+func LikePrefix(pattern, escape string) (string, bool, error) {
+	tokens, err := compileLike(pattern, escape)
+	if err != nil {
+		return "", false, err
+	}
+	var sb strings.Builder
+	i := 0
+	for ; i < len(tokens) && tokens[i].kind == likeLiteral; i++ {
+		sb.WriteRune(tokens[i].r)
+	}
+	exact := i == len(tokens)-1 && tokens[i].kind == likeAny
+	return sb.String(), exact, nil
+}
+
+type likeKind int
+
+const (
+	likeLiteral likeKind = iota
+	likeOne              // _
+	likeAny              // %
+)
+
+type likeToken struct {
+	kind likeKind
+	r    rune
+}
+
+func compileLike(pattern, escape string) ([]likeToken, error) {
+	var esc rune = -1
+	switch utf8.RuneCountInString(escape) {
+	case 0:
+	case 1:
+		esc, _ = utf8.DecodeRuneInString(escape)
+	default:
+		return nil, fmt.Errorf("invalid escape string %q: must be empty or one character", escape)
+	}
+
+	runes := []rune(pattern)
+	tokens := make([]likeToken, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == esc:
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("LIKE pattern must not end with escape character")
+			}
+			i++
+			tokens = append(tokens, likeToken{kind: likeLiteral, r: runes[i]})
+		case r == '%':
+			// collapse runs of % into one
+			if len(tokens) == 0 || tokens[len(tokens)-1].kind != likeAny {
+				tokens = append(tokens, likeToken{kind: likeAny})
+			}
+		case r == '_':
+			tokens = append(tokens, likeToken{kind: likeOne})
+		default:
+			tokens = append(tokens, likeToken{kind: likeLiteral, r: r})
+		}
+	}
+	return tokens, nil
+}
+
+// matchLike is a greedy wildcard matcher that backtracks to the last %.
+func matchLike(s []rune, tokens []likeToken) bool {
+	si, ti := 0, 0
+	starTi, starSi := -1, 0
+
+	for si < len(s) {
+		switch {
+		case ti < len(tokens) && tokens[ti].kind == likeAny:
+			starTi, starSi = ti, si
+			ti++
+		case ti < len(tokens) && (tokens[ti].kind == likeOne || tokens[ti].r == s[si]):
+			si++
+			ti++
+		case starTi != -1:
+			starSi++
+			si = starSi
+			ti = starTi + 1
+		default:
+			return false
+		}
+	}
+	for ti < len(tokens) && tokens[ti].kind == likeAny {
+		ti++
+	}
+	return ti == len(tokens)
+}
@@ -13,6 +13,16 @@ type RowPointer struct {
 	SlotIndex  uint16 `json:"slot_index"` // Index in the slot directory
 }
 
+// TupleHeader is the MVCC header every heap tuple carries: the transaction
+// that created this version of the row (Xmin), the one that deleted or
+// replaced it (Xmax, 0 while it is the live version) and the older version
+// it replaced (Prev, nil for the first one). Prev is in the same heap file.
+type TupleHeader struct {
+	Xmin uint64
+	Xmax uint64
+	Prev *RowPointer
+}
+
 type RowWithPointer struct {
 	Pointer RowPointer
 	Row     Row
@@ -1,9 +1,23 @@
 package types
 
 type ColumnDef struct {
-	Name         string `json:"name"`
-	Type         string `json:"type"`
-	IsPrimaryKey bool   `json:"is_primary_key"`
+	Name         string           `json:"name"`
+	Type         string           `json:"type"`
+	IsPrimaryKey bool             `json:"is_primary_key"`
+	Generated    *GeneratedColumn `json:"generated,omitempty"` // nil: an ordinary column
+}
+
+// GeneratedColumn is the GENERATED ALWAYS AS (expr) clause of a column. A stored
+// column is computed when its row is written and kept in the row; a virtual one
+// is not kept, and is computed whenever the row is read.
+type GeneratedColumn struct {
+	Expr   *ExpressionNode `json:"expr"`
+	Stored bool            `json:"stored,omitempty"`
+}
+
+// IsVirtual reports whether the column is generated and not stored.
+func (c ColumnDef) IsVirtual() bool {
+	return c.Generated != nil && !c.Generated.Stored
 }
 
 type ForeignKeyDef struct {
@@ -17,3 +31,44 @@ type TableSchema struct {
 	Columns     []ColumnDef     `json:"columns"`
 	ForeignKeys []ForeignKeyDef `json:"foreign_keys,omitempty"`
 }
+
+// TableStats are the optimizer statistics ANALYZE collects for a table.
+type TableStats struct {
+	RowCount  int                    `json:"row_count"`
+	PageCount int                    `json:"page_count"`
+	Columns   map[string]ColumnStats `json:"columns"` // by lower-case column name
+}
+
+// ColumnStats describe the values of one column. Histogram holds the bounds
+// of equi-depth buckets over the non-NULL values: len(Histogram)-1 buckets,
+// each with about the same number of rows, in ascending order.
+type ColumnStats struct {
+	Distinct  int     `json:"distinct"`
+	NullFrac  float64 `json:"null_frac"`
+	Histogram []any   `json:"histogram,omitempty"`
+}
+
+// ViewDef is a view kept in the catalog. A view's query is stored as SQL and
+// parsed again wherever the view is referenced; a materialized view keeps its
+// rows in the backing table Table, filled from Payload by REFRESH.
+type ViewDef struct {
+	Name         string         `json:"name"`
+	Query        string         `json:"query"`                  // the SQL after AS
+	ColumnNames  []string       `json:"column_names,omitempty"` // CREATE VIEW v (a, b, ...)
+	Columns      []ColumnDef    `json:"columns"`                // its output columns
+	DependsOn    []string       `json:"depends_on,omitempty"`   // tables and views the query reads
+	Materialized bool           `json:"materialized,omitempty"`
+	Table        string         `json:"table,omitempty"`
+	Payload      *SelectPayload `json:"payload,omitempty"`
+}
+
+// TriggerDef is a row-level trigger kept in the catalog. Its body is stored
+// as the SQL of each statement, compiled again (with NEW and OLD bound to the
+// row) every time it fires.
+type TriggerDef struct {
+	Name   string   `json:"name"`
+	Table  string   `json:"table"`
+	Timing string   `json:"timing"` // BEFORE | AFTER
+	Event  string   `json:"event"`  // INSERT | UPDATE | DELETE
+	Body   []string `json:"body"`
+}
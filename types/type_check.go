@@ -0,0 +1,276 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+This file contains plan-time type checking of expression trees.
+The VM runs these checks against the catalog schema before handing a
+statement to the storage engine, so type mismatches surface as errors
+before any row is read or written.
+*/
+
+// ColumnTypeResolver returns the declared SQL type of a column reference.
+type ColumnTypeResolver func(column string) (string, error)
+
+// ErrColumnNotFound is returned (wrapped) by resolvers for unknown columns.
+var ErrColumnNotFound = errors.New("column not found")
+
+// ChainResolvers tries inner first and falls back to outer for columns inner
+// does not know. Subqueries use it to resolve correlated references.
+func ChainResolvers(inner, outer ColumnTypeResolver) ColumnTypeResolver {
+	if outer == nil {
+		return inner
+	}
+	return func(column string) (string, error) {
+		typ, err := inner(column)
+		if errors.Is(err, ErrColumnNotFound) {
+			return outer(column)
+		}
+		return typ, err
+	}
+}
+
+// SchemaResolver builds a resolver over one or more table schemas.
+// Columns may be referenced as "col" or "table.col"; an unqualified name
+// that exists in more than one table is reported as ambiguous.
+func SchemaResolver(schemas ...TableSchema) ColumnTypeResolver {
+	qualified := make(map[string]string)
+	unqualified := make(map[string][]string)
+
+	for _, schema := range schemas {
+		for _, col := range schema.Columns {
+			typ, err := NormalizeType(col.Type)
+			if err != nil {
+				typ = strings.ToUpper(col.Type)
+			}
+			name := strings.ToLower(col.Name)
+			qualified[strings.ToLower(schema.TableName)+"."+name] = typ
+			unqualified[name] = append(unqualified[name], typ)
+		}
+	}
+
+	return func(column string) (string, error) {
+		name := strings.ToLower(column)
+		if strings.Contains(name, ".") {
+			if typ, ok := qualified[name]; ok {
+				return typ, nil
+			}
+			return "", fmt.Errorf("%w: %s", ErrColumnNotFound, column)
+		}
+		typesFound := unqualified[name]
+		switch len(typesFound) {
+		case 0:
+			return "", fmt.Errorf("%w: %s", ErrColumnNotFound, column)
+		case 1:
+			return typesFound[0], nil
+		}
+		return "", fmt.Errorf("column reference %s is ambiguous", column)
+	}
+}
+
+// InferType returns the SQL type expr evaluates to, or an error if the
+// expression is not well typed.
+func InferType(expr *ExpressionNode, resolve ColumnTypeResolver) (string, error) {
+	if expr == nil {
+		return "", fmt.Errorf("nil expression")
+	}
+
+	switch expr.Type {
+	case ExprLiteral:
+		if expr.DataType != "" {
+			return expr.DataType, nil
+		}
+		return TypeOfValue(expr.Literal), nil
+
+	case ExprColumn:
+		return resolve(expr.Column)
+
+	case ExprBinary:
+		lt, err := InferType(expr.Left, resolve)
+		if err != nil {
+			return "", err
+		}
+		rt, err := InferType(expr.Right, resolve)
+		if err != nil {
+			return "", err
+		}
+		for _, t := range []string{lt, rt} {
+			if t != TypeNull && !IsNumericType(t) {
+				return "", fmt.Errorf("operator %s requires numeric operands, got %s and %s", expr.Op, lt, rt)
+			}
+		}
+		common, err := CommonType(lt, rt)
+		if err != nil {
+			return "", err
+		}
+		if common == TypeNull {
+			return TypeInt, nil
+		}
+		return common, nil
+
+	case ExprComparison:
+		lt, err := InferType(expr.Left, resolve)
+		if err != nil {
+			return "", err
+		}
+		rt, err := InferType(expr.Right, resolve)
+		if err != nil {
+			return "", err
+		}
+		if _, err := CommonType(lt, rt); err != nil {
+			return "", fmt.Errorf("cannot compare %s %s %s: %w", lt, expr.Op, rt, err)
+		}
+		return TypeBool, nil
+
+	case ExprCast:
+		from, err := InferType(expr.Left, resolve)
+		if err != nil {
+			return "", err
+		}
+		if !CanExplicitCast(from, expr.DataType) {
+			return "", fmt.Errorf("cannot cast %s to %s", from, expr.DataType)
+		}
+		return expr.DataType, nil
+
+	case ExprFunc:
+		if expr.Window != nil {
+			return inferWindowType(expr, resolve)
+		}
+		fn, ok := LookupFunction(expr.Func)
+		if !ok {
+			if IsWindowFunction(expr.Func) {
+				return "", fmt.Errorf("%s requires an OVER clause", strings.ToUpper(expr.Func))
+			}
+			return "", fmt.Errorf("function %s does not exist", expr.Func)
+		}
+		argTypes := make([]string, len(expr.Args))
+		for i, arg := range expr.Args {
+			typ, err := InferType(arg, resolve)
+			if err != nil {
+				return "", err
+			}
+			argTypes[i] = typ
+		}
+		return fn.CheckArgs(argTypes)
+
+	case ExprCase:
+		// every WHEN must be boolean and all results must share a common type
+		result := TypeNull
+		for _, branch := range expr.Whens {
+			if err := CheckPredicate(branch.When, resolve); err != nil {
+				return "", fmt.Errorf("CASE WHEN: %w", err)
+			}
+			typ, err := InferType(branch.Then, resolve)
+			if err != nil {
+				return "", err
+			}
+			if result, err = CommonType(result, typ); err != nil {
+				return "", fmt.Errorf("CASE branches: %w", err)
+			}
+		}
+		if expr.Else != nil {
+			typ, err := InferType(expr.Else, resolve)
+			if err != nil {
+				return "", err
+			}
+			if result, err = CommonType(result, typ); err != nil {
+				return "", fmt.Errorf("CASE branches: %w", err)
+			}
+		}
+		return result, nil
+
+	case ExprLogical:
+		for _, operand := range []*ExpressionNode{expr.Left, expr.Right} {
+			if operand == nil {
+				continue
+			}
+			if err := CheckPredicate(operand, resolve); err != nil {
+				return "", fmt.Errorf("%s: %w", strings.ToUpper(expr.Op), err)
+			}
+		}
+		return TypeBool, nil
+
+	case ExprLike:
+		for _, operand := range []*ExpressionNode{expr.Left, expr.Right, expr.Escape} {
+			if operand == nil {
+				continue
+			}
+			typ, err := InferType(operand, resolve)
+			if err != nil {
+				return "", err
+			}
+			if typ != TypeVarchar && typ != TypeNull {
+				return "", fmt.Errorf("%s requires VARCHAR operands, got %s (use CAST)", strings.ToUpper(expr.Op), typ)
+			}
+		}
+		return TypeBool, nil
+
+	case ExprSubquery:
+		if expr.DataType == "" {
+			return "", fmt.Errorf("subquery has not been type checked")
+		}
+		return expr.DataType, nil
+
+	case ExprExists:
+		return TypeBool, nil
+
+	case ExprIn, ExprBetween:
+		lt, err := InferType(expr.Left, resolve)
+		if err != nil {
+			return "", err
+		}
+		if expr.Subquery != nil {
+			if expr.DataType == "" {
+				return "", fmt.Errorf("subquery has not been type checked")
+			}
+			if _, err := CommonType(lt, expr.DataType); err != nil {
+				return "", err
+			}
+			return TypeBool, nil
+		}
+		for _, arg := range expr.Args {
+			at, err := InferType(arg, resolve)
+			if err != nil {
+				return "", err
+			}
+			if _, err := CommonType(lt, at); err != nil {
+				return "", err
+			}
+		}
+		return TypeBool, nil
+	}
+
+	return "", fmt.Errorf("unsupported expression type: %d", expr.Type)
+}
+
+// CheckPredicate verifies that expr is a well-typed boolean expression.
+func CheckPredicate(expr *ExpressionNode, resolve ColumnTypeResolver) error {
+	typ, err := InferType(expr, resolve)
+	if err != nil {
+		return err
+	}
+	if typ != TypeBool && typ != TypeNull {
+		return fmt.Errorf("condition must be boolean, got %s", typ)
+	}
+	return nil
+}
+
+// CheckAssignable verifies that expr can be stored in a column of colType.
+func CheckAssignable(expr *ExpressionNode, colName, colType string, resolve ColumnTypeResolver) error {
+	typ, err := InferType(expr, resolve)
+	if err != nil {
+		return err
+	}
+	target, err := NormalizeType(colType)
+	if err != nil {
+		return err
+	}
+	if !CanImplicitCast(typ, target) {
+		return fmt.Errorf("column %s is %s but expression is %s (use CAST)", colName, target, typ)
+	}
+	return nil
+}
@@ -1,40 +1,49 @@
 package types
 
 import (
+	"errors"
 	"fmt"
-	"reflect"
 	"strconv"
 	"strings"
 )
 
+// ToInt converts v to the int32 an INT column stores. A value outside the
+// range of an INT is ErrIntOutOfRange.
 func ToInt(v any) (int32, error) {
+	var (
+		i   int
+		err error
+	)
 	switch x := v.(type) {
 	case int:
-		return int32(x), nil
+		i, err = checkInt(x)
 	case int32:
 		return x, nil
 	case int64:
-		return int32(x), nil
+		i, err = checkInt(int(x))
 	case float64:
-		return int32(x), nil
+		i, err = truncInt(x)
 	case float32:
-		return int32(x), nil
+		i, err = truncInt(float64(x))
 	case string:
-		i, err := strconv.Atoi(x)
-		if err != nil {
-			return 0, fmt.Errorf("cannot convert %q to int", x)
-		}
-		return int32(i), nil
+		i, err = toIntString(x)
 	case []byte:
-		s := strings.TrimSpace(string(x))
-		i, err := strconv.Atoi(s)
-		if err != nil {
-			return 0, fmt.Errorf("cannot convert %q to int", s)
-		}
-		return int32(i), nil
+		i, err = toIntString(string(x))
 	default:
 		return 0, fmt.Errorf("expected int, got %T", v)
 	}
+	if err != nil {
+		return 0, err
+	}
+	return int32(i), nil
+}
+
+func toIntString(s string) (int, error) {
+	i, err := parseInt(s)
+	if err != nil && !errors.Is(err, ErrIntOutOfRange) {
+		return 0, fmt.Errorf("cannot convert %q to int", strings.TrimSpace(s))
+	}
+	return i, err
 }
 
 func ToString(v any) (string, error) {
@@ -82,67 +91,14 @@ func ToFloat(v any) (float32, error) {
 	}
 }
 
-func isInteger(v reflect.Value) bool {
-	kind := v.Kind()
-	return kind >= reflect.Int && kind <= reflect.Int64
-}
-
-func isFloat(v reflect.Value) bool {
-	kind := v.Kind()
-	return kind == reflect.Float32 || kind == reflect.Float64
-}
-
+// CompareValues orders two values for sorting and merge joins.
+// Values are compared in their common type (see CompareTyped); values whose
+// types have no common type are ordered by type rank instead of falling back
+// to their string form, so the result is always deterministic.
 func CompareValues(v1, v2 interface{}) int {
-	if v1 == nil || v2 == nil {
-		if v1 == v2 {
-			return 0
-		}
-		if v1 == nil {
-			return -1
-		}
-		return 1
-	}
-
-	val1 := reflect.ValueOf(v1)
-	val2 := reflect.ValueOf(v2)
-
-	switch {
-	case isInteger(val1) && isInteger(val2):
-		i1, i2 := val1.Int(), val2.Int()
-		if i1 < i2 {
-			return -1
-		}
-		if i1 > i2 {
-			return 1
-		}
-		return 0
-	case isFloat(val1) || isFloat(val2):
-		var f1, f2 float64
-		if isFloat(val1) {
-			f1 = val1.Float()
-		} else {
-			f1 = float64(val1.Int())
-		}
-		if isFloat(val2) {
-			f2 = val2.Float()
-		} else {
-			f2 = float64(val2.Int())
-		}
-		if f1 < f2 {
-			return -1
-		}
-		if f1 > f2 {
-			return 1
-		}
-		return 0
-	default:
-		s1, s2 := fmt.Sprintf("%v", v1), fmt.Sprintf("%v", v2)
-		if s1 < s2 {
-			return -1
-		}
-		if s1 > s2 {
-			return 1
-		}
-		return 0
+	cmp, err := CompareTyped(v1, v2)
+	if err == nil {
+		return cmp
 	}
+	return cmpOrdered(typeRank(TypeOfValue(v1)), typeRank(TypeOfValue(v2)))
 }
@@ -0,0 +1,363 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+This file contains the type system used by the query layer.
+
+Every value flowing through the executor has one of the SQL types below.
+Their runtime (Go) representation is fixed:
+
+	INT     → int, within the range of an int32 (INT columns are stored in 4
+	          bytes); a value outside it is ErrIntOutOfRange, never wrapped
+	FLOAT   → float64
+	VARCHAR → string
+	BOOL    → bool
+	NULL    → nil
+
+Implicit casts (applied silently when two operands meet, or when a value is
+assigned to a column):
+
+	NULL → any type
+	INT  → FLOAT
+
+Everything else (VARCHAR ↔ INT/FLOAT, BOOL ↔ anything) must be written as an
+explicit CAST(x AS type) or x::type. This keeps '10' < '9' a string comparison
+and makes int_col = '10' a type error instead of a silent string compare.
+*/
+
+const (
+	TypeInt     = "INT"
+	TypeFloat   = "FLOAT"
+	TypeVarchar = "VARCHAR"
+	TypeBool    = "BOOL"
+	TypeNull    = "NULL"
+)
+
+// MinInt and MaxInt bound the values of type INT.
+const (
+	MinInt = math.MinInt32
+	MaxInt = math.MaxInt32
+)
+
+// ErrIntOutOfRange is returned for an INT value that does not fit in an int32.
+var ErrIntOutOfRange = errors.New("integer out of range")
+
+// checkInt returns i, or ErrIntOutOfRange if it is outside [MinInt, MaxInt].
+func checkInt(i int) (int, error) {
+	if i < MinInt || i > MaxInt {
+		return 0, fmt.Errorf("%w: %d", ErrIntOutOfRange, i)
+	}
+	return i, nil
+}
+
+// truncInt truncates x towards zero, or returns ErrIntOutOfRange if the
+// result is outside [MinInt, MaxInt] (or x is NaN).
+func truncInt(x float64) (int, error) {
+	t := math.Trunc(x)
+	if !(t >= MinInt && t <= MaxInt) {
+		return 0, fmt.Errorf("%w: %v", ErrIntOutOfRange, x)
+	}
+	return int(t), nil
+}
+
+// parseInt parses the INT written in s.
+func parseInt(s string) (int, error) {
+	i, err := strconv.Atoi(strings.TrimSpace(s))
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("%w: %s", ErrIntOutOfRange, strings.TrimSpace(s))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return checkInt(i)
+}
+
+// NormalizeType maps a user-written type name (including common aliases)
+// to one of the canonical type names above.
+func NormalizeType(name string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "INT", "INTEGER", "BIGINT", "SMALLINT":
+		return TypeInt, nil
+	case "FLOAT", "REAL", "DOUBLE", "DECIMAL", "NUMERIC":
+		return TypeFloat, nil
+	case "VARCHAR", "TEXT", "STRING", "CHAR":
+		return TypeVarchar, nil
+	case "BOOL", "BOOLEAN":
+		return TypeBool, nil
+	case "NULL":
+		return TypeNull, nil
+	}
+	return "", fmt.Errorf("unknown type %q", name)
+}
+
+// IsNumericType reports whether typ is INT or FLOAT.
+func IsNumericType(typ string) bool {
+	return typ == TypeInt || typ == TypeFloat
+}
+
+// TypeOfValue returns the SQL type of a runtime value.
+func TypeOfValue(v any) string {
+	switch v.(type) {
+	case nil:
+		return TypeNull
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return TypeInt
+	case float32, float64:
+		return TypeFloat
+	case string, []byte:
+		return TypeVarchar
+	case bool:
+		return TypeBool
+	}
+	return ""
+}
+
+// CanImplicitCast reports whether a value of type from may be used where
+// type to is expected without an explicit CAST.
+func CanImplicitCast(from, to string) bool {
+	if from == to || from == TypeNull {
+		return true
+	}
+	return from == TypeInt && to == TypeFloat
+}
+
+// CanExplicitCast reports whether CAST(from AS to) is allowed.
+// Whether a particular value converts successfully is decided at runtime.
+func CanExplicitCast(from, to string) bool {
+	if CanImplicitCast(from, to) {
+		return true
+	}
+	switch to {
+	case TypeInt, TypeFloat:
+		return from == TypeInt || from == TypeFloat || from == TypeVarchar || from == TypeBool
+	case TypeVarchar:
+		return true
+	case TypeBool:
+		return from == TypeInt || from == TypeVarchar
+	}
+	return false
+}
+
+// CommonType returns the type both operands are implicitly cast to before
+// they are compared or combined.
+func CommonType(a, b string) (string, error) {
+	switch {
+	case a == b:
+		return a, nil
+	case a == TypeNull:
+		return b, nil
+	case b == TypeNull:
+		return a, nil
+	case CanImplicitCast(a, b):
+		return b, nil
+	case CanImplicitCast(b, a):
+		return a, nil
+	}
+	return "", fmt.Errorf("type mismatch: %s and %s are not compatible (use CAST)", a, b)
+}
+
+// normalizeValue converts a Go value into the canonical runtime
+// representation of its SQL type (e.g. int32 → int, float32 → float64).
+func normalizeValue(v any) any {
+	switch x := v.(type) {
+	case int8:
+		return int(x)
+	case int16:
+		return int(x)
+	case int32:
+		return int(x)
+	case int64:
+		return int(x)
+	case uint8:
+		return int(x)
+	case uint16:
+		return int(x)
+	case uint32:
+		return int(x)
+	case float32:
+		return float64(x)
+	case []byte:
+		return string(x)
+	}
+	return v
+}
+
+// CoerceValue applies an implicit cast. It fails if the value's type cannot
+// be implicitly cast to typ.
+func CoerceValue(v any, typ string) (any, error) {
+	from := TypeOfValue(v)
+	if !CanImplicitCast(from, typ) {
+		return nil, fmt.Errorf("cannot implicitly cast %s to %s (use CAST)", from, typ)
+	}
+	return CastValue(v, typ)
+}
+
+// CastValue applies an explicit cast, converting v to typ.
+func CastValue(v any, typ string) (any, error) {
+	v = normalizeValue(v)
+	if v == nil {
+		return nil, nil
+	}
+
+	switch typ {
+	case TypeInt:
+		switch x := v.(type) {
+		case int:
+			return checkInt(x)
+		case float64:
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				return nil, fmt.Errorf("cannot cast %v to INT", x)
+			}
+			return truncInt(x)
+		case string:
+			i, err := parseInt(x)
+			if errors.Is(err, ErrIntOutOfRange) {
+				return nil, err
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid input for INT: %q", x)
+			}
+			return i, nil
+		case bool:
+			if x {
+				return 1, nil
+			}
+			return 0, nil
+		}
+
+	case TypeFloat:
+		switch x := v.(type) {
+		case int:
+			return float64(x), nil
+		case float64:
+			return x, nil
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid input for FLOAT: %q", x)
+			}
+			return f, nil
+		case bool:
+			if x {
+				return 1.0, nil
+			}
+			return 0.0, nil
+		}
+
+	case TypeVarchar:
+		switch x := v.(type) {
+		case string:
+			return x, nil
+		case int:
+			return strconv.Itoa(x), nil
+		case float64:
+			return strconv.FormatFloat(x, 'g', -1, 64), nil
+		case bool:
+			if x {
+				return "true", nil
+			}
+			return "false", nil
+		}
+
+	case TypeBool:
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case int:
+			return x != 0, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(x))
+			if err != nil {
+				return nil, fmt.Errorf("invalid input for BOOL: %q", x)
+			}
+			return b, nil
+		}
+
+	case TypeNull:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("cannot cast %s to %s", TypeOfValue(v), typ)
+}
+
+// CompareTyped compares two values after casting them to their common type.
+// NULL sorts before every other value. It returns an error when the types
+// have no common type.
+func CompareTyped(v1, v2 any) (int, error) {
+	if v1 == nil || v2 == nil {
+		switch {
+		case v1 == nil && v2 == nil:
+			return 0, nil
+		case v1 == nil:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+
+	common, err := CommonType(TypeOfValue(v1), TypeOfValue(v2))
+	if err != nil {
+		return 0, err
+	}
+	a, err := CastValue(v1, common)
+	if err != nil {
+		return 0, err
+	}
+	b, err := CastValue(v2, common)
+	if err != nil {
+		return 0, err
+	}
+
+	switch common {
+	case TypeInt:
+		return cmpOrdered(a.(int), b.(int)), nil
+	case TypeFloat:
+		return cmpOrdered(a.(float64), b.(float64)), nil
+	case TypeVarchar:
+		return strings.Compare(a.(string), b.(string)), nil
+	case TypeBool:
+		ab, bb := a.(bool), b.(bool)
+		switch {
+		case ab == bb:
+			return 0, nil
+		case !ab:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare values of type %s", common)
+}
+
+func cmpOrdered[T int | float64](a, b T) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// typeRank orders values of incompatible types so that sorting mixed
+// columns stays deterministic: NULL < BOOL < numbers < VARCHAR.
+func typeRank(typ string) int {
+	switch typ {
+	case TypeNull:
+		return 0
+	case TypeBool:
+		return 1
+	case TypeInt, TypeFloat:
+		return 2
+	case TypeVarchar:
+		return 3
+	}
+	return 4
+}
@@ -0,0 +1,278 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+This file contains the window functions, which are computed over a set of
+rows related to the current one instead of from the current row alone:
+
+	name '(' [args] ')' OVER '(' [PARTITION BY expr, ...] [ORDER BY key, ...] [frame] ')'
+
+	ranking:     ROW_NUMBER(), RANK(), DENSE_RANK()
+	offset:      LAG(x [, n [, default]]), LEAD(x [, n [, default]])
+	frame:       FIRST_VALUE(x), LAST_VALUE(x)
+	aggregates:  COUNT(*), COUNT(x), SUM(x), AVG(x), MIN(x), MAX(x)
+
+The frame limits the rows FIRST_VALUE, LAST_VALUE and the aggregates see:
+
+	ROWS  | RANGE  BETWEEN start AND end        (or just start: end is CURRENT ROW)
+	bound := UNBOUNDED PRECEDING | n PRECEDING | CURRENT ROW | n FOLLOWING | UNBOUNDED FOLLOWING
+
+ROWS counts rows, RANGE compares the value of the single ORDER BY key (CURRENT
+ROW is the current row and its peers, the rows with an equal ORDER BY key).
+Without a frame the window is the whole partition, or with ORDER BY, RANGE
+BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW, which makes SUM a running total.
+
+The storage engine evaluates windows (window.go there); here they are only
+described and type checked.
+*/
+
+// Frame bound kinds.
+const (
+	BoundUnboundedPreceding = "UNBOUNDED PRECEDING"
+	BoundPreceding          = "PRECEDING"
+	BoundCurrentRow         = "CURRENT ROW"
+	BoundFollowing          = "FOLLOWING"
+	BoundUnboundedFollowing = "UNBOUNDED FOLLOWING"
+)
+
+// WindowSpec is the OVER clause of a window function call.
+type WindowSpec struct {
+	PartitionBy []*ExpressionNode `json:"partition_by,omitempty"`
+	OrderBy     []OrderByItem     `json:"order_by,omitempty"`
+	Frame       *WindowFrame      `json:"frame,omitempty"`
+}
+
+// WindowFrame is ROWS | RANGE BETWEEN Start AND End.
+type WindowFrame struct {
+	Mode  string     `json:"mode"` // "ROWS" or "RANGE"
+	Start FrameBound `json:"start"`
+	End   FrameBound `json:"end"`
+}
+
+// FrameBound is one end of a window frame; Offset is n of n PRECEDING/FOLLOWING.
+type FrameBound struct {
+	Kind   string  `json:"kind"`
+	Offset float64 `json:"offset,omitempty"`
+}
+
+// boundOrder ranks bound kinds from the start of a partition to its end.
+var boundOrder = map[string]int{
+	BoundUnboundedPreceding: 0,
+	BoundPreceding:          1,
+	BoundCurrentRow:         2,
+	BoundFollowing:          3,
+	BoundUnboundedFollowing: 4,
+}
+
+// Validate checks that the frame can contain rows at all.
+func (f *WindowFrame) Validate() error {
+	if f.Start.Kind == BoundUnboundedFollowing {
+		return fmt.Errorf("frame start cannot be UNBOUNDED FOLLOWING")
+	}
+	if f.End.Kind == BoundUnboundedPreceding {
+		return fmt.Errorf("frame end cannot be UNBOUNDED PRECEDING")
+	}
+	if boundOrder[f.Start.Kind] > boundOrder[f.End.Kind] {
+		return fmt.Errorf("frame starting from %s cannot end with %s", f.Start, f.End)
+	}
+	for _, b := range []FrameBound{f.Start, f.End} {
+		if b.Offset < 0 {
+			return fmt.Errorf("frame offset must not be negative")
+		}
+		if f.Mode == "ROWS" && b.Offset != float64(int64(b.Offset)) {
+			return fmt.Errorf("ROWS frame offset must be an integer")
+		}
+	}
+	return nil
+}
+
+// HasOffset reports whether either bound is n PRECEDING or n FOLLOWING.
+func (f *WindowFrame) HasOffset() bool {
+	for _, b := range []FrameBound{f.Start, f.End} {
+		if b.Kind == BoundPreceding || b.Kind == BoundFollowing {
+			return true
+		}
+	}
+	return false
+}
+
+func (b FrameBound) String() string {
+	if b.Kind == BoundPreceding || b.Kind == BoundFollowing {
+		return strconv.FormatFloat(b.Offset, 'f', -1, 64) + " " + b.Kind
+	}
+	return b.Kind
+}
+
+func (f *WindowFrame) String() string {
+	return f.Mode + " BETWEEN " + f.Start.String() + " AND " + f.End.String()
+}
+
+// String renders the contents of the OVER clause.
+func (w *WindowSpec) String() string {
+	parts := []string{}
+	if len(w.PartitionBy) > 0 {
+		keys := make([]string, len(w.PartitionBy))
+		for i, expr := range w.PartitionBy {
+			keys[i] = FormatExpression(expr)
+		}
+		parts = append(parts, "PARTITION BY "+strings.Join(keys, ", "))
+	}
+	if len(w.OrderBy) > 0 {
+		keys := make([]string, len(w.OrderBy))
+		for i, item := range w.OrderBy {
+			keys[i] = FormatExpression(item.Expr)
+			if item.Desc {
+				keys[i] += " DESC"
+			}
+		}
+		parts = append(parts, "ORDER BY "+strings.Join(keys, ", "))
+	}
+	if w.Frame != nil {
+		parts = append(parts, w.Frame.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// windowOnly are the functions that exist only as window functions, with
+// their argument counts.
+var windowOnly = map[string][2]int{
+	"ROW_NUMBER":  {0, 0},
+	"RANK":        {0, 0},
+	"DENSE_RANK":  {0, 0},
+	"LAG":         {1, 3},
+	"LEAD":        {1, 3},
+	"FIRST_VALUE": {1, 1},
+	"LAST_VALUE":  {1, 1},
+}
+
+// windowAggregates are the aggregate functions; there is no GROUP BY, so
+// they can only be used with OVER.
+var windowAggregates = map[string][2]int{
+	"COUNT": {0, 1},
+	"SUM":   {1, 1},
+	"AVG":   {1, 1},
+	"MIN":   {1, 1},
+	"MAX":   {1, 1},
+}
+
+// IsWindowFunction reports whether name is a window or aggregate function.
+func IsWindowFunction(name string) bool {
+	name = strings.ToUpper(name)
+	_, window := windowOnly[name]
+	_, aggregate := windowAggregates[name]
+	return window || aggregate
+}
+
+// ContainsWindow reports whether expr calls a window function anywhere
+// outside subqueries.
+func ContainsWindow(expr *ExpressionNode) bool {
+	if expr == nil {
+		return false
+	}
+	if expr.Type == ExprFunc && expr.Window != nil {
+		return true
+	}
+	for _, child := range expr.Children() {
+		if ContainsWindow(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// inferWindowType type checks a call of a window function and returns its
+// result type.
+func inferWindowType(expr *ExpressionNode, resolve ColumnTypeResolver) (string, error) {
+	name := strings.ToUpper(expr.Func)
+	counts, ok := windowOnly[name]
+	if !ok {
+		if counts, ok = windowAggregates[name]; !ok {
+			return "", fmt.Errorf("function %s is not a window function", name)
+		}
+	}
+	if len(expr.Args) < counts[0] || len(expr.Args) > counts[1] {
+		return "", fmt.Errorf("function %s: wrong number of arguments (%d)", name, len(expr.Args))
+	}
+
+	argTypes := make([]string, len(expr.Args))
+	for i, arg := range expr.Args {
+		if ContainsWindow(arg) {
+			return "", fmt.Errorf("window function calls cannot be nested")
+		}
+		typ, err := InferType(arg, resolve)
+		if err != nil {
+			return "", err
+		}
+		argTypes[i] = typ
+	}
+	if err := checkWindowSpec(expr.Window, resolve); err != nil {
+		return "", err
+	}
+
+	switch name {
+	case "ROW_NUMBER", "RANK", "DENSE_RANK", "COUNT":
+		return TypeInt, nil
+
+	case "LAG", "LEAD":
+		if len(argTypes) > 1 && argTypes[1] != TypeInt && argTypes[1] != TypeNull {
+			return "", fmt.Errorf("function %s: offset must be INT, got %s", name, argTypes[1])
+		}
+		if len(argTypes) > 2 {
+			common, err := CommonType(argTypes[0], argTypes[2])
+			if err != nil {
+				return "", fmt.Errorf("function %s: default: %w", name, err)
+			}
+			return common, nil
+		}
+		return argTypes[0], nil
+
+	case "SUM", "AVG":
+		if argTypes[0] != TypeNull && !IsNumericType(argTypes[0]) {
+			return "", fmt.Errorf("function %s: argument must be numeric, got %s (use CAST)", name, argTypes[0])
+		}
+		if name == "AVG" || argTypes[0] == TypeFloat {
+			return TypeFloat, nil
+		}
+		return TypeInt, nil
+	}
+	// FIRST_VALUE, LAST_VALUE, MIN, MAX
+	return argTypes[0], nil
+}
+
+// checkWindowSpec type checks the keys of an OVER clause.
+func checkWindowSpec(w *WindowSpec, resolve ColumnTypeResolver) error {
+	keys := append([]*ExpressionNode{}, w.PartitionBy...)
+	for _, item := range w.OrderBy {
+		keys = append(keys, item.Expr)
+	}
+	for _, key := range keys {
+		if ContainsWindow(key) {
+			return fmt.Errorf("window function calls cannot be nested")
+		}
+		if _, err := InferType(key, resolve); err != nil {
+			return err
+		}
+	}
+
+	if w.Frame == nil {
+		return nil
+	}
+	if err := w.Frame.Validate(); err != nil {
+		return err
+	}
+	if w.Frame.Mode == "RANGE" && w.Frame.HasOffset() {
+		if len(w.OrderBy) != 1 {
+			return fmt.Errorf("RANGE with offset PRECEDING/FOLLOWING requires exactly one ORDER BY column")
+		}
+		typ, _ := InferType(w.OrderBy[0].Expr, resolve)
+		if !IsNumericType(typ) {
+			return fmt.Errorf("RANGE with offset PRECEDING/FOLLOWING requires a numeric ORDER BY column, got %s", typ)
+		}
+	}
+	return nil
+}